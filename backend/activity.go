@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ---------- Activity Feed ----------
+
+// GET /activity?project=&kind=&actor=&document_id=&since=&until=&limit=&cursor= lists what
+// happened most recent first: uploads, submissions, and suggestion reviews. A review of many
+// suggestions at once is one event with counts. Pass the returned next_cursor as cursor to get
+// the following page; it is omitted on the last page.
+
+const (
+	activityDefaultLimit = 50
+	activityMaxLimit     = 500
+)
+
+// activityKinds maps each event kind to the query producing it. Every branch names the same
+// columns, since any one may come first in the union: kind, at, document_id, project, actor,
+// ref (unique within the kind and instant), and detail.
+var activityKinds = map[string]string{
+	"upload": `SELECT 'upload' AS kind, d.created_at AS at, d.document_id, d.project, NULL::text AS actor,
+			d.document_id AS ref,
+			json_build_object('image_file', d.image_file, 'num_pages', d.num_pages, 'size_bytes', d.size_bytes) AS detail
+		FROM documents d WHERE d.created_at IS NOT NULL`,
+	"submission": `SELECT 'submission' AS kind, s.submitted_at AS at, s.document_id, d.project, s.annotator AS actor,
+			s.id::text AS ref,
+			json_build_object('annotations', s.annotations, 'created', s.created, 'removed', s.removed) AS detail
+		FROM submissions s JOIN documents d ON d.document_id = s.document_id`,
+	"review": `SELECT 'review' AS kind, g.decided_at AS at, g.document_id, d.project, g.decided_by AS actor,
+			g.document_id AS ref,
+			json_build_object('accepted', count(*) FILTER (WHERE g.status = 'accepted'),
+				'rejected', count(*) FILTER (WHERE g.status = 'rejected')) AS detail
+		FROM suggestions g JOIN documents d ON d.document_id = g.document_id
+		WHERE g.decided_at IS NOT NULL
+		GROUP BY g.decided_at, g.document_id, d.project, g.decided_by`,
+}
+
+// activityKindOrder keeps the generated query stable
+var activityKindOrder = []string{"upload", "submission", "review"}
+
+type ActivityEvent struct {
+	Kind       string          `json:"kind"`
+	At         string          `json:"at"`
+	DocumentID string          `json:"document_id"`
+	Project    string          `json:"project"`
+	Actor      string          `json:"actor,omitempty"`
+	Detail     json.RawMessage `json:"detail"`
+}
+
+// activityCursor is the position of the last event returned, encoded as "<unix micros>.<kind>.<ref>"
+type activityCursor struct {
+	at   time.Time
+	kind string
+	ref  string
+}
+
+func (c activityCursor) String() string {
+	return fmt.Sprintf("%d.%s.%s", c.at.UnixMicro(), c.kind, c.ref)
+}
+
+func parseActivityCursor(s string) (activityCursor, error) {
+	parts := strings.SplitN(s, ".", 3)
+	if len(parts) != 3 || activityKinds[parts[1]] == "" {
+		return activityCursor{}, fmt.Errorf("invalid cursor")
+	}
+	micros, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return activityCursor{}, fmt.Errorf("invalid cursor")
+	}
+	return activityCursor{at: time.UnixMicro(micros), kind: parts[1], ref: parts[2]}, nil
+}
+
+func handleActivity(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		jsonError(w, http.StatusMethodNotAllowed, "GET only")
+		return
+	}
+	q := r.URL.Query()
+
+	limit, err := intQueryParam(r, "limit", activityDefaultLimit)
+	if err != nil || limit < 1 || limit > activityMaxLimit {
+		jsonError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", activityMaxLimit))
+		return
+	}
+
+	kinds := activityKindOrder
+	if v := q.Get("kind"); v != "" {
+		kinds = nil
+		for _, k := range strings.Split(v, ",") {
+			k = strings.TrimSpace(k)
+			if activityKinds[k] == "" {
+				jsonError(w, http.StatusBadRequest, "kind must be a comma-separated list of upload, submission, review")
+				return
+			}
+			if !slices.Contains(kinds, k) {
+				kinds = append(kinds, k)
+			}
+		}
+	}
+	branches := make([]string, len(kinds))
+	for i, k := range kinds {
+		branches[i] = activityKinds[k]
+	}
+
+	var where []string
+	var args []interface{}
+	filter := func(cond string, v interface{}) {
+		args = append(args, v)
+		where = append(where, fmt.Sprintf(cond, len(args)))
+	}
+	for _, p := range []struct{ param, column string }{
+		{"project", "project"}, {"actor", "actor"}, {"document_id", "document_id"},
+	} {
+		if v := q.Get(p.param); v != "" {
+			filter(p.column+" = $%d", v)
+		}
+	}
+	for _, p := range []struct{ param, cond string }{{"since", "at >= $%d"}, {"until", "at < $%d"}} {
+		if v := q.Get(p.param); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				jsonError(w, http.StatusBadRequest, p.param+" must be an RFC 3339 timestamp")
+				return
+			}
+			filter(p.cond, t)
+		}
+	}
+	if v := q.Get("cursor"); v != "" {
+		c, err := parseActivityCursor(v)
+		if err != nil {
+			jsonError(w, http.StatusBadRequest, "cursor must come from a previous /activity")
+			return
+		}
+		args = append(args, c.at, c.kind, c.ref)
+		where = append(where, fmt.Sprintf("(at, kind, ref) < ($%d, $%d, $%d)", len(args)-2, len(args)-1, len(args)))
+	}
+
+	query := "SELECT kind, at, document_id, project, COALESCE(actor, ''), ref, detail FROM (\n" +
+		strings.Join(branches, "\nUNION ALL\n") + "\n) a"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	args = append(args, limit+1)
+	query += fmt.Sprintf(" ORDER BY at DESC, kind DESC, ref DESC LIMIT $%d", len(args))
+
+	rows, err := readDB(r.Context()).QueryContext(r.Context(), query, args...)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Activity query failed", "error", err)
+		jsonError(w, http.StatusInternalServerError, "Query failed")
+		return
+	}
+	defer rows.Close()
+
+	events := []ActivityEvent{}
+	var last activityCursor
+	hasMore := false
+	for rows.Next() {
+		if len(events) == limit {
+			hasMore = true
+			break
+		}
+		var e ActivityEvent
+		var detail []byte
+		if err := rows.Scan(&e.Kind, &last.at, &e.DocumentID, &e.Project, &e.Actor, &last.ref, &detail); err != nil {
+			jsonError(w, http.StatusInternalServerError, "Query failed")
+			return
+		}
+		last.kind = e.Kind
+		e.At = last.at.UTC().Format(time.RFC3339Nano)
+		e.Detail = detail
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		slog.ErrorContext(r.Context(), "Activity query failed", "error", err)
+		jsonError(w, http.StatusInternalServerError, "Query failed")
+		return
+	}
+
+	resp := map[string]interface{}{"events": events, "count": len(events), "has_more": hasMore}
+	if hasMore {
+		resp["next_cursor"] = last.String()
+	}
+	jsonResponse(w, http.StatusOK, resp)
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ---------- Document Names ----------
+
+// A document's id never changes once it is uploaded, but lab notebooks get renamed when they are
+// catalogued. The name people use is the document's display_name, and references are kept
+// working through aliases:
+//
+//	PATCH /documents/{id}?annotator= {"display_name": "...", "add_aliases": [...], "remove_aliases": [...]}
+//
+// Every display name a document is given is also added as an alias, so renaming leaves the old
+// name resolvable. GET /documents/{alias} redirects (308) to the document's canonical URL. An
+// alias belongs to one document and cannot be another document's id. Omitting display_name
+// keeps it; "" clears it.
+
+// maxAliasLength caps display names and aliases
+const maxAliasLength = 256
+
+type DocumentNames struct {
+	DocumentID  string   `json:"document_id"`
+	DisplayName string   `json:"display_name,omitempty"`
+	Aliases     []string `json:"aliases"`
+}
+
+type renameRequest struct {
+	DisplayName   *string  `json:"display_name"`
+	AddAliases    []string `json:"add_aliases"`
+	RemoveAliases []string `json:"remove_aliases"`
+}
+
+// check trims the names of req and rejects ones that can't be used in a document URL
+func (req *renameRequest) check() error {
+	var names []*string
+	if req.DisplayName != nil {
+		names = append(names, req.DisplayName)
+	}
+	for i := range req.AddAliases {
+		names = append(names, &req.AddAliases[i])
+	}
+	for _, n := range names {
+		*n = strings.TrimSpace(*n)
+		switch {
+		case len(*n) > maxAliasLength:
+			return fmt.Errorf("names are limited to %d bytes", maxAliasLength)
+		case strings.Contains(*n, "/"):
+			return fmt.Errorf("name %q contains a slash", *n)
+		}
+	}
+	if slices.Contains(req.AddAliases, "") {
+		return errors.New("add_aliases contains an empty name")
+	}
+	return nil
+}
+
+// errAliasTaken is returned from renameDocument when a name already refers to another document
+type errAliasTaken struct{ alias, other string }
+
+func (e errAliasTaken) Error() string {
+	return fmt.Sprintf("%q already refers to document %s", e.alias, e.other)
+}
+
+// addAlias points alias at docID unless it already names a different document
+func addAlias(ctx context.Context, tx pgx.Tx, docID, alias, actor string) error {
+	if alias == docID {
+		return nil
+	}
+	var other string
+	err := tx.QueryRow(ctx, `
+		SELECT document_id FROM documents WHERE document_id = $1
+		UNION ALL SELECT document_id FROM document_aliases WHERE alias = $1 AND document_id <> $2
+		LIMIT 1`, alias, docID).Scan(&other)
+	if err == nil {
+		return errAliasTaken{alias, other}
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+	_, err = tx.Exec(ctx, "INSERT INTO document_aliases (alias, document_id, created_by) VALUES ($1, $2, NULLIF($3, '')) ON CONFLICT (alias) DO NOTHING",
+		alias, docID, actor)
+	return err
+}
+
+// renameDocument applies req to docID in one transaction and records a document.renamed event
+func renameDocument(ctx context.Context, docID string, req renameRequest, actor string) (*DocumentNames, error) {
+	names := &DocumentNames{DocumentID: docID}
+	err := inTx(ctx, "rename_document", func(tx pgx.Tx) error {
+		var previous string
+		err := tx.QueryRow(ctx, "SELECT COALESCE(display_name, '') FROM documents WHERE document_id = $1 FOR UPDATE",
+			docID).Scan(&previous)
+		if err != nil {
+			return err
+		}
+
+		removed := []string{}
+		if len(req.RemoveAliases) > 0 {
+			rows, err := tx.Query(ctx, "DELETE FROM document_aliases WHERE document_id = $1 AND alias = ANY($2) RETURNING alias",
+				docID, req.RemoveAliases)
+			if err != nil {
+				return err
+			}
+			if removed, err = pgx.CollectRows(rows, pgx.RowTo[string]); err != nil {
+				return err
+			}
+		}
+
+		add := slices.Clone(req.AddAliases)
+		names.DisplayName = previous
+		if req.DisplayName != nil && *req.DisplayName != previous {
+			names.DisplayName = *req.DisplayName
+			if previous != "" && !slices.Contains(req.RemoveAliases, previous) {
+				add = append(add, previous)
+			}
+			if names.DisplayName != "" {
+				add = append(add, names.DisplayName)
+			}
+			if _, err := tx.Exec(ctx, "UPDATE documents SET display_name = NULLIF($2, '') WHERE document_id = $1",
+				docID, names.DisplayName); err != nil {
+				return err
+			}
+		}
+		for _, alias := range add {
+			if err := addAlias(ctx, tx, docID, alias, actor); err != nil {
+				return err
+			}
+		}
+
+		rows, err := tx.Query(ctx, "SELECT alias FROM document_aliases WHERE document_id = $1 ORDER BY created_at, alias", docID)
+		if err != nil {
+			return err
+		}
+		if names.Aliases, err = pgx.CollectRows(rows, pgx.RowTo[string]); err != nil {
+			return err
+		}
+
+		if names.DisplayName == previous && len(req.AddAliases) == 0 && len(removed) == 0 {
+			return nil
+		}
+		return enqueueEvents(ctx, tx, newEvent("document.renamed", docID, map[string]interface{}{
+			"from": previous, "to": names.DisplayName, "added_aliases": req.AddAliases, "removed_aliases": removed,
+			"renamed_by": actor,
+		}))
+	})
+	return names, err
+}
+
+// resolveDocumentAlias returns the id of the document alias refers to
+func resolveDocumentAlias(ctx context.Context, alias string) (string, error) {
+	var docID string
+	err := readPool(ctx).QueryRow(ctx, "SELECT document_id FROM document_aliases WHERE alias = $1", alias).Scan(&docID)
+	return docID, err
+}
+
+// redirectAlias sends a request for /documents/{alias} on to the document the alias refers to,
+// keeping the query. It reports whether alias was one.
+func redirectAlias(w http.ResponseWriter, r *http.Request, alias string) bool {
+	if dbDriver == "sqlite" {
+		return false
+	}
+	docID, err := resolveDocumentAlias(r.Context(), alias)
+	if err != nil {
+		if !errors.Is(err, pgx.ErrNoRows) {
+			slog.ErrorContext(r.Context(), "Resolving document alias failed", "alias", alias, "error", err)
+		}
+		return false
+	}
+	target := apiURL(r.Context(), "/documents/"+url.PathEscape(docID))
+	if r.URL.RawQuery != "" {
+		target += "?" + r.URL.RawQuery
+	}
+	http.Redirect(w, r, target, http.StatusPermanentRedirect)
+	return true
+}
+
+func handleRenameDocument(w http.ResponseWriter, r *http.Request) {
+	docID := r.PathValue("id")
+	var req renameRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+	if err := req.check(); err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	names, err := renameDocument(r.Context(), docID, req, requestUser(r))
+	var taken errAliasTaken
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		problemError(w, http.StatusNotFound, codeDocumentNotFound, "Document not found")
+	case errors.As(err, &taken):
+		jsonError(w, http.StatusConflict, taken.Error())
+	case err != nil:
+		slog.ErrorContext(r.Context(), "Renaming document failed", "document_id", docID, "error", err)
+		jsonError(w, http.StatusInternalServerError, "Failed to rename document")
+	default:
+		documentCache.forget(docID)
+		slog.InfoContext(r.Context(), "Document renamed", "document_id", docID, "display_name", names.DisplayName)
+		jsonResponse(w, http.StatusOK, names)
+	}
+}
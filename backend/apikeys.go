@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ---------- API Keys ----------
+
+// API keys are issued to people and scripts under /admin/api-keys and sent in X-API-Key. A key
+// buys its holder their own rate-limit budget (ratelimit.go) and names them for user quotas
+// (quotas.go). Only a key's SHA-256 is stored; the key itself is returned once, by the request
+// that creates it. Keys listed in API_KEYS keep working alongside these.
+//
+// Every /admin endpoint requires a key with the admin role: 401 without a known key, 403 with a
+// user key. Keys listed in ADMIN_API_KEYS are admin keys that live outside the database, which
+// is how the first managed key gets issued:
+//
+//	ADMIN_API_KEYS=<secret> corvina-backend
+//	corvina -api-key <secret> keys create -owner alice -role admin
+
+// apiKeyRefresh is how often each instance reloads the active keys, so a key created or revoked
+// on another instance takes effect there too
+var apiKeyRefresh = envDuration("API_KEY_REFRESH", 30*time.Second)
+
+// adminAPIKeys are comma-separated keys that always have the admin role
+var adminAPIKeys = envString("ADMIN_API_KEYS", "")
+
+// apiKeyRoles are the values of api_keys.role
+var apiKeyRoles = []string{"user", "admin"}
+
+// apiKeyPrefix starts every issued key, so a leaked one is recognizable in logs and secret scans
+const apiKeyPrefix = "cvk_"
+
+type APIKey struct {
+	ID        int64  `json:"id"`
+	Name      string `json:"name"`
+	Owner     string `json:"owner"`  // person or script the key was issued to
+	Prefix    string `json:"prefix"` // first characters of the key, to tell keys apart
+	Role      string `json:"role"`   // user | admin
+	CreatedAt string `json:"created_at"`
+	RevokedAt string `json:"revoked_at,omitempty"`
+	Key       string `json:"key,omitempty"` // only in the response that creates it
+}
+
+// keyHolder is who a key was issued to
+type keyHolder struct {
+	Owner string
+	Role  string
+}
+
+// keySet holds the active keys in api_keys by hash
+type keySet struct {
+	mu     sync.RWMutex
+	hashes map[string]keyHolder
+}
+
+var managedKeys = &keySet{}
+
+func (s *keySet) lookup(key string) (keyHolder, bool) {
+	if key == "" {
+		return keyHolder{}, false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	h, ok := s.hashes[hashAPIKey(key)]
+	return h, ok
+}
+
+// Keys from the environment; their holders are named by staticKeyOwner
+var (
+	staticAPIKeys   = parseAPIKeys(rateLimitAPIKeys)
+	staticAdminKeys = parseAPIKeys(adminAPIKeys)
+)
+
+// authenticate returns the holder of the request's X-API-Key, if it is a known key
+func authenticate(r *http.Request) (keyHolder, bool) {
+	key := r.Header.Get("X-API-Key")
+	if key == "" {
+		return keyHolder{}, false
+	}
+	if staticAdminKeys[key] {
+		return keyHolder{Owner: staticKeyOwner(key), Role: "admin"}, true
+	}
+	if h, ok := managedKeys.lookup(key); ok {
+		return h, true
+	}
+	if staticAPIKeys[key] {
+		return keyHolder{Owner: staticKeyOwner(key), Role: "user"}, true
+	}
+	return keyHolder{}, false
+}
+
+// staticKeyOwner names the holder of an environment key by a prefix of its hash, which is safe
+// to log and show; the key itself is a secret
+func staticKeyOwner(key string) string {
+	return "key:" + hashAPIKey(key)[:8]
+}
+
+// adminOnly lets a request through to next only with an admin key
+func adminOnly(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		holder, ok := authenticate(r)
+		switch {
+		case !ok && r.Header.Get("X-API-Key") == "":
+			problemError(w, http.StatusUnauthorized, "", "An admin API key is required in X-API-Key")
+		case !ok:
+			problemError(w, http.StatusUnauthorized, "", "Unknown or revoked API key")
+		case holder.Role != "admin":
+			problemError(w, http.StatusForbidden, "", "The API key of "+holder.Owner+" is not an admin key")
+		default:
+			next(w, r)
+		}
+	}
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// reload reads the active keys from the database
+func (s *keySet) reload(ctx context.Context) error {
+	rows, err := pool.Query(ctx, "SELECT key_hash, owner, role FROM api_keys WHERE revoked_at IS NULL")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	hashes := map[string]keyHolder{}
+	for rows.Next() {
+		var h string
+		var holder keyHolder
+		if err := rows.Scan(&h, &holder.Owner, &holder.Role); err != nil {
+			return err
+		}
+		hashes[h] = holder
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.hashes = hashes
+	s.mu.Unlock()
+	return nil
+}
+
+// runAPIKeyRefresh reloads managedKeys every API_KEY_REFRESH until ctx is cancelled
+func runAPIKeyRefresh(ctx context.Context) {
+	ticker := time.NewTicker(apiKeyRefresh)
+	defer ticker.Stop()
+	for {
+		if err := managedKeys.reload(ctx); err != nil && ctx.Err() == nil {
+			slog.Error("Loading API keys failed", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func newAPIKey() string {
+	b := make([]byte, 24)
+	rand.Read(b)
+	return apiKeyPrefix + hex.EncodeToString(b)
+}
+
+const apiKeyColumns = "id, name, owner, prefix, role, created_at, revoked_at"
+
+func scanAPIKey(scan func(...interface{}) error) (APIKey, error) {
+	var k APIKey
+	var created time.Time
+	var revoked sql.NullTime
+	if err := scan(&k.ID, &k.Name, &k.Owner, &k.Prefix, &k.Role, &created, &revoked); err != nil {
+		return k, err
+	}
+	k.CreatedAt = created.Format(time.RFC3339)
+	if revoked.Valid {
+		k.RevokedAt = revoked.Time.Format(time.RFC3339)
+	}
+	return k, nil
+}
+
+// handleAPIKeys lists (GET ?owner=&revoked=1) or issues (POST {"name": ..., "owner": ..., "role": "user"}) keys
+func handleAPIKeys(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		rows, err := db.QueryContext(r.Context(), "SELECT "+apiKeyColumns+` FROM api_keys
+			WHERE ($1 = '' OR owner = $1) AND ($2 OR revoked_at IS NULL) ORDER BY id`,
+			q.Get("owner"), queryFlag(q.Get("revoked")))
+		if err != nil {
+			jsonError(w, http.StatusInternalServerError, "Query failed")
+			return
+		}
+		defer rows.Close()
+
+		keys := []APIKey{}
+		for rows.Next() {
+			k, err := scanAPIKey(rows.Scan)
+			if err != nil {
+				continue
+			}
+			keys = append(keys, k)
+		}
+		jsonResponse(w, http.StatusOK, map[string]interface{}{
+			"keys":  keys,
+			"count": len(keys),
+		})
+
+	case http.MethodPost:
+		var req struct {
+			Name  string `json:"name"`
+			Owner string `json:"owner"`
+			Role  string `json:"role"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+		req.Name, req.Owner = strings.TrimSpace(req.Name), strings.TrimSpace(req.Owner)
+		if req.Owner == "" {
+			jsonError(w, http.StatusBadRequest, "Missing owner")
+			return
+		}
+		if req.Owner == anonymousUser {
+			jsonError(w, http.StatusBadRequest, "owner "+anonymousUser+" is reserved for requests without a key")
+			return
+		}
+		if req.Name == "" {
+			req.Name = req.Owner
+		}
+		if req.Role == "" {
+			req.Role = "user"
+		}
+		if !slices.Contains(apiKeyRoles, req.Role) {
+			jsonError(w, http.StatusBadRequest, "role must be user or admin")
+			return
+		}
+
+		key := newAPIKey()
+		prefix := key[:len(apiKeyPrefix)+8]
+		row := db.QueryRowContext(r.Context(), "INSERT INTO api_keys (name, owner, key_hash, prefix, role) VALUES ($1, $2, $3, $4, $5) RETURNING "+apiKeyColumns,
+			req.Name, req.Owner, hashAPIKey(key), prefix, req.Role)
+		k, err := scanAPIKey(row.Scan)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Creating API key failed", "error", err)
+			jsonError(w, http.StatusInternalServerError, "Failed to create key")
+			return
+		}
+		if err := managedKeys.reload(r.Context()); err != nil {
+			slog.ErrorContext(r.Context(), "Loading API keys failed", "error", err)
+		}
+		issuer, _ := authenticate(r)
+		slog.InfoContext(r.Context(), "Issued API key", "id", k.ID, "owner", k.Owner, "prefix", k.Prefix, "role", k.Role, "issued_by", issuer.Owner)
+		k.Key = key
+		jsonResponse(w, http.StatusCreated, k)
+
+	default:
+		jsonError(w, http.StatusMethodNotAllowed, "GET or POST only")
+	}
+}
+
+// handleAPIKey revokes a key: DELETE /admin/api-keys/{id}. The row is kept so the list still
+// shows who held it.
+func handleAPIKey(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		jsonError(w, http.StatusMethodNotAllowed, "DELETE only")
+		return
+	}
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "Invalid key id")
+		return
+	}
+
+	row := db.QueryRowContext(r.Context(), "UPDATE api_keys SET revoked_at = COALESCE(revoked_at, now()) WHERE id = $1 RETURNING "+apiKeyColumns, id)
+	k, err := scanAPIKey(row.Scan)
+	if err == sql.ErrNoRows {
+		jsonError(w, http.StatusNotFound, "Key not found")
+		return
+	}
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "Failed to revoke key")
+		return
+	}
+	if err := managedKeys.reload(r.Context()); err != nil {
+		slog.ErrorContext(r.Context(), "Loading API keys failed", "error", err)
+	}
+	slog.InfoContext(r.Context(), "Revoked API key", "id", k.ID, "owner", k.Owner, "prefix", k.Prefix)
+	jsonResponse(w, http.StatusOK, k)
+}
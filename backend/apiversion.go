@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ---------- API Versions ----------
+
+// The REST API is served under /api/v<N>/. The paths it had before versioning (/documents,
+// /submit, ...) still work as v1, with a Deprecation header and a Link to the versioned path.
+// Operational endpoints (health, metrics, the spec, the gRPC gateway) stay unversioned.
+//
+// A new version is only needed for a change that would break clients, such as renaming an
+// OutputJSON field. Make the change in the Go types, bump currentAPIVersion, and add an entry to
+// documentDowngrades that turns the new shape back into the old one, so clients pinned to an
+// older version, including consumers of exported documents, keep getting what they always got.
+const currentAPIVersion = 1
+
+// unversionedRoutes are the mux patterns served only at their own path
+var unversionedRoutes = map[string]bool{
+	"/healthz": true, "/readyz": true, "/metrics": true, "/openapi.json": true, "/docs/": true, "/v1/": true,
+}
+
+// documentDowngrades[v] rewrites a rendered document, in place, from the shape of version v+1
+// to the shape of version v. Versions are applied newest first down to the one requested.
+var documentDowngrades = map[int]func(doc map[string]interface{}){}
+
+type apiVersionKey struct{}
+
+// apiVersion is the version a request asked for; internal callers get the current one
+func apiVersion(ctx context.Context) int {
+	if v, ok := ctx.Value(apiVersionKey{}).(int); ok {
+		return v
+	}
+	return currentAPIVersion
+}
+
+// apiURL is the path of an API route in the version ctx's request used, for links in responses
+func apiURL(ctx context.Context, path string) string {
+	return "/api/v" + strconv.Itoa(apiVersion(ctx)) + path
+}
+
+// downgradeDocument converts a rendered document to the shape of ctx's API version
+func downgradeDocument(ctx context.Context, doc map[string]interface{}) {
+	for v := currentAPIVersion - 1; v >= apiVersion(ctx); v-- {
+		if f := documentDowngrades[v]; f != nil {
+			f(doc)
+		}
+	}
+}
+
+// needsDowngrade reports whether documents for ctx's API version differ from OutputJSON
+func needsDowngrade(ctx context.Context) bool {
+	for v := currentAPIVersion - 1; v >= apiVersion(ctx); v-- {
+		if documentDowngrades[v] != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// apiVersions routes /api/v<N>/<path> to the handler for /<path>, recording N on the request.
+// It wraps the whole handler chain so logs, metrics, and traces see the unversioned route.
+func apiVersions(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		version := 0
+		if rest, ok := strings.CutPrefix(r.URL.Path, "/api/"); ok {
+			v, path, _ := strings.Cut(rest, "/")
+			n, err := strconv.Atoi(strings.TrimPrefix(v, "v"))
+			if !strings.HasPrefix(v, "v") || err != nil || n < 1 || n > currentAPIVersion {
+				problemError(w, http.StatusNotFound, "", "Unknown API version "+v+"; the current version is v"+strconv.Itoa(currentAPIVersion))
+				return
+			}
+			prefix := "/api/" + v
+			r.URL.Path = "/" + path
+			r.URL.RawPath = strings.TrimPrefix(r.URL.RawPath, prefix)
+			if _, pattern := mux.Handler(r); unversionedRoutes[pattern] {
+				jsonError(w, http.StatusNotFound, "Not found")
+				return
+			}
+			version = n
+		} else if _, pattern := mux.Handler(r); pattern != "" && !unversionedRoutes[pattern] {
+			version = 1
+			w.Header().Set("Deprecation", "true")
+			w.Header().Set("Link", "</api/v1"+r.URL.EscapedPath()+`>; rel="successor-version"`)
+		}
+
+		if version != 0 {
+			w.Header().Set("API-Version", strconv.Itoa(version))
+			r = r.WithContext(context.WithValue(r.Context(), apiVersionKey{}, version))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// ---------- Assignments ----------
+
+// Coordinators hand specific documents to specific annotators:
+//
+//	GET    /assignments?assignee=&project=&overdue=true   list assignments
+//	POST   /assignments?annotator=<coordinator>           assign documents to one annotator
+//	PATCH  /assignments/{id}?annotator=<coordinator>      reassign or change the due date
+//	DELETE /assignments/{id}                              return the document to the pool
+//	GET    /assignments/mine?annotator=&all=true           the annotator's queue
+//
+// A document has at most one assignee. /tasks/next serves an annotator their own assignments
+// first and skips documents assigned to someone else.
+
+type Assignment struct {
+	DocumentID string `json:"document_id"`
+	Project    string `json:"project"`
+	ImageFile  string `json:"image_file"`
+	Assignee   string `json:"assignee"`
+	AssignedBy string `json:"assigned_by,omitempty"`
+	AssignedAt string `json:"assigned_at"`
+	DueAt      string `json:"due_at,omitempty"`
+	Overdue    bool   `json:"overdue"`
+	Status     string `json:"status"` // unannotated | in_progress | annotated
+}
+
+type AssignResult struct {
+	DocumentID string `json:"document_id"`
+	Status     string `json:"status"`             // assigned | reassigned | updated | conflict | not_found | error
+	Assignee   string `json:"assignee,omitempty"` // the current assignee on conflict
+	Error      string `json:"error,omitempty"`
+}
+
+// assignmentQuery lists assignments joined to their documents; $1 assignee and $2 project may
+// be "", and $3 and $4 are the task lease and heartbeat timeout for the status
+var assignmentQuery = `SELECT a.document_id, d.project, d.image_file, a.assignee, COALESCE(a.assigned_by, ''),
+		a.assigned_at, a.due_at, COALESCE(a.due_at < now(), false), ` + progressStatusSQL + `
+	FROM assignments a JOIN documents d ON d.document_id = a.document_id
+	WHERE ($1 = '' OR a.assignee = $1) AND ($2 = '' OR d.project = $2)`
+
+// parseDueDate accepts an RFC 3339 timestamp or a date, which means the end of that day (UTC)
+func parseDueDate(s string) (*time.Time, error) {
+	if s == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return nil, fmt.Errorf("due_at must be an RFC 3339 timestamp or a date (YYYY-MM-DD)")
+	}
+	t = t.Add(24*time.Hour - time.Second)
+	return &t, nil
+}
+
+// listAssignments runs assignmentQuery with extra conditions and ordering, whose arguments
+// start at $5
+func listAssignments(r *http.Request, assignee, project, extra string, args ...interface{}) ([]Assignment, error) {
+	args = append([]interface{}{assignee, project, taskLease.Seconds(), heartbeatTimeout.Seconds()}, args...)
+	rows, err := readDB(r.Context()).QueryContext(r.Context(), assignmentQuery+extra, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []Assignment{}
+	for rows.Next() {
+		var a Assignment
+		var assignedAt time.Time
+		var due sql.NullTime
+		if err := rows.Scan(&a.DocumentID, &a.Project, &a.ImageFile, &a.Assignee, &a.AssignedBy,
+			&assignedAt, &due, &a.Overdue, &a.Status); err != nil {
+			return nil, err
+		}
+		a.AssignedAt = assignedAt.UTC().Format(time.RFC3339)
+		if due.Valid {
+			a.DueAt = due.Time.UTC().Format(time.RFC3339)
+		}
+		list = append(list, a)
+	}
+	return list, rows.Err()
+}
+
+// handleAssignments lists (GET) or creates (POST) assignments: /assignments
+func handleAssignments(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		extra := ""
+		if q.Get("overdue") == "true" {
+			extra = " AND a.due_at < now()"
+		}
+		list, err := listAssignments(r, q.Get("assignee"), q.Get("project"), extra+" ORDER BY a.due_at NULLS LAST, a.assigned_at, a.document_id")
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Listing assignments failed", "error", err)
+			jsonError(w, http.StatusInternalServerError, "Query failed")
+			return
+		}
+		jsonResponse(w, http.StatusOK, map[string]interface{}{"assignments": list, "count": len(list)})
+
+	case http.MethodPost:
+		var req struct {
+			DocumentIDs []string `json:"document_ids"`
+			Assignee    string   `json:"assignee"`
+			DueAt       string   `json:"due_at"`
+			Reassign    bool     `json:"reassign"` // take documents already assigned to someone else
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+		if req.Assignee == "" || len(req.DocumentIDs) == 0 {
+			jsonError(w, http.StatusBadRequest, "assignee and document_ids are required")
+			return
+		}
+		due, err := parseDueDate(req.DueAt)
+		if err != nil {
+			jsonError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		results := make([]AssignResult, 0, len(req.DocumentIDs))
+		var nAssigned int
+		for _, id := range req.DocumentIDs {
+			res := AssignResult{DocumentID: id}
+			var previous sql.NullString
+			err := db.QueryRowContext(r.Context(), `
+				WITH prev AS (SELECT assignee FROM assignments WHERE document_id = $1)
+				INSERT INTO assignments (document_id, assignee, assigned_by, due_at)
+				SELECT document_id, $2, NULLIF($3, ''), $4 FROM documents WHERE document_id = $1
+				ON CONFLICT (document_id) DO UPDATE SET
+					assignee = EXCLUDED.assignee, assigned_by = EXCLUDED.assigned_by, due_at = EXCLUDED.due_at,
+					assigned_at = CASE WHEN assignments.assignee = EXCLUDED.assignee THEN assignments.assigned_at ELSE now() END
+				WHERE $5 OR assignments.assignee = EXCLUDED.assignee
+				RETURNING (SELECT assignee FROM prev)`,
+				id, req.Assignee, requestUser(r), due, req.Reassign).Scan(&previous)
+			switch {
+			case err == sql.ErrNoRows:
+				// Either the document is missing or someone else holds it
+				var holder string
+				err = db.QueryRowContext(r.Context(), "SELECT assignee FROM assignments WHERE document_id = $1", id).Scan(&holder)
+				if err == nil {
+					res.Status, res.Assignee = "conflict", holder
+				} else {
+					res.Status = "not_found"
+				}
+			case err != nil:
+				res.Status, res.Error = "error", err.Error()
+			case !previous.Valid:
+				res.Status = "assigned"
+				nAssigned++
+			case previous.String == req.Assignee:
+				res.Status = "updated"
+			default:
+				res.Status = "reassigned"
+				nAssigned++
+			}
+			results = append(results, res)
+		}
+
+		slog.InfoContext(r.Context(), "Documents assigned", "assignee", req.Assignee, "assigned", nAssigned, "requested", len(req.DocumentIDs))
+		jsonResponse(w, http.StatusOK, map[string]interface{}{
+			"status":   "success",
+			"assigned": nAssigned,
+			"results":  results,
+		})
+
+	default:
+		jsonError(w, http.StatusMethodNotAllowed, "GET or POST only")
+	}
+}
+
+// handleAssignment reassigns (PATCH) or removes (DELETE) one document's assignment:
+// /assignments/{id}
+func handleAssignment(w http.ResponseWriter, r *http.Request) {
+	docID := r.PathValue("id")
+	switch r.Method {
+	case http.MethodPatch:
+		var req struct {
+			Assignee *string `json:"assignee"`
+			DueAt    *string `json:"due_at"` // "" clears it
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+		if req.Assignee != nil && *req.Assignee == "" {
+			jsonError(w, http.StatusBadRequest, "assignee cannot be empty; DELETE the assignment instead")
+			return
+		}
+		var due *time.Time
+		if req.DueAt != nil {
+			var err error
+			if due, err = parseDueDate(*req.DueAt); err != nil {
+				jsonError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+
+		res, err := db.ExecContext(r.Context(), `
+			UPDATE assignments SET
+				assigned_at = CASE WHEN $2::text IS NULL OR $2 = assignee THEN assigned_at ELSE now() END,
+				assigned_by = CASE WHEN $2::text IS NULL OR $2 = assignee THEN assigned_by ELSE NULLIF($5, '') END,
+				assignee = COALESCE($2, assignee),
+				due_at = CASE WHEN $3 THEN $4 ELSE due_at END
+			WHERE document_id = $1`, docID, req.Assignee, req.DueAt != nil, due, requestUser(r))
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Updating assignment failed", "document_id", docID, "error", err)
+			jsonError(w, http.StatusInternalServerError, "Failed to update assignment")
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			jsonError(w, http.StatusNotFound, "Document is not assigned")
+			return
+		}
+		list, err := listAssignments(r, "", "", " AND a.document_id = $5", docID)
+		if err == nil && len(list) == 1 {
+			jsonResponse(w, http.StatusOK, list[0])
+			return
+		}
+		jsonResponse(w, http.StatusOK, map[string]string{"status": "success"})
+
+	case http.MethodDelete:
+		res, err := db.ExecContext(r.Context(), "DELETE FROM assignments WHERE document_id = $1", docID)
+		if err != nil {
+			jsonError(w, http.StatusInternalServerError, "Failed to remove assignment")
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			jsonError(w, http.StatusNotFound, "Document is not assigned")
+			return
+		}
+		jsonResponse(w, http.StatusOK, map[string]string{"status": "success"})
+
+	default:
+		jsonError(w, http.StatusMethodNotAllowed, "PATCH or DELETE only")
+	}
+}
+
+// handleMyAssignments lists the annotator's queue, soonest due first: GET /assignments/mine
+// Annotated documents are left out unless all=true.
+func handleMyAssignments(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		jsonError(w, http.StatusMethodNotAllowed, "GET only")
+		return
+	}
+	annotator := requestUser(r)
+	if annotator == "" {
+		jsonError(w, http.StatusBadRequest, "annotator is required")
+		return
+	}
+	extra := ""
+	if r.URL.Query().Get("all") != "true" {
+		extra = " AND " + unannotatedSQL
+	}
+	list, err := listAssignments(r, annotator, r.URL.Query().Get("project"), extra+" ORDER BY a.due_at NULLS LAST, a.assigned_at, a.document_id")
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Listing assignments failed", "error", err)
+		jsonError(w, http.StatusInternalServerError, "Query failed")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]interface{}{"annotator": annotator, "assignments": list, "count": len(list)})
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/sas"
+)
+
+// ---------- Azure Blob Storage ----------
+
+// Azure settings. AZURE_STORAGE_CONNECTION_STRING (account key) takes precedence; otherwise the
+// account is reached with the default Azure credential chain (managed identity, az login, ...).
+// Presigned URLs need an account key, so with identity credentials images are served directly.
+var (
+	azureConnectionString = envString("AZURE_STORAGE_CONNECTION_STRING", "")
+	azureAccount          = envString("AZURE_STORAGE_ACCOUNT", "")
+	azureContainer        = envString("AZURE_CONTAINER", "")
+	azurePrefix           = envString("AZURE_PREFIX", "objects/")
+	// Uploads are sent as blocks of this size
+	azureBlockSize = envInt("AZURE_BLOCK_SIZE_MB", 16)
+)
+
+type azureStorage struct {
+	client    *azblob.Client
+	container string
+	prefix    string
+}
+
+func newAzureStorage() (*azureStorage, error) {
+	if azureContainer == "" {
+		return nil, fmt.Errorf("AZURE_CONTAINER is not set")
+	}
+	var client *azblob.Client
+	var err error
+	switch {
+	case azureConnectionString != "":
+		client, err = azblob.NewClientFromConnectionString(azureConnectionString, nil)
+	case azureAccount != "":
+		var cred *azidentity.DefaultAzureCredential
+		if cred, err = azidentity.NewDefaultAzureCredential(nil); err == nil {
+			client, err = azblob.NewClient(fmt.Sprintf("https://%s.blob.core.windows.net/", azureAccount), cred, nil)
+		}
+	default:
+		return nil, fmt.Errorf("set AZURE_STORAGE_CONNECTION_STRING or AZURE_STORAGE_ACCOUNT")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := client.ServiceClient().NewContainerClient(azureContainer).GetProperties(ctx, nil); err != nil {
+		return nil, fmt.Errorf("checking container %s: %w", azureContainer, err)
+	}
+	return &azureStorage{client: client, container: azureContainer, prefix: azurePrefix}, nil
+}
+
+func (s *azureStorage) blob(key string) *blob.Client {
+	return s.client.ServiceClient().NewContainerClient(s.container).NewBlobClient(s.prefix + key)
+}
+
+func (s *azureStorage) Put(key string, src io.Reader) error {
+	contentType := mime.TypeByExtension(path.Ext(key))
+	_, err := s.client.UploadStream(context.Background(), s.container, s.prefix+key, src, &azblob.UploadStreamOptions{
+		BlockSize:   int64(azureBlockSize) << 20,
+		HTTPHeaders: &blob.HTTPHeaders{BlobContentType: &contentType},
+	})
+	return err
+}
+
+func (s *azureStorage) Get(key string) (io.ReadCloser, error) {
+	resp, err := s.client.DownloadStream(context.Background(), s.container, s.prefix+key, nil)
+	if bloberror.HasCode(err, bloberror.BlobNotFound) {
+		return nil, fmt.Errorf("object %s: %w", key, fs.ErrNotExist)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (s *azureStorage) Delete(key string) error {
+	_, err := s.client.DeleteBlob(context.Background(), s.container, s.prefix+key, nil)
+	if bloberror.HasCode(err, bloberror.BlobNotFound) {
+		return nil
+	}
+	return err
+}
+
+func (s *azureStorage) List(prefix string) ([]string, error) {
+	var keys []string
+	full := s.prefix + prefix
+	pager := s.client.NewListBlobsFlatPager(s.container, &azblob.ListBlobsFlatOptions{Prefix: &full})
+	for pager.More() {
+		page, err := pager.NextPage(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range page.Segment.BlobItems {
+			keys = append(keys, strings.TrimPrefix(*item.Name, s.prefix))
+		}
+	}
+	return keys, nil
+}
+
+func (s *azureStorage) Exists(key string) (bool, error) {
+	_, err := s.blob(key).GetProperties(context.Background(), nil)
+	if bloberror.HasCode(err, bloberror.BlobNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *azureStorage) Usage() (int, int64, error) {
+	objects, bytes := 0, int64(0)
+	pager := s.client.NewListBlobsFlatPager(s.container, &azblob.ListBlobsFlatOptions{Prefix: &s.prefix})
+	for pager.More() {
+		page, err := pager.NextPage(context.Background())
+		if err != nil {
+			return 0, 0, err
+		}
+		for _, item := range page.Segment.BlobItems {
+			objects++
+			if item.Properties != nil && item.Properties.ContentLength != nil {
+				bytes += *item.Properties.ContentLength
+			}
+		}
+	}
+	return objects, bytes, nil
+}
+
+func (s *azureStorage) ModTime(key string) (time.Time, error) {
+	props, err := s.blob(key).GetProperties(context.Background(), nil)
+	if bloberror.HasCode(err, bloberror.BlobNotFound) {
+		return time.Time{}, fmt.Errorf("object %s: %w", key, fs.ErrNotExist)
+	}
+	if err != nil || props.LastModified == nil {
+		return time.Time{}, err
+	}
+	return *props.LastModified, nil
+}
+
+// PresignGet returns a read-only SAS URL; this only works with account key credentials
+func (s *azureStorage) PresignGet(key, filename string, ttl time.Duration) (string, error) {
+	return s.blob(key).GetSASURL(sas.BlobPermissions{Read: true}, time.Now().Add(ttl), nil)
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ---------- Backups ----------
+
+// POST /admin/backup streams a gzipped tarball of everything needed to rebuild the dataset:
+//
+//	db/<table>.csv      each table in backupTables, as written by COPY ... (FORMAT csv, HEADER)
+//	objects/<key>       every object the tables reference (uploads, page images, thumbnails, snapshots)
+//	files/<doc>/<name>  files of documents uploaded before content addressing
+//	backup.json         the manifest, written last once the counts are known
+//
+// The tables are read in one REPEATABLE READ transaction, so the dump is consistent while uploads
+// and submissions carry on. Objects never change once written, so they are streamed after the
+// transaction ends.
+
+// backupFormat is bumped when the archive layout changes
+const backupFormat = 1
+
+// backupTables are dumped parents first, the order a restore loads them in. Operational state
+// (jobs, outbox, change_log, uploads in progress, API keys) is left out.
+var backupTables = []string{
+	"symbol_catalog", "documents", "document_aliases", "document_versions", "pages", "regions",
+	"components", "nodes", "connections", "text_annotations", "suggestions", "document_embeddings",
+	"submissions", "annotation_sessions", "assignments", "document_skips", "dataset_snapshots",
+	"export_schedules", "quotas", "templates",
+}
+
+// backupObjectsQuery lists the object store keys the dumped rows point at
+const backupObjectsQuery = `
+	SELECT storage_key FROM documents WHERE storage_key IS NOT NULL
+	UNION SELECT thumbnail_key FROM documents WHERE thumbnail_key IS NOT NULL
+	UNION SELECT storage_key FROM pages WHERE storage_key IS NOT NULL
+	UNION SELECT storage_key FROM document_versions WHERE storage_key IS NOT NULL
+	UNION SELECT p->>'storage_key' FROM document_versions, jsonb_array_elements(pages) p WHERE p->>'storage_key' IS NOT NULL
+	UNION SELECT storage_key FROM dataset_snapshots
+	ORDER BY 1`
+
+// backupFilesQuery lists the files of documents that predate content addressing, which live at
+// dataset/<document_id>/<file>
+const backupFilesQuery = `
+	SELECT document_id, image_file FROM documents WHERE storage_key IS NULL
+	UNION SELECT document_id, pdf_file FROM documents WHERE storage_key IS NULL AND pdf_file IS NOT NULL
+	UNION SELECT document_id, image_file FROM pages WHERE storage_key IS NULL
+	ORDER BY 1, 2`
+
+type BackupTable struct {
+	Name string `json:"name"`
+	Rows int64  `json:"rows"`
+}
+
+type BackupManifest struct {
+	Format        int           `json:"format"`
+	CreatedAt     string        `json:"created_at"`
+	SchemaVersion int           `json:"schema_version"` // latest migration applied when the dump was taken
+	Tables        []BackupTable `json:"tables"`
+	Objects       int           `json:"objects"`
+	Files         int           `json:"files"`
+	Missing       []string      `json:"missing,omitempty"` // referenced but not found; not in the archive
+}
+
+// backupRunning keeps backups on one instance from running concurrently
+var backupRunning atomic.Bool
+
+// backupDump is a consistent read of the database, spooled to local files
+type backupDump struct {
+	dir      string
+	manifest BackupManifest
+	objects  []string
+	files    [][2]string // document_id, file name
+}
+
+// dumpDatabase copies backupTables into dir and lists the files they reference
+func dumpDatabase(ctx context.Context, dir string) (*backupDump, error) {
+	tx, err := pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	d := &backupDump{dir: dir, manifest: BackupManifest{Format: backupFormat, CreatedAt: time.Now().UTC().Format(time.RFC3339)}}
+	if err := tx.QueryRow(ctx, "SELECT COALESCE(max(version), 0) FROM schema_migrations").Scan(&d.manifest.SchemaVersion); err != nil {
+		return nil, fmt.Errorf("reading schema version: %w", err)
+	}
+
+	for _, table := range backupTables {
+		f, err := os.Create(filepath.Join(dir, table+".csv"))
+		if err != nil {
+			return nil, err
+		}
+		tag, err := tx.Conn().PgConn().CopyTo(ctx, f, "COPY "+pgx.Identifier{table}.Sanitize()+" TO STDOUT WITH (FORMAT csv, HEADER true)")
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return nil, fmt.Errorf("dumping %s: %w", table, err)
+		}
+		d.manifest.Tables = append(d.manifest.Tables, BackupTable{Name: table, Rows: tag.RowsAffected()})
+	}
+
+	rows, err := tx.Query(ctx, backupObjectsQuery)
+	if err != nil {
+		return nil, fmt.Errorf("listing objects: %w", err)
+	}
+	if d.objects, err = pgx.CollectRows(rows, pgx.RowTo[string]); err != nil {
+		return nil, fmt.Errorf("listing objects: %w", err)
+	}
+	rows, err = tx.Query(ctx, backupFilesQuery)
+	if err != nil {
+		return nil, fmt.Errorf("listing files: %w", err)
+	}
+	d.files, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) ([2]string, error) {
+		var f [2]string
+		err := row.Scan(&f[0], &f[1])
+		return f, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing files: %w", err)
+	}
+	return d, nil
+}
+
+// writeTarFile adds a file to the archive. Entries need their size up front, so content of
+// unknown length is spooled to disk first.
+func writeTarFile(tw *tar.Writer, name string, rc io.ReadCloser) error {
+	defer rc.Close()
+	f, ok := rc.(*os.File)
+	if !ok {
+		tmp, err := os.CreateTemp("", "corvina-backup-*")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+		if _, err := io.Copy(tmp, rc); err != nil {
+			return err
+		}
+		if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		f = tmp
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	hdr := &tar.Header{Name: name, Mode: 0644, Size: info.Size(), ModTime: info.ModTime(), Typeflag: tar.TypeReg}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// writeArchive streams the dump and the files it references into tw
+func (d *backupDump) writeArchive(ctx context.Context, tw *tar.Writer) error {
+	for _, t := range d.manifest.Tables {
+		f, err := os.Open(filepath.Join(d.dir, t.Name+".csv"))
+		if err != nil {
+			return err
+		}
+		if err := writeTarFile(tw, "db/"+t.Name+".csv", f); err != nil {
+			return fmt.Errorf("writing %s: %w", t.Name, err)
+		}
+	}
+
+	for _, key := range d.objects {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rc, err := store.Get(key)
+		if errors.Is(err, fs.ErrNotExist) {
+			slog.WarnContext(ctx, "Backup skipped missing object", "key", key)
+			d.manifest.Missing = append(d.manifest.Missing, "objects/"+key)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("reading object %s: %w", key, err)
+		}
+		if err := writeTarFile(tw, "objects/"+key, rc); err != nil {
+			return fmt.Errorf("writing object %s: %w", key, err)
+		}
+		d.manifest.Objects++
+	}
+
+	for _, file := range d.files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		name := path.Join("files", file[0], file[1])
+		f, err := os.Open(filepath.Join(datasetDir, file[0], file[1]))
+		if errors.Is(err, fs.ErrNotExist) {
+			slog.WarnContext(ctx, "Backup skipped missing file", "document_id", file[0], "file", file[1])
+			d.manifest.Missing = append(d.manifest.Missing, name)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := writeTarFile(tw, name, f); err != nil {
+			return fmt.Errorf("writing %s: %w", name, err)
+		}
+		d.manifest.Files++
+	}
+
+	manifest, err := json.MarshalIndent(d.manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: "backup.json", Mode: 0644, Size: int64(len(manifest)), ModTime: time.Now(), Typeflag: tar.TypeReg}); err != nil {
+		return err
+	}
+	_, err = tw.Write(manifest)
+	return err
+}
+
+// handleBackup streams a backup archive: POST /admin/backup
+func handleBackup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		jsonError(w, http.StatusMethodNotAllowed, "POST only")
+		return
+	}
+	if !backupRunning.CompareAndSwap(false, true) {
+		jsonError(w, http.StatusConflict, "A backup is already running")
+		return
+	}
+	defer backupRunning.Store(false)
+
+	// Copying large tables outlasts DB_QUERY_TIMEOUT, and streaming the archive the server-wide
+	// write timeout
+	ctx := withoutQueryTimeout(r.Context())
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	start := time.Now()
+	dir, err := os.MkdirTemp("", "corvina-backup-*")
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "Failed to create backup")
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	d, err := dumpDatabase(ctx, dir)
+	if err != nil {
+		slog.ErrorContext(ctx, "Dumping database failed", "error", err)
+		jsonError(w, http.StatusInternalServerError, "Failed to dump database")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "corvina-backup-"+start.UTC().Format("20060102T150405Z")+".tar.gz"))
+	w.WriteHeader(http.StatusOK)
+
+	// Images are already compressed; the fastest level still shrinks the CSV dumps well
+	zw, _ := gzip.NewWriterLevel(w, gzip.BestSpeed)
+	tw := tar.NewWriter(zw)
+	err = d.writeArchive(ctx, tw)
+	if err == nil {
+		err = tw.Close()
+	}
+	if err == nil {
+		err = zw.Close()
+	}
+	if err != nil {
+		// The status is already sent; leaving the gzip stream unterminated makes the client see a
+		// truncated archive rather than a complete one
+		slog.ErrorContext(ctx, "Backup failed", "error", err)
+		return
+	}
+	slog.InfoContext(ctx, "Backup complete", "tables", len(d.manifest.Tables), "objects", d.manifest.Objects,
+		"files", d.manifest.Files, "missing", len(d.manifest.Missing), "duration_ms", time.Since(start).Milliseconds())
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ---------- Bulk Document Changes ----------
+
+// Cleaning up after a bad import takes one request instead of thousands:
+//
+//	DELETE /documents/{id}?force=true
+//	POST   /documents/batch/delete?force=true  {"document_ids": [...]}
+//	POST   /documents/batch/status              {"document_ids": [...], "status": "archived"}
+//
+// Each batch runs in one transaction and answers with a result per document. Documents that
+// already have annotations are only deleted with force=true. Deleting removes the document's
+// pages, annotations, suggestions, and history; its files are shared by content hash and are
+// removed by a consistency check with repair once nothing refers to them.
+
+// batchEditMax caps the document_ids of one batch
+var batchEditMax = envInt("BATCH_EDIT_MAX", 10000)
+
+// documentStatuses are the values of documents.status
+var documentStatuses = []string{"active", "on_hold", "archived"}
+
+type BatchResult struct {
+	DocumentID string `json:"document_id"`
+	Status     string `json:"status"` // deleted | updated | unchanged | not_found | annotated
+	Previous   string `json:"previous,omitempty"`
+}
+
+// decodeBatchIDs reads the request body into req and checks its document_ids, which it returns
+// without duplicates
+func decodeBatchIDs(w http.ResponseWriter, r *http.Request, req interface{}, ids *[]string) bool {
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		jsonError(w, http.StatusBadRequest, "Invalid JSON")
+		return false
+	}
+	if len(*ids) == 0 {
+		jsonError(w, http.StatusBadRequest, "document_ids is empty")
+		return false
+	}
+	if len(*ids) > batchEditMax {
+		jsonError(w, http.StatusBadRequest, fmt.Sprintf("At most %d document_ids per request", batchEditMax))
+		return false
+	}
+	seen := map[string]bool{}
+	*ids = slices.DeleteFunc(*ids, func(id string) bool {
+		dup := seen[id]
+		seen[id] = true
+		return dup
+	})
+	return true
+}
+
+// deleteDocuments deletes ids, leaving documents with annotations alone unless force is set
+func deleteDocuments(ctx context.Context, ids []string, force bool) ([]BatchResult, error) {
+	results := make([]BatchResult, len(ids))
+	err := inTx(ctx, "delete_documents", func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, `
+			SELECT d.document_id, NOT (`+unannotatedSQL+`)
+			FROM documents d WHERE d.document_id = ANY($1) FOR UPDATE OF d`, ids)
+		if err != nil {
+			return err
+		}
+		annotated := map[string]bool{}
+		found := map[string]bool{}
+		for rows.Next() {
+			var id string
+			var has bool
+			if err := rows.Scan(&id, &has); err != nil {
+				return err
+			}
+			found[id], annotated[id] = true, has
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		var doomed []string
+		var events []outboxEvent
+		for i, id := range ids {
+			results[i] = BatchResult{DocumentID: id}
+			switch {
+			case !found[id]:
+				results[i].Status = "not_found"
+			case annotated[id] && !force:
+				results[i].Status = "annotated"
+			default:
+				results[i].Status = "deleted"
+				doomed = append(doomed, id)
+				events = append(events, newEvent("document.deleted", id, nil))
+			}
+		}
+		if len(doomed) == 0 {
+			return nil
+		}
+		// Everything else that belongs to the document goes with it (ON DELETE CASCADE)
+		if _, err := tx.Exec(ctx, "DELETE FROM documents WHERE document_id = ANY($1)", doomed); err != nil {
+			return err
+		}
+		return enqueueEvents(ctx, tx, events...)
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, res := range results {
+		if res.Status == "deleted" {
+			documentCache.forget(res.DocumentID)
+		}
+	}
+	return results, nil
+}
+
+// setDocumentStatus moves ids to status
+func setDocumentStatus(ctx context.Context, ids []string, status string) ([]BatchResult, error) {
+	results := make([]BatchResult, len(ids))
+	err := inTx(ctx, "set_document_status", func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, `
+			WITH prev AS (SELECT document_id, status FROM documents WHERE document_id = ANY($1) FOR UPDATE)
+			UPDATE documents d SET status = $2 FROM prev
+			WHERE d.document_id = prev.document_id
+			RETURNING d.document_id, prev.status`, ids, status)
+		if err != nil {
+			return err
+		}
+		previous, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) ([2]string, error) {
+			var p [2]string
+			return p, row.Scan(&p[0], &p[1])
+		})
+		if err != nil {
+			return err
+		}
+		byID := map[string]string{}
+		for _, p := range previous {
+			byID[p[0]] = p[1]
+		}
+
+		var events []outboxEvent
+		for i, id := range ids {
+			res := BatchResult{DocumentID: id, Previous: byID[id]}
+			switch prev, ok := byID[id]; {
+			case !ok:
+				res.Status = "not_found"
+			case prev == status:
+				res.Status = "unchanged"
+			default:
+				res.Status = "updated"
+				events = append(events, newEvent("document.status_changed", id, map[string]string{"from": prev, "to": status}))
+			}
+			results[i] = res
+		}
+		return enqueueEvents(ctx, tx, events...)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// countResults tallies results by status
+func countResults(results []BatchResult) map[string]int {
+	counts := map[string]int{}
+	for _, res := range results {
+		counts[res.Status]++
+	}
+	return counts
+}
+
+// handleBatchDelete: POST /documents/batch/delete?force=true {"document_ids": [...]}
+func handleBatchDelete(w http.ResponseWriter, r *http.Request) {
+	var req batchFetchRequest
+	if !decodeBatchIDs(w, r, &req, &req.DocumentIDs) {
+		return
+	}
+	results, err := deleteDocuments(r.Context(), req.DocumentIDs, queryFlag(r.URL.Query().Get("force")))
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Batch delete failed", "documents", len(req.DocumentIDs), "error", err)
+		jsonError(w, http.StatusInternalServerError, "Failed to delete documents")
+		return
+	}
+	counts := countResults(results)
+	slog.InfoContext(r.Context(), "Documents deleted", "deleted", counts["deleted"], "requested", len(req.DocumentIDs))
+	jsonResponse(w, http.StatusOK, map[string]interface{}{
+		"status":  "success",
+		"deleted": counts["deleted"],
+		"results": results,
+	})
+}
+
+// handleBatchStatus: POST /documents/batch/status {"document_ids": [...], "status": "..."}
+func handleBatchStatus(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		DocumentIDs []string `json:"document_ids"`
+		Status      string   `json:"status"`
+	}
+	if !decodeBatchIDs(w, r, &req, &req.DocumentIDs) {
+		return
+	}
+	if !slices.Contains(documentStatuses, req.Status) {
+		jsonError(w, http.StatusBadRequest, "status must be active, on_hold, or archived")
+		return
+	}
+	results, err := setDocumentStatus(r.Context(), req.DocumentIDs, req.Status)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Batch status change failed", "documents", len(req.DocumentIDs), "error", err)
+		jsonError(w, http.StatusInternalServerError, "Failed to change status")
+		return
+	}
+	counts := countResults(results)
+	slog.InfoContext(r.Context(), "Document status changed", "status", req.Status, "updated", counts["updated"], "requested", len(req.DocumentIDs))
+	jsonResponse(w, http.StatusOK, map[string]interface{}{
+		"status":  "success",
+		"updated": counts["updated"],
+		"results": results,
+	})
+}
+
+// handleDeleteDocument deletes one document: DELETE /documents/{id}?force=true
+// Responds 409 when the document has annotations and force is not set.
+func handleDeleteDocument(w http.ResponseWriter, r *http.Request) {
+	docID := r.PathValue("id")
+	results, err := deleteDocuments(r.Context(), []string{docID}, queryFlag(r.URL.Query().Get("force")))
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Deleting document failed", "document_id", docID, "error", err)
+		jsonError(w, http.StatusInternalServerError, "Failed to delete document")
+		return
+	}
+	switch results[0].Status {
+	case "not_found":
+		problemError(w, http.StatusNotFound, codeDocumentNotFound, "Document not found")
+	case "annotated":
+		jsonError(w, http.StatusConflict, "Document has annotations; pass force=true to delete it anyway")
+	default:
+		slog.InfoContext(r.Context(), "Document deleted", "document_id", docID)
+		jsonResponse(w, http.StatusOK, map[string]string{"status": "success", "document_id": docID})
+	}
+}
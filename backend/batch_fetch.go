@@ -0,0 +1,133 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// ---------- Bulk Document Fetch ----------
+
+var batchFetchMax = envInt("BATCH_FETCH_MAX", 10000)
+
+type batchFetchRequest struct {
+	DocumentIDs []string `json:"document_ids"`
+}
+
+// handleBatchFetch returns many documents in one request: POST /documents/batch {"document_ids": [...]}
+// The default response is {"documents": [...], "missing": [...]}. With ?stream=1 (or Accept:
+// application/x-ndjson) each document is written as one JSON line as soon as it is loaded, and
+// missing IDs are reported as {"document_id": ..., "error": "not found"} lines. ?include=,
+// ?fields=, and ?coords= apply to each document as on GET /documents/{id}.
+func handleBatchFetch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		jsonError(w, http.StatusMethodNotAllowed, "POST only")
+		return
+	}
+
+	var req batchFetchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+	if len(req.DocumentIDs) == 0 {
+		jsonError(w, http.StatusBadRequest, "document_ids is empty")
+		return
+	}
+	if len(req.DocumentIDs) > batchFetchMax {
+		jsonError(w, http.StatusBadRequest, fmt.Sprintf("At most %d document_ids per request", batchFetchMax))
+		return
+	}
+
+	// Nothing is written here; POST only carries the id list, so reads go to the replica
+	r = r.WithContext(withReplica(r.Context()))
+
+	view, err := parseDocumentView(r.URL.Query())
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	stream := r.URL.Query().Get("stream") == "1" || strings.Contains(r.Header.Get("Accept"), "application/x-ndjson")
+	if stream {
+		streamDocuments(w, r, req.DocumentIDs, view)
+		return
+	}
+
+	documents := []interface{}{}
+	missing := []string{}
+	seen := map[string]bool{}
+	for _, id := range req.DocumentIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		doc, err := records.LoadDocument(r.Context(), id, view)
+		if errors.Is(err, sql.ErrNoRows) {
+			missing = append(missing, id)
+			continue
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Batch fetch failed", "document_id", id, "error", err)
+			jsonError(w, http.StatusInternalServerError, "Failed to load "+id)
+			return
+		}
+		body, err := view.render(r.Context(), doc)
+		if err != nil {
+			jsonError(w, http.StatusUnprocessableEntity, id+": "+err.Error())
+			return
+		}
+		documents = append(documents, body)
+	}
+	jsonResponse(w, http.StatusOK, BatchFetchResponse{Documents: documents, Missing: missing, Count: len(documents)})
+}
+
+// BatchFetchResponse is the body of POST /documents/batch without ?stream=1. Each document is
+// rendered as GET /documents/{id} would.
+type BatchFetchResponse struct {
+	Documents []interface{} `json:"documents"`
+	Missing   []string      `json:"missing"`
+	Count     int           `json:"count"`
+}
+
+// streamDocuments writes newline-delimited JSON, flushing periodically so clients can start
+// processing before the whole batch is loaded
+func streamDocuments(w http.ResponseWriter, r *http.Request, ids []string, view documentView) {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+
+	seen := map[string]bool{}
+	for i, id := range ids {
+		if r.Context().Err() != nil {
+			return // client went away
+		}
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		doc, err := records.LoadDocument(r.Context(), id, view)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			enc.Encode(map[string]string{"document_id": id, "error": "not found"})
+		case err != nil:
+			slog.ErrorContext(r.Context(), "Batch fetch failed", "document_id", id, "error", err)
+			enc.Encode(map[string]string{"document_id": id, "error": "failed to load"})
+		default:
+			if body, err := view.render(r.Context(), doc); err != nil {
+				enc.Encode(map[string]string{"document_id": id, "error": err.Error()})
+			} else {
+				enc.Encode(body)
+			}
+		}
+		if flusher != nil && i%50 == 49 {
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// ---------- Coordinate Bounds ----------
+
+// submitBoundsMode decides what /submit does with coordinates outside the page image:
+// "reject" fails the submission, "clamp" pulls them back onto the image. ?out_of_bounds= overrides it.
+var submitBoundsMode = envChoice("SUBMIT_OUT_OF_BOUNDS", "reject", "reject", "clamp")
+
+type pageSize struct {
+	Width, Height int
+}
+
+// PageSizes returns the stored image size of each page. Pages uploaded before sizes were
+// recorded are missing from the map and are not bounds-checked.
+func (postgresRecords) PageSizes(ctx context.Context, docID string) (map[int]pageSize, error) {
+	rows, err := db.QueryContext(ctx, sqlPageSizes, docID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sizes := map[int]pageSize{}
+	for rows.Next() {
+		var page int
+		var s pageSize
+		if err := rows.Scan(&page, &s.Width, &s.Height); err != nil {
+			return nil, err
+		}
+		sizes[page] = s
+	}
+	return sizes, rows.Err()
+}
+
+// checkAnnotationBounds validates an annotation's bbox and position against the page size.
+// With clamp set, out-of-range values are corrected in place and counted instead.
+// transcription_box is [x, y, width, height] and isn't stored, so it is not checked.
+func checkAnnotationBounds(ann *RawAnnotation, size pageSize, clamp bool) (int, *FieldError) {
+	clamped := 0
+	if len(ann.BBox) > 0 {
+		n, err := checkBox(ann.BBox, size, clamp)
+		if err != nil {
+			return 0, &FieldError{AnnotationID: ann.ID, Field: "bbox", Code: codeInvalidBBox, Message: fmt.Sprintf("%v %v", ann.BBox, err)}
+		}
+		clamped += n
+	}
+
+	if len(ann.Position) > 0 {
+		if len(ann.Position) != 2 {
+			return 0, &FieldError{AnnotationID: ann.ID, Field: "position", Code: codeInvalidPosition, Message: "must be [x, y]"}
+		}
+		n, err := checkPoint(ann.Position, size, clamp)
+		if err != nil {
+			return 0, &FieldError{AnnotationID: ann.ID, Field: "position", Code: codeInvalidPosition, Message: fmt.Sprintf("%v %v", ann.Position, err)}
+		}
+		clamped += n
+	}
+	return clamped, nil
+}
+
+// checkBox validates an [x1, y1, x2, y2] box; edges may touch the far side of the image
+func checkBox(box []int, size pageSize, clamp bool) (int, error) {
+	if len(box) != 4 {
+		return 0, fmt.Errorf("must have 4 values")
+	}
+	if box[0] > box[2] || box[1] > box[3] {
+		return 0, fmt.Errorf("has x1 > x2 or y1 > y2")
+	}
+
+	limits := [4]int{size.Width, size.Height, size.Width, size.Height}
+	clamped := 0
+	for i, v := range box {
+		if v >= 0 && v <= limits[i] {
+			continue
+		}
+		if !clamp {
+			return 0, outsideError(size)
+		}
+		box[i] = clampInt(v, 0, limits[i])
+		clamped = 1
+	}
+	if box[0] == box[2] || box[1] == box[3] {
+		// Clamping collapses a box that was entirely off the image
+		if clamped > 0 {
+			return 0, fmt.Errorf("lies entirely outside the %dx%d image", size.Width, size.Height)
+		}
+		return 0, fmt.Errorf("has zero width or height")
+	}
+	return clamped, nil
+}
+
+// checkPoint validates an [x, y] pixel position
+func checkPoint(pt []int, size pageSize, clamp bool) (int, error) {
+	if pt[0] >= 0 && pt[0] < size.Width && pt[1] >= 0 && pt[1] < size.Height {
+		return 0, nil
+	}
+	if !clamp {
+		return 0, outsideError(size)
+	}
+	pt[0] = clampInt(pt[0], 0, size.Width-1)
+	pt[1] = clampInt(pt[1], 0, size.Height-1)
+	return 1, nil
+}
+
+func outsideError(size pageSize) error {
+	return fmt.Errorf("is outside the %dx%d image", size.Width, size.Height)
+}
+
+func clampInt(v, lo, hi int) int {
+	return max(lo, min(v, hi))
+}
+
+// boundsModeFromQuery resolves the reject/clamp mode for a submission
+func boundsModeFromQuery(q string) (bool, error) {
+	mode := strings.ToLower(strings.TrimSpace(q))
+	if mode == "" {
+		mode = submitBoundsMode
+	}
+	switch mode {
+	case "reject":
+		return false, nil
+	case "clamp":
+		return true, nil
+	}
+	return false, fmt.Errorf("out_of_bounds must be reject or clamp")
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCheckBox(t *testing.T) {
+	size := pageSize{Width: 100, Height: 50}
+	tests := []struct {
+		name    string
+		box     []int
+		clamp   bool
+		want    []int // box after the check
+		clamped int
+		err     string
+	}{
+		{"inside", []int{10, 10, 20, 20}, false, []int{10, 10, 20, 20}, 0, ""},
+		{"touching the far edges", []int{0, 0, 100, 50}, false, []int{0, 0, 100, 50}, 0, ""},
+		{"wrong length", []int{1, 2, 3}, false, []int{1, 2, 3}, 0, "must have 4 values"},
+		{"reversed x", []int{20, 10, 10, 20}, false, []int{20, 10, 10, 20}, 0, "has x1 > x2 or y1 > y2"},
+		{"reversed y", []int{10, 20, 20, 10}, true, []int{10, 20, 20, 10}, 0, "has x1 > x2 or y1 > y2"},
+		{"zero width", []int{10, 10, 10, 20}, false, []int{10, 10, 10, 20}, 0, "has zero width or height"},
+		{"zero height", []int{10, 10, 20, 10}, true, []int{10, 10, 20, 10}, 0, "has zero width or height"},
+		{"past the right edge", []int{90, 10, 120, 20}, false, []int{90, 10, 120, 20}, 0, "is outside the 100x50 image"},
+		{"negative", []int{-5, 10, 20, 20}, false, []int{-5, 10, 20, 20}, 0, "is outside the 100x50 image"},
+		{"clamped", []int{-5, 10, 120, 60}, true, []int{0, 10, 100, 50}, 1, ""},
+		{"clamped to nothing", []int{110, 10, 120, 20}, true, []int{100, 10, 100, 20}, 0, "lies entirely outside the 100x50 image"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := checkBox(tt.box, size, tt.clamp)
+			if got := errString(err); got != tt.err {
+				t.Errorf("error = %q, want %q", got, tt.err)
+			}
+			if n != tt.clamped || !reflect.DeepEqual(tt.box, tt.want) {
+				t.Errorf("got %v (clamped %d), want %v (clamped %d)", tt.box, n, tt.want, tt.clamped)
+			}
+		})
+	}
+}
+
+func TestCheckPoint(t *testing.T) {
+	size := pageSize{Width: 100, Height: 50}
+	tests := []struct {
+		name    string
+		pt      []int
+		clamp   bool
+		want    []int
+		clamped int
+		err     string
+	}{
+		{"inside", []int{10, 10}, false, []int{10, 10}, 0, ""},
+		{"origin", []int{0, 0}, false, []int{0, 0}, 0, ""},
+		{"last pixel", []int{99, 49}, false, []int{99, 49}, 0, ""},
+		{"on the right edge", []int{100, 10}, false, []int{100, 10}, 0, "is outside the 100x50 image"},
+		{"negative", []int{10, -1}, false, []int{10, -1}, 0, "is outside the 100x50 image"},
+		{"clamped", []int{150, -3}, true, []int{99, 0}, 1, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := checkPoint(tt.pt, size, tt.clamp)
+			if got := errString(err); got != tt.err {
+				t.Errorf("error = %q, want %q", got, tt.err)
+			}
+			if n != tt.clamped || !reflect.DeepEqual(tt.pt, tt.want) {
+				t.Errorf("got %v (clamped %d), want %v (clamped %d)", tt.pt, n, tt.want, tt.clamped)
+			}
+		})
+	}
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ---------- Database Circuit Breaker ----------
+
+// After DB_BREAKER_FAILURES consecutive connection failures or timeouts the breaker opens, and
+// requests that need the database get 503 with Retry-After at once instead of each waiting out
+// its own timeout. Once DB_BREAKER_COOLDOWN has passed a single request is let through as a
+// probe; a query that succeeds closes the breaker again. DB_BREAKER_FAILURES=0 turns it off.
+var (
+	dbBreakerFailures = envInt("DB_BREAKER_FAILURES", 5)
+	dbBreakerCooldown = envDuration("DB_BREAKER_COOLDOWN", 10*time.Second)
+	// Rendered GET /documents/{id} bodies kept to answer from while the database is down, marked
+	// stale with a Warning header. 0 turns these degraded reads off.
+	documentCacheSize = envInt("DOCUMENT_CACHE_SIZE", 500)
+)
+
+// breakerExempt are routes that don't touch the database, or must answer either way. The gRPC
+// gateway is checked by the gRPC server it calls.
+var breakerExempt = map[string]bool{
+	"/healthz": true, "/readyz": true, "/metrics": true, "/admin/log-level": true, "/admin/config": true, "/v1/": true,
+	"/openapi.json": true, "/docs/": true,
+}
+
+var dbBreaker = &circuitBreaker{}
+
+type circuitBreaker struct {
+	mu       sync.Mutex
+	failures int       // consecutive
+	openedAt time.Time // zero while closed
+	probing  bool      // a request is testing the database after the cooldown
+}
+
+// allow reports whether a request may use the database. When it may not, retryAfter is how long
+// until the next probe. probe is true for the one request let through after the cooldown, which
+// must call probeDone when it finishes.
+func (b *circuitBreaker) allow() (ok, probe bool, retryAfter time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.openedAt.IsZero() {
+		return true, false, 0
+	}
+	if wait := dbBreakerCooldown - time.Since(b.openedAt); wait > 0 {
+		return false, false, wait
+	}
+	if b.probing {
+		return false, false, time.Second
+	}
+	b.probing = true
+	return true, true, 0
+}
+
+// probeDone frees the probe slot for a probe request that never reached the database
+func (b *circuitBreaker) probeDone() {
+	b.mu.Lock()
+	b.probing = false
+	b.mu.Unlock()
+}
+
+// record counts the outcome of one query or connection attempt
+func (b *circuitBreaker) record(err error) {
+	if dbBreakerFailures <= 0 {
+		return
+	}
+	failed := err != nil && dbUnreachable(err)
+	if err != nil && !failed {
+		return // the database answered, if only with an error
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch {
+	case !failed:
+		if !b.openedAt.IsZero() {
+			slog.Info("Database reachable again; circuit breaker closed", "open_for", time.Since(b.openedAt).Round(time.Second).String())
+			dbBreakerOpen.Set(0)
+		}
+		b.failures, b.openedAt, b.probing = 0, time.Time{}, false
+	case b.probing:
+		b.openedAt, b.probing = time.Now(), false
+	default:
+		b.failures++
+		if b.openedAt.IsZero() && b.failures >= dbBreakerFailures {
+			b.openedAt = time.Now()
+			dbBreakerOpen.Set(1)
+			slog.Error("Database unreachable; circuit breaker open", "failures", b.failures, "cooldown", dbBreakerCooldown.String(), "error", err)
+		}
+	}
+}
+
+// dbUnreachable reports errors that say the database couldn't be reached or didn't answer in
+// time, as opposed to errors about the statement itself
+func dbUnreachable(err error) bool {
+	var connectErr *pgconn.ConnectError
+	if errors.As(err, &connectErr) || pgconn.Timeout(err) {
+		return true
+	}
+	switch transientReason(err) {
+	case "", "40001", "40P01":
+		return false
+	}
+	return true
+}
+
+// The breaker watches the primary pool as a pgx tracer
+
+func (b *circuitBreaker) TraceQueryStart(ctx context.Context, _ *pgx.Conn, _ pgx.TraceQueryStartData) context.Context {
+	return ctx
+}
+
+func (b *circuitBreaker) TraceQueryEnd(_ context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	b.record(data.Err)
+}
+
+func (b *circuitBreaker) TraceConnectStart(ctx context.Context, _ pgx.TraceConnectStartData) context.Context {
+	return ctx
+}
+
+func (b *circuitBreaker) TraceConnectEnd(_ context.Context, data pgx.TraceConnectEndData) {
+	b.record(data.Err)
+}
+
+type dbUnavailableKey struct{}
+
+// dbUnavailable reports whether the breaker turned this request away, and when to try again.
+// Handlers that can answer without the database (see documentCache) check it before querying.
+func dbUnavailable(ctx context.Context) (time.Duration, bool) {
+	retryAfter, ok := ctx.Value(dbUnavailableKey{}).(time.Duration)
+	return retryAfter, ok
+}
+
+// breakerGuard answers 503 for requests that need the database while the breaker is open.
+// GET /documents/{id} is passed through, marked unavailable, to be served from documentCache.
+func breakerGuard(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, pattern := mux.Handler(r)
+		if breakerExempt[pattern] || r.Method == http.MethodOptions {
+			mux.ServeHTTP(w, r)
+			return
+		}
+		ok, probe, retryAfter := dbBreaker.allow()
+		if probe {
+			defer dbBreaker.probeDone()
+		}
+		if !ok {
+			if pattern == "/documents/" && r.Method == http.MethodGet && documentCacheSize > 0 {
+				mux.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), dbUnavailableKey{}, retryAfter)))
+				return
+			}
+			dbUnavailableError(w, retryAfter)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// dbUnavailableError answers 503 with a Retry-After for the breaker's next probe
+func dbUnavailableError(w http.ResponseWriter, retryAfter time.Duration) {
+	if retryAfter <= 0 {
+		retryAfter = dbBreakerCooldown
+	}
+	dbBreakerRejected.Inc()
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	problemError(w, http.StatusServiceUnavailable, codeDatabaseUnavailable,
+		"The database is unavailable; retry after the time in the Retry-After header")
+}
+
+// ---------- Document Cache ----------
+
+// documentCache keeps the most recently read document bodies, by request URI, so reads can be
+// answered while the database is down. /submit drops a document's entries; other edits may
+// leave an older copy, which the Warning header owns up to.
+var documentCache = newBodyCache(documentCacheSize)
+
+type bodyCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List // front is most recent
+	entries map[string]*list.Element
+}
+
+type cachedBody struct {
+	key, docID string
+	body       interface{}
+	storedAt   time.Time
+}
+
+func newBodyCache(size int) *bodyCache {
+	return &bodyCache{size: size, order: list.New(), entries: map[string]*list.Element{}}
+}
+
+func (c *bodyCache) put(key, docID string, body interface{}) {
+	if c.size <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		c.order.Remove(el)
+	}
+	c.entries[key] = c.order.PushFront(&cachedBody{key: key, docID: docID, body: body, storedAt: time.Now()})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cachedBody).key)
+	}
+}
+
+func (c *bodyCache) get(key string) (*cachedBody, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*cachedBody), true
+}
+
+// forget drops every cached body of docID, after it changes
+func (c *bodyCache) forget(docID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, el := range c.entries {
+		if el.Value.(*cachedBody).docID == docID {
+			c.order.Remove(el)
+			delete(c.entries, key)
+		}
+	}
+}
+
+// documentCacheKey is the URI and API version a body was rendered for
+func documentCacheKey(r *http.Request) string {
+	return "v" + strconv.Itoa(apiVersion(r.Context())) + " " + r.URL.RequestURI()
+}
+
+// serveStale answers from documentCache, or with 503 when the body isn't cached
+func serveStale(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	cached, ok := documentCache.get(documentCacheKey(r))
+	if !ok {
+		dbUnavailableError(w, retryAfter)
+		return
+	}
+	dbStaleReads.Inc()
+	w.Header().Set("Warning", `110 - "Response is Stale"`)
+	w.Header().Set("Age", strconv.Itoa(int(time.Since(cached.storedAt).Seconds())))
+	jsonResponse(w, http.StatusOK, cached.body)
+}
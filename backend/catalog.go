@@ -0,0 +1,322 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ---------- Symbol Catalog ----------
+
+// The symbol catalog lists the component types annotators should use. Each entry has a
+// canonical label and aliases; a component whose label matches either (ignoring case) links to
+// the entry through catalog_id, which GET /documents/{id} returns. Exporters map catalog entries
+// to SPICE or KiCad symbols through their metadata, e.g. {"spice_prefix": "X",
+// "kicad_symbol": "Amplifier_Operational:LM358"}.
+//
+//	GET    /catalog?domain=                   list entries
+//	POST   /catalog                           add an entry
+//	GET    /catalog/unmatched?project=        component labels no entry matches, most used first
+//	GET    /catalog/{id}                      one entry and how many components it links
+//	PUT    /catalog/{id}                      replace an entry
+//	DELETE /catalog/{id}                      remove an entry, unlinking its components
+//
+// Labels and aliases are unique across the catalog. Changing the catalog relinks existing
+// components in the same transaction.
+
+var catalogIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,63}$`)
+
+type CatalogEntry struct {
+	ID             string          `json:"id"`
+	Label          string          `json:"label"`
+	Aliases        []string        `json:"aliases"`
+	Domain         string          `json:"domain,omitempty"`
+	Metadata       json.RawMessage `json:"metadata,omitempty"`
+	ReferenceImage string          `json:"reference_image,omitempty"` // URL of an example drawing of the symbol
+	Components     *int64          `json:"components,omitempty"`      // linked components, on GET /catalog/{id}
+	CreatedAt      string          `json:"created_at,omitempty"`
+	UpdatedAt      string          `json:"updated_at,omitempty"`
+}
+
+// check validates e and normalizes its aliases: trimmed, without duplicates or the label itself
+func (e *CatalogEntry) check() error {
+	if !catalogIDPattern.MatchString(e.ID) {
+		return fmt.Errorf("id must be 1-64 lowercase letters, digits, '.', '_' or '-'")
+	}
+	e.Label = strings.TrimSpace(e.Label)
+	if e.Label == "" {
+		return fmt.Errorf("label is required")
+	}
+	seen := map[string]bool{strings.ToLower(e.Label): true}
+	aliases := []string{}
+	for _, a := range e.Aliases {
+		a = strings.TrimSpace(a)
+		if a == "" || seen[strings.ToLower(a)] {
+			continue
+		}
+		seen[strings.ToLower(a)] = true
+		aliases = append(aliases, a)
+	}
+	e.Aliases = aliases
+	if len(e.Metadata) == 0 || string(e.Metadata) == "null" {
+		e.Metadata = json.RawMessage("{}")
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(e.Metadata, &m); err != nil {
+		return fmt.Errorf("metadata must be a JSON object")
+	}
+	return nil
+}
+
+const catalogColumns = "id, label, aliases, domain, metadata, COALESCE(reference_image, ''), created_at, updated_at"
+
+func scanCatalogEntry(row pgx.Row) (CatalogEntry, error) {
+	var e CatalogEntry
+	var created, updated time.Time
+	err := row.Scan(&e.ID, &e.Label, &e.Aliases, &e.Domain, &e.Metadata, &e.ReferenceImage, &created, &updated)
+	e.CreatedAt = created.UTC().Format(time.RFC3339)
+	e.UpdatedAt = updated.UTC().Format(time.RFC3339)
+	return e, err
+}
+
+// names are e's label and aliases in lower case
+func (e *CatalogEntry) names() []string {
+	names := []string{strings.ToLower(e.Label)}
+	for _, a := range e.Aliases {
+		names = append(names, strings.ToLower(a))
+	}
+	return names
+}
+
+// catalogClash returns the entry other than e already using one of e's names, or ""
+func catalogClash(ctx context.Context, tx pgx.Tx, e CatalogEntry) (string, error) {
+	var other string
+	err := tx.QueryRow(ctx, `
+		SELECT id FROM symbol_catalog
+		WHERE id <> $1 AND (lower(label) = ANY($2) OR EXISTS (SELECT 1 FROM unnest(aliases) a WHERE lower(a) = ANY($2)))
+		LIMIT 1`, e.ID, e.names()).Scan(&other)
+	if err == pgx.ErrNoRows {
+		return "", nil
+	}
+	return other, err
+}
+
+// relinkCatalog updates the links of components that matched entry e before it was written or
+// match it now, and returns how many changed
+func relinkCatalog(ctx context.Context, tx pgx.Tx, e *CatalogEntry) (int64, error) {
+	tag, err := tx.Exec(ctx, `
+		UPDATE components SET catalog_id = catalog_entry(label)
+		WHERE (catalog_id = $1 OR lower(label) = ANY($2)) AND catalog_id IS DISTINCT FROM catalog_entry(label)`, e.ID, e.names())
+	return tag.RowsAffected(), err
+}
+
+// errCatalogClash is returned from catalog transactions when a label or alias is taken
+type errCatalogClash struct{ other string }
+
+func (e errCatalogClash) Error() string {
+	return fmt.Sprintf("label or alias already used by catalog entry %s", e.other)
+}
+
+// saveCatalogEntry inserts e, or replaces the entry with its id when replace is set, and
+// relinks components. created is false when the entry already existed.
+func saveCatalogEntry(ctx context.Context, e *CatalogEntry, replace bool) (created bool, linked int64, err error) {
+	err = inTx(ctx, "save_catalog_entry", func(tx pgx.Tx) error {
+		other, err := catalogClash(ctx, tx, *e)
+		if err != nil {
+			return err
+		}
+		if other != "" {
+			return errCatalogClash{other}
+		}
+		conflict := "DO NOTHING"
+		if replace {
+			conflict = `DO UPDATE SET label = EXCLUDED.label, aliases = EXCLUDED.aliases, domain = EXCLUDED.domain,
+				metadata = EXCLUDED.metadata, reference_image = EXCLUDED.reference_image, updated_at = now()`
+		}
+		var createdAt, updatedAt time.Time
+		err = tx.QueryRow(ctx, `
+			INSERT INTO symbol_catalog (id, label, aliases, domain, metadata, reference_image)
+			VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''))
+			ON CONFLICT (id) `+conflict+`
+			RETURNING created_at, updated_at, created_at = updated_at`,
+			e.ID, e.Label, e.Aliases, e.Domain, string(e.Metadata), e.ReferenceImage).Scan(&createdAt, &updatedAt, &created)
+		if err != nil {
+			return err
+		}
+		e.CreatedAt = createdAt.UTC().Format(time.RFC3339)
+		e.UpdatedAt = updatedAt.UTC().Format(time.RFC3339)
+		linked, err = relinkCatalog(ctx, tx, e)
+		return err
+	})
+	return created, linked, err
+}
+
+// writeCatalogSaveError maps the errors of saveCatalogEntry to responses
+func writeCatalogSaveError(w http.ResponseWriter, r *http.Request, id string, err error) {
+	var clash errCatalogClash
+	switch {
+	case err == pgx.ErrNoRows:
+		jsonError(w, http.StatusConflict, fmt.Sprintf("Catalog entry %s already exists", id))
+	case errors.As(err, &clash):
+		jsonError(w, http.StatusConflict, clash.Error())
+	default:
+		slog.ErrorContext(r.Context(), "Saving catalog entry failed", "catalog_id", id, "error", err)
+		jsonError(w, http.StatusInternalServerError, "Failed to save catalog entry")
+	}
+}
+
+// handleCatalog lists (GET) or adds (POST) catalog entries: /catalog
+func handleCatalog(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		rows, err := readPool(r.Context()).Query(r.Context(),
+			"SELECT "+catalogColumns+" FROM symbol_catalog WHERE $1 = '' OR domain = $1 ORDER BY label", r.URL.Query().Get("domain"))
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Listing catalog failed", "error", err)
+			jsonError(w, http.StatusInternalServerError, "Query failed")
+			return
+		}
+		defer rows.Close()
+		entries := []CatalogEntry{}
+		for rows.Next() {
+			e, err := scanCatalogEntry(rows)
+			if err != nil {
+				continue
+			}
+			entries = append(entries, e)
+		}
+		jsonResponse(w, http.StatusOK, map[string]interface{}{"entries": entries, "count": len(entries)})
+
+	case http.MethodPost:
+		var e CatalogEntry
+		if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+			jsonError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+		if err := e.check(); err != nil {
+			jsonError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		_, linked, err := saveCatalogEntry(r.Context(), &e, false)
+		if err != nil {
+			writeCatalogSaveError(w, r, e.ID, err)
+			return
+		}
+		e.Components = &linked
+		slog.InfoContext(r.Context(), "Catalog entry added", "catalog_id", e.ID, "label", e.Label, "linked", linked)
+		jsonResponse(w, http.StatusCreated, e)
+
+	default:
+		jsonError(w, http.StatusMethodNotAllowed, "GET or POST only")
+	}
+}
+
+// handleCatalogEntry reads (GET), replaces (PUT), or removes (DELETE) one entry: /catalog/{id}
+func handleCatalogEntry(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	switch r.Method {
+	case http.MethodGet:
+		e, err := scanCatalogEntry(readPool(r.Context()).QueryRow(r.Context(), "SELECT "+catalogColumns+" FROM symbol_catalog WHERE id = $1", id))
+		if err == pgx.ErrNoRows {
+			jsonError(w, http.StatusNotFound, "Catalog entry not found")
+			return
+		}
+		if err != nil {
+			jsonError(w, http.StatusInternalServerError, "Query failed")
+			return
+		}
+		var n int64
+		readPool(r.Context()).QueryRow(r.Context(), "SELECT count(*) FROM components WHERE catalog_id = $1", id).Scan(&n)
+		e.Components = &n
+		jsonResponse(w, http.StatusOK, e)
+
+	case http.MethodPut:
+		var e CatalogEntry
+		if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+			jsonError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+		e.ID = id
+		if err := e.check(); err != nil {
+			jsonError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		created, linked, err := saveCatalogEntry(r.Context(), &e, true)
+		if err != nil {
+			writeCatalogSaveError(w, r, id, err)
+			return
+		}
+		slog.InfoContext(r.Context(), "Catalog entry saved", "catalog_id", id, "label", e.Label, "relinked", linked)
+		status := http.StatusOK
+		if created {
+			status = http.StatusCreated
+		}
+		jsonResponse(w, status, e)
+
+	case http.MethodDelete:
+		// ON DELETE SET NULL unlinks the components; names are unique, so no other entry matches them
+		var unlinked int64
+		err := pool.QueryRow(r.Context(), `
+			WITH unlinked AS (SELECT count(*) AS n FROM components WHERE catalog_id = $1)
+			DELETE FROM symbol_catalog WHERE id = $1 RETURNING (SELECT n FROM unlinked)`, id).Scan(&unlinked)
+		if err == pgx.ErrNoRows {
+			jsonError(w, http.StatusNotFound, "Catalog entry not found")
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Deleting catalog entry failed", "catalog_id", id, "error", err)
+			jsonError(w, http.StatusInternalServerError, "Failed to delete catalog entry")
+			return
+		}
+		jsonResponse(w, http.StatusOK, map[string]interface{}{"status": "success", "unlinked": unlinked})
+
+	default:
+		jsonError(w, http.StatusMethodNotAllowed, "GET, PUT, or DELETE only")
+	}
+}
+
+type UnmatchedLabel struct {
+	Label      string `json:"label"`
+	Components int64  `json:"components"`
+	Documents  int64  `json:"documents"`
+}
+
+// handleUnmatchedLabels lists component labels without a catalog entry, the candidates for new
+// entries or aliases: GET /catalog/unmatched?project=
+func handleUnmatchedLabels(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		jsonError(w, http.StatusMethodNotAllowed, "GET only")
+		return
+	}
+	rows, err := readDB(r.Context()).QueryContext(r.Context(), `
+		SELECT c.label, count(*), count(DISTINCT c.document_id)
+		FROM components c JOIN documents d ON d.document_id = c.document_id
+		WHERE c.catalog_id IS NULL AND ($1 = '' OR d.project = $1)
+		GROUP BY c.label ORDER BY 2 DESC, 1`, r.URL.Query().Get("project"))
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unmatched labels query failed", "error", err)
+		jsonError(w, http.StatusInternalServerError, "Query failed")
+		return
+	}
+	defer rows.Close()
+	labels := []UnmatchedLabel{}
+	for rows.Next() {
+		var l UnmatchedLabel
+		var label sql.NullString
+		if err := rows.Scan(&label, &l.Components, &l.Documents); err != nil {
+			continue
+		}
+		l.Label = label.String
+		labels = append(labels, l)
+	}
+	jsonResponse(w, http.StatusOK, map[string]interface{}{"labels": labels, "count": len(labels)})
+}
@@ -0,0 +1,564 @@
+// Command corvina administers a corvina backend through its HTTP API, so every change goes
+// through the same validation as the frontend's.
+//
+//	corvina [-server URL] [-api-key KEY] <command> [flags] [args]
+//
+// The server defaults to $CORVINA_URL (or http://localhost:5001) and the key to $CORVINA_API_KEY.
+// Run a command with -h for its flags.
+//
+// keys, backup, and restore need an admin key. On a new server, start it with ADMIN_API_KEYS set
+// and use that key to issue the first managed one:
+//
+//	corvina -api-key <ADMIN_API_KEYS secret> keys create -owner alice -role admin
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type command struct {
+	name    string
+	summary string
+	run     func(c *client, args []string) error
+}
+
+var commands = []command{
+	{"upload", "Upload images or PDFs as new documents", runUpload},
+	{"export", "Export a project as COCO JSON", runExport},
+	{"validate", "Report graph defects and duplicate boxes", runValidate},
+	{"resplit", "Redraw which documents of a project are in train, val, and test", runResplit},
+	{"keys", "Manage users' API keys", runKeys},
+	{"backup", "Download a backup of the database and images", runBackup},
+	{"restore", "Load a backup into the server", runRestore},
+}
+
+var commandUsage = map[string]string{
+	"upload":   "upload [-project P] FILE...",
+	"export":   "export [-project P] [-split S] [-snapshot TAG] [-by page|region] [-coords relative] [-o FILE]",
+	"validate": "validate [-overlap-iou X] DOCUMENT_ID...",
+	"resplit":  "resplit [-project P] [-ratios train=0.8,val=0.1,test=0.1] [-seed S]",
+	"keys":     "keys list [-owner USER] [-revoked] | keys create -owner USER [-name NAME] [-role user|admin] | keys revoke ID",
+	"backup":   "backup -o FILE",
+	"restore":  "restore [-conflict skip|overwrite|rename] FILE",
+}
+
+func main() {
+	flag.Usage = usage
+	server := flag.String("server", envOr("CORVINA_URL", "http://localhost:5001"), "backend base URL")
+	apiKey := flag.String("api-key", os.Getenv("CORVINA_API_KEY"), "sent as X-API-Key")
+	timeout := flag.Duration("timeout", 5*time.Minute, "per-request timeout")
+	flag.Parse()
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	c := &client{base: strings.TrimSuffix(*server, "/") + "/api/v1", key: *apiKey, http: &http.Client{Timeout: *timeout}}
+	for _, cmd := range commands {
+		if cmd.name == flag.Arg(0) {
+			if err := cmd.run(c, flag.Args()[1:]); err != nil {
+				if errors.Is(err, errFailed) {
+					os.Exit(1)
+				}
+				fmt.Fprintln(os.Stderr, "corvina:", err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+	fmt.Fprintf(os.Stderr, "corvina: unknown command %q\n", flag.Arg(0))
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: corvina [-server URL] [-api-key KEY] <command> [flags] [args]")
+	fmt.Fprintln(os.Stderr, "\ncommands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-9s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(os.Stderr, "\nflags:")
+	flag.PrintDefaults()
+}
+
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// errFailed reports that a command already printed why it failed
+var errFailed = errors.New("failed")
+
+// commandFlags is a FlagSet whose usage line comes from commandUsage
+func commandFlags(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: corvina "+commandUsage[name])
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// ---------- HTTP Client ----------
+
+type client struct {
+	base string // .../api/v1
+	key  string
+	http *http.Client
+}
+
+// problem is the subset of the backend's problem details the CLI prints
+type problem struct {
+	Status int    `json:"status"`
+	Code   string `json:"code"`
+	Detail string `json:"detail"`
+	Errors []struct {
+		AnnotationID string `json:"annotation_id"`
+		Field        string `json:"field"`
+		Message      string `json:"message"`
+	} `json:"errors"`
+}
+
+func (p *problem) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s (%d %s)", p.Detail, p.Status, p.Code)
+	for _, e := range p.Errors {
+		b.WriteString("\n  ")
+		if e.AnnotationID != "" {
+			b.WriteString(e.AnnotationID + ": ")
+		}
+		b.WriteString(strings.TrimSpace(e.Field + " " + e.Message))
+	}
+	return b.String()
+}
+
+// do sends a request and returns the response when it succeeded; error statuses become a
+// *problem
+func (c *client) do(method, path string, query url.Values, contentType string, body io.Reader) (*http.Response, error) {
+	u := c.base + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.key != "" {
+		req.Header.Set("X-API-Key", c.key)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	p := &problem{Status: resp.StatusCode}
+	if json.Unmarshal(data, p) != nil || p.Detail == "" {
+		p.Detail = strings.TrimSpace(string(data))
+		if p.Detail == "" {
+			p.Detail = http.StatusText(resp.StatusCode)
+		}
+	}
+	return nil, p
+}
+
+// call sends in as JSON (when not nil) and decodes the response into out (when not nil)
+func (c *client) call(method, path string, query url.Values, in, out interface{}) error {
+	var body io.Reader
+	contentType := ""
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body, contentType = bytes.NewReader(data), "application/json"
+	}
+	resp, err := c.do(method, path, query, contentType, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// ---------- Commands ----------
+
+func runUpload(c *client, args []string) error {
+	fs := commandFlags("upload")
+	project := fs.String("project", "", "project to file the documents under")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	failed := 0
+	for _, path := range fs.Args() {
+		var out struct {
+			DocumentID string `json:"document_id"`
+			Project    string `json:"project"`
+			NumPages   int    `json:"num_pages"`
+			Warning    string `json:"warning"`
+		}
+		if err := c.upload(path, *project, &out); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			failed++
+			continue
+		}
+		fmt.Printf("%s\t%s\t%s\t%d page(s)\n", path, out.DocumentID, out.Project, out.NumPages)
+		if out.Warning != "" {
+			fmt.Fprintf(os.Stderr, "%s: warning: %s\n", path, out.Warning)
+		}
+	}
+	if failed > 0 {
+		return errFailed
+	}
+	return nil
+}
+
+// upload streams one file as multipart/form-data, without holding it in memory
+func (c *client) upload(path, project string, out interface{}) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	go func() {
+		// The backend reads form fields before the file part
+		err := mw.WriteField("project", project)
+		if err == nil {
+			var part io.Writer
+			if part, err = mw.CreateFormFile("file", filepath.Base(path)); err == nil {
+				_, err = io.Copy(part, f)
+			}
+		}
+		if err == nil {
+			err = mw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	resp, err := c.do(http.MethodPost, "/upload", nil, mw.FormDataContentType(), pr)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// writeOutput copies body to output ("-" for stdout). A file is written under a temporary name
+// first so a failed download never leaves a truncated file behind.
+func writeOutput(output string, body io.Reader) error {
+	if output == "-" {
+		_, err := io.Copy(os.Stdout, body)
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(output), ".corvina-download-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	n, err := io.Copy(tmp, body)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), output); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Wrote %s (%d bytes)\n", output, n)
+	return nil
+}
+
+func runExport(c *client, args []string) error {
+	fs := commandFlags("export")
+	project := fs.String("project", "", "project to export (default: the backend's default project)")
+	split := fs.String("split", "", "only this split")
+	snapshot := fs.String("snapshot", "", "export a frozen snapshot instead of the live annotations")
+	by := fs.String("by", "", "page (default) or region")
+	coords := fs.String("coords", "", "absolute (default) or relative")
+	output := fs.String("o", "-", "output file")
+	fs.Parse(args)
+
+	q := url.Values{}
+	for k, v := range map[string]string{"project": *project, "split": *split, "snapshot": *snapshot, "by": *by, "coords": *coords} {
+		if v != "" {
+			q.Set(k, v)
+		}
+	}
+	resp, err := c.do(http.MethodGet, "/export/coco", q, "", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return writeOutput(*output, resp.Body)
+}
+
+func runValidate(c *client, args []string) error {
+	fs := commandFlags("validate")
+	iou := fs.String("overlap-iou", "", "IoU above which overlapping boxes are reported")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	q := url.Values{}
+	if *iou != "" {
+		q.Set("overlap_iou", *iou)
+	}
+	invalid := 0
+	for _, id := range fs.Args() {
+		var out struct {
+			Valid  bool `json:"valid"`
+			Issues []struct {
+				Code     string `json:"code"`
+				Severity string `json:"severity"`
+				ID       string `json:"id"`
+				OtherID  string `json:"other_id"`
+				Page     int    `json:"page"`
+				Field    string `json:"field"`
+				Message  string `json:"message"`
+			} `json:"issues"`
+		}
+		if err := c.call(http.MethodGet, "/documents/"+url.PathEscape(id)+"/validate", q, nil, &out); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", id, err)
+			invalid++
+			continue
+		}
+		status := "ok"
+		if !out.Valid {
+			status = "invalid"
+			invalid++
+		}
+		fmt.Printf("%s\t%s\t%d issue(s)\n", id, status, len(out.Issues))
+		for _, is := range out.Issues {
+			ids := is.ID
+			if is.OtherID != "" {
+				ids += ", " + is.OtherID
+			}
+			if is.Field != "" {
+				ids += " " + is.Field
+			}
+			fmt.Printf("  %s\t%s\tpage %d\t%s\t%s\n", is.Severity, is.Code, max(is.Page, 1), ids, is.Message)
+		}
+	}
+	if invalid > 0 {
+		return errFailed
+	}
+	return nil
+}
+
+// runResplit moves a project's documents between splits; it does not touch annotator assignments
+func runResplit(c *client, args []string) error {
+	fs := commandFlags("resplit")
+	project := fs.String("project", "", "project whose documents are split again (default: the backend's default project)")
+	ratios := fs.String("ratios", "", "comma-separated split=weight pairs (default train=0.8,val=0.1,test=0.1)")
+	seed := fs.String("seed", "", "seed for the deterministic assignment")
+	fs.Parse(args)
+
+	req := map[string]interface{}{"project": *project, "seed": *seed, "reassign": true}
+	if *ratios != "" {
+		r := map[string]float64{}
+		for _, pair := range strings.Split(*ratios, ",") {
+			name, weight, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			var w float64
+			if _, err := fmt.Sscan(weight, &w); !ok || err != nil {
+				return fmt.Errorf("ratios: %q is not split=weight", pair)
+			}
+			r[name] = w
+		}
+		req["ratios"] = r
+	}
+
+	var out struct {
+		Project  string         `json:"project"`
+		Assigned map[string]int `json:"assigned"`
+		Totals   map[string]int `json:"totals"`
+	}
+	if err := c.call(http.MethodPost, "/splits/assign", nil, req, &out); err != nil {
+		return err
+	}
+	fmt.Printf("Redrew the splits of %s\n", out.Project)
+	for name, n := range out.Totals {
+		fmt.Printf("  %s\t%d\n", name, n)
+	}
+	return nil
+}
+
+type apiKey struct {
+	ID        int64  `json:"id"`
+	Name      string `json:"name"`
+	Owner     string `json:"owner"`
+	Prefix    string `json:"prefix"`
+	Role      string `json:"role"`
+	CreatedAt string `json:"created_at"`
+	RevokedAt string `json:"revoked_at"`
+	Key       string `json:"key"`
+}
+
+func runKeys(c *client, args []string) error {
+	if len(args) == 0 {
+		commandFlags("keys").Usage()
+		os.Exit(2)
+	}
+	fs := commandFlags("keys")
+	switch args[0] {
+	case "list":
+		owner := fs.String("owner", "", "only this user's keys")
+		revoked := fs.Bool("revoked", false, "include revoked keys")
+		fs.Parse(args[1:])
+		q := url.Values{}
+		if *owner != "" {
+			q.Set("owner", *owner)
+		}
+		if *revoked {
+			q.Set("revoked", "true")
+		}
+		var out struct {
+			Keys []apiKey `json:"keys"`
+		}
+		if err := c.call(http.MethodGet, "/admin/api-keys", q, nil, &out); err != nil {
+			return err
+		}
+		for _, k := range out.Keys {
+			state := "active"
+			if k.RevokedAt != "" {
+				state = "revoked " + k.RevokedAt
+			}
+			fmt.Printf("%d\t%s\t%s\t%s...\t%s\t%s\t%s\n", k.ID, k.Owner, k.Name, k.Prefix, k.Role, k.CreatedAt, state)
+		}
+		return nil
+
+	case "create":
+		owner := fs.String("owner", "", "user or script the key is for (required)")
+		name := fs.String("name", "", "label for the key (default: the owner)")
+		role := fs.String("role", "user", "user, or admin for keys that may call /admin")
+		fs.Parse(args[1:])
+		if *owner == "" {
+			fs.Usage()
+			os.Exit(2)
+		}
+		var k apiKey
+		if err := c.call(http.MethodPost, "/admin/api-keys", nil, map[string]string{"owner": *owner, "name": *name, "role": *role}, &k); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Created %s key %d for %s. It is shown only once:\n", k.Role, k.ID, k.Owner)
+		fmt.Println(k.Key)
+		return nil
+
+	case "revoke":
+		fs.Parse(args[1:])
+		if fs.NArg() != 1 {
+			fs.Usage()
+			os.Exit(2)
+		}
+		var k apiKey
+		if err := c.call(http.MethodDelete, "/admin/api-keys/"+url.PathEscape(fs.Arg(0)), nil, nil, &k); err != nil {
+			return err
+		}
+		fmt.Printf("Revoked key %d (%s, %s...)\n", k.ID, k.Owner, k.Prefix)
+		return nil
+	}
+	return fmt.Errorf("unknown keys command %q (list, create, revoke)", args[0])
+}
+
+func runBackup(c *client, args []string) error {
+	fs := commandFlags("backup")
+	output := fs.String("o", "", "output file (.tar.gz; - for stdout)")
+	fs.Parse(args)
+	if *output == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	// A backup takes as long as the dataset is large
+	c.http.Timeout = 0
+	resp, err := c.do(http.MethodPost, "/admin/backup", nil, "", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return writeOutput(*output, resp.Body)
+}
+
+func runRestore(c *client, args []string) error {
+	fs := commandFlags("restore")
+	conflict := fs.String("conflict", "skip", "what to do with documents that already exist: skip, overwrite, or rename")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	c.http.Timeout = 0
+	resp, err := c.do(http.MethodPost, "/admin/restore", url.Values{"conflict": {*conflict}}, "application/gzip", f)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var out struct {
+		Tables []struct {
+			Name string `json:"name"`
+			Rows int64  `json:"rows"`
+		} `json:"tables"`
+		Documents struct {
+			Restored    int               `json:"restored"`
+			Skipped     []string          `json:"skipped"`
+			Overwritten []string          `json:"overwritten"`
+			Renamed     map[string]string `json:"renamed"`
+		} `json:"documents"`
+		Objects int `json:"objects"`
+		Files   int `json:"files"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return err
+	}
+	fmt.Printf("Restored %d document(s), %d object(s), %d file(s)\n", out.Documents.Restored, out.Objects, out.Files)
+	for _, t := range out.Tables {
+		fmt.Printf("  %s\t%d\n", t.Name, t.Rows)
+	}
+	if n := len(out.Documents.Skipped); n > 0 {
+		fmt.Printf("Skipped %d existing document(s): %s\n", n, strings.Join(out.Documents.Skipped, ", "))
+	}
+	if n := len(out.Documents.Overwritten); n > 0 {
+		fmt.Printf("Overwrote %d document(s): %s\n", n, strings.Join(out.Documents.Overwritten, ", "))
+	}
+	for old, name := range out.Documents.Renamed {
+		fmt.Printf("Renamed %s -> %s\n", old, name)
+	}
+	return nil
+}
@@ -0,0 +1,547 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/png"
+	"io"
+	"log/slog"
+	"math"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ---------- COCO Types ----------
+
+type COCODataset struct {
+	Info        COCOInfo         `json:"info"`
+	Images      []COCOImage      `json:"images"`
+	Annotations []COCOAnnotation `json:"annotations"`
+	Categories  []COCOCategory   `json:"categories"`
+}
+
+type COCOInfo struct {
+	Description string `json:"description"`
+	Version     string `json:"version"`
+	DateCreated string `json:"date_created"`
+}
+
+type COCOImage struct {
+	ID         int    `json:"id"`
+	FileName   string `json:"file_name"`
+	Width      int    `json:"width"`
+	Height     int    `json:"height"`
+	DocumentID string `json:"document_id,omitempty"`
+	Page       int    `json:"page,omitempty"`
+	Split      string `json:"split,omitempty"`
+	RegionID   string `json:"region_id,omitempty"`
+}
+
+type COCOAnnotation struct {
+	ID          int         `json:"id"`
+	ImageID     int         `json:"image_id"`
+	CategoryID  int         `json:"category_id"`
+	BBox        []float64   `json:"bbox"` // [x, y, width, height]
+	Area        float64     `json:"area"`
+	IsCrowd     int         `json:"iscrowd"`
+	ComponentID string      `json:"component_id,omitempty"`
+	Score       *float64    `json:"score,omitempty"`  // set by detectors; absent in ground truth
+	Values      []COCOValue `json:"values,omitempty"` // transcribed values linked to the component
+}
+
+// COCOValue is a value of a text annotation linked to a component, with its normalized form
+type COCOValue struct {
+	LabelName string `json:"label_name,omitempty"`
+	Value
+}
+
+type COCOCategory struct {
+	ID            int    `json:"id"`
+	Name          string `json:"name"`
+	Supercategory string `json:"supercategory"`
+}
+
+// ---------- COCO Export ----------
+
+// imageDimensions reads width/height from the image header without decoding pixels
+func imageDimensions(path string) (int, int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	cfg, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return 0, 0, err
+	}
+	return cfg.Width, cfg.Height, nil
+}
+
+// exportScope selects the documents an export covers; an empty Split means every document.
+// With Snapshot set the export is read from that frozen snapshot instead of the live tables.
+// Relative converts boxes to fractions of the image size. Regions exports one image per region.
+type exportScope struct {
+	Project  string
+	Split    string
+	Snapshot string
+	Relative bool
+	Regions  bool
+}
+
+func (s exportScope) String() string {
+	name := s.Project
+	if s.Snapshot != "" {
+		name += "@" + s.Snapshot
+	}
+	if s.Split != "" {
+		name += " (" + s.Split + ")"
+	}
+	return name
+}
+
+// buildCOCO assembles a COCO detection dataset from all components in a project
+func buildCOCO(ctx context.Context, scope exportScope) (*COCODataset, error) {
+	ds, err := buildCOCOPixels(ctx, scope)
+	if err != nil || !scope.Relative {
+		return ds, err
+	}
+	if err := relativizeCOCO(ds); err != nil {
+		return nil, err
+	}
+	return ds, nil
+}
+
+func buildCOCOPixels(ctx context.Context, scope exportScope) (*COCODataset, error) {
+	if scope.Snapshot != "" {
+		return loadSnapshotCOCO(ctx, scope)
+	}
+	if scope.Regions {
+		return buildRegionCOCO(ctx, scope)
+	}
+	out := &COCODataset{
+		Info: COCOInfo{
+			Description: fmt.Sprintf("corvina export of project %s", scope),
+			Version:     "1.0",
+			DateCreated: time.Now().UTC().Format(time.RFC3339),
+		},
+		Images:      []COCOImage{},
+		Annotations: []COCOAnnotation{},
+		Categories:  []COCOCategory{},
+	}
+
+	// One COCO image per page; documents without page rows count as a single page
+	docRows, err := readDB(ctx).QueryContext(ctx, `
+		SELECT d.document_id, COALESCE(p.page_number, 1), COALESCE(p.image_file, d.image_file),
+		       COALESCE(p.width, 0), COALESCE(p.height, 0), COALESCE(p.storage_key, ''), COALESCE(d.split, '')
+		FROM documents d LEFT JOIN pages p ON p.document_id = d.document_id
+		WHERE d.project = $1 AND ($2 = '' OR d.split = $2)
+		ORDER BY d.id, 2
+	`, scope.Project, scope.Split)
+	if err != nil {
+		return nil, err
+	}
+	type pageKey struct {
+		docID string
+		page  int
+	}
+	imageIDs := map[pageKey]int{}
+	for docRows.Next() {
+		img := COCOImage{ID: len(out.Images) + 1}
+		var storageKey string
+		if err := docRows.Scan(&img.DocumentID, &img.Page, &img.FileName, &img.Width, &img.Height, &storageKey, &img.Split); err != nil {
+			docRows.Close()
+			return nil, err
+		}
+		if img.Width == 0 || img.Height == 0 {
+			// Keep the image entry even if the file is unreadable; consumers can still use the annotations
+			img.Width, img.Height, _ = imageDimensions(documentImagePath(storageKey, img.DocumentID, img.FileName))
+		}
+		imageIDs[pageKey{img.DocumentID, img.Page}] = img.ID
+		out.Images = append(out.Images, img)
+	}
+	docRows.Close()
+	if err := docRows.Err(); err != nil {
+		return nil, err
+	}
+
+	compRows, err := readPool(ctx).Query(ctx, `
+		SELECT c.document_id, c.id, c.label, COALESCE(c.bbox, '{}'), c.page_number
+		FROM components c JOIN documents d ON d.document_id = c.document_id
+		WHERE d.project = $1 AND ($2 = '' OR d.split = $2)
+		ORDER BY d.id, c.page_number, c.id
+	`, scope.Project, scope.Split)
+	if err != nil {
+		return nil, err
+	}
+	defer compRows.Close()
+
+	type compRow struct {
+		docID, id, label string
+		bbox             []int
+		page             int
+	}
+	var comps []compRow
+	labels := map[string]bool{}
+	for compRows.Next() {
+		var c compRow
+		if err := compRows.Scan(&c.docID, &c.id, &c.label, &c.bbox, &c.page); err != nil {
+			return nil, err
+		}
+		if len(c.bbox) != 4 {
+			continue
+		}
+		comps = append(comps, c)
+		labels[c.label] = true
+	}
+	if err := compRows.Err(); err != nil {
+		return nil, err
+	}
+
+	values, err := componentValues(ctx, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	var categoryIDs map[string]int
+	out.Categories, categoryIDs = cocoCategories(labels)
+
+	for i, c := range comps {
+		x1, y1, x2, y2 := float64(c.bbox[0]), float64(c.bbox[1]), float64(c.bbox[2]), float64(c.bbox[3])
+		w, h := x2-x1, y2-y1
+		out.Annotations = append(out.Annotations, COCOAnnotation{
+			ID:          i + 1,
+			ImageID:     imageIDs[pageKey{c.docID, c.page}],
+			CategoryID:  categoryIDs[c.label],
+			BBox:        []float64{x1, y1, w, h},
+			Area:        w * h,
+			ComponentID: c.id,
+			Values:      values[[2]string{c.docID, c.id}],
+		})
+	}
+
+	return out, nil
+}
+
+// componentValues collects the values of text annotations linked to components in scope, keyed
+// by document and component id
+func componentValues(ctx context.Context, scope exportScope) (map[[2]string][]COCOValue, error) {
+	rows, err := readPool(ctx).Query(ctx, `
+		SELECT t.document_id, t.linked_to, COALESCE(t.label_name, ''), t.values
+		FROM text_annotations t JOIN documents d ON d.document_id = t.document_id
+		WHERE d.project = $1 AND ($2 = '' OR d.split = $2)
+			AND t.linked_to IS NOT NULL AND t.values IS NOT NULL AND NOT t.is_ignored
+		ORDER BY t.document_id, t.id
+	`, scope.Project, scope.Split)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := map[[2]string][]COCOValue{}
+	for rows.Next() {
+		var docID, compID, label string
+		var vs []Value
+		if err := rows.Scan(&docID, &compID, &label, &vs); err != nil {
+			return nil, err
+		}
+		normalizeValues(vs)
+		key := [2]string{docID, compID}
+		for _, v := range vs {
+			out[key] = append(out[key], COCOValue{LabelName: label, Value: v})
+		}
+	}
+	return out, rows.Err()
+}
+
+// cocoCategories assigns category IDs alphabetically so they are stable across exports
+func cocoCategories(labels map[string]bool) ([]COCOCategory, map[string]int) {
+	names := make([]string, 0, len(labels))
+	for l := range labels {
+		names = append(names, l)
+	}
+	sort.Strings(names)
+	categories := []COCOCategory{}
+	categoryIDs := map[string]int{}
+	for i, name := range names {
+		categoryIDs[name] = i + 1
+		categories = append(categories, COCOCategory{ID: i + 1, Name: name, Supercategory: "component"})
+	}
+	return categories, categoryIDs
+}
+
+// handleExportCOCO: GET /export/coco?project=&split=&snapshot=&coords=relative&by=page|region
+func handleExportCOCO(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		jsonError(w, http.StatusMethodNotAllowed, "GET only")
+		return
+	}
+
+	q := r.URL.Query()
+	scope := exportScope{Project: q.Get("project"), Split: q.Get("split"), Snapshot: q.Get("snapshot")}
+	var err error
+	if scope.Relative, err = coordsModeFromQuery(q.Get("coords")); err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	switch q.Get("by") {
+	case "", "page":
+	case "region":
+		if scope.Snapshot != "" {
+			jsonError(w, http.StatusBadRequest, "Snapshots are stored per page; by=region is not available")
+			return
+		}
+		scope.Regions = true
+	default:
+		jsonError(w, http.StatusBadRequest, "by must be page or region")
+		return
+	}
+	if scope.Project == "" {
+		scope.Project = defaultProject
+	}
+
+	dataset, err := buildCOCO(r.Context(), scope)
+	if errors.Is(err, errSnapshotNotFound) {
+		jsonError(w, http.StatusNotFound, "Snapshot not found")
+		return
+	}
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "Export failed")
+		return
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", exportBaseName(scope)+"_coco.json"))
+	jsonResponse(w, http.StatusOK, dataset)
+}
+
+// ---------- COCO Import ----------
+
+// COCOImportResult reports the outcome for one image of an import
+type COCOImportResult struct {
+	FileName   string `json:"file_name"`
+	DocumentID string `json:"document_id,omitempty"`
+	Status     string `json:"status"` // created | existing | error
+	Components int    `json:"components"`
+	Error      string `json:"error,omitempty"`
+}
+
+// readCOCOPayload takes the COCO JSON from an "annotations" file part or form field
+func readCOCOPayload(r *http.Request) (*COCODataset, error) {
+	var data []byte
+	if f, _, err := r.FormFile("annotations"); err == nil {
+		defer f.Close()
+		if data, err = io.ReadAll(f); err != nil {
+			return nil, err
+		}
+	} else if v := r.FormValue("annotations"); v != "" {
+		data = []byte(v)
+	} else {
+		return nil, fmt.Errorf("missing annotations")
+	}
+
+	var dataset COCODataset
+	if err := json.Unmarshal(data, &dataset); err != nil {
+		return nil, fmt.Errorf("invalid COCO JSON: %v", err)
+	}
+	return &dataset, nil
+}
+
+// resolveImportDocument finds the document an import image refers to, uploading it when the
+// image file itself is part of the request
+func resolveImportDocument(ctx context.Context, img COCOImage, uploads map[string]*multipart.FileHeader, project string, opts UploadOptions) (string, string, error) {
+	if fh, ok := uploads[img.FileName]; ok {
+		f, err := fh.Open()
+		if err != nil {
+			return "", "", err
+		}
+		defer f.Close()
+
+		docID := newDocumentID(img.FileName)
+		_, err = registerUpload(ctx, docID, img.FileName, project, opts, f)
+		var de *DuplicateUploadError
+		if errors.As(err, &de) {
+			// The image is already in the project; attach the annotations to that document
+			return de.DocumentID, "existing", nil
+		}
+		var ee *DocumentExistsError
+		if errors.As(err, &ee) {
+			// Same name with DOCUMENT_ID_MODE=filename: annotate the document, keep its image
+			return ee.DocumentID, "existing", nil
+		}
+		if err != nil {
+			return "", "", err
+		}
+		return docID, "created", nil
+	}
+
+	// Reference to an already-uploaded image: by explicit document_id, then by file name
+	var docID string
+	err := db.QueryRowContext(ctx, `
+		SELECT document_id FROM documents
+		WHERE document_id = $1 OR image_file = $2 OR original_filename = $2
+		ORDER BY (document_id = $1) DESC, id DESC LIMIT 1
+	`, img.DocumentID, img.FileName).Scan(&docID)
+	if err != nil {
+		return "", "", fmt.Errorf("image not included in request and no uploaded document matches")
+	}
+	return docID, "existing", nil
+}
+
+// cocoImportMaxBytes caps a whole import request: the annotation JSON plus any attached images
+var cocoImportMaxBytes = int64(envInt("COCO_IMPORT_MAX_MB", 512)) << 20
+
+// handleImportCOCO creates documents and components from a COCO dataset. Images may be sent as
+// "images" file parts or reference documents that were uploaded earlier.
+func handleImportCOCO(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		jsonError(w, http.StatusMethodNotAllowed, "POST only")
+		return
+	}
+
+	limitRequestBody(w, r, cocoImportMaxBytes)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		if isTooLarge(err) {
+			tooLargeError(w, "Import", cocoImportMaxBytes)
+			return
+		}
+		jsonError(w, http.StatusBadRequest, "Expected multipart form data")
+		return
+	}
+
+	dataset, err := readCOCOPayload(r)
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	project := strings.TrimSpace(r.FormValue("project"))
+	if project == "" {
+		project = defaultProject
+	}
+	replace := r.FormValue("mode") == "replace"
+	minScore := 0.0
+	if v := r.FormValue("min_score"); v != "" {
+		if minScore, err = strconv.ParseFloat(v, 64); err != nil {
+			jsonError(w, http.StatusBadRequest, "Invalid min_score")
+			return
+		}
+	}
+
+	uploads := map[string]*multipart.FileHeader{}
+	for _, fh := range r.MultipartForm.File["images"] {
+		uploads[filepath.Base(fh.Filename)] = fh
+	}
+
+	categories := map[int]string{}
+	for _, c := range dataset.Categories {
+		categories[c.ID] = c.Name
+	}
+	annsByImage := map[int][]COCOAnnotation{}
+	for _, a := range dataset.Annotations {
+		annsByImage[a.ImageID] = append(annsByImage[a.ImageID], a)
+	}
+
+	results := make([]COCOImportResult, 0, len(dataset.Images))
+	var nCreated, nComponents, nFailed int
+
+	for _, img := range dataset.Images {
+		res := COCOImportResult{FileName: img.FileName}
+
+		docID, status, err := resolveImportDocument(r.Context(), img, uploads, project, UploadOptions{Uploader: requestUser(r), QuotaUser: quotaUser(r)})
+		if err == nil {
+			res.DocumentID, res.Status = docID, status
+			res.Components, err = importCOCOComponents(r.Context(), docID, img.Page, annsByImage[img.ID], categories, minScore, replace)
+		}
+		if err != nil {
+			res.Status, res.Error = "error", err.Error()
+			nFailed++
+		} else {
+			if status == "created" {
+				nCreated++
+			}
+			nComponents += res.Components
+		}
+		results = append(results, res)
+	}
+
+	slog.InfoContext(r.Context(), "COCO import", "images", len(dataset.Images), "created", nCreated,
+		"failed", nFailed, "components", nComponents, "project", project)
+
+	jsonResponse(w, http.StatusOK, map[string]interface{}{
+		"status":     "success",
+		"project":    project,
+		"images":     len(dataset.Images),
+		"created":    nCreated,
+		"failed":     nFailed,
+		"components": nComponents,
+		"results":    results,
+	})
+}
+
+// importCOCOComponents converts COCO [x, y, w, h] boxes into components for one document
+func importCOCOComponents(ctx context.Context, docID string, page int, anns []COCOAnnotation, categories map[int]string, minScore float64, replace bool) (int, error) {
+	if page == 0 {
+		page = 1
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if replace {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM components WHERE document_id = $1 AND page_number = $2", docID, page); err != nil {
+			return 0, err
+		}
+	}
+
+	n := 0
+	for _, a := range anns {
+		if len(a.BBox) != 4 {
+			continue
+		}
+		if a.Score != nil && *a.Score < minScore {
+			continue
+		}
+		label, ok := categories[a.CategoryID]
+		if !ok {
+			return 0, fmt.Errorf("annotation %d references unknown category %d", a.ID, a.CategoryID)
+		}
+
+		x, y, bw, bh := a.BBox[0], a.BBox[1], a.BBox[2], a.BBox[3]
+		bbox := []int{
+			int(math.Round(x)), int(math.Round(y)),
+			int(math.Round(x + bw)), int(math.Round(y + bh)),
+		}
+		id := a.ComponentID
+		if id == "" {
+			id = newID()
+		}
+
+		res, err := tx.ExecContext(ctx,
+			"INSERT INTO components (id, document_id, label, bbox, page_number, provenance) VALUES ($1, $2, $3, $4, $5, 'import') ON CONFLICT (document_id, id) DO NOTHING",
+			id, docID, label, bbox, page,
+		)
+		if err != nil {
+			return 0, err
+		}
+		// An id already on the document is skipped, not counted
+		inserted, err := res.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		n += int(inserted)
+	}
+
+	return n, tx.Commit()
+}
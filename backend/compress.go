@@ -0,0 +1,222 @@
+package main
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+// ---------- Response Compression ----------
+
+// JSON responses (documents with their polyline points, listings, exports) are compressed with
+// zstd or gzip, whichever the client prefers in Accept-Encoding. Responses below
+// COMPRESS_MIN_BYTES go out as they are, since the framing would cost more than it saves.
+var (
+	compressMinBytes = envInt("COMPRESS_MIN_BYTES", 1024)
+	compressZstd     = envBool("COMPRESS_ZSTD", true)
+)
+
+var (
+	gzipWriters = sync.Pool{New: func() any {
+		zw, _ := gzip.NewWriterLevel(nil, gzip.DefaultCompression)
+		return zw
+	}}
+	zstdWriters = sync.Pool{New: func() any {
+		zw, _ := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedDefault), zstd.WithEncoderConcurrency(1))
+		return zw
+	}}
+)
+
+// compressibleTypes are the content types worth compressing; images and archives already are
+var compressibleTypes = map[string]bool{
+	"application/json":         true,
+	"application/problem+json": true,
+	"application/x-ndjson":     true,
+	"image/svg+xml":            true,
+	"text/csv":                 true,
+	"text/plain":               true,
+}
+
+// negotiateEncoding picks zstd, gzip, or "" (identity) from an Accept-Encoding header.
+// Ties go to zstd, which is both faster and smaller.
+func negotiateEncoding(accept string) string {
+	q := map[string]float64{}
+	for _, part := range strings.Split(accept, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		weight := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				weight = f
+			}
+		}
+		q[name] = weight
+	}
+	weight := func(enc string) float64 {
+		if w, ok := q[enc]; ok {
+			return w
+		}
+		return q["*"]
+	}
+	best, bestQ := "", 0.0
+	if compressZstd && weight("zstd") > bestQ {
+		best, bestQ = "zstd", weight("zstd")
+	}
+	if weight("gzip") > bestQ {
+		best = "gzip"
+	}
+	return best
+}
+
+// compressWriter holds back the first compressMinBytes of a response, then decides whether to
+// compress it. The decision also happens when the handler flushes or returns.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	status   int
+	buf      []byte
+	decided  bool
+	enc      io.WriteCloser
+}
+
+func (c *compressWriter) WriteHeader(status int) {
+	if c.status == 0 {
+		c.status = status
+	}
+}
+
+func (c *compressWriter) Write(p []byte) (int, error) {
+	if c.status == 0 {
+		c.status = http.StatusOK
+	}
+	if !c.decided {
+		c.buf = append(c.buf, p...)
+		if len(c.buf) < compressMinBytes {
+			return len(p), nil
+		}
+		if err := c.decide(); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	if c.enc != nil {
+		return c.enc.Write(p)
+	}
+	return c.ResponseWriter.Write(p)
+}
+
+// decide starts the response, compressed or not, and writes out what was held back
+func (c *compressWriter) decide() error {
+	c.decided = true
+	if c.status == 0 {
+		c.status = http.StatusOK
+	}
+	if len(c.buf) >= compressMinBytes && c.shouldCompress() {
+		h := c.Header()
+		h.Set("Content-Encoding", c.encoding)
+		h.Del("Content-Length")
+		// The compressed bytes differ from what a strong ETag describes
+		if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			h.Set("ETag", "W/"+etag)
+		}
+		switch c.encoding {
+		case "zstd":
+			zw := zstdWriters.Get().(*zstd.Encoder)
+			zw.Reset(c.ResponseWriter)
+			c.enc = zw
+		default:
+			zw := gzipWriters.Get().(*gzip.Writer)
+			zw.Reset(c.ResponseWriter)
+			c.enc = zw
+		}
+	}
+	c.ResponseWriter.WriteHeader(c.status)
+	buf := c.buf
+	c.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if c.enc != nil {
+		_, err = c.enc.Write(buf)
+	} else {
+		_, err = c.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+func (c *compressWriter) shouldCompress() bool {
+	h := c.Header()
+	if c.status != http.StatusOK || h.Get("Content-Encoding") != "" || h.Get("Content-Range") != "" {
+		return false
+	}
+	mediaType, _, _ := mime.ParseMediaType(h.Get("Content-Type"))
+	return compressibleTypes[mediaType]
+}
+
+// Flush sends what has been written so far, so streamed ndjson still arrives line by line
+func (c *compressWriter) Flush() {
+	if !c.decided {
+		c.decide()
+	}
+	switch enc := c.enc.(type) {
+	case *gzip.Writer:
+		enc.Flush()
+	case *zstd.Encoder:
+		enc.Flush()
+	}
+	if f, ok := c.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (c *compressWriter) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
+
+// close finishes the compressed stream and returns the encoder to its pool
+func (c *compressWriter) close() {
+	if !c.decided {
+		if c.status == 0 && len(c.buf) == 0 {
+			return // the handler wrote nothing; let the server send its default
+		}
+		c.decide()
+	}
+	switch enc := c.enc.(type) {
+	case *gzip.Writer:
+		enc.Close()
+		enc.Reset(io.Discard)
+		gzipWriters.Put(enc)
+	case *zstd.Encoder:
+		enc.Close()
+		enc.Reset(nil)
+		zstdWriters.Put(enc)
+	}
+	c.enc = nil
+}
+
+// compressed wraps a handler whose responses are worth compressing
+func compressed(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+		if encoding == "" || r.Method == http.MethodHead || r.Header.Get("Range") != "" {
+			next(w, r)
+			return
+		}
+		cw := &compressWriter{ResponseWriter: w, encoding: encoding}
+		next(cw, r)
+		// Not deferred: after a panic nothing has been sent yet, and the recovery middleware
+		// can still answer 500
+		cw.close()
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ---------- Configuration ----------
+
+// Every setting is read through the env* helpers (env.go) and comes from, highest precedence
+// first: a command-line flag (--UPLOAD_MAX_MB=64 or --upload-max-mb=64), the environment, or
+// the YAML file named by --config or CONFIG_FILE. The file is a flat map of the same keys
+// (upload_max_mb: 64 works too); lists are joined with commas. Each setting read is recorded,
+// so unknown keys and malformed values stop the server at startup, and GET /admin/config
+// shows what is in effect and where it came from.
+
+// setting is one recorded setting as /admin/config reports it
+type setting struct {
+	Key     string `json:"key"`
+	Value   string `json:"value"`
+	Default string `json:"default"`
+	Source  string `json:"source"` // default | file | env | flag
+}
+
+type configSources struct {
+	mu       sync.Mutex
+	flags    map[string]string
+	file     map[string]string
+	fileName string
+	settings map[string]*setting
+	errs     []string
+	help     bool
+}
+
+// config is initialized before any setting is read, since the env* helpers depend on it
+var config = loadConfigSources(os.Args[1:])
+
+// configKey turns upload-max-mb or upload_max_mb into UPLOAD_MAX_MB
+func configKey(name string) string {
+	return strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(name), "-", "_"))
+}
+
+// loadConfigSources parses the flags and the config file. It must not log: the logger itself is
+// configured from these settings. Problems are kept for checkConfig.
+func loadConfigSources(args []string) *configSources {
+	c := &configSources{flags: map[string]string{}, file: map[string]string{}, settings: map[string]*setting{}}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") {
+			c.errs = append(c.errs, fmt.Sprintf("unexpected argument %q", arg))
+			continue
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		switch {
+		case name == "h" || name == "help":
+			c.help = true
+		case name == "config":
+			if !hasValue && i+1 < len(args) {
+				i++
+				value, hasValue = args[i], true
+			}
+			if !hasValue {
+				c.errs = append(c.errs, "--config needs a file name")
+			}
+			c.fileName = value
+		case hasValue:
+			c.flags[configKey(name)] = value
+		default:
+			c.errs = append(c.errs, fmt.Sprintf("flag %s needs a value (--%s=...)", arg, name))
+		}
+	}
+
+	if c.fileName == "" {
+		c.fileName = os.Getenv("CONFIG_FILE")
+	}
+	if c.fileName != "" {
+		if err := c.loadFile(c.fileName); err != nil {
+			c.errs = append(c.errs, fmt.Sprintf("config file %s: %v", c.fileName, err))
+		}
+	}
+	return c
+}
+
+func (c *configSources) loadFile(name string) error {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	for k, v := range raw {
+		switch v := v.(type) {
+		case nil:
+		case []interface{}:
+			parts := make([]string, len(v))
+			for i, item := range v {
+				parts[i] = fmt.Sprint(item)
+			}
+			c.file[configKey(k)] = strings.Join(parts, ",")
+		case map[string]interface{}:
+			return fmt.Errorf("%s: nested sections are not supported, use flat keys", k)
+		default:
+			c.file[configKey(k)] = fmt.Sprint(v)
+		}
+	}
+	return nil
+}
+
+// lookup returns the value of key from the highest-precedence source that sets it, or "" when
+// none does, and records the setting
+func (c *configSources) lookup(key, def string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := &setting{Key: key, Default: def, Source: "default"}
+	if v, ok := c.flags[key]; ok {
+		s.Value, s.Source = v, "flag"
+	} else if v := os.Getenv(key); v != "" {
+		s.Value, s.Source = v, "env"
+	} else if v, ok := c.file[key]; ok {
+		s.Value, s.Source = v, "file"
+	}
+	c.settings[key] = s
+	return s.Value
+}
+
+// invalid records a malformed value; the server refuses to start with it
+func (c *configSources) invalid(key, value, want string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.errs = append(c.errs, fmt.Sprintf("%s=%q: want %s", key, value, want))
+}
+
+// checkConfig reports every configuration problem at once: bad flags or file, malformed values,
+// and keys set in a flag or the file that no setting reads (usually a typo)
+func checkConfig() error {
+	c := config
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	errs := append([]string(nil), c.errs...)
+	for _, src := range []map[string]string{c.flags, c.file} {
+		for k := range src {
+			if _, known := c.settings[k]; !known {
+				errs = append(errs, fmt.Sprintf("unknown setting %s", k))
+			}
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	sort.Strings(errs)
+	return fmt.Errorf("invalid configuration:\n  %s", strings.Join(errs, "\n  "))
+}
+
+// printConfigHelp lists every setting with its default, for --help
+func printConfigHelp() {
+	fmt.Fprintf(os.Stderr, "Usage: server [--config file.yaml] [--SETTING=value ...]\n\nSettings (flag, environment variable, or config file key):\n")
+	for _, s := range configSettings() {
+		fmt.Fprintf(os.Stderr, "  %-32s default %q\n", s.Key, s.Default)
+	}
+}
+
+// configSettings returns the recorded settings sorted by key, with secrets masked
+func configSettings() []setting {
+	config.mu.Lock()
+	defer config.mu.Unlock()
+	out := make([]setting, 0, len(config.settings))
+	for _, s := range config.settings {
+		v := *s
+		if v.Source == "default" {
+			v.Value = v.Default
+		}
+		if v.Value != "" && isSecretSetting(v.Key) {
+			v.Value = redactSetting(v.Key, v.Value)
+		}
+		out = append(out, v)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out
+}
+
+func isSecretSetting(key string) bool {
+	return strings.Contains(key, "SECRET") || strings.Contains(key, "PASSWORD") || strings.Contains(key, "TOKEN") ||
+		strings.HasSuffix(key, "_KEY") || strings.HasSuffix(key, "_KEYS") || key == "DATABASE_URL"
+}
+
+// redactSetting keeps a DSN readable without its password and hides other secrets entirely
+func redactSetting(key, value string) string {
+	if key == "DATABASE_URL" {
+		if u, err := url.Parse(value); err == nil && u.Host != "" {
+			return u.Redacted()
+		}
+	}
+	return "xxxxx"
+}
+
+// handleConfig lists the settings in effect: GET /admin/config
+func handleConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		jsonError(w, http.StatusMethodNotAllowed, "GET only")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]interface{}{
+		"config_file": config.fileName,
+		"settings":    configSettings(),
+	})
+}
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ---------- Consistency Check ----------
+
+// The consistency_check job compares the database with the files it points at and reports:
+//
+//   - orphan objects and files: stored content no row refers to
+//   - missing files: rows whose object or legacy file is gone
+//   - orphan rows: annotations, pages, and the like whose document no longer exists (databases
+//     created before the foreign keys can have them)
+//
+// With repair set it also deletes the orphans and clears thumbnail keys whose object is missing
+// (they are regenerated on the next request). Rows whose image is missing are only reported;
+// deciding what to do with them is left to a person. Reports are the job results, and the latest
+// one is served by GET /admin/consistency.
+
+// consistencyGrace protects content written by requests still in flight: an upload stores its
+// image before it commits the document row, so only orphans older than this are reported
+var consistencyGrace = envDuration("CONSISTENCY_GRACE", time.Hour)
+
+// consistencyListLimit caps each list in a report; the counts are always complete
+const consistencyListLimit = 1000
+
+// datasetReservedDirs are directories under DATASET_DIR that do not belong to a document
+var datasetReservedDirs = map[string]bool{objectsDir: true, "cache": true, tilesDir: true, tusUploadsDir: true}
+
+func init() {
+	registerJobHandler("consistency_check", runConsistencyJob)
+}
+
+type consistencyJobPayload struct {
+	Repair bool `json:"repair"`
+}
+
+type MissingFile struct {
+	DocumentID string `json:"document_id,omitempty"`
+	Page       int    `json:"page,omitempty"`
+	Kind       string `json:"kind"` // image, original, thumbnail, snapshot, version, or version image
+	Key        string `json:"key"`  // object key, or the path under DATASET_DIR for legacy files
+}
+
+type OrphanRows struct {
+	Table      string `json:"table"`
+	DocumentID string `json:"document_id"`
+	Rows       int64  `json:"rows"`
+}
+
+type ConsistencyReport struct {
+	Repair            bool          `json:"repair"`
+	Objects           int           `json:"objects"` // objects in the store
+	OrphanObjects     int           `json:"orphan_objects"`
+	OrphanFiles       int           `json:"orphan_files"`
+	MissingFiles      int           `json:"missing_files"`
+	OrphanRows        int64         `json:"orphan_rows"`
+	Orphans           []string      `json:"orphans"` // objects/<key> and <document_id>/<file> under DATASET_DIR
+	Missing           []MissingFile `json:"missing"`
+	OrphanDocuments   []OrphanRows  `json:"orphan_documents"`
+	Deleted           int           `json:"deleted"`      // orphan objects and files removed
+	DeletedRows       int64         `json:"deleted_rows"` // orphan rows removed
+	ClearedThumbnails int           `json:"cleared_thumbnails"`
+	Truncated         bool          `json:"truncated,omitempty"` // a list hit the limit
+}
+
+// addOrphan records stored content nothing refers to
+func (r *ConsistencyReport) addOrphan(name string) {
+	if len(r.Orphans) < consistencyListLimit {
+		r.Orphans = append(r.Orphans, name)
+	} else {
+		r.Truncated = true
+	}
+}
+
+func (r *ConsistencyReport) addMissing(m MissingFile) {
+	r.MissingFiles++
+	if len(r.Missing) < consistencyListLimit {
+		r.Missing = append(r.Missing, m)
+	} else {
+		r.Truncated = true
+	}
+}
+
+// referencedObjects maps each object key the database points at to what points at it
+func referencedObjects(ctx context.Context) (map[string]MissingFile, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT storage_key, document_id, 0, 'original' FROM documents WHERE storage_key IS NOT NULL
+		UNION ALL SELECT thumbnail_key, document_id, 1, 'thumbnail' FROM documents WHERE thumbnail_key IS NOT NULL
+		UNION ALL SELECT storage_key, document_id, page_number, 'image' FROM pages WHERE storage_key IS NOT NULL
+		UNION ALL SELECT storage_key, document_id, 0, 'version' FROM document_versions WHERE storage_key IS NOT NULL
+		UNION ALL SELECT p->>'storage_key', document_id, (p->>'page_number')::int, 'version image'
+			FROM document_versions, jsonb_array_elements(pages) p WHERE p->>'storage_key' IS NOT NULL
+		UNION ALL SELECT storage_key, project || '/' || tag, 0, 'snapshot' FROM dataset_snapshots`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	refs := map[string]MissingFile{}
+	for rows.Next() {
+		var m MissingFile
+		if err := rows.Scan(&m.Key, &m.DocumentID, &m.Page, &m.Kind); err != nil {
+			return nil, err
+		}
+		if _, seen := refs[m.Key]; !seen {
+			refs[m.Key] = m
+		}
+	}
+	return refs, rows.Err()
+}
+
+// checkObjects compares the object store with the keys the database refers to
+func checkObjects(ctx context.Context, rep *ConsistencyReport, repair bool) error {
+	// Listed before the references are read, so an object whose row commits in between is
+	// seen as referenced rather than orphaned
+	keys, err := store.List("")
+	if err != nil {
+		return fmt.Errorf("listing objects: %w", err)
+	}
+	refs, err := referencedObjects(ctx)
+	if err != nil {
+		return fmt.Errorf("reading object references: %w", err)
+	}
+	rep.Objects = len(keys)
+
+	cutoff := time.Now().Add(-consistencyGrace)
+	for _, key := range keys {
+		if _, ok := refs[key]; ok {
+			delete(refs, key)
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if mod, err := store.ModTime(key); err != nil || mod.After(cutoff) {
+			continue
+		}
+		rep.OrphanObjects++
+		rep.addOrphan("objects/" + key)
+		if repair {
+			if err := store.Delete(key); err != nil {
+				return fmt.Errorf("deleting object %s: %w", key, err)
+			}
+			rep.Deleted++
+		}
+	}
+
+	// Whatever is left was referenced but not listed
+	missing := make([]MissingFile, 0, len(refs))
+	for _, m := range refs {
+		missing = append(missing, m)
+	}
+	slices.SortFunc(missing, func(a, b MissingFile) int {
+		if a.DocumentID != b.DocumentID {
+			return strings.Compare(a.DocumentID, b.DocumentID)
+		}
+		return a.Page - b.Page
+	})
+	for _, m := range missing {
+		rep.addMissing(m)
+		if repair && m.Kind == "thumbnail" {
+			if _, err := db.ExecContext(ctx, "UPDATE documents SET thumbnail_key = NULL WHERE document_id = $1 AND thumbnail_key = $2", m.DocumentID, m.Key); err != nil {
+				return err
+			}
+			rep.ClearedThumbnails++
+		}
+	}
+	return nil
+}
+
+// checkLegacyFiles compares the per-document directories of DATASET_DIR, used before content
+// addressing, with the rows that still point into them
+func checkLegacyFiles(ctx context.Context, rep *ConsistencyReport, repair bool) error {
+	rows, err := db.QueryContext(ctx, backupFilesQuery)
+	if err != nil {
+		return fmt.Errorf("reading legacy files: %w", err)
+	}
+	defer rows.Close()
+	wanted := map[string]bool{}
+	var files [][2]string
+	for rows.Next() {
+		var f [2]string
+		if err := rows.Scan(&f[0], &f[1]); err != nil {
+			return err
+		}
+		wanted[filepath.Join(f[0], f[1])] = true
+		files = append(files, f)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		if _, err := os.Stat(filepath.Join(datasetDir, f[0], f[1])); errors.Is(err, fs.ErrNotExist) {
+			rep.addMissing(MissingFile{DocumentID: f[0], Kind: "image", Key: filepath.ToSlash(filepath.Join(f[0], f[1]))})
+		}
+	}
+
+	entries, err := os.ReadDir(datasetDir)
+	if err != nil {
+		return err
+	}
+	cutoff := time.Now().Add(-consistencyGrace)
+	for _, e := range entries {
+		if !e.IsDir() || datasetReservedDirs[e.Name()] || e.Name()[0] == '.' {
+			continue
+		}
+		dir := filepath.Join(datasetDir, e.Name())
+		if ingestDir != "" && sameDir(dir, ingestDir) {
+			continue
+		}
+		err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			rel, _ := filepath.Rel(datasetDir, p)
+			if wanted[rel] {
+				return nil
+			}
+			if info, err := d.Info(); err != nil || info.ModTime().After(cutoff) {
+				return nil
+			}
+			rep.OrphanFiles++
+			rep.addOrphan(filepath.ToSlash(rel))
+			if repair {
+				if err := os.Remove(p); err != nil {
+					return err
+				}
+				rep.Deleted++
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("scanning %s: %w", dir, err)
+		}
+		if repair {
+			removeEmptyDirs(dir)
+		}
+	}
+	return nil
+}
+
+// sameDir reports whether a and b name the same directory
+func sameDir(a, b string) bool {
+	ia, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	ib, err := os.Stat(b)
+	return err == nil && os.SameFile(ia, ib)
+}
+
+// removeEmptyDirs removes dir and the directories below it that hold no files
+func removeEmptyDirs(dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			removeEmptyDirs(filepath.Join(dir, e.Name()))
+		}
+	}
+	os.Remove(dir) // fails, harmlessly, when something is left
+}
+
+// checkOrphanRows finds rows of document tables whose document is gone
+func checkOrphanRows(ctx context.Context, rep *ConsistencyReport, repair bool) error {
+	// Every table that hangs off documents, other than documents itself
+	for _, table := range restoreDocumentTables[1:] {
+		rows, err := db.QueryContext(ctx, fmt.Sprintf(`SELECT document_id, count(*) FROM %s t
+			WHERE NOT EXISTS (SELECT 1 FROM documents d WHERE d.document_id = t.document_id)
+			GROUP BY document_id ORDER BY document_id`, table))
+		if err != nil {
+			return fmt.Errorf("checking %s: %w", table, err)
+		}
+		var found []OrphanRows
+		for rows.Next() {
+			o := OrphanRows{Table: table}
+			if err := rows.Scan(&o.DocumentID, &o.Rows); err != nil {
+				rows.Close()
+				return err
+			}
+			found = append(found, o)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, o := range found {
+			rep.OrphanRows += o.Rows
+			if len(rep.OrphanDocuments) < consistencyListLimit {
+				rep.OrphanDocuments = append(rep.OrphanDocuments, o)
+			} else {
+				rep.Truncated = true
+			}
+		}
+		if repair && len(found) > 0 {
+			res, err := db.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s t
+				WHERE NOT EXISTS (SELECT 1 FROM documents d WHERE d.document_id = t.document_id)`, table))
+			if err != nil {
+				return fmt.Errorf("deleting from %s: %w", table, err)
+			}
+			n, _ := res.RowsAffected()
+			rep.DeletedRows += n
+		}
+	}
+	return nil
+}
+
+func runConsistencyJob(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+	var p consistencyJobPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return nil, err
+	}
+	// Scanning a large dataset takes longer than any single query is allowed
+	ctx = withoutQueryTimeout(ctx)
+
+	rep := &ConsistencyReport{Repair: p.Repair, Orphans: []string{}, Missing: []MissingFile{}, OrphanDocuments: []OrphanRows{}}
+	if err := checkOrphanRows(ctx, rep, p.Repair); err != nil {
+		return nil, err
+	}
+	if err := checkObjects(ctx, rep, p.Repair); err != nil {
+		return nil, err
+	}
+	if err := checkLegacyFiles(ctx, rep, p.Repair); err != nil {
+		return nil, err
+	}
+	slog.InfoContext(ctx, "Consistency check finished", "repair", p.Repair, "orphan_objects", rep.OrphanObjects,
+		"orphan_files", rep.OrphanFiles, "missing_files", rep.MissingFiles, "orphan_rows", rep.OrphanRows, "deleted", rep.Deleted)
+	return rep, nil
+}
+
+// handleConsistency shows the latest check (GET) or queues a new one (POST {"repair": true})
+func handleConsistency(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		row := db.QueryRowContext(r.Context(), "SELECT "+jobColumns+" FROM jobs WHERE kind = 'consistency_check' ORDER BY id DESC LIMIT 1")
+		j, err := scanJob(row.Scan)
+		if err == sql.ErrNoRows {
+			jsonError(w, http.StatusNotFound, "No consistency check has run yet")
+			return
+		}
+		if err != nil {
+			jsonError(w, http.StatusInternalServerError, "Query failed")
+			return
+		}
+		jsonResponse(w, http.StatusOK, j)
+
+	case http.MethodPost:
+		var p consistencyJobPayload
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+				jsonError(w, http.StatusBadRequest, "Invalid JSON")
+				return
+			}
+		}
+		jobID, err := enqueueJob(r.Context(), db, "consistency_check", p)
+		if err != nil {
+			jsonError(w, http.StatusInternalServerError, "Failed to queue consistency check")
+			return
+		}
+		jsonResponse(w, http.StatusAccepted, map[string]interface{}{
+			"status": "queued",
+			"job_id": jobID,
+		})
+
+	default:
+		jsonError(w, http.StatusMethodNotAllowed, "GET or POST only")
+	}
+}
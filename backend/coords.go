@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+)
+
+// ---------- Relative Coordinates ----------
+
+// ?coords=relative divides every x by the page image width and every y by its height, so
+// consumers working with resized copies of the image can scale coordinates themselves.
+
+// coordsModeFromQuery reports whether relative coordinates were requested
+func coordsModeFromQuery(v string) (bool, error) {
+	switch v {
+	case "", "absolute":
+		return false, nil
+	case "relative":
+		return true, nil
+	}
+	return false, fmt.Errorf("coords must be absolute or relative")
+}
+
+// documentPageSizes returns the image size of every page, reading image headers for documents
+// stored before dimensions were recorded
+func documentPageSizes(ctx context.Context, doc *OutputJSON) (map[int]pageSize, error) {
+	sizes := map[int]pageSize{}
+	for _, p := range doc.Pages {
+		s := pageSize{p.Width, p.Height}
+		if s.Width <= 0 || s.Height <= 0 {
+			sp, err := loadStoredPage(ctx, doc.DocumentID, p.PageNumber)
+			if err == nil {
+				s.Width, s.Height, err = imageDimensions(sp.Path)
+			}
+			if err != nil || s.Width <= 0 || s.Height <= 0 {
+				return nil, fmt.Errorf("image size of page %d is unknown", p.PageNumber)
+			}
+		}
+		sizes[p.PageNumber] = s
+	}
+	return sizes, nil
+}
+
+func roundCoord(v float64) float64 {
+	return math.Round(v*1e6) / 1e6
+}
+
+// relativeXY scales a [x, y, x, y, ...] list in place
+func relativeXY(list []interface{}, s pageSize) {
+	for i, v := range list {
+		f, ok := v.(float64)
+		if !ok {
+			continue
+		}
+		if i%2 == 0 {
+			list[i] = roundCoord(f / float64(s.Width))
+		} else {
+			list[i] = roundCoord(f / float64(s.Height))
+		}
+	}
+}
+
+// relativePoints scales polyline points in place
+func relativePoints(points interface{}, s pageSize) {
+	pts, _ := parsePoints(points)
+	list, _ := points.([]interface{})
+	for _, p := range pts {
+		list[p.Index] = withXY(list[p.Index], roundCoord(p.X/float64(s.Width)), roundCoord(p.Y/float64(s.Height)))
+	}
+}
+
+// relativizeDocument rewrites the coordinates of a document decoded into generic JSON values
+func relativizeDocument(m map[string]interface{}, sizes map[int]pageSize) {
+	sizeOf := func(item map[string]interface{}) pageSize {
+		page := 1
+		if p, ok := item["page"].(float64); ok && p > 0 {
+			page = int(p)
+		}
+		return sizes[page]
+	}
+	each := func(v interface{}, fn func(item map[string]interface{}, s pageSize)) {
+		list, _ := v.([]interface{})
+		for _, it := range list {
+			if item, ok := it.(map[string]interface{}); ok {
+				if s := sizeOf(item); s.Width > 0 && s.Height > 0 {
+					fn(item, s)
+				}
+			}
+		}
+	}
+	scaleKey := func(key string) func(map[string]interface{}, pageSize) {
+		return func(item map[string]interface{}, s pageSize) {
+			if list, ok := item[key].([]interface{}); ok {
+				relativeXY(list, s)
+			}
+		}
+	}
+
+	if graph, ok := m["graph"].(map[string]interface{}); ok {
+		each(graph["components"], scaleKey("bbox"))
+		each(graph["nodes"], scaleKey("position"))
+		each(graph["connections"], func(item map[string]interface{}, s pageSize) {
+			relativePoints(item["points"], s)
+		})
+	}
+	each(m["text_annotations"], scaleKey("bbox"))
+	each(m["regions"], scaleKey("bbox"))
+	m["coords"] = "relative"
+}
+
+// relativizeCOCO converts COCO boxes to fractions of their image size
+func relativizeCOCO(ds *COCODataset) error {
+	sizes := map[int]pageSize{}
+	for _, img := range ds.Images {
+		sizes[img.ID] = pageSize{img.Width, img.Height}
+	}
+	for i := range ds.Annotations {
+		a := &ds.Annotations[i]
+		s := sizes[a.ImageID]
+		if s.Width <= 0 || s.Height <= 0 {
+			return fmt.Errorf("image %d has unknown size", a.ImageID)
+		}
+		w, h := float64(s.Width), float64(s.Height)
+		if len(a.BBox) == 4 {
+			a.BBox = []float64{roundCoord(a.BBox[0] / w), roundCoord(a.BBox[1] / h), roundCoord(a.BBox[2] / w), roundCoord(a.BBox[3] / h)}
+		}
+		a.Area = roundCoord(a.Area / (w * h))
+	}
+	return nil
+}
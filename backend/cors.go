@@ -0,0 +1,113 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ---------- CORS ----------
+
+// Cross-origin access is limited to CORS_ALLOWED_ORIGINS (comma-separated; the default is the
+// Vite dev server). "*" allows any origin, but never with credentials, which browsers refuse.
+// Methods and headers can be overridden the same way; the defaults cover everything the
+// handlers use, including the tus and checksum headers.
+var (
+	corsAllowedOrigins = parseCSV(envString("CORS_ALLOWED_ORIGINS", "http://localhost:5173"))
+	corsAllowedMethods = envString("CORS_ALLOWED_METHODS", "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS")
+	corsAllowedHeaders = envString("CORS_ALLOWED_HEADERS", "Content-Type, Authorization, Range, If-None-Match, X-Content-SHA256, X-Request-ID, X-API-Key, "+
+		"Tus-Resumable, Upload-Length, Upload-Metadata, Upload-Offset")
+	corsExposedHeaders = envString("CORS_EXPOSED_HEADERS", "ETag, Content-Range, Accept-Ranges, X-Crop-Rect, X-Request-ID, Retry-After, Warning, Age, API-Version, Deprecation, Link, "+
+		"Location, Tus-Resumable, Tus-Version, Tus-Extension, Tus-Max-Size, Upload-Offset, Upload-Length, Upload-Expires, Upload-Document-Id")
+	corsAllowCredentials = envBool("CORS_ALLOW_CREDENTIALS", false)
+	// How long browsers may cache a preflight answer
+	corsMaxAge = envDuration("CORS_MAX_AGE", 10*time.Minute)
+)
+
+// parseCSV splits a comma-separated setting, dropping blanks
+func parseCSV(v string) []string {
+	var out []string
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// corsOrigins matches request origins against the allowlist. Origins are compared without
+// case or a trailing slash, the way browsers serialize them.
+type corsOrigins struct {
+	any     bool
+	allowed map[string]bool
+}
+
+func newCORSOrigins(list []string) corsOrigins {
+	o := corsOrigins{allowed: map[string]bool{}}
+	for _, origin := range list {
+		if origin == "*" {
+			o.any = true
+			continue
+		}
+		o.allowed[strings.ToLower(strings.TrimSuffix(origin, "/"))] = true
+	}
+	return o
+}
+
+func (o corsOrigins) allows(origin string) bool {
+	return o.any || o.allowed[strings.ToLower(origin)]
+}
+
+func corsMiddleware(next http.Handler) http.Handler {
+	origins := newCORSOrigins(corsAllowedOrigins)
+	credentials := corsAllowCredentials
+	if credentials && origins.any {
+		slog.Warn("CORS_ALLOW_CREDENTIALS is ignored while CORS_ALLOWED_ORIGINS contains *")
+		credentials = false
+	}
+	maxAge := strconv.Itoa(int(corsMaxAge.Seconds()))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+		// The answer depends on Origin (and, for preflights, on what is being asked), so caches
+		// must not hand one origin's response to another
+		h.Add("Vary", "Origin")
+		if preflight {
+			h.Add("Vary", "Access-Control-Request-Method")
+			h.Add("Vary", "Access-Control-Request-Headers")
+		}
+
+		if origin != "" && origins.allows(origin) {
+			if origins.any && !credentials {
+				h.Set("Access-Control-Allow-Origin", "*")
+			} else {
+				h.Set("Access-Control-Allow-Origin", origin)
+			}
+			if credentials {
+				h.Set("Access-Control-Allow-Credentials", "true")
+			}
+			if preflight {
+				h.Set("Access-Control-Allow-Methods", corsAllowedMethods)
+				h.Set("Access-Control-Allow-Headers", corsAllowedHeaders)
+				h.Set("Access-Control-Max-Age", maxAge)
+			} else {
+				h.Set("Access-Control-Expose-Headers", corsExposedHeaders)
+			}
+		}
+
+		// tus clients use OPTIONS for capability discovery, so those requests reach the handler.
+		// A preflight from an origin that isn't allowed gets no CORS headers and the browser
+		// blocks the real request.
+		if r.Method == http.MethodOptions && !strings.HasPrefix(r.URL.Path, "/uploads/tus") {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
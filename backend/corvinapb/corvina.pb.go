@@ -0,0 +1,1421 @@
+// Typed read API over documents and their annotations, served over gRPC next to the JSON
+// handlers and, through grpc-gateway, as JSON under /v1/ (see gateway.yaml).
+//
+// Regenerate corvinapb/ after editing, from backend/:
+//   protoc -I proto --go_out=. --go_opt=module=corvina-backend \
+//     --go-grpc_out=. --go-grpc_opt=module=corvina-backend \
+//     --grpc-gateway_out=. --grpc-gateway_opt=module=corvina-backend \
+//     --grpc-gateway_opt=grpc_api_configuration=proto/corvina/v1/gateway.yaml \
+//     corvina/v1/corvina.proto
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        (unknown)
+// source: corvina/v1/corvina.proto
+
+package corvinapb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	structpb "google.golang.org/protobuf/types/known/structpb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type GetDocumentRequest struct {
+	state      protoimpl.MessageState `protogen:"open.v1"`
+	DocumentId string                 `protobuf:"bytes,1,opt,name=document_id,json=documentId,proto3" json:"document_id,omitempty"`
+	// Sections to load: regions, graph, text_annotations. Empty loads all.
+	Include       []string `protobuf:"bytes,2,rep,name=include,proto3" json:"include,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetDocumentRequest) Reset() {
+	*x = GetDocumentRequest{}
+	mi := &file_corvina_v1_corvina_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetDocumentRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetDocumentRequest) ProtoMessage() {}
+
+func (x *GetDocumentRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_corvina_v1_corvina_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetDocumentRequest.ProtoReflect.Descriptor instead.
+func (*GetDocumentRequest) Descriptor() ([]byte, []int) {
+	return file_corvina_v1_corvina_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *GetDocumentRequest) GetDocumentId() string {
+	if x != nil {
+		return x.DocumentId
+	}
+	return ""
+}
+
+func (x *GetDocumentRequest) GetInclude() []string {
+	if x != nil {
+		return x.Include
+	}
+	return nil
+}
+
+type ListDocumentsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Project       string                 `protobuf:"bytes,1,opt,name=project,proto3" json:"project,omitempty"`
+	Split         string                 `protobuf:"bytes,2,opt,name=split,proto3" json:"split,omitempty"` // train | val | test
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListDocumentsRequest) Reset() {
+	*x = ListDocumentsRequest{}
+	mi := &file_corvina_v1_corvina_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListDocumentsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListDocumentsRequest) ProtoMessage() {}
+
+func (x *ListDocumentsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_corvina_v1_corvina_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListDocumentsRequest.ProtoReflect.Descriptor instead.
+func (*ListDocumentsRequest) Descriptor() ([]byte, []int) {
+	return file_corvina_v1_corvina_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *ListDocumentsRequest) GetProject() string {
+	if x != nil {
+		return x.Project
+	}
+	return ""
+}
+
+func (x *ListDocumentsRequest) GetSplit() string {
+	if x != nil {
+		return x.Split
+	}
+	return ""
+}
+
+type ListDocumentsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Documents     []*DocumentSummary     `protobuf:"bytes,1,rep,name=documents,proto3" json:"documents,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListDocumentsResponse) Reset() {
+	*x = ListDocumentsResponse{}
+	mi := &file_corvina_v1_corvina_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListDocumentsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListDocumentsResponse) ProtoMessage() {}
+
+func (x *ListDocumentsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_corvina_v1_corvina_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListDocumentsResponse.ProtoReflect.Descriptor instead.
+func (*ListDocumentsResponse) Descriptor() ([]byte, []int) {
+	return file_corvina_v1_corvina_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ListDocumentsResponse) GetDocuments() []*DocumentSummary {
+	if x != nil {
+		return x.Documents
+	}
+	return nil
+}
+
+type StreamDocumentsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Project       string                 `protobuf:"bytes,1,opt,name=project,proto3" json:"project,omitempty"`
+	Split         string                 `protobuf:"bytes,2,opt,name=split,proto3" json:"split,omitempty"`
+	Include       []string               `protobuf:"bytes,3,rep,name=include,proto3" json:"include,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StreamDocumentsRequest) Reset() {
+	*x = StreamDocumentsRequest{}
+	mi := &file_corvina_v1_corvina_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StreamDocumentsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamDocumentsRequest) ProtoMessage() {}
+
+func (x *StreamDocumentsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_corvina_v1_corvina_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamDocumentsRequest.ProtoReflect.Descriptor instead.
+func (*StreamDocumentsRequest) Descriptor() ([]byte, []int) {
+	return file_corvina_v1_corvina_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *StreamDocumentsRequest) GetProject() string {
+	if x != nil {
+		return x.Project
+	}
+	return ""
+}
+
+func (x *StreamDocumentsRequest) GetSplit() string {
+	if x != nil {
+		return x.Split
+	}
+	return ""
+}
+
+func (x *StreamDocumentsRequest) GetInclude() []string {
+	if x != nil {
+		return x.Include
+	}
+	return nil
+}
+
+type DocumentSummary struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	DocumentId    string                 `protobuf:"bytes,1,opt,name=document_id,json=documentId,proto3" json:"document_id,omitempty"`
+	ImageFile     string                 `protobuf:"bytes,2,opt,name=image_file,json=imageFile,proto3" json:"image_file,omitempty"`
+	DrawingType   string                 `protobuf:"bytes,3,opt,name=drawing_type,json=drawingType,proto3" json:"drawing_type,omitempty"`
+	Source        string                 `protobuf:"bytes,4,opt,name=source,proto3" json:"source,omitempty"`
+	Project       string                 `protobuf:"bytes,5,opt,name=project,proto3" json:"project,omitempty"`
+	Tags          []string               `protobuf:"bytes,6,rep,name=tags,proto3" json:"tags,omitempty"`
+	CreatedAt     string                 `protobuf:"bytes,7,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"` // RFC 3339
+	Split         string                 `protobuf:"bytes,8,opt,name=split,proto3" json:"split,omitempty"`
+	ThumbnailUrl  string                 `protobuf:"bytes,9,opt,name=thumbnail_url,json=thumbnailUrl,proto3" json:"thumbnail_url,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DocumentSummary) Reset() {
+	*x = DocumentSummary{}
+	mi := &file_corvina_v1_corvina_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DocumentSummary) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DocumentSummary) ProtoMessage() {}
+
+func (x *DocumentSummary) ProtoReflect() protoreflect.Message {
+	mi := &file_corvina_v1_corvina_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DocumentSummary.ProtoReflect.Descriptor instead.
+func (*DocumentSummary) Descriptor() ([]byte, []int) {
+	return file_corvina_v1_corvina_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *DocumentSummary) GetDocumentId() string {
+	if x != nil {
+		return x.DocumentId
+	}
+	return ""
+}
+
+func (x *DocumentSummary) GetImageFile() string {
+	if x != nil {
+		return x.ImageFile
+	}
+	return ""
+}
+
+func (x *DocumentSummary) GetDrawingType() string {
+	if x != nil {
+		return x.DrawingType
+	}
+	return ""
+}
+
+func (x *DocumentSummary) GetSource() string {
+	if x != nil {
+		return x.Source
+	}
+	return ""
+}
+
+func (x *DocumentSummary) GetProject() string {
+	if x != nil {
+		return x.Project
+	}
+	return ""
+}
+
+func (x *DocumentSummary) GetTags() []string {
+	if x != nil {
+		return x.Tags
+	}
+	return nil
+}
+
+func (x *DocumentSummary) GetCreatedAt() string {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return ""
+}
+
+func (x *DocumentSummary) GetSplit() string {
+	if x != nil {
+		return x.Split
+	}
+	return ""
+}
+
+func (x *DocumentSummary) GetThumbnailUrl() string {
+	if x != nil {
+		return x.ThumbnailUrl
+	}
+	return ""
+}
+
+type Document struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	DocumentId      string                 `protobuf:"bytes,1,opt,name=document_id,json=documentId,proto3" json:"document_id,omitempty"`
+	ImageFile       string                 `protobuf:"bytes,2,opt,name=image_file,json=imageFile,proto3" json:"image_file,omitempty"`
+	Width           int32                  `protobuf:"varint,3,opt,name=width,proto3" json:"width,omitempty"`
+	Height          int32                  `protobuf:"varint,4,opt,name=height,proto3" json:"height,omitempty"`
+	Sha256          string                 `protobuf:"bytes,5,opt,name=sha256,proto3" json:"sha256,omitempty"`
+	SizeBytes       int64                  `protobuf:"varint,6,opt,name=size_bytes,json=sizeBytes,proto3" json:"size_bytes,omitempty"`
+	NumPages        int32                  `protobuf:"varint,7,opt,name=num_pages,json=numPages,proto3" json:"num_pages,omitempty"`
+	Pages           []*Page                `protobuf:"bytes,8,rep,name=pages,proto3" json:"pages,omitempty"`
+	Classification  map[string]string      `protobuf:"bytes,9,rep,name=classification,proto3" json:"classification,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"` // type, domain
+	Tags            []string               `protobuf:"bytes,10,rep,name=tags,proto3" json:"tags,omitempty"`
+	Notes           string                 `protobuf:"bytes,11,opt,name=notes,proto3" json:"notes,omitempty"`
+	Regions         []*Region              `protobuf:"bytes,12,rep,name=regions,proto3" json:"regions,omitempty"`
+	Graph           *Graph                 `protobuf:"bytes,13,opt,name=graph,proto3" json:"graph,omitempty"`
+	TextAnnotations []*TextAnnotation      `protobuf:"bytes,14,rep,name=text_annotations,json=textAnnotations,proto3" json:"text_annotations,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *Document) Reset() {
+	*x = Document{}
+	mi := &file_corvina_v1_corvina_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Document) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Document) ProtoMessage() {}
+
+func (x *Document) ProtoReflect() protoreflect.Message {
+	mi := &file_corvina_v1_corvina_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Document.ProtoReflect.Descriptor instead.
+func (*Document) Descriptor() ([]byte, []int) {
+	return file_corvina_v1_corvina_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Document) GetDocumentId() string {
+	if x != nil {
+		return x.DocumentId
+	}
+	return ""
+}
+
+func (x *Document) GetImageFile() string {
+	if x != nil {
+		return x.ImageFile
+	}
+	return ""
+}
+
+func (x *Document) GetWidth() int32 {
+	if x != nil {
+		return x.Width
+	}
+	return 0
+}
+
+func (x *Document) GetHeight() int32 {
+	if x != nil {
+		return x.Height
+	}
+	return 0
+}
+
+func (x *Document) GetSha256() string {
+	if x != nil {
+		return x.Sha256
+	}
+	return ""
+}
+
+func (x *Document) GetSizeBytes() int64 {
+	if x != nil {
+		return x.SizeBytes
+	}
+	return 0
+}
+
+func (x *Document) GetNumPages() int32 {
+	if x != nil {
+		return x.NumPages
+	}
+	return 0
+}
+
+func (x *Document) GetPages() []*Page {
+	if x != nil {
+		return x.Pages
+	}
+	return nil
+}
+
+func (x *Document) GetClassification() map[string]string {
+	if x != nil {
+		return x.Classification
+	}
+	return nil
+}
+
+func (x *Document) GetTags() []string {
+	if x != nil {
+		return x.Tags
+	}
+	return nil
+}
+
+func (x *Document) GetNotes() string {
+	if x != nil {
+		return x.Notes
+	}
+	return ""
+}
+
+func (x *Document) GetRegions() []*Region {
+	if x != nil {
+		return x.Regions
+	}
+	return nil
+}
+
+func (x *Document) GetGraph() *Graph {
+	if x != nil {
+		return x.Graph
+	}
+	return nil
+}
+
+func (x *Document) GetTextAnnotations() []*TextAnnotation {
+	if x != nil {
+		return x.TextAnnotations
+	}
+	return nil
+}
+
+type Page struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	PageNumber    int32                  `protobuf:"varint,1,opt,name=page_number,json=pageNumber,proto3" json:"page_number,omitempty"`
+	ImageFile     string                 `protobuf:"bytes,2,opt,name=image_file,json=imageFile,proto3" json:"image_file,omitempty"`
+	Width         int32                  `protobuf:"varint,3,opt,name=width,proto3" json:"width,omitempty"`
+	Height        int32                  `protobuf:"varint,4,opt,name=height,proto3" json:"height,omitempty"`
+	Sha256        string                 `protobuf:"bytes,5,opt,name=sha256,proto3" json:"sha256,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Page) Reset() {
+	*x = Page{}
+	mi := &file_corvina_v1_corvina_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Page) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Page) ProtoMessage() {}
+
+func (x *Page) ProtoReflect() protoreflect.Message {
+	mi := &file_corvina_v1_corvina_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Page.ProtoReflect.Descriptor instead.
+func (*Page) Descriptor() ([]byte, []int) {
+	return file_corvina_v1_corvina_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *Page) GetPageNumber() int32 {
+	if x != nil {
+		return x.PageNumber
+	}
+	return 0
+}
+
+func (x *Page) GetImageFile() string {
+	if x != nil {
+		return x.ImageFile
+	}
+	return ""
+}
+
+func (x *Page) GetWidth() int32 {
+	if x != nil {
+		return x.Width
+	}
+	return 0
+}
+
+func (x *Page) GetHeight() int32 {
+	if x != nil {
+		return x.Height
+	}
+	return 0
+}
+
+func (x *Page) GetSha256() string {
+	if x != nil {
+		return x.Sha256
+	}
+	return ""
+}
+
+// Origin records where an annotation came from
+type Origin struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Provenance    string                 `protobuf:"bytes,1,opt,name=provenance,proto3" json:"provenance,omitempty"` // human | model | ocr | import | auto
+	SuggestionId  string                 `protobuf:"bytes,2,opt,name=suggestion_id,json=suggestionId,proto3" json:"suggestion_id,omitempty"`
+	ModelName     string                 `protobuf:"bytes,3,opt,name=model_name,json=modelName,proto3" json:"model_name,omitempty"`
+	ModelVersion  string                 `protobuf:"bytes,4,opt,name=model_version,json=modelVersion,proto3" json:"model_version,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Origin) Reset() {
+	*x = Origin{}
+	mi := &file_corvina_v1_corvina_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Origin) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Origin) ProtoMessage() {}
+
+func (x *Origin) ProtoReflect() protoreflect.Message {
+	mi := &file_corvina_v1_corvina_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Origin.ProtoReflect.Descriptor instead.
+func (*Origin) Descriptor() ([]byte, []int) {
+	return file_corvina_v1_corvina_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *Origin) GetProvenance() string {
+	if x != nil {
+		return x.Provenance
+	}
+	return ""
+}
+
+func (x *Origin) GetSuggestionId() string {
+	if x != nil {
+		return x.SuggestionId
+	}
+	return ""
+}
+
+func (x *Origin) GetModelName() string {
+	if x != nil {
+		return x.ModelName
+	}
+	return ""
+}
+
+func (x *Origin) GetModelVersion() string {
+	if x != nil {
+		return x.ModelVersion
+	}
+	return ""
+}
+
+type Region struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Label         string                 `protobuf:"bytes,2,opt,name=label,proto3" json:"label,omitempty"`
+	Bbox          []int32                `protobuf:"varint,3,rep,packed,name=bbox,proto3" json:"bbox,omitempty"`
+	Page          int32                  `protobuf:"varint,4,opt,name=page,proto3" json:"page,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Region) Reset() {
+	*x = Region{}
+	mi := &file_corvina_v1_corvina_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Region) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Region) ProtoMessage() {}
+
+func (x *Region) ProtoReflect() protoreflect.Message {
+	mi := &file_corvina_v1_corvina_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Region.ProtoReflect.Descriptor instead.
+func (*Region) Descriptor() ([]byte, []int) {
+	return file_corvina_v1_corvina_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *Region) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Region) GetLabel() string {
+	if x != nil {
+		return x.Label
+	}
+	return ""
+}
+
+func (x *Region) GetBbox() []int32 {
+	if x != nil {
+		return x.Bbox
+	}
+	return nil
+}
+
+func (x *Region) GetPage() int32 {
+	if x != nil {
+		return x.Page
+	}
+	return 0
+}
+
+type Graph struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Components    []*Component           `protobuf:"bytes,1,rep,name=components,proto3" json:"components,omitempty"`
+	Nodes         []*Node                `protobuf:"bytes,2,rep,name=nodes,proto3" json:"nodes,omitempty"`
+	Connections   []*Connection          `protobuf:"bytes,3,rep,name=connections,proto3" json:"connections,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Graph) Reset() {
+	*x = Graph{}
+	mi := &file_corvina_v1_corvina_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Graph) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Graph) ProtoMessage() {}
+
+func (x *Graph) ProtoReflect() protoreflect.Message {
+	mi := &file_corvina_v1_corvina_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Graph.ProtoReflect.Descriptor instead.
+func (*Graph) Descriptor() ([]byte, []int) {
+	return file_corvina_v1_corvina_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *Graph) GetComponents() []*Component {
+	if x != nil {
+		return x.Components
+	}
+	return nil
+}
+
+func (x *Graph) GetNodes() []*Node {
+	if x != nil {
+		return x.Nodes
+	}
+	return nil
+}
+
+func (x *Graph) GetConnections() []*Connection {
+	if x != nil {
+		return x.Connections
+	}
+	return nil
+}
+
+type Component struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Label         string                 `protobuf:"bytes,2,opt,name=label,proto3" json:"label,omitempty"`
+	Bbox          []int32                `protobuf:"varint,3,rep,packed,name=bbox,proto3" json:"bbox,omitempty"`
+	Page          int32                  `protobuf:"varint,4,opt,name=page,proto3" json:"page,omitempty"`
+	RegionId      string                 `protobuf:"bytes,5,opt,name=region_id,json=regionId,proto3" json:"region_id,omitempty"`
+	Origin        *Origin                `protobuf:"bytes,6,opt,name=origin,proto3" json:"origin,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Component) Reset() {
+	*x = Component{}
+	mi := &file_corvina_v1_corvina_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Component) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Component) ProtoMessage() {}
+
+func (x *Component) ProtoReflect() protoreflect.Message {
+	mi := &file_corvina_v1_corvina_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Component.ProtoReflect.Descriptor instead.
+func (*Component) Descriptor() ([]byte, []int) {
+	return file_corvina_v1_corvina_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *Component) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Component) GetLabel() string {
+	if x != nil {
+		return x.Label
+	}
+	return ""
+}
+
+func (x *Component) GetBbox() []int32 {
+	if x != nil {
+		return x.Bbox
+	}
+	return nil
+}
+
+func (x *Component) GetPage() int32 {
+	if x != nil {
+		return x.Page
+	}
+	return 0
+}
+
+func (x *Component) GetRegionId() string {
+	if x != nil {
+		return x.RegionId
+	}
+	return ""
+}
+
+func (x *Component) GetOrigin() *Origin {
+	if x != nil {
+		return x.Origin
+	}
+	return nil
+}
+
+type Node struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Position      []int32                `protobuf:"varint,2,rep,packed,name=position,proto3" json:"position,omitempty"`
+	Page          int32                  `protobuf:"varint,3,opt,name=page,proto3" json:"page,omitempty"`
+	RegionId      string                 `protobuf:"bytes,4,opt,name=region_id,json=regionId,proto3" json:"region_id,omitempty"`
+	Origin        *Origin                `protobuf:"bytes,5,opt,name=origin,proto3" json:"origin,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Node) Reset() {
+	*x = Node{}
+	mi := &file_corvina_v1_corvina_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Node) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Node) ProtoMessage() {}
+
+func (x *Node) ProtoReflect() protoreflect.Message {
+	mi := &file_corvina_v1_corvina_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Node.ProtoReflect.Descriptor instead.
+func (*Node) Descriptor() ([]byte, []int) {
+	return file_corvina_v1_corvina_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *Node) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Node) GetPosition() []int32 {
+	if x != nil {
+		return x.Position
+	}
+	return nil
+}
+
+func (x *Node) GetPage() int32 {
+	if x != nil {
+		return x.Page
+	}
+	return 0
+}
+
+func (x *Node) GetRegionId() string {
+	if x != nil {
+		return x.RegionId
+	}
+	return ""
+}
+
+func (x *Node) GetOrigin() *Origin {
+	if x != nil {
+		return x.Origin
+	}
+	return nil
+}
+
+type Connection struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	SourceId      string                 `protobuf:"bytes,2,opt,name=source_id,json=sourceId,proto3" json:"source_id,omitempty"`
+	TargetId      string                 `protobuf:"bytes,3,opt,name=target_id,json=targetId,proto3" json:"target_id,omitempty"`
+	Type          string                 `protobuf:"bytes,4,opt,name=type,proto3" json:"type,omitempty"`     // "line" for drawn polylines
+	Points        *structpb.Value        `protobuf:"bytes,5,opt,name=points,proto3" json:"points,omitempty"` // polyline as stored, e.g. [[x, y], ...]
+	Page          int32                  `protobuf:"varint,6,opt,name=page,proto3" json:"page,omitempty"`
+	RegionId      string                 `protobuf:"bytes,7,opt,name=region_id,json=regionId,proto3" json:"region_id,omitempty"`
+	Origin        *Origin                `protobuf:"bytes,8,opt,name=origin,proto3" json:"origin,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Connection) Reset() {
+	*x = Connection{}
+	mi := &file_corvina_v1_corvina_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Connection) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Connection) ProtoMessage() {}
+
+func (x *Connection) ProtoReflect() protoreflect.Message {
+	mi := &file_corvina_v1_corvina_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Connection.ProtoReflect.Descriptor instead.
+func (*Connection) Descriptor() ([]byte, []int) {
+	return file_corvina_v1_corvina_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *Connection) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Connection) GetSourceId() string {
+	if x != nil {
+		return x.SourceId
+	}
+	return ""
+}
+
+func (x *Connection) GetTargetId() string {
+	if x != nil {
+		return x.TargetId
+	}
+	return ""
+}
+
+func (x *Connection) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *Connection) GetPoints() *structpb.Value {
+	if x != nil {
+		return x.Points
+	}
+	return nil
+}
+
+func (x *Connection) GetPage() int32 {
+	if x != nil {
+		return x.Page
+	}
+	return 0
+}
+
+func (x *Connection) GetRegionId() string {
+	if x != nil {
+		return x.RegionId
+	}
+	return ""
+}
+
+func (x *Connection) GetOrigin() *Origin {
+	if x != nil {
+		return x.Origin
+	}
+	return nil
+}
+
+type Value struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Value         string                 `protobuf:"bytes,1,opt,name=value,proto3" json:"value,omitempty"`
+	UnitPrefix    string                 `protobuf:"bytes,2,opt,name=unit_prefix,json=unitPrefix,proto3" json:"unit_prefix,omitempty"`
+	UnitSuffix    string                 `protobuf:"bytes,3,opt,name=unit_suffix,json=unitSuffix,proto3" json:"unit_suffix,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Value) Reset() {
+	*x = Value{}
+	mi := &file_corvina_v1_corvina_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Value) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Value) ProtoMessage() {}
+
+func (x *Value) ProtoReflect() protoreflect.Message {
+	mi := &file_corvina_v1_corvina_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Value.ProtoReflect.Descriptor instead.
+func (*Value) Descriptor() ([]byte, []int) {
+	return file_corvina_v1_corvina_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *Value) GetValue() string {
+	if x != nil {
+		return x.Value
+	}
+	return ""
+}
+
+func (x *Value) GetUnitPrefix() string {
+	if x != nil {
+		return x.UnitPrefix
+	}
+	return ""
+}
+
+func (x *Value) GetUnitSuffix() string {
+	if x != nil {
+		return x.UnitSuffix
+	}
+	return ""
+}
+
+type TextAnnotation struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Bbox          []int32                `protobuf:"varint,2,rep,packed,name=bbox,proto3" json:"bbox,omitempty"`
+	RawText       string                 `protobuf:"bytes,3,opt,name=raw_text,json=rawText,proto3" json:"raw_text,omitempty"`
+	IsIgnored     bool                   `protobuf:"varint,4,opt,name=is_ignored,json=isIgnored,proto3" json:"is_ignored,omitempty"`
+	LinkedTo      string                 `protobuf:"bytes,5,opt,name=linked_to,json=linkedTo,proto3" json:"linked_to,omitempty"`
+	LabelName     string                 `protobuf:"bytes,6,opt,name=label_name,json=labelName,proto3" json:"label_name,omitempty"`
+	Values        []*Value               `protobuf:"bytes,7,rep,name=values,proto3" json:"values,omitempty"`
+	Page          int32                  `protobuf:"varint,8,opt,name=page,proto3" json:"page,omitempty"`
+	RegionId      string                 `protobuf:"bytes,9,opt,name=region_id,json=regionId,proto3" json:"region_id,omitempty"`
+	Origin        *Origin                `protobuf:"bytes,10,opt,name=origin,proto3" json:"origin,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TextAnnotation) Reset() {
+	*x = TextAnnotation{}
+	mi := &file_corvina_v1_corvina_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TextAnnotation) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TextAnnotation) ProtoMessage() {}
+
+func (x *TextAnnotation) ProtoReflect() protoreflect.Message {
+	mi := &file_corvina_v1_corvina_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TextAnnotation.ProtoReflect.Descriptor instead.
+func (*TextAnnotation) Descriptor() ([]byte, []int) {
+	return file_corvina_v1_corvina_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *TextAnnotation) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *TextAnnotation) GetBbox() []int32 {
+	if x != nil {
+		return x.Bbox
+	}
+	return nil
+}
+
+func (x *TextAnnotation) GetRawText() string {
+	if x != nil {
+		return x.RawText
+	}
+	return ""
+}
+
+func (x *TextAnnotation) GetIsIgnored() bool {
+	if x != nil {
+		return x.IsIgnored
+	}
+	return false
+}
+
+func (x *TextAnnotation) GetLinkedTo() string {
+	if x != nil {
+		return x.LinkedTo
+	}
+	return ""
+}
+
+func (x *TextAnnotation) GetLabelName() string {
+	if x != nil {
+		return x.LabelName
+	}
+	return ""
+}
+
+func (x *TextAnnotation) GetValues() []*Value {
+	if x != nil {
+		return x.Values
+	}
+	return nil
+}
+
+func (x *TextAnnotation) GetPage() int32 {
+	if x != nil {
+		return x.Page
+	}
+	return 0
+}
+
+func (x *TextAnnotation) GetRegionId() string {
+	if x != nil {
+		return x.RegionId
+	}
+	return ""
+}
+
+func (x *TextAnnotation) GetOrigin() *Origin {
+	if x != nil {
+		return x.Origin
+	}
+	return nil
+}
+
+var File_corvina_v1_corvina_proto protoreflect.FileDescriptor
+
+const file_corvina_v1_corvina_proto_rawDesc = "" +
+	"\n" +
+	"\x18corvina/v1/corvina.proto\x12\n" +
+	"corvina.v1\x1a\x1cgoogle/protobuf/struct.proto\"O\n" +
+	"\x12GetDocumentRequest\x12\x1f\n" +
+	"\vdocument_id\x18\x01 \x01(\tR\n" +
+	"documentId\x12\x18\n" +
+	"\ainclude\x18\x02 \x03(\tR\ainclude\"F\n" +
+	"\x14ListDocumentsRequest\x12\x18\n" +
+	"\aproject\x18\x01 \x01(\tR\aproject\x12\x14\n" +
+	"\x05split\x18\x02 \x01(\tR\x05split\"R\n" +
+	"\x15ListDocumentsResponse\x129\n" +
+	"\tdocuments\x18\x01 \x03(\v2\x1b.corvina.v1.DocumentSummaryR\tdocuments\"b\n" +
+	"\x16StreamDocumentsRequest\x12\x18\n" +
+	"\aproject\x18\x01 \x01(\tR\aproject\x12\x14\n" +
+	"\x05split\x18\x02 \x01(\tR\x05split\x12\x18\n" +
+	"\ainclude\x18\x03 \x03(\tR\ainclude\"\x94\x02\n" +
+	"\x0fDocumentSummary\x12\x1f\n" +
+	"\vdocument_id\x18\x01 \x01(\tR\n" +
+	"documentId\x12\x1d\n" +
+	"\n" +
+	"image_file\x18\x02 \x01(\tR\timageFile\x12!\n" +
+	"\fdrawing_type\x18\x03 \x01(\tR\vdrawingType\x12\x16\n" +
+	"\x06source\x18\x04 \x01(\tR\x06source\x12\x18\n" +
+	"\aproject\x18\x05 \x01(\tR\aproject\x12\x12\n" +
+	"\x04tags\x18\x06 \x03(\tR\x04tags\x12\x1d\n" +
+	"\n" +
+	"created_at\x18\a \x01(\tR\tcreatedAt\x12\x14\n" +
+	"\x05split\x18\b \x01(\tR\x05split\x12#\n" +
+	"\rthumbnail_url\x18\t \x01(\tR\fthumbnailUrl\"\xd1\x04\n" +
+	"\bDocument\x12\x1f\n" +
+	"\vdocument_id\x18\x01 \x01(\tR\n" +
+	"documentId\x12\x1d\n" +
+	"\n" +
+	"image_file\x18\x02 \x01(\tR\timageFile\x12\x14\n" +
+	"\x05width\x18\x03 \x01(\x05R\x05width\x12\x16\n" +
+	"\x06height\x18\x04 \x01(\x05R\x06height\x12\x16\n" +
+	"\x06sha256\x18\x05 \x01(\tR\x06sha256\x12\x1d\n" +
+	"\n" +
+	"size_bytes\x18\x06 \x01(\x03R\tsizeBytes\x12\x1b\n" +
+	"\tnum_pages\x18\a \x01(\x05R\bnumPages\x12&\n" +
+	"\x05pages\x18\b \x03(\v2\x10.corvina.v1.PageR\x05pages\x12P\n" +
+	"\x0eclassification\x18\t \x03(\v2(.corvina.v1.Document.ClassificationEntryR\x0eclassification\x12\x12\n" +
+	"\x04tags\x18\n" +
+	" \x03(\tR\x04tags\x12\x14\n" +
+	"\x05notes\x18\v \x01(\tR\x05notes\x12,\n" +
+	"\aregions\x18\f \x03(\v2\x12.corvina.v1.RegionR\aregions\x12'\n" +
+	"\x05graph\x18\r \x01(\v2\x11.corvina.v1.GraphR\x05graph\x12E\n" +
+	"\x10text_annotations\x18\x0e \x03(\v2\x1a.corvina.v1.TextAnnotationR\x0ftextAnnotations\x1aA\n" +
+	"\x13ClassificationEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\x8c\x01\n" +
+	"\x04Page\x12\x1f\n" +
+	"\vpage_number\x18\x01 \x01(\x05R\n" +
+	"pageNumber\x12\x1d\n" +
+	"\n" +
+	"image_file\x18\x02 \x01(\tR\timageFile\x12\x14\n" +
+	"\x05width\x18\x03 \x01(\x05R\x05width\x12\x16\n" +
+	"\x06height\x18\x04 \x01(\x05R\x06height\x12\x16\n" +
+	"\x06sha256\x18\x05 \x01(\tR\x06sha256\"\x91\x01\n" +
+	"\x06Origin\x12\x1e\n" +
+	"\n" +
+	"provenance\x18\x01 \x01(\tR\n" +
+	"provenance\x12#\n" +
+	"\rsuggestion_id\x18\x02 \x01(\tR\fsuggestionId\x12\x1d\n" +
+	"\n" +
+	"model_name\x18\x03 \x01(\tR\tmodelName\x12#\n" +
+	"\rmodel_version\x18\x04 \x01(\tR\fmodelVersion\"V\n" +
+	"\x06Region\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x14\n" +
+	"\x05label\x18\x02 \x01(\tR\x05label\x12\x12\n" +
+	"\x04bbox\x18\x03 \x03(\x05R\x04bbox\x12\x12\n" +
+	"\x04page\x18\x04 \x01(\x05R\x04page\"\xa0\x01\n" +
+	"\x05Graph\x125\n" +
+	"\n" +
+	"components\x18\x01 \x03(\v2\x15.corvina.v1.ComponentR\n" +
+	"components\x12&\n" +
+	"\x05nodes\x18\x02 \x03(\v2\x10.corvina.v1.NodeR\x05nodes\x128\n" +
+	"\vconnections\x18\x03 \x03(\v2\x16.corvina.v1.ConnectionR\vconnections\"\xa2\x01\n" +
+	"\tComponent\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x14\n" +
+	"\x05label\x18\x02 \x01(\tR\x05label\x12\x12\n" +
+	"\x04bbox\x18\x03 \x03(\x05R\x04bbox\x12\x12\n" +
+	"\x04page\x18\x04 \x01(\x05R\x04page\x12\x1b\n" +
+	"\tregion_id\x18\x05 \x01(\tR\bregionId\x12*\n" +
+	"\x06origin\x18\x06 \x01(\v2\x12.corvina.v1.OriginR\x06origin\"\x8f\x01\n" +
+	"\x04Node\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x1a\n" +
+	"\bposition\x18\x02 \x03(\x05R\bposition\x12\x12\n" +
+	"\x04page\x18\x03 \x01(\x05R\x04page\x12\x1b\n" +
+	"\tregion_id\x18\x04 \x01(\tR\bregionId\x12*\n" +
+	"\x06origin\x18\x05 \x01(\v2\x12.corvina.v1.OriginR\x06origin\"\xf7\x01\n" +
+	"\n" +
+	"Connection\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x1b\n" +
+	"\tsource_id\x18\x02 \x01(\tR\bsourceId\x12\x1b\n" +
+	"\ttarget_id\x18\x03 \x01(\tR\btargetId\x12\x12\n" +
+	"\x04type\x18\x04 \x01(\tR\x04type\x12.\n" +
+	"\x06points\x18\x05 \x01(\v2\x16.google.protobuf.ValueR\x06points\x12\x12\n" +
+	"\x04page\x18\x06 \x01(\x05R\x04page\x12\x1b\n" +
+	"\tregion_id\x18\a \x01(\tR\bregionId\x12*\n" +
+	"\x06origin\x18\b \x01(\v2\x12.corvina.v1.OriginR\x06origin\"_\n" +
+	"\x05Value\x12\x14\n" +
+	"\x05value\x18\x01 \x01(\tR\x05value\x12\x1f\n" +
+	"\vunit_prefix\x18\x02 \x01(\tR\n" +
+	"unitPrefix\x12\x1f\n" +
+	"\vunit_suffix\x18\x03 \x01(\tR\n" +
+	"unitSuffix\"\xb2\x02\n" +
+	"\x0eTextAnnotation\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
+	"\x04bbox\x18\x02 \x03(\x05R\x04bbox\x12\x19\n" +
+	"\braw_text\x18\x03 \x01(\tR\arawText\x12\x1d\n" +
+	"\n" +
+	"is_ignored\x18\x04 \x01(\bR\tisIgnored\x12\x1b\n" +
+	"\tlinked_to\x18\x05 \x01(\tR\blinkedTo\x12\x1d\n" +
+	"\n" +
+	"label_name\x18\x06 \x01(\tR\tlabelName\x12)\n" +
+	"\x06values\x18\a \x03(\v2\x11.corvina.v1.ValueR\x06values\x12\x12\n" +
+	"\x04page\x18\b \x01(\x05R\x04page\x12\x1b\n" +
+	"\tregion_id\x18\t \x01(\tR\bregionId\x12*\n" +
+	"\x06origin\x18\n" +
+	" \x01(\v2\x12.corvina.v1.OriginR\x06origin2\xfa\x01\n" +
+	"\x0eCorvinaService\x12C\n" +
+	"\vGetDocument\x12\x1e.corvina.v1.GetDocumentRequest\x1a\x14.corvina.v1.Document\x12T\n" +
+	"\rListDocuments\x12 .corvina.v1.ListDocumentsRequest\x1a!.corvina.v1.ListDocumentsResponse\x12M\n" +
+	"\x0fStreamDocuments\x12\".corvina.v1.StreamDocumentsRequest\x1a\x14.corvina.v1.Document0\x01B\x1bZ\x19corvina-backend/corvinapbb\x06proto3"
+
+var (
+	file_corvina_v1_corvina_proto_rawDescOnce sync.Once
+	file_corvina_v1_corvina_proto_rawDescData []byte
+)
+
+func file_corvina_v1_corvina_proto_rawDescGZIP() []byte {
+	file_corvina_v1_corvina_proto_rawDescOnce.Do(func() {
+		file_corvina_v1_corvina_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_corvina_v1_corvina_proto_rawDesc), len(file_corvina_v1_corvina_proto_rawDesc)))
+	})
+	return file_corvina_v1_corvina_proto_rawDescData
+}
+
+var file_corvina_v1_corvina_proto_msgTypes = make([]protoimpl.MessageInfo, 16)
+var file_corvina_v1_corvina_proto_goTypes = []any{
+	(*GetDocumentRequest)(nil),     // 0: corvina.v1.GetDocumentRequest
+	(*ListDocumentsRequest)(nil),   // 1: corvina.v1.ListDocumentsRequest
+	(*ListDocumentsResponse)(nil),  // 2: corvina.v1.ListDocumentsResponse
+	(*StreamDocumentsRequest)(nil), // 3: corvina.v1.StreamDocumentsRequest
+	(*DocumentSummary)(nil),        // 4: corvina.v1.DocumentSummary
+	(*Document)(nil),               // 5: corvina.v1.Document
+	(*Page)(nil),                   // 6: corvina.v1.Page
+	(*Origin)(nil),                 // 7: corvina.v1.Origin
+	(*Region)(nil),                 // 8: corvina.v1.Region
+	(*Graph)(nil),                  // 9: corvina.v1.Graph
+	(*Component)(nil),              // 10: corvina.v1.Component
+	(*Node)(nil),                   // 11: corvina.v1.Node
+	(*Connection)(nil),             // 12: corvina.v1.Connection
+	(*Value)(nil),                  // 13: corvina.v1.Value
+	(*TextAnnotation)(nil),         // 14: corvina.v1.TextAnnotation
+	nil,                            // 15: corvina.v1.Document.ClassificationEntry
+	(*structpb.Value)(nil),         // 16: google.protobuf.Value
+}
+var file_corvina_v1_corvina_proto_depIdxs = []int32{
+	4,  // 0: corvina.v1.ListDocumentsResponse.documents:type_name -> corvina.v1.DocumentSummary
+	6,  // 1: corvina.v1.Document.pages:type_name -> corvina.v1.Page
+	15, // 2: corvina.v1.Document.classification:type_name -> corvina.v1.Document.ClassificationEntry
+	8,  // 3: corvina.v1.Document.regions:type_name -> corvina.v1.Region
+	9,  // 4: corvina.v1.Document.graph:type_name -> corvina.v1.Graph
+	14, // 5: corvina.v1.Document.text_annotations:type_name -> corvina.v1.TextAnnotation
+	10, // 6: corvina.v1.Graph.components:type_name -> corvina.v1.Component
+	11, // 7: corvina.v1.Graph.nodes:type_name -> corvina.v1.Node
+	12, // 8: corvina.v1.Graph.connections:type_name -> corvina.v1.Connection
+	7,  // 9: corvina.v1.Component.origin:type_name -> corvina.v1.Origin
+	7,  // 10: corvina.v1.Node.origin:type_name -> corvina.v1.Origin
+	16, // 11: corvina.v1.Connection.points:type_name -> google.protobuf.Value
+	7,  // 12: corvina.v1.Connection.origin:type_name -> corvina.v1.Origin
+	13, // 13: corvina.v1.TextAnnotation.values:type_name -> corvina.v1.Value
+	7,  // 14: corvina.v1.TextAnnotation.origin:type_name -> corvina.v1.Origin
+	0,  // 15: corvina.v1.CorvinaService.GetDocument:input_type -> corvina.v1.GetDocumentRequest
+	1,  // 16: corvina.v1.CorvinaService.ListDocuments:input_type -> corvina.v1.ListDocumentsRequest
+	3,  // 17: corvina.v1.CorvinaService.StreamDocuments:input_type -> corvina.v1.StreamDocumentsRequest
+	5,  // 18: corvina.v1.CorvinaService.GetDocument:output_type -> corvina.v1.Document
+	2,  // 19: corvina.v1.CorvinaService.ListDocuments:output_type -> corvina.v1.ListDocumentsResponse
+	5,  // 20: corvina.v1.CorvinaService.StreamDocuments:output_type -> corvina.v1.Document
+	18, // [18:21] is the sub-list for method output_type
+	15, // [15:18] is the sub-list for method input_type
+	15, // [15:15] is the sub-list for extension type_name
+	15, // [15:15] is the sub-list for extension extendee
+	0,  // [0:15] is the sub-list for field type_name
+}
+
+func init() { file_corvina_v1_corvina_proto_init() }
+func file_corvina_v1_corvina_proto_init() {
+	if File_corvina_v1_corvina_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_corvina_v1_corvina_proto_rawDesc), len(file_corvina_v1_corvina_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   16,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_corvina_v1_corvina_proto_goTypes,
+		DependencyIndexes: file_corvina_v1_corvina_proto_depIdxs,
+		MessageInfos:      file_corvina_v1_corvina_proto_msgTypes,
+	}.Build()
+	File_corvina_v1_corvina_proto = out.File
+	file_corvina_v1_corvina_proto_goTypes = nil
+	file_corvina_v1_corvina_proto_depIdxs = nil
+}
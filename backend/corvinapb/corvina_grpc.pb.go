@@ -0,0 +1,217 @@
+// Typed read API over documents and their annotations, served over gRPC next to the JSON
+// handlers and, through grpc-gateway, as JSON under /v1/ (see gateway.yaml).
+//
+// Regenerate corvinapb/ after editing, from backend/:
+//   protoc -I proto --go_out=. --go_opt=module=corvina-backend \
+//     --go-grpc_out=. --go-grpc_opt=module=corvina-backend \
+//     --grpc-gateway_out=. --grpc-gateway_opt=module=corvina-backend \
+//     --grpc-gateway_opt=grpc_api_configuration=proto/corvina/v1/gateway.yaml \
+//     corvina/v1/corvina.proto
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: corvina/v1/corvina.proto
+
+package corvinapb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	CorvinaService_GetDocument_FullMethodName     = "/corvina.v1.CorvinaService/GetDocument"
+	CorvinaService_ListDocuments_FullMethodName   = "/corvina.v1.CorvinaService/ListDocuments"
+	CorvinaService_StreamDocuments_FullMethodName = "/corvina.v1.CorvinaService/StreamDocuments"
+)
+
+// CorvinaServiceClient is the client API for CorvinaService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type CorvinaServiceClient interface {
+	// GetDocument returns one document with the sections it asks for
+	GetDocument(ctx context.Context, in *GetDocumentRequest, opts ...grpc.CallOption) (*Document, error)
+	// ListDocuments returns document summaries, newest first
+	ListDocuments(ctx context.Context, in *ListDocumentsRequest, opts ...grpc.CallOption) (*ListDocumentsResponse, error)
+	// StreamDocuments sends every matching document in full, one message each, for bulk reads
+	StreamDocuments(ctx context.Context, in *StreamDocumentsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Document], error)
+}
+
+type corvinaServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewCorvinaServiceClient(cc grpc.ClientConnInterface) CorvinaServiceClient {
+	return &corvinaServiceClient{cc}
+}
+
+func (c *corvinaServiceClient) GetDocument(ctx context.Context, in *GetDocumentRequest, opts ...grpc.CallOption) (*Document, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Document)
+	err := c.cc.Invoke(ctx, CorvinaService_GetDocument_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *corvinaServiceClient) ListDocuments(ctx context.Context, in *ListDocumentsRequest, opts ...grpc.CallOption) (*ListDocumentsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListDocumentsResponse)
+	err := c.cc.Invoke(ctx, CorvinaService_ListDocuments_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *corvinaServiceClient) StreamDocuments(ctx context.Context, in *StreamDocumentsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Document], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &CorvinaService_ServiceDesc.Streams[0], CorvinaService_StreamDocuments_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[StreamDocumentsRequest, Document]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type CorvinaService_StreamDocumentsClient = grpc.ServerStreamingClient[Document]
+
+// CorvinaServiceServer is the server API for CorvinaService service.
+// All implementations must embed UnimplementedCorvinaServiceServer
+// for forward compatibility.
+type CorvinaServiceServer interface {
+	// GetDocument returns one document with the sections it asks for
+	GetDocument(context.Context, *GetDocumentRequest) (*Document, error)
+	// ListDocuments returns document summaries, newest first
+	ListDocuments(context.Context, *ListDocumentsRequest) (*ListDocumentsResponse, error)
+	// StreamDocuments sends every matching document in full, one message each, for bulk reads
+	StreamDocuments(*StreamDocumentsRequest, grpc.ServerStreamingServer[Document]) error
+	mustEmbedUnimplementedCorvinaServiceServer()
+}
+
+// UnimplementedCorvinaServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedCorvinaServiceServer struct{}
+
+func (UnimplementedCorvinaServiceServer) GetDocument(context.Context, *GetDocumentRequest) (*Document, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetDocument not implemented")
+}
+func (UnimplementedCorvinaServiceServer) ListDocuments(context.Context, *ListDocumentsRequest) (*ListDocumentsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListDocuments not implemented")
+}
+func (UnimplementedCorvinaServiceServer) StreamDocuments(*StreamDocumentsRequest, grpc.ServerStreamingServer[Document]) error {
+	return status.Errorf(codes.Unimplemented, "method StreamDocuments not implemented")
+}
+func (UnimplementedCorvinaServiceServer) mustEmbedUnimplementedCorvinaServiceServer() {}
+func (UnimplementedCorvinaServiceServer) testEmbeddedByValue()                        {}
+
+// UnsafeCorvinaServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to CorvinaServiceServer will
+// result in compilation errors.
+type UnsafeCorvinaServiceServer interface {
+	mustEmbedUnimplementedCorvinaServiceServer()
+}
+
+func RegisterCorvinaServiceServer(s grpc.ServiceRegistrar, srv CorvinaServiceServer) {
+	// If the following call pancis, it indicates UnimplementedCorvinaServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&CorvinaService_ServiceDesc, srv)
+}
+
+func _CorvinaService_GetDocument_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetDocumentRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CorvinaServiceServer).GetDocument(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CorvinaService_GetDocument_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CorvinaServiceServer).GetDocument(ctx, req.(*GetDocumentRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CorvinaService_ListDocuments_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListDocumentsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CorvinaServiceServer).ListDocuments(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CorvinaService_ListDocuments_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CorvinaServiceServer).ListDocuments(ctx, req.(*ListDocumentsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CorvinaService_StreamDocuments_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamDocumentsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(CorvinaServiceServer).StreamDocuments(m, &grpc.GenericServerStream[StreamDocumentsRequest, Document]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type CorvinaService_StreamDocumentsServer = grpc.ServerStreamingServer[Document]
+
+// CorvinaService_ServiceDesc is the grpc.ServiceDesc for CorvinaService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var CorvinaService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "corvina.v1.CorvinaService",
+	HandlerType: (*CorvinaServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetDocument",
+			Handler:    _CorvinaService_GetDocument_Handler,
+		},
+		{
+			MethodName: "ListDocuments",
+			Handler:    _CorvinaService_ListDocuments_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamDocuments",
+			Handler:       _CorvinaService_StreamDocuments_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "corvina/v1/corvina.proto",
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"5-1 * * * *",
+		"1-x * * * *",
+		"a * * * *",
+		"1,,2 * * * *",
+		"@fortnightly",
+	} {
+		if _, err := parseCron(expr); err == nil {
+			t.Errorf("parseCron(%q) succeeded", expr)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	// 2024-03-15 is a Friday
+	from := time.Date(2024, 3, 15, 10, 7, 30, 0, time.UTC)
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2024, 3, 15, 10, 8, 0, 0, time.UTC)},
+		{"0 2 * * *", time.Date(2024, 3, 16, 2, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2024, 3, 16, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2024, 3, 15, 11, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{"@yearly", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2024, 3, 17, 0, 0, 0, 0, time.UTC)},
+		// steps, ranges, and lists
+		{"*/15 * * * *", time.Date(2024, 3, 15, 10, 15, 0, 0, time.UTC)},
+		{"5/20 * * * *", time.Date(2024, 3, 15, 10, 25, 0, 0, time.UTC)},
+		{"0 8-18/4 * * *", time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)},
+		{"0,30 9,17 * * *", time.Date(2024, 3, 15, 17, 0, 0, 0, time.UTC)},
+		{"*/15 8-18 * * 1-5", time.Date(2024, 3, 15, 10, 15, 0, 0, time.UTC)},
+		// weekdays only: Friday evening rolls over to Monday
+		{"0 9 * * 1-5", time.Date(2024, 3, 18, 9, 0, 0, 0, time.UTC)},
+		// Sunday as 0 or 7
+		{"0 0 * * 0", time.Date(2024, 3, 17, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2024, 3, 17, 0, 0, 0, 0, time.UTC)},
+		// month and day of month
+		{"0 0 1 6 *", time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 * *", time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC)},
+		// both day fields restricted: either may match (the 20th, or the next Monday)
+		{"0 0 20 * 1", time.Date(2024, 3, 18, 0, 0, 0, 0, time.UTC)},
+		{"0 0 16 * 1", time.Date(2024, 3, 16, 0, 0, 0, 0, time.UTC)},
+		// only one restricted: it alone decides
+		{"0 0 20 * *", time.Date(2024, 3, 20, 0, 0, 0, 0, time.UTC)},
+		// a date that never comes
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, tt := range tests {
+		s, err := parseCron(tt.expr)
+		if err != nil {
+			t.Errorf("parseCron(%q): %v", tt.expr, err)
+			continue
+		}
+		if got := s.Next(from); !got.Equal(tt.want) {
+			t.Errorf("%q: Next = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestCronNextIsStrictlyAfter(t *testing.T) {
+	s, err := parseCron("30 10 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Date(2024, 3, 15, 10, 30, 0, 0, time.UTC)
+	if got, want := s.Next(at), at.AddDate(0, 0, 1); !got.Equal(want) {
+		t.Errorf("Next(%v) = %v, want %v", at, got, want)
+	}
+}
+
+func TestCronNextKeepsLocation(t *testing.T) {
+	loc := time.FixedZone("UTC+2", 2*60*60)
+	s, err := parseCron("0 2 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := s.Next(time.Date(2024, 3, 15, 10, 0, 0, 0, loc))
+	if want := time.Date(2024, 3, 16, 2, 0, 0, 0, loc); !got.Equal(want) || got.Location() != loc {
+		t.Errorf("Next = %v, want %v", got, want)
+	}
+}
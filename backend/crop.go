@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"strconv"
+	"sync"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// ---------- Component Crops ----------
+
+var cropMaxSize = envInt("CROP_MAX_SIZE", 2048)
+
+// recentPage keeps the last decoded page image, since crop requests usually walk through every
+// component of one document in a row and decoding a large scan dominates the cost
+var recentPage struct {
+	sync.Mutex
+	path string
+	img  image.Image
+}
+
+func decodePageCached(path string) (image.Image, error) {
+	recentPage.Lock()
+	defer recentPage.Unlock()
+	if recentPage.path == path {
+		return recentPage.img, nil
+	}
+	img, err := decodeImageFile(path)
+	if err != nil {
+		return nil, err
+	}
+	recentPage.path, recentPage.img = path, img
+	return img, nil
+}
+
+// cropRect pads an [x1, y1, x2, y2] bbox and clips it to the image
+func cropRect(bbox []int, pad int, bounds image.Rectangle) (image.Rectangle, error) {
+	if len(bbox) != 4 {
+		return image.Rectangle{}, fmt.Errorf("component has no valid bbox")
+	}
+	r := image.Rect(bbox[0]-pad, bbox[1]-pad, bbox[2]+pad, bbox[3]+pad).Add(bounds.Min).Intersect(bounds)
+	if r.Empty() {
+		return image.Rectangle{}, fmt.Errorf("component bbox lies outside the image")
+	}
+	return r, nil
+}
+
+// intQueryParam parses an optional non-negative integer query parameter
+func intQueryParam(r *http.Request, name string, def int) (int, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative integer", name)
+	}
+	return n, nil
+}
+
+// handleComponentCrop returns the image region under a component's bbox:
+// GET /documents/{id}/components/{cid}/crop?pad=8&size=224&format=png|jpg
+// pad adds pixels on every side; size scales the crop so its longest edge is that many pixels.
+func handleComponentCrop(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		jsonError(w, http.StatusMethodNotAllowed, "GET only")
+		return
+	}
+	docID, compID := r.PathValue("id"), r.PathValue("cid")
+
+	pad, err := intQueryParam(r, "pad", 0)
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	size, err := intQueryParam(r, "size", 0)
+	if err != nil || size > cropMaxSize {
+		jsonError(w, http.StatusBadRequest, fmt.Sprintf("size must be between 1 and %d", cropMaxSize))
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "png"
+	}
+	if format != "png" && format != "jpg" {
+		jsonError(w, http.StatusBadRequest, "format must be png or jpg")
+		return
+	}
+
+	var bbox []int
+	var page int
+	err = pool.QueryRow(r.Context(), "SELECT bbox, page_number FROM components WHERE document_id = $1 AND id = $2", docID, compID).
+		Scan(&bbox, &page)
+	if errors.Is(err, sql.ErrNoRows) {
+		jsonError(w, http.StatusNotFound, "Component not found")
+		return
+	}
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "Query failed")
+		return
+	}
+
+	sp, err := loadStoredPage(r.Context(), docID, page)
+	if err != nil {
+		jsonError(w, http.StatusNotFound, "Page image not found")
+		return
+	}
+
+	// The crop is fully determined by the page content and the request, so cache on that
+	etag := fmt.Sprintf(`"%s-%v-%d-%d-%s"`, sp.SHA256, bbox, pad, size, format)
+	if sp.SHA256 != "" && r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	img, err := decodePageCached(sp.Path)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "Failed to read page image")
+		return
+	}
+	rect, err := cropRect(bbox, pad, img.Bounds())
+	if err != nil {
+		jsonError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	var crop image.Image = subImage(img, rect)
+	if size > 0 {
+		cw, ch := rect.Dx(), rect.Dy()
+		if cw >= ch {
+			cw, ch = size, max(1, ch*size/cw)
+		} else {
+			cw, ch = max(1, cw*size/ch), size
+		}
+		scaled := image.NewRGBA(image.Rect(0, 0, cw, ch))
+		xdraw.CatmullRom.Scale(scaled, scaled.Bounds(), crop, crop.Bounds(), xdraw.Src, nil)
+		crop = scaled
+	}
+
+	var buf bytes.Buffer
+	contentType := "image/png"
+	if format == "jpg" {
+		contentType = "image/jpeg"
+		err = jpeg.Encode(&buf, crop, &jpeg.Options{Quality: 90})
+	} else {
+		err = png.Encode(&buf, crop)
+	}
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "Failed to encode crop")
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	if sp.SHA256 != "" {
+		w.Header().Set("ETag", etag)
+	}
+	w.Header().Set("X-Crop-Rect", fmt.Sprintf("%d,%d,%d,%d", rect.Min.X, rect.Min.Y, rect.Max.X, rect.Max.Y))
+	w.Write(buf.Bytes())
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// ---------- Campaign Progress ----------
+
+// Two endpoints back the progress dashboard:
+//
+//	GET /stats/progress?project=&split=&from=&to=     documents per status and a daily burn-down
+//	GET /stats/leaderboard?project=&split=&from=&to=  annotators ranked by documents completed
+//
+// A document is completed by the first submission that saved any annotations. Documents
+// annotated before submissions were recorded count as completed when they were uploaded.
+
+// progressStatuses are reported in this order, always all of them
+var progressStatuses = []string{"unannotated", "in_progress", "annotated"}
+
+// progressStatusSQL classifies documents d; $3 and $4 are the task lease and heartbeat timeout
+var progressStatusSQL = `CASE WHEN NOT (` + unannotatedSQL + `) THEN 'annotated'
+	WHEN NOT ` + claimLapsedSQL(3, 4) + ` THEN 'in_progress'
+	ELSE 'unannotated' END`
+
+// completedAtSQL is when document d was completed, NULL while it is not
+const completedAtSQL = `COALESCE(
+	(SELECT min(s.submitted_at) FROM submissions s WHERE s.document_id = d.document_id AND s.annotations > 0),
+	CASE WHEN NOT (` + unannotatedSQL + `) THEN COALESCE(d.created_at, '-infinity') END)`
+
+type StatusCount struct {
+	Status    string  `json:"status"`
+	Documents int64   `json:"documents"`
+	Percent   float64 `json:"percent"`
+}
+
+type BurndownPoint struct {
+	Date      string `json:"date"`
+	Total     int64  `json:"total"` // uploaded by the end of the day
+	Completed int64  `json:"completed"`
+	Remaining int64  `json:"remaining"`
+}
+
+type Progress struct {
+	Project   string          `json:"project,omitempty"`
+	Split     string          `json:"split,omitempty"`
+	Documents int64           `json:"documents"`
+	Statuses  []StatusCount   `json:"statuses"`
+	From      string          `json:"from"`
+	To        string          `json:"to"`
+	Burndown  []BurndownPoint `json:"burndown"`
+}
+
+func campaignProgress(ctx context.Context, project, split string, from, to time.Time) (*Progress, error) {
+	p := &Progress{Project: project, Split: split, From: from.Format("2006-01-02"), To: to.Format("2006-01-02")}
+
+	counts, err := countBy(ctx, "SELECT "+progressStatusSQL+", count(*) FROM documents d WHERE "+statsDocFilter+" GROUP BY 1",
+		project, split, taskLease.Seconds(), heartbeatTimeout.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	byStatus := map[string]int64{}
+	for _, c := range counts {
+		byStatus[c.Label] = c.Count
+		p.Documents += c.Count
+	}
+	for _, s := range progressStatuses {
+		sc := StatusCount{Status: s, Documents: byStatus[s]}
+		if p.Documents > 0 {
+			sc.Percent = 100 * float64(sc.Documents) / float64(p.Documents)
+		}
+		p.Statuses = append(p.Statuses, sc)
+	}
+
+	rows, err := readDB(ctx).QueryContext(ctx, `
+		WITH docs AS (
+			SELECT COALESCE(d.created_at, '-infinity') AS created_at, `+completedAtSQL+` AS completed_at
+			FROM documents d WHERE `+statsDocFilter+`
+		)
+		SELECT to_char(day, 'YYYY-MM-DD'),
+			count(docs.created_at) FILTER (WHERE docs.created_at < day + interval '1 day'),
+			count(docs.created_at) FILTER (WHERE docs.completed_at < day + interval '1 day')
+		FROM generate_series($3::timestamptz, $4::timestamptz, interval '1 day') day LEFT JOIN docs ON true
+		GROUP BY day ORDER BY day`, project, split, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	p.Burndown = []BurndownPoint{}
+	for rows.Next() {
+		var b BurndownPoint
+		if err := rows.Scan(&b.Date, &b.Total, &b.Completed); err != nil {
+			return nil, err
+		}
+		b.Remaining = b.Total - b.Completed
+		p.Burndown = append(p.Burndown, b)
+	}
+	return p, rows.Err()
+}
+
+type LeaderboardEntry struct {
+	Rank        int64  `json:"rank"`
+	Annotator   string `json:"annotator"`
+	Completed   int64  `json:"completed"` // documents their submission completed
+	Documents   int64  `json:"documents"` // documents they submitted at all
+	Submissions int64  `json:"submissions"`
+}
+
+// leaderboard ranks the annotators who submitted between from and to by documents completed,
+// then documents submitted
+func leaderboard(ctx context.Context, project, split string, from, to time.Time) ([]LeaderboardEntry, error) {
+	rows, err := readDB(ctx).QueryContext(ctx, `
+		WITH firsts AS (
+			SELECT DISTINCT ON (s.document_id) s.document_id, s.annotator, s.submitted_at
+			FROM submissions s JOIN documents d ON d.document_id = s.document_id
+			WHERE `+statsDocFilter+` AND s.annotations > 0
+			ORDER BY s.document_id, s.submitted_at
+		), completed AS (
+			SELECT annotator, count(*) AS n FROM firsts
+			WHERE submitted_at >= $3 AND submitted_at < $4 AND annotator IS NOT NULL
+			GROUP BY 1
+		), submitted AS (
+			SELECT s.annotator, count(*) AS submissions, count(DISTINCT s.document_id) AS documents
+			FROM submissions s JOIN documents d ON d.document_id = s.document_id
+			WHERE `+statsDocFilter+` AND s.submitted_at >= $3 AND s.submitted_at < $4 AND s.annotator IS NOT NULL
+			GROUP BY 1
+		)
+		SELECT rank() OVER (ORDER BY COALESCE(c.n, 0) DESC, a.documents DESC), a.annotator,
+			COALESCE(c.n, 0), a.documents, a.submissions
+		FROM submitted a LEFT JOIN completed c ON c.annotator = a.annotator
+		ORDER BY 1, 2`, project, split, from, to.AddDate(0, 0, 1))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	entries := []LeaderboardEntry{}
+	for rows.Next() {
+		var e LeaderboardEntry
+		if err := rows.Scan(&e.Rank, &e.Annotator, &e.Completed, &e.Documents, &e.Submissions); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+func handleProgress(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		jsonError(w, http.StatusMethodNotAllowed, "GET only")
+		return
+	}
+	q := r.URL.Query()
+	from, to, err := statsDateRange(q.Get("from"), q.Get("to"))
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	p, err := campaignProgress(r.Context(), q.Get("project"), q.Get("split"), from, to)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Progress query failed", "error", err)
+		jsonError(w, http.StatusInternalServerError, "Query failed")
+		return
+	}
+	jsonResponse(w, http.StatusOK, p)
+}
+
+func handleLeaderboard(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		jsonError(w, http.StatusMethodNotAllowed, "GET only")
+		return
+	}
+	q := r.URL.Query()
+	from, to, err := statsDateRange(q.Get("from"), q.Get("to"))
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	entries, err := leaderboard(r.Context(), q.Get("project"), q.Get("split"), from, to)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Leaderboard query failed", "error", err)
+		jsonError(w, http.StatusInternalServerError, "Query failed")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]interface{}{
+		"from":        from.Format("2006-01-02"),
+		"to":          to.Format("2006-01-02"),
+		"leaderboard": entries,
+		"count":       len(entries),
+	})
+}
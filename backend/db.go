@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/multitracer"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ---------- Connection Pool ----------
+
+// Pool settings. DB_STATEMENT_CACHE_SIZE bounds the prepared statements each connection keeps
+// under DB_QUERY_EXEC_MODE=cache_statement (see statements.go).
+var (
+	databaseURL          = envString("DATABASE_URL", "")
+	dbMaxConns           = envInt("DB_MAX_CONNS", 10)
+	dbMinConns           = envInt("DB_MIN_CONNS", 2)
+	dbMaxConnLifetime    = envDuration("DB_MAX_CONN_LIFETIME", 30*time.Minute)
+	dbMaxConnIdleTime    = envDuration("DB_MAX_CONN_IDLE_TIME", 5*time.Minute)
+	dbHealthCheckPeriod  = envDuration("DB_HEALTH_CHECK_PERIOD", time.Minute)
+	dbStatementCacheSize = envInt("DB_STATEMENT_CACHE_SIZE", 512)
+	dbQueryTimeout       = envDuration("DB_QUERY_TIMEOUT", 15*time.Second)
+	// Applies unless DATABASE_URL sets connect_timeout
+	dbConnectTimeout = envDuration("DB_CONNECT_TIMEOUT", 5*time.Second)
+)
+
+// newPoolConfig parses DATABASE_URL and applies the pool settings
+func newPoolConfig(dsn string) (*pgxpool.Config, error) {
+	if dbMaxConns < 1 || dbMinConns < 0 || dbMinConns > dbMaxConns {
+		return nil, fmt.Errorf("need 0 <= DB_MIN_CONNS (%d) <= DB_MAX_CONNS (%d) and DB_MAX_CONNS >= 1", dbMinConns, dbMaxConns)
+	}
+	if queryExecMode == "cache_statement" && dbStatementCacheSize < 1 {
+		return nil, fmt.Errorf("DB_QUERY_EXEC_MODE=cache_statement needs DB_STATEMENT_CACHE_SIZE >= 1")
+	}
+	cfg, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return nil, err
+	}
+	cfg.MaxConns = int32(dbMaxConns)
+	cfg.MinConns = int32(dbMinConns)
+	cfg.MaxConnLifetime = dbMaxConnLifetime
+	cfg.MaxConnLifetimeJitter = dbMaxConnLifetime / 10
+	cfg.MaxConnIdleTime = dbMaxConnIdleTime
+	cfg.HealthCheckPeriod = dbHealthCheckPeriod
+	if cfg.ConnConfig.ConnectTimeout == 0 {
+		cfg.ConnConfig.ConnectTimeout = dbConnectTimeout
+	}
+	cfg.ConnConfig.StatementCacheCapacity = dbStatementCacheSize
+	cfg.ConnConfig.DefaultQueryExecMode = queryExecModes[queryExecMode]
+	cfg.AfterConnect = prepareStatements
+	cfg.ConnConfig.Tracer = multitracer.New(queryTimeout{}, dbTracer{})
+	return cfg, nil
+}
+
+// connectDB opens the pool and waits for PostgreSQL to answer. The returned *sql.DB is a
+// database/sql view of the same pool for code written against that interface; it holds no
+// connections of its own.
+func connectDB() (*pgxpool.Pool, *sql.DB) {
+	if databaseURL == "" {
+		fatal("DATABASE_URL is not set")
+	}
+	p := connectPool("DATABASE_URL", databaseURL, false)
+	return p, stdlib.OpenDBFromPool(p)
+}
+
+// connectPool opens a pool on dsn, read from setting, and waits for the server to answer.
+// readOnly sessions reject writes.
+func connectPool(setting, dsn string, readOnly bool) *pgxpool.Pool {
+	cfg, err := newPoolConfig(dsn)
+	if err != nil {
+		fatal("Invalid database configuration", "setting", setting, "error", err)
+	}
+	if readOnly {
+		cfg.ConnConfig.RuntimeParams["default_transaction_read_only"] = "on"
+	} else {
+		// Only the primary feeds the circuit breaker; /readyz reports on the replica
+		cfg.ConnConfig.Tracer = multitracer.New(cfg.ConnConfig.Tracer, dbBreaker)
+	}
+	p, err := pgxpool.NewWithConfig(context.Background(), cfg)
+	if err != nil {
+		fatal("Creating connection pool failed", "setting", setting, "error", err)
+	}
+
+	// Retry loop — Postgres may take a few seconds to start in Docker
+	for i := 0; i < 30; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		err = p.Ping(ctx)
+		cancel()
+		if err == nil {
+			slog.Info("Connected to PostgreSQL", "setting", setting, "max_conns", cfg.MaxConns, "min_conns", cfg.MinConns)
+			return p
+		}
+		slog.Info("Waiting for PostgreSQL", "setting", setting, "attempt", i+1, "of", 30)
+		time.Sleep(1 * time.Second)
+	}
+
+	fatal("Failed to connect to PostgreSQL after 30 attempts", "setting", setting, "error", err)
+	return nil
+}
+
+// queryTimeout bounds each statement by DB_QUERY_TIMEOUT (0 disables it). The caller's context
+// still applies, so a query made for a request is also cancelled when the client goes away.
+type queryTimeout struct{}
+
+type queryCancelKey struct{}
+
+type noQueryTimeoutKey struct{}
+
+// withoutQueryTimeout exempts queries made with ctx from DB_QUERY_TIMEOUT, for work that is
+// slow by design such as migrations waiting on the advisory lock
+func withoutQueryTimeout(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noQueryTimeoutKey{}, true)
+}
+
+func (queryTimeout) TraceQueryStart(ctx context.Context, _ *pgx.Conn, _ pgx.TraceQueryStartData) context.Context {
+	if dbQueryTimeout <= 0 || ctx.Value(noQueryTimeoutKey{}) != nil {
+		return ctx
+	}
+	ctx, cancel := context.WithTimeout(ctx, dbQueryTimeout)
+	return context.WithValue(ctx, queryCancelKey{}, cancel)
+}
+
+func (queryTimeout) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, _ pgx.TraceQueryEndData) {
+	if cancel, ok := ctx.Value(queryCancelKey{}).(context.CancelFunc); ok {
+		cancel()
+	}
+}
+
+// poolCollector exports pgxpool statistics on /metrics, labelled with the pool's role
+// (primary | replica)
+type poolCollector struct {
+	pool *pgxpool.Pool
+
+	conns, maxConns                       *prometheus.Desc
+	acquires, acquireWait, emptyAcquires  *prometheus.Desc
+	canceledAcquires, newConns, destroyed *prometheus.Desc
+}
+
+func newPoolCollector(p *pgxpool.Pool, role string) *poolCollector {
+	desc := func(name, help string, labels ...string) *prometheus.Desc {
+		return prometheus.NewDesc("corvina_db_pool_"+name, help, labels, prometheus.Labels{"pool": role})
+	}
+	return &poolCollector{
+		pool:             p,
+		conns:            desc("conns", "Connections in the pool by state (acquired | idle | constructing).", "state"),
+		maxConns:         desc("max_conns", "Maximum size of the pool."),
+		acquires:         desc("acquires_total", "Successful connection acquisitions."),
+		acquireWait:      desc("acquire_wait_seconds_total", "Total time spent acquiring connections."),
+		emptyAcquires:    desc("empty_acquires_total", "Acquisitions that had to wait because no connection was idle."),
+		canceledAcquires: desc("canceled_acquires_total", "Acquisitions abandoned because their context ended."),
+		newConns:         desc("new_conns_total", "Connections opened."),
+		destroyed:        desc("destroyed_conns_total", "Connections closed by the pool, by reason (lifetime | idle).", "reason"),
+	}
+}
+
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(c, ch)
+}
+
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	s := c.pool.Stat()
+	gauge, counter := prometheus.GaugeValue, prometheus.CounterValue
+	ch <- prometheus.MustNewConstMetric(c.conns, gauge, float64(s.AcquiredConns()), "acquired")
+	ch <- prometheus.MustNewConstMetric(c.conns, gauge, float64(s.IdleConns()), "idle")
+	ch <- prometheus.MustNewConstMetric(c.conns, gauge, float64(s.ConstructingConns()), "constructing")
+	ch <- prometheus.MustNewConstMetric(c.maxConns, gauge, float64(s.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(c.acquires, counter, float64(s.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.acquireWait, counter, s.AcquireDuration().Seconds())
+	ch <- prometheus.MustNewConstMetric(c.emptyAcquires, counter, float64(s.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.canceledAcquires, counter, float64(s.CanceledAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.newConns, counter, float64(s.NewConnsCount()))
+	ch <- prometheus.MustNewConstMetric(c.destroyed, counter, float64(s.MaxLifetimeDestroyCount()), "lifetime")
+	ch <- prometheus.MustNewConstMetric(c.destroyed, counter, float64(s.MaxIdleDestroyCount()), "idle")
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ---------- Image Embeddings ----------
+
+var (
+	// Empty disables embedding; documents are then never returned by /similar
+	embedURL     = envString("EMBED_URL", "")
+	embedTimeout = envDuration("EMBED_TIMEOUT", time.Minute)
+)
+
+type embedJobPayload struct {
+	DocumentID string `json:"document_id"`
+}
+
+type embedResponse struct {
+	Model     string    `json:"model"`
+	Embedding []float64 `json:"embedding"`
+}
+
+func init() {
+	registerJobHandler("embed", runEmbedJob)
+}
+
+// queueEmbedding schedules a new document's embedding; failures only cost /similar results
+func queueEmbedding(ctx context.Context, docID string) {
+	if embedURL == "" {
+		return
+	}
+	if _, err := enqueueJob(ctx, db, "embed", embedJobPayload{DocumentID: docID}); err != nil {
+		slog.ErrorContext(ctx, "Queueing embedding failed", "document_id", docID, "error", err)
+	}
+}
+
+// runEmbedJob posts a document's first page to the embedding service, which answers
+// {"model": "...", "embedding": [0.12, ...]}, and stores the vector
+func runEmbedJob(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+	var p embedJobPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return nil, err
+	}
+	if embedURL == "" {
+		return nil, fmt.Errorf("embedding is disabled (set EMBED_URL)")
+	}
+	sp, err := loadStoredPage(ctx, p.DocumentID, 1)
+	if err != nil {
+		return nil, fmt.Errorf("loading page image: %w", err)
+	}
+	f, err := os.Open(sp.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, embedTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, embedURL, f)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "image/png")
+	req.Header.Set("X-Document-ID", p.DocumentID)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("calling embedding service: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("embedding service returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	var out embedResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("decoding embedding response: %w", err)
+	}
+	if len(out.Embedding) == 0 {
+		return nil, fmt.Errorf("embedding service returned an empty vector")
+	}
+
+	_, err = db.ExecContext(ctx, `
+		INSERT INTO document_embeddings (document_id, model, embedding, created_at)
+		VALUES ($1, $2, $3::vector, now())
+		ON CONFLICT (document_id) DO UPDATE SET model = EXCLUDED.model, embedding = EXCLUDED.embedding, created_at = now()
+	`, p.DocumentID, out.Model, vectorToPg(out.Embedding))
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"document_id": p.DocumentID, "model": out.Model, "dims": len(out.Embedding)}, nil
+}
+
+// vectorToPg formats floats as a pgvector literal like "[0.1,0.2]"
+func vectorToPg(v []float64) string {
+	parts := make([]string, len(v))
+	for i, f := range v {
+		parts[i] = strconv.FormatFloat(f, 'g', -1, 32)
+	}
+	return "[" + strings.Join(parts, ",") + "]"
+}
+
+type SimilarDocument struct {
+	DocumentID string  `json:"document_id"`
+	Project    string  `json:"project"`
+	ImageFile  string  `json:"image_file"`
+	Similarity float64 `json:"similarity"` // cosine similarity, 1 = identical
+}
+
+// handleSimilarDocuments lists the documents nearest to one in embedding space:
+// GET /documents/{id}/similar?limit=10&project=
+func handleSimilarDocuments(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		jsonError(w, http.StatusMethodNotAllowed, "GET only")
+		return
+	}
+	docID := r.PathValue("id")
+	limit, err := intQueryParam(r, "limit", 10)
+	if err != nil || limit < 1 || limit > 100 {
+		jsonError(w, http.StatusBadRequest, "limit must be between 1 and 100")
+		return
+	}
+
+	var model string
+	if err := readDB(r.Context()).QueryRowContext(r.Context(), "SELECT model FROM document_embeddings WHERE document_id = $1", docID).Scan(&model); err != nil {
+		jsonError(w, http.StatusNotFound, "Document has no embedding yet")
+		return
+	}
+
+	// Only vectors from the same model are comparable
+	query := `
+		SELECT e.document_id, d.project, d.image_file, 1 - (e.embedding <=> src.embedding)
+		FROM document_embeddings src
+		JOIN document_embeddings e ON e.model = src.model AND e.document_id <> src.document_id
+			AND vector_dims(e.embedding) = vector_dims(src.embedding)
+		JOIN documents d ON d.document_id = e.document_id
+		WHERE src.document_id = $1`
+	args := []interface{}{docID, limit}
+	if project := r.URL.Query().Get("project"); project != "" {
+		args = append(args, project)
+		query += fmt.Sprintf(" AND d.project = $%d", len(args))
+	}
+	query += " ORDER BY e.embedding <=> src.embedding LIMIT $2"
+
+	rows, err := readDB(r.Context()).QueryContext(r.Context(), query, args...)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Similar query failed", "document_id", docID, "error", err)
+		jsonError(w, http.StatusInternalServerError, "Query failed")
+		return
+	}
+	defer rows.Close()
+
+	similar := []SimilarDocument{}
+	for rows.Next() {
+		var s SimilarDocument
+		if err := rows.Scan(&s.DocumentID, &s.Project, &s.ImageFile, &s.Similarity); err != nil {
+			jsonError(w, http.StatusInternalServerError, "Query failed")
+			return
+		}
+		similar = append(similar, s)
+	}
+	jsonResponse(w, http.StatusOK, map[string]interface{}{
+		"document_id": docID,
+		"model":       model,
+		"similar":     similar,
+	})
+}
+
+// handleBackfillEmbeddings queues embedding jobs for every document without a vector:
+// POST /admin/embeddings/backfill
+func handleBackfillEmbeddings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		jsonError(w, http.StatusMethodNotAllowed, "POST only")
+		return
+	}
+	if embedURL == "" {
+		jsonError(w, http.StatusServiceUnavailable, "Embedding is disabled (set EMBED_URL)")
+		return
+	}
+	docIDs, err := queryStrings(r.Context(), `
+		SELECT d.document_id FROM documents d
+		WHERE NOT EXISTS (SELECT 1 FROM document_embeddings e WHERE e.document_id = d.document_id)
+		ORDER BY d.created_at
+	`)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "Query failed")
+		return
+	}
+	for _, id := range docIDs {
+		if _, err := enqueueJob(r.Context(), db, "embed", embedJobPayload{DocumentID: id}); err != nil {
+			jsonError(w, http.StatusInternalServerError, "Failed to queue jobs: "+err.Error())
+			return
+		}
+	}
+	jsonResponse(w, http.StatusAccepted, map[string]interface{}{"queued": len(docIDs)})
+}
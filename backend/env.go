@@ -0,0 +1,91 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ---------- Environment Helpers ----------
+
+// The env* helpers read a setting from flags, the environment, or the config file (config.go).
+// A malformed value falls back to the default here and is reported by checkConfig at startup.
+
+// envString returns the value of key, or def when unset
+func envString(key, def string) string {
+	if v := config.lookup(key, def); v != "" {
+		return v
+	}
+	return def
+}
+
+// envChoice returns the value of key, which must be one of choices, or def when unset or invalid
+func envChoice(key, def string, choices ...string) string {
+	v := config.lookup(key, def)
+	if v == "" {
+		return def
+	}
+	for _, c := range choices {
+		if v == c {
+			return v
+		}
+	}
+	config.invalid(key, v, "one of "+strings.Join(choices, ", "))
+	return def
+}
+
+// envInt returns the integer value of key, or def when unset or invalid
+func envInt(key string, def int) int {
+	v := config.lookup(key, strconv.Itoa(def))
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		config.invalid(key, v, "an integer")
+		return def
+	}
+	return n
+}
+
+// envDuration returns the duration value of key (e.g. "30s"), or def when unset or invalid
+func envDuration(key string, def time.Duration) time.Duration {
+	v := config.lookup(key, def.String())
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		config.invalid(key, v, "a duration such as 30s or 5m")
+		return def
+	}
+	return d
+}
+
+// envBool returns the boolean value of key, or def when unset or invalid
+func envBool(key string, def bool) bool {
+	v := config.lookup(key, strconv.FormatBool(def))
+	if v == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		config.invalid(key, v, "true or false")
+		return def
+	}
+	return b
+}
+
+// envFloat returns the float value of key, or def when unset or invalid
+func envFloat(key string, def float64) float64 {
+	v := config.lookup(key, strconv.FormatFloat(def, 'g', -1, 64))
+	if v == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		config.invalid(key, v, "a number")
+		return def
+	}
+	return f
+}
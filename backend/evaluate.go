@@ -0,0 +1,361 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+// ---------- Model Evaluation ----------
+
+// ClassMetrics scores one component label
+type ClassMetrics struct {
+	GroundTruth   int     `json:"ground_truth"`
+	Predicted     int     `json:"predicted"`
+	TruePositives int     `json:"true_positives"`
+	Precision     float64 `json:"precision"`
+	Recall        float64 `json:"recall"`
+	AP            float64 `json:"ap"`
+}
+
+type ComponentMetrics struct {
+	PerClass      map[string]*ClassMetrics `json:"per_class"`
+	GroundTruth   int                      `json:"ground_truth"`
+	Predicted     int                      `json:"predicted"`
+	TruePositives int                      `json:"true_positives"`
+	Precision     float64                  `json:"precision"`
+	Recall        float64                  `json:"recall"`
+	MAP           float64                  `json:"map"`
+}
+
+type EdgeMetrics struct {
+	GroundTruth   int     `json:"ground_truth"`
+	Predicted     int     `json:"predicted"`
+	TruePositives int     `json:"true_positives"`
+	Precision     float64 `json:"precision"`
+	Recall        float64 `json:"recall"`
+	F1            float64 `json:"f1"`
+}
+
+// scoredPrediction is one predicted box after matching, kept for the AP curve
+type scoredPrediction struct {
+	confidence float64
+	tp         bool
+}
+
+// evaluation accumulates matches across documents
+type evaluation struct {
+	iouThreshold float64
+	nodeDistance float64
+	gtCount      map[string]int
+	scored       map[string][]scoredPrediction
+	edges        EdgeMetrics
+}
+
+func boxIoU(a, b []int) float64 {
+	if len(a) != 4 || len(b) != 4 {
+		return 0
+	}
+	iw := min(a[2], b[2]) - max(a[0], b[0])
+	ih := min(a[3], b[3]) - max(a[1], b[1])
+	if iw <= 0 || ih <= 0 {
+		return 0
+	}
+	inter := float64(iw * ih)
+	union := float64((a[2]-a[0])*(a[3]-a[1])+(b[2]-b[0])*(b[3]-b[1])) - inter
+	return inter / union
+}
+
+// addDocument matches one document's model suggestions against its final annotations
+func (ev *evaluation) addDocument(graph Graph, preds []Suggestion) {
+	// Predictions in confidence order, so greedy matching favours confident boxes
+	sort.SliceStable(preds, func(i, j int) bool { return preds[i].Confidence > preds[j].Confidence })
+
+	// Suggestion ID -> matched ground-truth ID, used to resolve predicted edge endpoints
+	matchedTo := map[string]string{}
+
+	usedComp := map[string]bool{}
+	for _, c := range graph.Components {
+		ev.gtCount[c.Label]++
+	}
+	for _, p := range preds {
+		if p.Type != "box" {
+			continue
+		}
+		best, bestIoU := "", ev.iouThreshold
+		for _, c := range graph.Components {
+			if usedComp[c.ID] || c.Label != p.Label || c.Page != p.Page {
+				continue
+			}
+			if v := boxIoU(p.BBox, c.BBox); v >= bestIoU {
+				best, bestIoU = c.ID, v
+			}
+		}
+		if best != "" {
+			usedComp[best] = true
+			matchedTo[p.ID] = best
+		}
+		ev.scored[p.Label] = append(ev.scored[p.Label], scoredPrediction{p.Confidence, best != ""})
+	}
+
+	usedNode := map[string]bool{}
+	for _, p := range preds {
+		if p.Type != "node" || len(p.Position) != 2 {
+			continue
+		}
+		best, bestDist := "", ev.nodeDistance
+		for _, n := range graph.Nodes {
+			if usedNode[n.ID] || n.Page != p.Page || len(n.Position) != 2 {
+				continue
+			}
+			d := math.Hypot(float64(p.Position[0]-n.Position[0]), float64(p.Position[1]-n.Position[1]))
+			if d <= bestDist {
+				best, bestDist = n.ID, d
+			}
+		}
+		if best != "" {
+			usedNode[best] = true
+			matchedTo[p.ID] = best
+		}
+	}
+
+	// Edges are unordered endpoint pairs; a predicted edge is correct when both endpoints resolve
+	// to ground-truth entities that the annotator connected
+	edgeKey := func(a, b string) [2]string {
+		if a > b {
+			a, b = b, a
+		}
+		return [2]string{a, b}
+	}
+	gtEdges := map[[2]string]bool{}
+	for _, c := range graph.Connections {
+		gtEdges[edgeKey(c.SourceID, c.TargetID)] = true
+	}
+	ev.edges.GroundTruth += len(gtEdges)
+
+	resolve := func(id string) string {
+		if gt, ok := matchedTo[id]; ok {
+			return gt
+		}
+		return id // may already reference an existing annotation
+	}
+	seen := map[[2]string]bool{}
+	for _, p := range preds {
+		if p.Type != "connection" && p.Type != "line" {
+			continue
+		}
+		key := edgeKey(resolve(p.SourceID), resolve(p.TargetID))
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		ev.edges.Predicted++
+		if gtEdges[key] {
+			ev.edges.TruePositives++
+		}
+	}
+}
+
+// averagePrecision computes all-point interpolated AP from matched predictions
+func averagePrecision(preds []scoredPrediction, gt int) float64 {
+	if gt == 0 || len(preds) == 0 {
+		return 0
+	}
+	sort.SliceStable(preds, func(i, j int) bool { return preds[i].confidence > preds[j].confidence })
+
+	precision := make([]float64, len(preds))
+	recall := make([]float64, len(preds))
+	tp := 0
+	for i, p := range preds {
+		if p.tp {
+			tp++
+		}
+		precision[i] = float64(tp) / float64(i+1)
+		recall[i] = float64(tp) / float64(gt)
+	}
+	// Precision envelope: the best precision at any recall level at or beyond this one
+	for i := len(precision) - 2; i >= 0; i-- {
+		precision[i] = max(precision[i], precision[i+1])
+	}
+	ap, prevRecall := 0.0, 0.0
+	for i := range preds {
+		ap += (recall[i] - prevRecall) * precision[i]
+		prevRecall = recall[i]
+	}
+	return ap
+}
+
+func ratio(a, b int) float64 {
+	if b == 0 {
+		return 0
+	}
+	return float64(a) / float64(b)
+}
+
+func (ev *evaluation) componentMetrics() ComponentMetrics {
+	m := ComponentMetrics{PerClass: map[string]*ClassMetrics{}}
+	labels := map[string]bool{}
+	for l := range ev.gtCount {
+		labels[l] = true
+	}
+	for l := range ev.scored {
+		labels[l] = true
+	}
+
+	apSum, apClasses := 0.0, 0
+	for label := range labels {
+		cm := &ClassMetrics{GroundTruth: ev.gtCount[label], Predicted: len(ev.scored[label])}
+		for _, p := range ev.scored[label] {
+			if p.tp {
+				cm.TruePositives++
+			}
+		}
+		cm.Precision = ratio(cm.TruePositives, cm.Predicted)
+		cm.Recall = ratio(cm.TruePositives, cm.GroundTruth)
+		cm.AP = averagePrecision(ev.scored[label], cm.GroundTruth)
+		m.PerClass[label] = cm
+
+		m.GroundTruth += cm.GroundTruth
+		m.Predicted += cm.Predicted
+		m.TruePositives += cm.TruePositives
+		// mAP averages over classes present in the ground truth
+		if cm.GroundTruth > 0 {
+			apSum += cm.AP
+			apClasses++
+		}
+	}
+	m.Precision = ratio(m.TruePositives, m.Predicted)
+	m.Recall = ratio(m.TruePositives, m.GroundTruth)
+	if apClasses > 0 {
+		m.MAP = apSum / float64(apClasses)
+	}
+	return m
+}
+
+func (ev *evaluation) edgeMetrics() EdgeMetrics {
+	e := ev.edges
+	e.Precision = ratio(e.TruePositives, e.Predicted)
+	e.Recall = ratio(e.TruePositives, e.GroundTruth)
+	if e.Precision+e.Recall > 0 {
+		e.F1 = 2 * e.Precision * e.Recall / (e.Precision + e.Recall)
+	}
+	return e
+}
+
+// handleEvaluate scores stored model suggestions against the final annotations of the same documents:
+// GET /evaluate?model=detector-v3&model_version=&project=&iou=0.5&node_distance=10
+// Only documents that have both model suggestions and at least one annotation are counted.
+func handleEvaluate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		jsonError(w, http.StatusMethodNotAllowed, "GET only")
+		return
+	}
+	q := r.URL.Query()
+
+	ev := &evaluation{iouThreshold: 0.5, nodeDistance: 10, gtCount: map[string]int{}, scored: map[string][]scoredPrediction{}}
+	if v := q.Get("iou"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f <= 0 || f > 1 {
+			jsonError(w, http.StatusBadRequest, "iou must be in (0, 1]")
+			return
+		}
+		ev.iouThreshold = f
+	}
+	if v := q.Get("node_distance"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f < 0 {
+			jsonError(w, http.StatusBadRequest, "node_distance must be a non-negative number of pixels")
+			return
+		}
+		ev.nodeDistance = f
+	}
+
+	query := `SELECT DISTINCT s.document_id FROM suggestions s JOIN documents d ON d.document_id = s.document_id
+		WHERE s.source = 'model'
+		  AND (EXISTS (SELECT 1 FROM components c WHERE c.document_id = s.document_id)
+		    OR EXISTS (SELECT 1 FROM connections c WHERE c.document_id = s.document_id))`
+	args := []interface{}{}
+	if v := q.Get("model"); v != "" {
+		args = append(args, v)
+		query += fmt.Sprintf(" AND s.model_name = $%d", len(args))
+	}
+	if v := q.Get("model_version"); v != "" {
+		args = append(args, v)
+		query += fmt.Sprintf(" AND s.model_version = $%d", len(args))
+	}
+	if v := q.Get("project"); v != "" {
+		args = append(args, v)
+		query += fmt.Sprintf(" AND d.project = $%d", len(args))
+	}
+	docIDs, err := queryStrings(r.Context(), query, args...)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Evaluate query failed", "error", err)
+		jsonError(w, http.StatusInternalServerError, "Query failed")
+		return
+	}
+
+	for _, docID := range docIDs {
+		sq := "SELECT " + suggestionColumns + " FROM suggestions WHERE document_id = $1 AND source = 'model'"
+		sargs := []interface{}{docID}
+		if v := q.Get("model"); v != "" {
+			sargs = append(sargs, v)
+			sq += fmt.Sprintf(" AND model_name = $%d", len(sargs))
+		}
+		if v := q.Get("model_version"); v != "" {
+			sargs = append(sargs, v)
+			sq += fmt.Sprintf(" AND model_version = $%d", len(sargs))
+		}
+		rows, err := pool.Query(r.Context(), sq, sargs...)
+		if err != nil {
+			jsonError(w, http.StatusInternalServerError, "Query failed")
+			return
+		}
+		var preds []Suggestion
+		for rows.Next() {
+			s, err := scanSuggestion(rows.Scan)
+			if err != nil {
+				rows.Close()
+				jsonError(w, http.StatusInternalServerError, "Query failed")
+				return
+			}
+			preds = append(preds, s)
+		}
+		rows.Close()
+
+		graph, _ := loadAnnotations(r.Context(), docID)
+		ev.addDocument(graph, preds)
+	}
+
+	jsonResponse(w, http.StatusOK, map[string]interface{}{
+		"model":         q.Get("model"),
+		"model_version": q.Get("model_version"),
+		"iou_threshold": ev.iouThreshold,
+		"node_distance": ev.nodeDistance,
+		"documents":     len(docIDs),
+		"components":    ev.componentMetrics(),
+		"connections":   ev.edgeMetrics(),
+	})
+}
+
+// queryStrings runs a query returning one text column
+func queryStrings(ctx context.Context, query string, args ...interface{}) ([]string, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []string{}
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
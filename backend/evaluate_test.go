@@ -0,0 +1,129 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func approxEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestBoxIoU(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []int
+		want float64
+	}{
+		{"identical", []int{0, 0, 10, 10}, []int{0, 0, 10, 10}, 1},
+		{"half overlap", []int{0, 0, 10, 10}, []int{5, 0, 15, 10}, 50.0 / 150},
+		{"contained", []int{0, 0, 10, 10}, []int{0, 0, 5, 5}, 0.25},
+		{"touching edges", []int{0, 0, 10, 10}, []int{10, 0, 20, 10}, 0},
+		{"disjoint", []int{0, 0, 10, 10}, []int{50, 50, 60, 60}, 0},
+		{"malformed", []int{0, 0, 10}, []int{0, 0, 10, 10}, 0},
+	}
+	for _, tt := range tests {
+		if got := boxIoU(tt.a, tt.b); !approxEqual(got, tt.want) {
+			t.Errorf("%s: boxIoU = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAveragePrecision(t *testing.T) {
+	tp := func(c float64) scoredPrediction { return scoredPrediction{c, true} }
+	fp := func(c float64) scoredPrediction { return scoredPrediction{c, false} }
+	tests := []struct {
+		name  string
+		preds []scoredPrediction
+		gt    int
+		want  float64
+	}{
+		{"all correct", []scoredPrediction{tp(0.9), tp(0.8)}, 2, 1},
+		{"all wrong", []scoredPrediction{fp(0.9), fp(0.8)}, 2, 0},
+		// precision 1, 1/2, 2/3 at recall 1/2, 1/2, 1; the envelope lifts the middle to 2/3
+		{"miss in the middle", []scoredPrediction{tp(0.9), fp(0.8), tp(0.7)}, 2, 0.5 + 0.5*2.0/3},
+		{"half the ground truth found", []scoredPrediction{tp(0.9), tp(0.8)}, 4, 0.5},
+		{"sorted by confidence first", []scoredPrediction{tp(0.2), fp(0.9)}, 1, 0.5},
+		{"trailing false positives are free", []scoredPrediction{tp(0.9), fp(0.1), fp(0.05)}, 1, 1},
+		{"no ground truth", []scoredPrediction{tp(0.9)}, 0, 0},
+		{"no predictions", nil, 3, 0},
+	}
+	for _, tt := range tests {
+		if got := averagePrecision(tt.preds, tt.gt); !approxEqual(got, tt.want) {
+			t.Errorf("%s: averagePrecision = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestEvaluationMetrics(t *testing.T) {
+	graph := Graph{
+		Components: []Component{
+			{ID: "r1", Label: "resistor", BBox: []int{0, 0, 10, 10}},
+			{ID: "r2", Label: "resistor", BBox: []int{20, 0, 30, 10}},
+			{ID: "c1", Label: "capacitor", BBox: []int{0, 20, 10, 30}},
+		},
+		Nodes: []Node{
+			{ID: "n1", Position: []int{0, 0}},
+			{ID: "n2", Position: []int{100, 0}},
+		},
+		Connections: []Connection{
+			{ID: "e1", SourceID: "n1", TargetID: "n2"},
+			{ID: "e2", SourceID: "r1", TargetID: "r2"},
+		},
+	}
+	preds := []Suggestion{
+		{ID: "p1", Type: "box", Label: "resistor", BBox: []int{0, 0, 10, 10}, Confidence: 0.9},
+		{ID: "p2", Type: "box", Label: "resistor", BBox: []int{50, 50, 60, 60}, Confidence: 0.8},
+		{ID: "p3", Type: "box", Label: "resistor", BBox: []int{21, 0, 31, 10}, Confidence: 0.7},
+		{ID: "p4", Type: "box", Label: "resistor", BBox: []int{0, 0, 10, 10}, Confidence: 0.6}, // r1 is taken
+		{ID: "p5", Type: "box", Label: "diode", BBox: []int{0, 20, 10, 30}, Confidence: 0.5},
+		{ID: "q1", Type: "node", Position: []int{2, 2}},
+		{ID: "q2", Type: "node", Position: []int{100, 5}},
+		{ID: "s1", Type: "connection", SourceID: "q2", TargetID: "q1"}, // n2-n1, reversed
+		{ID: "s2", Type: "line", SourceID: "q1", TargetID: "q2"},       // the same edge again
+		{ID: "s3", Type: "connection", SourceID: "r1", TargetID: "c1"},
+	}
+	ev := &evaluation{iouThreshold: 0.5, nodeDistance: 10, gtCount: map[string]int{}, scored: map[string][]scoredPrediction{}}
+	ev.addDocument(graph, preds)
+
+	cm := ev.componentMetrics()
+	classes := []struct {
+		label                 string
+		gt, predicted, tp     int
+		precision, recall, ap float64
+	}{
+		// resistor: p1 and p3 match, p2 and p4 don't; AP as in "miss in the middle", plus a trailing miss
+		{"resistor", 2, 4, 2, 0.5, 1, 0.5 + 0.5*2.0/3},
+		{"capacitor", 1, 0, 0, 0, 0, 0},
+		{"diode", 0, 1, 0, 0, 0, 0},
+	}
+	for _, c := range classes {
+		got := cm.PerClass[c.label]
+		if got == nil {
+			t.Errorf("%s: missing", c.label)
+			continue
+		}
+		if got.GroundTruth != c.gt || got.Predicted != c.predicted || got.TruePositives != c.tp ||
+			!approxEqual(got.Precision, c.precision) || !approxEqual(got.Recall, c.recall) || !approxEqual(got.AP, c.ap) {
+			t.Errorf("%s: got %+v", c.label, *got)
+		}
+	}
+	if cm.GroundTruth != 3 || cm.Predicted != 5 || cm.TruePositives != 2 {
+		t.Errorf("totals: got %d ground truth, %d predicted, %d true positives", cm.GroundTruth, cm.Predicted, cm.TruePositives)
+	}
+	if !approxEqual(cm.Precision, 2.0/5) || !approxEqual(cm.Recall, 2.0/3) {
+		t.Errorf("precision %v, recall %v", cm.Precision, cm.Recall)
+	}
+	// diode has no ground truth, so mAP averages resistor and capacitor only
+	if want := (0.5 + 0.5*2.0/3) / 2; !approxEqual(cm.MAP, want) {
+		t.Errorf("mAP = %v, want %v", cm.MAP, want)
+	}
+
+	em := ev.edgeMetrics()
+	if em.GroundTruth != 2 || em.Predicted != 2 || em.TruePositives != 1 {
+		t.Errorf("edges: got %+v", em)
+	}
+	if !approxEqual(em.Precision, 0.5) || !approxEqual(em.Recall, 0.5) || !approxEqual(em.F1, 0.5) {
+		t.Errorf("edges: got precision %v, recall %v, F1 %v", em.Precision, em.Recall, em.F1)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/segmentio/kafka-go"
+)
+
+// ---------- Event Bus ----------
+
+// EVENT_BUS publishes outbox events to a message bus as well as to webhooks: nats or kafka, or
+// empty for none. Each event type goes to <EVENT_SUBJECT_PREFIX>.<type>, a NATS subject or a
+// Kafka topic, e.g. corvina.annotations.submitted. Kafka messages are keyed by document ID so a
+// document's events stay in order within a partition.
+var (
+	eventBus           = envChoice("EVENT_BUS", "", "", "nats", "kafka")
+	eventSubjectPrefix = envString("EVENT_SUBJECT_PREFIX", "corvina")
+	natsURL            = envString("NATS_URL", nats.DefaultURL)
+	// Comma-separated host:port list
+	kafkaBrokers = parseCSV(envString("KAFKA_BROKERS", "localhost:9092"))
+)
+
+// busDestination is the outbox destination of events bound for EVENT_BUS
+const busDestination = "bus"
+
+type eventPublisher interface {
+	Publish(ctx context.Context, subject, eventID, docID string, body []byte) error
+	Close() error
+}
+
+// publisher is set in main when EVENT_BUS is configured
+var publisher eventPublisher
+
+// openEventBus connects to EVENT_BUS
+func openEventBus() (eventPublisher, error) {
+	switch eventBus {
+	case "nats":
+		nc, err := nats.Connect(natsURL, nats.Name("corvina-backend"), nats.MaxReconnects(-1))
+		if err != nil {
+			return nil, fmt.Errorf("connecting to NATS at %s: %w", natsURL, err)
+		}
+		return natsPublisher{nc}, nil
+	case "kafka":
+		if len(kafkaBrokers) == 0 {
+			return nil, fmt.Errorf("EVENT_BUS=kafka needs KAFKA_BROKERS")
+		}
+		return kafkaPublisher{&kafka.Writer{
+			Addr:                   kafka.TCP(kafkaBrokers...),
+			Balancer:               &kafka.Hash{},
+			RequiredAcks:           kafka.RequireAll,
+			AllowAutoTopicCreation: true,
+			WriteTimeout:           10 * time.Second,
+		}}, nil
+	}
+	return nil, fmt.Errorf("unknown EVENT_BUS %q", eventBus)
+}
+
+// eventSubject names the subject or topic for an event type
+func eventSubject(eventType string) string {
+	return strings.TrimSuffix(eventSubjectPrefix, ".") + "." + eventType
+}
+
+// publishEvent sends an outbox row to the bus
+func publishEvent(ctx context.Context, eventID, eventType, docID string, body []byte) error {
+	if publisher == nil {
+		return fmt.Errorf("EVENT_BUS is not configured")
+	}
+	return publisher.Publish(ctx, eventSubject(eventType), eventID, docID, body)
+}
+
+type natsPublisher struct {
+	nc *nats.Conn
+}
+
+// Publish sets Nats-Msg-Id, which JetStream streams use to drop redelivered events
+func (p natsPublisher) Publish(_ context.Context, subject, eventID, _ string, body []byte) error {
+	msg := nats.NewMsg(subject)
+	msg.Data = body
+	msg.Header.Set(nats.MsgIdHdr, eventID)
+	msg.Header.Set("Corvina-Event-ID", eventID)
+	if err := p.nc.PublishMsg(msg); err != nil {
+		return err
+	}
+	// Flush so a publish the server never saw is retried rather than marked delivered
+	return p.nc.FlushTimeout(webhookTimeout)
+}
+
+func (p natsPublisher) Close() error {
+	return p.nc.Drain()
+}
+
+type kafkaPublisher struct {
+	w *kafka.Writer
+}
+
+func (p kafkaPublisher) Publish(ctx context.Context, topic, eventID, docID string, body []byte) error {
+	return p.w.WriteMessages(ctx, kafka.Message{
+		Topic:   topic,
+		Key:     []byte(docID),
+		Value:   body,
+		Headers: []kafka.Header{{Key: "Corvina-Event-ID", Value: []byte(eventID)}},
+	})
+}
+
+func (p kafkaPublisher) Close() error {
+	return p.w.Close()
+}
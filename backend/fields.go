@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// ---------- Sparse Document Fields ----------
+
+// documentSections are the expensive parts of a document payload, each needing its own queries
+var documentSections = map[string]bool{"graph": true, "text_annotations": true}
+
+// documentFields are the top-level keys of OutputJSON that ?fields= may select
+var documentFields = map[string]bool{
+	"document_id": true, "image_file": true, "original_filename": true, "display_name": true, "aliases": true, "width": true, "height": true, "sha256": true,
+	"size_bytes": true, "num_pages": true, "pages": true, "classification": true, "tags": true,
+	"notes": true, "regions": true, "graph": true, "text_annotations": true,
+}
+
+// documentView selects which parts of a document to load and return.
+// ?include=graph,text keeps all metadata but only the listed sections; ?fields= picks exact
+// top-level keys. Both may be combined. ?coords=relative scales coordinates to the page size.
+// The zero value returns everything in pixels.
+type documentView struct {
+	sections map[string]bool
+	fields   map[string]bool
+	relative bool
+}
+
+func parseDocumentView(q url.Values) (documentView, error) {
+	var v documentView
+	var err error
+	if v.relative, err = coordsModeFromQuery(q.Get("coords")); err != nil {
+		return v, err
+	}
+	if include := q.Get("include"); include != "" {
+		v.sections = map[string]bool{}
+		for _, s := range strings.Split(include, ",") {
+			s = strings.TrimSpace(s)
+			if s == "text" {
+				s = "text_annotations"
+			}
+			if !documentSections[s] {
+				return v, fmt.Errorf("include must list graph and/or text, got %q", s)
+			}
+			v.sections[s] = true
+		}
+	}
+	if fields := q.Get("fields"); fields != "" {
+		v.fields = map[string]bool{}
+		for _, f := range strings.Split(fields, ",") {
+			f = strings.TrimSpace(f)
+			if !documentFields[f] {
+				return v, fmt.Errorf("unknown field %q (valid: %s)", f, strings.Join(sortedKeys(documentFields), ", "))
+			}
+			v.fields[f] = true
+		}
+	}
+	return v, nil
+}
+
+// wants reports whether a top-level key is part of the view
+func (v documentView) wants(key string) bool {
+	if documentSections[key] {
+		return (v.sections == nil && v.fields == nil) || v.sections[key] || v.fields[key]
+	}
+	return v.fields == nil || v.fields[key]
+}
+
+// render converts coordinates, puts the document in the shape of the request's API version,
+// and drops the keys outside the view; the full view of the current version returns the
+// document unchanged
+func (v documentView) render(ctx context.Context, doc *OutputJSON) (interface{}, error) {
+	downgrade := needsDowngrade(ctx)
+	if v.sections == nil && v.fields == nil && !v.relative && !downgrade {
+		return doc, nil
+	}
+	var sizes map[int]pageSize
+	if v.relative {
+		var err error
+		if sizes, err = documentPageSizes(ctx, doc); err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	if v.relative {
+		relativizeDocument(m, sizes)
+	}
+	if downgrade {
+		downgradeDocument(ctx, m)
+	}
+	for key := range m {
+		if key != "coords" && !v.wants(key) {
+			delete(m, key)
+		}
+	}
+	return m, nil
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	gcs "cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+)
+
+// ---------- Google Cloud Storage ----------
+
+// GCS settings. Credentials come from Application Default Credentials (GOOGLE_APPLICATION_CREDENTIALS
+// or the workload's service account); presigned URLs need a service account that can sign.
+var (
+	gcsBucket = envString("GCS_BUCKET", "")
+	gcsPrefix = envString("GCS_PREFIX", "objects/")
+	// Uploads are sent in resumable chunks of this size
+	gcsChunkSize = envInt("GCS_CHUNK_SIZE_MB", 16)
+)
+
+type gcsStorage struct {
+	bucket *gcs.BucketHandle
+	prefix string
+}
+
+func newGCSStorage() (*gcsStorage, error) {
+	if gcsBucket == "" {
+		return nil, fmt.Errorf("GCS_BUCKET is not set")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	client, err := gcs.NewClient(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	bucket := client.Bucket(gcsBucket)
+	if _, err := bucket.Attrs(ctx); err != nil {
+		return nil, fmt.Errorf("checking bucket %s: %w", gcsBucket, err)
+	}
+	return &gcsStorage{bucket: bucket, prefix: gcsPrefix}, nil
+}
+
+func (s *gcsStorage) Put(key string, src io.Reader) error {
+	w := s.bucket.Object(s.prefix + key).NewWriter(context.Background())
+	w.ChunkSize = gcsChunkSize << 20
+	w.ContentType = mime.TypeByExtension(path.Ext(key))
+	if _, err := io.Copy(w, src); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+func (s *gcsStorage) Get(key string) (io.ReadCloser, error) {
+	r, err := s.bucket.Object(s.prefix + key).NewReader(context.Background())
+	if errors.Is(err, gcs.ErrObjectNotExist) {
+		return nil, fmt.Errorf("object %s: %w", key, fs.ErrNotExist)
+	}
+	return r, err
+}
+
+func (s *gcsStorage) Delete(key string) error {
+	err := s.bucket.Object(s.prefix + key).Delete(context.Background())
+	if errors.Is(err, gcs.ErrObjectNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (s *gcsStorage) List(prefix string) ([]string, error) {
+	var keys []string
+	it := s.bucket.Objects(context.Background(), &gcs.Query{Prefix: s.prefix + prefix})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			return keys, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, strings.TrimPrefix(attrs.Name, s.prefix))
+	}
+}
+
+func (s *gcsStorage) Exists(key string) (bool, error) {
+	_, err := s.bucket.Object(s.prefix + key).Attrs(context.Background())
+	if errors.Is(err, gcs.ErrObjectNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *gcsStorage) Usage() (int, int64, error) {
+	objects, bytes := 0, int64(0)
+	it := s.bucket.Objects(context.Background(), &gcs.Query{Prefix: s.prefix})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			return objects, bytes, nil
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+		objects++
+		bytes += attrs.Size
+	}
+}
+
+func (s *gcsStorage) ModTime(key string) (time.Time, error) {
+	attrs, err := s.bucket.Object(s.prefix + key).Attrs(context.Background())
+	if errors.Is(err, gcs.ErrObjectNotExist) {
+		return time.Time{}, fmt.Errorf("object %s: %w", key, fs.ErrNotExist)
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return attrs.Updated, nil
+}
+
+// PresignGet returns a V4 signed URL for the object
+func (s *gcsStorage) PresignGet(key, filename string, ttl time.Duration) (string, error) {
+	opts := &gcs.SignedURLOptions{
+		Scheme:  gcs.SigningSchemeV4,
+		Method:  http.MethodGet,
+		Expires: time.Now().Add(ttl),
+	}
+	if filename != "" {
+		opts.QueryParameters = url.Values{"response-content-disposition": {fmt.Sprintf("inline; filename=%q", filename)}}
+	}
+	return s.bucket.SignedURL(s.prefix+key, opts)
+}
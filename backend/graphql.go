@@ -0,0 +1,358 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// ---------- GraphQL ----------
+
+// /graphql answers read-only queries over documents, their graphs, and text annotations, so a
+// view can ask for exactly the fields it shows in one request. Lists take filters as arguments:
+//
+//	{ documents(project: "lab", limit: 20) { id imageFile graph(page: 1) { components(label: "R") { id bbox } } } }
+//
+// A document's metadata comes from the list query; pages, regions, the graph, and the text
+// annotations are each loaded only when selected.
+
+// graphqlMaxLimit caps documents(limit:)
+const graphqlMaxLimit = 1000
+
+// graphqlMaxBytes bounds a POSTed query
+const graphqlMaxBytes = 1 << 20
+
+// gqlDocument is the source object of a Document; sections load on first use
+type gqlDocument struct {
+	DocumentSummary
+	mu     sync.Mutex
+	loaded map[string]*OutputJSON // by section; "" holds metadata, pages, and regions
+}
+
+func (d *gqlDocument) load(p graphql.ResolveParams, section string) (*OutputJSON, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if doc, ok := d.loaded[section]; ok {
+		return doc, nil
+	}
+	view := documentView{sections: map[string]bool{}}
+	if section != "" {
+		view.sections[section] = true
+	}
+	doc, err := records.LoadDocument(p.Context, d.DocumentID, view)
+	if err != nil {
+		return nil, err
+	}
+	if d.loaded == nil {
+		d.loaded = map[string]*OutputJSON{}
+	}
+	d.loaded[section] = doc
+	return doc, nil
+}
+
+// docField resolves a Document field from the given section
+func docField(t graphql.Output, section string, args graphql.FieldConfigArgument, get func(*OutputJSON, map[string]interface{}) interface{}) *graphql.Field {
+	return &graphql.Field{Type: t, Args: args, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+		doc, err := p.Source.(*gqlDocument).load(p, section)
+		if err != nil {
+			return nil, err
+		}
+		return get(doc, p.Args), nil
+	}}
+}
+
+// pageArg filters a list to one page; annotations without a page are on page 1
+var pageArg = graphql.FieldConfigArgument{"page": &graphql.ArgumentConfig{Type: graphql.Int}}
+
+func onPage(args map[string]interface{}, page int) bool {
+	want, ok := args["page"].(int)
+	return !ok || want == max(page, 1)
+}
+
+// jsonScalar passes stored JSON (connection points) through as is
+var jsonScalar = graphql.NewScalar(graphql.ScalarConfig{
+	Name:         "JSON",
+	Description:  "Arbitrary JSON, as stored",
+	Serialize:    func(v interface{}) interface{} { return v },
+	ParseValue:   func(v interface{}) interface{} { return v },
+	ParseLiteral: func(ast.Value) interface{} { return nil },
+})
+
+var graphqlSchema = newGraphQLSchema()
+
+func newGraphQLSchema() graphql.Schema {
+	intList := graphql.NewList(graphql.Int)
+	stringList := graphql.NewList(graphql.String)
+
+	originType := graphql.NewObject(graphql.ObjectConfig{Name: "Origin", Fields: graphql.Fields{
+		"provenance":   &graphql.Field{Type: graphql.String},
+		"suggestionId": &graphql.Field{Type: graphql.String},
+		"modelName":    &graphql.Field{Type: graphql.String},
+		"modelVersion": &graphql.Field{Type: graphql.String},
+	}})
+	pageType := graphql.NewObject(graphql.ObjectConfig{Name: "Page", Fields: graphql.Fields{
+		"pageNumber": &graphql.Field{Type: graphql.Int},
+		"imageFile":  &graphql.Field{Type: graphql.String},
+		"width":      &graphql.Field{Type: graphql.Int},
+		"height":     &graphql.Field{Type: graphql.Int},
+		"sha256":     &graphql.Field{Type: graphql.String},
+	}})
+	regionType := graphql.NewObject(graphql.ObjectConfig{Name: "Region", Fields: graphql.Fields{
+		"id":    &graphql.Field{Type: graphql.ID},
+		"label": &graphql.Field{Type: graphql.String},
+		"bbox":  &graphql.Field{Type: intList},
+		"page":  &graphql.Field{Type: graphql.Int},
+	}})
+	componentType := graphql.NewObject(graphql.ObjectConfig{Name: "Component", Fields: graphql.Fields{
+		"id":       &graphql.Field{Type: graphql.ID},
+		"label":    &graphql.Field{Type: graphql.String},
+		"bbox":     &graphql.Field{Type: intList},
+		"page":     &graphql.Field{Type: graphql.Int},
+		"regionId": &graphql.Field{Type: graphql.String},
+		"origin":   &graphql.Field{Type: originType},
+	}})
+	nodeType := graphql.NewObject(graphql.ObjectConfig{Name: "Node", Fields: graphql.Fields{
+		"id":       &graphql.Field{Type: graphql.ID},
+		"position": &graphql.Field{Type: intList},
+		"page":     &graphql.Field{Type: graphql.Int},
+		"regionId": &graphql.Field{Type: graphql.String},
+		"origin":   &graphql.Field{Type: originType},
+	}})
+	connectionType := graphql.NewObject(graphql.ObjectConfig{Name: "Connection", Fields: graphql.Fields{
+		"id":       &graphql.Field{Type: graphql.ID},
+		"sourceId": &graphql.Field{Type: graphql.String},
+		"targetId": &graphql.Field{Type: graphql.String},
+		"type":     &graphql.Field{Type: graphql.String},
+		"points":   &graphql.Field{Type: jsonScalar},
+		"page":     &graphql.Field{Type: graphql.Int},
+		"regionId": &graphql.Field{Type: graphql.String},
+		"origin":   &graphql.Field{Type: originType},
+	}})
+	normalizedType := graphql.NewObject(graphql.ObjectConfig{Name: "NormalizedValue", Fields: graphql.Fields{
+		"value": &graphql.Field{Type: graphql.Float},
+		"unit":  &graphql.Field{Type: graphql.String},
+	}})
+	valueType := graphql.NewObject(graphql.ObjectConfig{Name: "Value", Fields: graphql.Fields{
+		"value":      &graphql.Field{Type: graphql.String},
+		"unitPrefix": &graphql.Field{Type: graphql.String},
+		"unitSuffix": &graphql.Field{Type: graphql.String},
+		"normalized": &graphql.Field{Type: normalizedType},
+	}})
+	textType := graphql.NewObject(graphql.ObjectConfig{Name: "TextAnnotation", Fields: graphql.Fields{
+		"id":        &graphql.Field{Type: graphql.ID},
+		"bbox":      &graphql.Field{Type: intList},
+		"rawText":   &graphql.Field{Type: graphql.String},
+		"isIgnored": &graphql.Field{Type: graphql.Boolean},
+		"linkedTo":  &graphql.Field{Type: graphql.String},
+		"labelName": &graphql.Field{Type: graphql.String},
+		"values":    &graphql.Field{Type: graphql.NewList(valueType)},
+		"page":      &graphql.Field{Type: graphql.Int},
+		"regionId":  &graphql.Field{Type: graphql.String},
+		"origin":    &graphql.Field{Type: originType},
+	}})
+
+	// graph(page:) hands its lists a Graph already narrowed to the page
+	graphType := graphql.NewObject(graphql.ObjectConfig{Name: "Graph", Fields: graphql.Fields{
+		"components": &graphql.Field{
+			Type: graphql.NewList(componentType),
+			Args: graphql.FieldConfigArgument{"label": &graphql.ArgumentConfig{Type: graphql.String}},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				label, _ := p.Args["label"].(string)
+				out := []Component{}
+				for _, c := range p.Source.(Graph).Components {
+					if label == "" || c.Label == label {
+						out = append(out, c)
+					}
+				}
+				return out, nil
+			},
+		},
+		"nodes": &graphql.Field{Type: graphql.NewList(nodeType), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return p.Source.(Graph).Nodes, nil
+		}},
+		"connections": &graphql.Field{
+			Type: graphql.NewList(connectionType),
+			Args: graphql.FieldConfigArgument{"type": &graphql.ArgumentConfig{Type: graphql.String}},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				typ, _ := p.Args["type"].(string)
+				out := []Connection{}
+				for _, c := range p.Source.(Graph).Connections {
+					if typ == "" || c.Type == typ {
+						out = append(out, c)
+					}
+				}
+				return out, nil
+			},
+		},
+	}})
+
+	summary := func(get func(*gqlDocument) interface{}) graphql.FieldResolveFn {
+		return func(p graphql.ResolveParams) (interface{}, error) { return get(p.Source.(*gqlDocument)), nil }
+	}
+	documentType := graphql.NewObject(graphql.ObjectConfig{Name: "Document", Fields: graphql.Fields{
+		"id":           &graphql.Field{Type: graphql.NewNonNull(graphql.ID), Resolve: summary(func(d *gqlDocument) interface{} { return d.DocumentID })},
+		"imageFile":    &graphql.Field{Type: graphql.String, Resolve: summary(func(d *gqlDocument) interface{} { return d.ImageFile })},
+		"drawingType":  &graphql.Field{Type: graphql.String, Resolve: summary(func(d *gqlDocument) interface{} { return d.DrawingType })},
+		"source":       &graphql.Field{Type: graphql.String, Resolve: summary(func(d *gqlDocument) interface{} { return d.Source })},
+		"project":      &graphql.Field{Type: graphql.String, Resolve: summary(func(d *gqlDocument) interface{} { return d.Project })},
+		"tags":         &graphql.Field{Type: stringList, Resolve: summary(func(d *gqlDocument) interface{} { return d.Tags })},
+		"createdAt":    &graphql.Field{Type: graphql.String, Resolve: summary(func(d *gqlDocument) interface{} { return d.CreatedAt })},
+		"split":        &graphql.Field{Type: graphql.String, Resolve: summary(func(d *gqlDocument) interface{} { return d.Split })},
+		"thumbnailUrl": &graphql.Field{Type: graphql.String, Resolve: summary(func(d *gqlDocument) interface{} { return d.Thumbnail })},
+
+		"width":     docField(graphql.Int, "", nil, func(d *OutputJSON, _ map[string]interface{}) interface{} { return d.Width }),
+		"height":    docField(graphql.Int, "", nil, func(d *OutputJSON, _ map[string]interface{}) interface{} { return d.Height }),
+		"sha256":    docField(graphql.String, "", nil, func(d *OutputJSON, _ map[string]interface{}) interface{} { return d.SHA256 }),
+		"sizeBytes": docField(graphql.Float, "", nil, func(d *OutputJSON, _ map[string]interface{}) interface{} { return d.SizeBytes }),
+		"numPages":  docField(graphql.Int, "", nil, func(d *OutputJSON, _ map[string]interface{}) interface{} { return d.NumPages }),
+		"notes":     docField(graphql.String, "", nil, func(d *OutputJSON, _ map[string]interface{}) interface{} { return d.Notes }),
+		"pages":     docField(graphql.NewList(pageType), "", nil, func(d *OutputJSON, _ map[string]interface{}) interface{} { return d.Pages }),
+		"regions": docField(graphql.NewList(regionType), "", pageArg, func(d *OutputJSON, args map[string]interface{}) interface{} {
+			out := []Region{}
+			for _, rg := range d.Regions {
+				if onPage(args, rg.Page) {
+					out = append(out, rg)
+				}
+			}
+			return out
+		}),
+		"graph": docField(graphType, "graph", pageArg, func(d *OutputJSON, args map[string]interface{}) interface{} {
+			g := Graph{Components: []Component{}, Nodes: []Node{}, Connections: []Connection{}}
+			for _, c := range d.Graph.Components {
+				if onPage(args, c.Page) {
+					g.Components = append(g.Components, c)
+				}
+			}
+			for _, n := range d.Graph.Nodes {
+				if onPage(args, n.Page) {
+					g.Nodes = append(g.Nodes, n)
+				}
+			}
+			for _, c := range d.Graph.Connections {
+				if onPage(args, c.Page) {
+					g.Connections = append(g.Connections, c)
+				}
+			}
+			return g
+		}),
+		"textAnnotations": docField(graphql.NewList(textType), "text_annotations", graphql.FieldConfigArgument{
+			"page":      &graphql.ArgumentConfig{Type: graphql.Int},
+			"labelName": &graphql.ArgumentConfig{Type: graphql.String},
+			"ignored":   &graphql.ArgumentConfig{Type: graphql.Boolean},
+		}, func(d *OutputJSON, args map[string]interface{}) interface{} {
+			label, _ := args["labelName"].(string)
+			ignored, filterIgnored := args["ignored"].(bool)
+			out := []TextAnnotation{}
+			for _, t := range d.TextAnnotations {
+				if onPage(args, t.Page) && (label == "" || t.LabelName == label) && (!filterIgnored || t.IsIgnored == ignored) {
+					out = append(out, t)
+				}
+			}
+			return out
+		}),
+	}})
+
+	queryType := graphql.NewObject(graphql.ObjectConfig{Name: "Query", Fields: graphql.Fields{
+		"document": &graphql.Field{
+			Type: documentType,
+			Args: graphql.FieldConfigArgument{"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)}},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				docs, err := records.ListDocuments(p.Context, documentFilter{DocumentID: p.Args["id"].(string)})
+				if err != nil || len(docs) == 0 {
+					return nil, err
+				}
+				return &gqlDocument{DocumentSummary: docs[0]}, nil
+			},
+		},
+		"documents": &graphql.Field{
+			Type:        graphql.NewList(documentType),
+			Description: "Documents newest first",
+			Args: graphql.FieldConfigArgument{
+				"project": &graphql.ArgumentConfig{Type: graphql.String},
+				"split":   &graphql.ArgumentConfig{Type: graphql.String},
+				"limit":   &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 100},
+				"offset":  &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 0},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				project, _ := p.Args["project"].(string)
+				split, _ := p.Args["split"].(string)
+				docs, err := records.ListDocuments(p.Context, documentFilter{Project: project, Split: split})
+				if err != nil {
+					return nil, err
+				}
+				offset := min(max(p.Args["offset"].(int), 0), len(docs))
+				limit := min(max(p.Args["limit"].(int), 0), graphqlMaxLimit)
+				docs = docs[offset:min(offset+limit, len(docs))]
+				out := make([]*gqlDocument, len(docs))
+				for i, d := range docs {
+					out[i] = &gqlDocument{DocumentSummary: d}
+				}
+				return out, nil
+			},
+		},
+	}})
+
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{Query: queryType})
+	if err != nil {
+		panic(err)
+	}
+	return schema
+}
+
+type graphqlRequest struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables"`
+	OperationName string                 `json:"operationName"`
+}
+
+// handleGraphQL runs a query sent as JSON (POST) or as ?query=&variables= (GET). Errors in the
+// query itself are reported in the body's errors list with status 200, as GraphQL clients expect.
+func handleGraphQL(w http.ResponseWriter, r *http.Request) {
+	var req graphqlRequest
+	switch r.Method {
+	case http.MethodGet:
+		var ok bool
+		if req, ok = graphqlQueryParams(w, r.URL.Query()); !ok {
+			return
+		}
+	case http.MethodPost:
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, graphqlMaxBytes)).Decode(&req); err != nil {
+			jsonError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+	default:
+		jsonError(w, http.StatusMethodNotAllowed, "GET or POST only")
+		return
+	}
+	runGraphQL(w, r, req)
+}
+
+func graphqlQueryParams(w http.ResponseWriter, q url.Values) (graphqlRequest, bool) {
+	req := graphqlRequest{Query: q.Get("query"), OperationName: q.Get("operationName")}
+	if v := q.Get("variables"); v != "" {
+		if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+			jsonError(w, http.StatusBadRequest, "variables must be a JSON object")
+			return req, false
+		}
+	}
+	return req, true
+}
+
+func runGraphQL(w http.ResponseWriter, r *http.Request, req graphqlRequest) {
+	if req.Query == "" {
+		jsonError(w, http.StatusBadRequest, "query is required")
+		return
+	}
+	result := graphql.Do(graphql.Params{
+		Schema:         graphqlSchema,
+		RequestString:  req.Query,
+		VariableValues: req.Variables,
+		OperationName:  req.OperationName,
+		Context:        withReplica(r.Context()),
+	})
+	jsonResponse(w, http.StatusOK, result)
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"corvina-backend/corvinapb"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// ---------- gRPC API ----------
+
+// GRPC_ADDR serves the typed read API defined in proto/corvina/v1 (empty turns it off).
+// grpc-gateway exposes the same methods as JSON under /v1/ on the HTTP port. It calls through
+// the gRPC server, so StreamDocuments works there too, as newline-delimited JSON.
+var grpcAddr = envString("GRPC_ADDR", ":9090")
+
+type grpcServer struct {
+	corvinapb.UnimplementedCorvinaServiceServer
+}
+
+func (grpcServer) GetDocument(ctx context.Context, req *corvinapb.GetDocumentRequest) (*corvinapb.Document, error) {
+	if req.GetDocumentId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "document_id is required")
+	}
+	view, err := grpcView(req.GetInclude())
+	if err != nil {
+		return nil, err
+	}
+	doc, err := records.LoadDocument(withReplica(ctx), req.GetDocumentId(), view)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	return documentProto(doc), nil
+}
+
+func (grpcServer) ListDocuments(ctx context.Context, req *corvinapb.ListDocumentsRequest) (*corvinapb.ListDocumentsResponse, error) {
+	docs, err := records.ListDocuments(withReplica(ctx), documentFilter{Project: req.GetProject(), Split: req.GetSplit()})
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	resp := &corvinapb.ListDocumentsResponse{Documents: make([]*corvinapb.DocumentSummary, len(docs))}
+	for i, d := range docs {
+		resp.Documents[i] = &corvinapb.DocumentSummary{
+			DocumentId: d.DocumentID, ImageFile: d.ImageFile, DrawingType: d.DrawingType, Source: d.Source,
+			Project: d.Project, Tags: d.Tags, CreatedAt: d.CreatedAt, Split: d.Split, ThumbnailUrl: d.Thumbnail,
+		}
+	}
+	return resp, nil
+}
+
+// StreamDocuments loads and sends one document at a time, so memory stays flat however many match
+func (grpcServer) StreamDocuments(req *corvinapb.StreamDocumentsRequest, stream grpc.ServerStreamingServer[corvinapb.Document]) error {
+	ctx := withReplica(stream.Context())
+	view, err := grpcView(req.GetInclude())
+	if err != nil {
+		return err
+	}
+	docs, err := records.ListDocuments(ctx, documentFilter{Project: req.GetProject(), Split: req.GetSplit()})
+	if err != nil {
+		return grpcError(ctx, err)
+	}
+	for _, d := range docs {
+		doc, err := records.LoadDocument(ctx, d.DocumentID, view)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue // deleted since it was listed
+		}
+		if err != nil {
+			return grpcError(ctx, err)
+		}
+		if err := stream.Send(documentProto(doc)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// grpcView turns an include list into a documentView, as ?include= does for GET /documents/{id}
+func grpcView(include []string) (documentView, error) {
+	if len(include) == 0 {
+		return documentView{}, nil
+	}
+	view, err := parseDocumentView(url.Values{"include": {strings.Join(include, ",")}})
+	if err != nil {
+		return view, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return view, nil
+}
+
+// grpcError maps a record store error to a status
+func grpcError(ctx context.Context, err error) error {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return status.Error(codes.NotFound, "document not found")
+	case errors.Is(err, errRequiresPostgres):
+		return status.Error(codes.Unimplemented, err.Error())
+	case dbUnreachable(err):
+		return status.Error(codes.Unavailable, dbUnavailableMessage)
+	case ctx.Err() != nil:
+		return status.FromContextError(ctx.Err()).Err()
+	}
+	slog.ErrorContext(ctx, "gRPC call failed", "error", err)
+	return status.Error(codes.Internal, "internal error")
+}
+
+const dbUnavailableMessage = "the database is unavailable"
+
+// ---------- Conversion ----------
+
+func documentProto(doc *OutputJSON) *corvinapb.Document {
+	out := &corvinapb.Document{
+		DocumentId: doc.DocumentID, ImageFile: doc.ImageFile, Width: int32(doc.Width), Height: int32(doc.Height),
+		Sha256: doc.SHA256, SizeBytes: doc.SizeBytes, NumPages: int32(doc.NumPages), Classification: doc.Classification,
+		Tags: doc.Tags, Notes: doc.Notes, Graph: &corvinapb.Graph{},
+	}
+	for _, p := range doc.Pages {
+		out.Pages = append(out.Pages, &corvinapb.Page{
+			PageNumber: int32(p.PageNumber), ImageFile: p.ImageFile, Width: int32(p.Width), Height: int32(p.Height), Sha256: p.SHA256,
+		})
+	}
+	for _, rg := range doc.Regions {
+		out.Regions = append(out.Regions, &corvinapb.Region{Id: rg.ID, Label: rg.Label, Bbox: int32s(rg.BBox), Page: int32(rg.Page)})
+	}
+	for _, c := range doc.Graph.Components {
+		out.Graph.Components = append(out.Graph.Components, &corvinapb.Component{
+			Id: c.ID, Label: c.Label, Bbox: int32s(c.BBox), Page: int32(c.Page), RegionId: c.RegionID, Origin: originProto(c.Origin),
+		})
+	}
+	for _, n := range doc.Graph.Nodes {
+		out.Graph.Nodes = append(out.Graph.Nodes, &corvinapb.Node{
+			Id: n.ID, Position: int32s(n.Position), Page: int32(n.Page), RegionId: n.RegionID, Origin: originProto(n.Origin),
+		})
+	}
+	for _, c := range doc.Graph.Connections {
+		conn := &corvinapb.Connection{
+			Id: c.ID, SourceId: c.SourceID, TargetId: c.TargetID, Type: c.Type, Page: int32(c.Page),
+			RegionId: c.RegionID, Origin: originProto(c.Origin),
+		}
+		if c.Points != nil {
+			conn.Points, _ = structpb.NewValue(c.Points)
+		}
+		out.Graph.Connections = append(out.Graph.Connections, conn)
+	}
+	for _, t := range doc.TextAnnotations {
+		ta := &corvinapb.TextAnnotation{
+			Id: t.ID, Bbox: int32s(t.BBox), RawText: t.RawText, IsIgnored: t.IsIgnored, LinkedTo: t.LinkedTo,
+			LabelName: t.LabelName, Page: int32(t.Page), RegionId: t.RegionID, Origin: originProto(t.Origin),
+		}
+		for _, v := range t.Values {
+			ta.Values = append(ta.Values, &corvinapb.Value{Value: v.Val, UnitPrefix: v.UnitPrefix, UnitSuffix: v.UnitSuffix})
+		}
+		out.TextAnnotations = append(out.TextAnnotations, ta)
+	}
+	return out
+}
+
+func originProto(o Origin) *corvinapb.Origin {
+	return &corvinapb.Origin{Provenance: o.Provenance, SuggestionId: o.SuggestionID, ModelName: o.ModelName, ModelVersion: o.ModelVersion}
+}
+
+func int32s(v []int) []int32 {
+	if v == nil {
+		return nil
+	}
+	out := make([]int32, len(v))
+	for i, x := range v {
+		out[i] = int32(x)
+	}
+	return out
+}
+
+// ---------- Server ----------
+
+// startGRPC listens on GRPC_ADDR, serves until ctx is cancelled, and returns the grpc-gateway
+// handler for /v1/
+func startGRPC(ctx context.Context) (http.Handler, error) {
+	lis, err := net.Listen("tcp", grpcAddr)
+	if err != nil {
+		return nil, err
+	}
+	srv := grpc.NewServer(
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.ChainUnaryInterceptor(grpcUnaryInterceptor),
+		grpc.ChainStreamInterceptor(grpcStreamInterceptor),
+	)
+	corvinapb.RegisterCorvinaServiceServer(srv, grpcServer{})
+	startWorker(ctx, func(ctx context.Context) {
+		go func() {
+			<-ctx.Done()
+			srv.GracefulStop()
+		}()
+		if err := srv.Serve(lis); err != nil {
+			slog.Error("gRPC server stopped", "error", err)
+		}
+	})
+
+	gw := runtime.NewServeMux(runtime.WithMarshalerOption(runtime.MIMEWildcard, &runtime.JSONPb{
+		MarshalOptions:   protojson.MarshalOptions{UseProtoNames: true},
+		UnmarshalOptions: protojson.UnmarshalOptions{DiscardUnknown: true},
+	}))
+	err = corvinapb.RegisterCorvinaServiceHandlerFromEndpoint(ctx, gw, dialAddr(lis.Addr()),
+		[]grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())})
+	if err != nil {
+		return nil, fmt.Errorf("grpc-gateway: %w", err)
+	}
+	slog.Info("gRPC API listening", "addr", lis.Addr().String())
+	return gw, nil
+}
+
+// dialAddr is a loopback address for a listener that may be bound to all interfaces
+func dialAddr(addr net.Addr) string {
+	tcp, ok := addr.(*net.TCPAddr)
+	if !ok || !tcp.IP.IsUnspecified() {
+		return addr.String()
+	}
+	return fmt.Sprintf("localhost:%d", tcp.Port)
+}
+
+// grpcAllow applies the database circuit breaker to a call. The returned func must be called
+// when the call finishes.
+func grpcAllow() (func(), error) {
+	ok, probe, retryAfter := dbBreaker.allow()
+	if !ok {
+		dbBreakerRejected.Inc()
+		return nil, status.Errorf(codes.Unavailable, "%s; retry after %s", dbUnavailableMessage, retryAfter.Round(time.Second))
+	}
+	if probe {
+		return dbBreaker.probeDone, nil
+	}
+	return func() {}, nil
+}
+
+// grpcUnaryInterceptor and grpcStreamInterceptor write an access log line per call, like
+// loggingMiddleware does for HTTP
+func grpcUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	done, err := grpcAllow()
+	var resp interface{}
+	if err == nil {
+		resp, err = handler(ctx, req)
+		done()
+	}
+	logGRPC(ctx, info.FullMethod, start, err)
+	return resp, err
+}
+
+func grpcStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	done, err := grpcAllow()
+	if err == nil {
+		err = handler(srv, ss)
+		done()
+	}
+	logGRPC(ss.Context(), info.FullMethod, start, err)
+	return err
+}
+
+func logGRPC(ctx context.Context, method string, start time.Time, err error) {
+	code := status.Code(err)
+	level := slog.LevelInfo
+	if code == codes.Internal || code == codes.Unavailable || code == codes.Unknown {
+		level = slog.LevelError
+	}
+	slog.LogAttrs(ctx, level, "gRPC call",
+		slog.String("method", method),
+		slog.String("code", code.String()),
+		slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+	)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ---------- Health Checks ----------
+
+// readyCheckTimeout bounds each readiness check so a hung dependency fails the probe instead of
+// stalling it
+var readyCheckTimeout = envDuration("READY_CHECK_TIMEOUT", 2*time.Second)
+
+// handleHealthz is the liveness probe: it only shows that the process is serving requests
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		jsonError(w, http.StatusMethodNotAllowed, "GET only")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// handleReadyz is the readiness probe: the database (and read replica, if configured) answers,
+// the object store is reachable, and the schema is in place. Each check is reported so a failing probe says what is wrong.
+func handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		jsonError(w, http.StatusMethodNotAllowed, "GET only")
+		return
+	}
+
+	checks := map[string]string{}
+	ready := true
+	for _, c := range []struct {
+		name string
+		fn   func(ctx context.Context) error
+	}{
+		{"database", records.Ping},
+		{"replica", func(ctx context.Context) error { return replicaPool.Ping(ctx) }},
+		{"storage", checkStorage},
+		{"schema", checkMigrations},
+	} {
+		if c.name == "replica" && replicaPool == pool || c.name == "schema" && dbDriver == "sqlite" {
+			continue
+		}
+		if err := runCheck(r.Context(), c.fn); err != nil {
+			checks[c.name] = err.Error()
+			ready = false
+		} else {
+			checks[c.name] = "ok"
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	status, state := http.StatusOK, "ready"
+	if !ready {
+		status, state = http.StatusServiceUnavailable, "unavailable"
+	}
+	jsonResponse(w, status, map[string]interface{}{"status": state, "checks": checks})
+}
+
+// runCheck runs fn with readyCheckTimeout. The storage clients don't all take a context, so the
+// check runs in its own goroutine and is abandoned when the time is up.
+func runCheck(parent context.Context, fn func(ctx context.Context) error) error {
+	ctx, cancel := context.WithTimeout(parent, readyCheckTimeout)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- fn(ctx) }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("timed out after %s", readyCheckTimeout)
+	}
+}
+
+// checkStorage looks up a key that never exists; a backend that can answer "no" is reachable
+// and accepting our credentials
+func checkStorage(ctx context.Context) error {
+	_, err := store.Exists(".readyz")
+	return err
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// ---------- Heartbeats ----------
+
+// While a document is open the frontend pings POST /documents/{id}/heartbeat?annotator= every
+// few seconds. Each ping holds the document's claim for the annotator and keeps their open
+// annotation session alive. When the pings stop (the tab is closed, the browser crashes) the
+// claim lapses after HEARTBEAT_TIMEOUT, and the lease sweeper releases it and ends the session
+// at its last heartbeat. Claim and heartbeat updates are not changes to the document and are kept
+// out of change_log, so /sync doesn't report documents that are merely open.
+
+// heartbeatTimeout is how long a claim or session survives without a heartbeat
+var heartbeatTimeout = envDuration("HEARTBEAT_TIMEOUT", 2*time.Minute)
+
+// leaseSweepInterval is how often lapsed claims and sessions are cleaned up
+var leaseSweepInterval = envDuration("LEASE_SWEEP_INTERVAL", time.Minute)
+
+type Heartbeat struct {
+	DocumentID string `json:"document_id"`
+	ClaimedBy  string `json:"claimed_by,omitempty"`
+	ClaimedAt  string `json:"claimed_at"`
+	ExpiresAt  string `json:"expires_at"`           // unless another heartbeat arrives
+	SessionID  string `json:"session_id,omitempty"` // the open session kept alive, if any
+}
+
+// handleHeartbeat takes or holds the claim on a document: POST /documents/{id}/heartbeat
+// Responds 409 while another annotator holds a live claim.
+func handleHeartbeat(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		jsonError(w, http.StatusMethodNotAllowed, "POST only")
+		return
+	}
+	docID := r.PathValue("id")
+	annotator := requestUser(r)
+
+	hb := Heartbeat{DocumentID: docID}
+	var claimedBy sql.NullString
+	var claimedAt, expiresAt time.Time
+	lapsed := claimLapsedSQL(2, 3)
+	err := db.QueryRowContext(r.Context(), `
+		UPDATE documents d SET
+			claimed_by = NULLIF($1, ''),
+			claimed_at = CASE WHEN `+lapsed+` OR d.claimed_by IS DISTINCT FROM NULLIF($1, '')
+				THEN now() ELSE d.claimed_at END,
+			heartbeat_at = now()
+		WHERE d.document_id = $4 AND (`+lapsed+` OR d.claimed_by IS NOT DISTINCT FROM NULLIF($1, ''))
+		RETURNING d.claimed_by, d.claimed_at, d.heartbeat_at + $3 * interval '1 second'`,
+		annotator, taskLease.Seconds(), heartbeatTimeout.Seconds(), docID).Scan(&claimedBy, &claimedAt, &expiresAt)
+	if err == sql.ErrNoRows {
+		var holder sql.NullString
+		err = db.QueryRowContext(r.Context(), "SELECT claimed_by FROM documents WHERE document_id = $1", docID).Scan(&holder)
+		if err == sql.ErrNoRows {
+			problemError(w, http.StatusNotFound, codeDocumentNotFound, "Document not found")
+			return
+		}
+		if err == nil {
+			jsonResponse(w, http.StatusConflict, map[string]string{
+				"error":      "Document is claimed by another annotator",
+				"claimed_by": holder.String,
+			})
+			return
+		}
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Heartbeat failed", "document_id", docID, "error", err)
+		jsonError(w, http.StatusInternalServerError, "Failed to record heartbeat")
+		return
+	}
+	hb.ClaimedBy = claimedBy.String
+	hb.ClaimedAt = claimedAt.UTC().Format(time.RFC3339)
+	hb.ExpiresAt = expiresAt.UTC().Format(time.RFC3339)
+
+	err = db.QueryRowContext(r.Context(), `
+		UPDATE annotation_sessions SET heartbeat_at = now()
+		WHERE id = (
+			SELECT id FROM annotation_sessions
+			WHERE document_id = $1 AND annotator IS NOT DISTINCT FROM NULLIF($2, '') AND ended_at IS NULL
+			ORDER BY started_at DESC LIMIT 1
+		)
+		RETURNING id`, docID, annotator).Scan(&hb.SessionID)
+	if err != nil && err != sql.ErrNoRows {
+		slog.WarnContext(r.Context(), "Session heartbeat failed", "document_id", docID, "error", err)
+	}
+	jsonResponse(w, http.StatusOK, hb)
+}
+
+// runLeaseSweeper releases lapsed claims and ends silent sessions until ctx is cancelled
+func runLeaseSweeper(ctx context.Context) {
+	ticker := time.NewTicker(leaseSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := sweepLeases(ctx); err != nil {
+			slog.Error("Lease sweep failed", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sweepLeases clears lapsed claims so the documents stop showing as in progress, and ends
+// sessions whose heartbeats stopped at their last heartbeat. Sessions from clients that never
+// sent one are left alone. Both updates are idempotent, so every instance may run them.
+func sweepLeases(ctx context.Context) error {
+	res, err := db.ExecContext(ctx, `
+		UPDATE documents d SET claimed_by = NULL, claimed_at = NULL, heartbeat_at = NULL
+		WHERE d.claimed_at IS NOT NULL AND `+claimLapsedSQL(1, 2), taskLease.Seconds(), heartbeatTimeout.Seconds())
+	if err != nil {
+		return err
+	}
+	released, _ := res.RowsAffected()
+
+	res, err = db.ExecContext(ctx, `
+		UPDATE annotation_sessions SET ended_at = heartbeat_at
+		WHERE ended_at IS NULL AND heartbeat_at < now() - $1 * interval '1 second'`, heartbeatTimeout.Seconds())
+	if err != nil {
+		return err
+	}
+	ended, _ := res.RowsAffected()
+
+	if released > 0 || ended > 0 {
+		slog.Info("Released lapsed leases", "claims", released, "sessions", ended)
+	}
+	return nil
+}
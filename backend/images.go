@@ -0,0 +1,410 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+)
+
+// ---------- Image Uploads ----------
+
+// uploadFormats maps accepted upload extensions to their format. PNGs are stored as-is, PDFs are
+// rasterized, and everything else is decoded and converted to PNG.
+var uploadFormats = map[string]string{
+	".png":  "png",
+	".pdf":  "pdf",
+	".jpg":  "jpeg",
+	".jpeg": "jpeg",
+	".tif":  "tiff",
+	".tiff": "tiff",
+	".webp": "webp",
+}
+
+const supportedUploadsMsg = "Only PNG, JPEG, TIFF, WebP, and PDF files are allowed"
+
+var errInvalidImage = errors.New("file is not a readable image")
+
+// errUnrecognizedUpload is returned when the content matches none of the supported formats
+var errUnrecognizedUpload = fmt.Errorf("%w: content is not a PNG, JPEG, TIFF, WebP, or PDF file", errInvalidImage)
+
+// Dimension limits checked from the image header before any pixels are decoded, so a small file
+// claiming an enormous canvas is rejected without allocating it
+var (
+	maxImageWidth  = envInt("MAX_IMAGE_WIDTH", 30000)
+	maxImageHeight = envInt("MAX_IMAGE_HEIGHT", 30000)
+	maxImagePixels = envInt("MAX_IMAGE_PIXELS", 200_000_000)
+)
+
+// sniffUploadExt identifies a supported format from the first bytes of a file and returns its
+// canonical extension, or "" when the content is not a supported format
+func sniffUploadExt(head []byte) string {
+	switch {
+	case bytes.HasPrefix(head, []byte("II*\x00")), bytes.HasPrefix(head, []byte("MM\x00*")):
+		return ".tiff"
+	}
+	switch http.DetectContentType(head) {
+	case "image/png":
+		return ".png"
+	case "image/jpeg":
+		return ".jpg"
+	case "image/webp":
+		return ".webp"
+	case "application/pdf":
+		return ".pdf"
+	}
+	return ""
+}
+
+// isUploadClientError reports errors caused by the uploaded content rather than the server
+func isUploadClientError(err error) bool {
+	return errors.Is(err, errInvalidImage) || errors.Is(err, errInvalidPDF) || errors.Is(err, errTooManyPDFPages) ||
+		errors.Is(err, errFileTooLarge)
+}
+
+// DOCUMENT_ID_MODE=filename names documents after the uploaded file (without extension), as
+// before ids were generated; uploads with the same name then replace each other
+var documentIDMode = envChoice("DOCUMENT_ID_MODE", "uuid", "uuid", "filename")
+
+// newDocumentID is the id of a document created from an upload named filename
+func newDocumentID(filename string) string {
+	if documentIDMode == "filename" {
+		return strings.TrimSuffix(filename, filepath.Ext(filename))
+	}
+	return newID()
+}
+
+// UploadOptions are the per-request settings of registerUpload
+type UploadOptions struct {
+	Uploader       string // annotator named on the request, "" for nobody in particular
+	QuotaUser      string // who the upload counts against for per-user quotas (quotaUser), "" for nobody
+	OriginalName   string // file name as uploaded; set by registerUpload
+	AllowDuplicate bool   // register content already in the project as a separate document
+	Overwrite      bool   // replace the file of an existing document, keeping the old one as a version
+	Supersedes     string // document this upload is a new version of
+}
+
+// DuplicateUploadError is returned by SaveDocument when the project already has a document with
+// the same content and the upload did not allow duplicates
+type DuplicateUploadError struct {
+	DocumentID string
+}
+
+func (e *DuplicateUploadError) Error() string {
+	return fmt.Sprintf("the same file was already uploaded as document %s", e.DocumentID)
+}
+
+// duplicateUploadError writes err as a problem response when it is a DuplicateUploadError
+func duplicateUploadError(w http.ResponseWriter, err error) bool {
+	var de *DuplicateUploadError
+	if !errors.As(err, &de) {
+		return false
+	}
+	writeProblem(w, Problem{
+		Status:     http.StatusConflict,
+		Code:       codeDuplicateUpload,
+		Detail:     de.Error() + "; pass allow_duplicate=true to register it again",
+		DocumentID: de.DocumentID,
+	})
+	return true
+}
+
+// registerUpload stores an upload of any supported format and registers its document. The format
+// is taken from the content's magic bytes; the filename extension is only used for naming.
+func registerUpload(ctx context.Context, docID, filename, project string, opts UploadOptions, src io.Reader) (*StoredDocument, error) {
+	if err := checkQuotas(ctx, docID, project, opts.QuotaUser); err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(src)
+	head, _ := br.Peek(512)
+	ext := sniffUploadExt(head)
+	if ext == "" {
+		return nil, errUnrecognizedUpload
+	}
+	opts.OriginalName = filename
+	// A mislabeled file is stored under the extension of what it actually is
+	if uploadFormats[strings.ToLower(filepath.Ext(filename))] != uploadFormats[ext] {
+		filename = strings.TrimSuffix(filename, filepath.Ext(filename)) + ext
+	}
+
+	var doc *StoredDocument
+	var err error
+	switch format := uploadFormats[ext]; format {
+	case "png":
+		doc, err = registerDocument(ctx, docID, filename, project, opts, br)
+	case "pdf":
+		doc, err = registerPDFDocument(ctx, docID, filename, project, opts, br)
+	default:
+		doc, err = registerConvertedDocument(ctx, docID, filename, format, project, opts, br)
+	}
+	if err != nil {
+		return nil, err
+	}
+	queueEmbedding(ctx, docID)
+	uploadBytes.WithLabelValues(doc.Format).Observe(float64(doc.Original.Size))
+	return doc, nil
+}
+
+// checkImageConfig enforces the configured dimension limits on a decoded image header
+func checkImageConfig(cfg image.Config) error {
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		return fmt.Errorf("%w: image has no pixels", errInvalidImage)
+	}
+	if cfg.Width > maxImageWidth || cfg.Height > maxImageHeight {
+		return fmt.Errorf("%w: image is %dx%d, larger than the %dx%d limit",
+			errInvalidImage, cfg.Width, cfg.Height, maxImageWidth, maxImageHeight)
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > int64(maxImagePixels) {
+		return fmt.Errorf("%w: image is %dx%d, more than %d pixels",
+			errInvalidImage, cfg.Width, cfg.Height, maxImagePixels)
+	}
+	return nil
+}
+
+// decodeImage checks the header against format and the dimension limits, then decodes the full
+// image so truncated or corrupt pixel data is caught at upload time
+func decodeImage(r io.ReadSeeker, format string) (image.Image, error) {
+	cfg, decoded, err := image.DecodeConfig(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidImage, err)
+	}
+	if decoded != format {
+		return nil, fmt.Errorf("%w: content is %s, not %s", errInvalidImage, decoded, format)
+	}
+	if err := checkImageConfig(cfg); err != nil {
+		return nil, err
+	}
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: corrupt %s data: %v", errInvalidImage, format, err)
+	}
+	return img, nil
+}
+
+// decodeImageFile decodes an image already in storage
+func decodeImageFile(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("decoding %s: %w", filepath.Base(path), err)
+	}
+	return img, nil
+}
+
+// spoolUpload copies an upload to a temporary file so it can be decoded and then stored without
+// holding the file in memory. The caller closes it with closeSpool.
+func spoolUpload(src io.Reader) (*os.File, error) {
+	f, err := os.CreateTemp("", "corvina-upload-*")
+	if err != nil {
+		return nil, fmt.Errorf("creating file: %w", err)
+	}
+	if _, err := io.Copy(f, src); err != nil {
+		closeSpool(f)
+		return nil, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		closeSpool(f)
+		return nil, err
+	}
+	return f, nil
+}
+
+func closeSpool(f *os.File) {
+	f.Close()
+	os.Remove(f.Name())
+}
+
+// jpegHeaderBytes is how much of a JPEG is searched for its EXIF block, which comes before the
+// image data and is at most 64 KiB
+const jpegHeaderBytes = 128 << 10
+
+// registerConvertedDocument decodes a JPEG/TIFF/WebP upload, applies EXIF orientation, and stores it
+// as <docID>.png alongside the original file, with the original name and format recorded on the document
+func registerConvertedDocument(ctx context.Context, docID, filename, format, project string, opts UploadOptions, src io.Reader) (*StoredDocument, error) {
+	f, err := spoolUpload(src)
+	if err != nil {
+		return nil, err
+	}
+	defer closeSpool(f)
+
+	img, err := decodeImage(f, format)
+	if err != nil {
+		return nil, err
+	}
+	if format == "jpeg" {
+		// Phone cameras store pixels sideways and rely on the EXIF tag for display
+		head := make([]byte, jpegHeaderBytes)
+		n, _ := io.ReadFull(io.NewSectionReader(f, 0, jpegHeaderBytes), head)
+		img = applyOrientation(img, jpegOrientation(head[:n]))
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("encoding png: %w", err)
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	original, err := storeObject(f, objectExt(format))
+	if err != nil {
+		return nil, err
+	}
+	converted, err := storeObject(&buf, ".png")
+	if err != nil {
+		return nil, err
+	}
+	thumb, err := makeThumbnail(img)
+	if err != nil {
+		return nil, err
+	}
+
+	b := img.Bounds()
+	doc := &StoredDocument{
+		DocumentID:    docID,
+		Project:       project,
+		UploadOptions: opts,
+		Filename:      filename,
+		Format:        format,
+		Original:      original,
+		Pages:         []PageInfo{{PageNumber: 1, ImageFile: docID + ".png", Width: b.Dx(), Height: b.Dy(), StoredObject: converted}},
+		PHash:         imagePHash(img),
+		Thumbnail:     thumb,
+	}
+	if err := records.SaveDocument(ctx, doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// ---------- EXIF Orientation ----------
+
+// jpegOrientation returns the EXIF orientation (1-8) of a JPEG, or 1 when absent
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return 1
+		}
+		marker := data[i+1]
+		if marker == 0xDA || marker == 0xD9 { // start of scan / end of image: no more metadata
+			return 1
+		}
+		size := int(binary.BigEndian.Uint16(data[i+2:]))
+		start, end := i+4, i+2+size
+		if size < 2 || end > len(data) {
+			return 1
+		}
+		if marker == 0xE1 && bytes.HasPrefix(data[start:end], []byte("Exif\x00\x00")) {
+			return exifOrientation(data[start+6 : end])
+		}
+		i = end
+	}
+	return 1
+}
+
+// exifOrientation reads tag 0x0112 from IFD0 of a TIFF-structured EXIF block
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd+2 > len(tiff) {
+		return 1
+	}
+	count := int(order.Uint16(tiff[ifd:]))
+	for n := 0; n < count; n++ {
+		entry := ifd + 2 + n*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			if v := int(order.Uint16(tiff[entry+8:])); v >= 1 && v <= 8 {
+				return v
+			}
+			return 1
+		}
+	}
+	return 1
+}
+
+// applyOrientation rotates/flips img so it displays upright for the given EXIF orientation
+func applyOrientation(src image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return src
+	}
+
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+
+	// Work on an RGBA copy so pixel access avoids the generic At/Set interface per pixel
+	in := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(in, in.Bounds(), src, b.Min, draw.Src)
+	out := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // mirror horizontal
+				dx, dy = w-1-x, y
+			case 3: // rotate 180
+				dx, dy = w-1-x, h-1-y
+			case 4: // mirror vertical
+				dx, dy = x, h-1-y
+			case 5: // transpose
+				dx, dy = y, x
+			case 6: // rotate 90 clockwise
+				dx, dy = h-1-y, x
+			case 7: // transverse
+				dx, dy = h-1-y, w-1-x
+			case 8: // rotate 90 counter-clockwise
+				dx, dy = y, w-1-x
+			}
+			si := in.PixOffset(x, y)
+			di := out.PixOffset(dx, dy)
+			copy(out.Pix[di:di+4], in.Pix[si:si+4])
+		}
+	}
+	return out
+}
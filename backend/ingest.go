@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ---------- Watched-Directory Ingestion ----------
+
+var (
+	// Empty disables the ingest worker
+	ingestDir      = envString("INGEST_DIR", "")
+	ingestInterval = envDuration("INGEST_INTERVAL", 10*time.Second)
+	ingestProject  = envString("INGEST_PROJECT", defaultProject)
+)
+
+// ingestFailedDir holds files that could not be ingested, each with a .error note beside it
+const ingestFailedDir = "failed"
+
+type fileState struct {
+	size    int64
+	modTime time.Time
+}
+
+// runIngestWorker polls ingestDir and registers new images as documents. A file is only picked up
+// once its size and mtime are unchanged across two polls, so scanners still writing are left alone.
+func runIngestWorker(ctx context.Context) {
+	if err := os.MkdirAll(filepath.Join(ingestDir, ingestFailedDir), 0755); err != nil {
+		slog.Error("Ingest disabled", "error", err)
+		return
+	}
+	slog.Info("Watching for new images", "dir", ingestDir, "interval", ingestInterval.String(), "project", ingestProject)
+
+	ticker := time.NewTicker(ingestInterval)
+	defer ticker.Stop()
+
+	pending := map[string]fileState{}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		pending = ingestPoll(ctx, pending)
+	}
+}
+
+// ingestPoll ingests stable files and returns the states to compare against on the next poll
+func ingestPoll(ctx context.Context, prev map[string]fileState) map[string]fileState {
+	entries, err := os.ReadDir(ingestDir)
+	if err != nil {
+		slog.Error("Ingest: cannot read directory", "dir", ingestDir, "error", err)
+		return prev
+	}
+
+	next := map[string]fileState{}
+	for _, e := range entries {
+		name := e.Name()
+		if !e.Type().IsRegular() || strings.HasPrefix(name, ".") {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+
+		state := fileState{size: info.Size(), modTime: info.ModTime()}
+		if last, ok := prev[name]; !ok || last != state {
+			next[name] = state // still changing (or first sighting); check again next poll
+			continue
+		}
+
+		path := filepath.Join(ingestDir, name)
+		if err := ingestFile(ctx, path, name); err != nil {
+			slog.Error("Ingest failed", "file", name, "error", err)
+			quarantineIngestFile(path, name, err)
+		}
+	}
+	return next
+}
+
+// ingestFile registers one file and removes it from the watched directory
+func ingestFile(ctx context.Context, path, name string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	docID := newDocumentID(name)
+	_, err = registerUpload(ctx, docID, name, ingestProject, UploadOptions{}, f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Ingested file", "file", name, "document_id", docID)
+	return os.Remove(path)
+}
+
+func quarantineIngestFile(path, name string, cause error) {
+	dst := filepath.Join(ingestDir, ingestFailedDir, name)
+	if err := os.Rename(path, dst); err != nil {
+		slog.Error("Ingest: cannot quarantine file", "file", name, "dir", ingestFailedDir, "error", err)
+		return
+	}
+	os.WriteFile(dst+".error", []byte(cause.Error()+"\n"), 0644)
+}
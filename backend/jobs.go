@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ---------- Job Subsystem ----------
+
+// jobHandler executes a queued job and returns a JSON-serializable result
+type jobHandler func(ctx context.Context, payload json.RawMessage) (interface{}, error)
+
+var jobHandlers = map[string]jobHandler{}
+
+// registerJobHandler makes a job kind runnable by the worker; call from init()
+func registerJobHandler(kind string, h jobHandler) {
+	jobHandlers[kind] = h
+}
+
+var jobPollInterval = envDuration("JOB_POLL_INTERVAL", 5*time.Second)
+
+// A job still running JOB_LEASE after it started is assumed to have lost its worker (a crash or a
+// killed instance) and is queued again, up to JOB_MAX_ATTEMPTS runs in all; then it is failed.
+// The lease must be longer than the slowest job.
+var (
+	jobLease       = envDuration("JOB_LEASE", 30*time.Minute)
+	jobMaxAttempts = envInt("JOB_MAX_ATTEMPTS", 3)
+)
+
+// rowQuerier is satisfied by both *sql.DB and *sql.Tx
+type rowQuerier interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// enqueueJob inserts a queued job, optionally inside an open transaction
+func enqueueJob(ctx context.Context, q rowQuerier, kind string, payload interface{}) (int64, error) {
+	if _, ok := jobHandlers[kind]; !ok {
+		return 0, fmt.Errorf("unknown job kind %q", kind)
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return 0, err
+	}
+	var id int64
+	err = q.QueryRowContext(ctx, "INSERT INTO jobs (kind, payload) VALUES ($1, $2) RETURNING id", kind, string(data)).Scan(&id)
+	return id, err
+}
+
+// runJobWorker claims and executes queued jobs until ctx is cancelled
+func runJobWorker(ctx context.Context) {
+	ticker := time.NewTicker(jobPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := reclaimStaleJobs(ctx); err != nil && ctx.Err() == nil {
+			slog.Error("Reclaiming stale jobs failed", "error", err)
+		}
+		// Drain everything that is ready before sleeping again
+		for ctx.Err() == nil && runNextJob(ctx) {
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// reclaimStaleJobs requeues running jobs whose lease has run out, or fails them once they have
+// used up their attempts
+func reclaimStaleJobs(ctx context.Context) error {
+	rows, err := db.QueryContext(ctx, `
+		UPDATE jobs SET
+			status = CASE WHEN attempts < $2 THEN 'queued' ELSE 'failed' END,
+			error = CASE WHEN attempts < $2 THEN error ELSE 'lease expired after ' || attempts || ' attempt(s)' END,
+			finished_at = CASE WHEN attempts < $2 THEN NULL ELSE now() END
+		WHERE status = 'running' AND started_at < now() - make_interval(secs => $1)
+		RETURNING id, kind, status`, jobLease.Seconds(), jobMaxAttempts)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var kind, status string
+		if err := rows.Scan(&id, &kind, &status); err != nil {
+			return err
+		}
+		if status == "failed" {
+			jobsFinished.WithLabelValues(kind, status).Inc()
+		}
+		slog.Warn("Reclaimed job whose lease expired", "job_id", id, "kind", kind, "status", status)
+	}
+	return rows.Err()
+}
+
+// runNextJob executes a single queued job; returns false when the queue is empty
+func runNextJob(ctx context.Context) bool {
+	var id int64
+	var kind string
+	var payload []byte
+	var attempt int
+	err := db.QueryRowContext(ctx, `
+		UPDATE jobs SET status = 'running', started_at = now(), attempts = attempts + 1
+		WHERE id = (
+			SELECT id FROM jobs WHERE status = 'queued'
+			ORDER BY id FOR UPDATE SKIP LOCKED LIMIT 1
+		)
+		RETURNING id, kind, payload, attempts
+	`).Scan(&id, &kind, &payload, &attempt)
+	if err == sql.ErrNoRows {
+		return false
+	}
+	if err != nil {
+		slog.Error("Job claim failed", "error", err)
+		return false
+	}
+
+	handler, ok := jobHandlers[kind]
+	if !ok {
+		finishJob(ctx, id, attempt, kind, nil, fmt.Errorf("no handler registered for job kind %q", kind))
+		return true
+	}
+
+	slog.Info("Job started", "job_id", id, "kind", kind)
+	start := time.Now()
+	// A job that has started is allowed to finish during shutdown rather than being failed halfway
+	result, err := handler(context.WithoutCancel(ctx), payload)
+	finishJob(ctx, id, attempt, kind, result, err)
+	jobDuration.WithLabelValues(kind).Observe(time.Since(start).Seconds())
+
+	if err != nil {
+		slog.Error("Job failed", "job_id", id, "kind", kind, "duration_ms", time.Since(start).Milliseconds(), "error", err)
+	} else {
+		slog.Info("Job finished", "job_id", id, "kind", kind, "duration_ms", time.Since(start).Milliseconds())
+	}
+	return true
+}
+
+// finishJob records the outcome of attempt of job id, unless the job was reclaimed meanwhile
+func finishJob(ctx context.Context, id int64, attempt int, kind string, result interface{}, jobErr error) {
+	// The outcome is recorded even when the worker is shutting down
+	ctx = context.WithoutCancel(ctx)
+	status, errMsg := "done", ""
+	if jobErr != nil {
+		status, errMsg = "failed", jobErr.Error()
+	}
+	jobsFinished.WithLabelValues(kind, status).Inc()
+	var resultJSON []byte
+	if result != nil {
+		resultJSON, _ = json.Marshal(result)
+	}
+	res, err := db.ExecContext(ctx,
+		"UPDATE jobs SET status = $1, result = $2, error = $3, finished_at = now() WHERE id = $4 AND attempts = $5 AND status = 'running'",
+		status, nullableJSON(resultJSON), errMsg, id, attempt,
+	)
+	if err != nil {
+		slog.Error("Recording job result failed", "job_id", id, "error", err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		slog.Warn("Job finished after its lease expired; result dropped", "job_id", id, "attempt", attempt)
+	}
+}
+
+// ---------- Job Endpoints ----------
+
+type Job struct {
+	ID         int64           `json:"id"`
+	Kind       string          `json:"kind"`
+	Status     string          `json:"status"`
+	Payload    json.RawMessage `json:"payload,omitempty"`
+	Result     json.RawMessage `json:"result,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	Attempts   int             `json:"attempts"`
+	CreatedAt  string          `json:"created_at"`
+	StartedAt  string          `json:"started_at,omitempty"`
+	FinishedAt string          `json:"finished_at,omitempty"`
+}
+
+const jobColumns = "id, kind, status, payload, result, error, attempts, created_at, started_at, finished_at"
+
+func scanJob(scan func(dest ...interface{}) error) (Job, error) {
+	var j Job
+	var payload, result []byte
+	var errMsg sql.NullString
+	var createdAt time.Time
+	var startedAt, finishedAt sql.NullTime
+	if err := scan(&j.ID, &j.Kind, &j.Status, &payload, &result, &errMsg, &j.Attempts, &createdAt, &startedAt, &finishedAt); err != nil {
+		return j, err
+	}
+	j.Payload = payload
+	j.Result = result
+	j.Error = errMsg.String
+	j.CreatedAt = createdAt.Format(time.RFC3339)
+	if startedAt.Valid {
+		j.StartedAt = startedAt.Time.Format(time.RFC3339)
+	}
+	if finishedAt.Valid {
+		j.FinishedAt = finishedAt.Time.Format(time.RFC3339)
+	}
+	return j, nil
+}
+
+func handleListJobs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		jsonError(w, http.StatusMethodNotAllowed, "GET only")
+		return
+	}
+
+	query := "SELECT " + jobColumns + " FROM jobs"
+	args := []interface{}{}
+	if status := r.URL.Query().Get("status"); status != "" {
+		query += " WHERE status = $1"
+		args = append(args, status)
+	}
+	query += " ORDER BY id DESC LIMIT 100"
+
+	rows, err := db.QueryContext(r.Context(), query, args...)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "Query failed")
+		return
+	}
+	defer rows.Close()
+
+	jobs := []Job{}
+	for rows.Next() {
+		j, err := scanJob(rows.Scan)
+		if err != nil {
+			continue
+		}
+		jobs = append(jobs, j)
+	}
+
+	jsonResponse(w, http.StatusOK, map[string]interface{}{
+		"jobs":  jobs,
+		"count": len(jobs),
+	})
+}
+
+func handleGetJob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		jsonError(w, http.StatusMethodNotAllowed, "GET only")
+		return
+	}
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "Invalid job id")
+		return
+	}
+
+	j, err := scanJob(db.QueryRowContext(r.Context(), "SELECT "+jobColumns+" FROM jobs WHERE id = $1", id).Scan)
+	if err != nil {
+		jsonError(w, http.StatusNotFound, "Job not found")
+		return
+	}
+	jsonResponse(w, http.StatusOK, j)
+}
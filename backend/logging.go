@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// ---------- Logging ----------
+
+// Logs are JSON lines on stdout (LOG_FORMAT=text for local development). The level starts at
+// LOG_LEVEL and can be changed while running with PUT /admin/log-level.
+var logLevel = new(slog.LevelVar)
+
+// baseLogger is set up during package initialization, so anything initialized after it can log
+var baseLogger = newLogger(envChoice("LOG_FORMAT", "json", "json", "text"), envString("LOG_LEVEL", ""))
+
+func init() {
+	slog.SetDefault(baseLogger)
+}
+
+func newLogger(format, level string) *slog.Logger {
+	if level != "" {
+		if err := logLevel.UnmarshalText([]byte(level)); err != nil {
+			config.invalid("LOG_LEVEL", level, "debug, info, warn, or error")
+		}
+	}
+	opts := &slog.HandlerOptions{Level: logLevel}
+	var h slog.Handler = slog.NewJSONHandler(os.Stdout, opts)
+	if strings.EqualFold(format, "text") {
+		h = slog.NewTextHandler(os.Stdout, opts)
+	}
+	return slog.New(contextHandler{h})
+}
+
+// fatal logs at error level and exits; slog has no Fatal
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// requestLog collects attributes for the request's access log line. Handlers add what they learn
+// while working (the document an upload created, say) with addLogAttrs.
+type requestLog struct {
+	attrs []slog.Attr
+}
+
+type requestLogKey struct{}
+
+func requestLogFrom(ctx context.Context) *requestLog {
+	rl, _ := ctx.Value(requestLogKey{}).(*requestLog)
+	return rl
+}
+
+// addLogAttrs attaches attributes to the access log line of the request ctx belongs to
+func addLogAttrs(ctx context.Context, attrs ...slog.Attr) {
+	if rl := requestLogFrom(ctx); rl != nil {
+		rl.attrs = append(rl.attrs, attrs...)
+	}
+}
+
+// contextHandler adds the request ID to records logged with a request context
+// (slog.InfoContext(r.Context(), ...)), so every line a request produces can be found together
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, rec slog.Record) error {
+	if id := requestIDFrom(ctx); id != "" {
+		rec.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, rec)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// requestUser is who a request acts for: the annotator the client names, if any. It is not
+// verified; quotas go by the API key instead (quotaUser).
+func requestUser(r *http.Request) string {
+	return r.URL.Query().Get("annotator")
+}
+
+// loggingMiddleware writes one access log line per request with its route, status, and latency.
+// It wraps the mux directly so r.Pattern and path values are filled in when the line is written.
+func loggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rl := &requestLog{}
+		r = r.WithContext(context.WithValue(r.Context(), requestLogKey{}, rl))
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.String("route", r.Pattern),
+			slog.Int("status", rec.status),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+		}
+		if id := r.PathValue("id"); id != "" && strings.Contains(r.Pattern, "/documents/{id}") {
+			attrs = append(attrs, slog.String("document_id", id))
+		}
+		if user := requestUser(r); user != "" {
+			attrs = append(attrs, slog.String("user", user))
+		}
+		attrs = append(attrs, rl.attrs...)
+
+		level := slog.LevelInfo
+		if rec.status >= 500 {
+			level = slog.LevelError
+		}
+		slog.LogAttrs(r.Context(), level, "Request", attrs...)
+	})
+}
+
+// handleLogLevel reports (GET) or changes (PUT {"level": "debug"}) the log level
+func handleLogLevel(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var req struct {
+			Level string `json:"level"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+		var lvl slog.Level
+		if err := lvl.UnmarshalText([]byte(req.Level)); err != nil {
+			jsonError(w, http.StatusBadRequest, "level must be debug, info, warn, or error")
+			return
+		}
+		logLevel.Set(lvl)
+		slog.InfoContext(r.Context(), "Log level changed", "level", lvl.String())
+	default:
+		jsonError(w, http.StatusMethodNotAllowed, "GET or PUT only")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]string{"level": logLevel.Level().String()})
+}
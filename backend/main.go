@@ -1,29 +1,63 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
-	"log"
+	"log/slog"
+	"mime/multipart"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
-	"path/filepath"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
-	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-const (
-	datasetDir = "dataset"
-	port       = ":5001"
+const defaultProject = "default"
+
+var (
+	// LISTEN_ADDR is host:port (or just a port); 127.0.0.1:5001 keeps the server off other
+	// interfaces. Instances sharing a host each need their own port and DATASET_DIR.
+	listenAddr = listenAddress(envString("LISTEN_ADDR", ":5001"))
+	// DATASET_DIR holds local objects, tiles, caches, and in-progress uploads
+	datasetDir = envString("DATASET_DIR", "dataset")
 )
 
+// listenAddress accepts "5001" as shorthand for ":5001"
+func listenAddress(v string) string {
+	if !strings.Contains(v, ":") {
+		v = ":" + v
+	}
+	if _, p, err := net.SplitHostPort(v); err != nil || p == "" {
+		config.invalid("LISTEN_ADDR", v, "host:port, :port, or a port number")
+	}
+	return v
+}
+
 // ---------- Global DB ----------
 
-var db *sql.DB
+// pool is the pgx connection pool (db.go); db is a database/sql view of it for the queries
+// written against that interface. Both share the same connections and limits. Reads that may
+// be served by a replica go through readPool/readDB (replica.go).
+var (
+	pool *pgxpool.Pool
+	db   *sql.DB
+)
 
 // ---------- JSON Types ----------
 
@@ -44,12 +78,32 @@ type RawAnnotation struct {
 	LabelName          string      `json:"label_name,omitempty"`
 	Values             []Value     `json:"values,omitempty"`
 	TranscriptionBox   []int       `json:"transcription_box,omitempty"`
+	Page               int         `json:"page,omitempty"`      // 1-based; defaults to 1
+	RegionID           string      `json:"region_id,omitempty"` // drawing on the page this belongs to
+	Origin
+}
+
+// Origin records where an annotation came from. It is sent back on GET so that a re-submission
+// from the frontend keeps the provenance of accepted machine suggestions.
+type Origin struct {
+	Provenance   string `json:"provenance,omitempty"`    // human (default) | model | ocr | import | auto | template
+	SuggestionID string `json:"suggestion_id,omitempty"` // suggestion the annotation was accepted from
+	ModelName    string `json:"model_name,omitempty"`    // model that produced the suggestion
+	ModelVersion string `json:"model_version,omitempty"`
+}
+
+const originColumns = "provenance, COALESCE(suggestion_id, ''), COALESCE(model_name, ''), COALESCE(model_version, '')"
+
+// dest returns scan destinations matching originColumns
+func (o *Origin) dest() []interface{} {
+	return []interface{}{&o.Provenance, &o.SuggestionID, &o.ModelName, &o.ModelVersion}
 }
 
 type Value struct {
-	Val        string `json:"value"`
-	UnitPrefix string `json:"unit_prefix"`
-	UnitSuffix string `json:"unit_suffix"`
+	Val        string           `json:"value"`
+	UnitPrefix string           `json:"unit_prefix"`
+	UnitSuffix string           `json:"unit_suffix"`
+	Normalized *NormalizedValue `json:"normalized,omitempty"` // set by the server; see units.go
 }
 
 type SubmitPayload struct {
@@ -62,14 +116,21 @@ type SubmitPayload struct {
 
 // Output types
 type Component struct {
-	ID    string `json:"id"`
-	Label string `json:"label"`
-	BBox  []int  `json:"bbox"`
+	ID        string `json:"id"`
+	Label     string `json:"label"`
+	BBox      []int  `json:"bbox"`
+	Page      int    `json:"page,omitempty"`
+	RegionID  string `json:"region_id,omitempty"`
+	CatalogID string `json:"catalog_id,omitempty"` // symbol catalog entry matching the label
+	Origin
 }
 
 type Node struct {
 	ID       string `json:"id"`
 	Position []int  `json:"position"`
+	Page     int    `json:"page,omitempty"`
+	RegionID string `json:"region_id,omitempty"`
+	Origin
 }
 
 type Connection struct {
@@ -78,6 +139,9 @@ type Connection struct {
 	TargetID string      `json:"target_id"`
 	Type     string      `json:"type,omitempty"`
 	Points   interface{} `json:"points,omitempty"`
+	Page     int         `json:"page,omitempty"`
+	RegionID string      `json:"region_id,omitempty"`
+	Origin
 }
 
 type Graph struct {
@@ -94,76 +158,29 @@ type TextAnnotation struct {
 	LinkedTo  string  `json:"linked_to,omitempty"`
 	LabelName string  `json:"label_name,omitempty"`
 	Values    []Value `json:"values,omitempty"`
+	Page      int     `json:"page,omitempty"`
+	RegionID  string  `json:"region_id,omitempty"`
+	Origin
 }
 
 type OutputJSON struct {
-	ImageFile       string            `json:"image_file"`
-	Classification  map[string]string `json:"classification"`
-	Graph           Graph             `json:"graph"`
-	TextAnnotations []TextAnnotation  `json:"text_annotations"`
-}
-
-// ---------- Database ----------
-
-func connectDB() *sql.DB {
-	dsn := os.Getenv("DATABASE_URL")
-	if dsn == "" {
-		log.Fatal("DATABASE_URL is not set")
-	}
-
-	var conn *sql.DB
-	var err error
-
-	// Retry loop — Postgres may take a few seconds to start in Docker
-	for i := 0; i < 30; i++ {
-		conn, err = sql.Open("pgx", dsn)
-		if err == nil {
-			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-			err = conn.PingContext(ctx)
-			cancel()
-			if err == nil {
-				log.Println("Connected to PostgreSQL")
-				conn.SetMaxOpenConns(10)
-				conn.SetMaxIdleConns(5)
-				conn.SetConnMaxLifetime(5 * time.Minute)
-				return conn
-			}
-		}
-		log.Printf("Waiting for PostgreSQL... (%d/30)", i+1)
-		time.Sleep(1 * time.Second)
-	}
-
-	log.Fatalf("Failed to connect to PostgreSQL after 30 attempts: %v", err)
-	return nil
-}
-
-// intArrayToPg converts an int slice to a PostgreSQL array literal
-func intArrayToPg(arr []int) string {
-	if len(arr) == 0 {
-		return "{}"
-	}
-	parts := make([]string, len(arr))
-	for i, v := range arr {
-		parts[i] = fmt.Sprintf("%d", v)
-	}
-	return "{" + strings.Join(parts, ",") + "}"
-}
-
-// ---------- CORS Middleware ----------
-
-func corsMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-
-		if r.Method == http.MethodOptions {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
-
-		next.ServeHTTP(w, r)
-	})
+	DocumentID       string            `json:"document_id,omitempty"`
+	ImageFile        string            `json:"image_file"`
+	OriginalFilename string            `json:"original_filename,omitempty"`
+	DisplayName      string            `json:"display_name,omitempty"`
+	Aliases          []string          `json:"aliases,omitempty"`
+	Width            int               `json:"width,omitempty"`
+	Height           int               `json:"height,omitempty"`
+	SHA256           string            `json:"sha256,omitempty"`
+	SizeBytes        int64             `json:"size_bytes,omitempty"`
+	NumPages         int               `json:"num_pages"`
+	Pages            []PageInfo        `json:"pages,omitempty"`
+	Classification   map[string]string `json:"classification"`
+	Tags             []string          `json:"tags,omitempty"`
+	Notes            string            `json:"notes,omitempty"`
+	Regions          []Region          `json:"regions,omitempty"`
+	Graph            Graph             `json:"graph"`
+	TextAnnotations  []TextAnnotation  `json:"text_annotations"`
 }
 
 // ---------- Response Helpers ----------
@@ -174,93 +191,430 @@ func jsonResponse(w http.ResponseWriter, status int, data interface{}) {
 	json.NewEncoder(w).Encode(data)
 }
 
+// jsonError writes a problem+json error whose code is derived from the status (see problems.go)
 func jsonError(w http.ResponseWriter, status int, msg string) {
-	jsonResponse(w, status, map[string]string{"error": msg})
+	problemError(w, status, "", msg)
 }
 
 // ---------- Handlers ----------
 
+// uploadMaxBytes caps a single /upload file. The file part is read straight from the request
+// into a temporary file, never held whole in memory or spooled by the multipart parser; only the
+// decoded image is.
+var uploadMaxBytes = int64(envInt("UPLOAD_MAX_MB", 32)) << 20
+
 func handleUpload(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		jsonError(w, http.StatusMethodNotAllowed, "POST only")
 		return
 	}
 
-	// 32 MB max
-	r.ParseMultipartForm(32 << 20)
-
-	file, header, err := r.FormFile("file")
+	limitRequestBody(w, r, uploadMaxBytes+multipartOverhead)
+	mr, err := r.MultipartReader()
 	if err != nil {
-		jsonError(w, http.StatusBadRequest, "No file part")
+		jsonError(w, http.StatusBadRequest, "Expected multipart form data")
 		return
 	}
+
+	// The file is registered while it streams in, so form fields must come before the file part.
+	// ?project= and the X-Content-SHA256 header work regardless of part order.
+	project := strings.TrimSpace(r.URL.Query().Get("project"))
+	checksum := r.Header.Get("X-Content-SHA256")
+	var file *multipart.Part
+	for file == nil {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			jsonError(w, http.StatusBadRequest, "No file part")
+			return
+		}
+		if isTooLarge(err) {
+			tooLargeError(w, "Request", uploadMaxBytes+multipartOverhead)
+			return
+		}
+		if err != nil {
+			jsonError(w, http.StatusBadRequest, "Malformed multipart body: "+err.Error())
+			return
+		}
+		switch {
+		case part.FormName() == "file":
+			file = part
+		case part.FormName() == "project" && part.FileName() == "":
+			v, _ := io.ReadAll(io.LimitReader(part, 1<<10))
+			if p := strings.TrimSpace(string(v)); p != "" {
+				project = p
+			}
+		case part.FormName() == "sha256" && part.FileName() == "":
+			v, _ := io.ReadAll(io.LimitReader(part, 1<<10))
+			if c := strings.TrimSpace(string(v)); c != "" {
+				checksum = c
+			}
+		}
+	}
 	defer file.Close()
 
-	filename := header.Filename
+	var src io.Reader = &limitedReader{r: file, remaining: uploadMaxBytes}
+	if checksum != "" {
+		want, err := hex.DecodeString(strings.TrimSpace(checksum))
+		if err != nil || len(want) != sha256.Size {
+			jsonError(w, http.StatusBadRequest, "X-Content-SHA256 must be a hex-encoded SHA-256 digest")
+			return
+		}
+		src = &checksumReader{r: src, h: sha256.New(), want: want}
+	}
+
+	filename := file.FileName()
 	if filename == "" {
 		jsonError(w, http.StatusBadRequest, "No selected file")
 		return
 	}
 
-	if !strings.HasSuffix(strings.ToLower(filename), ".png") {
-		jsonError(w, http.StatusBadRequest, "Only .png files are allowed")
+	q := r.URL.Query()
+	opts := UploadOptions{
+		Uploader:       requestUser(r),
+		QuotaUser:      quotaUser(r),
+		AllowDuplicate: queryFlag(q.Get("allow_duplicate")),
+		Overwrite:      queryFlag(q.Get("overwrite")),
+	}
+	newVersion := queryFlag(q.Get("new_version"))
+	if opts.Overwrite && newVersion {
+		jsonError(w, http.StatusBadRequest, "Pass overwrite or new_version, not both")
 		return
 	}
 
-	// doc_id = filename without extension
-	docID := strings.TrimSuffix(filename, filepath.Ext(filename))
+	// A new document gets a generated id. ?document_id= uploads into an existing one, which
+	// stays in its project; see versions.go for what overwrite and new_version do.
+	docID := q.Get("document_id")
+	if docID != "" {
+		existing, err := records.ListDocuments(r.Context(), documentFilter{DocumentID: docID})
+		if err != nil {
+			jsonError(w, http.StatusInternalServerError, "Failed to look up document")
+			return
+		}
+		if len(existing) == 0 {
+			problemError(w, http.StatusNotFound, codeDocumentNotFound, "Document not found")
+			return
+		}
+		project = existing[0].Project
+		switch {
+		case newVersion:
+			opts.Supersedes, docID = docID, newID()
+		case !opts.Overwrite:
+			// Refused before the file is read
+			documentExistsError(w, &DocumentExistsError{DocumentID: docID})
+			return
+		}
+	} else {
+		docID = newDocumentID(filename)
+	}
 
-	// Save to dataset directory (filesystem)
-	docDir := filepath.Join(datasetDir, docID)
-	os.MkdirAll(docDir, 0755)
+	if project == "" {
+		project = defaultProject
+	}
 
-	savePath := filepath.Join(docDir, filename)
-	dst, err := os.Create(savePath)
+	addLogAttrs(r.Context(), slog.String("document_id", docID), slog.String("project", project))
+	doc, err := registerUpload(r.Context(), docID, filename, project, opts, src)
 	if err != nil {
+		slog.ErrorContext(r.Context(), "Upload failed", "document_id", docID, "error", err)
+		if isTooLarge(err) {
+			tooLargeError(w, "File", uploadMaxBytes)
+			return
+		}
+		if errors.Is(err, errChecksumMismatch) {
+			problemError(w, http.StatusUnprocessableEntity, codeChecksumMismatch, err.Error())
+			return
+		}
+		if quotaExceededError(w, err) || duplicateUploadError(w, err) || documentExistsError(w, err) {
+			return
+		}
+		if isUploadClientError(err) {
+			problemError(w, http.StatusUnprocessableEntity, codeInvalidUpload, err.Error())
+			return
+		}
 		jsonError(w, http.StatusInternalServerError, "Failed to save file")
 		return
 	}
-	defer dst.Close()
 
-	io.Copy(dst, file)
+	jsonResponse(w, http.StatusOK, uploadResponse(r.Context(), doc))
+}
 
-	// Insert into PostgreSQL (upsert — handle re-uploads)
-	_, err = db.Exec(`
-		INSERT INTO documents (document_id, image_file, drawing_type, source)
-		VALUES ($1, $2, 'handwritten', 'notebook')
-		ON CONFLICT (document_id) DO UPDATE SET image_file = $2
-	`, docID, filename)
-	if err != nil {
-		log.Printf("DB insert error (document): %v", err)
-		// Non-fatal — file is already saved, log and continue
+var errChecksumMismatch = errors.New("content does not match X-Content-SHA256")
+
+// checksumReader hashes everything read through it and fails at EOF when the digest differs
+// from want. Every register path reads the whole upload before saving anything, so a
+// truncated or corrupted file is rejected before its document exists.
+type checksumReader struct {
+	r    io.Reader
+	h    hash.Hash
+	want []byte
+}
+
+func (c *checksumReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.h.Write(p[:n])
+	if err == io.EOF {
+		if got := c.h.Sum(nil); !bytes.Equal(got, c.want) {
+			return n, fmt.Errorf("%w: received %s", errChecksumMismatch, hex.EncodeToString(got))
+		}
 	}
+	return n, err
+}
 
-	jsonResponse(w, http.StatusOK, map[string]interface{}{
-		"status":      "success",
-		"document_id": docID,
-		"pdf_file":    filename,
-		"num_pages":   1,
-		"classification": map[string]string{
+// StoredDocument describes a stored upload as recorded by SaveDocument
+type StoredDocument struct {
+	DocumentID    string
+	Project       string
+	UploadOptions              // the uploader is kept from the first upload
+	Filename      string       // upload name, with the extension corrected to the real format
+	Format        string       // png | pdf | jpeg | tiff | webp
+	Original      StoredObject // the uploaded bytes
+	Pages         []PageInfo   // page images (the upload itself for PNGs)
+	PHash         uint64
+	Thumbnail     StoredObject
+}
+
+// UploadResponse is the body returned by all upload endpoints. Warning and Duplicates are set
+// when the image looks like one that was already uploaded.
+type UploadResponse struct {
+	Status         string              `json:"status"`
+	DocumentID     string              `json:"document_id"`
+	Project        string              `json:"project"`
+	OriginalFile   string              `json:"original_filename"`
+	PDFFile        string              `json:"pdf_file"`
+	SHA256         string              `json:"sha256"`
+	SizeBytes      int64               `json:"size_bytes"`
+	NumPages       int                 `json:"num_pages"`
+	Classification map[string]string   `json:"classification"`
+	Pages          []PageInfo          `json:"pages"`
+	SourceURL      string              `json:"source_url,omitempty"` // POST /upload/url only
+	Warning        string              `json:"warning,omitempty"`
+	Duplicates     []DuplicateDocument `json:"duplicates,omitempty"`
+}
+
+func uploadResponse(ctx context.Context, doc *StoredDocument) *UploadResponse {
+	resp := &UploadResponse{
+		Status:       "success",
+		DocumentID:   doc.DocumentID,
+		Project:      doc.Project,
+		OriginalFile: doc.OriginalName,
+		PDFFile:      doc.Filename,
+		SHA256:       doc.Original.SHA256,
+		SizeBytes:    doc.Original.Size,
+		NumPages:     len(doc.Pages),
+		Classification: map[string]string{
 			"type":   "handwritten",
 			"domain": "notebook",
 		},
-		"pages": []map[string]interface{}{
-			{"page_number": 1, "image_file": filename},
-		},
+		Pages: doc.Pages,
+	}
+
+	if dups, err := records.FindDuplicates(ctx, doc.DocumentID, phashMaxDistance); err != nil {
+		slog.Error("Duplicate check failed", "document_id", doc.DocumentID, "error", err)
+	} else if len(dups) > 0 {
+		resp.Warning = duplicateWarning(dups)
+		resp.Duplicates = dups
+	}
+	return resp
+}
+
+// registerDocument stores a PNG and saves its documents row (see SaveDocument for re-uploads).
+// The PNG is fully decoded before anything is written so corrupt files never reach the store.
+func registerDocument(ctx context.Context, docID, filename, project string, opts UploadOptions, src io.Reader) (*StoredDocument, error) {
+	f, err := spoolUpload(src)
+	if err != nil {
+		return nil, err
+	}
+	defer closeSpool(f)
+	img, err := decodeImage(f, "png")
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	obj, err := storeObject(f, ".png")
+	if err != nil {
+		return nil, err
+	}
+	thumb, err := makeThumbnail(img)
+	if err != nil {
+		return nil, err
+	}
+
+	b := img.Bounds()
+	doc := &StoredDocument{
+		DocumentID:    docID,
+		Project:       project,
+		UploadOptions: opts,
+		Filename:      filename,
+		Format:        "png",
+		Original:      obj,
+		Pages:         []PageInfo{{PageNumber: 1, ImageFile: docID + ".png", Width: b.Dx(), Height: b.Dy(), StoredObject: obj}},
+		PHash:         imagePHash(img),
+		Thumbnail:     thumb,
+	}
+	if err := records.SaveDocument(ctx, doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// SaveDocument inserts the documents row and its pages in one transaction, recording a
+// document.created event. An existing document fails with a DocumentExistsError unless the upload
+// overwrites it, in which case its previous file is recorded as a version. Unless the upload
+// allows duplicates, it fails with a DuplicateUploadError when another document of the project
+// has the same content.
+func (postgresRecords) SaveDocument(ctx context.Context, doc *StoredDocument) error {
+	// pdf_file holds the original upload name when the stored image was derived from it (PDF, JPEG, ...)
+	var originalFile string
+	if doc.Format != "png" {
+		originalFile = doc.Filename
+	}
+	first := doc.Pages[0]
+
+	return inTx(ctx, "upload", func(tx pgx.Tx) error {
+		var currentSHA string
+		err := tx.QueryRow(ctx, "SELECT COALESCE(sha256, '') FROM documents WHERE document_id = $1 FOR UPDATE", doc.DocumentID).Scan(&currentSHA)
+		exists := err == nil
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("looking up document: %w", err)
+		}
+		if exists && !doc.Overwrite {
+			return &DocumentExistsError{DocumentID: doc.DocumentID}
+		}
+
+		if !doc.AllowDuplicate {
+			var existing string
+			err := tx.QueryRow(ctx, "SELECT document_id FROM documents WHERE project = $1 AND sha256 = $2 AND document_id <> $3 LIMIT 1",
+				doc.Project, doc.Original.SHA256, doc.DocumentID).Scan(&existing)
+			if err == nil {
+				return &DuplicateUploadError{DocumentID: existing}
+			}
+			if !errors.Is(err, pgx.ErrNoRows) {
+				return fmt.Errorf("checking for duplicates: %w", err)
+			}
+		}
+
+		// Only an overwrite keeps the replaced file; re-uploading the same bytes replaces nothing
+		var version int
+		if exists && currentSHA != doc.Original.SHA256 {
+			if version, err = recordVersion(ctx, tx, doc.DocumentID, doc.Uploader); err != nil {
+				return fmt.Errorf("recording version: %w", err)
+			}
+		}
+
+		// xmax is 0 only on a fresh insert; a conflict the lookup above did not see is a
+		// concurrent upload of the same document
+		var inserted bool
+		err = tx.QueryRow(ctx, `
+			INSERT INTO documents (document_id, image_file, drawing_type, source, project, pdf_file, original_format, num_pages,
+				width, height, phash, sha256, size_bytes, storage_key, thumbnail_key, uploaded_by, original_filename, supersedes, quota_user)
+			VALUES ($1, $2, 'handwritten', 'notebook', $3, NULLIF($4, ''), $5, $6, NULLIF($7, 0), NULLIF($8, 0), $9, $10, $11, $12, NULLIF($13, ''),
+				NULLIF($14, ''), NULLIF($15, ''), NULLIF($16, ''), NULLIF($17, ''))
+			ON CONFLICT (document_id) DO UPDATE SET image_file = $2, pdf_file = NULLIF($4, ''), original_format = $5, num_pages = $6,
+				width = NULLIF($7, 0), height = NULLIF($8, 0), phash = $9, sha256 = $10, size_bytes = $11, storage_key = $12,
+				thumbnail_key = NULLIF($13, ''), original_filename = NULLIF($15, '')
+			RETURNING xmax = 0
+		`, doc.DocumentID, first.ImageFile, doc.Project, originalFile, doc.Format, len(doc.Pages), first.Width, first.Height,
+			int64(doc.PHash), doc.Original.SHA256, doc.Original.Size, doc.Original.Key, doc.Thumbnail.Key, doc.Uploader,
+			doc.OriginalName, doc.Supersedes, doc.QuotaUser).Scan(&inserted)
+		if err != nil {
+			return fmt.Errorf("inserting document: %w", err)
+		}
+		if inserted == exists {
+			return &DocumentExistsError{DocumentID: doc.DocumentID}
+		}
+
+		if _, err := tx.Exec(ctx, "DELETE FROM pages WHERE document_id = $1", doc.DocumentID); err != nil {
+			return fmt.Errorf("clearing pages: %w", err)
+		}
+		for _, p := range doc.Pages {
+			_, err := tx.Exec(ctx,
+				"INSERT INTO pages (document_id, page_number, image_file, width, height, storage_key, sha256) VALUES ($1, $2, $3, $4, $5, $6, $7)",
+				doc.DocumentID, p.PageNumber, p.ImageFile, p.Width, p.Height, p.Key, p.SHA256,
+			)
+			if err != nil {
+				return fmt.Errorf("inserting page %d: %w", p.PageNumber, err)
+			}
+		}
+
+		if !inserted {
+			if version == 0 {
+				return nil
+			}
+			return enqueueEvents(ctx, tx, newEvent("document.overwritten", doc.DocumentID, map[string]interface{}{
+				"version": version, "previous_sha256": currentSHA, "sha256": doc.Original.SHA256, "uploaded_by": doc.Uploader,
+			}))
+		}
+		if doc.Supersedes != "" {
+			if err := supersede(ctx, tx, doc.Supersedes, doc); err != nil {
+				return err
+			}
+		}
+		return enqueueEvents(ctx, tx, newEvent("document.created", doc.DocumentID, map[string]interface{}{
+			"project": doc.Project, "image_file": first.ImageFile, "original_filename": doc.OriginalName,
+			"num_pages": len(doc.Pages), "sha256": doc.Original.SHA256,
+		}))
 	})
 }
 
+// Limits on a single /submit so a broken client can't tie up the server with one request
+var (
+	submitMaxBytes       = int64(envInt("SUBMIT_MAX_MB", 8)) << 20
+	submitMaxAnnotations = envInt("SUBMIT_MAX_ANNOTATIONS", 20000)
+)
+
+// decodeSubmitPayload reads a submission strictly: unknown fields and trailing data are errors
+// rather than being dropped, since they usually mean the client and server disagree on the format
+func decodeSubmitPayload(w http.ResponseWriter, r *http.Request) (SubmitPayload, bool) {
+	var payload SubmitPayload
+	limitRequestBody(w, r, submitMaxBytes)
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&payload)
+	if err == nil && dec.Decode(&struct{}{}) != io.EOF {
+		err = errors.New("unexpected data after the JSON object")
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case err == nil:
+	case isTooLarge(err):
+		tooLargeError(w, "Submission", submitMaxBytes)
+		return payload, false
+	case errors.As(err, &typeErr):
+		problemError(w, http.StatusUnprocessableEntity, codeSchemaViolation, "Invalid submission: "+strings.TrimPrefix(err.Error(), "json: "),
+			FieldError{Field: typeErr.Field, Message: "must be " + typeErr.Type.String() + ", not " + typeErr.Value})
+		return payload, false
+	case strings.HasPrefix(err.Error(), "json: unknown field"):
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		problemError(w, http.StatusUnprocessableEntity, codeSchemaViolation, "Invalid submission: "+strings.TrimPrefix(err.Error(), "json: "),
+			FieldError{Field: field, Message: "is not a known field"})
+		return payload, false
+	default:
+		problemError(w, http.StatusBadRequest, codeSchemaViolation, "Invalid JSON: "+err.Error())
+		return payload, false
+	}
+
+	if len(payload.Annotations) > submitMaxAnnotations {
+		problemError(w, http.StatusUnprocessableEntity, codeTooManyAnnotations, fmt.Sprintf("Submission has %d annotations; the limit is %d",
+			len(payload.Annotations), submitMaxAnnotations))
+		return payload, false
+	}
+	return payload, true
+}
+
 func handleSubmit(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		jsonError(w, http.StatusMethodNotAllowed, "POST only")
 		return
 	}
 
-	var payload SubmitPayload
-	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		jsonError(w, http.StatusBadRequest, "Invalid JSON")
+	payload, ok := decodeSubmitPayload(w, r)
+	if !ok {
 		return
 	}
+	addLogAttrs(r.Context(), slog.String("document_id", payload.DocumentID))
 
 	if payload.DocumentID == "" {
 		jsonError(w, http.StatusBadRequest, "Missing document_id")
@@ -268,10 +622,74 @@ func handleSubmit(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Verify document exists in DB
-	var exists bool
-	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM documents WHERE document_id = $1)", payload.DocumentID).Scan(&exists)
-	if err != nil || !exists {
-		jsonError(w, http.StatusNotFound, fmt.Sprintf("Document %s not found. Please upload again.", payload.DocumentID))
+	numPages, err := records.PageCount(r.Context(), payload.DocumentID)
+	if err != nil {
+		problemError(w, http.StatusNotFound, codeDocumentNotFound, fmt.Sprintf("Document %s not found. Please upload again.", payload.DocumentID))
+		return
+	}
+
+	clamp, err := boundsModeFromQuery(r.URL.Query().Get("out_of_bounds"))
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	tolerance, err := simplifyToleranceFromQuery(r.URL.Query().Get("simplify"))
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	overlapIoU, err := overlapThresholdFromQuery(r.URL.Query().Get("overlap_iou"))
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	sizes, err := records.PageSizes(r.Context(), payload.DocumentID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "Failed to load page sizes")
+		return
+	}
+
+	// Opt-in: give endpoint-less lines real nodes before validation so the new nodes are checked too
+	nAutoNodes := 0
+	if queryFlag(r.URL.Query().Get("auto_nodes")) {
+		nAutoNodes = addEndpointNodes(&payload)
+	}
+
+	for i := range payload.Annotations {
+		ann := &payload.Annotations[i]
+		if ann.Page == 0 {
+			ann.Page = 1
+		}
+		if ann.Provenance == "" {
+			ann.Provenance = "human"
+		}
+	}
+	invalid := validateAnnotations(payload.Annotations, numPages, clamp)
+
+	// Bounds are only checked once every annotation is well-formed
+	nClamped := 0
+	if len(invalid) == 0 {
+		for i := range payload.Annotations {
+			ann := &payload.Annotations[i]
+			size, ok := sizes[ann.Page]
+			if !ok {
+				continue
+			}
+			n, err := checkAnnotationBounds(ann, size, clamp)
+			if err != nil {
+				invalid = append(invalid, *err)
+				continue
+			}
+			nClamped += n
+		}
+	}
+	if len(invalid) > 0 {
+		problemError(w, http.StatusUnprocessableEntity, codeInvalidAnnotations,
+			fmt.Sprintf("%d problem(s) with the submitted annotations", len(invalid)), invalid...)
+		return
+	}
+	if err := checkRegionRefs(payload.Annotations); err != nil {
+		problemError(w, http.StatusBadRequest, codeInvalidRegion, err.Error())
 		return
 	}
 
@@ -280,97 +698,202 @@ func handleSubmit(w http.ResponseWriter, r *http.Request) {
 		drawingType := payload.Classification["type"]
 		source := payload.Classification["domain"]
 		if drawingType != "" || source != "" {
-			db.Exec("UPDATE documents SET drawing_type = $1, source = $2 WHERE document_id = $3",
-				drawingType, source, payload.DocumentID)
+			records.SetClassification(r.Context(), payload.DocumentID, drawingType, source)
 		}
 	}
 
-	// Begin transaction for all annotation data
-	ctx := context.Background()
-	tx, err := db.BeginTx(ctx, nil)
-	if err != nil {
-		jsonError(w, http.StatusInternalServerError, "Failed to begin transaction")
-		return
-	}
-	defer tx.Rollback() // no-op if committed
-
-	// Clear previous annotations for this document (supports re-submission)
-	tx.Exec("DELETE FROM components WHERE document_id = $1", payload.DocumentID)
-	tx.Exec("DELETE FROM nodes WHERE document_id = $1", payload.DocumentID)
-	tx.Exec("DELETE FROM connections WHERE document_id = $1", payload.DocumentID)
-	tx.Exec("DELETE FROM text_annotations WHERE document_id = $1", payload.DocumentID)
+	// Duplicate boxes and values that don't parse are saved anyway but reported back so the
+	// annotator can fix them
+	warnings := append(submittedOverlaps(payload.Annotations, overlapIoU), submittedValueIssues(payload.Annotations)...)
 
-	// Counters for logging
-	var nComponents, nNodes, nConnections, nText int
+	// Rows are gathered per table and written in one go by ReplaceAnnotations
+	var regionRows, componentRows, nodeRows, connectionRows, textRows [][]interface{}
+	nSimplified := 0
 
 	for i := range payload.Annotations {
 		ann := &payload.Annotations[i]
+		prov := []interface{}{ann.Provenance, nullIfEmpty(ann.SuggestionID), nullIfEmpty(ann.ModelName),
+			nullIfEmpty(ann.ModelVersion), nullIfEmpty(ann.RegionID)}
 
 		switch ann.Type {
+		case "region":
+			regionRows = append(regionRows, []interface{}{ann.ID, payload.DocumentID, ann.Label, ann.BBox, ann.Page})
+
 		case "box":
-			_, err = tx.Exec(
-				"INSERT INTO components (id, document_id, label, bbox) VALUES ($1, $2, $3, $4)",
-				ann.ID, payload.DocumentID, ann.Label, intArrayToPg(ann.BBox),
-			)
-			nComponents++
+			componentRows = append(componentRows, append([]interface{}{
+				ann.ID, payload.DocumentID, ann.Label, ann.BBox, ann.Page}, prov...))
 
 		case "node":
-			_, err = tx.Exec(
-				"INSERT INTO nodes (id, document_id, position) VALUES ($1, $2, $3)",
-				ann.ID, payload.DocumentID, intArrayToPg(ann.Position),
-			)
-			nNodes++
+			nodeRows = append(nodeRows, append([]interface{}{
+				ann.ID, payload.DocumentID, ann.Position, ann.Page}, prov...))
 
 		case "connection":
-			_, err = tx.Exec(
-				"INSERT INTO connections (id, document_id, source_id, target_id) VALUES ($1, $2, $3, $4)",
-				ann.ID, payload.DocumentID, ann.SourceID, ann.TargetID,
-			)
-			nConnections++
+			connectionRows = append(connectionRows, append([]interface{}{
+				ann.ID, payload.DocumentID, ann.SourceID, ann.TargetID, nil, nil, nil, ann.Page}, prov...))
 
 		case "line":
-			pointsJSON, _ := json.Marshal(ann.Points)
-			_, err = tx.Exec(
-				"INSERT INTO connections (id, document_id, source_id, target_id, type, points) VALUES ($1, $2, $3, $4, $5, $6)",
-				ann.ID, payload.DocumentID, ann.SourceID, ann.TargetID, "line", string(pointsJSON),
-			)
-			nConnections++
+			// Points bind straight to the JSONB columns; nil leaves points_original NULL
+			points := ann.Points
+			var original interface{}
+			if tolerance > 0 {
+				if simplified, changed := simplifyPolyline(ann.Points, tolerance); changed {
+					if simplifyKeepOriginal {
+						original = ann.Points
+					}
+					points = simplified
+					nSimplified++
+				}
+			}
+			connectionRows = append(connectionRows, append([]interface{}{
+				ann.ID, payload.DocumentID, ann.SourceID, ann.TargetID, "line", points, original, ann.Page}, prov...))
 
 		case "text":
-			var valuesJSON []byte
+			var values interface{}
 			if len(ann.Values) > 0 {
-				valuesJSON, _ = json.Marshal(ann.Values)
+				normalizeValues(ann.Values)
+				values = ann.Values
 			}
-			_, err = tx.Exec(
-				"INSERT INTO text_annotations (id, document_id, bbox, raw_text, is_ignored, linked_to, label_name, values) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)",
-				ann.ID, payload.DocumentID, intArrayToPg(ann.BBox), ann.RawText, ann.IsIgnored,
-				ann.LinkedAnnotationID, ann.LabelName, nullableJSON(valuesJSON),
-			)
-			nText++
+			textRows = append(textRows, append([]interface{}{
+				ann.ID, payload.DocumentID, ann.BBox, ann.RawText, ann.IsIgnored,
+				ann.LinkedAnnotationID, ann.LabelName, values, ann.Page}, prov...))
 		}
+	}
 
-		if err != nil {
-			log.Printf("Insert error for annotation %s: %v", ann.ID, err)
-			tx.Rollback()
-			jsonError(w, http.StatusInternalServerError, "Failed to save annotation: "+err.Error())
-			return
-		}
+	provColumns := []string{"provenance", "suggestion_id", "model_name", "model_version", "region_id"}
+	tables := []annotationTable{
+		{"regions", []string{"id", "document_id", "label", "bbox", "page_number"}, regionRows},
+		{"components", append([]string{"id", "document_id", "label", "bbox", "page_number"}, provColumns...), componentRows},
+		{"nodes", append([]string{"id", "document_id", "position", "page_number"}, provColumns...), nodeRows},
+		{"connections", append([]string{"id", "document_id", "source_id", "target_id", "type", "points", "points_original", "page_number"}, provColumns...), connectionRows},
+		{"text_annotations", append([]string{"id", "document_id", "bbox", "raw_text", "is_ignored", "linked_to", "label_name", "values", "page_number"}, provColumns...), textRows},
 	}
 
-	if err := tx.Commit(); err != nil {
-		jsonError(w, http.StatusInternalServerError, "Failed to commit transaction")
+	submitted := newEvent("annotations.submitted", payload.DocumentID, map[string]int{
+		"components": len(componentRows), "nodes": len(nodeRows), "connections": len(connectionRows),
+		"text_annotations": len(textRows), "regions": len(regionRows),
+	})
+
+	// The context carries the request's trace but not its cancellation: a client hanging up
+	// mid-save shouldn't roll back a nearly done submission
+	if err := records.ReplaceAnnotations(context.WithoutCancel(r.Context()), payload.DocumentID, requestUser(r), tables, submitted); err != nil {
+		slog.ErrorContext(r.Context(), "Saving annotations failed", "document_id", payload.DocumentID, "error", err)
+		jsonError(w, http.StatusInternalServerError, "Failed to save annotations")
 		return
 	}
+	documentCache.forget(payload.DocumentID)
+	nRegions, nComponents, nNodes, nText := len(regionRows), len(componentRows), len(nodeRows), len(textRows)
+	nConnections := len(connectionRows)
+
+	slog.InfoContext(r.Context(), "Saved annotations", "document_id", payload.DocumentID, "components", nComponents,
+		"nodes", nNodes, "connections", nConnections, "text", nText, "regions", nRegions, "clamped", nClamped)
+	submitAnnotations.Observe(float64(len(payload.Annotations)))
+	for _, ann := range payload.Annotations {
+		submittedAnnotations.WithLabelValues(ann.Type).Inc()
+	}
+
+	jsonResponse(w, http.StatusOK, SubmitResponse{
+		Status:     "success",
+		Message:    fmt.Sprintf("Saved %s to database", payload.DocumentID),
+		Clamped:    nClamped,
+		AutoNodes:  nAutoNodes,
+		Simplified: nSimplified,
+		Warnings:   warnings,
+	})
+}
+
+// SubmitResponse is the body of a successful /submit
+type SubmitResponse struct {
+	Status     string       `json:"status"`
+	Message    string       `json:"message"`
+	Clamped    int          `json:"clamped"`    // coordinates pulled onto the image
+	AutoNodes  int          `json:"auto_nodes"` // nodes created for connection endpoints
+	Simplified int          `json:"simplified"` // connections whose points were simplified
+	Warnings   []GraphIssue `json:"warnings"`   // overlapping boxes and suspect values, saved anyway
+}
+
+// annotationTable holds the rows of one annotation table, in Columns order
+type annotationTable struct {
+	Table   string
+	Columns []string
+	Rows    [][]interface{}
+}
 
-	log.Printf("Saved to PostgreSQL: %s | Components: %d, Nodes: %d, Connections: %d, Text: %d",
-		payload.DocumentID, nComponents, nNodes, nConnections, nText)
+// PageCount returns the document's number of pages, or sql.ErrNoRows
+func (postgresRecords) PageCount(ctx context.Context, docID string) (int, error) {
+	var n int
+	err := pool.QueryRow(ctx, sqlDocumentNumPages, docID).Scan(&n)
+	return n, err
+}
+
+func (postgresRecords) SetClassification(ctx context.Context, docID, drawingType, source string) error {
+	_, err := pool.Exec(ctx, "UPDATE documents SET drawing_type = $1, source = $2 WHERE document_id = $3",
+		drawingType, source, docID)
+	return err
+}
 
-	jsonResponse(w, http.StatusOK, map[string]string{
-		"status":  "success",
-		"message": fmt.Sprintf("Saved %s to database", payload.DocumentID),
+// ReplaceAnnotations swaps all of a document's annotations for tables in one transaction,
+// retried when it loses a race with a concurrent save. Rows are streamed with COPY: one round
+// trip per table instead of one INSERT per annotation, which dominated save time on large
+// schematics. Each save is logged in submissions with the annotations it added and removed.
+func (postgresRecords) ReplaceAnnotations(ctx context.Context, docID, annotator string, tables []annotationTable, events ...outboxEvent) error {
+	return inTx(ctx, "submit", func(tx pgx.Tx) error {
+		// Locking the document row queues concurrent saves of the same document; without it the
+		// second one's COPY collides with the rows the first just inserted
+		if _, err := tx.Exec(ctx, "SELECT 1 FROM documents WHERE document_id = $1 FOR UPDATE", docID); err != nil {
+			return err
+		}
+		previous := map[string]bool{} // table/id
+		for _, table := range []string{"components", "nodes", "connections", "text_annotations", "regions"} {
+			rows, err := tx.Query(ctx, "DELETE FROM "+table+" WHERE document_id = $1 RETURNING id", docID)
+			if err != nil {
+				return err
+			}
+			ids, err := pgx.CollectRows(rows, pgx.RowTo[string])
+			if err != nil {
+				return err
+			}
+			for _, id := range ids {
+				previous[table+"/"+id] = true
+			}
+		}
+		n, created := 0, 0
+		for _, t := range tables {
+			n += len(t.Rows)
+			for _, row := range t.Rows {
+				// id is the first column of every annotation table
+				if key := fmt.Sprintf("%s/%v", t.Table, row[0]); previous[key] {
+					delete(previous, key)
+				} else {
+					created++
+				}
+			}
+			if len(t.Rows) == 0 {
+				continue
+			}
+			if _, err := tx.CopyFrom(ctx, pgx.Identifier{t.Table}, t.Columns, pgx.CopyFromRows(t.Rows)); err != nil {
+				return fmt.Errorf("%s: %w", t.Table, err)
+			}
+		}
+		_, err := tx.Exec(ctx, `
+			INSERT INTO submissions (document_id, annotations, annotator, created, removed, started_at)
+			VALUES ($1, $2, NULLIF($3, ''), $4, $5,
+				(SELECT claimed_at FROM documents WHERE document_id = $1 AND claimed_by = NULLIF($3, '')))`,
+			docID, n, annotator, created, len(previous))
+		if err != nil {
+			return err
+		}
+		return enqueueEvents(ctx, tx, events...)
 	})
 }
 
+// nullIfEmpty maps "" to NULL, since COPY can't wrap values in NULLIF the way INSERT does
+func nullIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
 // nullableJSON returns nil for empty/null JSON payloads, or the string for valid ones
 func nullableJSON(data []byte) interface{} {
 	if data == nil || string(data) == "null" {
@@ -379,6 +902,17 @@ func nullableJSON(data []byte) interface{} {
 	return string(data)
 }
 
+// newID returns a random RFC 4122 version 4 UUID, matching the IDs the frontend generates
+func newID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
 // ---------- Query Endpoints ----------
 
 func handleListDocuments(w http.ResponseWriter, r *http.Request) {
@@ -387,38 +921,110 @@ func handleListDocuments(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	rows, err := db.Query("SELECT document_id, image_file, drawing_type, source, created_at FROM documents ORDER BY created_at DESC")
+	q := r.URL.Query()
+	docs, err := records.ListDocuments(r.Context(), documentFilter{
+		Project:      q.Get("project"),
+		Split:        q.Get("split"),
+		PredictedBy:  q.Get("predicted_by"),
+		ModelVersion: q.Get("model_version"),
+		Status:       q.Get("status"),
+	})
+	if errors.Is(err, errRequiresPostgres) {
+		problemError(w, http.StatusNotImplemented, codeRequiresPostgres, "predicted_by "+err.Error())
+		return
+	}
 	if err != nil {
 		jsonError(w, http.StatusInternalServerError, "Query failed")
 		return
 	}
-	defer rows.Close()
 
-	type DocSummary struct {
-		DocumentID  string `json:"document_id"`
-		ImageFile   string `json:"image_file"`
-		DrawingType string `json:"drawing_type"`
-		Source      string `json:"source"`
-		CreatedAt   string `json:"created_at"`
+	jsonResponse(w, http.StatusOK, DocumentList{Documents: docs, Count: len(docs)})
+}
+
+// DocumentList is the body of GET /documents
+type DocumentList struct {
+	Documents []DocumentSummary `json:"documents"`
+	Count     int               `json:"count"`
+}
+
+// documentFilter narrows ListDocuments; empty fields don't filter
+type documentFilter struct {
+	DocumentID   string
+	Project      string
+	Split        string
+	PredictedBy  string // documents the model made suggestions for
+	ModelVersion string // with PredictedBy, only that version's suggestions
+	Status       string // active | on_hold | archived
+}
+
+// DocumentSummary is one entry of the document list
+type DocumentSummary struct {
+	DocumentID  string   `json:"document_id"`
+	ImageFile   string   `json:"image_file"`
+	DrawingType string   `json:"drawing_type"`
+	Source      string   `json:"source"`
+	Project     string   `json:"project"`
+	DisplayName string   `json:"display_name,omitempty"`
+	Tags        []string `json:"tags"`
+	CreatedAt   string   `json:"created_at"`
+	Split       string   `json:"split,omitempty"`
+	Status      string   `json:"status,omitempty"`
+	Thumbnail   string   `json:"thumbnail_url"`
+}
+
+// ListDocuments returns the documents matching f, newest first
+func (postgresRecords) ListDocuments(ctx context.Context, f documentFilter) ([]DocumentSummary, error) {
+	query := "SELECT document_id, image_file, drawing_type, source, project, COALESCE(tags, '{}'), created_at, COALESCE(split, ''), status, " +
+		"COALESCE(display_name, '') FROM documents WHERE true"
+	args := []interface{}{}
+	if f.DocumentID != "" {
+		args = append(args, f.DocumentID)
+		query += fmt.Sprintf(" AND document_id = $%d", len(args))
+	}
+	if f.Project != "" {
+		args = append(args, f.Project)
+		query += fmt.Sprintf(" AND project = $%d", len(args))
+	}
+	if f.Split != "" {
+		args = append(args, f.Split)
+		query += fmt.Sprintf(" AND split = $%d", len(args))
+	}
+	if f.Status != "" {
+		args = append(args, f.Status)
+		query += fmt.Sprintf(" AND status = $%d", len(args))
+	}
+	if f.PredictedBy != "" {
+		args = append(args, f.PredictedBy)
+		cond := fmt.Sprintf("s.model_name = $%d", len(args))
+		if f.ModelVersion != "" {
+			args = append(args, f.ModelVersion)
+			cond += fmt.Sprintf(" AND s.model_version = $%d", len(args))
+		}
+		query += " AND EXISTS (SELECT 1 FROM suggestions s WHERE s.document_id = documents.document_id AND " + cond + ")"
+	}
+	query += " ORDER BY created_at DESC"
+
+	rows, err := readPool(ctx).Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
 	}
+	defer rows.Close()
 
-	docs := []DocSummary{}
+	docs := []DocumentSummary{}
 	for rows.Next() {
-		var d DocSummary
+		var d DocumentSummary
 		var createdAt time.Time
-		if err := rows.Scan(&d.DocumentID, &d.ImageFile, &d.DrawingType, &d.Source, &createdAt); err != nil {
+		if err := rows.Scan(&d.DocumentID, &d.ImageFile, &d.DrawingType, &d.Source, &d.Project, &d.Tags, &createdAt, &d.Split, &d.Status, &d.DisplayName); err != nil {
 			continue
 		}
 		d.CreatedAt = createdAt.Format(time.RFC3339)
+		d.Thumbnail = apiURL(ctx, "/documents/"+url.PathEscape(d.DocumentID)+"/thumbnail")
 		docs = append(docs, d)
 	}
-
-	jsonResponse(w, http.StatusOK, map[string]interface{}{
-		"documents": docs,
-		"count":     len(docs),
-	})
+	return docs, rows.Err()
 }
 
+// handleGetDocument returns one document: GET /documents/{id}?include=graph,text&fields=...&coords=relative
 func handleGetDocument(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		jsonError(w, http.StatusMethodNotAllowed, "GET only")
@@ -433,25 +1039,122 @@ func handleGetDocument(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check document exists
-	var imageFile, drawingType, source string
-	err := db.QueryRow("SELECT image_file, drawing_type, source FROM documents WHERE document_id = $1", docID).
-		Scan(&imageFile, &drawingType, &source)
+	view, err := parseDocumentView(r.URL.Query())
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if retryAfter, down := dbUnavailable(r.Context()); down {
+		serveStale(w, r, retryAfter)
+		return
+	}
+	output, err := records.LoadDocument(r.Context(), docID, view)
+	if errors.Is(err, sql.ErrNoRows) || errors.Is(err, pgx.ErrNoRows) {
+		if !redirectAlias(w, r, docID) {
+			problemError(w, http.StatusNotFound, codeDocumentNotFound, "Document not found")
+		}
+		return
+	}
 	if err != nil {
-		jsonError(w, http.StatusNotFound, "Document not found")
+		if dbUnreachable(err) {
+			serveStale(w, r, 0)
+			return
+		}
+		slog.ErrorContext(r.Context(), "Loading document failed", "document_id", docID, "error", err)
+		jsonError(w, http.StatusInternalServerError, "Failed to load document")
 		return
 	}
 
+	body, err := view.render(r.Context(), output)
+	if err != nil {
+		jsonError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	documentCache.put(documentCacheKey(r), docID, body)
+	jsonResponse(w, http.StatusOK, body)
+}
+
+// LoadDocument assembles a document's metadata, pages, and the annotations the view asks for.
+// It returns sql.ErrNoRows when the document does not exist.
+func (postgresRecords) LoadDocument(ctx context.Context, docID string, view documentView) (*OutputJSON, error) {
+	var imageFile, drawingType, source, originalFilename, displayName string
+	var tags, aliases []string
+	var notes sql.NullString
+	var numPages, width, height int
+	var sha sql.NullString
+	var sizeBytes sql.NullInt64
+	err := readPool(ctx).QueryRow(ctx, sqlDocument, docID).
+		Scan(&imageFile, &drawingType, &source, &tags, &notes, &numPages, &width, &height, &sha, &sizeBytes, &originalFilename, &displayName, &aliases)
+	if err != nil {
+		return nil, err
+	}
+
+	// Fetch pages (documents uploaded before page tracking have none)
+	pages := []PageInfo{}
+	pageRows, _ := readPool(ctx).Query(ctx, sqlDocumentPages, docID)
+	if pageRows != nil {
+		defer pageRows.Close()
+		for pageRows.Next() {
+			var p PageInfo
+			if err := pageRows.Scan(&p.PageNumber, &p.ImageFile, &p.Width, &p.Height, &p.SHA256); err == nil {
+				pages = append(pages, p)
+			}
+		}
+	}
+	if len(pages) == 0 {
+		pages = append(pages, PageInfo{PageNumber: 1, ImageFile: imageFile, Width: width, Height: height})
+	}
+
+	var regions []Region
+	var graph Graph
+	var textAnns []TextAnnotation
+	if view.wants("regions") {
+		regions = loadRegions(ctx, docID)
+	}
+	if view.wants("graph") {
+		graph = loadGraph(ctx, docID)
+	}
+	if view.wants("text_annotations") {
+		textAnns = loadTextAnnotations(ctx, docID)
+	}
+
+	return &OutputJSON{
+		DocumentID:       docID,
+		ImageFile:        imageFile,
+		OriginalFilename: originalFilename,
+		DisplayName:      displayName,
+		Aliases:          aliases,
+		Width:            width,
+		Height:           height,
+		SHA256:           sha.String,
+		SizeBytes:        sizeBytes.Int64,
+		NumPages:         numPages,
+		Pages:            pages,
+		Classification:   map[string]string{"type": drawingType, "domain": source},
+		Tags:             tags,
+		Notes:            notes.String,
+		Regions:          regions,
+		Graph:            graph,
+		TextAnnotations:  textAnns,
+	}, nil
+}
+
+// loadAnnotations fetches all of a document's annotations across pages
+func loadAnnotations(ctx context.Context, docID string) (Graph, []TextAnnotation) {
+	return loadGraph(ctx, docID), loadTextAnnotations(ctx, docID)
+}
+
+// loadGraph fetches a document's components, nodes, and connections
+func loadGraph(ctx context.Context, docID string) Graph {
 	// Fetch components
 	components := []Component{}
-	compRows, _ := db.Query("SELECT id, label, bbox FROM components WHERE document_id = $1", docID)
+	compRows, _ := readPool(ctx).Query(ctx, sqlComponents, docID)
 	if compRows != nil {
 		defer compRows.Close()
 		for compRows.Next() {
 			var c Component
-			var bboxStr string
-			if err := compRows.Scan(&c.ID, &c.Label, &bboxStr); err == nil {
-				c.BBox = parsePgIntArray(bboxStr)
+			if err := compRows.Scan(append([]interface{}{&c.ID, &c.Label, &c.BBox, &c.Page, &c.RegionID, &c.CatalogID}, c.Origin.dest()...)...); err == nil {
 				components = append(components, c)
 			}
 		}
@@ -459,14 +1162,12 @@ func handleGetDocument(w http.ResponseWriter, r *http.Request) {
 
 	// Fetch nodes
 	nodes := []Node{}
-	nodeRows, _ := db.Query("SELECT id, position FROM nodes WHERE document_id = $1", docID)
+	nodeRows, _ := readPool(ctx).Query(ctx, sqlNodes, docID)
 	if nodeRows != nil {
 		defer nodeRows.Close()
 		for nodeRows.Next() {
 			var n Node
-			var posStr string
-			if err := nodeRows.Scan(&n.ID, &posStr); err == nil {
-				n.Position = parsePgIntArray(posStr)
+			if err := nodeRows.Scan(append([]interface{}{&n.ID, &n.Position, &n.Page, &n.RegionID}, n.Origin.dest()...)...); err == nil {
 				nodes = append(nodes, n)
 			}
 		}
@@ -474,97 +1175,240 @@ func handleGetDocument(w http.ResponseWriter, r *http.Request) {
 
 	// Fetch connections
 	connections := []Connection{}
-	connRows, _ := db.Query("SELECT id, source_id, target_id, type, points FROM connections WHERE document_id = $1", docID)
+	connRows, _ := readPool(ctx).Query(ctx, sqlConnections, docID)
 	if connRows != nil {
 		defer connRows.Close()
 		for connRows.Next() {
 			var c Connection
-			var connType, pointsJSON sql.NullString
-			if err := connRows.Scan(&c.ID, &c.SourceID, &c.TargetID, &connType, &pointsJSON); err == nil {
+			var connType sql.NullString
+			if err := connRows.Scan(append([]interface{}{&c.ID, &c.SourceID, &c.TargetID, &connType, &c.Points, &c.Page, &c.RegionID}, c.Origin.dest()...)...); err == nil {
 				c.Type = connType.String
-				if pointsJSON.Valid {
-					json.Unmarshal([]byte(pointsJSON.String), &c.Points)
-				}
 				connections = append(connections, c)
 			}
 		}
 	}
 
-	// Fetch text annotations
+	return Graph{Components: components, Nodes: nodes, Connections: connections}
+}
+
+// loadTextAnnotations fetches a document's text annotations
+func loadTextAnnotations(ctx context.Context, docID string) []TextAnnotation {
 	textAnns := []TextAnnotation{}
-	textRows, _ := db.Query("SELECT id, bbox, raw_text, is_ignored, linked_to, label_name, values FROM text_annotations WHERE document_id = $1", docID)
+	textRows, _ := readPool(ctx).Query(ctx, sqlTextAnnotations, docID)
 	if textRows != nil {
 		defer textRows.Close()
 		for textRows.Next() {
 			var ta TextAnnotation
-			var bboxStr string
 			var linkedTo, labelName sql.NullString
-			var valuesJSON sql.NullString
-			if err := textRows.Scan(&ta.ID, &bboxStr, &ta.RawText, &ta.IsIgnored, &linkedTo, &labelName, &valuesJSON); err == nil {
-				ta.BBox = parsePgIntArray(bboxStr)
+			if err := textRows.Scan(append([]interface{}{&ta.ID, &ta.BBox, &ta.RawText, &ta.IsIgnored, &linkedTo, &labelName, &ta.Values, &ta.Page, &ta.RegionID}, ta.Origin.dest()...)...); err == nil {
 				ta.LinkedTo = linkedTo.String
 				ta.LabelName = labelName.String
-				if valuesJSON.Valid {
-					json.Unmarshal([]byte(valuesJSON.String), &ta.Values)
-				}
+				normalizeValues(ta.Values)
 				textAnns = append(textAnns, ta)
 			}
 		}
 	}
 
-	output := OutputJSON{
-		ImageFile:      imageFile,
-		Classification: map[string]string{"type": drawingType, "domain": source},
-		Graph: Graph{
-			Components:  components,
-			Nodes:       nodes,
-			Connections: connections,
-		},
-		TextAnnotations: textAnns,
-	}
-
-	jsonResponse(w, http.StatusOK, output)
+	return textAnns
 }
 
-// parsePgIntArray parses a PostgreSQL int array string like "{1,2,3,4}" into []int
-func parsePgIntArray(s string) []int {
-	s = strings.Trim(s, "{}")
-	if s == "" {
-		return []int{}
+// ---------- Main ----------
+
+func main() {
+	if config.help {
+		printConfigHelp()
+		return
 	}
-	parts := strings.Split(s, ",")
-	result := make([]int, 0, len(parts))
-	for _, p := range parts {
-		var v int
-		fmt.Sscanf(strings.TrimSpace(p), "%d", &v)
-		result = append(result, v)
+	if err := checkConfig(); err != nil {
+		fatal("Configuration error", "error", err)
+	}
+	if config.fileName != "" {
+		slog.Info("Loaded configuration file", "file", config.fileName)
 	}
-	return result
-}
 
-// ---------- Main ----------
+	if err := os.MkdirAll(datasetDir, 0755); err != nil {
+		fatal("Creating dataset directory failed", "dir", datasetDir, "error", err)
+	}
 
-func main() {
-	os.MkdirAll(datasetDir, 0755)
+	var err error
+	if store, err = openStorage(); err != nil {
+		fatal("Opening object storage failed", "error", err)
+	}
+	slog.Info("Object storage ready", "backend", storageBackend)
 
-	// Connect to PostgreSQL
-	db = connectDB()
-	defer db.Close()
+	shutdownTracing, err := initTracing(context.Background())
+	if err != nil {
+		fatal("Starting tracing failed", "error", err)
+	}
+	defer shutdownTracing(context.Background())
+
+	// Connect to PostgreSQL, or open the local SQLite file
+	if dbDriver == "sqlite" {
+		sqlite, err := openSQLite(sqlitePath)
+		if err != nil {
+			fatal("Opening SQLite database failed", "path", sqlitePath, "error", err)
+		}
+		defer sqlite.db.Close()
+		records = sqlite
+		slog.Warn("Using SQLite; endpoints beyond upload, browse, and submit are disabled", "path", sqlitePath)
+	} else {
+		pool, db = connectDB()
+		defer pool.Close()
+		defer db.Close()
+		replicaPool, replicaDB = connectReplica()
+		defer replicaPool.Close()
+		registerDBMetrics()
+		if migrateOnStart {
+			if err := migrate(context.Background()); err != nil {
+				fatal("Database migration failed", "error", err)
+			}
+		}
+	}
 
 	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", handleHealthz)
+	mux.HandleFunc("/readyz", handleReadyz)
+	mux.HandleFunc("/migrations", handleMigrations)
+	mux.Handle("/metrics", promhttp.Handler())
 	mux.HandleFunc("/upload", handleUpload)
+	mux.HandleFunc("/upload/batch", handleUploadBatch)
+	mux.HandleFunc("/upload/url", handleUploadURL)
+	mux.HandleFunc("/quotas", handleQuotaUsage)
+	mux.HandleFunc("/uploads/tus", handleTusCreate)
+	mux.HandleFunc("/uploads/tus/{id}", handleTusUpload)
 	mux.HandleFunc("/submit", handleSubmit)
-	mux.HandleFunc("/documents", handleListDocuments)
-	mux.HandleFunc("/documents/", handleGetDocument)
+	mux.HandleFunc("/documents", compressed(replicaReads(handleListDocuments)))
+	mux.HandleFunc("/documents/", compressed(replicaReads(handleGetDocument)))
+	// Method-qualified so GET /documents/batch still reaches handleGetDocument
+	mux.HandleFunc("POST /documents/batch", compressed(handleBatchFetch))
+	mux.HandleFunc("POST /documents/batch/delete", handleBatchDelete)
+	mux.HandleFunc("POST /documents/batch/status", handleBatchStatus)
+	mux.HandleFunc("DELETE /documents/{id}", handleDeleteDocument)
+	mux.HandleFunc("PATCH /documents/{id}", handleRenameDocument)
+	mux.HandleFunc("/documents/{id}/duplicates", handleDocumentDuplicates)
+	mux.HandleFunc("/documents/{id}/validate", handleValidateDocument)
+	mux.HandleFunc("/documents/{id}/graph/normalize", handleNormalizeGraph)
+	mux.HandleFunc("/documents/{id}/similar", replicaReads(handleSimilarDocuments))
+	mux.HandleFunc("/documents/{id}/regions", compressed(replicaReads(handleListRegions)))
+	mux.HandleFunc("/documents/{id}/regions/{rid}", handleGetRegion)
+	mux.HandleFunc("/documents/{id}/regions/{rid}/image", handleRegionImage)
+	mux.HandleFunc("/documents/{id}/thumbnail", handleDocumentThumbnail)
+	mux.HandleFunc("/documents/{id}/image", handleDocumentImage)
+	mux.HandleFunc("/documents/{id}/image-url", handleImageURL)
+	mux.HandleFunc("/documents/{id}/tiles", handleTileInfo)
+	mux.HandleFunc("/documents/{id}/tiles/{z}/{x}/{y}", handleTile)
+	mux.HandleFunc("/documents/{id}/components/{cid}/crop", handleComponentCrop)
+	mux.HandleFunc("/documents/{id}/render", handleRenderDocument)
+	mux.HandleFunc("/documents/{id}/overlay.svg", compressed(handleOverlaySVG))
+	mux.HandleFunc("/documents/{id}/ocr", handleDocumentOCR)
+	mux.HandleFunc("/documents/{id}/predict", handlePredict)
+	mux.HandleFunc("/documents/{id}/sessions", handleDocumentSessions)
+	mux.HandleFunc("/documents/{id}/heartbeat", handleHeartbeat)
+	mux.HandleFunc("/documents/{id}/skip", handleSkipDocument)
+	mux.HandleFunc("/documents/{id}/priority", handleDocumentPriority)
+	mux.HandleFunc("/documents/{id}/move", handleMoveDocument)
+	mux.HandleFunc("/documents/{id}/versions", replicaReads(handleDocumentVersions))
+	mux.HandleFunc("/documents/{id}/templates/{tid}/instantiate", handleInstantiateTemplate)
+	mux.HandleFunc("/documents/{id}/suggestions", compressed(handleListSuggestions))
+	mux.HandleFunc("/documents/{id}/suggestions/{action}", handleReviewSuggestions)
+	mux.HandleFunc("/suggestions/{sid}/{action}", handleReviewSuggestion)
+	mux.HandleFunc("/activity", compressed(replicaReads(handleActivity)))
+	mux.HandleFunc("/stats", compressed(replicaReads(handleStats)))
+	mux.HandleFunc("/stats/annotators", compressed(replicaReads(handleAnnotatorStats)))
+	mux.HandleFunc("/stats/progress", compressed(replicaReads(handleProgress)))
+	mux.HandleFunc("/stats/leaderboard", compressed(replicaReads(handleLeaderboard)))
+	mux.HandleFunc("/evaluate", handleEvaluate)
+	mux.HandleFunc("/tasks/next", handleNextTask)
+	mux.HandleFunc("/assignments", handleAssignments)
+	mux.HandleFunc("/assignments/mine", handleMyAssignments)
+	mux.HandleFunc("/assignments/{id}", handleAssignment)
+	mux.HandleFunc("/templates", handleTemplates)
+	mux.HandleFunc("/catalog", handleCatalog)
+	mux.HandleFunc("/catalog/unmatched", replicaReads(handleUnmatchedLabels))
+	mux.HandleFunc("/catalog/{id}", handleCatalogEntry)
+	mux.HandleFunc("/templates/{id}", handleTemplate)
+	mux.HandleFunc("/images/{token}", handleSignedImage)
+	mux.HandleFunc("/graphql", compressed(handleGraphQL))
+	mux.HandleFunc("/openapi.json", compressed(handleOpenAPI))
+	mux.Handle("/docs/", swaggerUI)
+	mux.HandleFunc("/export/coco", compressed(replicaReads(handleExportCOCO)))
+	mux.HandleFunc("/splits/assign", handleAssignSplits)
+	mux.HandleFunc("/sync", handleSync)
+	mux.HandleFunc("/datasets/{project}/snapshots", handleDatasetSnapshots)
+	mux.HandleFunc("/import/coco", handleImportCOCO)
+	mux.HandleFunc("/import/metadata", handleImportMetadata)
+	mux.HandleFunc("/jobs", compressed(handleListJobs))
+	mux.HandleFunc("/jobs/{id}", handleGetJob)
+	mux.HandleFunc("/admin/log-level", adminOnly(handleLogLevel))
+	mux.HandleFunc("/admin/config", adminOnly(handleConfig))
+	mux.HandleFunc("/admin/backup", adminOnly(handleBackup))
+	mux.HandleFunc("/admin/restore", adminOnly(handleRestore))
+	mux.HandleFunc("/admin/consistency", adminOnly(handleConsistency))
+	mux.HandleFunc("/admin/usage", adminOnly(compressed(replicaReads(handleUsage))))
+	mux.HandleFunc("/admin/quotas", adminOnly(handleAdminQuotas))
+	mux.HandleFunc("/admin/quotas/{scope}/{name}", adminOnly(handleAdminQuota))
+	mux.HandleFunc("/admin/api-keys", adminOnly(handleAPIKeys))
+	mux.HandleFunc("/admin/api-keys/{id}", adminOnly(handleAPIKey))
+	mux.HandleFunc("/admin/export-schedules", adminOnly(handleExportSchedules))
+	mux.HandleFunc("/admin/embeddings/backfill", adminOnly(handleBackfillEmbeddings))
+	mux.HandleFunc("/admin/simplify-lines", adminOnly(handleSimplifyLines))
+	mux.HandleFunc("/admin/export-schedules/{id}", adminOnly(handleExportSchedule))
+	mux.HandleFunc("/admin/export-schedules/{id}/run", adminOnly(handleRunExportSchedule))
+
+	// Background workers
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	if grpcAddr != "" {
+		gw, err := startGRPC(ctx)
+		if err != nil {
+			fatal("Starting gRPC server failed", "addr", grpcAddr, "error", err)
+		}
+		mux.Handle("/v1/", gw)
+	}
+	handler := breakerGuard(mux)
+	if dbDriver == "sqlite" {
+		handler = sqliteOnly(mux)
+	} else {
+		if eventBus != "" {
+			bus, err := openEventBus()
+			if err != nil {
+				fatal("Connecting to the event bus failed", "bus", eventBus, "error", err)
+			}
+			defer bus.Close()
+			publisher = bus
+			slog.Info("Publishing events", "bus", eventBus, "prefix", eventSubjectPrefix)
+		}
+		startWorker(ctx, runJobWorker)
+		startWorker(ctx, runScheduler)
+		startWorker(ctx, runOutboxDispatcher)
+		startWorker(ctx, runAPIKeyRefresh)
+		startWorker(ctx, runLeaseSweeper)
+		startWorker(ctx, runChangeLogPruner)
+		if ingestDir != "" {
+			startWorker(ctx, runIngestWorker)
+		}
+	}
 
 	server := &http.Server{
-		Addr:         port,
-		Handler:      corsMiddleware(mux),
+		Addr:         listenAddr,
+		Handler:      apiVersions(mux, corsMiddleware(requestIDMiddleware(tracingMiddleware(loggingMiddleware(metricsMiddleware(rateLimitMiddleware(recoverMiddleware(validateRequests(handler))))))))),
 		ReadTimeout:  30 * time.Second,
 		WriteTimeout: 30 * time.Second,
 		IdleTimeout:  120 * time.Second,
 	}
 
-	log.Printf("corvina backend (go) listening on %s", port)
-	log.Fatal(server.ListenAndServe())
+	servers := []*http.Server{server}
+	redirect, err := configureTLS(server)
+	if err != nil {
+		fatal("TLS configuration failed", "error", err)
+	}
+	if redirect != nil {
+		servers = append(servers, redirect)
+		slog.Info("Redirecting HTTP to HTTPS", "addr", redirect.Addr)
+	}
+
+	slog.Info("corvina backend (go) listening", "addr", server.Addr, "tls", server.TLSConfig != nil)
+	if err := serve(ctx, servers...); err != nil {
+		fatal("Server stopped", "error", err)
+	}
 }
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ---------- CSV Metadata Import ----------
+
+var metadataColumns = map[string]bool{
+	"document_id":  true,
+	"drawing_type": true,
+	"source":       true,
+	"tags":         true,
+	"notes":        true,
+	"priority":     true,
+}
+
+type MetadataImportResult struct {
+	Row        int    `json:"row"`
+	DocumentID string `json:"document_id,omitempty"`
+	Status     string `json:"status"` // updated | not_found | error
+	Error      string `json:"error,omitempty"`
+}
+
+// splitTags accepts "a;b;c" or "a, b, c" within a single CSV cell
+func splitTags(cell string) []string {
+	tags := []string{}
+	for _, t := range strings.FieldsFunc(cell, func(r rune) bool { return r == ';' || r == ',' }) {
+		if t = strings.TrimSpace(t); t != "" {
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
+
+// readMetadataCSV reads the CSV from a multipart "file" part or a raw text/csv body
+func readMetadataCSV(r *http.Request) (io.Reader, func(), error) {
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/") {
+		f, _, err := r.FormFile("file")
+		if err != nil {
+			return nil, nil, errors.New("no file part")
+		}
+		return f, func() { f.Close() }, nil
+	}
+	return r.Body, func() {}, nil
+}
+
+// handleImportMetadata bulk-updates document classification, tags, notes, and priority from a CSV.
+// Empty cells leave the stored value untouched; tags replace existing tags unless ?tags=append.
+func handleImportMetadata(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		jsonError(w, http.StatusMethodNotAllowed, "POST only")
+		return
+	}
+
+	src, closeSrc, err := readMetadataCSV(r)
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer closeSrc()
+
+	appendTags := r.URL.Query().Get("tags") == "append"
+
+	cr := csv.NewReader(src)
+	cr.TrimLeadingSpace = true
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "CSV is empty or unreadable")
+		return
+	}
+	cols := map[string]int{}
+	for i, h := range header {
+		name := strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))
+		if !metadataColumns[name] {
+			jsonError(w, http.StatusBadRequest, fmt.Sprintf("Unknown column %q (expected document_id, drawing_type, source, tags, notes, priority)", h))
+			return
+		}
+		cols[name] = i
+	}
+	if _, ok := cols["document_id"]; !ok {
+		jsonError(w, http.StatusBadRequest, "CSV header must include document_id")
+		return
+	}
+
+	cell := func(rec []string, name string) string {
+		if i, ok := cols[name]; ok && i < len(rec) {
+			return strings.TrimSpace(rec[i])
+		}
+		return ""
+	}
+
+	results := []MetadataImportResult{}
+	var nUpdated, nFailed int
+	for row := 2; ; row++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		res := MetadataImportResult{Row: row}
+		if err != nil {
+			res.Status, res.Error = "error", err.Error()
+			results = append(results, res)
+			nFailed++
+			continue
+		}
+
+		res.DocumentID = cell(rec, "document_id")
+		if res.DocumentID == "" {
+			res.Status, res.Error = "error", "missing document_id"
+			results = append(results, res)
+			nFailed++
+			continue
+		}
+
+		var tags interface{}
+		if c := cell(rec, "tags"); c != "" {
+			tags = splitTags(c)
+		}
+		var priority interface{}
+		if c := cell(rec, "priority"); c != "" {
+			n, err := strconv.Atoi(c)
+			if err != nil {
+				res.Status, res.Error = "error", "priority must be an integer"
+				results = append(results, res)
+				nFailed++
+				continue
+			}
+			priority = n
+		}
+
+		tagsExpr := "$4::text[]"
+		if appendTags {
+			tagsExpr = "ARRAY(SELECT DISTINCT unnest(COALESCE(tags, '{}') || $4::text[]))"
+		}
+		result, err := db.ExecContext(r.Context(), `
+			UPDATE documents SET
+				drawing_type = COALESCE(NULLIF($2, ''), drawing_type),
+				source       = COALESCE(NULLIF($3, ''), source),
+				tags         = CASE WHEN $4::text[] IS NULL THEN tags ELSE `+tagsExpr+` END,
+				notes        = COALESCE(NULLIF($5, ''), notes),
+				priority     = COALESCE($6::int, priority)
+			WHERE document_id = $1
+		`, res.DocumentID, cell(rec, "drawing_type"), cell(rec, "source"), tags, cell(rec, "notes"), priority)
+
+		var n int64
+		if err == nil {
+			n, _ = result.RowsAffected()
+		}
+		switch {
+		case err != nil:
+			res.Status, res.Error = "error", err.Error()
+			nFailed++
+		case n == 0:
+			res.Status = "not_found"
+			nFailed++
+		default:
+			res.Status = "updated"
+			nUpdated++
+		}
+		results = append(results, res)
+	}
+
+	slog.InfoContext(r.Context(), "Metadata import", "updated", nUpdated, "failed", nFailed)
+
+	jsonResponse(w, http.StatusOK, map[string]interface{}{
+		"status":  "success",
+		"updated": nUpdated,
+		"failed":  nFailed,
+		"results": results,
+	})
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// ---------- Metrics ----------
+
+// Prometheus metrics served on /metrics. Routes are labelled by their mux pattern
+// ("GET /documents/{id}/image"), never the raw path, to keep label cardinality bounded.
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "corvina_http_requests_total",
+		Help: "HTTP requests by route, method, and status code.",
+	}, []string{"route", "method", "code"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "corvina_http_request_duration_seconds",
+		Help:    "HTTP request latency by route and method.",
+		Buckets: []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"route", "method"})
+
+	uploadBytes = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "corvina_upload_bytes",
+		Help:    "Size of registered uploads by format.",
+		Buckets: prometheus.ExponentialBuckets(64<<10, 4, 8), // 64 KB .. 1 GB
+	}, []string{"format"})
+
+	submitAnnotations = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "corvina_submit_annotations",
+		Help:    "Annotations per accepted /submit.",
+		Buckets: prometheus.ExponentialBuckets(1, 4, 8), // 1 .. 16384
+	})
+
+	submittedAnnotations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "corvina_submitted_annotations_total",
+		Help: "Annotations saved through /submit by type.",
+	}, []string{"type"})
+
+	jobsFinished = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "corvina_jobs_total",
+		Help: "Background jobs run by kind and outcome (done | failed).",
+	}, []string{"kind", "status"})
+
+	jobDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "corvina_job_duration_seconds",
+		Help:    "Background job run time by kind.",
+		Buckets: prometheus.ExponentialBuckets(.1, 4, 8), // 100 ms .. ~27 min
+	}, []string{"kind"})
+
+	dbBreakerOpen = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "corvina_db_breaker_open",
+		Help: "1 while the database circuit breaker is open",
+	})
+
+	dbBreakerRejected = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "corvina_db_breaker_rejected_total",
+		Help: "Requests answered 503 because the database was unavailable",
+	})
+
+	dbStaleReads = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "corvina_db_stale_reads_total",
+		Help: "Document reads answered from the cache while the database was unavailable",
+	})
+
+	webhookDeliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "corvina_webhook_deliveries_total",
+		Help: "Webhook and event bus delivery attempts by outcome (delivered | retry | failed).",
+	}, []string{"outcome"})
+
+	txRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "corvina_db_tx_retries_total",
+		Help: "Transactions retried after a transient failure, by transaction and SQLSTATE (or \"conn\").",
+	}, []string{"tx", "reason"})
+)
+
+// registerDBMetrics exports connection pool stats and the job queue depth; call once db is open
+func registerDBMetrics() {
+	prometheus.MustRegister(newPoolCollector(pool, "primary"))
+	if replicaPool != pool {
+		prometheus.MustRegister(newPoolCollector(replicaPool, "replica"))
+	}
+	prometheus.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "corvina_jobs_queued",
+		Help: "Background jobs waiting to run.",
+	}, func() float64 {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		var n int
+		if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM jobs WHERE status = 'queued'").Scan(&n); err != nil {
+			return -1
+		}
+		return float64(n)
+	}))
+}
+
+// statusRecorder captures the status code a handler writes
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	if s.status == 0 {
+		s.status = code
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+// Flush keeps streaming handlers (ndjson batch fetch) working through the wrapper
+func (s *statusRecorder) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying connection
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// metricsMiddleware records request counts and latency. It wraps the mux so r.Pattern has been
+// filled in by the time the handler returns.
+func metricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		route := r.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		httpRequests.WithLabelValues(route, r.Method, strconv.Itoa(rec.status)).Inc()
+		httpDuration.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
+	})
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ---------- Schema Migrations ----------
+
+// The schema lives in migrations/NNNN_name.sql, embedded in the binary and applied in version
+// order at startup, each in its own transaction. schema_migrations records what has been applied
+// with a checksum, so a migration edited after it shipped is reported instead of silently
+// diverging. Never change a released migration; add a new one.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// MIGRATE_ON_START=false leaves applying to an operator; the server then refuses to become ready
+// until the database is current
+var migrateOnStart = envBool("MIGRATE_ON_START", true)
+
+// migrationLockID keys the advisory lock that keeps concurrently starting instances from
+// migrating at the same time
+const migrationLockID = 0x636f7276 // "corv"
+
+type migration struct {
+	Version  int
+	Name     string
+	SQL      string
+	Checksum string
+}
+
+// loadMigrations parses the embedded files; a malformed name or duplicate version is a build
+// mistake, so it panics
+func loadMigrations() []migration {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		panic(err)
+	}
+	var out []migration
+	seen := map[int]string{}
+	for _, e := range entries {
+		file := e.Name()
+		num, name, ok := strings.Cut(strings.TrimSuffix(file, ".sql"), "_")
+		version, err := strconv.Atoi(num)
+		if !ok || err != nil || version <= 0 {
+			panic(fmt.Sprintf("migration %s: name must be NNNN_description.sql", file))
+		}
+		if other, dup := seen[version]; dup {
+			panic(fmt.Sprintf("migrations %s and %s share version %d", other, file, version))
+		}
+		seen[version] = file
+		data, err := migrationFiles.ReadFile(path.Join("migrations", file))
+		if err != nil {
+			panic(err)
+		}
+		sum := sha256.Sum256(data)
+		out = append(out, migration{Version: version, Name: name, SQL: string(data), Checksum: hex.EncodeToString(sum[:])})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	return out
+}
+
+var migrations = loadMigrations()
+
+const migrationsTable = `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INT PRIMARY KEY,
+		name       TEXT NOT NULL,
+		checksum   TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`
+
+type appliedMigration struct {
+	Checksum  string
+	AppliedAt time.Time
+}
+
+func appliedMigrations(ctx context.Context, q interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}) (map[int]appliedMigration, error) {
+	rows, err := q.QueryContext(ctx, "SELECT version, checksum, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	applied := map[int]appliedMigration{}
+	for rows.Next() {
+		var v int
+		var a appliedMigration
+		if err := rows.Scan(&v, &a.Checksum, &a.AppliedAt); err != nil {
+			return nil, err
+		}
+		applied[v] = a
+	}
+	return applied, rows.Err()
+}
+
+// migrate applies every pending migration. It holds a session advisory lock throughout, so a
+// second instance starting at the same time waits and then finds nothing left to do. Statements
+// run without DB_QUERY_TIMEOUT: waiting on the lock or rewriting a large table can take a while.
+func migrate(ctx context.Context) error {
+	ctx = withoutQueryTimeout(ctx)
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockID); err != nil {
+		return fmt.Errorf("taking migration lock: %w", err)
+	}
+	defer conn.ExecContext(context.WithoutCancel(ctx), "SELECT pg_advisory_unlock($1)", migrationLockID)
+
+	if _, err := conn.ExecContext(ctx, migrationsTable); err != nil {
+		return err
+	}
+	applied, err := appliedMigrations(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if a, ok := applied[m.Version]; ok {
+			if a.Checksum != m.Checksum {
+				slog.Warn("Applied migration differs from the embedded file", "version", m.Version, "name", m.Name)
+			}
+			continue
+		}
+		start := time.Now()
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, m.SQL); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %04d_%s: %w", m.Version, m.Name, err)
+		}
+		if _, err := tx.ExecContext(ctx,
+			"INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3)",
+			m.Version, m.Name, m.Checksum,
+		); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("migration %04d_%s: %w", m.Version, m.Name, err)
+		}
+		slog.Info("Applied migration", "version", m.Version, "name", m.Name, "duration_ms", time.Since(start).Milliseconds())
+	}
+	return nil
+}
+
+// MigrationStatus is one row of GET /migrations
+type MigrationStatus struct {
+	Version   int    `json:"version"`
+	Name      string `json:"name"`
+	Status    string `json:"status"` // applied | pending | modified | unknown
+	AppliedAt string `json:"applied_at,omitempty"`
+}
+
+// migrationStatus compares the database with the embedded migrations. "modified" means the file
+// changed after it was applied; "unknown" is a version this binary doesn't have (a newer build
+// migrated the database).
+func migrationStatus(ctx context.Context) ([]MigrationStatus, error) {
+	var exists bool
+	if err := db.QueryRowContext(ctx, "SELECT to_regclass('schema_migrations') IS NOT NULL").Scan(&exists); err != nil {
+		return nil, err
+	}
+	applied := map[int]appliedMigration{}
+	if exists {
+		var err error
+		if applied, err = appliedMigrations(ctx, db); err != nil {
+			return nil, err
+		}
+	}
+
+	var out []MigrationStatus
+	for _, m := range migrations {
+		s := MigrationStatus{Version: m.Version, Name: m.Name, Status: "pending"}
+		if a, ok := applied[m.Version]; ok {
+			s.Status, s.AppliedAt = "applied", a.AppliedAt.Format(time.RFC3339)
+			if a.Checksum != m.Checksum {
+				s.Status = "modified"
+			}
+			delete(applied, m.Version)
+		}
+		out = append(out, s)
+	}
+	for v, a := range applied {
+		out = append(out, MigrationStatus{Version: v, Status: "unknown", AppliedAt: a.AppliedAt.Format(time.RFC3339)})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	return out, nil
+}
+
+// checkMigrations is the readiness check: every embedded migration has been applied
+func checkMigrations(ctx context.Context) error {
+	statuses, err := migrationStatus(ctx)
+	if err != nil {
+		return err
+	}
+	var pending []string
+	for _, s := range statuses {
+		if s.Status == "pending" {
+			pending = append(pending, fmt.Sprintf("%04d_%s", s.Version, s.Name))
+		}
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("pending migrations: %s", strings.Join(pending, ", "))
+	}
+	return nil
+}
+
+// handleMigrations reports the migration status: GET /migrations
+func handleMigrations(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		jsonError(w, http.StatusMethodNotAllowed, "GET only")
+		return
+	}
+	statuses, err := migrationStatus(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Reading migration status failed", "error", err)
+		jsonError(w, http.StatusInternalServerError, "Failed to read migration status")
+		return
+	}
+	current := 0
+	for _, s := range statuses {
+		if s.Status != "pending" && s.Version > current {
+			current = s.Version
+		}
+	}
+	jsonResponse(w, http.StatusOK, map[string]interface{}{
+		"current":    current,
+		"latest":     migrations[len(migrations)-1].Version,
+		"migrations": statuses,
+	})
+}
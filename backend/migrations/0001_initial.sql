@@ -0,0 +1,306 @@
+-- CORVINA PostgreSQL Schema
+-- The schema as it stood before versioned migrations. Every statement is idempotent, so this
+-- also applies cleanly to databases that were created from the old schema.sql.
+
+CREATE TABLE IF NOT EXISTS documents (
+    id            SERIAL PRIMARY KEY,
+    document_id   TEXT UNIQUE NOT NULL,
+    image_file    TEXT NOT NULL,
+    drawing_type  TEXT DEFAULT 'handwritten',
+    source        TEXT DEFAULT 'notebook',
+    created_at    TIMESTAMPTZ DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS components (
+    id          TEXT NOT NULL,
+    document_id TEXT NOT NULL REFERENCES documents(document_id) ON DELETE CASCADE,
+    label       TEXT,
+    bbox        INT[],
+    PRIMARY KEY (document_id, id)
+);
+
+CREATE TABLE IF NOT EXISTS nodes (
+    id          TEXT NOT NULL,
+    document_id TEXT NOT NULL REFERENCES documents(document_id) ON DELETE CASCADE,
+    position    INT[],
+    PRIMARY KEY (document_id, id)
+);
+
+CREATE TABLE IF NOT EXISTS connections (
+    id          TEXT NOT NULL,
+    document_id TEXT NOT NULL REFERENCES documents(document_id) ON DELETE CASCADE,
+    source_id   TEXT,
+    target_id   TEXT,
+    type        TEXT,
+    points      JSONB,
+    PRIMARY KEY (document_id, id)
+);
+
+CREATE TABLE IF NOT EXISTS text_annotations (
+    id          TEXT NOT NULL,
+    document_id TEXT NOT NULL REFERENCES documents(document_id) ON DELETE CASCADE,
+    bbox        INT[],
+    raw_text    TEXT,
+    is_ignored  BOOLEAN DEFAULT false,
+    linked_to   TEXT,
+    label_name  TEXT,
+    values      JSONB,
+    PRIMARY KEY (document_id, id)
+);
+
+-- Index for fast document lookups
+CREATE INDEX IF NOT EXISTS idx_components_doc ON components(document_id);
+CREATE INDEX IF NOT EXISTS idx_nodes_doc ON nodes(document_id);
+CREATE INDEX IF NOT EXISTS idx_connections_doc ON connections(document_id);
+CREATE INDEX IF NOT EXISTS idx_text_annotations_doc ON text_annotations(document_id);
+
+-- Projects group documents for export and scheduling
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS project TEXT NOT NULL DEFAULT 'default';
+CREATE INDEX IF NOT EXISTS idx_documents_project ON documents(project);
+
+-- Background jobs executed by the job worker
+CREATE TABLE IF NOT EXISTS jobs (
+    id           BIGSERIAL PRIMARY KEY,
+    kind         TEXT NOT NULL,
+    status       TEXT NOT NULL DEFAULT 'queued',
+    payload      JSONB,
+    result       JSONB,
+    error        TEXT,
+    attempts     INT NOT NULL DEFAULT 0,
+    created_at   TIMESTAMPTZ DEFAULT now(),
+    started_at   TIMESTAMPTZ,
+    finished_at  TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_jobs_queued ON jobs(id) WHERE status = 'queued';
+
+-- Recurring exports (cron expression evaluated in the given timezone)
+CREATE TABLE IF NOT EXISTS export_schedules (
+    id           BIGSERIAL PRIMARY KEY,
+    name         TEXT NOT NULL,
+    project      TEXT NOT NULL DEFAULT 'default',
+    format       TEXT NOT NULL DEFAULT 'coco',
+    destination  TEXT NOT NULL,
+    cron         TEXT NOT NULL,
+    timezone     TEXT NOT NULL DEFAULT 'UTC',
+    enabled      BOOLEAN NOT NULL DEFAULT true,
+    next_run_at  TIMESTAMPTZ,
+    last_run_at  TIMESTAMPTZ,
+    last_status  TEXT,
+    last_error   TEXT,
+    last_output  TEXT,
+    created_at   TIMESTAMPTZ DEFAULT now()
+);
+
+-- Free-form document metadata (bulk-editable via /import/metadata)
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS tags TEXT[] DEFAULT '{}';
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS notes TEXT;
+
+-- Multi-page documents (PDF uploads are rasterized to one PNG per page)
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS pdf_file TEXT;
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS num_pages INT NOT NULL DEFAULT 1;
+
+CREATE TABLE IF NOT EXISTS pages (
+    document_id TEXT NOT NULL REFERENCES documents(document_id) ON DELETE CASCADE,
+    page_number INT NOT NULL,
+    image_file  TEXT NOT NULL,
+    width       INT,
+    height      INT,
+    PRIMARY KEY (document_id, page_number)
+);
+
+ALTER TABLE components ADD COLUMN IF NOT EXISTS page_number INT NOT NULL DEFAULT 1;
+ALTER TABLE nodes ADD COLUMN IF NOT EXISTS page_number INT NOT NULL DEFAULT 1;
+ALTER TABLE connections ADD COLUMN IF NOT EXISTS page_number INT NOT NULL DEFAULT 1;
+ALTER TABLE text_annotations ADD COLUMN IF NOT EXISTS page_number INT NOT NULL DEFAULT 1;
+
+-- Format of the original upload when the stored PNG was converted (jpeg, tiff, webp, pdf)
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS original_format TEXT DEFAULT 'png';
+
+-- Image size of the first page, recorded at upload time; submitted coordinates are checked against it
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS width INT;
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS height INT;
+
+-- 64-bit DCT perceptual hash of the first page, for near-duplicate detection
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS phash BIGINT;
+
+-- Content-addressed storage: files live at dataset/objects/<sha256[:2]>/<sha256><ext>.
+-- documents.* describe the original upload; pages.* the PNG image of each page.
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS sha256 TEXT;
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS size_bytes BIGINT;
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS storage_key TEXT;
+ALTER TABLE pages ADD COLUMN IF NOT EXISTS sha256 TEXT;
+ALTER TABLE pages ADD COLUMN IF NOT EXISTS storage_key TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_documents_sha256 ON documents(sha256);
+
+-- Small JPEG preview of page 1 (object store key)
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS thumbnail_key TEXT;
+
+-- Machine-generated annotation drafts, kept apart from the canonical tables until accepted
+CREATE TABLE IF NOT EXISTS suggestions (
+    id            TEXT PRIMARY KEY,
+    document_id   TEXT NOT NULL REFERENCES documents(document_id) ON DELETE CASCADE,
+    page_number   INT NOT NULL DEFAULT 1,
+    type          TEXT NOT NULL,
+    annotation_id TEXT,
+    bbox          INT[],
+    raw_text      TEXT,
+    confidence    REAL,
+    source        TEXT NOT NULL,
+    status        TEXT NOT NULL DEFAULT 'pending',
+    created_at    TIMESTAMPTZ DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_suggestions_doc ON suggestions(document_id, status);
+
+-- Model predictions stored as suggestions carry the full annotation shape
+ALTER TABLE suggestions ADD COLUMN IF NOT EXISTS label TEXT;
+ALTER TABLE suggestions ADD COLUMN IF NOT EXISTS position INT[];
+ALTER TABLE suggestions ADD COLUMN IF NOT EXISTS points JSONB;
+ALTER TABLE suggestions ADD COLUMN IF NOT EXISTS source_id TEXT;
+ALTER TABLE suggestions ADD COLUMN IF NOT EXISTS target_id TEXT;
+
+-- Where each annotation came from (human, model, ocr, import) and the suggestion it was accepted from
+ALTER TABLE components ADD COLUMN IF NOT EXISTS provenance TEXT NOT NULL DEFAULT 'human';
+ALTER TABLE components ADD COLUMN IF NOT EXISTS suggestion_id TEXT;
+ALTER TABLE nodes ADD COLUMN IF NOT EXISTS provenance TEXT NOT NULL DEFAULT 'human';
+ALTER TABLE nodes ADD COLUMN IF NOT EXISTS suggestion_id TEXT;
+ALTER TABLE connections ADD COLUMN IF NOT EXISTS provenance TEXT NOT NULL DEFAULT 'human';
+ALTER TABLE connections ADD COLUMN IF NOT EXISTS suggestion_id TEXT;
+ALTER TABLE text_annotations ADD COLUMN IF NOT EXISTS provenance TEXT NOT NULL DEFAULT 'human';
+ALTER TABLE text_annotations ADD COLUMN IF NOT EXISTS suggestion_id TEXT;
+
+-- Accept/reject decisions on suggestions
+ALTER TABLE suggestions ADD COLUMN IF NOT EXISTS decided_at TIMESTAMPTZ;
+ALTER TABLE suggestions ADD COLUMN IF NOT EXISTS decided_by TEXT;
+
+-- Model that produced each suggestion, carried onto annotations accepted from it
+ALTER TABLE suggestions ADD COLUMN IF NOT EXISTS model_name TEXT;
+ALTER TABLE suggestions ADD COLUMN IF NOT EXISTS model_version TEXT;
+CREATE INDEX IF NOT EXISTS idx_suggestions_model ON suggestions(model_name, model_version);
+ALTER TABLE components ADD COLUMN IF NOT EXISTS model_name TEXT;
+ALTER TABLE components ADD COLUMN IF NOT EXISTS model_version TEXT;
+ALTER TABLE nodes ADD COLUMN IF NOT EXISTS model_name TEXT;
+ALTER TABLE nodes ADD COLUMN IF NOT EXISTS model_version TEXT;
+ALTER TABLE connections ADD COLUMN IF NOT EXISTS model_name TEXT;
+ALTER TABLE connections ADD COLUMN IF NOT EXISTS model_version TEXT;
+ALTER TABLE text_annotations ADD COLUMN IF NOT EXISTS model_name TEXT;
+ALTER TABLE text_annotations ADD COLUMN IF NOT EXISTS model_version TEXT;
+
+-- Task queue: model uncertainty for active-learning order, and the lease held by an annotator
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS uncertainty DOUBLE PRECISION;
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS claimed_at TIMESTAMPTZ;
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS claimed_by TEXT;
+CREATE INDEX IF NOT EXISTS idx_documents_uncertainty ON documents(uncertainty DESC NULLS LAST);
+
+-- Image embeddings for similar-document search (pgvector). The column is left without a fixed
+-- dimension so the embedding model can change; add an HNSW index once the dimension is settled.
+CREATE EXTENSION IF NOT EXISTS vector;
+CREATE TABLE IF NOT EXISTS document_embeddings (
+    document_id TEXT PRIMARY KEY REFERENCES documents(document_id) ON DELETE CASCADE,
+    model       TEXT NOT NULL DEFAULT '',
+    embedding   vector NOT NULL,
+    created_at  TIMESTAMPTZ DEFAULT now()
+);
+
+-- Train/val/test split of each document; NULL until assigned
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS split TEXT;
+CREATE INDEX IF NOT EXISTS idx_documents_split ON documents(project, split);
+ALTER TABLE export_schedules ADD COLUMN IF NOT EXISTS split TEXT;
+
+-- Frozen dataset versions; the export itself is an immutable object in the object store
+CREATE TABLE IF NOT EXISTS dataset_snapshots (
+    id           BIGSERIAL PRIMARY KEY,
+    project      TEXT NOT NULL,
+    tag          TEXT NOT NULL,
+    description  TEXT,
+    documents    INT NOT NULL DEFAULT 0,
+    images       INT NOT NULL DEFAULT 0,
+    annotations  INT NOT NULL DEFAULT 0,
+    sha256       TEXT NOT NULL,
+    storage_key  TEXT NOT NULL,
+    created_at   TIMESTAMPTZ DEFAULT now(),
+    UNIQUE (project, tag)
+);
+
+-- Change log behind /sync, filled by triggers on documents and annotation tables
+CREATE TABLE IF NOT EXISTS change_log (
+    seq          BIGSERIAL PRIMARY KEY,
+    txid         xid8 NOT NULL DEFAULT pg_current_xact_id(),
+    entity       TEXT NOT NULL,
+    document_id  TEXT NOT NULL,
+    entity_id    TEXT NOT NULL,
+    op           TEXT NOT NULL,
+    changed_at   TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_change_log_cursor ON change_log(txid, seq);
+CREATE INDEX IF NOT EXISTS idx_change_log_changed_at ON change_log(changed_at);
+
+CREATE OR REPLACE FUNCTION log_change() RETURNS trigger AS $$
+DECLARE
+    rec RECORD;
+    eid TEXT;
+BEGIN
+    IF TG_OP = 'DELETE' THEN rec := OLD; ELSE rec := NEW; END IF;
+    IF TG_TABLE_NAME = 'documents' THEN eid := rec.document_id; ELSE eid := rec.id; END IF;
+    INSERT INTO change_log (entity, document_id, entity_id, op)
+    VALUES (TG_TABLE_NAME, rec.document_id, eid, lower(TG_OP));
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS documents_change_log ON documents;
+CREATE TRIGGER documents_change_log AFTER INSERT OR UPDATE OR DELETE ON documents
+    FOR EACH ROW EXECUTE FUNCTION log_change();
+DROP TRIGGER IF EXISTS components_change_log ON components;
+CREATE TRIGGER components_change_log AFTER INSERT OR UPDATE OR DELETE ON components
+    FOR EACH ROW EXECUTE FUNCTION log_change();
+DROP TRIGGER IF EXISTS nodes_change_log ON nodes;
+CREATE TRIGGER nodes_change_log AFTER INSERT OR UPDATE OR DELETE ON nodes
+    FOR EACH ROW EXECUTE FUNCTION log_change();
+DROP TRIGGER IF EXISTS connections_change_log ON connections;
+CREATE TRIGGER connections_change_log AFTER INSERT OR UPDATE OR DELETE ON connections
+    FOR EACH ROW EXECUTE FUNCTION log_change();
+DROP TRIGGER IF EXISTS text_annotations_change_log ON text_annotations;
+CREATE TRIGGER text_annotations_change_log AFTER INSERT OR UPDATE OR DELETE ON text_annotations
+    FOR EACH ROW EXECUTE FUNCTION log_change();
+
+-- Documents that predate the log are recorded once so a first sync sees the whole corpus
+INSERT INTO change_log (entity, document_id, entity_id, op)
+SELECT 'documents', document_id, document_id, 'insert' FROM documents
+WHERE NOT EXISTS (SELECT 1 FROM change_log);
+
+-- Unsimplified line points, kept when a line is simplified
+ALTER TABLE connections ADD COLUMN IF NOT EXISTS points_original JSONB;
+
+-- Independent drawings on one page; annotations may point at the region they belong to
+CREATE TABLE IF NOT EXISTS regions (
+    id          TEXT NOT NULL,
+    document_id TEXT NOT NULL REFERENCES documents(document_id) ON DELETE CASCADE,
+    page_number INT NOT NULL DEFAULT 1,
+    label       TEXT,
+    bbox        INT[],
+    PRIMARY KEY (document_id, id)
+);
+
+ALTER TABLE components ADD COLUMN IF NOT EXISTS region_id TEXT;
+ALTER TABLE nodes ADD COLUMN IF NOT EXISTS region_id TEXT;
+ALTER TABLE connections ADD COLUMN IF NOT EXISTS region_id TEXT;
+ALTER TABLE text_annotations ADD COLUMN IF NOT EXISTS region_id TEXT;
+
+DROP TRIGGER IF EXISTS regions_change_log ON regions;
+CREATE TRIGGER regions_change_log AFTER INSERT OR UPDATE OR DELETE ON regions
+    FOR EACH ROW EXECUTE FUNCTION log_change();
+
+-- Resumable (tus) uploads; partial data lives in dataset/uploads/<id> until complete
+CREATE TABLE IF NOT EXISTS tus_uploads (
+    id           TEXT PRIMARY KEY,
+    filename     TEXT NOT NULL,
+    project      TEXT NOT NULL,
+    length       BIGINT NOT NULL,
+    document_id  TEXT,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at   TIMESTAMPTZ NOT NULL,
+    completed_at TIMESTAMPTZ
+);
@@ -0,0 +1,19 @@
+-- Transactional outbox: events are written in the same transaction as the change they describe,
+-- one row per webhook destination, and delivered by the outbox dispatcher
+CREATE TABLE IF NOT EXISTS outbox (
+    id              BIGSERIAL PRIMARY KEY,
+    event_id        UUID NOT NULL,
+    event_type      TEXT NOT NULL,
+    document_id     TEXT,
+    payload         JSONB NOT NULL,
+    destination     TEXT NOT NULL,
+    status          TEXT NOT NULL DEFAULT 'pending', -- pending | delivered | failed
+    attempts        INT NOT NULL DEFAULT 0,
+    last_error      TEXT,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+    delivered_at    TIMESTAMPTZ,
+    UNIQUE (event_id, destination)
+);
+
+CREATE INDEX IF NOT EXISTS idx_outbox_pending ON outbox(next_attempt_at) WHERE status = 'pending';
@@ -0,0 +1,10 @@
+-- One row per /submit, for per-day submission counts in /stats
+CREATE TABLE IF NOT EXISTS submissions (
+    id           BIGSERIAL PRIMARY KEY,
+    document_id  TEXT NOT NULL REFERENCES documents(document_id) ON DELETE CASCADE,
+    annotations  INT NOT NULL DEFAULT 0,
+    submitted_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_submissions_submitted_at ON submissions(submitted_at);
+CREATE INDEX IF NOT EXISTS idx_submissions_doc ON submissions(document_id);
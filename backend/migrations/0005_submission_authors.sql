@@ -0,0 +1,8 @@
+-- Who made each submission and how it changed the document, for /stats/annotators. started_at
+-- is when the annotator claimed the document from /tasks/next, if they did.
+ALTER TABLE submissions ADD COLUMN IF NOT EXISTS annotator TEXT;
+ALTER TABLE submissions ADD COLUMN IF NOT EXISTS created INT NOT NULL DEFAULT 0;
+ALTER TABLE submissions ADD COLUMN IF NOT EXISTS removed INT NOT NULL DEFAULT 0;
+ALTER TABLE submissions ADD COLUMN IF NOT EXISTS started_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_submissions_annotator ON submissions(annotator, submitted_at);
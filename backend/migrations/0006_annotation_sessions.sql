@@ -0,0 +1,12 @@
+-- Time spent annotating: a session runs from the moment a document is opened for annotation to
+-- the moment it is closed. Sessions never stopped have no ended_at and count for nothing.
+CREATE TABLE IF NOT EXISTS annotation_sessions (
+    id          TEXT PRIMARY KEY,
+    document_id TEXT NOT NULL REFERENCES documents(document_id) ON DELETE CASCADE,
+    annotator   TEXT,
+    started_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    ended_at    TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_annotation_sessions_doc ON annotation_sessions(document_id);
+CREATE INDEX IF NOT EXISTS idx_annotation_sessions_started ON annotation_sessions(started_at);
@@ -0,0 +1,7 @@
+-- Heartbeats from an open document: a claim or session whose heartbeats stop lapses after
+-- HEARTBEAT_TIMEOUT instead of staying open forever.
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS heartbeat_at TIMESTAMPTZ;
+ALTER TABLE annotation_sessions ADD COLUMN IF NOT EXISTS heartbeat_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_documents_claimed ON documents(claimed_at) WHERE claimed_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_annotation_sessions_open ON annotation_sessions(heartbeat_at) WHERE ended_at IS NULL;
@@ -0,0 +1,3 @@
+-- The activity feed reads uploads and suggestion reviews newest first
+CREATE INDEX IF NOT EXISTS idx_documents_created_at ON documents(created_at);
+CREATE INDEX IF NOT EXISTS idx_suggestions_decided_at ON suggestions(decided_at) WHERE decided_at IS NOT NULL;
@@ -0,0 +1,11 @@
+-- Documents handed to a specific annotator by a coordinator. /tasks/next serves an annotator
+-- their assignments first and never hands an assigned document to anyone else.
+CREATE TABLE IF NOT EXISTS assignments (
+    document_id TEXT PRIMARY KEY REFERENCES documents(document_id) ON DELETE CASCADE,
+    assignee    TEXT NOT NULL,
+    assigned_by TEXT,
+    assigned_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    due_at      TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_assignments_assignee ON assignments(assignee, due_at);
@@ -0,0 +1,14 @@
+-- Task queue order and skipping: /tasks/next serves higher priority first, and a document an
+-- annotator skips is held back until deferred_until.
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS priority INT NOT NULL DEFAULT 0;
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS deferred_until TIMESTAMPTZ;
+
+CREATE TABLE IF NOT EXISTS document_skips (
+    id          BIGSERIAL PRIMARY KEY,
+    document_id TEXT NOT NULL REFERENCES documents(document_id) ON DELETE CASCADE,
+    annotator   TEXT,
+    reason      TEXT NOT NULL,
+    skipped_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_document_skips_doc ON document_skips(document_id);
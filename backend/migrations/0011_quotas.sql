@@ -0,0 +1,15 @@
+-- Upload quotas. uploaded_by is the annotator named on the upload, counted for per-user quotas;
+-- quotas overrides the QUOTA_* defaults for one project or user (NULL keeps the default).
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS uploaded_by TEXT;
+ALTER TABLE tus_uploads ADD COLUMN IF NOT EXISTS uploaded_by TEXT;
+CREATE INDEX IF NOT EXISTS idx_documents_uploaded_by ON documents(uploaded_by) WHERE uploaded_by IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS quotas (
+    scope               TEXT NOT NULL CHECK (scope IN ('project', 'user')),
+    name                TEXT NOT NULL,
+    max_documents       BIGINT,
+    max_storage_bytes   BIGINT,
+    max_uploads_per_day BIGINT,
+    updated_at          TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (scope, name)
+);
@@ -0,0 +1,14 @@
+-- Reusable annotation templates ("stamps"): a subgraph of components, nodes, and connections
+-- saved with coordinates relative to its top-left corner, stamped into documents at an offset.
+CREATE TABLE IF NOT EXISTS templates (
+    id          TEXT PRIMARY KEY,
+    project     TEXT NOT NULL DEFAULT 'default',
+    name        TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    width       INT NOT NULL,
+    height      INT NOT NULL,
+    graph       JSONB NOT NULL,
+    created_by  TEXT,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (project, name)
+);
@@ -0,0 +1,36 @@
+-- Catalog of known component types. components.catalog_id links a component to the entry whose
+-- label or one of whose aliases matches its label (case-insensitively); the trigger keeps the
+-- link current as labels change, and the API relinks components when the catalog changes.
+CREATE TABLE IF NOT EXISTS symbol_catalog (
+    id              TEXT PRIMARY KEY,
+    label           TEXT NOT NULL,
+    aliases         TEXT[] NOT NULL DEFAULT '{}',
+    domain          TEXT NOT NULL DEFAULT '',
+    metadata        JSONB NOT NULL DEFAULT '{}',
+    reference_image TEXT,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at      TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_symbol_catalog_label ON symbol_catalog(lower(label));
+
+ALTER TABLE components ADD COLUMN IF NOT EXISTS catalog_id TEXT REFERENCES symbol_catalog(id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS idx_components_catalog ON components(catalog_id) WHERE catalog_id IS NOT NULL;
+
+CREATE OR REPLACE FUNCTION catalog_entry(component_label TEXT) RETURNS TEXT AS $$
+    SELECT id FROM symbol_catalog
+    WHERE lower(symbol_catalog.label) = lower($1)
+       OR lower($1) = ANY (SELECT lower(a) FROM unnest(aliases) a)
+    ORDER BY lower(symbol_catalog.label) = lower($1) DESC, id
+    LIMIT 1
+$$ LANGUAGE sql STABLE;
+
+CREATE OR REPLACE FUNCTION link_catalog() RETURNS trigger AS $$
+BEGIN
+    NEW.catalog_id := catalog_entry(NEW.label);
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS components_link_catalog ON components;
+CREATE TRIGGER components_link_catalog BEFORE INSERT OR UPDATE OF label ON components
+    FOR EACH ROW EXECUTE FUNCTION link_catalog();
@@ -0,0 +1,5 @@
+-- Workflow status set by coordinators: only active documents are served by /tasks/next;
+-- on_hold parks documents pending a decision, archived takes them out of the campaign.
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'active'
+    CHECK (status IN ('active', 'on_hold', 'archived'));
+CREATE INDEX IF NOT EXISTS idx_documents_status ON documents(status) WHERE status <> 'active';
@@ -0,0 +1,4 @@
+-- Document ids are generated by the server instead of being taken from the file name, which is
+-- kept here as uploaded. Older documents get the name they were stored under.
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS original_filename TEXT;
+UPDATE documents SET original_filename = COALESCE(pdf_file, image_file) WHERE original_filename IS NULL;
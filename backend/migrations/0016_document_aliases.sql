@@ -0,0 +1,11 @@
+-- Documents keep their id for good; display_name is what people call them. Every name a
+-- document has been given stays in document_aliases so references made under it still resolve.
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS display_name TEXT;
+
+CREATE TABLE IF NOT EXISTS document_aliases (
+    alias       TEXT PRIMARY KEY,
+    document_id TEXT NOT NULL REFERENCES documents(document_id) ON DELETE CASCADE,
+    created_by  TEXT,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_document_aliases_document ON document_aliases(document_id);
@@ -0,0 +1,25 @@
+-- Files a document had before an upload with overwrite=true replaced them. Pages are kept as
+-- they were ({page_number, image_file, width, height, storage_key, sha256}) so the objects stay
+-- referenced.
+CREATE TABLE IF NOT EXISTS document_versions (
+    document_id       TEXT NOT NULL REFERENCES documents(document_id) ON DELETE CASCADE,
+    version           INTEGER NOT NULL,
+    image_file        TEXT NOT NULL,
+    pdf_file          TEXT,
+    original_format   TEXT,
+    original_filename TEXT,
+    num_pages         INTEGER,
+    width             INTEGER,
+    height            INTEGER,
+    sha256            TEXT,
+    size_bytes        BIGINT,
+    storage_key       TEXT,
+    pages             JSONB NOT NULL DEFAULT '[]',
+    replaced_by       TEXT,
+    replaced_at       TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (document_id, version)
+);
+
+-- Set on a document uploaded with new_version=true to the one it replaces
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS supersedes TEXT REFERENCES documents(document_id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS idx_documents_supersedes ON documents(supersedes) WHERE supersedes IS NOT NULL;
@@ -0,0 +1,3 @@
+-- Only admin keys may call /admin. Keys issued before roles existed are ordinary user keys.
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS role TEXT NOT NULL DEFAULT 'user'
+    CHECK (role IN ('user', 'admin'));
@@ -0,0 +1,2 @@
+-- Running jobs are reclaimed once their lease runs out (a worker that crashed never finishes them)
+CREATE INDEX IF NOT EXISTS idx_jobs_running ON jobs(started_at) WHERE status = 'running';
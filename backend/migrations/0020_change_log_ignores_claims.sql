@@ -0,0 +1,12 @@
+-- Claims and heartbeats are who has a document open, not a change to it: updates that touch only
+-- those columns stay out of change_log, so an open tab doesn't make /sync report the document
+-- every few seconds.
+DROP TRIGGER IF EXISTS documents_change_log ON documents;
+CREATE TRIGGER documents_change_log AFTER INSERT OR DELETE ON documents
+    FOR EACH ROW EXECUTE FUNCTION log_change();
+DROP TRIGGER IF EXISTS documents_change_log_update ON documents;
+CREATE TRIGGER documents_change_log_update AFTER UPDATE ON documents
+    FOR EACH ROW
+    WHEN ((to_jsonb(OLD) - 'claimed_by' - 'claimed_at' - 'heartbeat_at')
+        IS DISTINCT FROM (to_jsonb(NEW) - 'claimed_by' - 'claimed_at' - 'heartbeat_at'))
+    EXECUTE FUNCTION log_change();
@@ -0,0 +1,8 @@
+-- change_log is pruned after CHANGE_LOG_RETENTION. The horizon is the newest position pruned so
+-- far; a /sync cursor or timestamp before it has missed changes and gets 410.
+CREATE TABLE IF NOT EXISTS change_log_horizon (
+    id          BOOLEAN PRIMARY KEY DEFAULT true CHECK (id),
+    txid        xid8 NOT NULL,
+    seq         BIGINT NOT NULL,
+    changed_at  TIMESTAMPTZ NOT NULL
+);
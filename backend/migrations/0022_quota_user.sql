@@ -0,0 +1,7 @@
+-- Per-user quotas count documents by the API key owner that uploaded them ('anonymous' without
+-- a key), not by the self-declared annotator in uploaded_by.
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS quota_user TEXT;
+UPDATE documents SET quota_user = uploaded_by WHERE quota_user IS NULL AND uploaded_by IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_documents_quota_user ON documents(quota_user, created_at) WHERE quota_user IS NOT NULL;
+
+ALTER TABLE tus_uploads ADD COLUMN IF NOT EXISTS quota_user TEXT;
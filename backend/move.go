@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ---------- Moving Documents ----------
+
+// POST /documents/{id}/move?annotator= {"project": "<target>", "keep_split": false} moves a
+// document uploaded into the wrong project. Files are content-addressed and per-project counts
+// (usage, stats, quotas) are computed from documents.project, so the move is a single row update.
+// The split is cleared, since it was drawn for the old project, unless keep_split is set. The
+// document must fit the target project's document and storage quotas.
+
+type MoveResult struct {
+	DocumentID string `json:"document_id"`
+	From       string `json:"from"`
+	To         string `json:"to"`
+	Split      string `json:"split,omitempty"`
+}
+
+// checkMoveQuota fails with a QuotaError when project cannot take another document of size bytes
+func checkMoveQuota(ctx context.Context, project string, size int64) error {
+	u, err := quotaUsage(ctx, "project", project)
+	if err != nil {
+		return err
+	}
+	switch l := u.Limits; {
+	case l.MaxStorageBytes > 0 && u.StorageBytes+size > l.MaxStorageBytes:
+		return &QuotaError{"project", project, "max_storage_bytes", l.MaxStorageBytes, u.StorageBytes}
+	case l.MaxDocuments > 0 && u.Documents >= l.MaxDocuments:
+		return &QuotaError{"project", project, "max_documents", l.MaxDocuments, u.Documents}
+	}
+	return nil
+}
+
+// moveDocument reassigns docID to project in one transaction and records a document.moved event
+func moveDocument(ctx context.Context, docID, project, actor string, keepSplit bool) (*MoveResult, error) {
+	res := &MoveResult{DocumentID: docID, To: project}
+	err := inTx(ctx, "move_document", func(tx pgx.Tx) error {
+		var size int64
+		err := tx.QueryRow(ctx, "SELECT project, COALESCE(size_bytes, 0) FROM documents WHERE document_id = $1 FOR UPDATE",
+			docID).Scan(&res.From, &size)
+		if err != nil {
+			return err
+		}
+		if res.From == project {
+			return nil
+		}
+		if err := checkMoveQuota(ctx, project, size); err != nil {
+			return err
+		}
+		err = tx.QueryRow(ctx, `
+			UPDATE documents SET project = $2, split = CASE WHEN $3 THEN split END
+			WHERE document_id = $1 RETURNING COALESCE(split, '')`, docID, project, keepSplit).Scan(&res.Split)
+		if err != nil {
+			return err
+		}
+		return enqueueEvents(ctx, tx, newEvent("document.moved", docID, map[string]string{
+			"from": res.From, "to": project, "moved_by": actor,
+		}))
+	})
+	return res, err
+}
+
+func handleMoveDocument(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		jsonError(w, http.StatusMethodNotAllowed, "POST only")
+		return
+	}
+	docID := r.PathValue("id")
+	var req struct {
+		Project   string `json:"project"`
+		KeepSplit bool   `json:"keep_split"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+	req.Project = strings.TrimSpace(req.Project)
+	if req.Project == "" {
+		jsonError(w, http.StatusBadRequest, "project is required")
+		return
+	}
+
+	res, err := moveDocument(r.Context(), docID, req.Project, requestUser(r), req.KeepSplit)
+	if errors.Is(err, pgx.ErrNoRows) {
+		problemError(w, http.StatusNotFound, codeDocumentNotFound, "Document not found")
+		return
+	}
+	if quotaExceededError(w, err) {
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Moving document failed", "document_id", docID, "project", req.Project, "error", err)
+		jsonError(w, http.StatusInternalServerError, "Failed to move document")
+		return
+	}
+	if res.From != res.To {
+		documentCache.forget(docID)
+		slog.InfoContext(r.Context(), "Document moved", "document_id", docID, "from", res.From, "to", res.To)
+	}
+	jsonResponse(w, http.StatusOK, res)
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"image"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+// ---------- Graph Normalization ----------
+
+// autoNodeRadius lets line endpoints that land this close to an existing node share it
+var autoNodeRadius = envInt("SUBMIT_AUTO_NODE_RADIUS", 2)
+
+// queryFlag reads a boolean query parameter such as ?auto_nodes=1
+func queryFlag(v string) bool {
+	b, _ := strconv.ParseBool(v)
+	return b
+}
+
+// addEndpointNodes creates nodes at both ends of every line annotation submitted without
+// endpoints and wires the line to them. Endpoints within autoNodeRadius of a node on the same
+// page (submitted or created here) reuse that node. Returns the number of nodes created.
+func addEndpointNodes(payload *SubmitPayload) int {
+	type pageNode struct {
+		id   string
+		page int
+		pt   image.Point
+	}
+	var nodes []pageNode
+	for _, ann := range payload.Annotations {
+		if ann.Type == "node" && len(ann.Position) == 2 {
+			nodes = append(nodes, pageNode{ann.ID, max(ann.Page, 1), image.Pt(ann.Position[0], ann.Position[1])})
+		}
+	}
+
+	nodeAt := func(page int, pt image.Point) (string, bool) {
+		for _, n := range nodes {
+			dx, dy := n.pt.X-pt.X, n.pt.Y-pt.Y
+			if n.page == page && dx*dx+dy*dy <= autoNodeRadius*autoNodeRadius {
+				return n.id, false
+			}
+		}
+		id := newID()
+		nodes = append(nodes, pageNode{id, page, pt})
+		return id, true
+	}
+
+	var created []RawAnnotation
+	for i := range payload.Annotations {
+		ann := &payload.Annotations[i]
+		if ann.Type != "line" || ann.SourceID != "" || ann.TargetID != "" {
+			continue
+		}
+		pts := polylinePoints(ann.Points)
+		if len(pts) < 2 {
+			continue
+		}
+		page := max(ann.Page, 1)
+		var isNew bool
+		for _, end := range []struct {
+			pt  image.Point
+			ref *string
+		}{{pts[0], &ann.SourceID}, {pts[len(pts)-1], &ann.TargetID}} {
+			*end.ref, isNew = nodeAt(page, end.pt)
+			if isNew {
+				created = append(created, RawAnnotation{
+					ID: *end.ref, Type: "node", Position: []int{end.pt.X, end.pt.Y}, Page: page, RegionID: ann.RegionID,
+					Origin: Origin{Provenance: "auto"},
+				})
+			}
+		}
+	}
+	payload.Annotations = append(payload.Annotations, created...)
+	return len(created)
+}
+
+// nodeMergeEpsilon is the default distance (pixels) under which nodes are considered one junction
+var nodeMergeEpsilon = envFloat("GRAPH_MERGE_EPSILON", 5)
+
+// NodeMerge describes one group of nodes collapsed into a single node
+type NodeMerge struct {
+	Kept     string   `json:"kept"`
+	Merged   []string `json:"merged"`
+	Position []int    `json:"position"`
+	Page     int      `json:"page"`
+}
+
+// planNodeMerges clusters nodes on the same page whose positions are within epsilon of each other
+// (transitively). The node listed first in each cluster is kept and moved to the cluster centroid.
+func planNodeMerges(nodes []Node, epsilon float64) []NodeMerge {
+	parent := make([]int, len(nodes))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	eps2 := epsilon * epsilon
+	for i := range nodes {
+		for j := i + 1; j < len(nodes); j++ {
+			a, b := nodes[i], nodes[j]
+			if a.Page != b.Page || len(a.Position) != 2 || len(b.Position) != 2 {
+				continue
+			}
+			dx, dy := float64(a.Position[0]-b.Position[0]), float64(a.Position[1]-b.Position[1])
+			if dx*dx+dy*dy <= eps2 {
+				if ri, rj := find(i), find(j); ri != rj {
+					parent[max(ri, rj)] = min(ri, rj)
+				}
+			}
+		}
+	}
+
+	groups := map[int][]int{}
+	var roots []int
+	for i := range nodes {
+		r := find(i)
+		if _, ok := groups[r]; !ok {
+			roots = append(roots, r)
+		}
+		groups[r] = append(groups[r], i)
+	}
+
+	merges := []NodeMerge{}
+	for _, r := range roots {
+		members := groups[r]
+		if len(members) < 2 {
+			continue
+		}
+		m := NodeMerge{Kept: nodes[r].ID, Page: nodes[r].Page}
+		sx, sy := 0, 0
+		for _, i := range members {
+			sx += nodes[i].Position[0]
+			sy += nodes[i].Position[1]
+			if i != r {
+				m.Merged = append(m.Merged, nodes[i].ID)
+			}
+		}
+		m.Position = []int{(sx + len(members)/2) / len(members), (sy + len(members)/2) / len(members)}
+		merges = append(merges, m)
+	}
+	return merges
+}
+
+// handleNormalizeGraph merges nodes that sit within epsilon pixels of each other and rewires their
+// connections: POST /documents/{id}/graph/normalize {"epsilon": 5, "dry_run": false}
+// Connections left joining a node to itself by the merge are removed.
+func handleNormalizeGraph(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		jsonError(w, http.StatusMethodNotAllowed, "POST only")
+		return
+	}
+	docID := r.PathValue("id")
+
+	req := struct {
+		Epsilon *float64 `json:"epsilon"`
+		DryRun  bool     `json:"dry_run"`
+	}{}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+			jsonError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+	}
+	epsilon := nodeMergeEpsilon
+	if req.Epsilon != nil {
+		epsilon = *req.Epsilon
+	}
+	if epsilon < 0 {
+		jsonError(w, http.StatusBadRequest, "epsilon must be non-negative")
+		return
+	}
+
+	var exists bool
+	db.QueryRowContext(r.Context(), "SELECT EXISTS (SELECT 1 FROM documents WHERE document_id = $1)", docID).Scan(&exists)
+	if !exists {
+		problemError(w, http.StatusNotFound, codeDocumentNotFound, "Document not found")
+		return
+	}
+
+	graph := loadGraph(r.Context(), docID)
+	merges := planNodeMerges(graph.Nodes, epsilon)
+
+	keptFor := map[string]string{}
+	var mergedIDs []string
+	for _, m := range merges {
+		for _, id := range m.Merged {
+			keptFor[id] = m.Kept
+			mergedIDs = append(mergedIDs, id)
+		}
+	}
+	resolve := func(id string) string {
+		if kept, ok := keptFor[id]; ok {
+			return kept
+		}
+		return id
+	}
+	removed := []string{}
+	for _, c := range graph.Connections {
+		if c.SourceID == "" || c.SourceID == c.TargetID {
+			continue // already degenerate; left for /validate to report
+		}
+		if resolve(c.SourceID) == resolve(c.TargetID) {
+			removed = append(removed, c.ID)
+		}
+	}
+
+	if !req.DryRun && len(merges) > 0 {
+		if err := applyNodeMerges(r.Context(), docID, merges, mergedIDs, removed); err != nil {
+			slog.ErrorContext(r.Context(), "Graph normalize failed", "document_id", docID, "error", err)
+			jsonError(w, http.StatusInternalServerError, "Failed to normalize graph")
+			return
+		}
+		slog.InfoContext(r.Context(), "Normalized graph", "document_id", docID, "merged_nodes", len(mergedIDs), "into", len(merges), "removed_connections", len(removed))
+	}
+
+	jsonResponse(w, http.StatusOK, map[string]interface{}{
+		"document_id":         docID,
+		"epsilon":             epsilon,
+		"dry_run":             req.DryRun,
+		"merges":              merges,
+		"nodes_removed":       len(mergedIDs),
+		"removed_connections": removed,
+	})
+}
+
+// applyNodeMerges rewrites references to merged nodes and deletes them in one transaction
+func applyNodeMerges(ctx context.Context, docID string, merges []NodeMerge, mergedIDs, removedConns []string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if len(removedConns) > 0 {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM connections WHERE document_id = $1 AND id = ANY($2::text[])",
+			docID, removedConns); err != nil {
+			return err
+		}
+	}
+	for _, m := range merges {
+		if _, err := tx.ExecContext(ctx, "UPDATE nodes SET position = $1 WHERE document_id = $2 AND id = $3",
+			m.Position, docID, m.Kept); err != nil {
+			return err
+		}
+		for _, col := range []string{"source_id", "target_id"} {
+			if _, err := tx.ExecContext(ctx, "UPDATE connections SET "+col+" = $1 WHERE document_id = $2 AND "+col+" = ANY($3::text[])",
+				m.Kept, docID, m.Merged); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE text_annotations SET linked_to = $1 WHERE document_id = $2 AND linked_to = ANY($3::text[])",
+			m.Kept, docID, m.Merged); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM nodes WHERE document_id = $1 AND id = ANY($2::text[])",
+		docID, mergedIDs); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
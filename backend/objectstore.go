@@ -0,0 +1,218 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ---------- Storage Backends ----------
+
+// Storage holds the object store's files. Keys are slash-separated paths of the form
+// <h[:2]>/<h><ext>; Get and ModTime return an error matching fs.ErrNotExist for a missing key.
+type Storage interface {
+	Put(key string, src io.Reader) error
+	Get(key string) (io.ReadCloser, error)
+	Delete(key string) error
+	List(prefix string) ([]string, error)
+	Exists(key string) (bool, error)
+	ModTime(key string) (time.Time, error)
+	Usage() (objects int, bytes int64, err error)
+}
+
+// presigner is implemented by remote stores that can hand clients a direct, time-limited URL
+type presigner interface {
+	PresignGet(key, filename string, ttl time.Duration) (string, error)
+}
+
+var (
+	// STORAGE_BACKEND selects where objects are kept: local (dataset/objects), s3, gcs, or azure
+	storageBackend = envString("STORAGE_BACKEND", "local")
+	// Lifetime of the direct URLs image requests are redirected to on remote stores
+	storagePresignTTL = envDuration("STORAGE_PRESIGN_TTL", 15*time.Minute)
+)
+
+// localObjects keeps objects under dataset/objects on the container filesystem
+var localObjects = localStorage{root: filepath.Join(datasetDir, objectsDir)}
+
+// objectCache holds local copies of remote objects for code that needs a real file. Objects never
+// change once written, so a cached copy never goes stale and the cache can be dropped at any time.
+var objectCache = localStorage{root: filepath.Join(datasetDir, "cache", objectsDir)}
+
+// store is the backend every object is written to and read from
+var store Storage = localObjects
+
+// openStorage connects the configured backend; called once at startup
+func openStorage() (Storage, error) {
+	switch storageBackend {
+	case "local":
+		return localObjects, nil
+	case "s3":
+		return newS3Storage()
+	case "gcs":
+		return newGCSStorage()
+	case "azure":
+		return newAzureStorage()
+	}
+	return nil, fmt.Errorf("unknown STORAGE_BACKEND %q (local, s3, gcs, or azure)", storageBackend)
+}
+
+// isRemoteStore reports whether objects live outside the container filesystem
+func isRemoteStore() bool {
+	_, local := store.(localStorage)
+	return !local
+}
+
+// cacheObject downloads a remote object into the local cache
+func cacheObject(key string) error {
+	rc, err := store.Get(key)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return objectCache.Put(key, rc)
+}
+
+// serveObject serves an object, redirecting to a presigned URL when the store supports one so
+// image bytes don't pass through the API server
+func serveObject(w http.ResponseWriter, r *http.Request, key, name string) {
+	if p, ok := store.(presigner); ok {
+		u, err := p.PresignGet(key, name, storagePresignTTL)
+		if err == nil {
+			w.Header().Set("Cache-Control", "private, no-cache")
+			http.Redirect(w, r, u, http.StatusFound)
+			return
+		}
+		slog.WarnContext(r.Context(), "Presigning failed, serving directly", "key", key, "error", err)
+	}
+	serveStoredFile(w, r, objectPath(key), name, objectHash(key))
+}
+
+type localStorage struct {
+	root string
+}
+
+func (s localStorage) path(key string) string {
+	return filepath.Join(s.root, filepath.FromSlash(key))
+}
+
+// Put writes to a temporary file in the destination directory and renames it into place, so
+// readers never see a partial object
+func (s localStorage) Put(key string, src io.Reader) error {
+	dst := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+
+	_, err = io.Copy(tmp, src)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+func (s localStorage) Get(key string) (io.ReadCloser, error) {
+	return os.Open(s.path(key))
+}
+
+func (s localStorage) Delete(key string) error {
+	err := os.Remove(s.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// List returns the keys starting with prefix, skipping in-progress temporary files
+func (s localStorage) List(prefix string) ([]string, error) {
+	var keys []string
+	err := filepath.WalkDir(s.root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() && p != s.root {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(s.root, p)
+		if err != nil {
+			return err
+		}
+		if key := filepath.ToSlash(rel); strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	sort.Strings(keys)
+	return keys, err
+}
+
+func (s localStorage) Exists(key string) (bool, error) {
+	_, err := os.Stat(s.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Usage counts the objects and their total size, skipping in-progress temporary files
+func (s localStorage) Usage() (int, int64, error) {
+	objects, bytes := 0, int64(0)
+	err := filepath.WalkDir(s.root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() && p != s.root {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		objects++
+		bytes += info.Size()
+		return nil
+	})
+	return objects, bytes, err
+}
+
+func (s localStorage) ModTime(key string) (time.Time, error) {
+	info, err := os.Stat(s.path(key))
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
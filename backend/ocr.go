@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ---------- OCR ----------
+
+var (
+	// tesseract runs the local CLI; http posts the page image to OCR_URL; none disables OCR
+	ocrEngineName    = envString("OCR_ENGINE", "tesseract")
+	ocrTesseractPath = envString("TESSERACT_PATH", "tesseract")
+	ocrLanguage      = envString("OCR_LANGUAGE", "eng")
+	ocrURL           = envString("OCR_URL", "")
+	ocrTimeout       = envDuration("OCR_TIMEOUT", 2*time.Minute)
+	ocrMinConfidence = envFloat("OCR_MIN_CONFIDENCE", 0.3)
+)
+
+var errOCRDisabled = errors.New("OCR is disabled (set OCR_ENGINE)")
+
+// ocrRegion is one line of recognized text in image pixel coordinates
+type ocrRegion struct {
+	BBox       []int   `json:"bbox"` // [x1, y1, x2, y2]
+	Text       string  `json:"text"`
+	Confidence float64 `json:"confidence"` // 0-1
+}
+
+// ocrEngine recognizes text lines in a page image
+type ocrEngine interface {
+	Recognize(ctx context.Context, imagePath string) ([]ocrRegion, error)
+}
+
+func newOCREngine() (ocrEngine, error) {
+	switch ocrEngineName {
+	case "tesseract":
+		return tesseractOCR{path: ocrTesseractPath, lang: ocrLanguage}, nil
+	case "http":
+		if ocrURL == "" {
+			return nil, errors.New("OCR_ENGINE=http requires OCR_URL")
+		}
+		return httpOCR{url: ocrURL}, nil
+	case "none", "":
+		return nil, errOCRDisabled
+	}
+	return nil, fmt.Errorf("unknown OCR_ENGINE %q", ocrEngineName)
+}
+
+// tesseractOCR runs the tesseract CLI with TSV output and groups words into lines
+type tesseractOCR struct {
+	path string
+	lang string
+}
+
+func (t tesseractOCR) Recognize(ctx context.Context, imagePath string) ([]ocrRegion, error) {
+	var stdout, stderr bytes.Buffer
+	// psm 11: sparse text, since schematic labels are scattered rather than laid out in paragraphs
+	cmd := exec.CommandContext(ctx, t.path, imagePath, "stdout", "-l", t.lang, "--psm", "11", "tsv")
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("running %s: %v: %s", t.path, err, strings.TrimSpace(stderr.String()))
+	}
+	return parseTesseractTSV(&stdout)
+}
+
+// parseTesseractTSV merges word rows (level 5) that share a block/paragraph/line into regions
+func parseTesseractTSV(r io.Reader) ([]ocrRegion, error) {
+	type line struct {
+		rect  image.Rectangle
+		words []string
+		conf  float64
+	}
+	lines := map[string]*line{}
+	var order []string
+
+	// Plain tab splitting rather than encoding/csv: recognized text may contain stray quotes
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		rec := strings.Split(sc.Text(), "\t")
+		if len(rec) < 12 || rec[0] != "5" { // header and non-word rows
+			continue
+		}
+		text := strings.TrimSpace(rec[11])
+		conf, _ := strconv.ParseFloat(rec[10], 64)
+		if text == "" || conf < 0 {
+			continue
+		}
+		var n [4]int
+		for i := range n {
+			n[i], _ = strconv.Atoi(rec[6+i])
+		}
+		rect := image.Rect(n[0], n[1], n[0]+n[2], n[1]+n[3])
+
+		key := strings.Join(rec[1:5], "/")
+		l, ok := lines[key]
+		if !ok {
+			l = &line{rect: rect}
+			lines[key] = l
+			order = append(order, key)
+		}
+		l.rect = l.rect.Union(rect)
+		l.words = append(l.words, text)
+		l.conf += conf
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("reading tesseract output: %w", err)
+	}
+
+	regions := make([]ocrRegion, 0, len(order))
+	for _, key := range order {
+		l := lines[key]
+		regions = append(regions, ocrRegion{
+			BBox:       []int{l.rect.Min.X, l.rect.Min.Y, l.rect.Max.X, l.rect.Max.Y},
+			Text:       strings.Join(l.words, " "),
+			Confidence: l.conf / float64(len(l.words)) / 100,
+		})
+	}
+	return regions, nil
+}
+
+// httpOCR posts the page PNG to an external service, which answers
+// {"regions": [{"bbox": [x1, y1, x2, y2], "text": "...", "confidence": 0.93}, ...]}
+type httpOCR struct {
+	url string
+}
+
+func (h httpOCR) Recognize(ctx context.Context, imagePath string) ([]ocrRegion, error) {
+	f, err := os.Open(imagePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, f)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "image/png")
+	forwardRequestID(req)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("calling OCR service: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("OCR service returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var out struct {
+		Regions []ocrRegion `json:"regions"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("decoding OCR response: %w", err)
+	}
+	return out.Regions, nil
+}
+
+// ocrSuggestions turns OCR regions into text suggestions. Lines that fall inside an existing text
+// box with no transcription become a draft raw_text for that box; lines inside already
+// transcribed boxes are dropped; everything else is suggested as a new text annotation.
+func ocrSuggestions(docID string, page int, regions []ocrRegion, texts []TextAnnotation) []Suggestion {
+	suggestions := []Suggestion{}
+	drafts := map[string][]ocrRegion{}
+
+	for _, reg := range regions {
+		if len(reg.BBox) != 4 || reg.Confidence < ocrMinConfidence || strings.TrimSpace(reg.Text) == "" {
+			continue
+		}
+		cx, cy := (reg.BBox[0]+reg.BBox[2])/2, (reg.BBox[1]+reg.BBox[3])/2
+
+		var target *TextAnnotation
+		for i := range texts {
+			t := &texts[i]
+			if t.Page == page && len(t.BBox) == 4 &&
+				cx >= t.BBox[0] && cx <= t.BBox[2] && cy >= t.BBox[1] && cy <= t.BBox[3] {
+				target = t
+				break
+			}
+		}
+		switch {
+		case target == nil:
+			suggestions = append(suggestions, Suggestion{
+				ID: newID(), DocumentID: docID, Page: page, Type: "text",
+				BBox: reg.BBox, RawText: reg.Text, Confidence: reg.Confidence, ModelName: ocrEngineName,
+			})
+		case target.RawText == "":
+			drafts[target.ID] = append(drafts[target.ID], reg)
+		}
+	}
+
+	// Several OCR lines can land in one box; join them top-to-bottom
+	for id, regs := range drafts {
+		sort.Slice(regs, func(i, j int) bool { return regs[i].BBox[1] < regs[j].BBox[1] })
+		parts := make([]string, len(regs))
+		var conf float64
+		for i, r := range regs {
+			parts[i] = r.Text
+			conf += r.Confidence
+		}
+		var bbox []int
+		for _, t := range texts {
+			if t.ID == id {
+				bbox = t.BBox
+			}
+		}
+		suggestions = append(suggestions, Suggestion{
+			ID: newID(), DocumentID: docID, Page: page, Type: "text", AnnotationID: id,
+			BBox: bbox, RawText: strings.Join(parts, "\n"), Confidence: conf / float64(len(regs)),
+			ModelName: ocrEngineName,
+		})
+	}
+	return suggestions
+}
+
+// handleDocumentOCR runs OCR on a page and stores the results as pending suggestions,
+// replacing earlier OCR suggestions for that page: POST /documents/{id}/ocr?page=N
+func handleDocumentOCR(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		jsonError(w, http.StatusMethodNotAllowed, "POST only")
+		return
+	}
+	docID := r.PathValue("id")
+	page, err := pageParam(r)
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	engine, err := newOCREngine()
+	if err != nil {
+		jsonError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	sp, err := loadStoredPage(r.Context(), docID, page)
+	if err != nil {
+		jsonError(w, http.StatusNotFound, "Document or page not found")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), ocrTimeout)
+	defer cancel()
+	start := time.Now()
+	regions, err := engine.Recognize(ctx, sp.Path)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "OCR failed", "document_id", docID, "page", page, "error", err)
+		jsonError(w, http.StatusBadGateway, "OCR failed: "+err.Error())
+		return
+	}
+
+	_, texts := loadAnnotations(r.Context(), docID)
+	suggestions := ocrSuggestions(docID, page, regions, texts)
+	for i := range suggestions {
+		suggestions[i].Source, suggestions[i].Status = "ocr", "pending"
+		suggestions[i].CreatedAt = time.Now().UTC().Format(time.RFC3339)
+	}
+	if err := replacePendingSuggestions(r.Context(), docID, page, "ocr", suggestions); err != nil {
+		slog.ErrorContext(r.Context(), "Saving OCR suggestions failed", "document_id", docID, "error", err)
+		jsonError(w, http.StatusInternalServerError, "Failed to save suggestions")
+		return
+	}
+
+	slog.InfoContext(r.Context(), "OCR finished", "document_id", docID, "page", page, "regions", len(regions),
+		"suggestions", len(suggestions), "duration_ms", time.Since(start).Milliseconds())
+	jsonResponse(w, http.StatusOK, map[string]interface{}{
+		"document_id": docID,
+		"page":        page,
+		"engine":      ocrEngineName,
+		"suggestions": suggestions,
+	})
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/openapi3gen"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/legacy"
+	"github.com/swaggest/swgui/v5emb"
+)
+
+// ---------- OpenAPI ----------
+
+// /openapi.json is an OpenAPI 3 description of the REST API. Request and response schemas are
+// generated from the Go types the handlers decode and encode (SubmitPayload, OutputJSON, ...),
+// so the contract changes with the code rather than drifting from it. /docs/ serves Swagger UI
+// over it.
+//
+// Requests to the operations listed in apiOperations are checked against the spec before they
+// reach the handler: parameter types and the shape of JSON bodies. Rules the schema can't express
+// (annotation types, bbox bounds, ...) are still enforced by the handlers.
+var openapiValidate = envBool("OPENAPI_VALIDATE", true)
+
+// apiOperation is one documented method and path
+type apiOperation struct {
+	Method  string
+	Path    string // OpenAPI template, e.g. /documents/{id}
+	Summary string
+	Params  []*openapi3.Parameter // path parameters are added from Path
+	Body    interface{}           // JSON request body type
+	Form    *openapi3.Schema      // multipart/form-data request body
+	Result  interface{}           // JSON 200 body type
+	Media   string                // non-JSON 200 body, e.g. image/*
+}
+
+func queryParam(name, description string, schema *openapi3.Schema) *openapi3.Parameter {
+	return openapi3.NewQueryParameter(name).WithDescription(description).WithSchema(schema)
+}
+
+// documentViewParams are the query parameters parseDocumentView reads
+var documentViewParams = []*openapi3.Parameter{
+	queryParam("include", "Comma-separated annotation sections to load: graph, text", openapi3.NewStringSchema()),
+	queryParam("fields", "Comma-separated top-level fields to return: "+strings.Join(sortedKeys(documentFields), ", "), openapi3.NewStringSchema()),
+	queryParam("coords", "absolute (default) or relative", openapi3.NewStringSchema()),
+}
+
+var apiOperations = []apiOperation{
+	{
+		Method: http.MethodPost, Path: "/upload", Summary: "Upload a PNG, JPEG, TIFF, WebP, or PDF as a new document",
+		Params: []*openapi3.Parameter{
+			queryParam("project", "Project to file the document under", openapi3.NewStringSchema()),
+			queryParam("annotator", "Uploader, counted against per-user quotas", openapi3.NewStringSchema()),
+			queryParam("document_id", "Replace the file of this existing document instead of creating one", openapi3.NewStringSchema()),
+			queryParam("allow_duplicate", "Register the file even if the project already has a document with the same content", openapi3.NewBoolSchema()),
+			queryParam("overwrite", "With document_id, replace its file and keep the old one as a version", openapi3.NewBoolSchema()),
+			queryParam("new_version", "With document_id, upload a new document that supersedes it", openapi3.NewBoolSchema()),
+		},
+		Form: openapi3.NewObjectSchema().
+			WithProperty("project", openapi3.NewStringSchema()).
+			WithProperty("file", openapi3.NewStringSchema().WithFormat("binary")).
+			WithRequired([]string{"file"}),
+		Result: UploadResponse{},
+	},
+	{
+		Method: http.MethodPost, Path: "/submit", Summary: "Replace a document's annotations",
+		Params: []*openapi3.Parameter{
+			queryParam("out_of_bounds", "reject or clamp coordinates outside the image (default SUBMIT_BOUNDS_MODE)", openapi3.NewStringSchema()),
+			queryParam("simplify", "Line simplification tolerance in pixels", openapi3.NewFloat64Schema().WithMin(0)),
+			queryParam("overlap_iou", "IoU above which overlapping boxes are reported", openapi3.NewFloat64Schema()),
+			queryParam("auto_nodes", "Create nodes for line endpoints", openapi3.NewBoolSchema()),
+		},
+		Body:   SubmitPayload{},
+		Result: SubmitResponse{},
+	},
+	{
+		Method: http.MethodGet, Path: "/documents", Summary: "List documents, newest first",
+		Params: []*openapi3.Parameter{
+			queryParam("project", "", openapi3.NewStringSchema()),
+			queryParam("split", "train, val, or test", openapi3.NewStringSchema()),
+			queryParam("predicted_by", "Only documents this model made suggestions for", openapi3.NewStringSchema()),
+			queryParam("model_version", "With predicted_by, only suggestions from this version", openapi3.NewStringSchema()),
+		},
+		Result: DocumentList{},
+	},
+	{
+		Method: http.MethodGet, Path: "/documents/{id}", Summary: "Get a document with its annotations",
+		Params: documentViewParams,
+		Result: OutputJSON{},
+	},
+	{
+		Method: http.MethodPost, Path: "/documents/batch", Summary: "Get many documents in one request",
+		Params: append([]*openapi3.Parameter{queryParam("stream", "1 for newline-delimited JSON", openapi3.NewStringSchema())}, documentViewParams...),
+		Body:   batchFetchRequest{},
+		Result: BatchFetchResponse{},
+	},
+	{
+		Method: http.MethodGet, Path: "/documents/{id}/image", Summary: "Get a page image",
+		Params: []*openapi3.Parameter{queryParam("page", "Page number, from 1", openapi3.NewIntegerSchema().WithMin(1))},
+		Media:  "image/*",
+	},
+	{
+		Method: http.MethodGet, Path: "/documents/{id}/thumbnail", Summary: "Get a JPEG preview of page 1",
+		Media: "image/jpeg",
+	},
+}
+
+// apiSchemaNullable marks lists, maps, and free-form values as nullable, since encoding/json
+// accepts and writes null for them
+func apiSchemaNullable(_ string, t reflect.Type, _ reflect.StructTag, schema *openapi3.Schema) error {
+	switch t.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Interface:
+		schema.Nullable = true
+	case reflect.Struct:
+		// Bodies are decoded with DisallowUnknownFields
+		if schema.Type.Is(openapi3.TypeObject) {
+			schema.AdditionalProperties = openapi3.AdditionalProperties{Has: openapi3.BoolPtr(false)}
+		}
+	}
+	return nil
+}
+
+// buildOpenAPI assembles the spec from apiOperations
+func buildOpenAPI() (*openapi3.T, error) {
+	doc := &openapi3.T{
+		OpenAPI: "3.0.3",
+		Info: &openapi3.Info{
+			Title:       "Corvina API",
+			Version:     "1",
+			Description: "Errors are RFC 7807 problem details; branch on code.",
+		},
+		Servers:    openapi3.Servers{{URL: "/api/v" + strconv.Itoa(currentAPIVersion)}},
+		Paths:      openapi3.NewPaths(),
+		Components: &openapi3.Components{Schemas: openapi3.Schemas{}},
+	}
+	gen := openapi3gen.NewGenerator(
+		openapi3gen.SchemaCustomizer(apiSchemaNullable),
+		openapi3gen.CreateComponentSchemas(openapi3gen.ExportComponentSchemasOptions{ExportComponentSchemas: true, ExportTopLevelSchema: true}),
+	)
+	schemaFor := func(v interface{}) (*openapi3.SchemaRef, error) {
+		return gen.NewSchemaRefForValue(v, doc.Components.Schemas)
+	}
+
+	problem, err := schemaFor(Problem{})
+	if err != nil {
+		return nil, err
+	}
+	problemResponse := openapi3.NewResponse().WithDescription("Problem details").
+		WithContent(openapi3.Content{"application/problem+json": openapi3.NewMediaType().WithSchemaRef(problem)})
+
+	for _, op := range apiOperations {
+		o := openapi3.NewOperation()
+		o.Summary = op.Summary
+		o.OperationID = strings.ToLower(op.Method) + strings.NewReplacer("/", "_", "{", "", "}", "").Replace(op.Path)
+		for _, seg := range strings.Split(op.Path, "/") {
+			if name, ok := strings.CutPrefix(seg, "{"); ok {
+				o.AddParameter(openapi3.NewPathParameter(strings.TrimSuffix(name, "}")).WithSchema(openapi3.NewStringSchema()))
+			}
+		}
+		for _, p := range op.Params {
+			o.AddParameter(p)
+		}
+
+		switch {
+		case op.Body != nil:
+			body, err := schemaFor(op.Body)
+			if err != nil {
+				return nil, err
+			}
+			o.RequestBody = &openapi3.RequestBodyRef{Value: openapi3.NewRequestBody().WithRequired(true).WithJSONSchemaRef(body)}
+		case op.Form != nil:
+			o.RequestBody = &openapi3.RequestBodyRef{Value: openapi3.NewRequestBody().WithRequired(true).
+				WithContent(openapi3.NewContentWithFormDataSchema(op.Form))}
+		}
+
+		ok := openapi3.NewResponse().WithDescription("OK")
+		if op.Result != nil {
+			result, err := schemaFor(op.Result)
+			if err != nil {
+				return nil, err
+			}
+			ok.WithJSONSchemaRef(result)
+		} else {
+			ok.WithContent(openapi3.Content{op.Media: openapi3.NewMediaType().WithSchema(openapi3.NewStringSchema().WithFormat("binary"))})
+		}
+		o.AddResponse(http.StatusOK, ok)
+		o.Responses.Set("default", &openapi3.ResponseRef{Value: problemResponse})
+		doc.AddOperation(op.Path, op.Method, o)
+	}
+
+	// Batch documents are rendered through ?fields=, so the Go type can't name them
+	if batch := doc.Components.Schemas["BatchFetchResponse"]; batch != nil {
+		batch.Value.Properties["documents"].Value.Items = openapi3.NewSchemaRef("#/components/schemas/OutputJSON", nil)
+	}
+	return doc, nil
+}
+
+var (
+	openapiDoc    *openapi3.T
+	openapiJSON   []byte
+	openapiRouter routers.Router
+)
+
+// init builds the spec and loads it back from its JSON, which resolves the $refs between
+// schemas, so requests are validated against exactly what /openapi.json serves
+func init() {
+	doc, err := buildOpenAPI()
+	if err == nil {
+		openapiJSON, err = json.Marshal(doc)
+	}
+	if err == nil {
+		openapiDoc, err = openapi3.NewLoader().LoadFromData(openapiJSON)
+	}
+	if err == nil {
+		err = openapiDoc.Validate(context.Background())
+	}
+	if err == nil {
+		// apiVersions has already taken the server prefix off the path
+		unprefixed := *openapiDoc
+		unprefixed.Servers = nil
+		openapiRouter, err = legacy.NewRouter(&unprefixed)
+	}
+	if err != nil {
+		panic("openapi: " + err.Error())
+	}
+}
+
+// handleOpenAPI serves the spec: GET /openapi.json
+func handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		jsonError(w, http.StatusMethodNotAllowed, "GET only")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openapiJSON)
+}
+
+// swaggerUI serves Swagger UI under /docs/, with its assets embedded in the binary
+var swaggerUI = v5emb.New("Corvina API", "/openapi.json", "/docs/")
+
+// validateRequests checks requests to documented operations against the spec
+func validateRequests(next http.Handler) http.Handler {
+	if !openapiValidate {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route, pathParams, err := openapiRouter.FindRoute(r)
+		if err != nil {
+			next.ServeHTTP(w, r) // undocumented; the handler answers 404 or 405 itself
+			return
+		}
+
+		// Multipart uploads stream into storage and are checked by the handler
+		isJSON := strings.HasPrefix(r.Header.Get("Content-Type"), "application/json")
+		if isJSON {
+			limitRequestBody(w, r, submitMaxBytes)
+		}
+		err = openapi3filter.ValidateRequest(r.Context(), &openapi3filter.RequestValidationInput{
+			Request:    r,
+			PathParams: pathParams,
+			Route:      route,
+			Options: &openapi3filter.Options{
+				ExcludeRequestBody: !isJSON,
+				AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+			},
+		})
+		if err != nil {
+			specViolation(w, err)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// specViolation answers a request that doesn't match the spec: 400 for parameters and malformed
+// JSON, 422 for a body of the wrong shape, as decodeSubmitPayload does
+func specViolation(w http.ResponseWriter, err error) {
+	if isTooLarge(err) {
+		tooLargeError(w, "Request body", submitMaxBytes)
+		return
+	}
+	status, fe := http.StatusBadRequest, FieldError{Message: err.Error()}
+	var reqErr *openapi3filter.RequestError
+	if errors.As(err, &reqErr) {
+		fe.Message = reqErr.Reason
+		if reqErr.Parameter != nil {
+			fe.Field = reqErr.Parameter.Name
+		}
+	}
+	var schemaErr *openapi3.SchemaError
+	if errors.As(err, &schemaErr) {
+		fe.Message = schemaErr.Reason
+		if ptr := schemaErr.JSONPointer(); len(ptr) > 0 {
+			fe.Field = strings.Join(ptr, ".")
+		}
+		if reqErr != nil && reqErr.RequestBody != nil {
+			status = http.StatusUnprocessableEntity
+		}
+	}
+	if schemaErr == nil && reqErr != nil && reqErr.Err != nil {
+		fe.Message = strings.TrimPrefix(reqErr.Reason+": "+reqErr.Err.Error(), ": ")
+	}
+	detail := "Request does not match the API specification"
+	if fe.Field != "" {
+		detail += ": " + fe.Field + " " + fe.Message
+	} else {
+		detail += ": " + fe.Message
+	}
+	problemError(w, status, codeSchemaViolation, detail, fe)
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ---------- Outbox and Webhooks ----------
+
+// Events are inserted into the outbox table in the transaction that makes the change, so an
+// event exists exactly when its change committed. The dispatcher then POSTs each one to every
+// WEBHOOK_URLS entry and publishes it to EVENT_BUS (see eventbus.go), retrying failures with
+// backoff. Delivery is at least once: a crash between a receiver's 2xx and marking the row
+// delivered sends it again, so receivers should drop repeats of an event ID they have already
+// seen.
+var (
+	// Comma-separated
+	webhookURLs = parseCSV(envString("WEBHOOK_URLS", ""))
+	// Signs each body into X-Corvina-Signature (sha256=<hex HMAC>) when set
+	webhookSecret       = envString("WEBHOOK_SECRET", "")
+	webhookTimeout      = envDuration("WEBHOOK_TIMEOUT", 10*time.Second)
+	webhookMaxAttempts  = envInt("WEBHOOK_MAX_ATTEMPTS", 10)
+	webhookRetryDelay   = envDuration("WEBHOOK_RETRY_DELAY", 10*time.Second)
+	outboxPollInterval  = envDuration("OUTBOX_POLL_INTERVAL", time.Second)
+	outboxRetention     = envDuration("OUTBOX_RETENTION", 7*24*time.Hour)
+	webhookMaxRetryWait = time.Hour
+)
+
+var webhookClient = &http.Client{Timeout: webhookTimeout}
+
+// outboxEvent is one notification, sent as the webhook body
+type outboxEvent struct {
+	ID         string      `json:"id"`
+	Type       string      `json:"type"`
+	DocumentID string      `json:"document_id,omitempty"`
+	CreatedAt  time.Time   `json:"created_at"`
+	Data       interface{} `json:"data"`
+}
+
+func newEvent(eventType, docID string, data interface{}) outboxEvent {
+	return outboxEvent{ID: newID(), Type: eventType, DocumentID: docID, CreatedAt: time.Now().UTC(), Data: data}
+}
+
+// eventDestinations lists where each event goes; with none, no events are recorded
+func eventDestinations() []string {
+	dests := webhookURLs
+	if eventBus != "" {
+		dests = append([]string{busDestination}, dests...)
+	}
+	return dests
+}
+
+// enqueueEvents writes events to the outbox as part of tx, one row per destination
+func enqueueEvents(ctx context.Context, tx pgx.Tx, events ...outboxEvent) error {
+	dests := eventDestinations()
+	if len(dests) == 0 {
+		return nil
+	}
+	for _, ev := range events {
+		body, err := json.Marshal(ev)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, `
+			INSERT INTO outbox (event_id, event_type, document_id, payload, destination, created_at)
+			SELECT $1, $2, NULLIF($3, ''), $4, dest, $5 FROM unnest($6::text[]) AS dest
+		`, ev.ID, ev.Type, ev.DocumentID, string(body), ev.CreatedAt, dests)
+		if err != nil {
+			return fmt.Errorf("outbox: %w", err)
+		}
+	}
+	return nil
+}
+
+// runOutboxDispatcher delivers due outbox rows until ctx is cancelled, and prunes delivered rows
+// past OUTBOX_RETENTION
+func runOutboxDispatcher(ctx context.Context) {
+	ticker := time.NewTicker(outboxPollInterval)
+	defer ticker.Stop()
+	var lastPrune time.Time
+
+	for {
+		for ctx.Err() == nil && deliverNextEvent(ctx) {
+		}
+		if time.Since(lastPrune) > time.Hour {
+			lastPrune = time.Now()
+			if _, err := pool.Exec(ctx, "DELETE FROM outbox WHERE status = 'delivered' AND delivered_at < now() - $1 * interval '1 second'",
+				outboxRetention.Seconds()); err != nil {
+				slog.Error("Pruning outbox failed", "error", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// deliverNextEvent sends one due row; returns false when none is due. The row stays locked
+// while the request is in flight, so other instances skip it rather than sending it too.
+func deliverNextEvent(ctx context.Context) bool {
+	found := false
+	err := pgx.BeginFunc(ctx, pool, func(tx pgx.Tx) error {
+		var id int64
+		var eventID, eventType, docID, destination string
+		var payload []byte
+		var attempts int
+		err := tx.QueryRow(ctx, `
+			SELECT id, event_id::text, event_type, COALESCE(document_id, ''), payload, destination, attempts FROM outbox
+			WHERE status = 'pending' AND next_attempt_at <= now()
+			ORDER BY id FOR UPDATE SKIP LOCKED LIMIT 1
+		`).Scan(&id, &eventID, &eventType, &docID, &payload, &destination, &attempts)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		found = true
+		attempts++
+
+		// Once claimed, the attempt is recorded even if shutdown begins mid-request
+		var sendErr error
+		if destination == busDestination {
+			sendErr = publishEvent(context.WithoutCancel(ctx), eventID, eventType, docID, payload)
+		} else {
+			sendErr = postWebhook(context.WithoutCancel(ctx), destination, eventID, eventType, attempts, payload)
+		}
+		switch {
+		case sendErr == nil:
+			webhookDeliveries.WithLabelValues("delivered").Inc()
+			_, err = tx.Exec(ctx, "UPDATE outbox SET status = 'delivered', attempts = $2, last_error = NULL, delivered_at = now() WHERE id = $1",
+				id, attempts)
+		case attempts >= webhookMaxAttempts:
+			webhookDeliveries.WithLabelValues("failed").Inc()
+			slog.Error("Event delivery failed; giving up", "event_id", eventID, "destination", destination, "attempts", attempts, "error", sendErr)
+			_, err = tx.Exec(ctx, "UPDATE outbox SET status = 'failed', attempts = $2, last_error = $3 WHERE id = $1",
+				id, attempts, sendErr.Error())
+		default:
+			webhookDeliveries.WithLabelValues("retry").Inc()
+			delay := min(webhookRetryDelay<<min(attempts-1, 20), webhookMaxRetryWait)
+			slog.Warn("Event delivery failed; will retry", "event_id", eventID, "destination", destination, "attempts", attempts,
+				"retry_in", delay.String(), "error", sendErr)
+			_, err = tx.Exec(ctx, "UPDATE outbox SET attempts = $2, last_error = $3, next_attempt_at = now() + $4 * interval '1 second' WHERE id = $1",
+				id, attempts, sendErr.Error(), delay.Seconds())
+		}
+		return err
+	})
+	if err != nil {
+		if ctx.Err() == nil {
+			slog.Error("Outbox dispatch failed", "error", err)
+		}
+		return false
+	}
+	return found
+}
+
+// postWebhook sends one event; any status other than 2xx is a failure to be retried
+func postWebhook(ctx context.Context, url, eventID, eventType string, attempt int, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Corvina-Event", eventType)
+	req.Header.Set("X-Corvina-Event-ID", eventID)
+	req.Header.Set("X-Corvina-Delivery-Attempt", strconv.Itoa(attempt))
+	if webhookSecret != "" {
+		mac := hmac.New(sha256.New, []byte(webhookSecret))
+		mac.Write(body)
+		req.Header.Set("X-Corvina-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("receiver answered %s", resp.Status)
+	}
+	return nil
+}
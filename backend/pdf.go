@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ---------- PDF Rasterization ----------
+
+var (
+	pdftoppmPath   = envString("PDFTOPPM_PATH", "pdftoppm")
+	pdfinfoPath    = envString("PDFINFO_PATH", "pdfinfo")
+	pdfDPI         = envInt("PDF_DPI", 200)
+	pdfMaxPages    = envInt("PDF_MAX_PAGES", 200)
+	pdfRasterLimit = envDuration("PDF_RASTER_TIMEOUT", 2*time.Minute)
+)
+
+var (
+	errInvalidPDF      = errors.New("file is not a readable PDF")
+	errTooManyPDFPages = errors.New("PDF has too many pages")
+)
+
+// PageInfo describes one page image of a document (PNG uploads have a single page)
+type PageInfo struct {
+	PageNumber int    `json:"page_number"`
+	ImageFile  string `json:"image_file"`
+	Width      int    `json:"width,omitempty"`
+	Height     int    `json:"height,omitempty"`
+	StoredObject
+}
+
+// pageImageName is the stored file name for a rasterized PDF page
+func pageImageName(docID string, page int) string {
+	return fmt.Sprintf("%s_page_%d.png", docID, page)
+}
+
+// registerPDFDocument stores the PDF, rasterizes every page to PNG with pdftoppm, and registers
+// the document with one pages row per page
+func registerPDFDocument(ctx context.Context, docID, filename, project string, opts UploadOptions, src io.Reader) (*StoredDocument, error) {
+	obj, err := storeObject(src, ".pdf")
+	if err != nil {
+		return nil, err
+	}
+
+	pages, err := rasterizePDF(objectPath(obj.Key), docID)
+	if err != nil {
+		return nil, err
+	}
+
+	// The document's perceptual hash and thumbnail are taken from its first page
+	first, err := decodeImageFile(objectPath(pages[0].Key))
+	if err != nil {
+		return nil, err
+	}
+	thumb, err := makeThumbnail(first)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &StoredDocument{
+		DocumentID:    docID,
+		Project:       project,
+		UploadOptions: opts,
+		Filename:      filename,
+		Format:        "pdf",
+		Original:      obj,
+		Pages:         pages,
+		PHash:         imagePHash(first),
+		Thumbnail:     thumb,
+	}
+	if err := records.SaveDocument(ctx, doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// rasterizePDF renders each page and stores it as a PNG object named <docID>_page_<n>.png
+func rasterizePDF(pdfPath, docID string) ([]PageInfo, error) {
+	// Render into a scratch directory first so a failed run never leaves partial pages behind
+	root := filepath.Join(datasetDir, objectsDir)
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+	scratch, err := os.MkdirTemp(root, ".raster-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(scratch)
+
+	ctx, cancel := context.WithTimeout(context.Background(), pdfRasterLimit)
+	defer cancel()
+
+	// Refuse long PDFs outright rather than keeping only their first pdfMaxPages pages
+	count, err := pdfPageCount(ctx, pdfPath)
+	if err != nil {
+		return nil, err
+	}
+	if count > pdfMaxPages {
+		return nil, fmt.Errorf("%w: the PDF has %d pages and the limit is %d", errTooManyPDFPages, count, pdfMaxPages)
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, pdftoppmPath,
+		"-png", "-r", strconv.Itoa(pdfDPI),
+		"-f", "1", "-l", strconv.Itoa(pdfMaxPages),
+		pdfPath, filepath.Join(scratch, "page"),
+	)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("%w: %s", errInvalidPDF, strings.TrimSpace(stderr.String()))
+		}
+		return nil, fmt.Errorf("running %s: %w", pdftoppmPath, err)
+	}
+
+	// pdftoppm names pages page-1.png, page-01.png, ... depending on the page count
+	entries, err := os.ReadDir(scratch)
+	if err != nil {
+		return nil, err
+	}
+	numbered := map[int]string{}
+	for _, e := range entries {
+		name := strings.TrimSuffix(strings.TrimPrefix(e.Name(), "page-"), ".png")
+		if n, err := strconv.Atoi(name); err == nil {
+			numbered[n] = e.Name()
+		}
+	}
+	if len(numbered) == 0 {
+		return nil, fmt.Errorf("%w: no pages rendered", errInvalidPDF)
+	}
+
+	nums := make([]int, 0, len(numbered))
+	for n := range numbered {
+		nums = append(nums, n)
+	}
+	sort.Ints(nums)
+
+	pages := make([]PageInfo, 0, len(nums))
+	for _, n := range nums {
+		f, err := os.Open(filepath.Join(scratch, numbered[n]))
+		if err != nil {
+			return nil, err
+		}
+		obj, err := storeObject(f, ".png")
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		p := PageInfo{PageNumber: n, ImageFile: pageImageName(docID, n), StoredObject: obj}
+		p.Width, p.Height, _ = imageDimensions(objectPath(obj.Key))
+		pages = append(pages, p)
+	}
+	return pages, nil
+}
+
+// pdfPageCount reads the page count from pdfinfo's "Pages:" line
+func pdfPageCount(ctx context.Context, pdfPath string) (int, error) {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, pdfinfoPath, pdfPath)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return 0, fmt.Errorf("%w: %s", errInvalidPDF, strings.TrimSpace(stderr.String()))
+		}
+		return 0, fmt.Errorf("running %s: %w", pdfinfoPath, err)
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if v, ok := strings.CutPrefix(line, "Pages:"); ok {
+			if n, err := strconv.Atoi(strings.TrimSpace(v)); err == nil {
+				return n, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("%w: pdfinfo reported no page count", errInvalidPDF)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+// ---------- Perceptual Hash Duplicates ----------
+
+// phashMaxDistance is the Hamming distance (out of 64 bits) at or below which two images are
+// reported as near-duplicates. Re-scans of the same page typically land within 2-6 bits.
+var phashMaxDistance = envInt("PHASH_DUPLICATE_DISTANCE", 6)
+
+const phashSize = 32 // images are reduced to 32x32 grayscale before the DCT
+
+// imagePHash computes a 64-bit DCT perceptual hash: the low-frequency 8x8 DCT coefficients of a
+// 32x32 grayscale thumbnail, each compared against their median
+func imagePHash(img image.Image) uint64 {
+	var px [phashSize][phashSize]float64
+	b := img.Bounds()
+	for cy := 0; cy < phashSize; cy++ {
+		y0 := b.Min.Y + cy*b.Dy()/phashSize
+		y1 := max(y0+1, b.Min.Y+(cy+1)*b.Dy()/phashSize)
+		for cx := 0; cx < phashSize; cx++ {
+			x0 := b.Min.X + cx*b.Dx()/phashSize
+			x1 := max(x0+1, b.Min.X+(cx+1)*b.Dx()/phashSize)
+			px[cy][cx] = cellLuma(img, x0, y0, x1, y1)
+		}
+	}
+
+	var coeffs [64]float64
+	for v := 0; v < 8; v++ {
+		for u := 0; u < 8; u++ {
+			var sum float64
+			for y := 0; y < phashSize; y++ {
+				cv := math.Cos(float64(2*y+1) * float64(v) * math.Pi / (2 * phashSize))
+				for x := 0; x < phashSize; x++ {
+					sum += px[y][x] * cv * math.Cos(float64(2*x+1)*float64(u)*math.Pi/(2*phashSize))
+				}
+			}
+			coeffs[v*8+u] = sum
+		}
+	}
+
+	// The DC term only reflects overall brightness, so it is left out of the median
+	sorted := append([]float64(nil), coeffs[1:]...)
+	sort.Float64s(sorted)
+	median := sorted[len(sorted)/2]
+
+	var hash uint64
+	for i, c := range coeffs {
+		if c > median {
+			hash |= 1 << uint(i)
+		}
+	}
+	return hash
+}
+
+// cellLuma averages the gray level over a cell, sampling at most 16x16 points so very large
+// scans don't cost a full pass over every pixel
+func cellLuma(img image.Image, x0, y0, x1, y1 int) float64 {
+	stepX := max(1, (x1-x0)/16)
+	stepY := max(1, (y1-y0)/16)
+	var sum float64
+	var n int
+	for y := y0; y < y1; y += stepY {
+		for x := x0; x < x1; x += stepX {
+			sum += float64(color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y)
+			n++
+		}
+	}
+	return sum / float64(n)
+}
+
+// duplicateWarning summarizes near-duplicates for upload responses
+func duplicateWarning(dups []DuplicateDocument) string {
+	if len(dups) == 1 {
+		return fmt.Sprintf("Image looks like a duplicate of document %s", dups[0].DocumentID)
+	}
+	return fmt.Sprintf("Image looks like a duplicate of %d existing documents, including %s", len(dups), dups[0].DocumentID)
+}
+
+type DuplicateDocument struct {
+	DocumentID string `json:"document_id"`
+	ImageFile  string `json:"image_file"`
+	Project    string `json:"project"`
+	Distance   int    `json:"distance"`
+}
+
+// FindDuplicates lists other documents whose perceptual hash is within maxDistance of docID's
+func (postgresRecords) FindDuplicates(ctx context.Context, docID string, maxDistance int) ([]DuplicateDocument, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT o.document_id, o.image_file, o.project, bit_count((o.phash # d.phash)::bit(64))::int AS distance
+		FROM documents d
+		JOIN documents o ON o.document_id <> d.document_id AND o.phash IS NOT NULL
+		WHERE d.document_id = $1
+		  AND bit_count((o.phash # d.phash)::bit(64)) <= $2
+		ORDER BY distance, o.created_at DESC
+	`, docID, maxDistance)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	dups := []DuplicateDocument{}
+	for rows.Next() {
+		var d DuplicateDocument
+		if err := rows.Scan(&d.DocumentID, &d.ImageFile, &d.Project, &d.Distance); err != nil {
+			return nil, err
+		}
+		dups = append(dups, d)
+	}
+	return dups, rows.Err()
+}
+
+// handleDocumentDuplicates returns near-identical documents: GET /documents/{id}/duplicates?max_distance=
+func handleDocumentDuplicates(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		jsonError(w, http.StatusMethodNotAllowed, "GET only")
+		return
+	}
+	docID := r.PathValue("id")
+
+	maxDistance := phashMaxDistance
+	if v := r.URL.Query().Get("max_distance"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > 64 {
+			jsonError(w, http.StatusBadRequest, "max_distance must be between 0 and 64")
+			return
+		}
+		maxDistance = n
+	}
+
+	var hasHash bool
+	if err := db.QueryRowContext(r.Context(), "SELECT phash IS NOT NULL FROM documents WHERE document_id = $1", docID).Scan(&hasHash); err != nil {
+		problemError(w, http.StatusNotFound, codeDocumentNotFound, "Document not found")
+		return
+	}
+	if !hasHash {
+		jsonError(w, http.StatusConflict, "Document has no perceptual hash; re-upload it to compute one")
+		return
+	}
+
+	dups, err := records.FindDuplicates(r.Context(), docID, maxDistance)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "Query failed")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]interface{}{
+		"document_id":  docID,
+		"max_distance": maxDistance,
+		"duplicates":   dups,
+	})
+}
@@ -0,0 +1,72 @@
+package main
+
+// ---------- Polyline Points ----------
+
+// Line points are stored as the client sent them: [{x, y}, ...] from the annotator or
+// [[x, y], ...] from imports. Everything that reads them goes through parsePoints, so a
+// malformed element is treated the same way everywhere: it is left out of the points, and code
+// that rewrites a list leaves it untouched.
+
+// point is one well-formed polyline point; Index is its position in the original list
+type point struct {
+	X, Y  float64
+	Index int
+}
+
+// pointsShape describes a points value as a whole
+type pointsShape int
+
+const (
+	pointsNotList    pointsShape = iota // nil or not a JSON array
+	pointsWellFormed                    // every element is {x, y} or [x, y]; may be empty
+	pointsMalformed                     // some elements are neither and were left out
+)
+
+// parsePoints reads the well-formed points of a decoded JSON points value
+func parsePoints(raw interface{}) ([]point, pointsShape) {
+	list, ok := raw.([]interface{})
+	if !ok {
+		return nil, pointsNotList
+	}
+	pts := make([]point, 0, len(list))
+	shape := pointsWellFormed
+	for i, elem := range list {
+		x, y, ok := pointXY(elem)
+		if !ok {
+			shape = pointsMalformed
+			continue
+		}
+		pts = append(pts, point{X: x, Y: y, Index: i})
+	}
+	return pts, shape
+}
+
+// pointXY reads an {x, y} object or an [x, y] pair
+func pointXY(elem interface{}) (x, y float64, ok bool) {
+	var okX, okY bool
+	switch v := elem.(type) {
+	case map[string]interface{}:
+		x, okX = v["x"].(float64)
+		y, okY = v["y"].(float64)
+	case []interface{}:
+		if len(v) == 2 {
+			x, okX = v[0].(float64)
+			y, okY = v[1].(float64)
+		}
+	}
+	return x, y, okX && okY
+}
+
+// withXY returns a copy of a well-formed point element moved to (x, y), in the same format.
+// Other keys of an {x, y} object are kept.
+func withXY(elem interface{}, x, y float64) interface{} {
+	if v, ok := elem.(map[string]interface{}); ok {
+		moved := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			moved[k] = val
+		}
+		moved["x"], moved["y"] = x, y
+		return moved
+	}
+	return []interface{}{x, y}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestParsePoints(t *testing.T) {
+	tests := []struct {
+		name  string
+		raw   string
+		want  []point
+		shape pointsShape
+	}{
+		{"objects", `[{"x":1,"y":2},{"x":3.5,"y":4}]`, []point{{1, 2, 0}, {3.5, 4, 1}}, pointsWellFormed},
+		{"pairs", `[[1,2],[3,4]]`, []point{{1, 2, 0}, {3, 4, 1}}, pointsWellFormed},
+		{"mixed", `[[1,2],{"x":3,"y":4,"k":"a"}]`, []point{{1, 2, 0}, {3, 4, 1}}, pointsWellFormed},
+		{"empty list", `[]`, []point{}, pointsWellFormed},
+		{"missing y", `[{"x":1},[3,4]]`, []point{{3, 4, 1}}, pointsMalformed},
+		{"string coordinate", `[["1",2],[3,4]]`, []point{{3, 4, 1}}, pointsMalformed},
+		{"three coordinates", `[[1,2,3],[3,4]]`, []point{{3, 4, 1}}, pointsMalformed},
+		{"flat list", `[1,2,3,4]`, []point{}, pointsMalformed},
+		{"null element", `[null,[3,4]]`, []point{{3, 4, 1}}, pointsMalformed},
+		{"object", `{"x":1,"y":2}`, nil, pointsNotList},
+		{"string", `"1,2 3,4"`, nil, pointsNotList},
+		{"null", `null`, nil, pointsNotList},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var raw interface{}
+			if err := json.Unmarshal([]byte(tt.raw), &raw); err != nil {
+				t.Fatal(err)
+			}
+			got, shape := parsePoints(raw)
+			if shape != tt.shape {
+				t.Errorf("shape = %d, want %d", shape, tt.shape)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithXY(t *testing.T) {
+	obj := map[string]interface{}{"x": 1.0, "y": 2.0, "k": "a"}
+	moved := withXY(obj, 5, 6)
+	if want := map[string]interface{}{"x": 5.0, "y": 6.0, "k": "a"}; !reflect.DeepEqual(moved, want) {
+		t.Errorf("object: got %v, want %v", moved, want)
+	}
+	if obj["x"] != 1.0 {
+		t.Errorf("object was modified: %v", obj)
+	}
+	if got, want := withXY([]interface{}{1.0, 2.0}, 5, 6), []interface{}{5.0, 6.0}; !reflect.DeepEqual(got, want) {
+		t.Errorf("pair: got %v, want %v", got, want)
+	}
+}
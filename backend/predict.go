@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// ---------- Model Pre-Annotation ----------
+
+var (
+	// Empty disables /predict
+	predictURL     = envString("PREDICT_URL", "")
+	predictTimeout = envDuration("PREDICT_TIMEOUT", 2*time.Minute)
+
+	// Recorded on suggestions when the service response doesn't name its model
+	predictModel        = envString("PREDICT_MODEL", "")
+	predictModelVersion = envString("PREDICT_MODEL_VERSION", "")
+)
+
+var predictTypes = map[string]bool{"box": true, "node": true, "connection": true, "line": true, "text": true}
+
+// predictedAnnotation is one detection returned by the inference service. IDs are local to the
+// response and only used to wire connections to the nodes/boxes they join.
+type predictedAnnotation struct {
+	ID         string      `json:"id"`
+	Type       string      `json:"type"`
+	Label      string      `json:"label"`
+	BBox       []int       `json:"bbox"`
+	Position   []int       `json:"position"`
+	Points     interface{} `json:"points"`
+	SourceID   string      `json:"source_id"`
+	TargetID   string      `json:"target_id"`
+	RawText    string      `json:"raw_text"`
+	Confidence float64     `json:"confidence"`
+}
+
+type predictResponse struct {
+	Model        string                `json:"model"`
+	ModelVersion string                `json:"model_version"`
+	Uncertainty  *float64              `json:"uncertainty"` // optional page score, higher = harder
+	Annotations  []predictedAnnotation `json:"annotations"`
+}
+
+// callPredictService posts a page PNG to the inference service, which answers
+// {"model", "model_version", "uncertainty", "annotations": [{"id", "type", "label", "bbox", "position", "points", "source_id", "target_id", "raw_text", "confidence"}, ...]}
+func callPredictService(ctx context.Context, docID string, page int, imagePath string) (*predictResponse, error) {
+	f, err := os.Open(imagePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, predictURL, f)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "image/png")
+	req.Header.Set("X-Document-ID", docID)
+	req.Header.Set("X-Page", fmt.Sprint(page))
+	forwardRequestID(req)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("calling prediction service: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("prediction service returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var out predictResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("decoding prediction response: %w", err)
+	}
+	if out.Model == "" {
+		out.Model, out.ModelVersion = predictModel, predictModelVersion
+	}
+	return &out, nil
+}
+
+// predictionSuggestions converts predicted annotations into suggestions with fresh IDs, remapping
+// connection endpoints that refer to other predictions in the same response
+func predictionSuggestions(docID string, page int, resp *predictResponse) []Suggestion {
+	preds := resp.Annotations
+	ids := map[string]string{}
+	for _, p := range preds {
+		if p.ID != "" {
+			ids[p.ID] = newID()
+		}
+	}
+	remap := func(id string) string {
+		if mapped, ok := ids[id]; ok {
+			return mapped
+		}
+		return id // may reference an existing annotation
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	suggestions := []Suggestion{}
+	for _, p := range preds {
+		if !predictTypes[p.Type] {
+			continue
+		}
+		id := ids[p.ID]
+		if id == "" {
+			id = newID()
+		}
+		suggestions = append(suggestions, Suggestion{
+			ID: id, DocumentID: docID, Page: page, Type: p.Type, Label: p.Label,
+			BBox: p.BBox, Position: p.Position, Points: p.Points,
+			SourceID: remap(p.SourceID), TargetID: remap(p.TargetID),
+			RawText: p.RawText, Confidence: p.Confidence,
+			Source: "model", ModelName: resp.Model, ModelVersion: resp.ModelVersion,
+			Status: "pending", CreatedAt: now,
+		})
+	}
+	return suggestions
+}
+
+// pageUncertainty is the service's own score for a page, or else one minus the mean confidence
+// of its detections. Pages with no detections have no score.
+func pageUncertainty(resp *predictResponse) (float64, bool) {
+	if resp.Uncertainty != nil {
+		return *resp.Uncertainty, true
+	}
+	if len(resp.Annotations) == 0 {
+		return 0, false
+	}
+	sum := 0.0
+	for _, p := range resp.Annotations {
+		sum += p.Confidence
+	}
+	return 1 - sum/float64(len(resp.Annotations)), true
+}
+
+// handlePredict runs the configured model on one page (?page=N) or every page of a document and
+// stores the detections as pending machine suggestions: POST /documents/{id}/predict
+func handlePredict(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		jsonError(w, http.StatusMethodNotAllowed, "POST only")
+		return
+	}
+	if predictURL == "" {
+		jsonError(w, http.StatusServiceUnavailable, "Prediction is disabled (set PREDICT_URL)")
+		return
+	}
+	docID := r.PathValue("id")
+
+	var numPages int
+	err := db.QueryRowContext(r.Context(), "SELECT COALESCE(num_pages, 1) FROM documents WHERE document_id = $1", docID).Scan(&numPages)
+	if err != nil {
+		problemError(w, http.StatusNotFound, codeDocumentNotFound, "Document not found")
+		return
+	}
+	pages := make([]int, 0, numPages)
+	if r.URL.Query().Get("page") != "" {
+		page, err := pageParam(r)
+		if err != nil || page > numPages {
+			jsonError(w, http.StatusBadRequest, fmt.Sprintf("page must be between 1 and %d", numPages))
+			return
+		}
+		pages = append(pages, page)
+	} else {
+		for p := 1; p <= numPages; p++ {
+			pages = append(pages, p)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), predictTimeout)
+	defer cancel()
+
+	all := []Suggestion{}
+	uncertaintySum, scored := 0.0, 0
+	for _, page := range pages {
+		sp, err := loadStoredPage(r.Context(), docID, page)
+		if err != nil {
+			jsonError(w, http.StatusNotFound, fmt.Sprintf("Page %d image not found", page))
+			return
+		}
+		resp, err := callPredictService(ctx, docID, page, sp.Path)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Prediction failed", "document_id", docID, "page", page, "error", err)
+			status := http.StatusBadGateway
+			if errors.Is(err, context.DeadlineExceeded) {
+				status = http.StatusGatewayTimeout
+			}
+			jsonError(w, status, "Prediction failed: "+err.Error())
+			return
+		}
+
+		suggestions := predictionSuggestions(docID, page, resp)
+		if err := replacePendingSuggestions(r.Context(), docID, page, "model", suggestions); err != nil {
+			slog.ErrorContext(r.Context(), "Saving predictions failed", "document_id", docID, "error", err)
+			jsonError(w, http.StatusInternalServerError, "Failed to save suggestions")
+			return
+		}
+		all = append(all, suggestions...)
+		if u, ok := pageUncertainty(resp); ok {
+			uncertaintySum += u
+			scored++
+		}
+	}
+
+	// The document's score orders the /tasks/next queue
+	var uncertainty interface{}
+	if scored > 0 {
+		uncertainty = uncertaintySum / float64(scored)
+		if _, err := db.ExecContext(r.Context(), "UPDATE documents SET uncertainty = $1 WHERE document_id = $2", uncertainty, docID); err != nil {
+			slog.ErrorContext(r.Context(), "Saving uncertainty failed", "document_id", docID, "error", err)
+		}
+	}
+
+	slog.InfoContext(r.Context(), "Predicted", "document_id", docID, "suggestions", len(all), "pages", len(pages))
+	jsonResponse(w, http.StatusOK, map[string]interface{}{
+		"document_id": docID,
+		"pages":       pages,
+		"uncertainty": uncertainty,
+		"suggestions": all,
+	})
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ---------- Problem Details ----------
+
+// Error responses are RFC 7807 problem details (application/problem+json). Clients should branch
+// on code, which is stable; detail is meant for people and its wording may change.
+
+// Codes for errors clients are expected to act on. Any other error gets a code derived from its
+// HTTP status: NOT_FOUND, BAD_REQUEST, INTERNAL_SERVER_ERROR, ...
+const (
+	codeDocumentNotFound    = "DOCUMENT_NOT_FOUND"
+	codeSchemaViolation     = "SCHEMA_VIOLATION"    // body doesn't match the expected JSON shape
+	codeInvalidBBox         = "INVALID_BBOX"        // malformed or off-image bbox
+	codeInvalidPosition     = "INVALID_POSITION"    // malformed or off-image node position
+	codeInvalidPage         = "INVALID_PAGE"        // page number the document doesn't have
+	codeInvalidRegion       = "INVALID_REGION"      // bad region or region_id reference
+	codeInvalidAnnotations  = "INVALID_ANNOTATIONS" // see errors for each annotation and field
+	codeTooManyAnnotations  = "TOO_MANY_ANNOTATIONS"
+	codePayloadTooLarge     = "PAYLOAD_TOO_LARGE"
+	codeInvalidUpload       = "INVALID_UPLOAD" // unsupported, corrupt, or oversized content, or a PDF over PDF_MAX_PAGES
+	codeChecksumMismatch    = "CHECKSUM_MISMATCH"
+	codeRateLimited         = "RATE_LIMITED"         // wait for the Retry-After header
+	codeDatabaseUnavailable = "DATABASE_UNAVAILABLE" // wait for the Retry-After header
+	codeRequiresPostgres    = "REQUIRES_POSTGRES"    // endpoint not available with DB_DRIVER=sqlite
+	codeQuotaExceeded       = "QUOTA_EXCEEDED"       // a project or user quota is reached; see GET /quotas
+	codeDuplicateUpload     = "DUPLICATE_UPLOAD"     // same content already uploaded; see document_id
+	codeDocumentExists      = "DOCUMENT_EXISTS"      // re-upload without overwrite or new_version
+	codeSyncExpired         = "SYNC_EXPIRED"         // since is older than the change log; resync in full
+)
+
+type Problem struct {
+	Type       string       `json:"type"`
+	Title      string       `json:"title"`
+	Status     int          `json:"status"`
+	Code       string       `json:"code"`
+	Detail     string       `json:"detail,omitempty"`
+	Errors     []FieldError `json:"errors,omitempty"`
+	MaxBytes   int64        `json:"max_bytes,omitempty"`   // set with PAYLOAD_TOO_LARGE
+	DocumentID string       `json:"document_id,omitempty"` // set with DUPLICATE_UPLOAD and DOCUMENT_EXISTS
+	RequestID  string       `json:"request_id,omitempty"`
+}
+
+// FieldError points at the input field that caused a problem. It is also an error, so checks
+// deep inside a handler can return one and let the handler pick the response.
+type FieldError struct {
+	AnnotationID string `json:"annotation_id,omitempty"`
+	Field        string `json:"field"`
+	Code         string `json:"code,omitempty"`
+	Message      string `json:"message"`
+}
+
+func (e *FieldError) Error() string {
+	if e.AnnotationID != "" {
+		return fmt.Sprintf("annotation %s: %s %s", e.AnnotationID, e.Field, e.Message)
+	}
+	return e.Field + " " + e.Message
+}
+
+// statusCode is the fallback code for a status, e.g. 404 -> NOT_FOUND
+func statusCode(status int) string {
+	return strings.ToUpper(strings.ReplaceAll(http.StatusText(status), " ", "_"))
+}
+
+func writeProblem(w http.ResponseWriter, p Problem) {
+	if p.Type == "" {
+		p.Type = "about:blank"
+	}
+	if p.Title == "" {
+		p.Title = http.StatusText(p.Status)
+	}
+	if p.Code == "" {
+		p.Code = statusCode(p.Status)
+	}
+	// requestIDMiddleware has already set the header; quoting it lets a bug report carry it
+	p.RequestID = w.Header().Get(requestIDHeader)
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+// problemError writes an error with a specific code and optional per-field details
+func problemError(w http.ResponseWriter, status int, code, detail string, fields ...FieldError) {
+	writeProblem(w, Problem{Status: status, Code: code, Detail: detail, Errors: fields})
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// ---------- Quotas ----------
+
+// Every upload path (/upload, /upload/batch, /upload/url, tus, /import/coco, the ingest
+// directory) goes through registerUpload, which checks the quotas of the target project and of
+// the uploading user before reading the file:
+//
+//   - max documents: re-uploading an existing document does not count as a new one (429)
+//   - max uploads per day: documents created in the last 24 hours (429)
+//   - max storage bytes: size of the original uploads (413)
+//
+// A limit is reached once usage is at or above it, so one upload can overshoot by its own size.
+// The QUOTA_* settings are the defaults for every project and user, 0 meaning unlimited;
+// /admin/quotas overrides them for one project or user. The user is the owner of the request's
+// API key, not ?annotator=, which anyone can change; requests without a key share the user
+// "anonymous". Files picked up from the ingest directory only count against the project. Quotas
+// need PostgreSQL and are not enforced with DB_DRIVER=sqlite.
+//
+//	GET    /quotas?project=                   limits and current usage of the project and caller
+//	GET    /admin/quotas                      defaults and overrides
+//	PUT    /admin/quotas/{scope}/{name}       set an override (scope is project or user)
+//	DELETE /admin/quotas/{scope}/{name}       drop an override
+
+type QuotaLimits struct {
+	MaxDocuments     int64 `json:"max_documents"`
+	MaxStorageBytes  int64 `json:"max_storage_bytes"`
+	MaxUploadsPerDay int64 `json:"max_uploads_per_day"`
+}
+
+func (l QuotaLimits) unlimited() bool {
+	return l.MaxDocuments == 0 && l.MaxStorageBytes == 0 && l.MaxUploadsPerDay == 0
+}
+
+var quotaDefaults = map[string]QuotaLimits{
+	"project": {
+		MaxDocuments:     int64(envInt("QUOTA_PROJECT_MAX_DOCUMENTS", 0)),
+		MaxStorageBytes:  int64(envInt("QUOTA_PROJECT_MAX_STORAGE_MB", 0)) << 20,
+		MaxUploadsPerDay: int64(envInt("QUOTA_PROJECT_MAX_UPLOADS_PER_DAY", 0)),
+	},
+	"user": {
+		MaxDocuments:     int64(envInt("QUOTA_USER_MAX_DOCUMENTS", 0)),
+		MaxStorageBytes:  int64(envInt("QUOTA_USER_MAX_STORAGE_MB", 0)) << 20,
+		MaxUploadsPerDay: int64(envInt("QUOTA_USER_MAX_UPLOADS_PER_DAY", 0)),
+	},
+}
+
+// quotaColumns is the documents column each scope is counted by
+var quotaColumns = map[string]string{"project": "project", "user": "quota_user"}
+
+// anonymousUser is the quota user of requests without a known API key
+const anonymousUser = "anonymous"
+
+// quotaUser is who a request's uploads count against for per-user quotas
+func quotaUser(r *http.Request) string {
+	if holder, ok := authenticate(r); ok {
+		return holder.Owner
+	}
+	return anonymousUser
+}
+
+type QuotaUsage struct {
+	Scope        string      `json:"scope"`
+	Name         string      `json:"name"`
+	Limits       QuotaLimits `json:"limits"`
+	Documents    int64       `json:"documents"`
+	StorageBytes int64       `json:"storage_bytes"`
+	UploadsToday int64       `json:"uploads_last_24h"`
+}
+
+// QuotaError is returned by registerUpload when a quota is reached
+type QuotaError struct {
+	Scope string
+	Name  string
+	Limit string // max_documents | max_storage_bytes | max_uploads_per_day
+	Max   int64
+	Used  int64
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("%s %q has reached its %s quota (%d of %d)", e.Scope, e.Name, e.Limit, e.Used, e.Max)
+}
+
+// status is 413 for storage, which only freeing space fixes, and 429 for the counts
+func (e *QuotaError) status() int {
+	if e.Limit == "max_storage_bytes" {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusTooManyRequests
+}
+
+// quotaExceededError writes err as a problem response when it is a QuotaError
+func quotaExceededError(w http.ResponseWriter, err error) bool {
+	var qe *QuotaError
+	if !errors.As(err, &qe) {
+		return false
+	}
+	problemError(w, qe.status(), codeQuotaExceeded, qe.Error())
+	return true
+}
+
+// quotaLimits is the default for scope with name's override applied
+func quotaLimits(ctx context.Context, scope, name string) (QuotaLimits, error) {
+	l := quotaDefaults[scope]
+	var docs, bytes, perDay sql.NullInt64
+	err := db.QueryRowContext(ctx, "SELECT max_documents, max_storage_bytes, max_uploads_per_day FROM quotas WHERE scope = $1 AND name = $2",
+		scope, name).Scan(&docs, &bytes, &perDay)
+	if err == sql.ErrNoRows {
+		return l, nil
+	}
+	if err != nil {
+		return l, err
+	}
+	if docs.Valid {
+		l.MaxDocuments = docs.Int64
+	}
+	if bytes.Valid {
+		l.MaxStorageBytes = bytes.Int64
+	}
+	if perDay.Valid {
+		l.MaxUploadsPerDay = perDay.Int64
+	}
+	return l, nil
+}
+
+func quotaUsage(ctx context.Context, scope, name string) (QuotaUsage, error) {
+	u := QuotaUsage{Scope: scope, Name: name}
+	var err error
+	if u.Limits, err = quotaLimits(ctx, scope, name); err != nil {
+		return u, err
+	}
+	err = db.QueryRowContext(ctx, fmt.Sprintf(`
+		SELECT count(*), COALESCE(sum(size_bytes), 0), count(*) FILTER (WHERE created_at > now() - interval '1 day')
+		FROM documents WHERE %s = $1`, quotaColumns[scope]), name).Scan(&u.Documents, &u.StorageBytes, &u.UploadsToday)
+	return u, err
+}
+
+// checkQuotas fails with a QuotaError when uploading docID would go past a quota of project or
+// of user ("" for uploads that no user makes)
+func checkQuotas(ctx context.Context, docID, project, user string) error {
+	if dbDriver == "sqlite" {
+		return nil
+	}
+	var exists bool
+	checkedExists := false
+	for _, s := range [][2]string{{"project", project}, {"user", user}} {
+		scope, name := s[0], s[1]
+		if name == "" {
+			continue
+		}
+		u, err := quotaUsage(ctx, scope, name)
+		if err != nil {
+			return fmt.Errorf("checking quota: %w", err)
+		}
+		if u.Limits.unlimited() {
+			continue
+		}
+		if !checkedExists {
+			if err := db.QueryRowContext(ctx, sqlDocumentExists, docID).Scan(&exists); err != nil {
+				return fmt.Errorf("checking quota: %w", err)
+			}
+			checkedExists = true
+		}
+		switch l := u.Limits; {
+		case l.MaxStorageBytes > 0 && u.StorageBytes >= l.MaxStorageBytes:
+			return &QuotaError{scope, name, "max_storage_bytes", l.MaxStorageBytes, u.StorageBytes}
+		case exists:
+			// Replacing a document's file adds neither a document nor an upload of the day
+		case l.MaxDocuments > 0 && u.Documents >= l.MaxDocuments:
+			return &QuotaError{scope, name, "max_documents", l.MaxDocuments, u.Documents}
+		case l.MaxUploadsPerDay > 0 && u.UploadsToday >= l.MaxUploadsPerDay:
+			return &QuotaError{scope, name, "max_uploads_per_day", l.MaxUploadsPerDay, u.UploadsToday}
+		}
+	}
+	return nil
+}
+
+// handleQuotaUsage reports the quotas and usage of a project and of the caller:
+// GET /quotas?project=
+func handleQuotaUsage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		jsonError(w, http.StatusMethodNotAllowed, "GET only")
+		return
+	}
+	project := r.URL.Query().Get("project")
+	if project == "" {
+		project = defaultProject
+	}
+	resp := map[string]interface{}{}
+	for _, s := range [][2]string{{"project", project}, {"user", quotaUser(r)}} {
+		u, err := quotaUsage(r.Context(), s[0], s[1])
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Quota usage query failed", "error", err)
+			jsonError(w, http.StatusInternalServerError, "Query failed")
+			return
+		}
+		resp[s[0]] = u
+	}
+	jsonResponse(w, http.StatusOK, resp)
+}
+
+// QuotaOverride is one row of the quotas table; a nil limit keeps the default
+type QuotaOverride struct {
+	Scope            string `json:"scope"`
+	Name             string `json:"name"`
+	MaxDocuments     *int64 `json:"max_documents"`
+	MaxStorageBytes  *int64 `json:"max_storage_bytes"`
+	MaxUploadsPerDay *int64 `json:"max_uploads_per_day"`
+	UpdatedAt        string `json:"updated_at,omitempty"`
+}
+
+// handleAdminQuotas lists the defaults and overrides: GET /admin/quotas
+func handleAdminQuotas(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		jsonError(w, http.StatusMethodNotAllowed, "GET only")
+		return
+	}
+	rows, err := db.QueryContext(r.Context(), `
+		SELECT scope, name, max_documents, max_storage_bytes, max_uploads_per_day, updated_at
+		FROM quotas ORDER BY scope, name`)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "Query failed")
+		return
+	}
+	defer rows.Close()
+	overrides := []QuotaOverride{}
+	for rows.Next() {
+		var o QuotaOverride
+		var updated time.Time
+		if err := rows.Scan(&o.Scope, &o.Name, &o.MaxDocuments, &o.MaxStorageBytes, &o.MaxUploadsPerDay, &updated); err != nil {
+			continue
+		}
+		o.UpdatedAt = updated.UTC().Format(time.RFC3339)
+		overrides = append(overrides, o)
+	}
+	jsonResponse(w, http.StatusOK, map[string]interface{}{
+		"defaults":  quotaDefaults,
+		"overrides": overrides,
+		"count":     len(overrides),
+	})
+}
+
+// handleAdminQuota sets (PUT) or removes (DELETE) an override: /admin/quotas/{scope}/{name}
+func handleAdminQuota(w http.ResponseWriter, r *http.Request) {
+	scope, name := r.PathValue("scope"), r.PathValue("name")
+	if quotaColumns[scope] == "" {
+		jsonError(w, http.StatusBadRequest, "scope must be project or user")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		var o QuotaOverride
+		if err := json.NewDecoder(r.Body).Decode(&o); err != nil {
+			jsonError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+		for _, v := range []*int64{o.MaxDocuments, o.MaxStorageBytes, o.MaxUploadsPerDay} {
+			if v != nil && *v < 0 {
+				jsonError(w, http.StatusBadRequest, "Limits must be non-negative (0 is unlimited, null the default)")
+				return
+			}
+		}
+		o.Scope, o.Name = scope, name
+		_, err := db.ExecContext(r.Context(), `
+			INSERT INTO quotas (scope, name, max_documents, max_storage_bytes, max_uploads_per_day) VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (scope, name) DO UPDATE SET max_documents = $3, max_storage_bytes = $4, max_uploads_per_day = $5,
+				updated_at = now()`, scope, name, o.MaxDocuments, o.MaxStorageBytes, o.MaxUploadsPerDay)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Setting quota failed", "scope", scope, "name", name, "error", err)
+			jsonError(w, http.StatusInternalServerError, "Failed to set quota")
+			return
+		}
+		slog.InfoContext(r.Context(), "Quota set", "scope", scope, "name", name)
+		jsonResponse(w, http.StatusOK, o)
+
+	case http.MethodDelete:
+		res, err := db.ExecContext(r.Context(), "DELETE FROM quotas WHERE scope = $1 AND name = $2", scope, name)
+		if err != nil {
+			jsonError(w, http.StatusInternalServerError, "Failed to remove quota")
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			jsonError(w, http.StatusNotFound, "No such quota override")
+			return
+		}
+		jsonResponse(w, http.StatusOK, map[string]string{"status": "success"})
+
+	default:
+		jsonError(w, http.StatusMethodNotAllowed, "PUT or DELETE only")
+	}
+}
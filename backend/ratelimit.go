@@ -0,0 +1,149 @@
+package main
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// ---------- Rate Limiting ----------
+
+// Token bucket limits per client IP, and per API key for clients that send a known key in
+// X-API-Key (batch scripts get their own, usually larger, budget). Known keys are those in
+// API_KEYS and ADMIN_API_KEYS and those issued under /admin/api-keys (apikeys.go). A rate of 0 turns a limit off.
+var (
+	rateLimitIPRate   = envFloat("RATE_LIMIT_IP_RPS", 20)
+	rateLimitIPBurst  = envInt("RATE_LIMIT_IP_BURST", 40)
+	rateLimitKeyRate  = envFloat("RATE_LIMIT_KEY_RPS", 50)
+	rateLimitKeyBurst = envInt("RATE_LIMIT_KEY_BURST", 100)
+	// Comma-separated. An unknown key is ignored, so inventing keys can't get around the IP limit.
+	rateLimitAPIKeys = envString("API_KEYS", "")
+	// Behind a reverse proxy the client address comes from the last X-Forwarded-For entry
+	rateLimitTrustProxy = envBool("RATE_LIMIT_TRUST_PROXY", false)
+)
+
+// rateLimitExempt are probe and scrape endpoints that must keep answering under load
+var rateLimitExempt = map[string]bool{"/healthz": true, "/readyz": true, "/metrics": true}
+
+// rateLimitIdle is how long an unused bucket is kept before it is dropped
+const rateLimitIdle = 10 * time.Minute
+
+type bucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+type rateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	limit   rate.Limit
+	burst   int
+}
+
+func newRateLimiter(rps float64, burst int) *rateLimiter {
+	rl := &rateLimiter{buckets: map[string]*bucket{}, limit: rate.Limit(rps), burst: burst}
+	go func() {
+		for range time.Tick(rateLimitIdle) {
+			rl.evictIdle()
+		}
+	}()
+	return rl
+}
+
+// reserve takes a token for key and returns how long the caller must wait for it; 0 means the
+// request may go ahead now. A refused request doesn't spend its token.
+func (rl *rateLimiter) reserve(key string) time.Duration {
+	rl.mu.Lock()
+	b, ok := rl.buckets[key]
+	if !ok {
+		b = &bucket{limiter: rate.NewLimiter(rl.limit, rl.burst)}
+		rl.buckets[key] = b
+	}
+	b.lastSeen = time.Now()
+	rl.mu.Unlock()
+
+	res := b.limiter.Reserve()
+	if !res.OK() {
+		return rateLimitIdle
+	}
+	delay := res.Delay()
+	if delay > 0 {
+		res.Cancel()
+	}
+	return delay
+}
+
+func (rl *rateLimiter) evictIdle() {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	for k, b := range rl.buckets {
+		if time.Since(b.lastSeen) > rateLimitIdle {
+			delete(rl.buckets, k)
+		}
+	}
+}
+
+// clientIP is the address rate limits are keyed on
+func clientIP(r *http.Request) string {
+	if rateLimitTrustProxy {
+		if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+			parts := strings.Split(xff, ",")
+			return strings.TrimSpace(parts[len(parts)-1])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func parseAPIKeys(v string) map[string]bool {
+	keys := map[string]bool{}
+	for _, k := range strings.Split(v, ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			keys[k] = true
+		}
+	}
+	return keys
+}
+
+// rateLimitMiddleware answers 429 with Retry-After once a client's bucket is empty
+func rateLimitMiddleware(next http.Handler) http.Handler {
+	var byIP, byKey *rateLimiter
+	if rateLimitIPRate > 0 {
+		byIP = newRateLimiter(rateLimitIPRate, rateLimitIPBurst)
+	}
+	if rateLimitKeyRate > 0 {
+		byKey = newRateLimiter(rateLimitKeyRate, rateLimitKeyBurst)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rateLimitExempt[r.URL.Path] || r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var wait time.Duration
+		if _, ok := authenticate(r); ok {
+			if byKey != nil {
+				wait = byKey.reserve(r.Header.Get("X-API-Key"))
+			}
+		} else if byIP != nil {
+			wait = byIP.reserve(clientIP(r))
+		}
+		if wait > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			problemError(w, http.StatusTooManyRequests, codeRateLimited,
+				"Too many requests; retry after the time in the Retry-After header")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// ---------- Record Store ----------
+
+// DB_DRIVER picks where documents and annotations are kept. postgres, the default, backs every
+// endpoint. sqlite keeps them in one local file (SQLITE_PATH) with no server to start, for
+// development and demos: uploads, the document list and reads, images, thumbnails, and /submit
+// work, and every other endpoint answers 501.
+var dbDriver = envChoice("DB_DRIVER", "postgres", "postgres", "sqlite")
+
+// recordStore is the persistence behind the core annotation loop. Endpoints beyond that loop
+// query PostgreSQL directly.
+type recordStore interface {
+	Ping(ctx context.Context) error
+	SaveDocument(ctx context.Context, doc *StoredDocument) error
+	ListDocuments(ctx context.Context, f documentFilter) ([]DocumentSummary, error)
+	LoadDocument(ctx context.Context, docID string, view documentView) (*OutputJSON, error)
+	PageCount(ctx context.Context, docID string) (int, error)
+	FindPage(ctx context.Context, docID string, page int) (storedPage, error)
+	PageSizes(ctx context.Context, docID string) (map[int]pageSize, error)
+	FindDuplicates(ctx context.Context, docID string, maxDistance int) ([]DuplicateDocument, error)
+	ThumbnailKey(ctx context.Context, docID string) (string, error)
+	SetThumbnailKey(ctx context.Context, docID, key string) error
+	SetClassification(ctx context.Context, docID, drawingType, source string) error
+	// ReplaceAnnotations saves a document's annotations on behalf of annotator ("" when the
+	// client named none) and records events in the same transaction
+	ReplaceAnnotations(ctx context.Context, docID, annotator string, tables []annotationTable, events ...outboxEvent) error
+}
+
+// records is set in main from DB_DRIVER
+var records recordStore = postgresRecords{}
+
+// postgresRecords keeps records in PostgreSQL through pool and db
+type postgresRecords struct{}
+
+func (postgresRecords) Ping(ctx context.Context) error {
+	return pool.Ping(ctx)
+}
+
+var errRequiresPostgres = errors.New("requires DB_DRIVER=postgres")
+
+// sqliteRoutes are the mux patterns served with DB_DRIVER=sqlite
+var sqliteRoutes = map[string]bool{
+	"/healthz":                    true,
+	"/readyz":                     true,
+	"/metrics":                    true,
+	"/upload":                     true,
+	"/submit":                     true,
+	"/documents":                  true,
+	"/documents/":                 true,
+	"/documents/{id}/image":       true,
+	"/documents/{id}/thumbnail":   true,
+	"/documents/{id}/render":      true,
+	"/documents/{id}/overlay.svg": true,
+	"/admin/log-level":            true,
+	"/admin/config":               true,
+	"/v1/":                        true, // the gRPC gateway reads through records only
+	"/graphql":                    true,
+	"/openapi.json":               true,
+	"/docs/":                      true,
+}
+
+// sqliteOnly answers 501 for routes that need PostgreSQL
+func sqliteOnly(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, pattern := mux.Handler(r); pattern != "" && !sqliteRoutes[pattern] {
+			problemError(w, http.StatusNotImplemented, codeRequiresPostgres, "This endpoint "+errRequiresPostgres.Error())
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+)
+
+// ---------- Panic Recovery ----------
+
+// recoverMiddleware turns a panicking handler into a logged stack trace and a 500 problem+json
+// response, instead of the server dropping the connection. It sits inside the logging and
+// metrics middleware so the failed request is still counted and logged with its request ID.
+func recoverMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w}
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			// The server uses this panic to abort a response on purpose
+			if err, ok := v.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+				panic(v)
+			}
+			slog.ErrorContext(r.Context(), "Handler panicked",
+				"panic", fmt.Sprint(v), "method", r.Method, "path", r.URL.Path, "stack", string(debug.Stack()))
+			// Once the status line is out there is nothing left to correct; the client sees a short body
+			if rec.status == 0 {
+				problemError(rec, http.StatusInternalServerError, "", "Internal server error")
+			}
+		}()
+		next.ServeHTTP(rec, r)
+	})
+}
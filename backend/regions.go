@@ -0,0 +1,376 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"image/png"
+	"net/http"
+	"time"
+)
+
+// ---------- Regions ----------
+
+// Region is one independent drawing on a page. Regions are submitted as "region" annotations
+// with a bbox; other annotations join one through region_id.
+type Region struct {
+	ID    string `json:"id"`
+	Label string `json:"label,omitempty"`
+	BBox  []int  `json:"bbox"`
+	Page  int    `json:"page,omitempty"`
+}
+
+// checkRegionRefs verifies that every region_id names a region submitted on the same page
+func checkRegionRefs(anns []RawAnnotation) error {
+	regionPage := map[string]int{}
+	for _, ann := range anns {
+		if ann.Type == "region" {
+			if len(ann.BBox) != 4 {
+				return fmt.Errorf("region %s: bbox must be [x1, y1, x2, y2]", ann.ID)
+			}
+			regionPage[ann.ID] = ann.Page
+		}
+	}
+	for _, ann := range anns {
+		if ann.RegionID == "" {
+			continue
+		}
+		if ann.Type == "region" {
+			return fmt.Errorf("region %s cannot itself have a region_id", ann.ID)
+		}
+		page, ok := regionPage[ann.RegionID]
+		if !ok {
+			return fmt.Errorf("annotation %s references unknown region %s", ann.ID, ann.RegionID)
+		}
+		if page != ann.Page {
+			return fmt.Errorf("annotation %s is on page %d but region %s is on page %d", ann.ID, ann.Page, ann.RegionID, page)
+		}
+	}
+	return nil
+}
+
+func loadRegions(ctx context.Context, docID string) []Region {
+	regions := []Region{}
+	rows, _ := readPool(ctx).Query(ctx, sqlRegions, docID)
+	if rows != nil {
+		defer rows.Close()
+		for rows.Next() {
+			var rg Region
+			if err := rows.Scan(&rg.ID, &rg.Label, &rg.BBox, &rg.Page); err == nil {
+				regions = append(regions, rg)
+			}
+		}
+	}
+	return regions
+}
+
+func loadRegion(ctx context.Context, docID, regionID string) (Region, error) {
+	rg := Region{ID: regionID}
+	err := readPool(ctx).QueryRow(ctx, "SELECT COALESCE(label, ''), bbox, page_number FROM regions WHERE document_id = $1 AND id = $2", docID, regionID).
+		Scan(&rg.Label, &rg.BBox, &rg.Page)
+	if err != nil {
+		return rg, err
+	}
+	if len(rg.BBox) != 4 {
+		return rg, fmt.Errorf("region %s has no bbox", regionID)
+	}
+	return rg, nil
+}
+
+// extractRegion turns a document into a standalone sample of one region: only the region's
+// annotations are kept and their coordinates are shifted to the region's top-left corner
+func extractRegion(doc *OutputJSON, rg Region) *OutputJSON {
+	x0, y0 := rg.BBox[0], rg.BBox[1]
+	w, h := rg.BBox[2]-x0, rg.BBox[3]-y0
+	shift := func(v []int) []int {
+		out := make([]int, len(v))
+		for i, c := range v {
+			if i%2 == 0 {
+				out[i] = c - x0
+			} else {
+				out[i] = c - y0
+			}
+		}
+		return out
+	}
+
+	out := *doc
+	out.ImageFile = fmt.Sprintf("%s_%s.png", doc.DocumentID, rg.ID)
+	out.Width, out.Height = w, h
+	out.NumPages = 1
+	out.Pages = []PageInfo{{PageNumber: rg.Page, ImageFile: out.ImageFile, Width: w, Height: h}}
+	out.SHA256, out.SizeBytes = "", 0
+	out.Regions = []Region{{ID: rg.ID, Label: rg.Label, BBox: shift(rg.BBox), Page: rg.Page}}
+
+	// Sections the view did not load stay nil
+	if doc.Graph.Components != nil {
+		out.Graph = Graph{Components: []Component{}, Nodes: []Node{}, Connections: []Connection{}}
+		for _, c := range doc.Graph.Components {
+			if c.RegionID == rg.ID {
+				c.BBox = shift(c.BBox)
+				out.Graph.Components = append(out.Graph.Components, c)
+			}
+		}
+		for _, n := range doc.Graph.Nodes {
+			if n.RegionID == rg.ID {
+				n.Position = shift(n.Position)
+				out.Graph.Nodes = append(out.Graph.Nodes, n)
+			}
+		}
+		for _, c := range doc.Graph.Connections {
+			if c.RegionID == rg.ID {
+				c.Points = offsetPoints(c.Points, float64(x0), float64(y0))
+				out.Graph.Connections = append(out.Graph.Connections, c)
+			}
+		}
+	}
+	if doc.TextAnnotations != nil {
+		out.TextAnnotations = []TextAnnotation{}
+		for _, ta := range doc.TextAnnotations {
+			if ta.RegionID == rg.ID {
+				ta.BBox = shift(ta.BBox)
+				out.TextAnnotations = append(out.TextAnnotations, ta)
+			}
+		}
+	}
+	return &out
+}
+
+// offsetPoints returns a copy of polyline points moved by (-dx, -dy)
+func offsetPoints(raw interface{}, dx, dy float64) interface{} {
+	pts, shape := parsePoints(raw)
+	if shape == pointsNotList {
+		return raw
+	}
+	out := make([]interface{}, len(raw.([]interface{})))
+	copy(out, raw.([]interface{}))
+	for _, p := range pts {
+		out[p.Index] = withXY(out[p.Index], p.X-dx, p.Y-dy)
+	}
+	return out
+}
+
+// handleListRegions lists a document's regions: GET /documents/{id}/regions
+func handleListRegions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		jsonError(w, http.StatusMethodNotAllowed, "GET only")
+		return
+	}
+	docID := r.PathValue("id")
+
+	var exists bool
+	readPool(r.Context()).QueryRow(r.Context(), sqlDocumentExists, docID).Scan(&exists)
+	if !exists {
+		problemError(w, http.StatusNotFound, codeDocumentNotFound, "Document not found")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]interface{}{"document_id": docID, "regions": loadRegions(r.Context(), docID)})
+}
+
+// handleGetRegion returns one region as its own sample, in the shape of GET /documents/{id}:
+// GET /documents/{id}/regions/{rid}?include=&fields=&coords=relative
+// Coordinates are relative to the region's top-left corner; the image is served by /image.
+func handleGetRegion(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		jsonError(w, http.StatusMethodNotAllowed, "GET only")
+		return
+	}
+	docID, regionID := r.PathValue("id"), r.PathValue("rid")
+
+	view, err := parseDocumentView(r.URL.Query())
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	rg, err := loadRegion(r.Context(), docID, regionID)
+	if errors.Is(err, sql.ErrNoRows) {
+		jsonError(w, http.StatusNotFound, "Region not found")
+		return
+	}
+	if err != nil {
+		jsonError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	doc, err := records.LoadDocument(r.Context(), docID, view)
+	if err != nil {
+		problemError(w, http.StatusNotFound, codeDocumentNotFound, "Document not found")
+		return
+	}
+
+	body, err := view.render(r.Context(), extractRegion(doc, rg))
+	if err != nil {
+		jsonError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	jsonResponse(w, http.StatusOK, body)
+}
+
+// handleRegionImage returns the page image cropped to a region as PNG:
+// GET /documents/{id}/regions/{rid}/image
+func handleRegionImage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		jsonError(w, http.StatusMethodNotAllowed, "GET only")
+		return
+	}
+	docID, regionID := r.PathValue("id"), r.PathValue("rid")
+
+	rg, err := loadRegion(r.Context(), docID, regionID)
+	if errors.Is(err, sql.ErrNoRows) {
+		jsonError(w, http.StatusNotFound, "Region not found")
+		return
+	}
+	if err != nil {
+		jsonError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	sp, err := loadStoredPage(r.Context(), docID, rg.Page)
+	if err != nil {
+		jsonError(w, http.StatusNotFound, "Page image not found")
+		return
+	}
+
+	etag := fmt.Sprintf(`"%s-%v"`, sp.SHA256, rg.BBox)
+	if sp.SHA256 != "" && r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	img, err := decodePageCached(sp.Path)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "Failed to read page image")
+		return
+	}
+	rect, err := cropRect(rg.BBox, 0, img.Bounds())
+	if err != nil {
+		jsonError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, subImage(img, rect)); err != nil {
+		jsonError(w, http.StatusInternalServerError, "Failed to encode region")
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	if sp.SHA256 != "" {
+		w.Header().Set("ETag", etag)
+	}
+	w.Header().Set("X-Crop-Rect", fmt.Sprintf("%d,%d,%d,%d", rect.Min.X, rect.Min.Y, rect.Max.X, rect.Max.Y))
+	w.Write(buf.Bytes())
+}
+
+// ---------- Region Export ----------
+
+// buildRegionCOCO exports one COCO image per region instead of per page. Component boxes are
+// shifted into region coordinates and clipped to it; components outside any region are left out.
+func buildRegionCOCO(ctx context.Context, scope exportScope) (*COCODataset, error) {
+	out := &COCODataset{
+		Info: COCOInfo{
+			Description: fmt.Sprintf("corvina region export of project %s", scope),
+			Version:     "1.0",
+			DateCreated: time.Now().UTC().Format(time.RFC3339),
+		},
+		Images:      []COCOImage{},
+		Annotations: []COCOAnnotation{},
+		Categories:  []COCOCategory{},
+	}
+
+	regionRows, err := readPool(ctx).Query(ctx, `
+		SELECT r.document_id, r.id, r.page_number, COALESCE(r.bbox, '{}'), COALESCE(d.split, '')
+		FROM regions r JOIN documents d ON d.document_id = r.document_id
+		WHERE d.project = $1 AND ($2 = '' OR d.split = $2)
+		ORDER BY d.id, r.page_number, r.id
+	`, scope.Project, scope.Split)
+	if err != nil {
+		return nil, err
+	}
+	type regionKey struct{ docID, id string }
+	type regionImage struct {
+		imageID int
+		bbox    []int
+	}
+	images := map[regionKey]regionImage{}
+	for regionRows.Next() {
+		var k regionKey
+		var bbox []int
+		img := COCOImage{ID: len(out.Images) + 1}
+		if err := regionRows.Scan(&k.docID, &k.id, &img.Page, &bbox, &img.Split); err != nil {
+			regionRows.Close()
+			return nil, err
+		}
+		if len(bbox) != 4 {
+			continue
+		}
+		img.DocumentID, img.RegionID = k.docID, k.id
+		img.FileName = fmt.Sprintf("%s_%s.png", k.docID, k.id)
+		img.Width, img.Height = bbox[2]-bbox[0], bbox[3]-bbox[1]
+		images[k] = regionImage{img.ID, bbox}
+		out.Images = append(out.Images, img)
+	}
+	regionRows.Close()
+	if err := regionRows.Err(); err != nil {
+		return nil, err
+	}
+
+	compRows, err := readPool(ctx).Query(ctx, `
+		SELECT c.document_id, c.region_id, c.id, c.label, COALESCE(c.bbox, '{}')
+		FROM components c JOIN documents d ON d.document_id = c.document_id
+		WHERE d.project = $1 AND ($2 = '' OR d.split = $2) AND c.region_id IS NOT NULL
+		ORDER BY d.id, c.page_number, c.id
+	`, scope.Project, scope.Split)
+	if err != nil {
+		return nil, err
+	}
+	defer compRows.Close()
+
+	type compRow struct {
+		region    regionImage
+		id, label string
+		bbox      []int
+	}
+	var comps []compRow
+	labels := map[string]bool{}
+	for compRows.Next() {
+		var k regionKey
+		var c compRow
+		if err := compRows.Scan(&k.docID, &k.id, &c.id, &c.label, &c.bbox); err != nil {
+			return nil, err
+		}
+		region, ok := images[k]
+		if !ok || len(c.bbox) != 4 {
+			continue
+		}
+		c.region = region
+		comps = append(comps, c)
+		labels[c.label] = true
+	}
+	if err := compRows.Err(); err != nil {
+		return nil, err
+	}
+
+	var categoryIDs map[string]int
+	out.Categories, categoryIDs = cocoCategories(labels)
+
+	for _, c := range comps {
+		rb := c.region.bbox
+		w, h := rb[2]-rb[0], rb[3]-rb[1]
+		x1, y1 := clampInt(c.bbox[0]-rb[0], 0, w), clampInt(c.bbox[1]-rb[1], 0, h)
+		x2, y2 := clampInt(c.bbox[2]-rb[0], 0, w), clampInt(c.bbox[3]-rb[1], 0, h)
+		if x2 <= x1 || y2 <= y1 {
+			continue
+		}
+		bw, bh := float64(x2-x1), float64(y2-y1)
+		out.Annotations = append(out.Annotations, COCOAnnotation{
+			ID:          len(out.Annotations) + 1,
+			ImageID:     c.region.imageID,
+			CategoryID:  categoryIDs[c.label],
+			BBox:        []float64{float64(x1), float64(y1), bw, bh},
+			Area:        bw * bh,
+			ComponentID: c.id,
+		})
+	}
+
+	return out, nil
+}
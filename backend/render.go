@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"hash/fnv"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"log/slog"
+	"net/http"
+
+	"github.com/jackc/pgx/v5"
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// ---------- Rendered Overlays ----------
+
+var (
+	nodeColor       = color.RGBA{220, 38, 38, 255}
+	connectionColor = color.RGBA{37, 99, 235, 255}
+	textColor       = color.RGBA{22, 163, 74, 255}
+
+	// Component boxes are colored by label so each symbol class is recognizable across a page
+	labelPalette = []color.RGBA{
+		{234, 88, 12, 255}, {147, 51, 234, 255}, {219, 39, 119, 255}, {13, 148, 136, 255},
+		{202, 138, 4, 255}, {79, 70, 229, 255}, {190, 18, 60, 255}, {21, 128, 61, 255},
+	}
+)
+
+func labelColor(label string) color.RGBA {
+	h := fnv.New32a()
+	h.Write([]byte(label))
+	return labelPalette[h.Sum32()%uint32(len(labelPalette))]
+}
+
+// pageOverlay holds the annotations drawn on one page, with connection endpoints resolved
+type pageOverlay struct {
+	Components []Component
+	Nodes      []Node
+	Text       []TextAnnotation
+	Polylines  [][]image.Point
+}
+
+// loadPageOverlay gathers a page's annotations. Connections between annotations are drawn from
+// node positions or component box centers; free-drawn lines use their stored points.
+func loadPageOverlay(ctx context.Context, docID string, page int) (pageOverlay, error) {
+	doc, err := records.LoadDocument(ctx, docID, documentView{})
+	if err != nil {
+		return pageOverlay{}, err
+	}
+	graph, texts := doc.Graph, doc.TextAnnotations
+
+	var ov pageOverlay
+	anchors := map[string]image.Point{}
+	for _, c := range graph.Components {
+		if c.Page == page && len(c.BBox) == 4 {
+			ov.Components = append(ov.Components, c)
+			anchors[c.ID] = image.Pt((c.BBox[0]+c.BBox[2])/2, (c.BBox[1]+c.BBox[3])/2)
+		}
+	}
+	for _, n := range graph.Nodes {
+		if n.Page == page && len(n.Position) == 2 {
+			ov.Nodes = append(ov.Nodes, n)
+			anchors[n.ID] = image.Pt(n.Position[0], n.Position[1])
+		}
+	}
+	for _, t := range texts {
+		if t.Page == page && len(t.BBox) == 4 {
+			ov.Text = append(ov.Text, t)
+		}
+	}
+	for _, c := range graph.Connections {
+		if c.Page != page {
+			continue
+		}
+		if pts := polylinePoints(c.Points); len(pts) >= 2 {
+			ov.Polylines = append(ov.Polylines, pts)
+			continue
+		}
+		src, okS := anchors[c.SourceID]
+		dst, okT := anchors[c.TargetID]
+		if okS && okT {
+			ov.Polylines = append(ov.Polylines, []image.Point{src, dst})
+		}
+	}
+	return ov, nil
+}
+
+// overlayError answers a failed loadPageOverlay: 404 if the document went away, 503 if the
+// database couldn't be reached, 500 otherwise
+func overlayError(w http.ResponseWriter, r *http.Request, docID string, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows) || errors.Is(err, pgx.ErrNoRows):
+		jsonError(w, http.StatusNotFound, "Document or page not found")
+	case dbUnreachable(err):
+		dbUnavailableError(w, 0)
+	default:
+		slog.ErrorContext(r.Context(), "Loading annotations failed", "document_id", docID, "error", err)
+		jsonError(w, http.StatusInternalServerError, "Failed to load annotations")
+	}
+}
+
+// polylinePoints reads stored line points as pixel positions
+func polylinePoints(raw interface{}) []image.Point {
+	pts, _ := parsePoints(raw)
+	out := make([]image.Point, len(pts))
+	for i, p := range pts {
+		out[i] = image.Pt(int(p.X), int(p.Y))
+	}
+	return out
+}
+
+// ---------- Raster Drawing ----------
+
+// stamp fills a square of side w centered on (x, y)
+func stamp(img *image.RGBA, x, y, w int, c color.Color) {
+	r := image.Rect(x-w/2, y-w/2, x-w/2+w, y-w/2+w)
+	draw.Draw(img, r, image.NewUniform(c), image.Point{}, draw.Src)
+}
+
+// drawLine draws a w-pixel-wide segment with Bresenham's algorithm
+func drawLine(img *image.RGBA, p0, p1 image.Point, w int, c color.Color) {
+	dx, dy := abs(p1.X-p0.X), -abs(p1.Y-p0.Y)
+	sx, sy := 1, 1
+	if p0.X > p1.X {
+		sx = -1
+	}
+	if p0.Y > p1.Y {
+		sy = -1
+	}
+	e := dx + dy
+	x, y := p0.X, p0.Y
+	for {
+		stamp(img, x, y, w, c)
+		if x == p1.X && y == p1.Y {
+			return
+		}
+		e2 := 2 * e
+		if e2 >= dy {
+			e += dy
+			x += sx
+		}
+		if e2 <= dx {
+			e += dx
+			y += sy
+		}
+	}
+}
+
+func drawRect(img *image.RGBA, bbox []int, w int, c color.Color) {
+	tl, tr := image.Pt(bbox[0], bbox[1]), image.Pt(bbox[2], bbox[1])
+	bl, br := image.Pt(bbox[0], bbox[3]), image.Pt(bbox[2], bbox[3])
+	drawLine(img, tl, tr, w, c)
+	drawLine(img, tr, br, w, c)
+	drawLine(img, br, bl, w, c)
+	drawLine(img, bl, tl, w, c)
+}
+
+// drawLabel writes text on a filled background just above (x, y)
+func drawLabel(img *image.RGBA, x, y int, text string, bg color.Color) {
+	face := basicfont.Face7x13
+	width := font.MeasureString(face, text).Ceil()
+	top := max(0, y-face.Height-2)
+	draw.Draw(img, image.Rect(x, top, x+width+4, top+face.Height+2), image.NewUniform(bg), image.Point{}, draw.Src)
+	d := font.Drawer{
+		Dst:  img,
+		Src:  image.White,
+		Face: face,
+		Dot:  fixed.P(x+2, top+face.Ascent+1),
+	}
+	d.DrawString(text)
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// renderOverlay draws the overlay onto a copy of the page image
+func renderOverlay(page image.Image, ov pageOverlay, labels bool) *image.RGBA {
+	b := page.Bounds()
+	out := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(out, out.Bounds(), page, b.Min, draw.Src)
+
+	// Keep strokes visible on large scans without swamping small images
+	stroke := max(2, max(b.Dx(), b.Dy())/800)
+
+	for _, pl := range ov.Polylines {
+		for i := 1; i < len(pl); i++ {
+			drawLine(out, pl[i-1], pl[i], stroke, connectionColor)
+		}
+	}
+	for _, t := range ov.Text {
+		drawRect(out, t.BBox, stroke, textColor)
+	}
+	for _, c := range ov.Components {
+		drawRect(out, c.BBox, stroke, labelColor(c.Label))
+	}
+	for _, n := range ov.Nodes {
+		stamp(out, n.Position[0], n.Position[1], stroke*4, nodeColor)
+	}
+
+	if labels {
+		for _, c := range ov.Components {
+			drawLabel(out, c.BBox[0], c.BBox[1], c.Label, labelColor(c.Label))
+		}
+		for _, t := range ov.Text {
+			if t.RawText != "" && !t.IsIgnored {
+				drawLabel(out, t.BBox[0], t.BBox[1], t.RawText, textColor)
+			}
+		}
+	}
+	return out
+}
+
+// handleRenderDocument returns the page image with annotations burned in:
+// GET /documents/{id}/render?page=N&labels=0&max_size=2000
+func handleRenderDocument(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		jsonError(w, http.StatusMethodNotAllowed, "GET only")
+		return
+	}
+	docID := r.PathValue("id")
+	page, err := pageParam(r)
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	maxSize, err := intQueryParam(r, "max_size", 0)
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	labels := r.URL.Query().Get("labels") != "0"
+
+	sp, err := loadStoredPage(r.Context(), docID, page)
+	if errors.Is(err, sql.ErrNoRows) {
+		jsonError(w, http.StatusNotFound, "Document or page not found")
+		return
+	}
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "Query failed")
+		return
+	}
+	img, err := decodePageCached(sp.Path)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "Failed to read page image")
+		return
+	}
+
+	ov, err := loadPageOverlay(r.Context(), docID, page)
+	if err != nil {
+		overlayError(w, r, docID, err)
+		return
+	}
+	var out image.Image = renderOverlay(img, ov, labels)
+	if b := out.Bounds(); maxSize > 0 && max(b.Dx(), b.Dy()) > maxSize {
+		sw, sh := maxSize, max(1, b.Dy()*maxSize/b.Dx())
+		if b.Dy() > b.Dx() {
+			sw, sh = max(1, b.Dx()*maxSize/b.Dy()), maxSize
+		}
+		scaled := image.NewRGBA(image.Rect(0, 0, sw, sh))
+		xdraw.ApproxBiLinear.Scale(scaled, scaled.Bounds(), out, b, xdraw.Src, nil)
+		out = scaled
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, out); err != nil {
+		jsonError(w, http.StatusInternalServerError, "Failed to encode image")
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(buf.Bytes())
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// ---------- Read Replicas ----------
+
+// DATABASE_REPLICA_URL points read-heavy endpoints (document listing and GET, similarity search,
+// exports) at a streaming replica so large exports don't compete with annotators' saves on the
+// primary. Replica reads may trail the primary by the replication lag. Unset, everything reads
+// from the primary. The replica pool uses the same DB_* pool settings as the primary.
+var databaseReplicaURL = envString("DATABASE_REPLICA_URL", "")
+
+// replicaPool and replicaDB are the replica's pool and its database/sql view; without a replica
+// they are pool and db themselves
+var (
+	replicaPool *pgxpool.Pool
+	replicaDB   *sql.DB
+)
+
+// connectReplica opens the replica pool, or returns the primary's when none is configured.
+// Replica connections are opened read-only, so a write routed there by mistake fails loudly.
+func connectReplica() (*pgxpool.Pool, *sql.DB) {
+	if databaseReplicaURL == "" {
+		return pool, db
+	}
+	p := connectPool("DATABASE_REPLICA_URL", databaseReplicaURL, true)
+	return p, stdlib.OpenDBFromPool(p)
+}
+
+type replicaKey struct{}
+
+// withReplica marks ctx so reads made with it go to the replica
+func withReplica(ctx context.Context) context.Context {
+	return context.WithValue(ctx, replicaKey{}, true)
+}
+
+// replicaReads routes a handler's GET and HEAD requests to the replica. Other methods on the
+// same route keep reading from the primary, so a read that feeds a write never sees stale rows.
+func replicaReads(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			r = r.WithContext(withReplica(r.Context()))
+		}
+		h(w, r)
+	}
+}
+
+// readPool is the pool to read from for ctx: the replica when ctx is marked, else the primary
+func readPool(ctx context.Context) *pgxpool.Pool {
+	if ctx.Value(replicaKey{}) != nil {
+		return replicaPool
+	}
+	return pool
+}
+
+// readDB is readPool's database/sql counterpart
+func readDB(ctx context.Context) *sql.DB {
+	if ctx.Value(replicaKey{}) != nil {
+		return replicaDB
+	}
+	return db
+}
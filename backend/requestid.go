@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"net/http"
+)
+
+// ---------- Request IDs ----------
+
+// Every request gets an ID, taken from the caller's X-Request-ID when it sends a usable one (a
+// proxy or the frontend) and generated otherwise. It is echoed in the X-Request-ID response
+// header, included in problem+json bodies and every log line of the request, and forwarded to
+// the prediction and OCR services.
+const requestIDHeader = "X-Request-ID"
+
+type requestIDKey struct{}
+
+func requestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// validRequestID keeps client-supplied IDs to short printable ASCII, so they can't break log
+// lines or smuggle anything into headers
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = newID()
+		}
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// forwardRequestID copies the ID of the request that req is made on behalf of
+func forwardRequestID(req *http.Request) {
+	if id := requestIDFrom(req.Context()); id != "" {
+		req.Header.Set(requestIDHeader, id)
+	}
+}
@@ -0,0 +1,485 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ---------- Restore ----------
+
+// POST /admin/restore?conflict=skip|overwrite|rename loads an archive made by /admin/backup,
+// typically to move a dataset between deployments. Objects are written to the object store as
+// they arrive (they are content-addressed, so existing ones are left alone); the rows are loaded
+// in one transaction once the whole archive has been read.
+//
+// A document, snapshot (project and tag), or export schedule (project and name) that already
+// exists is a conflict, resolved by the policy:
+//
+//	skip       keep what is there and leave the archived copy out (the default)
+//	overwrite  replace it with the archived copy
+//	rename     load the archived copy under a new name (<id>-restored, <id>-restored-2, ...)
+
+var restoreConflictPolicies = map[string]bool{"skip": true, "overwrite": true, "rename": true}
+
+var errInvalidBackup = errors.New("invalid backup archive")
+
+// restoreSerialIDs are tables whose id is a sequence; restored rows get new ids
+var restoreSerialIDs = map[string]bool{
+	"documents": true, "submissions": true, "document_skips": true, "dataset_snapshots": true, "export_schedules": true,
+}
+
+// restoreDocumentTables hold rows that belong to a document, which follow its conflict resolution
+var restoreDocumentTables = []string{
+	"documents", "document_aliases", "document_versions", "pages", "regions", "components", "nodes",
+	"connections", "text_annotations", "suggestions", "document_embeddings", "submissions",
+	"annotation_sessions", "assignments", "document_skips",
+}
+
+// restoreAnnotationTables may point at a suggestion by id
+var restoreAnnotationTables = []string{"components", "nodes", "connections", "text_annotations"}
+
+// restoreConflicts resolves conflicts in the tables that are not keyed by document. match joins
+// the staged rows (s) to existing ones (t); rename is the SET clause applied to staged rows.
+// Tables left out (quotas, symbol_catalog) keep their existing rows under every policy.
+var restoreConflicts = map[string]struct{ match, rename string }{
+	"dataset_snapshots": {"s.project = t.project AND s.tag = t.tag", "tag = s.tag || '-restored'"},
+	"export_schedules":  {"s.project = t.project AND s.name = t.name", "name = s.name || ' (restored)'"},
+	"templates":         {"s.project = t.project AND s.name = t.name", "name = s.name || ' (restored)'"},
+}
+
+var backupObjectKey = regexp.MustCompile(`^([0-9a-f]{2})/([0-9a-f]{64})\.[a-z0-9]+$`)
+
+type RestoreDocuments struct {
+	Restored    int               `json:"restored"`
+	Skipped     []string          `json:"skipped"`
+	Overwritten []string          `json:"overwritten"`
+	Renamed     map[string]string `json:"renamed"`
+}
+
+type RestoreResult struct {
+	Conflict      string           `json:"conflict"`
+	BackupCreated string           `json:"backup_created_at"`
+	SchemaVersion int              `json:"schema_version"`
+	Tables        []BackupTable    `json:"tables"` // rows loaded
+	Documents     RestoreDocuments `json:"documents"`
+	Objects       int              `json:"objects"`
+	Files         int              `json:"files"`
+}
+
+// restoreRunning keeps restores on one instance from running concurrently
+var restoreRunning atomic.Bool
+
+// readBackupArchive unpacks a backup: table dumps and legacy files are spooled into dir, objects
+// go straight to the object store. It returns the manifest and the number of objects.
+func readBackupArchive(ctx context.Context, body io.Reader, dir string) (*BackupManifest, int, error) {
+	zr, err := gzip.NewReader(body)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: %v", errInvalidBackup, err)
+	}
+	tr := tar.NewReader(zr)
+
+	var manifest *BackupManifest
+	objects := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, 0, err
+		}
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("%w: %v", errInvalidBackup, err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		switch name := path.Clean(hdr.Name); {
+		case name == "backup.json":
+			manifest = &BackupManifest{}
+			if err := json.NewDecoder(tr).Decode(manifest); err != nil {
+				return nil, 0, fmt.Errorf("%w: backup.json: %v", errInvalidBackup, err)
+			}
+
+		case strings.HasPrefix(name, "db/"):
+			table := strings.TrimSuffix(strings.TrimPrefix(name, "db/"), ".csv")
+			if !slices.Contains(backupTables, table) {
+				slog.WarnContext(ctx, "Restore ignored unknown table", "table", table)
+				continue
+			}
+			if err := spoolFile(filepath.Join(dir, table+".csv"), tr); err != nil {
+				return nil, 0, err
+			}
+
+		case strings.HasPrefix(name, "objects/"):
+			key := strings.TrimPrefix(name, "objects/")
+			m := backupObjectKey.FindStringSubmatch(key)
+			if m == nil || !strings.HasPrefix(m[2], m[1]) {
+				return nil, 0, fmt.Errorf("%w: %s is not an object key", errInvalidBackup, key)
+			}
+			obj, err := storeObject(tr, path.Ext(key))
+			if err != nil {
+				return nil, 0, fmt.Errorf("storing %s: %w", key, err)
+			}
+			if obj.Key != key {
+				return nil, 0, fmt.Errorf("%w: %s does not match its content", errInvalidBackup, key)
+			}
+			objects++
+
+		case strings.HasPrefix(name, "files/"):
+			parts := strings.Split(strings.TrimPrefix(name, "files/"), "/")
+			if len(parts) != 2 || !filepath.IsLocal(parts[0]) || !filepath.IsLocal(parts[1]) {
+				return nil, 0, fmt.Errorf("%w: unexpected file %s", errInvalidBackup, name)
+			}
+			if err := spoolFile(filepath.Join(dir, "files", parts[0], parts[1]), tr); err != nil {
+				return nil, 0, err
+			}
+		}
+	}
+
+	if manifest == nil {
+		return nil, 0, fmt.Errorf("%w: backup.json is missing", errInvalidBackup)
+	}
+	return manifest, objects, nil
+}
+
+// spoolFile writes src to dst, creating its directory
+func spoolFile(dst string, src io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, src)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// csvColumns reads the header of a table dump
+func csvColumns(file string) ([]string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	header, err := csv.NewReader(f).Read()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", errInvalidBackup, filepath.Base(file), err)
+	}
+	return header, nil
+}
+
+// restoreName finds a free document id for an archived document that conflicts with id
+func restoreName(ctx context.Context, tx pgx.Tx, id string, taken map[string]bool) (string, error) {
+	for n := 1; ; n++ {
+		name := id + "-restored"
+		if n > 1 {
+			name += fmt.Sprintf("-%d", n)
+		}
+		if taken[name] {
+			continue
+		}
+		var exists bool
+		err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM documents WHERE document_id = $1)
+			OR EXISTS (SELECT 1 FROM restore_documents WHERE document_id = $1)`, name).Scan(&exists)
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			taken[name] = true
+			return name, nil
+		}
+	}
+}
+
+// restoreDatabase loads the table dumps in dir into the database. Each table is copied into a
+// temporary staging table, conflicts are resolved there, and the rest is inserted.
+func restoreDatabase(ctx context.Context, tx pgx.Tx, dir, policy string, res *RestoreResult) error {
+	staged := map[string][]string{}
+	for _, table := range backupTables {
+		file := filepath.Join(dir, table+".csv")
+		if _, err := os.Stat(file); err != nil {
+			continue
+		}
+		cols, err := csvColumns(file)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, fmt.Sprintf("CREATE TEMP TABLE restore_%s (LIKE %s INCLUDING DEFAULTS) ON COMMIT DROP", table, table)); err != nil {
+			return err
+		}
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		quoted := make([]string, len(cols))
+		for i, c := range cols {
+			quoted[i] = pgx.Identifier{c}.Sanitize()
+		}
+		_, err = tx.Conn().PgConn().CopyFrom(ctx, f, fmt.Sprintf("COPY restore_%s (%s) FROM STDIN WITH (FORMAT csv, HEADER true)", table, strings.Join(quoted, ", ")))
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%w: loading %s: %v", errInvalidBackup, table, err)
+		}
+		staged[table] = cols
+	}
+	if staged["documents"] == nil {
+		return fmt.Errorf("%w: db/documents.csv is missing", errInvalidBackup)
+	}
+
+	// Conflicting documents, resolved for every table that hangs off them
+	rows, err := tx.Query(ctx, "SELECT document_id FROM restore_documents WHERE document_id IN (SELECT document_id FROM documents) ORDER BY 1")
+	if err != nil {
+		return err
+	}
+	conflicts, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return err
+	}
+	if len(conflicts) > 0 {
+		switch policy {
+		case "skip":
+			for _, table := range restoreDocumentTables {
+				if staged[table] == nil {
+					continue
+				}
+				if _, err := tx.Exec(ctx, fmt.Sprintf("DELETE FROM restore_%s WHERE document_id = ANY($1)", table), conflicts); err != nil {
+					return err
+				}
+			}
+			res.Documents.Skipped = conflicts
+		case "overwrite":
+			// Annotations, pages, and embeddings go with the document (ON DELETE CASCADE)
+			if _, err := tx.Exec(ctx, "DELETE FROM documents WHERE document_id = ANY($1)", conflicts); err != nil {
+				return err
+			}
+			res.Documents.Overwritten = conflicts
+		case "rename":
+			taken := map[string]bool{}
+			for _, id := range conflicts {
+				name, err := restoreName(ctx, tx, id, taken)
+				if err != nil {
+					return err
+				}
+				for _, table := range restoreDocumentTables {
+					if staged[table] == nil {
+						continue
+					}
+					if _, err := tx.Exec(ctx, fmt.Sprintf("UPDATE restore_%s SET document_id = $2 WHERE document_id = $1", table), id, name); err != nil {
+						return err
+					}
+				}
+				// Suggestion and session ids are unique across documents, so the copy's would
+				// collide with the original's
+				if staged["annotation_sessions"] != nil {
+					if _, err := tx.Exec(ctx, "UPDATE restore_annotation_sessions SET id = id || '@' || document_id WHERE document_id = $1", name); err != nil {
+						return err
+					}
+				}
+				if staged["suggestions"] != nil {
+					if _, err := tx.Exec(ctx, "UPDATE restore_suggestions SET id = id || '@' || document_id WHERE document_id = $1", name); err != nil {
+						return err
+					}
+					for _, table := range restoreAnnotationTables {
+						if staged[table] == nil || !slices.Contains(staged[table], "suggestion_id") {
+							continue
+						}
+						if _, err := tx.Exec(ctx, fmt.Sprintf("UPDATE restore_%s SET suggestion_id = suggestion_id || '@' || document_id WHERE document_id = $1 AND suggestion_id IS NOT NULL", table), name); err != nil {
+							return err
+						}
+					}
+				}
+				res.Documents.Renamed[id] = name
+			}
+		}
+	}
+
+	for table, c := range restoreConflicts {
+		if staged[table] == nil {
+			continue
+		}
+		var q string
+		switch policy {
+		case "skip":
+			q = fmt.Sprintf("DELETE FROM restore_%s s USING %s t WHERE %s", table, table, c.match)
+		case "overwrite":
+			q = fmt.Sprintf("DELETE FROM %s t USING restore_%s s WHERE %s", table, table, c.match)
+		case "rename":
+			q = fmt.Sprintf("UPDATE restore_%s s SET %s FROM %s t WHERE %s", table, c.rename, table, c.match)
+		}
+		if _, err := tx.Exec(ctx, q); err != nil {
+			return err
+		}
+	}
+
+	for _, table := range backupTables {
+		cols := staged[table]
+		if cols == nil {
+			continue
+		}
+		if restoreSerialIDs[table] {
+			cols = slices.DeleteFunc(slices.Clone(cols), func(c string) bool { return c == "id" })
+		}
+		list := make([]string, len(cols))
+		for i, c := range cols {
+			list[i] = pgx.Identifier{c}.Sanitize()
+		}
+		// Whatever still collides (a renamed snapshot tag that is also taken) is left out
+		tag, err := tx.Exec(ctx, fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM restore_%s ON CONFLICT DO NOTHING",
+			table, strings.Join(list, ", "), strings.Join(list, ", "), table))
+		if err != nil {
+			return fmt.Errorf("restoring %s: %w", table, err)
+		}
+		res.Tables = append(res.Tables, BackupTable{Name: table, Rows: tag.RowsAffected()})
+		if table == "documents" {
+			res.Documents.Restored = int(tag.RowsAffected())
+		}
+	}
+	return nil
+}
+
+// restoreFiles moves the files of pre-content-addressing documents into place under the
+// document ids they were restored as
+func restoreFiles(dir string, res *RestoreResult) error {
+	root := filepath.Join(dir, "files")
+	entries, err := os.ReadDir(root)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		docID := e.Name()
+		if slices.Contains(res.Documents.Skipped, docID) {
+			continue
+		}
+		if name, ok := res.Documents.Renamed[docID]; ok {
+			docID = name
+		}
+		files, err := os.ReadDir(filepath.Join(root, e.Name()))
+		if err != nil {
+			return err
+		}
+		for _, f := range files {
+			src, err := os.Open(filepath.Join(root, e.Name(), f.Name()))
+			if err != nil {
+				return err
+			}
+			err = spoolFile(filepath.Join(datasetDir, docID, f.Name()), src)
+			src.Close()
+			if err != nil {
+				return err
+			}
+			res.Files++
+		}
+	}
+	return nil
+}
+
+// handleRestore loads a backup archive sent as the request body: POST /admin/restore
+func handleRestore(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		jsonError(w, http.StatusMethodNotAllowed, "POST only")
+		return
+	}
+	policy := r.URL.Query().Get("conflict")
+	if policy == "" {
+		policy = "skip"
+	}
+	if !restoreConflictPolicies[policy] {
+		jsonError(w, http.StatusBadRequest, "conflict must be skip, overwrite, or rename")
+		return
+	}
+	if !restoreRunning.CompareAndSwap(false, true) {
+		jsonError(w, http.StatusConflict, "A restore is already running")
+		return
+	}
+	defer restoreRunning.Store(false)
+
+	// Archives are large: neither the upload nor loading the tables fits the usual timeouts
+	ctx := withoutQueryTimeout(r.Context())
+	http.NewResponseController(w).SetReadDeadline(time.Time{})
+
+	start := time.Now()
+	dir, err := os.MkdirTemp("", "corvina-restore-*")
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "Failed to restore backup")
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	manifest, objects, err := readBackupArchive(ctx, r.Body, dir)
+	if errors.Is(err, errInvalidBackup) {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Reading backup failed", "error", err)
+		jsonError(w, http.StatusInternalServerError, "Failed to read backup")
+		return
+	}
+	if manifest.Format != backupFormat {
+		jsonError(w, http.StatusUnprocessableEntity, fmt.Sprintf("Backup format %d is not supported (expected %d)", manifest.Format, backupFormat))
+		return
+	}
+	// Tables only ever gain columns with defaults, so an older dump loads into a newer schema
+	if latest := migrations[len(migrations)-1].Version; manifest.SchemaVersion > latest {
+		jsonError(w, http.StatusUnprocessableEntity, fmt.Sprintf("Backup was taken at schema version %d; this server is at %d", manifest.SchemaVersion, latest))
+		return
+	}
+
+	var res RestoreResult
+	err = inTx(ctx, "restore", func(tx pgx.Tx) error {
+		res = RestoreResult{
+			Conflict: policy, BackupCreated: manifest.CreatedAt, SchemaVersion: manifest.SchemaVersion, Objects: objects,
+			Documents: RestoreDocuments{Skipped: []string{}, Overwritten: []string{}, Renamed: map[string]string{}},
+		}
+		return restoreDatabase(ctx, tx, dir, policy, &res)
+	})
+	if errors.Is(err, errInvalidBackup) {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Restoring backup failed", "error", err)
+		jsonError(w, http.StatusInternalServerError, "Failed to restore backup")
+		return
+	}
+	for _, id := range res.Documents.Overwritten {
+		documentCache.forget(id)
+	}
+	if err := restoreFiles(dir, &res); err != nil {
+		slog.ErrorContext(ctx, "Restoring files failed", "error", err)
+		jsonError(w, http.StatusInternalServerError, "Rows were restored but writing their files failed")
+		return
+	}
+
+	slog.InfoContext(ctx, "Restore complete", "conflict", policy, "documents", res.Documents.Restored,
+		"skipped", len(res.Documents.Skipped), "overwritten", len(res.Documents.Overwritten), "renamed", len(res.Documents.Renamed),
+		"objects", res.Objects, "files", res.Files, "duration_ms", time.Since(start).Milliseconds())
+	jsonResponse(w, http.StatusOK, res)
+}
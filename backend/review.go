@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ---------- Suggestion Review ----------
+
+var errSuggestionConflict = errors.New("suggestion conflict")
+
+// SuggestionReview selects suggestions to accept or reject: explicit ids, or every pending
+// suggestion (all) optionally narrowed by source and minimum confidence
+type SuggestionReview struct {
+	IDs           []string `json:"ids"`
+	All           bool     `json:"all"`
+	Source        string   `json:"source"`
+	MinConfidence float64  `json:"min_confidence"`
+	Reviewer      string   `json:"reviewer"`
+}
+
+// typeOrder makes boxes, nodes, and text land before the connections that may refer to them
+var typeOrder = map[string]int{"box": 0, "node": 0, "text": 0, "line": 1, "connection": 1}
+
+// reviewSuggestions accepts or rejects pending suggestions in one transaction. Accepted
+// suggestions are copied into the annotation tables with their source as provenance.
+func reviewSuggestions(ctx context.Context, docID string, rv SuggestionReview, accept bool) ([]string, error) {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	query := "SELECT " + suggestionColumns + " FROM suggestions WHERE document_id = $1 AND status = 'pending'"
+	args := []interface{}{docID}
+	if len(rv.IDs) > 0 {
+		args = append(args, rv.IDs)
+		query += fmt.Sprintf(" AND id = ANY($%d::text[])", len(args))
+	}
+	if rv.Source != "" {
+		args = append(args, rv.Source)
+		query += fmt.Sprintf(" AND source = $%d", len(args))
+	}
+	if rv.MinConfidence > 0 {
+		args = append(args, rv.MinConfidence)
+		query += fmt.Sprintf(" AND confidence >= $%d", len(args))
+	}
+	rows, err := tx.Query(ctx, query+" FOR UPDATE", args...)
+	if err != nil {
+		return nil, err
+	}
+	var suggestions []Suggestion
+	for rows.Next() {
+		s, err := scanSuggestion(rows.Scan)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		suggestions = append(suggestions, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(rv.IDs) > 0 && len(suggestions) != len(rv.IDs) {
+		found := map[string]bool{}
+		for _, s := range suggestions {
+			found[s.ID] = true
+		}
+		var missing []string
+		for _, id := range rv.IDs {
+			if !found[id] {
+				missing = append(missing, id)
+			}
+		}
+		return nil, fmt.Errorf("%w: not pending or not found: %s", errSuggestionConflict, strings.Join(missing, ", "))
+	}
+
+	sort.SliceStable(suggestions, func(i, j int) bool {
+		return typeOrder[suggestions[i].Type] < typeOrder[suggestions[j].Type]
+	})
+
+	status := "rejected"
+	if accept {
+		status = "accepted"
+	}
+	ids := make([]string, 0, len(suggestions))
+	for _, s := range suggestions {
+		if accept {
+			if err := promoteSuggestion(ctx, tx, s); err != nil {
+				return nil, fmt.Errorf("accepting %s: %w", s.ID, err)
+			}
+		}
+		ids = append(ids, s.ID)
+	}
+	if len(ids) > 0 {
+		_, err := tx.Exec(ctx, `
+			UPDATE suggestions SET status = $1, decided_at = now(), decided_by = NULLIF($2, '')
+			WHERE document_id = $3 AND id = ANY($4::text[])
+		`, status, rv.Reviewer, docID, ids)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ids, tx.Commit(ctx)
+}
+
+// promoteSuggestion writes an accepted suggestion into the matching annotation table
+func promoteSuggestion(ctx context.Context, tx pgx.Tx, s Suggestion) error {
+	var err error
+	switch {
+	case s.AnnotationID != "":
+		// Draft text for an existing text box
+		var tag pgconn.CommandTag
+		tag, err = tx.Exec(ctx,
+			`UPDATE text_annotations SET raw_text = $1, provenance = $2, suggestion_id = $3,
+				model_name = NULLIF($6, ''), model_version = NULLIF($7, '')
+			WHERE document_id = $4 AND id = $5`,
+			s.RawText, s.Source, s.ID, s.DocumentID, s.AnnotationID, s.ModelName, s.ModelVersion,
+		)
+		if err == nil {
+			if tag.RowsAffected() == 0 {
+				return fmt.Errorf("%w: text annotation %s no longer exists", errSuggestionConflict, s.AnnotationID)
+			}
+		}
+
+	case s.Type == "box":
+		_, err = tx.Exec(ctx,
+			"INSERT INTO components (id, document_id, label, bbox, page_number, provenance, suggestion_id, model_name, model_version) VALUES ($1, $2, $3, $4, $5, $6, $1, NULLIF($7, ''), NULLIF($8, ''))",
+			s.ID, s.DocumentID, s.Label, s.BBox, s.Page, s.Source, s.ModelName, s.ModelVersion,
+		)
+
+	case s.Type == "node":
+		_, err = tx.Exec(ctx,
+			"INSERT INTO nodes (id, document_id, position, page_number, provenance, suggestion_id, model_name, model_version) VALUES ($1, $2, $3, $4, $5, $1, NULLIF($6, ''), NULLIF($7, ''))",
+			s.ID, s.DocumentID, s.Position, s.Page, s.Source, s.ModelName, s.ModelVersion,
+		)
+
+	case s.Type == "connection":
+		_, err = tx.Exec(ctx,
+			"INSERT INTO connections (id, document_id, source_id, target_id, page_number, provenance, suggestion_id, model_name, model_version) VALUES ($1, $2, $3, $4, $5, $6, $1, NULLIF($7, ''), NULLIF($8, ''))",
+			s.ID, s.DocumentID, s.SourceID, s.TargetID, s.Page, s.Source, s.ModelName, s.ModelVersion,
+		)
+
+	case s.Type == "line":
+		_, err = tx.Exec(ctx,
+			"INSERT INTO connections (id, document_id, source_id, target_id, type, points, page_number, provenance, suggestion_id, model_name, model_version) VALUES ($1, $2, $3, $4, 'line', $5, $6, $7, $1, NULLIF($8, ''), NULLIF($9, ''))",
+			s.ID, s.DocumentID, s.SourceID, s.TargetID, s.Points, s.Page, s.Source, s.ModelName, s.ModelVersion,
+		)
+
+	case s.Type == "text":
+		_, err = tx.Exec(ctx,
+			"INSERT INTO text_annotations (id, document_id, bbox, raw_text, is_ignored, page_number, provenance, suggestion_id, model_name, model_version) VALUES ($1, $2, $3, $4, false, $5, $6, $1, NULLIF($7, ''), NULLIF($8, ''))",
+			s.ID, s.DocumentID, s.BBox, s.RawText, s.Page, s.Source, s.ModelName, s.ModelVersion,
+		)
+
+	default:
+		return fmt.Errorf("unknown suggestion type %q", s.Type)
+	}
+	return err
+}
+
+// writeReviewResult sends the outcome of a review, mapping conflicts to 409
+func writeReviewResult(w http.ResponseWriter, docID string, ids []string, err error, accept bool) {
+	if errors.Is(err, errSuggestionConflict) {
+		jsonError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		slog.Error("Suggestion review failed", "document_id", docID, "error", err)
+		jsonError(w, http.StatusInternalServerError, "Failed to review suggestions: "+err.Error())
+		return
+	}
+	key := "rejected"
+	if accept {
+		key = "accepted"
+	}
+	jsonResponse(w, http.StatusOK, map[string]interface{}{
+		"status":      "success",
+		"document_id": docID,
+		key:           ids,
+	})
+}
+
+// handleReviewSuggestions accepts or rejects suggestions in bulk:
+// POST /documents/{id}/suggestions/{action} with action accept or reject
+func handleReviewSuggestions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		jsonError(w, http.StatusMethodNotAllowed, "POST only")
+		return
+	}
+	action := r.PathValue("action")
+	if action != "accept" && action != "reject" {
+		jsonError(w, http.StatusNotFound, "Unknown action")
+		return
+	}
+
+	var rv SuggestionReview
+	if err := json.NewDecoder(r.Body).Decode(&rv); err != nil {
+		jsonError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+	if len(rv.IDs) == 0 && !rv.All {
+		jsonError(w, http.StatusBadRequest, "Pass ids or all: true")
+		return
+	}
+
+	docID := r.PathValue("id")
+	ids, err := reviewSuggestions(r.Context(), docID, rv, action == "accept")
+	writeReviewResult(w, docID, ids, err, action == "accept")
+}
+
+// handleReviewSuggestion accepts or rejects one suggestion: POST /suggestions/{sid}/{action}
+func handleReviewSuggestion(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		jsonError(w, http.StatusMethodNotAllowed, "POST only")
+		return
+	}
+	action := r.PathValue("action")
+	if action != "accept" && action != "reject" {
+		jsonError(w, http.StatusNotFound, "Unknown action")
+		return
+	}
+	sid := r.PathValue("sid")
+
+	var docID string
+	if err := db.QueryRowContext(r.Context(), "SELECT document_id FROM suggestions WHERE id = $1", sid).Scan(&docID); err != nil {
+		jsonError(w, http.StatusNotFound, "Suggestion not found")
+		return
+	}
+
+	// The body is optional here; it only carries the reviewer name
+	var rv SuggestionReview
+	json.NewDecoder(r.Body).Decode(&rv)
+	rv.IDs, rv.All = []string{sid}, false
+
+	ids, err := reviewSuggestions(r.Context(), docID, rv, action == "accept")
+	writeReviewResult(w, docID, ids, err, action == "accept")
+}
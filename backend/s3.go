@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// ---------- S3 Storage ----------
+
+// S3-compatible object store settings (AWS S3, MinIO, R2, ...). Without S3_ACCESS_KEY the
+// credentials come from the standard AWS environment variables or the ECS/EC2 instance role.
+var (
+	s3Endpoint  = envString("S3_ENDPOINT", "s3.amazonaws.com")
+	s3Region    = envString("S3_REGION", "")
+	s3Bucket    = envString("S3_BUCKET", "")
+	s3Prefix    = envString("S3_PREFIX", "objects/")
+	s3AccessKey = envString("S3_ACCESS_KEY", "")
+	s3SecretKey = envString("S3_SECRET_KEY", "")
+	s3UseSSL    = envBool("S3_USE_SSL", true)
+	// Uploads larger than one part are sent as multipart uploads of this size
+	s3PartSize = envInt("S3_PART_SIZE_MB", 16)
+)
+
+type s3Storage struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+func newS3Storage() (*s3Storage, error) {
+	if s3Bucket == "" {
+		return nil, fmt.Errorf("S3_BUCKET is not set")
+	}
+	creds := credentials.NewChainCredentials([]credentials.Provider{&credentials.EnvAWS{}, &credentials.IAM{}})
+	if s3AccessKey != "" {
+		creds = credentials.NewStaticV4(s3AccessKey, s3SecretKey, "")
+	}
+	client, err := minio.New(s3Endpoint, &minio.Options{Creds: creds, Secure: s3UseSSL, Region: s3Region})
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	ok, err := client.BucketExists(ctx, s3Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("checking bucket %s: %w", s3Bucket, err)
+	}
+	if !ok {
+		return nil, fmt.Errorf("bucket %s does not exist", s3Bucket)
+	}
+	return &s3Storage{client: client, bucket: s3Bucket, prefix: s3Prefix}, nil
+}
+
+// isS3NotFound reports the error S3 returns for a missing key
+func isS3NotFound(err error) bool {
+	code := minio.ToErrorResponse(err).Code
+	return code == "NoSuchKey" || code == "NotFound"
+}
+
+// Put streams src to the bucket. Files report their size so the part count is known up front;
+// other readers are buffered one part at a time.
+func (s *s3Storage) Put(key string, src io.Reader) error {
+	size := int64(-1)
+	if f, ok := src.(*os.File); ok {
+		if info, err := f.Stat(); err == nil {
+			pos, _ := f.Seek(0, io.SeekCurrent)
+			size = info.Size() - pos
+		}
+	}
+	opts := minio.PutObjectOptions{
+		ContentType: mime.TypeByExtension(path.Ext(key)),
+		PartSize:    uint64(s3PartSize) << 20,
+	}
+	_, err := s.client.PutObject(context.Background(), s.bucket, s.prefix+key, src, size, opts)
+	return err
+}
+
+func (s *s3Storage) Get(key string) (io.ReadCloser, error) {
+	obj, err := s.client.GetObject(context.Background(), s.bucket, s.prefix+key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	// GetObject is lazy; Stat surfaces a missing key before the first read
+	if _, err := obj.Stat(); err != nil {
+		obj.Close()
+		if isS3NotFound(err) {
+			return nil, fmt.Errorf("object %s: %w", key, fs.ErrNotExist)
+		}
+		return nil, err
+	}
+	return obj, nil
+}
+
+func (s *s3Storage) Delete(key string) error {
+	return s.client.RemoveObject(context.Background(), s.bucket, s.prefix+key, minio.RemoveObjectOptions{})
+}
+
+func (s *s3Storage) List(prefix string) ([]string, error) {
+	var keys []string
+	opts := minio.ListObjectsOptions{Prefix: s.prefix + prefix, Recursive: true}
+	for obj := range s.client.ListObjects(context.Background(), s.bucket, opts) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+		keys = append(keys, strings.TrimPrefix(obj.Key, s.prefix))
+	}
+	return keys, nil
+}
+
+func (s *s3Storage) Exists(key string) (bool, error) {
+	_, err := s.client.StatObject(context.Background(), s.bucket, s.prefix+key, minio.StatObjectOptions{})
+	if isS3NotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *s3Storage) Usage() (int, int64, error) {
+	objects, bytes := 0, int64(0)
+	for obj := range s.client.ListObjects(context.Background(), s.bucket, minio.ListObjectsOptions{Prefix: s.prefix, Recursive: true}) {
+		if obj.Err != nil {
+			return 0, 0, obj.Err
+		}
+		objects++
+		bytes += obj.Size
+	}
+	return objects, bytes, nil
+}
+
+func (s *s3Storage) ModTime(key string) (time.Time, error) {
+	info, err := s.client.StatObject(context.Background(), s.bucket, s.prefix+key, minio.StatObjectOptions{})
+	if isS3NotFound(err) {
+		return time.Time{}, fmt.Errorf("object %s: %w", key, fs.ErrNotExist)
+	}
+	return info.LastModified, err
+}
+
+// PresignGet returns a time-limited URL that downloads the object directly from S3
+func (s *s3Storage) PresignGet(key, filename string, ttl time.Duration) (string, error) {
+	params := url.Values{}
+	if filename != "" {
+		params.Set("response-content-disposition", fmt.Sprintf("inline; filename=%q", filename))
+	}
+	u, err := s.client.PresignedGetObject(context.Background(), s.bucket, s.prefix+key, ttl, params)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
@@ -0,0 +1,399 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // schedules may name any IANA zone; the runtime image has no zoneinfo
+)
+
+// ---------- Scheduled Exports ----------
+
+var schedulerInterval = envDuration("SCHEDULER_INTERVAL", 30*time.Second)
+
+// exportDir is the root scheduled exports are written under. A schedule's destination is a
+// directory relative to it and can't climb out of it.
+var exportDir = envString("EXPORT_DIR", "exports")
+
+// exportFormats lists the formats a schedule may request
+var exportFormats = map[string]bool{"coco": true}
+
+type ExportSchedule struct {
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	Project     string `json:"project"`
+	Split       string `json:"split,omitempty"`
+	Format      string `json:"format"`
+	Destination string `json:"destination"` // relative to EXPORT_DIR
+	Cron        string `json:"cron"`
+	Timezone    string `json:"timezone"`
+	Enabled     bool   `json:"enabled"`
+	NextRunAt   string `json:"next_run_at,omitempty"`
+	LastRunAt   string `json:"last_run_at,omitempty"`
+	LastStatus  string `json:"last_status,omitempty"`
+	LastError   string `json:"last_error,omitempty"`
+	LastOutput  string `json:"last_output,omitempty"`
+}
+
+// exportJobPayload is queued by the scheduler (or a manual trigger) for the "export" job kind
+type exportJobPayload struct {
+	ScheduleID  int64  `json:"schedule_id,omitempty"`
+	Project     string `json:"project"`
+	Split       string `json:"split,omitempty"`
+	Format      string `json:"format"`
+	Destination string `json:"destination"`
+}
+
+func init() {
+	registerJobHandler("export", runExportJob)
+}
+
+// nextScheduleRun computes the next fire time of a cron expression in the given zone
+func nextScheduleRun(expr, tz string, after time.Time) (time.Time, error) {
+	sched, err := parseCron(expr)
+	if err != nil {
+		return time.Time{}, err
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unknown timezone %q", tz)
+	}
+	next := sched.Next(after.In(loc))
+	if next.IsZero() {
+		return next, fmt.Errorf("cron expression %q never fires", expr)
+	}
+	return next, nil
+}
+
+// runScheduler enqueues export jobs for due schedules until ctx is cancelled
+func runScheduler(ctx context.Context) {
+	ticker := time.NewTicker(schedulerInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := enqueueDueExports(ctx); err != nil {
+			slog.Error("Scheduler failed", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// enqueueDueExports queues one job per due schedule and advances next_run_at in the same transaction,
+// so concurrent backend instances never enqueue the same run twice
+func enqueueDueExports(ctx context.Context) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, project, COALESCE(split, ''), format, destination, cron, timezone
+		FROM export_schedules
+		WHERE enabled AND next_run_at <= now()
+		FOR UPDATE SKIP LOCKED
+	`)
+	if err != nil {
+		return err
+	}
+	var due []ExportSchedule
+	for rows.Next() {
+		var s ExportSchedule
+		if err := rows.Scan(&s.ID, &s.Project, &s.Split, &s.Format, &s.Destination, &s.Cron, &s.Timezone); err != nil {
+			rows.Close()
+			return err
+		}
+		due = append(due, s)
+	}
+	rows.Close()
+
+	for _, s := range due {
+		jobID, err := enqueueJob(ctx, tx, "export", exportJobPayload{
+			ScheduleID:  s.ID,
+			Project:     s.Project,
+			Split:       s.Split,
+			Format:      s.Format,
+			Destination: s.Destination,
+		})
+		if err != nil {
+			return err
+		}
+
+		next, err := nextScheduleRun(s.Cron, s.Timezone, time.Now())
+		if err != nil {
+			// The expression was validated on creation; disable rather than spin
+			slog.Warn("Disabling export schedule", "schedule_id", s.ID, "error", err)
+			_, err = tx.ExecContext(ctx, "UPDATE export_schedules SET enabled = false, last_error = $1 WHERE id = $2", err.Error(), s.ID)
+		} else {
+			_, err = tx.ExecContext(ctx, "UPDATE export_schedules SET next_run_at = $1 WHERE id = $2", next, s.ID)
+		}
+		if err != nil {
+			return err
+		}
+		slog.Info("Export schedule queued", "schedule_id", s.ID, "job_id", jobID, "project", s.Project)
+	}
+
+	return tx.Commit()
+}
+
+// runExportJob writes a timestamped export plus a stable "latest" copy into the destination directory
+func runExportJob(ctx context.Context, raw json.RawMessage) (interface{}, error) {
+	var p exportJobPayload
+	if err := json.Unmarshal(raw, &p); err != nil {
+		return nil, err
+	}
+
+	outPath, err := writeExport(withReplica(ctx), p)
+	status, errMsg := "success", ""
+	if err != nil {
+		status, errMsg = "failed", err.Error()
+	}
+	if p.ScheduleID != 0 {
+		db.ExecContext(ctx,
+			"UPDATE export_schedules SET last_run_at = now(), last_status = $1, last_error = $2, last_output = $3 WHERE id = $4",
+			status, errMsg, outPath, p.ScheduleID,
+		)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{"output": outPath}, nil
+}
+
+// exportDestination checks a schedule's destination and returns it cleaned
+func exportDestination(dest string) (string, error) {
+	dest = filepath.Clean(strings.TrimSpace(dest))
+	if dest == "." || !filepath.IsLocal(dest) {
+		return "", fmt.Errorf("destination must be a directory relative to EXPORT_DIR, without ..")
+	}
+	return dest, nil
+}
+
+func writeExport(ctx context.Context, p exportJobPayload) (string, error) {
+	if !exportFormats[p.Format] {
+		return "", fmt.Errorf("unsupported export format %q", p.Format)
+	}
+	// Schedules made before EXPORT_DIR may hold absolute paths; they are refused here too
+	dest, err := exportDestination(p.Destination)
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(exportDir, dest)
+
+	scope := exportScope{Project: p.Project, Split: p.Split}
+	dataset, err := buildCOCO(ctx, scope)
+	if err != nil {
+		return "", fmt.Errorf("building export: %w", err)
+	}
+	data, err := json.MarshalIndent(dataset, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	stamp := time.Now().UTC().Format("20060102-150405")
+	outPath := filepath.Join(dir, fmt.Sprintf("%s_%s_%s.json", exportBaseName(scope), p.Format, stamp))
+	if err := writeFileAtomic(outPath, data); err != nil {
+		return "", err
+	}
+	latest := filepath.Join(dir, fmt.Sprintf("%s_%s_latest.json", exportBaseName(scope), p.Format))
+	if err := writeFileAtomic(latest, data); err != nil {
+		return "", err
+	}
+	return outPath, nil
+}
+
+// writeFileAtomic writes via a temp file and rename so readers never observe a partial file
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// ---------- Schedule Endpoints ----------
+
+const scheduleColumns = "id, name, project, COALESCE(split, ''), format, destination, cron, timezone, enabled, next_run_at, last_run_at, last_status, last_error, last_output"
+
+func scanSchedule(scan func(dest ...interface{}) error) (ExportSchedule, error) {
+	var s ExportSchedule
+	var nextRun, lastRun sql.NullTime
+	var lastStatus, lastError, lastOutput sql.NullString
+	err := scan(&s.ID, &s.Name, &s.Project, &s.Split, &s.Format, &s.Destination, &s.Cron, &s.Timezone, &s.Enabled,
+		&nextRun, &lastRun, &lastStatus, &lastError, &lastOutput)
+	if err != nil {
+		return s, err
+	}
+	if nextRun.Valid {
+		s.NextRunAt = nextRun.Time.Format(time.RFC3339)
+	}
+	if lastRun.Valid {
+		s.LastRunAt = lastRun.Time.Format(time.RFC3339)
+	}
+	s.LastStatus = lastStatus.String
+	s.LastError = lastError.String
+	s.LastOutput = lastOutput.String
+	return s, nil
+}
+
+// handleExportSchedules lists (GET) or creates (POST) export schedules
+func handleExportSchedules(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		rows, err := db.QueryContext(r.Context(), "SELECT "+scheduleColumns+" FROM export_schedules ORDER BY id")
+		if err != nil {
+			jsonError(w, http.StatusInternalServerError, "Query failed")
+			return
+		}
+		defer rows.Close()
+
+		schedules := []ExportSchedule{}
+		for rows.Next() {
+			s, err := scanSchedule(rows.Scan)
+			if err != nil {
+				continue
+			}
+			schedules = append(schedules, s)
+		}
+		jsonResponse(w, http.StatusOK, map[string]interface{}{
+			"schedules": schedules,
+			"count":     len(schedules),
+		})
+
+	case http.MethodPost:
+		var s ExportSchedule
+		if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+			jsonError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+		if s.Project == "" {
+			s.Project = defaultProject
+		}
+		if s.Format == "" {
+			s.Format = "coco"
+		}
+		if s.Timezone == "" {
+			s.Timezone = "UTC"
+		}
+		if s.Name == "" {
+			s.Name = fmt.Sprintf("%s %s export", s.Project, s.Format)
+		}
+		if !exportFormats[s.Format] {
+			jsonError(w, http.StatusBadRequest, fmt.Sprintf("Unsupported export format %q", s.Format))
+			return
+		}
+		if strings.TrimSpace(s.Destination) == "" {
+			jsonError(w, http.StatusBadRequest, "Missing destination")
+			return
+		}
+		dest, err := exportDestination(s.Destination)
+		if err != nil {
+			jsonError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		s.Destination = dest
+		next, err := nextScheduleRun(s.Cron, s.Timezone, time.Now())
+		if err != nil {
+			jsonError(w, http.StatusBadRequest, "Invalid schedule: "+err.Error())
+			return
+		}
+
+		s.Enabled = true
+		err = db.QueryRowContext(r.Context(), `
+			INSERT INTO export_schedules (name, project, split, format, destination, cron, timezone, next_run_at)
+			VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6, $7, $8) RETURNING id
+		`, s.Name, s.Project, s.Split, s.Format, s.Destination, s.Cron, s.Timezone, next).Scan(&s.ID)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Inserting export schedule failed", "error", err)
+			jsonError(w, http.StatusInternalServerError, "Failed to create schedule")
+			return
+		}
+		s.NextRunAt = next.Format(time.RFC3339)
+		jsonResponse(w, http.StatusCreated, s)
+
+	default:
+		jsonError(w, http.StatusMethodNotAllowed, "GET or POST only")
+	}
+}
+
+// handleExportSchedule deletes a schedule
+func handleExportSchedule(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		jsonError(w, http.StatusMethodNotAllowed, "DELETE only")
+		return
+	}
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "Invalid schedule id")
+		return
+	}
+
+	res, err := db.ExecContext(r.Context(), "DELETE FROM export_schedules WHERE id = $1", id)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "Failed to delete schedule")
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		jsonError(w, http.StatusNotFound, "Schedule not found")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+// handleRunExportSchedule queues an immediate run without changing the regular schedule
+func handleRunExportSchedule(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		jsonError(w, http.StatusMethodNotAllowed, "POST only")
+		return
+	}
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "Invalid schedule id")
+		return
+	}
+
+	p := exportJobPayload{ScheduleID: id}
+	err = db.QueryRowContext(r.Context(), "SELECT project, COALESCE(split, ''), format, destination FROM export_schedules WHERE id = $1", id).
+		Scan(&p.Project, &p.Split, &p.Format, &p.Destination)
+	if err != nil {
+		jsonError(w, http.StatusNotFound, "Schedule not found")
+		return
+	}
+
+	jobID, err := enqueueJob(r.Context(), db, "export", p)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "Failed to queue export")
+		return
+	}
+	jsonResponse(w, http.StatusAccepted, map[string]interface{}{
+		"status": "queued",
+		"job_id": jobID,
+	})
+}
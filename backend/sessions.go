@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// ---------- Annotation Sessions ----------
+
+// The frontend starts a session when it opens a document and stops it when the document is
+// closed or saved, so the time spent annotating each document is measured on the server:
+//
+//	POST /documents/{id}/sessions?annotator=  {"event": "start"}
+//	POST /documents/{id}/sessions?annotator=  {"event": "stop", "session_id": "..."}
+//	GET  /documents/{id}/sessions
+//
+// Starting again while the annotator already has an open session on the document returns that
+// session, so a reload does not split the time. Stopping without session_id stops the
+// annotator's open session.
+
+type AnnotationSession struct {
+	ID         string   `json:"id"`
+	DocumentID string   `json:"document_id"`
+	Annotator  string   `json:"annotator,omitempty"`
+	StartedAt  string   `json:"started_at"`
+	EndedAt    string   `json:"ended_at,omitempty"`
+	Seconds    *float64 `json:"duration_seconds,omitempty"` // once stopped
+}
+
+const sessionColumns = "id, document_id, annotator, started_at, ended_at"
+
+func scanSession(scan func(...interface{}) error) (AnnotationSession, error) {
+	var s AnnotationSession
+	var annotator sql.NullString
+	var started time.Time
+	var ended sql.NullTime
+	if err := scan(&s.ID, &s.DocumentID, &annotator, &started, &ended); err != nil {
+		return s, err
+	}
+	s.Annotator = annotator.String
+	s.StartedAt = started.UTC().Format(time.RFC3339)
+	if ended.Valid {
+		s.EndedAt = ended.Time.UTC().Format(time.RFC3339)
+		secs := ended.Time.Sub(started).Seconds()
+		s.Seconds = &secs
+	}
+	return s, nil
+}
+
+// startSession opens a session for annotator on docID, or returns the one already open. A
+// session whose heartbeats have lapsed is left for the lease sweeper to end.
+func startSession(ctx context.Context, docID, annotator string) (AnnotationSession, bool, error) {
+	row := db.QueryRowContext(ctx, "SELECT "+sessionColumns+` FROM annotation_sessions
+		WHERE document_id = $1 AND annotator IS NOT DISTINCT FROM NULLIF($2, '') AND ended_at IS NULL
+			AND (heartbeat_at IS NULL OR heartbeat_at >= now() - $3 * interval '1 second')
+		ORDER BY started_at DESC LIMIT 1`, docID, annotator, heartbeatTimeout.Seconds())
+	s, err := scanSession(row.Scan)
+	if err == nil {
+		return s, false, nil
+	}
+	if err != sql.ErrNoRows {
+		return s, false, err
+	}
+	row = db.QueryRowContext(ctx, "INSERT INTO annotation_sessions (id, document_id, annotator) VALUES ($1, $2, NULLIF($3, '')) RETURNING "+sessionColumns,
+		newID(), docID, annotator)
+	s, err = scanSession(row.Scan)
+	return s, err == nil, err
+}
+
+// stopSession closes sessionID, or annotator's open session on docID when sessionID is ""
+func stopSession(ctx context.Context, docID, annotator, sessionID string) (AnnotationSession, error) {
+	row := db.QueryRowContext(ctx, `
+		UPDATE annotation_sessions SET ended_at = COALESCE(ended_at, now())
+		WHERE id = (
+			SELECT id FROM annotation_sessions WHERE document_id = $1
+			AND CASE WHEN $3 = '' THEN annotator IS NOT DISTINCT FROM NULLIF($2, '') AND ended_at IS NULL ELSE id = $3 END
+			ORDER BY started_at DESC LIMIT 1
+		)
+		RETURNING `+sessionColumns, docID, annotator, sessionID)
+	return scanSession(row.Scan)
+}
+
+// handleDocumentSessions lists (GET) or starts and stops (POST) annotation sessions:
+// /documents/{id}/sessions
+func handleDocumentSessions(w http.ResponseWriter, r *http.Request) {
+	docID := r.PathValue("id")
+	var exists bool
+	readPool(r.Context()).QueryRow(r.Context(), sqlDocumentExists, docID).Scan(&exists)
+	if !exists {
+		problemError(w, http.StatusNotFound, codeDocumentNotFound, "Document not found")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		rows, err := db.QueryContext(r.Context(), "SELECT "+sessionColumns+" FROM annotation_sessions WHERE document_id = $1 ORDER BY started_at", docID)
+		if err != nil {
+			jsonError(w, http.StatusInternalServerError, "Query failed")
+			return
+		}
+		defer rows.Close()
+		sessions := []AnnotationSession{}
+		total := 0.0
+		for rows.Next() {
+			s, err := scanSession(rows.Scan)
+			if err != nil {
+				continue
+			}
+			if s.Seconds != nil {
+				total += *s.Seconds
+			}
+			sessions = append(sessions, s)
+		}
+		jsonResponse(w, http.StatusOK, map[string]interface{}{
+			"document_id":   docID,
+			"sessions":      sessions,
+			"count":         len(sessions),
+			"total_seconds": total,
+		})
+
+	case http.MethodPost:
+		var req struct {
+			Event     string `json:"event"`
+			SessionID string `json:"session_id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+		annotator := requestUser(r)
+
+		switch req.Event {
+		case "start":
+			s, created, err := startSession(r.Context(), docID, annotator)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "Starting session failed", "document_id", docID, "error", err)
+				jsonError(w, http.StatusInternalServerError, "Failed to start session")
+				return
+			}
+			status := http.StatusOK
+			if created {
+				status = http.StatusCreated
+			}
+			jsonResponse(w, status, s)
+
+		case "stop":
+			s, err := stopSession(r.Context(), docID, annotator, req.SessionID)
+			if err == sql.ErrNoRows {
+				jsonError(w, http.StatusNotFound, "No such session")
+				return
+			}
+			if err != nil {
+				slog.ErrorContext(r.Context(), "Stopping session failed", "document_id", docID, "error", err)
+				jsonError(w, http.StatusInternalServerError, "Failed to stop session")
+				return
+			}
+			jsonResponse(w, http.StatusOK, s)
+
+		default:
+			jsonError(w, http.StatusBadRequest, "event must be start or stop")
+		}
+
+	default:
+		jsonError(w, http.StatusMethodNotAllowed, "GET or POST only")
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ---------- Graceful Shutdown ----------
+
+// On SIGTERM or SIGINT the server stops accepting connections and gives in-flight requests (a
+// /submit transaction, an upload streaming into storage) up to SHUTDOWN_TIMEOUT to finish.
+// Background workers finish what they are doing within the same deadline, and only then is the
+// database pool closed. Keep the timeout below the orchestrator's kill grace period.
+var shutdownTimeout = envDuration("SHUTDOWN_TIMEOUT", 25*time.Second)
+
+// workers tracks the background goroutines that use the database
+var workers sync.WaitGroup
+
+// startWorker runs fn in the background until ctx is cancelled
+func startWorker(ctx context.Context, fn func(context.Context)) {
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		fn(ctx)
+	}()
+}
+
+// serve runs the servers until ctx is cancelled, then drains requests and workers. It returns an
+// error only when a server could not run at all.
+func serve(ctx context.Context, servers ...*http.Server) error {
+	errc := make(chan error, len(servers))
+	for _, s := range servers {
+		go func() { errc <- listen(s) }()
+	}
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("Shutting down", "timeout", shutdownTimeout.String())
+	drainCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	var wg sync.WaitGroup
+	for _, s := range servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.Shutdown(drainCtx); err != nil {
+				slog.Warn("Requests still running at the shutdown deadline, closing their connections", "addr", s.Addr, "error", err)
+				s.Close()
+			}
+		}()
+	}
+	wg.Wait()
+	for range servers {
+		if err := <-errc; err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Server stopped", "error", err)
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		slog.Info("Shutdown complete")
+	case <-drainCtx.Done():
+		slog.Warn("Background workers still running at the shutdown deadline")
+	}
+	return nil
+}
+
+// listen serves HTTPS when configureTLS set up the server for it, plain HTTP otherwise
+func listen(s *http.Server) error {
+	if s.TLSConfig != nil {
+		return s.ListenAndServeTLS("", "")
+	}
+	return s.ListenAndServe()
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ---------- Signed Image URLs ----------
+
+var (
+	// Set IMAGE_URL_SECRET so signed URLs stay valid across restarts and replicas
+	imageURLSecret = []byte(envString("IMAGE_URL_SECRET", ""))
+	imageURLTTL    = envDuration("IMAGE_URL_TTL", time.Hour)
+	imageURLMaxTTL = envDuration("IMAGE_URL_MAX_TTL", 7*24*time.Hour)
+)
+
+func init() {
+	if len(imageURLSecret) == 0 {
+		imageURLSecret = make([]byte, 32)
+		if _, err := rand.Read(imageURLSecret); err != nil {
+			panic(err)
+		}
+		slog.Warn("IMAGE_URL_SECRET not set; signed image URLs will stop working when the server restarts")
+	}
+}
+
+// imageClaims is the signed content of an image URL token
+type imageClaims struct {
+	DocumentID string `json:"d"`
+	Page       int    `json:"p,omitempty"`
+	Kind       string `json:"k"` // image | thumbnail
+	Expires    int64  `json:"e"` // unix seconds
+}
+
+var errBadImageToken = errors.New("invalid or expired image URL")
+
+// signImageToken encodes claims as <payload>.<hmac>, both base64url
+func signImageToken(c imageClaims) string {
+	payload, _ := json.Marshal(c)
+	p := base64.RawURLEncoding.EncodeToString(payload)
+	return p + "." + base64.RawURLEncoding.EncodeToString(imageTokenMAC(p))
+}
+
+func imageTokenMAC(payload string) []byte {
+	mac := hmac.New(sha256.New, imageURLSecret)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+// verifyImageToken checks the signature and expiry of a token and returns its claims
+func verifyImageToken(token string, now time.Time) (imageClaims, error) {
+	p, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return imageClaims{}, errBadImageToken
+	}
+	got, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(got, imageTokenMAC(p)) {
+		return imageClaims{}, errBadImageToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(p)
+	if err != nil {
+		return imageClaims{}, errBadImageToken
+	}
+	var c imageClaims
+	if err := json.Unmarshal(payload, &c); err != nil || now.Unix() >= c.Expires {
+		return imageClaims{}, errBadImageToken
+	}
+	return c, nil
+}
+
+// handleImageURL issues a signed URL: GET /documents/{id}/image-url?page=N&kind=image|thumbnail&ttl=15m
+func handleImageURL(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		jsonError(w, http.StatusMethodNotAllowed, "GET only")
+		return
+	}
+	docID := r.PathValue("id")
+	q := r.URL.Query()
+
+	kind := q.Get("kind")
+	if kind == "" {
+		kind = "image"
+	}
+	if kind != "image" && kind != "thumbnail" {
+		jsonError(w, http.StatusBadRequest, "kind must be image or thumbnail")
+		return
+	}
+	page, err := pageParam(r)
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	ttl := imageURLTTL
+	if v := q.Get("ttl"); v != "" {
+		if ttl, err = time.ParseDuration(v); err != nil || ttl <= 0 {
+			jsonError(w, http.StatusBadRequest, "ttl must be a positive duration such as 15m or 24h")
+			return
+		}
+	}
+	if ttl > imageURLMaxTTL {
+		ttl = imageURLMaxTTL
+	}
+
+	if _, err := records.FindPage(r.Context(), docID, page); errors.Is(err, sql.ErrNoRows) {
+		jsonError(w, http.StatusNotFound, "Document or page not found")
+		return
+	} else if err != nil {
+		jsonError(w, http.StatusInternalServerError, "Query failed")
+		return
+	}
+
+	expires := time.Now().Add(ttl).Truncate(time.Second)
+	claims := imageClaims{DocumentID: docID, Kind: kind, Expires: expires.Unix()}
+	if kind == "image" {
+		claims.Page = page
+	}
+	jsonResponse(w, http.StatusOK, map[string]interface{}{
+		"url":        apiURL(r.Context(), "/images/"+signImageToken(claims)),
+		"expires_at": expires.UTC().Format(time.RFC3339),
+	})
+}
+
+// handleSignedImage serves the image a signed token grants access to: GET /images/{token}
+func handleSignedImage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		jsonError(w, http.StatusMethodNotAllowed, "GET only")
+		return
+	}
+	claims, err := verifyImageToken(r.PathValue("token"), time.Now())
+	if err != nil {
+		jsonError(w, http.StatusForbidden, err.Error())
+		return
+	}
+
+	if claims.Kind == "thumbnail" {
+		key, err := ensureThumbnail(r.Context(), claims.DocumentID)
+		if err != nil {
+			jsonError(w, http.StatusNotFound, "Thumbnail not available")
+			return
+		}
+		serveObject(w, r, key, "thumbnail.jpg")
+		return
+	}
+
+	sp, err := records.FindPage(r.Context(), claims.DocumentID, max(claims.Page, 1))
+	if err != nil {
+		jsonError(w, http.StatusNotFound, "Document or page not found")
+		return
+	}
+	serveStoredPage(w, r, sp)
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+)
+
+// ---------- Polyline Simplification ----------
+
+var (
+	// Douglas-Peucker tolerance in pixels applied to lines on /submit; 0 disables it.
+	// ?simplify=<pixels> overrides it per request.
+	submitSimplifyTolerance = envFloat("SUBMIT_SIMPLIFY_TOLERANCE", 0)
+	// Keep the unsimplified points in connections.points_original
+	simplifyKeepOriginal = envBool("SIMPLIFY_KEEP_ORIGINAL", true)
+)
+
+// douglasPeucker returns the indices of the points to keep so that no dropped point lies further
+// than tolerance from the simplified line
+func douglasPeucker(pts []point, tolerance float64) []int {
+	n := len(pts)
+	if n < 3 {
+		idx := make([]int, n)
+		for i := range idx {
+			idx[i] = i
+		}
+		return idx
+	}
+
+	keep := make([]bool, n)
+	keep[0], keep[n-1] = true, true
+	stack := [][2]int{{0, n - 1}}
+	for len(stack) > 0 {
+		seg := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		a, b := pts[seg[0]], pts[seg[1]]
+
+		far, farDist := -1, tolerance
+		for i := seg[0] + 1; i < seg[1]; i++ {
+			if d := segmentDistance(pts[i], a, b); d > farDist {
+				far, farDist = i, d
+			}
+		}
+		if far >= 0 {
+			keep[far] = true
+			stack = append(stack, [2]int{seg[0], far}, [2]int{far, seg[1]})
+		}
+	}
+
+	idx := []int{}
+	for i, k := range keep {
+		if k {
+			idx = append(idx, i)
+		}
+	}
+	return idx
+}
+
+// segmentDistance is the distance from p to the segment a-b
+func segmentDistance(p, a, b point) float64 {
+	dx, dy := b.X-a.X, b.Y-a.Y
+	if dx == 0 && dy == 0 {
+		return math.Hypot(p.X-a.X, p.Y-a.Y)
+	}
+	t := ((p.X-a.X)*dx + (p.Y-a.Y)*dy) / (dx*dx + dy*dy)
+	t = math.Max(0, math.Min(1, t))
+	return math.Hypot(p.X-(a.X+t*dx), p.Y-(a.Y+t*dy))
+}
+
+// simplifyPolyline simplifies a points value, returning it unchanged (and false) when nothing
+// could be dropped. Kept points are the client's original elements, in their format and
+// precision; malformed elements are dropped with the rest.
+func simplifyPolyline(raw interface{}, tolerance float64) (interface{}, bool) {
+	pts, _ := parsePoints(raw)
+	if len(pts) < 3 {
+		return raw, false
+	}
+	idx := douglasPeucker(pts, tolerance)
+	if len(idx) == len(pts) {
+		return raw, false
+	}
+	list := raw.([]interface{})
+	out := make([]interface{}, len(idx))
+	for i, j := range idx {
+		out[i] = list[pts[j].Index]
+	}
+	return out, true
+}
+
+// simplifyToleranceFromQuery resolves the /submit tolerance
+func simplifyToleranceFromQuery(v string) (float64, error) {
+	if v == "" {
+		return submitSimplifyTolerance, nil
+	}
+	t, err := strconv.ParseFloat(v, 64)
+	if err != nil || t < 0 || math.IsNaN(t) || math.IsInf(t, 0) {
+		return 0, fmt.Errorf("simplify must be a non-negative number of pixels")
+	}
+	return t, nil
+}
+
+// handleSimplifyLines simplifies stored lines in place:
+// POST /admin/simplify-lines {"tolerance": 1.5, "project": "", "document_id": "", "keep_original": true, "dry_run": false}
+// An original that is already preserved is never overwritten, so repeated runs can be undone.
+func handleSimplifyLines(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		jsonError(w, http.StatusMethodNotAllowed, "POST only")
+		return
+	}
+	var req struct {
+		Tolerance    float64 `json:"tolerance"`
+		Project      string  `json:"project"`
+		DocumentID   string  `json:"document_id"`
+		KeepOriginal *bool   `json:"keep_original"`
+		DryRun       bool    `json:"dry_run"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+	if req.Tolerance <= 0 || math.IsNaN(req.Tolerance) || math.IsInf(req.Tolerance, 0) {
+		jsonError(w, http.StatusBadRequest, "tolerance must be a positive number of pixels")
+		return
+	}
+	keepOriginal := simplifyKeepOriginal
+	if req.KeepOriginal != nil {
+		keepOriginal = *req.KeepOriginal
+	}
+
+	query := `SELECT c.document_id, c.id, c.points FROM connections c JOIN documents d ON d.document_id = c.document_id
+		WHERE c.type = 'line' AND c.points IS NOT NULL`
+	args := []interface{}{}
+	if req.Project != "" {
+		args = append(args, req.Project)
+		query += fmt.Sprintf(" AND d.project = $%d", len(args))
+	}
+	if req.DocumentID != "" {
+		args = append(args, req.DocumentID)
+		query += fmt.Sprintf(" AND c.document_id = $%d", len(args))
+	}
+	rows, err := db.QueryContext(r.Context(), query, args...)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "Query failed")
+		return
+	}
+
+	type update struct {
+		docID, id string
+		points    []byte
+	}
+	var updates []update
+	lines, before, after := 0, 0, 0
+	for rows.Next() {
+		var u update
+		var raw []byte
+		if err := rows.Scan(&u.docID, &u.id, &raw); err != nil {
+			rows.Close()
+			jsonError(w, http.StatusInternalServerError, "Query failed")
+			return
+		}
+		lines++
+		var points interface{}
+		if json.Unmarshal(raw, &points) != nil {
+			continue
+		}
+		pts, _ := parsePoints(points)
+		simplified, changed := simplifyPolyline(points, req.Tolerance)
+		before += len(pts)
+		if !changed {
+			after += len(pts)
+			continue
+		}
+		after += len(simplified.([]interface{}))
+		u.points, _ = json.Marshal(simplified)
+		updates = append(updates, u)
+	}
+	rows.Close()
+
+	if !req.DryRun && len(updates) > 0 {
+		tx, err := db.BeginTx(r.Context(), nil)
+		if err != nil {
+			jsonError(w, http.StatusInternalServerError, "Failed to begin transaction")
+			return
+		}
+		defer tx.Rollback()
+		for _, u := range updates {
+			q := "UPDATE connections SET points = $1 WHERE document_id = $2 AND id = $3"
+			if keepOriginal {
+				q = "UPDATE connections SET points_original = COALESCE(points_original, points), points = $1 WHERE document_id = $2 AND id = $3"
+			}
+			if _, err := tx.ExecContext(r.Context(), q, string(u.points), u.docID, u.id); err != nil {
+				jsonError(w, http.StatusInternalServerError, "Failed to update lines")
+				return
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			jsonError(w, http.StatusInternalServerError, "Failed to commit transaction")
+			return
+		}
+		slog.InfoContext(r.Context(), "Simplified lines", "simplified", len(updates), "lines", lines, "tolerance", req.Tolerance, "points_before", before, "points_after", after)
+	}
+
+	jsonResponse(w, http.StatusOK, map[string]interface{}{
+		"tolerance":     req.Tolerance,
+		"dry_run":       req.DryRun,
+		"lines":         lines,
+		"simplified":    len(updates),
+		"points_before": before,
+		"points_after":  after,
+	})
+}
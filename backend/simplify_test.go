@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestSimplifyPolyline(t *testing.T) {
+	tests := []struct {
+		name      string
+		points    string
+		tolerance float64
+		want      string // unchanged when empty
+	}{
+		{"collinear points collapse", `[[0,0],[1,0],[2,0],[3,0]]`, 0.5, `[[0,0],[3,0]]`},
+		{"peak beyond tolerance is kept", `[[0,0],[5,3],[10,0]]`, 1, ""},
+		{"peak within tolerance is dropped", `[[0,0],[5,0.4],[10,0]]`, 1, `[[0,0],[10,0]]`},
+		{"zero tolerance keeps bends", `[[0,0],[5,1],[10,0]]`, 0, ""},
+		{"zero tolerance drops exact midpoints", `[[0,0],[5,0],[10,0]]`, 0, `[[0,0],[10,0]]`},
+		{"two points", `[[0,0],[9,9]]`, 100, ""},
+		{"objects keep their keys", `[{"x":0,"y":0,"k":"a"},{"x":1,"y":0},{"x":2,"y":0,"k":"b"}]`, 0.5, `[{"x":0,"y":0,"k":"a"},{"x":2,"y":0,"k":"b"}]`},
+		{"mixed formats", `[[0,0],{"x":1,"y":0},[2,0]]`, 0.5, `[[0,0],[2,0]]`},
+		{"malformed elements are dropped", `[[0,0],[1,"a"],[1,0],{"x":2},[2,0]]`, 0.5, `[[0,0],[2,0]]`},
+		{"closed loop keeps its corners", `[[0,0],[5,0.1],[10,0],[10,10],[0,0]]`, 1, `[[0,0],[10,0],[10,10],[0,0]]`},
+		{"not a list", `{"x":1,"y":2}`, 1, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var raw interface{}
+			if err := json.Unmarshal([]byte(tt.points), &raw); err != nil {
+				t.Fatal(err)
+			}
+			got, changed := simplifyPolyline(raw, tt.tolerance)
+			if changed != (tt.want != "") {
+				t.Fatalf("changed = %v", changed)
+			}
+			want := tt.want
+			if want == "" {
+				want = tt.points
+			}
+			if b, _ := json.Marshal(got); !jsonEqual(t, b, want) {
+				t.Errorf("got %s, want %s", b, want)
+			}
+		})
+	}
+}
+
+func TestDouglasPeuckerKeepsEnds(t *testing.T) {
+	for n := 0; n <= 4; n++ {
+		pts := make([]point, n)
+		idx := douglasPeucker(pts, 1)
+		if n < 2 && len(idx) != n {
+			t.Errorf("%d points: kept %v", n, idx)
+		}
+		if n >= 2 && (idx[0] != 0 || idx[len(idx)-1] != n-1) {
+			t.Errorf("%d points: kept %v, want both ends", n, idx)
+		}
+	}
+}
+
+// jsonEqual compares b with want as decoded JSON, ignoring key order
+func jsonEqual(t *testing.T, b []byte, want string) bool {
+	t.Helper()
+	var x, y interface{}
+	if err := json.Unmarshal(b, &x); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(want), &y); err != nil {
+		t.Fatal(err)
+	}
+	bx, _ := json.Marshal(x)
+	by, _ := json.Marshal(y)
+	return string(bx) == string(by)
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+// ---------- Dataset Snapshots ----------
+
+// A snapshot freezes a project's export under a version tag. The COCO dataset is built once and
+// stored as an immutable object, so exporting the snapshot later returns the same annotations no
+// matter what has been edited since.
+
+var snapshotTagPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+var errSnapshotNotFound = errors.New("snapshot not found")
+
+type DatasetSnapshot struct {
+	Project     string `json:"project"`
+	Tag         string `json:"tag"`
+	Description string `json:"description,omitempty"`
+	Documents   int    `json:"documents"`
+	Images      int    `json:"images"`
+	Annotations int    `json:"annotations"`
+	SHA256      string `json:"sha256"`
+	CreatedAt   string `json:"created_at"`
+}
+
+// loadSnapshotCOCO reads a frozen dataset, keeping only scope.Split when set
+func loadSnapshotCOCO(ctx context.Context, scope exportScope) (*COCODataset, error) {
+	var key string
+	err := readDB(ctx).QueryRowContext(ctx, "SELECT storage_key FROM dataset_snapshots WHERE project = $1 AND tag = $2", scope.Project, scope.Snapshot).Scan(&key)
+	if err == sql.ErrNoRows {
+		return nil, errSnapshotNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	data, err := readObject(key)
+	if err != nil {
+		return nil, fmt.Errorf("reading snapshot %s: %w", scope.Snapshot, err)
+	}
+	var ds COCODataset
+	if err := json.Unmarshal(data, &ds); err != nil {
+		return nil, fmt.Errorf("decoding snapshot %s: %w", scope.Snapshot, err)
+	}
+	if scope.Split == "" {
+		return &ds, nil
+	}
+
+	keep := map[int]bool{}
+	images := []COCOImage{}
+	for _, img := range ds.Images {
+		if img.Split == scope.Split {
+			keep[img.ID] = true
+			images = append(images, img)
+		}
+	}
+	anns := []COCOAnnotation{}
+	for _, a := range ds.Annotations {
+		if keep[a.ImageID] {
+			anns = append(anns, a)
+		}
+	}
+	ds.Images, ds.Annotations = images, anns
+	return &ds, nil
+}
+
+// handleDatasetSnapshots lists (GET) or creates (POST {"tag", "description"}) snapshots of a project:
+// /datasets/{project}/snapshots
+func handleDatasetSnapshots(w http.ResponseWriter, r *http.Request) {
+	project := r.PathValue("project")
+
+	switch r.Method {
+	case http.MethodGet:
+		rows, err := db.QueryContext(r.Context(), `
+			SELECT project, tag, COALESCE(description, ''), documents, images, annotations, sha256, created_at
+			FROM dataset_snapshots WHERE project = $1 ORDER BY created_at DESC
+		`, project)
+		if err != nil {
+			jsonError(w, http.StatusInternalServerError, "Query failed")
+			return
+		}
+		defer rows.Close()
+
+		snapshots := []DatasetSnapshot{}
+		for rows.Next() {
+			var s DatasetSnapshot
+			var createdAt time.Time
+			if err := rows.Scan(&s.Project, &s.Tag, &s.Description, &s.Documents, &s.Images, &s.Annotations, &s.SHA256, &createdAt); err != nil {
+				continue
+			}
+			s.CreatedAt = createdAt.Format(time.RFC3339)
+			snapshots = append(snapshots, s)
+		}
+		jsonResponse(w, http.StatusOK, map[string]interface{}{
+			"project":   project,
+			"snapshots": snapshots,
+		})
+
+	case http.MethodPost:
+		var s DatasetSnapshot
+		if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+			jsonError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+		if !snapshotTagPattern.MatchString(s.Tag) {
+			jsonError(w, http.StatusBadRequest, "tag must be 1-64 letters, digits, '.', '_' or '-'")
+			return
+		}
+		s.Project = project
+
+		var exists bool
+		db.QueryRowContext(r.Context(), "SELECT EXISTS (SELECT 1 FROM dataset_snapshots WHERE project = $1 AND tag = $2)", project, s.Tag).Scan(&exists)
+		if exists {
+			jsonError(w, http.StatusConflict, fmt.Sprintf("Snapshot %q already exists", s.Tag))
+			return
+		}
+
+		ds, err := buildCOCO(r.Context(), exportScope{Project: project})
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Snapshot build failed", "project", project, "error", err)
+			jsonError(w, http.StatusInternalServerError, "Failed to build snapshot")
+			return
+		}
+		ds.Info.Version = s.Tag
+		data, err := json.Marshal(ds)
+		if err != nil {
+			jsonError(w, http.StatusInternalServerError, "Failed to encode snapshot")
+			return
+		}
+		obj, err := storeObject(bytes.NewReader(data), ".json")
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Snapshot store failed", "project", project, "error", err)
+			jsonError(w, http.StatusInternalServerError, "Failed to store snapshot")
+			return
+		}
+
+		docs := map[string]bool{}
+		for _, img := range ds.Images {
+			docs[img.DocumentID] = true
+		}
+		s.Documents, s.Images, s.Annotations, s.SHA256 = len(docs), len(ds.Images), len(ds.Annotations), obj.SHA256
+
+		var createdAt time.Time
+		err = db.QueryRowContext(r.Context(), `
+			INSERT INTO dataset_snapshots (project, tag, description, documents, images, annotations, sha256, storage_key)
+			VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6, $7, $8)
+			RETURNING created_at
+		`, project, s.Tag, s.Description, s.Documents, s.Images, s.Annotations, obj.SHA256, obj.Key).Scan(&createdAt)
+		if err != nil {
+			// A concurrent request may have taken the tag between the check and the insert
+			slog.ErrorContext(r.Context(), "Inserting snapshot failed", "project", project, "error", err)
+			jsonError(w, http.StatusConflict, "Failed to create snapshot: "+err.Error())
+			return
+		}
+		s.CreatedAt = createdAt.Format(time.RFC3339)
+
+		slog.InfoContext(r.Context(), "Snapshot created", "project", project, "tag", s.Tag, "documents", s.Documents, "annotations", s.Annotations)
+		jsonResponse(w, http.StatusCreated, s)
+
+	default:
+		jsonError(w, http.StatusMethodNotAllowed, "GET or POST only")
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// ---------- Dataset Splits ----------
+
+// exportBaseName names export files after the project and, when set, the snapshot and split
+func exportBaseName(scope exportScope) string {
+	name := scope.Project
+	if scope.Snapshot != "" {
+		name += "_" + scope.Snapshot
+	}
+	if scope.Split != "" {
+		name += "_" + scope.Split
+	}
+	if scope.Regions {
+		name += "_regions"
+	}
+	return name
+}
+
+// SplitRequest configures POST /splits/assign. Ratios are normalized, so {"train": 8, "val": 1,
+// "test": 1} works as well as fractions. Documents that already have a split keep it unless
+// Reassign is set, so existing exports stay stable as new documents arrive.
+type SplitRequest struct {
+	Project  string             `json:"project"`
+	Ratios   map[string]float64 `json:"ratios"`
+	Seed     string             `json:"seed"`
+	Reassign bool               `json:"reassign"`
+}
+
+var defaultSplitRatios = map[string]float64{"train": 0.8, "val": 0.1, "test": 0.1}
+
+type splitDoc struct {
+	id   string
+	rank uint64
+}
+
+// splitRank orders documents pseudo-randomly but reproducibly for a given seed
+func splitRank(seed, docID string) uint64 {
+	sum := sha256.Sum256([]byte(seed + "\x00" + docID))
+	return binary.BigEndian.Uint64(sum[:8])
+}
+
+// assignStratum spreads one stratum's documents over the splits in proportion to the ratios.
+// Document i of n takes the split whose cumulative share covers (i+0.5)/n, so every split gets
+// its fair share to within one document.
+func assignStratum(docs []splitDoc, names []string, ratios map[string]float64) map[string]string {
+	sort.Slice(docs, func(i, j int) bool {
+		if docs[i].rank != docs[j].rank {
+			return docs[i].rank < docs[j].rank
+		}
+		return docs[i].id < docs[j].id
+	})
+	out := map[string]string{}
+	for i, d := range docs {
+		pos := (float64(i) + 0.5) / float64(len(docs))
+		cum := 0.0
+		split := names[len(names)-1]
+		for _, name := range names {
+			cum += ratios[name]
+			if pos < cum {
+				split = name
+				break
+			}
+		}
+		out[d.id] = split
+	}
+	return out
+}
+
+// handleAssignSplits assigns train/val/test splits deterministically, stratified by the document's
+// classification (drawing type and domain) and its most frequent component label
+func handleAssignSplits(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		jsonError(w, http.StatusMethodNotAllowed, "POST only")
+		return
+	}
+
+	var req SplitRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+	if req.Project == "" {
+		req.Project = defaultProject
+	}
+	if len(req.Ratios) == 0 {
+		req.Ratios = defaultSplitRatios
+	}
+	total := 0.0
+	names := make([]string, 0, len(req.Ratios))
+	for name, ratio := range req.Ratios {
+		if strings.TrimSpace(name) == "" || ratio < 0 || math.IsNaN(ratio) || math.IsInf(ratio, 0) {
+			jsonError(w, http.StatusBadRequest, "Split names must be non-empty and ratios non-negative")
+			return
+		}
+		total += ratio
+		names = append(names, name)
+	}
+	if total == 0 {
+		jsonError(w, http.StatusBadRequest, "Split ratios sum to zero")
+		return
+	}
+	sort.Strings(names)
+	ratios := map[string]float64{}
+	for _, name := range names {
+		ratios[name] = req.Ratios[name] / total
+	}
+
+	// The dominant label breaks ties alphabetically so the stratum is stable
+	rows, err := db.QueryContext(r.Context(), `
+		SELECT d.document_id, COALESCE(d.drawing_type, ''), COALESCE(d.source, ''),
+		       COALESCE((SELECT c.label FROM components c WHERE c.document_id = d.document_id
+		                 GROUP BY c.label ORDER BY count(*) DESC, c.label LIMIT 1), '')
+		FROM documents d
+		WHERE d.project = $1 AND ($2 OR d.split IS NULL)
+	`, req.Project, req.Reassign)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Split query failed", "error", err)
+		jsonError(w, http.StatusInternalServerError, "Query failed")
+		return
+	}
+	strata := map[string][]splitDoc{}
+	for rows.Next() {
+		var id, drawingType, domain, label string
+		if err := rows.Scan(&id, &drawingType, &domain, &label); err != nil {
+			rows.Close()
+			jsonError(w, http.StatusInternalServerError, "Query failed")
+			return
+		}
+		key := drawingType + "|" + domain + "|" + label
+		strata[key] = append(strata[key], splitDoc{id: id, rank: splitRank(req.Seed, id)})
+	}
+	rows.Close()
+
+	tx, err := db.BeginTx(r.Context(), nil)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "Failed to begin transaction")
+		return
+	}
+	defer tx.Rollback()
+
+	counts := map[string]int{}
+	for _, name := range names {
+		counts[name] = 0
+	}
+	for _, docs := range strata {
+		for id, split := range assignStratum(docs, names, ratios) {
+			if _, err := tx.ExecContext(r.Context(), "UPDATE documents SET split = $1 WHERE document_id = $2", split, id); err != nil {
+				jsonError(w, http.StatusInternalServerError, "Failed to save splits")
+				return
+			}
+			counts[split]++
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		jsonError(w, http.StatusInternalServerError, "Failed to commit transaction")
+		return
+	}
+
+	totals, err := splitCounts(r.Context(), req.Project)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Split count failed", "error", err)
+	}
+
+	slog.InfoContext(r.Context(), "Assigned splits", "project", req.Project, "counts", counts, "strata", len(strata))
+	jsonResponse(w, http.StatusOK, map[string]interface{}{
+		"status":   "success",
+		"project":  req.Project,
+		"assigned": counts,
+		"totals":   totals,
+		"strata":   len(strata),
+		"ratios":   ratios,
+	})
+}
+
+// splitCounts reports a project's split sizes, counting documents without one as "unassigned"
+func splitCounts(ctx context.Context, project string) (map[string]int, error) {
+	rows, err := db.QueryContext(ctx, "SELECT COALESCE(split, ''), count(*) FROM documents WHERE project = $1 GROUP BY 1", project)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	counts := map[string]int{}
+	for rows.Next() {
+		var split string
+		var n int
+		if err := rows.Scan(&split, &n); err != nil {
+			return nil, fmt.Errorf("scanning split counts: %w", err)
+		}
+		if split == "" {
+			split = "unassigned"
+		}
+		counts[split] = n
+	}
+	return counts, rows.Err()
+}
@@ -0,0 +1,652 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math/bits"
+	"net/url"
+	"sort"
+	"strings"
+
+	_ "modernc.org/sqlite"
+)
+
+// ---------- SQLite Records ----------
+
+// SQLITE_PATH is the database file used with DB_DRIVER=sqlite; it is created on first start
+var sqlitePath = envString("SQLITE_PATH", "corvina.db")
+
+// sqliteSchema mirrors the PostgreSQL columns the record store touches. Arrays and JSONB
+// values are stored as JSON text.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS documents (
+    document_id     TEXT PRIMARY KEY,
+    image_file      TEXT NOT NULL,
+    drawing_type    TEXT DEFAULT 'handwritten',
+    source          TEXT DEFAULT 'notebook',
+    project         TEXT NOT NULL DEFAULT 'default',
+    pdf_file        TEXT,
+    original_format TEXT,
+    num_pages       INTEGER,
+    width           INTEGER,
+    height          INTEGER,
+    phash           INTEGER,
+    sha256          TEXT,
+    size_bytes      INTEGER,
+    storage_key     TEXT,
+    thumbnail_key   TEXT,
+    tags            TEXT NOT NULL DEFAULT '[]',
+    notes           TEXT,
+    split           TEXT,
+    created_at      TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%SZ', 'now'))
+);
+CREATE TABLE IF NOT EXISTS pages (
+    document_id TEXT NOT NULL REFERENCES documents(document_id) ON DELETE CASCADE,
+    page_number INTEGER NOT NULL,
+    image_file  TEXT NOT NULL,
+    width       INTEGER,
+    height      INTEGER,
+    storage_key TEXT,
+    sha256      TEXT,
+    PRIMARY KEY (document_id, page_number)
+);
+CREATE TABLE IF NOT EXISTS regions (
+    id          TEXT NOT NULL,
+    document_id TEXT NOT NULL REFERENCES documents(document_id) ON DELETE CASCADE,
+    label       TEXT,
+    bbox        TEXT,
+    page_number INTEGER NOT NULL DEFAULT 1,
+    PRIMARY KEY (document_id, id)
+);
+CREATE TABLE IF NOT EXISTS components (
+    id            TEXT NOT NULL,
+    document_id   TEXT NOT NULL REFERENCES documents(document_id) ON DELETE CASCADE,
+    label         TEXT,
+    bbox          TEXT,
+    page_number   INTEGER NOT NULL DEFAULT 1,
+    provenance    TEXT NOT NULL DEFAULT 'human',
+    suggestion_id TEXT,
+    model_name    TEXT,
+    model_version TEXT,
+    region_id     TEXT,
+    PRIMARY KEY (document_id, id)
+);
+CREATE TABLE IF NOT EXISTS nodes (
+    id            TEXT NOT NULL,
+    document_id   TEXT NOT NULL REFERENCES documents(document_id) ON DELETE CASCADE,
+    position      TEXT,
+    page_number   INTEGER NOT NULL DEFAULT 1,
+    provenance    TEXT NOT NULL DEFAULT 'human',
+    suggestion_id TEXT,
+    model_name    TEXT,
+    model_version TEXT,
+    region_id     TEXT,
+    PRIMARY KEY (document_id, id)
+);
+CREATE TABLE IF NOT EXISTS connections (
+    id              TEXT NOT NULL,
+    document_id     TEXT NOT NULL REFERENCES documents(document_id) ON DELETE CASCADE,
+    source_id       TEXT,
+    target_id       TEXT,
+    type            TEXT,
+    points          TEXT,
+    points_original TEXT,
+    page_number     INTEGER NOT NULL DEFAULT 1,
+    provenance      TEXT NOT NULL DEFAULT 'human',
+    suggestion_id   TEXT,
+    model_name      TEXT,
+    model_version   TEXT,
+    region_id       TEXT,
+    PRIMARY KEY (document_id, id)
+);
+CREATE TABLE IF NOT EXISTS text_annotations (
+    id            TEXT NOT NULL,
+    document_id   TEXT NOT NULL REFERENCES documents(document_id) ON DELETE CASCADE,
+    bbox          TEXT,
+    raw_text      TEXT,
+    is_ignored    INTEGER NOT NULL DEFAULT 0,
+    linked_to     TEXT,
+    label_name    TEXT,
+    "values"      TEXT,
+    page_number   INTEGER NOT NULL DEFAULT 1,
+    provenance    TEXT NOT NULL DEFAULT 'human',
+    suggestion_id TEXT,
+    model_name    TEXT,
+    model_version TEXT,
+    region_id     TEXT,
+    PRIMARY KEY (document_id, id)
+);
+CREATE TABLE IF NOT EXISTS document_versions (
+    document_id     TEXT NOT NULL REFERENCES documents(document_id) ON DELETE CASCADE,
+    version         INTEGER NOT NULL,
+    image_file      TEXT NOT NULL,
+    pdf_file        TEXT,
+    original_format TEXT,
+    num_pages       INTEGER,
+    width           INTEGER,
+    height          INTEGER,
+    sha256          TEXT,
+    size_bytes      INTEGER,
+    storage_key     TEXT,
+    pages           TEXT NOT NULL DEFAULT '[]',
+    replaced_by     TEXT,
+    replaced_at     TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%SZ', 'now')),
+    PRIMARY KEY (document_id, version)
+);
+`
+
+// sqliteUpgrades bring the tables of an existing file up to date, since CREATE TABLE IF NOT
+// EXISTS leaves a table that is already there as it is. The file's user_version counts the
+// upgrades applied; entry i takes it from version i to i+1. New files get sqliteSchema and then
+// every upgrade, so the upgrades are the only place columns are added.
+var sqliteUpgrades = []string{
+	// 1: the document columns of PostgreSQL migrations 0014-0017 and 0022
+	`ALTER TABLE documents ADD COLUMN status TEXT NOT NULL DEFAULT 'active'
+    CHECK (status IN ('active', 'on_hold', 'archived'));
+ALTER TABLE documents ADD COLUMN original_filename TEXT;
+ALTER TABLE documents ADD COLUMN display_name TEXT;
+ALTER TABLE documents ADD COLUMN uploaded_by TEXT;
+ALTER TABLE documents ADD COLUMN supersedes TEXT;
+ALTER TABLE documents ADD COLUMN quota_user TEXT;
+UPDATE documents SET original_filename = COALESCE(pdf_file, image_file);
+ALTER TABLE document_versions ADD COLUMN original_filename TEXT;
+CREATE TABLE IF NOT EXISTS document_aliases (
+    alias       TEXT PRIMARY KEY,
+    document_id TEXT NOT NULL REFERENCES documents(document_id) ON DELETE CASCADE,
+    created_by  TEXT,
+    created_at  TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%SZ', 'now'))
+);
+CREATE INDEX IF NOT EXISTS idx_document_aliases_document ON document_aliases(document_id);`,
+}
+
+// sqliteRecords keeps records in a local SQLite file
+type sqliteRecords struct {
+	db *sql.DB
+}
+
+// openSQLite opens (creating if needed) the SQLite file and its tables. A single connection
+// serializes writes, which is plenty for one developer and avoids SQLITE_BUSY.
+func openSQLite(path string) (*sqliteRecords, error) {
+	dsn := "file:" + path + "?_pragma=foreign_keys(1)&_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)"
+	sdb, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	sdb.SetMaxOpenConns(1)
+	if _, err := sdb.Exec(sqliteSchema); err != nil {
+		sdb.Close()
+		return nil, fmt.Errorf("creating tables: %w", err)
+	}
+	if err := upgradeSQLite(sdb); err != nil {
+		sdb.Close()
+		return nil, err
+	}
+	return &sqliteRecords{db: sdb}, nil
+}
+
+// upgradeSQLite applies the sqliteUpgrades the file hasn't had yet, each in its own transaction
+func upgradeSQLite(sdb *sql.DB) error {
+	var version int
+	if err := sdb.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return fmt.Errorf("reading schema version: %w", err)
+	}
+	for ; version < len(sqliteUpgrades); version++ {
+		tx, err := sdb.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(sqliteUpgrades[version]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("upgrading schema to version %d: %w", version+1, err)
+		}
+		// PRAGMA takes no placeholders
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", version+1)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("upgrading schema to version %d: %w", version+1, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("upgrading schema to version %d: %w", version+1, err)
+		}
+	}
+	return nil
+}
+
+func (s *sqliteRecords) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+func (s *sqliteRecords) SaveDocument(ctx context.Context, doc *StoredDocument) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var currentSHA string
+	err = tx.QueryRowContext(ctx, "SELECT COALESCE(sha256, '') FROM documents WHERE document_id = ?", doc.DocumentID).Scan(&currentSHA)
+	exists := err == nil
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("looking up document: %w", err)
+	}
+	if exists && !doc.Overwrite {
+		return &DocumentExistsError{DocumentID: doc.DocumentID}
+	}
+
+	if !doc.AllowDuplicate {
+		var existing string
+		err := tx.QueryRowContext(ctx, "SELECT document_id FROM documents WHERE project = ? AND sha256 = ? AND document_id <> ? LIMIT 1",
+			doc.Project, doc.Original.SHA256, doc.DocumentID).Scan(&existing)
+		if err == nil {
+			return &DuplicateUploadError{DocumentID: existing}
+		}
+		if err != sql.ErrNoRows {
+			return fmt.Errorf("checking for duplicates: %w", err)
+		}
+	}
+
+	if exists && currentSHA != doc.Original.SHA256 {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO document_versions (document_id, version, image_file, pdf_file, original_format, original_filename,
+				num_pages, width, height, sha256, size_bytes, storage_key, pages, replaced_by)
+			SELECT d.document_id, COALESCE((SELECT max(version) FROM document_versions v WHERE v.document_id = d.document_id), 0) + 1,
+				d.image_file, d.pdf_file, d.original_format, d.original_filename, d.num_pages, d.width, d.height, d.sha256, d.size_bytes, d.storage_key,
+				COALESCE((SELECT json_group_array(json_object('page_number', p.page_number, 'image_file', p.image_file,
+					'width', p.width, 'height', p.height, 'storage_key', p.storage_key, 'sha256', p.sha256))
+					FROM (SELECT * FROM pages WHERE document_id = d.document_id ORDER BY page_number) p), '[]'),
+				NULLIF(?2, '')
+			FROM documents d WHERE d.document_id = ?1
+		`, doc.DocumentID, doc.Uploader)
+		if err != nil {
+			return fmt.Errorf("recording version: %w", err)
+		}
+	}
+
+	var originalFile string
+	if doc.Format != "png" {
+		originalFile = doc.Filename
+	}
+	first := doc.Pages[0]
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO documents (document_id, image_file, project, pdf_file, original_format, num_pages,
+			width, height, phash, sha256, size_bytes, storage_key, thumbnail_key, uploaded_by, original_filename, supersedes, quota_user)
+		VALUES (?1, ?2, ?3, NULLIF(?4, ''), ?5, ?6, NULLIF(?7, 0), NULLIF(?8, 0), ?9, ?10, ?11, ?12, NULLIF(?13, ''),
+			NULLIF(?14, ''), NULLIF(?15, ''), NULLIF(?16, ''), NULLIF(?17, ''))
+		ON CONFLICT (document_id) DO UPDATE SET image_file = ?2, pdf_file = NULLIF(?4, ''), original_format = ?5,
+			num_pages = ?6, width = NULLIF(?7, 0), height = NULLIF(?8, 0), phash = ?9, sha256 = ?10,
+			size_bytes = ?11, storage_key = ?12, thumbnail_key = NULLIF(?13, ''), original_filename = NULLIF(?15, '')
+	`, doc.DocumentID, first.ImageFile, doc.Project, originalFile, doc.Format, len(doc.Pages), first.Width, first.Height,
+		int64(doc.PHash), doc.Original.SHA256, doc.Original.Size, doc.Original.Key, doc.Thumbnail.Key, doc.Uploader,
+		doc.OriginalName, doc.Supersedes, doc.QuotaUser)
+	if err != nil {
+		return fmt.Errorf("inserting document: %w", err)
+	}
+	// There is no outbox here, so superseding only archives the old document
+	if !exists && doc.Supersedes != "" {
+		if _, err := tx.ExecContext(ctx, "UPDATE documents SET status = 'archived' WHERE document_id = ?", doc.Supersedes); err != nil {
+			return fmt.Errorf("archiving superseded document: %w", err)
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM pages WHERE document_id = ?", doc.DocumentID); err != nil {
+		return fmt.Errorf("clearing pages: %w", err)
+	}
+	for _, p := range doc.Pages {
+		_, err := tx.ExecContext(ctx,
+			"INSERT INTO pages (document_id, page_number, image_file, width, height, storage_key, sha256) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			doc.DocumentID, p.PageNumber, p.ImageFile, p.Width, p.Height, p.Key, p.SHA256,
+		)
+		if err != nil {
+			return fmt.Errorf("inserting page %d: %w", p.PageNumber, err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteRecords) ListDocuments(ctx context.Context, f documentFilter) ([]DocumentSummary, error) {
+	if f.PredictedBy != "" {
+		return nil, errRequiresPostgres
+	}
+	query := "SELECT document_id, image_file, drawing_type, source, project, tags, created_at, COALESCE(split, ''), status, " +
+		"COALESCE(display_name, '') FROM documents WHERE true"
+	args := []interface{}{}
+	if f.DocumentID != "" {
+		query += " AND document_id = ?"
+		args = append(args, f.DocumentID)
+	}
+	if f.Project != "" {
+		query += " AND project = ?"
+		args = append(args, f.Project)
+	}
+	if f.Split != "" {
+		query += " AND split = ?"
+		args = append(args, f.Split)
+	}
+	if f.Status != "" {
+		query += " AND status = ?"
+		args = append(args, f.Status)
+	}
+	query += " ORDER BY created_at DESC, rowid DESC"
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	docs := []DocumentSummary{}
+	for rows.Next() {
+		var d DocumentSummary
+		var tags string
+		if err := rows.Scan(&d.DocumentID, &d.ImageFile, &d.DrawingType, &d.Source, &d.Project, &tags, &d.CreatedAt, &d.Split, &d.Status, &d.DisplayName); err != nil {
+			return nil, err
+		}
+		d.Tags = []string{}
+		json.Unmarshal([]byte(tags), &d.Tags)
+		d.Thumbnail = apiURL(ctx, "/documents/"+url.PathEscape(d.DocumentID)+"/thumbnail")
+		docs = append(docs, d)
+	}
+	return docs, rows.Err()
+}
+
+func (s *sqliteRecords) LoadDocument(ctx context.Context, docID string, view documentView) (*OutputJSON, error) {
+	doc := &OutputJSON{DocumentID: docID}
+	var drawingType, source, tags, aliases string
+	var notes, sha sql.NullString
+	var sizeBytes sql.NullInt64
+	err := s.db.QueryRowContext(ctx, `
+		SELECT image_file, drawing_type, source, tags, notes, COALESCE(num_pages, 1), COALESCE(width, 0),
+			COALESCE(height, 0), sha256, size_bytes, COALESCE(original_filename, ''), COALESCE(display_name, ''),
+			(SELECT json_group_array(alias) FROM (SELECT alias FROM document_aliases a
+				WHERE a.document_id = documents.document_id ORDER BY a.created_at, a.alias))
+		FROM documents WHERE document_id = ?
+	`, docID).Scan(&doc.ImageFile, &drawingType, &source, &tags, &notes, &doc.NumPages, &doc.Width, &doc.Height, &sha, &sizeBytes,
+		&doc.OriginalFilename, &doc.DisplayName, &aliases)
+	if err != nil {
+		return nil, err
+	}
+	doc.Classification = map[string]string{"type": drawingType, "domain": source}
+	json.Unmarshal([]byte(tags), &doc.Tags)
+	json.Unmarshal([]byte(aliases), &doc.Aliases)
+	doc.Notes, doc.SHA256, doc.SizeBytes = notes.String, sha.String, sizeBytes.Int64
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT page_number, image_file, COALESCE(width, 0), COALESCE(height, 0), COALESCE(sha256, '')
+		FROM pages WHERE document_id = ? ORDER BY page_number
+	`, docID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var p PageInfo
+		if err := rows.Scan(&p.PageNumber, &p.ImageFile, &p.Width, &p.Height, &p.SHA256); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		doc.Pages = append(doc.Pages, p)
+	}
+	rows.Close()
+	if len(doc.Pages) == 0 {
+		doc.Pages = []PageInfo{{PageNumber: 1, ImageFile: doc.ImageFile, Width: doc.Width, Height: doc.Height}}
+	}
+
+	if view.wants("regions") {
+		if doc.Regions, err = s.loadRegions(ctx, docID); err != nil {
+			return nil, err
+		}
+	}
+	if view.wants("graph") {
+		if doc.Graph, err = s.loadGraph(ctx, docID); err != nil {
+			return nil, err
+		}
+	}
+	if view.wants("text_annotations") {
+		if doc.TextAnnotations, err = s.loadText(ctx, docID); err != nil {
+			return nil, err
+		}
+	}
+	return doc, nil
+}
+
+// sqliteOrigin selects region_id followed by originColumns
+const sqliteOrigin = "COALESCE(region_id, ''), " + originColumns
+
+// queryEach runs query for docID and calls scan for each row
+func (s *sqliteRecords) queryEach(ctx context.Context, query, docID string, scan func(*sql.Rows) error) error {
+	rows, err := s.db.QueryContext(ctx, query, docID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (s *sqliteRecords) loadRegions(ctx context.Context, docID string) ([]Region, error) {
+	regions := []Region{}
+	err := s.queryEach(ctx, "SELECT id, COALESCE(label, ''), COALESCE(bbox, '[]'), page_number FROM regions WHERE document_id = ? ORDER BY page_number, id", docID,
+		func(rows *sql.Rows) error {
+			var rg Region
+			var bbox string
+			if err := rows.Scan(&rg.ID, &rg.Label, &bbox, &rg.Page); err != nil {
+				return err
+			}
+			json.Unmarshal([]byte(bbox), &rg.BBox)
+			regions = append(regions, rg)
+			return nil
+		})
+	return regions, err
+}
+
+func (s *sqliteRecords) loadGraph(ctx context.Context, docID string) (Graph, error) {
+	g := Graph{Components: []Component{}, Nodes: []Node{}, Connections: []Connection{}}
+	err := s.queryEach(ctx, "SELECT id, COALESCE(label, ''), COALESCE(bbox, '[]'), page_number, "+sqliteOrigin+" FROM components WHERE document_id = ?", docID,
+		func(rows *sql.Rows) error {
+			var c Component
+			var bbox string
+			if err := rows.Scan(append([]interface{}{&c.ID, &c.Label, &bbox, &c.Page, &c.RegionID}, c.Origin.dest()...)...); err != nil {
+				return err
+			}
+			json.Unmarshal([]byte(bbox), &c.BBox)
+			g.Components = append(g.Components, c)
+			return nil
+		})
+	if err != nil {
+		return g, err
+	}
+	err = s.queryEach(ctx, "SELECT id, COALESCE(position, '[]'), page_number, "+sqliteOrigin+" FROM nodes WHERE document_id = ?", docID,
+		func(rows *sql.Rows) error {
+			var n Node
+			var pos string
+			if err := rows.Scan(append([]interface{}{&n.ID, &pos, &n.Page, &n.RegionID}, n.Origin.dest()...)...); err != nil {
+				return err
+			}
+			json.Unmarshal([]byte(pos), &n.Position)
+			g.Nodes = append(g.Nodes, n)
+			return nil
+		})
+	if err != nil {
+		return g, err
+	}
+	err = s.queryEach(ctx, "SELECT id, COALESCE(source_id, ''), COALESCE(target_id, ''), COALESCE(type, ''), points, page_number, "+sqliteOrigin+" FROM connections WHERE document_id = ?", docID,
+		func(rows *sql.Rows) error {
+			var c Connection
+			var points sql.NullString
+			if err := rows.Scan(append([]interface{}{&c.ID, &c.SourceID, &c.TargetID, &c.Type, &points, &c.Page, &c.RegionID}, c.Origin.dest()...)...); err != nil {
+				return err
+			}
+			if points.Valid {
+				json.Unmarshal([]byte(points.String), &c.Points)
+			}
+			g.Connections = append(g.Connections, c)
+			return nil
+		})
+	return g, err
+}
+
+func (s *sqliteRecords) loadText(ctx context.Context, docID string) ([]TextAnnotation, error) {
+	texts := []TextAnnotation{}
+	err := s.queryEach(ctx, `SELECT id, COALESCE(bbox, '[]'), COALESCE(raw_text, ''), is_ignored, COALESCE(linked_to, ''),
+		COALESCE(label_name, ''), "values", page_number, `+sqliteOrigin+` FROM text_annotations WHERE document_id = ?`, docID,
+		func(rows *sql.Rows) error {
+			var t TextAnnotation
+			var bbox string
+			var values sql.NullString
+			if err := rows.Scan(append([]interface{}{&t.ID, &bbox, &t.RawText, &t.IsIgnored, &t.LinkedTo, &t.LabelName, &values, &t.Page, &t.RegionID},
+				t.Origin.dest()...)...); err != nil {
+				return err
+			}
+			json.Unmarshal([]byte(bbox), &t.BBox)
+			if values.Valid {
+				json.Unmarshal([]byte(values.String), &t.Values)
+				normalizeValues(t.Values)
+			}
+			texts = append(texts, t)
+			return nil
+		})
+	return texts, err
+}
+
+func (s *sqliteRecords) PageCount(ctx context.Context, docID string) (int, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx, "SELECT COALESCE(num_pages, 1) FROM documents WHERE document_id = ?", docID).Scan(&n)
+	return n, err
+}
+
+func (s *sqliteRecords) FindPage(ctx context.Context, docID string, page int) (storedPage, error) {
+	sp := storedPage{docID: docID}
+	err := s.db.QueryRowContext(ctx, `
+		SELECT COALESCE(p.storage_key, ''), COALESCE(p.image_file, d.image_file), COALESCE(p.sha256, '')
+		FROM documents d
+		LEFT JOIN pages p ON p.document_id = d.document_id AND p.page_number = ?2
+		WHERE d.document_id = ?1 AND (p.page_number IS NOT NULL OR ?2 = 1)
+	`, docID, page).Scan(&sp.Key, &sp.ImageFile, &sp.SHA256)
+	if err != nil {
+		return storedPage{}, err
+	}
+	return sp, nil
+}
+
+func (s *sqliteRecords) PageSizes(ctx context.Context, docID string) (map[int]pageSize, error) {
+	sizes := map[int]pageSize{}
+	err := s.queryEach(ctx, `
+		SELECT page_number, width, height FROM pages
+		WHERE document_id = ?1 AND width > 0 AND height > 0
+		UNION ALL
+		SELECT 1, width, height FROM documents
+		WHERE document_id = ?1 AND width > 0 AND height > 0
+		  AND NOT EXISTS (SELECT 1 FROM pages WHERE document_id = ?1)
+	`, docID, func(rows *sql.Rows) error {
+		var page int
+		var ps pageSize
+		if err := rows.Scan(&page, &ps.Width, &ps.Height); err != nil {
+			return err
+		}
+		sizes[page] = ps
+		return nil
+	})
+	return sizes, err
+}
+
+// FindDuplicates compares hashes in Go; SQLite has no popcount
+func (s *sqliteRecords) FindDuplicates(ctx context.Context, docID string, maxDistance int) ([]DuplicateDocument, error) {
+	dups := []DuplicateDocument{}
+	var hash sql.NullInt64
+	err := s.db.QueryRowContext(ctx, "SELECT phash FROM documents WHERE document_id = ?", docID).Scan(&hash)
+	if err != nil || !hash.Valid {
+		return dups, err
+	}
+	err = s.queryEach(ctx, "SELECT document_id, image_file, project, phash FROM documents WHERE document_id <> ? AND phash IS NOT NULL", docID,
+		func(rows *sql.Rows) error {
+			var d DuplicateDocument
+			var other int64
+			if err := rows.Scan(&d.DocumentID, &d.ImageFile, &d.Project, &other); err != nil {
+				return err
+			}
+			if d.Distance = bits.OnesCount64(uint64(other ^ hash.Int64)); d.Distance <= maxDistance {
+				dups = append(dups, d)
+			}
+			return nil
+		})
+	sort.SliceStable(dups, func(i, j int) bool { return dups[i].Distance < dups[j].Distance })
+	return dups, err
+}
+
+func (s *sqliteRecords) ThumbnailKey(ctx context.Context, docID string) (string, error) {
+	var key sql.NullString
+	err := s.db.QueryRowContext(ctx, "SELECT thumbnail_key FROM documents WHERE document_id = ?", docID).Scan(&key)
+	return key.String, err
+}
+
+func (s *sqliteRecords) SetThumbnailKey(ctx context.Context, docID, key string) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE documents SET thumbnail_key = ? WHERE document_id = ?", key, docID)
+	return err
+}
+
+func (s *sqliteRecords) SetClassification(ctx context.Context, docID, drawingType, source string) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE documents SET drawing_type = ?, source = ? WHERE document_id = ?",
+		drawingType, source, docID)
+	return err
+}
+
+// ReplaceAnnotations drops events: webhooks are delivered from the PostgreSQL outbox only
+func (s *sqliteRecords) ReplaceAnnotations(ctx context.Context, docID, _ string, tables []annotationTable, _ ...outboxEvent) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{"components", "nodes", "connections", "text_annotations", "regions"} {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM "+table+" WHERE document_id = ?", docID); err != nil {
+			return err
+		}
+	}
+	for _, t := range tables {
+		if len(t.Rows) == 0 {
+			continue
+		}
+		cols := make([]string, len(t.Columns))
+		for i, c := range t.Columns {
+			cols[i] = `"` + c + `"`
+		}
+		stmt, err := tx.PrepareContext(ctx, "INSERT INTO "+t.Table+" ("+strings.Join(cols, ", ")+") VALUES (?"+strings.Repeat(", ?", len(cols)-1)+")")
+		if err != nil {
+			return fmt.Errorf("%s: %w", t.Table, err)
+		}
+		for _, row := range t.Rows {
+			args := make([]interface{}, len(row))
+			for i, v := range row {
+				if args[i], err = sqliteValue(v); err != nil {
+					stmt.Close()
+					return fmt.Errorf("%s: %w", t.Table, err)
+				}
+			}
+			if _, err := stmt.ExecContext(ctx, args...); err != nil {
+				stmt.Close()
+				return fmt.Errorf("%s: %w", t.Table, err)
+			}
+		}
+		stmt.Close()
+	}
+	return tx.Commit()
+}
+
+// sqliteValue stores what PostgreSQL keeps in array and JSONB columns as JSON text
+func sqliteValue(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case nil, string, bool, int, int64, float64:
+		return v, nil
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func testDocument(id, sha string) *StoredDocument {
+	page := PageInfo{PageNumber: 1, ImageFile: id + ".png", Width: 100, Height: 50}
+	return &StoredDocument{
+		DocumentID: id,
+		Project:    "default",
+		Filename:   id + ".png",
+		Format:     "png",
+		Original:   StoredObject{Key: id + ".png", SHA256: sha, Size: 10},
+		Pages:      []PageInfo{page},
+	}
+}
+
+func TestSQLiteUpgradesExistingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "old.db")
+	// A file as the first SQLite store left it: the base tables and no upgrades
+	old, err := sql.Open("sqlite", "file:"+path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := old.Exec(sqliteSchema); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := old.Exec("INSERT INTO documents (document_id, image_file, pdf_file) VALUES ('a', 'a.png', 'scan.pdf')"); err != nil {
+		t.Fatal(err)
+	}
+	old.Close()
+
+	// Opening twice checks that applied upgrades are not run again
+	for i := 0; i < 2; i++ {
+		s, err := openSQLite(path)
+		if err != nil {
+			t.Fatalf("open %d: %v", i, err)
+		}
+		var version int
+		if err := s.db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+			t.Fatal(err)
+		}
+		if version != len(sqliteUpgrades) {
+			t.Errorf("open %d: user_version = %d, want %d", i, version, len(sqliteUpgrades))
+		}
+		doc, err := s.LoadDocument(context.Background(), "a", documentView{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if doc.OriginalFilename != "scan.pdf" {
+			t.Errorf("open %d: original_filename = %q, want scan.pdf", i, doc.OriginalFilename)
+		}
+		docs, err := s.ListDocuments(context.Background(), documentFilter{Status: "active"})
+		if err != nil || len(docs) != 1 {
+			t.Errorf("open %d: active documents = %v, %v", i, docs, err)
+		}
+		s.db.Close()
+	}
+}
+
+func TestSQLiteDocumentFields(t *testing.T) {
+	ctx := context.Background()
+	s, err := openSQLite(filepath.Join(t.TempDir(), "corvina.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.db.Close()
+
+	doc := testDocument("a", "sha-a")
+	doc.OriginalName, doc.Uploader, doc.QuotaUser = "Lab Notebook 3.png", "alice", "key-owner"
+	if err := s.SaveDocument(ctx, doc); err != nil {
+		t.Fatal(err)
+	}
+	var uploader, quotaUser string
+	if err := s.db.QueryRow("SELECT uploaded_by, quota_user FROM documents WHERE document_id = 'a'").Scan(&uploader, &quotaUser); err != nil {
+		t.Fatal(err)
+	}
+	if uploader != "alice" || quotaUser != "key-owner" {
+		t.Errorf("uploaded_by %q, quota_user %q", uploader, quotaUser)
+	}
+
+	// Names are only given through PostgreSQL endpoints; set them directly
+	if _, err := s.db.Exec(`UPDATE documents SET display_name = 'Notebook 3' WHERE document_id = 'a';
+		INSERT INTO document_aliases (alias, document_id, created_at) VALUES ('nb3', 'a', '2024-01-02T00:00:00Z'), ('lab-3', 'a', '2024-01-01T00:00:00Z')`); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.LoadDocument(ctx, "a", documentView{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.OriginalFilename != "Lab Notebook 3.png" || got.DisplayName != "Notebook 3" || !reflect.DeepEqual(got.Aliases, []string{"lab-3", "nb3"}) {
+		t.Errorf("got original_filename %q, display_name %q, aliases %v", got.OriginalFilename, got.DisplayName, got.Aliases)
+	}
+
+	// A new version archives the document it supersedes
+	next := testDocument("b", "sha-b")
+	next.Supersedes = "a"
+	if err := s.SaveDocument(ctx, next); err != nil {
+		t.Fatal(err)
+	}
+	for status, want := range map[string]string{"active": "b", "archived": "a"} {
+		docs, err := s.ListDocuments(ctx, documentFilter{Status: status})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(docs) != 1 || docs[0].DocumentID != want || docs[0].Status != status {
+			t.Errorf("status %s: got %+v", status, docs)
+		}
+	}
+	docs, err := s.ListDocuments(ctx, documentFilter{DocumentID: "a"})
+	if err != nil || len(docs) != 1 || docs[0].DisplayName != "Notebook 3" {
+		t.Errorf("list: got %+v, %v", docs, err)
+	}
+}
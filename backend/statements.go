@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ---------- Prepared Statements ----------
+
+// queryExecMode picks how pgx sends queries. cache_statement prepares each distinct query once
+// per connection and reuses it; behind a transaction-mode pooler such as PgBouncer, which can't
+// keep statements across transactions, use exec or simple_protocol.
+var queryExecMode = envChoice("DB_QUERY_EXEC_MODE", "cache_statement",
+	"cache_statement", "cache_describe", "describe_exec", "exec", "simple_protocol")
+
+var queryExecModes = map[string]pgx.QueryExecMode{
+	"cache_statement": pgx.QueryExecModeCacheStatement,
+	"cache_describe":  pgx.QueryExecModeCacheDescribe,
+	"describe_exec":   pgx.QueryExecModeDescribeExec,
+	"exec":            pgx.QueryExecModeExec,
+	"simple_protocol": pgx.QueryExecModeSimpleProtocol,
+}
+
+// Queries on the hot paths (/submit and /documents/{id}). They are prepared as soon as a
+// connection opens rather than on first use.
+const (
+	sqlDocumentNumPages = "SELECT COALESCE(num_pages, 1) FROM documents WHERE document_id = $1"
+	sqlDocumentExists   = "SELECT EXISTS (SELECT 1 FROM documents WHERE document_id = $1)"
+	sqlDocument         = "SELECT image_file, drawing_type, source, COALESCE(tags, '{}'), notes, COALESCE(num_pages, 1), COALESCE(width, 0), COALESCE(height, 0), sha256, size_bytes, COALESCE(original_filename, ''), COALESCE(display_name, ''), ARRAY(SELECT alias FROM document_aliases a WHERE a.document_id = documents.document_id ORDER BY a.created_at, a.alias) FROM documents WHERE document_id = $1"
+	sqlDocumentPages    = "SELECT page_number, image_file, COALESCE(width, 0), COALESCE(height, 0), COALESCE(sha256, '') FROM pages WHERE document_id = $1 ORDER BY page_number"
+	sqlComponents       = "SELECT id, label, COALESCE(bbox, '{}'), page_number, COALESCE(region_id, ''), COALESCE(catalog_id, ''), " + originColumns + " FROM components WHERE document_id = $1"
+	sqlNodes            = "SELECT id, COALESCE(position, '{}'), page_number, COALESCE(region_id, ''), " + originColumns + " FROM nodes WHERE document_id = $1"
+	sqlConnections      = "SELECT id, source_id, target_id, type, points, page_number, COALESCE(region_id, ''), " + originColumns + " FROM connections WHERE document_id = $1"
+	sqlTextAnnotations  = "SELECT id, COALESCE(bbox, '{}'), raw_text, is_ignored, linked_to, label_name, values, page_number, COALESCE(region_id, ''), " + originColumns + " FROM text_annotations WHERE document_id = $1"
+	sqlRegions          = "SELECT id, COALESCE(label, ''), COALESCE(bbox, '{}'), page_number FROM regions WHERE document_id = $1 ORDER BY page_number, id"
+	sqlPageSizes        = `
+		SELECT page_number, width, height FROM pages
+		WHERE document_id = $1 AND width > 0 AND height > 0
+		UNION ALL
+		SELECT 1, width, height FROM documents
+		WHERE document_id = $1 AND width > 0 AND height > 0
+		  AND NOT EXISTS (SELECT 1 FROM pages WHERE document_id = $1)
+	`
+)
+
+var hotStatements = []string{
+	sqlDocumentNumPages, sqlDocumentExists, sqlDocument, sqlDocumentPages,
+	sqlComponents, sqlNodes, sqlConnections, sqlTextAnnotations, sqlRegions, sqlPageSizes,
+}
+
+// prepareStatements prepares hotStatements on a new connection. Each is named by its own SQL
+// text, which pgx matches on lookup, so callers keep passing the query string. A statement that
+// fails to prepare (say, before migrations have created its table) is left to be prepared on
+// first use instead.
+func prepareStatements(ctx context.Context, conn *pgx.Conn) error {
+	if queryExecMode != "cache_statement" {
+		return nil
+	}
+	for _, q := range hotStatements {
+		if _, err := conn.Prepare(ctx, q, q); err != nil {
+			slog.DebugContext(ctx, "Preparing statement failed", "error", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// benchmarkLoadDocument loads the benchmark document, with 2,000 annotations, through a pool
+// whose connections send queries in mode. prepare also prepares hotStatements on connect.
+func benchmarkLoadDocument(b *testing.B, mode pgx.QueryExecMode, prepare bool) {
+	benchPostgres(b)
+	ctx := context.Background()
+	if err := (postgresRecords{}).ReplaceAnnotations(ctx, benchDocumentID, "", benchTables(2000)); err != nil {
+		b.Fatal(err)
+	}
+
+	cfg, err := newPoolConfig(databaseURL)
+	if err != nil {
+		b.Fatal(err)
+	}
+	cfg.ConnConfig.DefaultQueryExecMode = mode
+	if !prepare {
+		cfg.AfterConnect = nil
+	}
+	p, err := pgxpool.NewWithConfig(ctx, cfg)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer p.Close()
+	primary := pool
+	pool, replicaPool = p, p
+	defer func() { pool, replicaPool = primary, primary }()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := (postgresRecords{}).LoadDocument(ctx, benchDocumentID, documentView{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkLoadDocumentPrepared(b *testing.B) {
+	benchmarkLoadDocument(b, pgx.QueryExecModeCacheStatement, true)
+}
+
+func BenchmarkLoadDocumentUnprepared(b *testing.B) {
+	benchmarkLoadDocument(b, pgx.QueryExecModeExec, false)
+}
@@ -0,0 +1,384 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ---------- Corpus Statistics ----------
+
+// GET /stats?project=&split=&from=&to= summarizes the annotations: label frequencies, annotations
+// per document, connection types, classification breakdowns, and submissions per day between
+// from and to (YYYY-MM-DD, inclusive; the last 30 days by default). Without project, every
+// project is counted.
+
+// statsDefaultDays is the submission window when from is not given
+const statsDefaultDays = 30
+
+// statsDocFilter restricts d (documents) to $1 project and $2 split, either of which may be ""
+const statsDocFilter = "($1 = '' OR d.project = $1) AND ($2 = '' OR d.split = $2)"
+
+type LabelCount struct {
+	Label string `json:"label"`
+	Count int64  `json:"count"`
+}
+
+type DailySubmissions struct {
+	Date        string `json:"date"`
+	Submissions int64  `json:"submissions"`
+	Documents   int64  `json:"documents"` // distinct documents submitted that day
+}
+
+type CorpusStats struct {
+	Project            string                  `json:"project,omitempty"`
+	Split              string                  `json:"split,omitempty"`
+	Documents          int64                   `json:"documents"`
+	AnnotatedDocuments int64                   `json:"annotated_documents"` // with at least one annotation
+	Annotations        map[string]int64        `json:"annotations"`         // per table
+	TotalAnnotations   int64                   `json:"total_annotations"`
+	AvgPerDocument     float64                 `json:"avg_annotations_per_document"` // over annotated documents
+	Labels             map[string][]LabelCount `json:"labels"`                       // components, regions, text_annotations
+	Connections        map[string]int64        `json:"connections"`                  // per type: connection, line
+	Classification     map[string][]LabelCount `json:"classification"`               // drawing_type, source, split
+	From               string                  `json:"from"`
+	To                 string                  `json:"to"`
+	SubmissionsPerDay  []DailySubmissions      `json:"submissions_per_day"`
+	AnnotationHours    float64                 `json:"annotation_hours"` // stopped sessions started in the range
+}
+
+// statsAnnotationTables are counted towards annotations per document
+var statsAnnotationTables = []string{"components", "nodes", "connections", "text_annotations", "regions"}
+
+// statsLabelColumns names the label column of each table with label frequencies
+var statsLabelColumns = map[string]string{"components": "label", "regions": "label", "text_annotations": "label_name"}
+
+// countBy runs a query returning (label, count) rows
+func countBy(ctx context.Context, query string, args ...interface{}) ([]LabelCount, error) {
+	rows, err := readDB(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	counts := []LabelCount{}
+	for rows.Next() {
+		var c LabelCount
+		if err := rows.Scan(&c.Label, &c.Count); err != nil {
+			return nil, err
+		}
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
+
+func corpusStats(ctx context.Context, project, split string, from, to time.Time) (*CorpusStats, error) {
+	st := &CorpusStats{
+		Project: project, Split: split,
+		Annotations: map[string]int64{}, Labels: map[string][]LabelCount{}, Connections: map[string]int64{},
+		Classification: map[string][]LabelCount{},
+		From:           from.Format("2006-01-02"), To: to.Format("2006-01-02"),
+	}
+	args := []interface{}{project, split}
+
+	err := readDB(ctx).QueryRowContext(ctx, "SELECT count(*) FROM documents d WHERE "+statsDocFilter, args...).Scan(&st.Documents)
+	if err != nil {
+		return nil, err
+	}
+
+	annotated := ""
+	for i, t := range statsAnnotationTables {
+		var n int64
+		err := readDB(ctx).QueryRowContext(ctx, fmt.Sprintf("SELECT count(*) FROM %s a JOIN documents d ON d.document_id = a.document_id WHERE %s", t, statsDocFilter), args...).Scan(&n)
+		if err != nil {
+			return nil, err
+		}
+		st.Annotations[t] = n
+		st.TotalAnnotations += n
+		if i > 0 {
+			annotated += " UNION "
+		}
+		annotated += "SELECT document_id FROM " + t
+	}
+	err = readDB(ctx).QueryRowContext(ctx, "SELECT count(*) FROM documents d WHERE "+statsDocFilter+" AND d.document_id IN ("+annotated+")", args...).Scan(&st.AnnotatedDocuments)
+	if err != nil {
+		return nil, err
+	}
+	if st.AnnotatedDocuments > 0 {
+		st.AvgPerDocument = float64(st.TotalAnnotations) / float64(st.AnnotatedDocuments)
+	}
+
+	for table, col := range statsLabelColumns {
+		counts, err := countBy(ctx, fmt.Sprintf(`SELECT COALESCE(a.%s, ''), count(*) FROM %s a JOIN documents d ON d.document_id = a.document_id
+			WHERE %s GROUP BY 1 ORDER BY 2 DESC, 1`, col, table, statsDocFilter), args...)
+		if err != nil {
+			return nil, err
+		}
+		st.Labels[table] = counts
+	}
+
+	types, err := countBy(ctx, `SELECT COALESCE(a.type, 'connection'), count(*) FROM connections a JOIN documents d ON d.document_id = a.document_id
+		WHERE `+statsDocFilter+` GROUP BY 1`, args...)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range types {
+		st.Connections[c.Label] = c.Count
+	}
+
+	for _, col := range []string{"drawing_type", "source", "split"} {
+		counts, err := countBy(ctx, fmt.Sprintf(`SELECT COALESCE(d.%s, ''), count(*) FROM documents d
+			WHERE %s GROUP BY 1 ORDER BY 2 DESC, 1`, col, statsDocFilter), args...)
+		if err != nil {
+			return nil, err
+		}
+		st.Classification[col] = counts
+	}
+
+	err = readDB(ctx).QueryRowContext(ctx, `
+		SELECT COALESCE(sum(extract(epoch FROM s.ended_at - s.started_at)), 0) / 3600
+		FROM annotation_sessions s JOIN documents d ON d.document_id = s.document_id
+		WHERE `+statsDocFilter+` AND s.started_at >= $3 AND s.started_at < $4 AND s.ended_at IS NOT NULL`,
+		project, split, from, to.AddDate(0, 0, 1)).Scan(&st.AnnotationHours)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := readDB(ctx).QueryContext(ctx, `
+		SELECT to_char(date_trunc('day', s.submitted_at), 'YYYY-MM-DD'), count(*), count(DISTINCT s.document_id)
+		FROM submissions s JOIN documents d ON d.document_id = s.document_id
+		WHERE `+statsDocFilter+` AND s.submitted_at >= $3 AND s.submitted_at < $4
+		GROUP BY 1 ORDER BY 1`, project, split, from, to.AddDate(0, 0, 1))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	st.SubmissionsPerDay = []DailySubmissions{}
+	for rows.Next() {
+		var d DailySubmissions
+		if err := rows.Scan(&d.Date, &d.Submissions, &d.Documents); err != nil {
+			return nil, err
+		}
+		st.SubmissionsPerDay = append(st.SubmissionsPerDay, d)
+	}
+	return st, rows.Err()
+}
+
+// statsDateRange parses from and to (YYYY-MM-DD), defaulting to the statsDefaultDays ending today
+func statsDateRange(fromParam, toParam string) (time.Time, time.Time, error) {
+	to := time.Now().UTC().Truncate(24 * time.Hour)
+	if toParam != "" {
+		t, err := time.Parse("2006-01-02", toParam)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("to must be a date (YYYY-MM-DD)")
+		}
+		to = t
+	}
+	from := to.AddDate(0, 0, -(statsDefaultDays - 1))
+	if fromParam != "" {
+		t, err := time.Parse("2006-01-02", fromParam)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("from must be a date (YYYY-MM-DD)")
+		}
+		from = t
+	}
+	if from.After(to) {
+		return time.Time{}, time.Time{}, fmt.Errorf("from is after to")
+	}
+	return from, to, nil
+}
+
+func handleStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		jsonError(w, http.StatusMethodNotAllowed, "GET only")
+		return
+	}
+	q := r.URL.Query()
+	from, to, err := statsDateRange(q.Get("from"), q.Get("to"))
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	st, err := corpusStats(r.Context(), q.Get("project"), q.Get("split"), from, to)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Stats query failed", "error", err)
+		jsonError(w, http.StatusInternalServerError, "Query failed")
+		return
+	}
+	jsonResponse(w, http.StatusOK, st)
+}
+
+// ---------- Annotator Statistics ----------
+
+// GET /stats/annotators?annotator=&project=&split=&from=&to= reports each annotator's totals over
+// the date range, for balancing workload. Only totals are reported, never individual saves.
+// Authorship comes from the annotator query parameter of /submit and the reviewer of suggestion
+// decisions; anonymous work is left out.
+//
+//   - documents: distinct documents the annotator saved
+//   - annotations_created / annotations_removed: annotation ids their saves added and dropped
+//   - avg_seconds_per_document: from claiming a document in /tasks/next to its last save in that
+//     claim, over the documents they claimed
+//   - rejection_rate: share of the model suggestions they decided on that they rejected
+
+type AnnotatorStats struct {
+	Annotator             string   `json:"annotator"`
+	Documents             int64    `json:"documents"`
+	Submissions           int64    `json:"submissions"`
+	AnnotationsCreated    int64    `json:"annotations_created"`
+	AnnotationsRemoved    int64    `json:"annotations_removed"`
+	TimedDocuments        int64    `json:"timed_documents"`
+	AvgSecondsPerDocument *float64 `json:"avg_seconds_per_document"`
+	SuggestionsDecided    int64    `json:"suggestions_decided"`
+	SuggestionsRejected   int64    `json:"suggestions_rejected"`
+	RejectionRate         *float64 `json:"rejection_rate"`
+	SessionHours          float64  `json:"session_hours"` // from annotation sessions
+}
+
+func annotatorStats(ctx context.Context, annotator, project, split string, from, to time.Time) ([]AnnotatorStats, error) {
+	args := []interface{}{project, split, from, to.AddDate(0, 0, 1), annotator}
+	byName := map[string]*AnnotatorStats{}
+	get := func(name string) *AnnotatorStats {
+		if byName[name] == nil {
+			byName[name] = &AnnotatorStats{Annotator: name}
+		}
+		return byName[name]
+	}
+
+	rows, err := readDB(ctx).QueryContext(ctx, `
+		SELECT s.annotator, count(DISTINCT s.document_id), count(*), COALESCE(sum(s.created), 0), COALESCE(sum(s.removed), 0)
+		FROM submissions s JOIN documents d ON d.document_id = s.document_id
+		WHERE `+statsDocFilter+` AND s.submitted_at >= $3 AND s.submitted_at < $4
+			AND s.annotator IS NOT NULL AND ($5 = '' OR s.annotator = $5)
+		GROUP BY 1`, args...)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var name string
+		var a AnnotatorStats
+		if err := rows.Scan(&name, &a.Documents, &a.Submissions, &a.AnnotationsCreated, &a.AnnotationsRemoved); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		st := get(name)
+		st.Documents, st.Submissions, st.AnnotationsCreated, st.AnnotationsRemoved = a.Documents, a.Submissions, a.AnnotationsCreated, a.AnnotationsRemoved
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// One claim of one document is timed from the claim to the last save made under it
+	rows, err = readDB(ctx).QueryContext(ctx, `
+		SELECT annotator, count(*), avg(seconds) FROM (
+			SELECT s.annotator, extract(epoch FROM max(s.submitted_at) - s.started_at) AS seconds
+			FROM submissions s JOIN documents d ON d.document_id = s.document_id
+			WHERE `+statsDocFilter+` AND s.submitted_at >= $3 AND s.submitted_at < $4
+				AND s.annotator IS NOT NULL AND ($5 = '' OR s.annotator = $5) AND s.started_at IS NOT NULL
+			GROUP BY s.annotator, s.document_id, s.started_at
+		) claims GROUP BY 1`, args...)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var name string
+		var n int64
+		var avg float64
+		if err := rows.Scan(&name, &n, &avg); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		st := get(name)
+		st.TimedDocuments, st.AvgSecondsPerDocument = n, &avg
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = readDB(ctx).QueryContext(ctx, `
+		SELECT s.annotator, sum(extract(epoch FROM s.ended_at - s.started_at)) / 3600
+		FROM annotation_sessions s JOIN documents d ON d.document_id = s.document_id
+		WHERE `+statsDocFilter+` AND s.started_at >= $3 AND s.started_at < $4 AND s.ended_at IS NOT NULL
+			AND s.annotator IS NOT NULL AND ($5 = '' OR s.annotator = $5)
+		GROUP BY 1`, args...)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var name string
+		var hours float64
+		if err := rows.Scan(&name, &hours); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		get(name).SessionHours = hours
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = readDB(ctx).QueryContext(ctx, `
+		SELECT g.decided_by, count(*), count(*) FILTER (WHERE g.status = 'rejected')
+		FROM suggestions g JOIN documents d ON d.document_id = g.document_id
+		WHERE `+statsDocFilter+` AND g.decided_at >= $3 AND g.decided_at < $4
+			AND g.decided_by IS NOT NULL AND ($5 = '' OR g.decided_by = $5)
+		GROUP BY 1`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		var decided, rejected int64
+		if err := rows.Scan(&name, &decided, &rejected); err != nil {
+			return nil, err
+		}
+		st := get(name)
+		st.SuggestionsDecided, st.SuggestionsRejected = decided, rejected
+		rate := float64(rejected) / float64(decided)
+		st.RejectionRate = &rate
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	out := make([]AnnotatorStats, 0, len(byName))
+	for _, st := range byName {
+		out = append(out, *st)
+	}
+	slices.SortFunc(out, func(a, b AnnotatorStats) int { return strings.Compare(a.Annotator, b.Annotator) })
+	return out, nil
+}
+
+func handleAnnotatorStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		jsonError(w, http.StatusMethodNotAllowed, "GET only")
+		return
+	}
+	q := r.URL.Query()
+	from, to, err := statsDateRange(q.Get("from"), q.Get("to"))
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	annotators, err := annotatorStats(r.Context(), q.Get("annotator"), q.Get("project"), q.Get("split"), from, to)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Annotator stats query failed", "error", err)
+		jsonError(w, http.StatusInternalServerError, "Query failed")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]interface{}{
+		"from":       from.Format("2006-01-02"),
+		"to":         to.Format("2006-01-02"),
+		"annotators": annotators,
+		"count":      len(annotators),
+	})
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ---------- Content-Addressed Storage ----------
+
+// Uploaded files and page images live under dataset/objects/<h[:2]>/<h><ext>, where h is the
+// SHA-256 of the content. Identical files are stored once no matter how many documents use them.
+// Documents uploaded before this layout keep their files at dataset/<document_id>/<image_file>.
+const objectsDir = "objects"
+
+// StoredObject identifies a file in the object store
+type StoredObject struct {
+	Key    string `json:"-"`
+	SHA256 string `json:"sha256,omitempty"`
+	Size   int64  `json:"size_bytes,omitempty"`
+}
+
+// objectPath is a local file holding an object, for code that needs a real file (image
+// decoding, pdftoppm, Range requests). Remote objects are downloaded into the cache first; when
+// that fails the error is logged and opening the returned path fails.
+func objectPath(key string) string {
+	if !isRemoteStore() {
+		return localObjects.path(key)
+	}
+	p := objectCache.path(key)
+	if _, err := os.Stat(p); err != nil {
+		if err := cacheObject(key); err != nil {
+			slog.Error("Fetching object failed", "key", key, "error", err)
+		}
+	}
+	return p
+}
+
+// objectHash extracts the SHA-256 from an object key
+func objectHash(key string) string {
+	base := path.Base(key)
+	return strings.TrimSuffix(base, path.Ext(base))
+}
+
+// objectExt is the extension objects of a format are stored under
+func objectExt(format string) string {
+	if format == "jpeg" {
+		return ".jpg"
+	}
+	return "." + format
+}
+
+// storeObject streams src into the object store, hashing as it goes. Content that is already
+// stored is not written twice.
+func storeObject(src io.Reader, ext string) (StoredObject, error) {
+	// The key depends on the hash, so the content is spooled before it is handed to the store
+	tmp, err := os.CreateTemp("", "corvina-object-*")
+	if err != nil {
+		return StoredObject{}, fmt.Errorf("creating file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tmp, h), src)
+	if err != nil {
+		return StoredObject{}, fmt.Errorf("writing file: %w", err)
+	}
+
+	sum := hex.EncodeToString(h.Sum(nil))
+	obj := StoredObject{Key: sum[:2] + "/" + sum + ext, SHA256: sum, Size: n}
+	if ok, err := store.Exists(obj.Key); err != nil {
+		return StoredObject{}, fmt.Errorf("checking object store: %w", err)
+	} else if ok {
+		return obj, nil
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return StoredObject{}, err
+	}
+	if err := store.Put(obj.Key, tmp); err != nil {
+		return StoredObject{}, fmt.Errorf("storing object: %w", err)
+	}
+	// New uploads are usually read back right away (rasterizing, thumbnails), so keep a copy
+	if isRemoteStore() {
+		if _, err := tmp.Seek(0, io.SeekStart); err == nil {
+			objectCache.Put(obj.Key, tmp)
+		}
+	}
+	return obj, nil
+}
+
+// readObject returns the full content of a small object
+func readObject(key string) ([]byte, error) {
+	rc, err := store.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+// documentImagePath returns the on-disk location of a page image, falling back to the
+// per-document directory used before content addressing
+func documentImagePath(storageKey, docID, imageFile string) string {
+	if storageKey != "" {
+		return objectPath(storageKey)
+	}
+	return filepath.Join(datasetDir, docID, imageFile)
+}
+
+// storedPage locates the image of one page of a document
+type storedPage struct {
+	Path      string // local file; empty until loadStoredPage fetches it
+	Key       string // object key; empty for documents stored before content addressing
+	ImageFile string
+	SHA256    string // empty for documents stored before content addressing
+	docID     string
+}
+
+// FindPage looks up a page image without fetching it from the store; documents without page
+// rows only have page 1. Returns sql.ErrNoRows when the document or page does not exist.
+func (postgresRecords) FindPage(ctx context.Context, docID string, page int) (storedPage, error) {
+	sp := storedPage{docID: docID}
+	err := readDB(ctx).QueryRowContext(ctx, `
+		SELECT COALESCE(p.storage_key, ''), COALESCE(p.image_file, d.image_file), COALESCE(p.sha256, '')
+		FROM documents d
+		LEFT JOIN pages p ON p.document_id = d.document_id AND p.page_number = $2
+		WHERE d.document_id = $1 AND (p.page_number IS NOT NULL OR $2 = 1)
+	`, docID, page).Scan(&sp.Key, &sp.ImageFile, &sp.SHA256)
+	if err != nil {
+		return storedPage{}, err
+	}
+	return sp, nil
+}
+
+// loadStoredPage finds a page image and makes it available as a local file
+func loadStoredPage(ctx context.Context, docID string, page int) (storedPage, error) {
+	sp, err := records.FindPage(ctx, docID, page)
+	if err != nil {
+		return sp, err
+	}
+	sp.Path = documentImagePath(sp.Key, docID, sp.ImageFile)
+	return sp, nil
+}
+
+// serveStoredPage serves a page image from wherever it is stored
+func serveStoredPage(w http.ResponseWriter, r *http.Request, sp storedPage) {
+	if sp.Key != "" {
+		serveObject(w, r, sp.Key, sp.ImageFile)
+		return
+	}
+	serveStoredFile(w, r, documentImagePath("", sp.docID, sp.ImageFile), sp.ImageFile, sp.SHA256)
+}
+
+// serveStoredFile streams a stored file with Range and conditional request support. etag is the
+// content hash when known; otherwise a weak tag is derived from size and modification time.
+func serveStoredFile(w http.ResponseWriter, r *http.Request, filePath, name, etag string) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		jsonError(w, http.StatusNotFound, "Image file missing")
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "Failed to read image")
+		return
+	}
+
+	if etag != "" {
+		w.Header().Set("ETag", `"`+etag+`"`)
+	} else {
+		w.Header().Set("ETag", fmt.Sprintf(`W/"%x-%x"`, info.Size(), info.ModTime().UnixNano()))
+	}
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	// ServeContent picks the Content-Type from the name's extension and handles Range/If-None-Match
+	http.ServeContent(w, r, name, info.ModTime(), f)
+}
+
+// ---------- Image Serving ----------
+
+// pageParam reads the optional 1-based ?page= query parameter
+func pageParam(r *http.Request) (int, error) {
+	v := r.URL.Query().Get("page")
+	if v == "" {
+		return 1, nil
+	}
+	page, err := strconv.Atoi(v)
+	if err != nil || page < 1 {
+		return 0, errors.New("page must be a positive integer")
+	}
+	return page, nil
+}
+
+// handleDocumentImage serves a page image: GET /documents/{id}/image?page=N
+func handleDocumentImage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		jsonError(w, http.StatusMethodNotAllowed, "GET only")
+		return
+	}
+	docID := r.PathValue("id")
+	page, err := pageParam(r)
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	sp, err := records.FindPage(r.Context(), docID, page)
+	if errors.Is(err, sql.ErrNoRows) {
+		jsonError(w, http.StatusNotFound, "Document or page not found")
+		return
+	}
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "Query failed")
+		return
+	}
+	serveStoredPage(w, r, sp)
+}
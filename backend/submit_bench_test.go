@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// The benchmarks here need a PostgreSQL database they may write to and are skipped without one:
+//
+//	DATABASE_URL=postgres://... go test -run '^$' -bench . -benchtime 20x
+
+const benchDocumentID = "bench-document"
+
+var benchSetup sync.Once
+
+// benchPostgres connects to DATABASE_URL, migrates it, and creates the document the benchmarks
+// write to
+func benchPostgres(b *testing.B) {
+	b.Helper()
+	if databaseURL == "" {
+		b.Skip("DATABASE_URL is not set")
+	}
+	benchSetup.Do(func() {
+		pool, db = connectDB()
+		replicaPool, replicaDB = pool, db
+		records = postgresRecords{}
+		ctx := context.Background()
+		if err := migrate(ctx); err != nil {
+			b.Fatalf("migrating: %v", err)
+		}
+		_, err := pool.Exec(ctx, `INSERT INTO documents (document_id, image_file, project) VALUES ($1, $1 || '.png', 'bench')
+			ON CONFLICT (document_id) DO NOTHING`, benchDocumentID)
+		if err != nil {
+			b.Fatalf("creating document: %v", err)
+		}
+	})
+}
+
+// benchTables builds a submission of n annotations, split between components, nodes, and text
+func benchTables(n int) []annotationTable {
+	provColumns := []string{"provenance", "suggestion_id", "model_name", "model_version", "region_id"}
+	prov := []interface{}{"human", nil, nil, nil, nil}
+	var components, nodes, texts [][]interface{}
+	for i := 0; i < n; i++ {
+		x, y := i%100*20, i/100*20
+		switch i % 5 {
+		case 0, 1:
+			components = append(components, append([]interface{}{
+				fmt.Sprintf("c%d", i), benchDocumentID, "resistor", []int{x, y, x + 15, y + 15}, 1}, prov...))
+		case 2, 3:
+			nodes = append(nodes, append([]interface{}{
+				fmt.Sprintf("n%d", i), benchDocumentID, []int{x, y}, 1}, prov...))
+		default:
+			texts = append(texts, append([]interface{}{
+				fmt.Sprintf("t%d", i), benchDocumentID, []int{x, y, x + 15, y + 8}, "4k7", false, nil, "R1",
+				[]Value{{Val: "4.7", UnitPrefix: "k", UnitSuffix: "Ω"}}, 1}, prov...))
+		}
+	}
+	return []annotationTable{
+		{"components", append([]string{"id", "document_id", "label", "bbox", "page_number"}, provColumns...), components},
+		{"nodes", append([]string{"id", "document_id", "position", "page_number"}, provColumns...), nodes},
+		{"text_annotations", append([]string{"id", "document_id", "bbox", "raw_text", "is_ignored", "linked_to", "label_name", "values", "page_number"}, provColumns...), texts},
+	}
+}
+
+// replaceAnnotationsByInsert saves tables the way /submit did before COPY: one INSERT per row
+func replaceAnnotationsByInsert(ctx context.Context, docID string, tables []annotationTable) error {
+	return inTx(ctx, "submit", func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, "SELECT 1 FROM documents WHERE document_id = $1 FOR UPDATE", docID); err != nil {
+			return err
+		}
+		for _, table := range []string{"components", "nodes", "connections", "text_annotations", "regions"} {
+			if _, err := tx.Exec(ctx, "DELETE FROM "+table+" WHERE document_id = $1", docID); err != nil {
+				return err
+			}
+		}
+		for _, t := range tables {
+			params := make([]string, len(t.Columns))
+			for i := range params {
+				params[i] = fmt.Sprintf("$%d", i+1)
+			}
+			insert := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", t.Table, strings.Join(t.Columns, ", "), strings.Join(params, ", "))
+			for _, row := range t.Rows {
+				if _, err := tx.Exec(ctx, insert, row...); err != nil {
+					return fmt.Errorf("%s: %w", t.Table, err)
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func benchmarkSubmit(b *testing.B, save func(context.Context, []annotationTable) error) {
+	benchPostgres(b)
+	ctx := context.Background()
+	for _, n := range []int{100, 2000, 10000} {
+		tables := benchTables(n)
+		b.Run(fmt.Sprintf("annotations=%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if err := save(ctx, tables); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkSubmitCopy(b *testing.B) {
+	benchmarkSubmit(b, func(ctx context.Context, tables []annotationTable) error {
+		return postgresRecords{}.ReplaceAnnotations(ctx, benchDocumentID, "", tables)
+	})
+}
+
+func BenchmarkSubmitInsertPerRow(b *testing.B) {
+	benchmarkSubmit(b, func(ctx context.Context, tables []annotationTable) error {
+		return replaceAnnotationsByInsert(ctx, benchDocumentID, tables)
+	})
+}
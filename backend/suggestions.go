@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ---------- Suggestions ----------
+
+// Suggestion is a machine-generated annotation draft. Suggestions live outside the canonical
+// annotation tables until an annotator accepts them.
+type Suggestion struct {
+	ID           string      `json:"id"`
+	DocumentID   string      `json:"document_id"`
+	Page         int         `json:"page"`
+	Type         string      `json:"type"`                    // box | node | connection | line | text
+	AnnotationID string      `json:"annotation_id,omitempty"` // existing annotation the suggestion fills in
+	Label        string      `json:"label,omitempty"`
+	BBox         []int       `json:"bbox,omitempty"`
+	Position     []int       `json:"position,omitempty"`
+	Points       interface{} `json:"points,omitempty"`
+	SourceID     string      `json:"source_id,omitempty"`
+	TargetID     string      `json:"target_id,omitempty"`
+	RawText      string      `json:"raw_text,omitempty"`
+	Confidence   float64     `json:"confidence"`
+	Source       string      `json:"source"` // ocr | model
+	ModelName    string      `json:"model_name,omitempty"`
+	ModelVersion string      `json:"model_version,omitempty"`
+	Status       string      `json:"status"` // pending
+	CreatedAt    string      `json:"created_at"`
+}
+
+// replacePendingSuggestions swaps a page's pending suggestions from one source for a new set
+func replacePendingSuggestions(ctx context.Context, docID string, page int, source string, suggestions []Suggestion) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx,
+		"DELETE FROM suggestions WHERE document_id = $1 AND page_number = $2 AND source = $3 AND status = 'pending'",
+		docID, page, source,
+	); err != nil {
+		return err
+	}
+	for _, s := range suggestions {
+		// Empty shapes are stored as NULL rather than as empty arrays
+		var bbox, position interface{}
+		if len(s.BBox) > 0 {
+			bbox = s.BBox
+		}
+		if len(s.Position) > 0 {
+			position = s.Position
+		}
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO suggestions (id, document_id, page_number, type, annotation_id, label, bbox, position, points,
+				source_id, target_id, raw_text, confidence, source, model_name, model_version)
+			VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, ''), $7, $8, $9, NULLIF($10, ''), NULLIF($11, ''), NULLIF($12, ''), $13, $14,
+				NULLIF($15, ''), NULLIF($16, ''))
+		`, s.ID, docID, page, s.Type, s.AnnotationID, s.Label, bbox, position, s.Points,
+			s.SourceID, s.TargetID, s.RawText, s.Confidence, source, s.ModelName, s.ModelVersion)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+const suggestionColumns = `id, document_id, page_number, type, annotation_id, label, bbox, position, points,
+	source_id, target_id, raw_text, confidence, source, status, created_at, model_name, model_version`
+
+// scanSuggestion reads a suggestions row selected with suggestionColumns from a pgx query
+func scanSuggestion(scan func(dest ...interface{}) error) (Suggestion, error) {
+	var s Suggestion
+	var annotationID, label, sourceID, targetID, rawText, modelName, modelVersion sql.NullString
+	var confidence sql.NullFloat64
+	var createdAt time.Time
+	err := scan(&s.ID, &s.DocumentID, &s.Page, &s.Type, &annotationID, &label, &s.BBox, &s.Position, &s.Points,
+		&sourceID, &targetID, &rawText, &confidence, &s.Source, &s.Status, &createdAt, &modelName, &modelVersion)
+	if err != nil {
+		return s, err
+	}
+	s.AnnotationID = annotationID.String
+	s.Label = label.String
+	s.SourceID = sourceID.String
+	s.TargetID = targetID.String
+	s.RawText = rawText.String
+	s.Confidence = confidence.Float64
+	s.CreatedAt = createdAt.Format(time.RFC3339)
+	s.ModelName = modelName.String
+	s.ModelVersion = modelVersion.String
+	return s, nil
+}
+
+// handleListSuggestions lists a document's suggestions:
+// GET /documents/{id}/suggestions?status=pending&source=model&model=detector-v3&page=N
+func handleListSuggestions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		jsonError(w, http.StatusMethodNotAllowed, "GET only")
+		return
+	}
+	docID := r.PathValue("id")
+	q := r.URL.Query()
+
+	query := "SELECT " + suggestionColumns + " FROM suggestions WHERE document_id = $1"
+	args := []interface{}{docID}
+	if v := q.Get("status"); v != "" {
+		args = append(args, v)
+		query += fmt.Sprintf(" AND status = $%d", len(args))
+	}
+	if v := q.Get("source"); v != "" {
+		args = append(args, v)
+		query += fmt.Sprintf(" AND source = $%d", len(args))
+	}
+	if v := q.Get("model"); v != "" {
+		args = append(args, v)
+		query += fmt.Sprintf(" AND model_name = $%d", len(args))
+	}
+	if v := q.Get("model_version"); v != "" {
+		args = append(args, v)
+		query += fmt.Sprintf(" AND model_version = $%d", len(args))
+	}
+	if q.Get("page") != "" {
+		page, err := pageParam(r)
+		if err != nil {
+			jsonError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		args = append(args, page)
+		query += fmt.Sprintf(" AND page_number = $%d", len(args))
+	}
+	query += " ORDER BY page_number, created_at, id"
+
+	rows, err := pool.Query(r.Context(), query, args...)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "Query failed")
+		return
+	}
+	defer rows.Close()
+
+	suggestions := []Suggestion{}
+	for rows.Next() {
+		s, err := scanSuggestion(rows.Scan)
+		if err != nil {
+			jsonError(w, http.StatusInternalServerError, "Query failed")
+			return
+		}
+		suggestions = append(suggestions, s)
+	}
+	jsonResponse(w, http.StatusOK, map[string]interface{}{
+		"document_id": docID,
+		"suggestions": suggestions,
+	})
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"html"
+	"image/color"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ---------- SVG Overlay Export ----------
+
+func svgColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// renderOverlaySVG writes the overlay as an SVG whose user units are image pixels, so it lines up
+// exactly when scaled to the image. imageHref, when set, embeds the page image underneath.
+func renderOverlaySVG(width, height int, ov pageOverlay, imageHref string) []byte {
+	var b bytes.Buffer
+	esc := html.EscapeString
+
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`+"\n",
+		width, height, width, height)
+	if imageHref != "" {
+		fmt.Fprintf(&b, `  <image href="%s" x="0" y="0" width="%d" height="%d"/>`+"\n", esc(imageHref), width, height)
+	}
+	b.WriteString(`  <g fill="none" stroke-width="2" font-family="sans-serif" font-size="12">` + "\n")
+
+	b.WriteString(`    <g id="connections">` + "\n")
+	for _, pl := range ov.Polylines {
+		pts := make([]string, len(pl))
+		for i, p := range pl {
+			pts[i] = fmt.Sprintf("%d,%d", p.X, p.Y)
+		}
+		fmt.Fprintf(&b, `      <polyline points="%s" stroke="%s" vector-effect="non-scaling-stroke"/>`+"\n",
+			strings.Join(pts, " "), svgColor(connectionColor))
+	}
+	b.WriteString("    </g>\n")
+
+	b.WriteString(`    <g id="text_annotations">` + "\n")
+	for _, t := range ov.Text {
+		fmt.Fprintf(&b, `      <rect data-id="%s" x="%d" y="%d" width="%d" height="%d" stroke="%s" vector-effect="non-scaling-stroke"/>`+"\n",
+			esc(t.ID), t.BBox[0], t.BBox[1], t.BBox[2]-t.BBox[0], t.BBox[3]-t.BBox[1], svgColor(textColor))
+		if t.RawText != "" && !t.IsIgnored {
+			fmt.Fprintf(&b, `      <text x="%d" y="%d" fill="%s" stroke="none">%s</text>`+"\n",
+				t.BBox[0], t.BBox[1]-3, svgColor(textColor), esc(t.RawText))
+		}
+	}
+	b.WriteString("    </g>\n")
+
+	b.WriteString(`    <g id="components">` + "\n")
+	for _, c := range ov.Components {
+		col := svgColor(labelColor(c.Label))
+		fmt.Fprintf(&b, `      <rect data-id="%s" data-label="%s" x="%d" y="%d" width="%d" height="%d" stroke="%s" vector-effect="non-scaling-stroke"/>`+"\n",
+			esc(c.ID), esc(c.Label), c.BBox[0], c.BBox[1], c.BBox[2]-c.BBox[0], c.BBox[3]-c.BBox[1], col)
+		fmt.Fprintf(&b, `      <text x="%d" y="%d" fill="%s" stroke="none">%s</text>`+"\n",
+			c.BBox[0], c.BBox[1]-3, col, esc(c.Label))
+	}
+	b.WriteString("    </g>\n")
+
+	b.WriteString(`    <g id="nodes">` + "\n")
+	for _, n := range ov.Nodes {
+		fmt.Fprintf(&b, `      <circle data-id="%s" cx="%d" cy="%d" r="4" fill="%s" stroke="none"/>`+"\n",
+			esc(n.ID), n.Position[0], n.Position[1], svgColor(nodeColor))
+	}
+	b.WriteString("    </g>\n")
+
+	b.WriteString("  </g>\n</svg>\n")
+	return b.Bytes()
+}
+
+// handleOverlaySVG exports a page's annotations as an SVG layer:
+// GET /documents/{id}/overlay.svg?page=N&image=1 (image=1 embeds a link to the page image)
+func handleOverlaySVG(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		jsonError(w, http.StatusMethodNotAllowed, "GET only")
+		return
+	}
+	docID := r.PathValue("id")
+	page, err := pageParam(r)
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	sp, err := loadStoredPage(r.Context(), docID, page)
+	if errors.Is(err, sql.ErrNoRows) {
+		jsonError(w, http.StatusNotFound, "Document or page not found")
+		return
+	}
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "Query failed")
+		return
+	}
+	width, height, err := imageDimensions(sp.Path)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "Failed to read page image")
+		return
+	}
+
+	ov, err := loadPageOverlay(r.Context(), docID, page)
+	if err != nil {
+		overlayError(w, r, docID, err)
+		return
+	}
+
+	var href string
+	if r.URL.Query().Get("image") == "1" {
+		href = apiURL(r.Context(), fmt.Sprintf("/documents/%s/image?page=%d", url.PathEscape(docID), page))
+	}
+
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="%s_page_%d.svg"`, strings.ReplaceAll(docID, `"`, ""), page))
+	w.Write(renderOverlaySVG(width, height, ov, href))
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ---------- Incremental Sync ----------
+
+// Triggers on documents and the annotation tables append every insert, update, and delete to
+// change_log. Rows are only handed out once every transaction that could still write an older
+// row has finished (txid below the snapshot xmin), so a cursor never skips a late commit.
+//
+// The log keeps CHANGE_LOG_RETENTION of changes (0 keeps everything). A since from before the
+// oldest pruned change, or no since at all once anything was pruned, can't be answered from the
+// log and gets 410 SYNC_EXPIRED. The client then resyncs in full: take a fresh cursor with
+// since=now, fetch every document (GET /documents, POST /documents/batch), and continue /sync
+// from that cursor.
+
+const (
+	syncDefaultLimit = 1000
+	syncMaxLimit     = 10000
+)
+
+var (
+	changeLogRetention  = envDuration("CHANGE_LOG_RETENTION", 30*24*time.Hour)
+	changeLogPruneEvery = envDuration("CHANGE_LOG_PRUNE_INTERVAL", time.Hour)
+)
+
+// changeLogPruneBatch caps the rows one prune statement deletes, to keep its locks short
+const changeLogPruneBatch = 10000
+
+// syncCursor is the position after the last change returned, encoded as "<txid>.<seq>"
+type syncCursor struct {
+	txid uint64
+	seq  int64
+}
+
+func (c syncCursor) String() string {
+	return fmt.Sprintf("%d.%d", c.txid, c.seq)
+}
+
+func parseSyncCursor(s string) (syncCursor, error) {
+	txid, seq, ok := strings.Cut(s, ".")
+	if !ok {
+		return syncCursor{}, fmt.Errorf("invalid cursor")
+	}
+	var c syncCursor
+	var err1, err2 error
+	c.txid, err1 = strconv.ParseUint(txid, 10, 64)
+	c.seq, err2 = strconv.ParseInt(seq, 10, 64)
+	if err1 != nil || err2 != nil {
+		return syncCursor{}, fmt.Errorf("invalid cursor")
+	}
+	return c, nil
+}
+
+// less reports whether c comes before o in log order
+func (c syncCursor) less(o syncCursor) bool {
+	return c.txid < o.txid || (c.txid == o.txid && c.seq < o.seq)
+}
+
+// changeLogHorizon is the newest pruned change, if the log was ever pruned
+type changeLogHorizon struct {
+	cursor    syncCursor
+	changedAt time.Time
+}
+
+func loadChangeLogHorizon(ctx context.Context) (*changeLogHorizon, error) {
+	var h changeLogHorizon
+	var txid string
+	err := db.QueryRowContext(ctx, "SELECT txid::text, seq, changed_at FROM change_log_horizon").Scan(&txid, &h.cursor.seq, &h.changedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	h.cursor.txid, err = strconv.ParseUint(txid, 10, 64)
+	return &h, err
+}
+
+// headCursor is the position of the newest change a /sync could return now
+func headCursor(ctx context.Context, h *changeLogHorizon) (syncCursor, error) {
+	var c syncCursor
+	var txid string
+	err := db.QueryRowContext(ctx, `SELECT txid::text, seq FROM change_log
+		WHERE txid < pg_snapshot_xmin(pg_current_snapshot()) ORDER BY txid DESC, seq DESC LIMIT 1`).Scan(&txid, &c.seq)
+	if err == sql.ErrNoRows {
+		if h != nil {
+			return h.cursor, nil
+		}
+		return c, nil
+	}
+	if err != nil {
+		return c, err
+	}
+	c.txid, err = strconv.ParseUint(txid, 10, 64)
+	return c, err
+}
+
+// pruneChangeLog deletes changes older than CHANGE_LOG_RETENTION and moves the horizon past
+// them. It returns how many rows were deleted.
+func pruneChangeLog(ctx context.Context) (int64, error) {
+	var total int64
+	for {
+		var n int64
+		err := db.QueryRowContext(ctx, `
+			WITH gone AS (
+				DELETE FROM change_log WHERE seq IN (
+					SELECT seq FROM change_log
+					WHERE changed_at < now() - $1 * interval '1 second' AND txid < pg_snapshot_xmin(pg_current_snapshot())
+					ORDER BY seq LIMIT $2)
+				RETURNING txid, seq, changed_at
+			), top AS (
+				SELECT txid, seq FROM gone ORDER BY txid DESC, seq DESC LIMIT 1
+			), horizon AS (
+				INSERT INTO change_log_horizon (txid, seq, changed_at)
+				SELECT top.txid, top.seq, (SELECT max(changed_at) FROM gone) FROM top
+				ON CONFLICT (id) DO UPDATE SET
+					txid = CASE WHEN (EXCLUDED.txid, EXCLUDED.seq) > (change_log_horizon.txid, change_log_horizon.seq)
+						THEN EXCLUDED.txid ELSE change_log_horizon.txid END,
+					seq = CASE WHEN (EXCLUDED.txid, EXCLUDED.seq) > (change_log_horizon.txid, change_log_horizon.seq)
+						THEN EXCLUDED.seq ELSE change_log_horizon.seq END,
+					changed_at = GREATEST(change_log_horizon.changed_at, EXCLUDED.changed_at)
+			)
+			SELECT count(*) FROM gone`, changeLogRetention.Seconds(), changeLogPruneBatch).Scan(&n)
+		if err != nil {
+			return total, err
+		}
+		total += n
+		if n < changeLogPruneBatch || ctx.Err() != nil {
+			return total, nil
+		}
+	}
+}
+
+// runChangeLogPruner prunes change_log every CHANGE_LOG_PRUNE_INTERVAL until ctx is cancelled
+func runChangeLogPruner(ctx context.Context) {
+	if changeLogRetention <= 0 {
+		return
+	}
+	ticker := time.NewTicker(changeLogPruneEvery)
+	defer ticker.Stop()
+	for {
+		n, err := pruneChangeLog(ctx)
+		if err != nil && ctx.Err() == nil {
+			slog.Error("Pruning change log failed", "error", err)
+		} else if n > 0 {
+			slog.Info("Pruned change log", "rows", n, "retention", changeLogRetention.String())
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+type changeKey struct {
+	entity, docID, id string
+}
+
+// DeletedAnnotation is a tombstone for an annotation removed without its document
+type DeletedAnnotation struct {
+	Type       string `json:"type"` // components | nodes | connections | text_annotations
+	DocumentID string `json:"document_id"`
+	ID         string `json:"id"`
+}
+
+// handleSync returns what changed after a cursor or timestamp:
+// GET /sync?since=<cursor|RFC3339|now>&limit=1000
+// Every changed document is returned in full (replace it wholesale); deleted documents and
+// annotations are listed separately. Pass the returned cursor as since on the next call and
+// repeat while has_more is true. Omitting since replays the whole log; since=now returns no
+// changes, just the cursor of the newest one.
+func handleSync(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		jsonError(w, http.StatusMethodNotAllowed, "GET only")
+		return
+	}
+	q := r.URL.Query()
+
+	limit, err := intQueryParam(r, "limit", syncDefaultLimit)
+	if err != nil || limit < 1 || limit > syncMaxLimit {
+		jsonError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", syncMaxLimit))
+		return
+	}
+
+	horizon, err := loadChangeLogHorizon(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Sync query failed", "error", err)
+		jsonError(w, http.StatusInternalServerError, "Query failed")
+		return
+	}
+	if q.Get("since") == "now" {
+		head, err := headCursor(r.Context(), horizon)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Sync query failed", "error", err)
+			jsonError(w, http.StatusInternalServerError, "Query failed")
+			return
+		}
+		jsonResponse(w, http.StatusOK, map[string]interface{}{
+			"cursor": head.String(), "has_more": false, "changes": 0, "documents": []interface{}{},
+			"deleted_documents": []string{}, "deleted_annotations": []DeletedAnnotation{},
+		})
+		return
+	}
+
+	query := `SELECT txid::text, seq, entity, document_id, entity_id, op FROM change_log
+		WHERE txid < pg_snapshot_xmin(pg_current_snapshot())`
+	args := []interface{}{}
+	expired := false
+	if since := q.Get("since"); since != "" {
+		if t, err := time.Parse(time.RFC3339, since); err == nil {
+			expired = horizon != nil && !t.After(horizon.changedAt)
+			args = append(args, t)
+			query += " AND changed_at >= $1"
+		} else if c, err := parseSyncCursor(since); err == nil {
+			expired = horizon != nil && c.less(horizon.cursor)
+			args = append(args, strconv.FormatUint(c.txid, 10), c.seq)
+			query += " AND (txid, seq) > ($1::xid8, $2)"
+		} else {
+			jsonError(w, http.StatusBadRequest, "since must be a cursor from a previous /sync, an RFC 3339 timestamp, or now")
+			return
+		}
+	} else {
+		expired = horizon != nil
+	}
+	if expired {
+		problemError(w, http.StatusGone, codeSyncExpired, fmt.Sprintf(
+			"Changes before %s have been pruned (CHANGE_LOG_RETENTION); take a cursor with since=now and fetch every document again",
+			horizon.changedAt.UTC().Format(time.RFC3339)))
+		return
+	}
+	args = append(args, limit+1)
+	query += fmt.Sprintf(" ORDER BY txid, seq LIMIT $%d", len(args))
+
+	rows, err := db.QueryContext(r.Context(), query, args...)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Sync query failed", "error", err)
+		jsonError(w, http.StatusInternalServerError, "Query failed")
+		return
+	}
+	defer rows.Close()
+
+	// Later changes to the same row supersede earlier ones
+	latest := map[changeKey]string{}
+	var order []changeKey
+	var cursor syncCursor
+	n := 0
+	hasMore := false
+	for rows.Next() {
+		if n == limit {
+			hasMore = true
+			break
+		}
+		var txid string
+		var k changeKey
+		var op string
+		if err := rows.Scan(&txid, &cursor.seq, &k.entity, &k.docID, &k.id, &op); err != nil {
+			jsonError(w, http.StatusInternalServerError, "Query failed")
+			return
+		}
+		cursor.txid, _ = strconv.ParseUint(txid, 10, 64)
+		if _, seen := latest[k]; !seen {
+			order = append(order, k)
+		}
+		latest[k] = op
+		n++
+	}
+	rows.Close()
+
+	next := cursor.String()
+	if n == 0 && q.Get("since") != "" {
+		// Nothing new: hand the caller's position back unchanged
+		next = q.Get("since")
+	}
+
+	deletedDocs := map[string]bool{}
+	for _, k := range order {
+		if k.entity == "documents" && latest[k] == "delete" {
+			deletedDocs[k.docID] = true
+		}
+	}
+
+	documents := []interface{}{}
+	deletedDocIDs := []string{}
+	deletedAnns := []DeletedAnnotation{}
+	loaded := map[string]bool{}
+	for _, k := range order {
+		if deletedDocs[k.docID] {
+			continue
+		}
+		if k.entity != "documents" && latest[k] == "delete" {
+			deletedAnns = append(deletedAnns, DeletedAnnotation{Type: k.entity, DocumentID: k.docID, ID: k.id})
+		}
+		if loaded[k.docID] {
+			continue
+		}
+		loaded[k.docID] = true
+		doc, err := records.LoadDocument(r.Context(), k.docID, documentView{})
+		if err != nil {
+			// Deleted by a change past this page; the next call reports it
+			continue
+		}
+		body, err := documentView{}.render(r.Context(), doc)
+		if err != nil {
+			jsonError(w, http.StatusInternalServerError, "Failed to render "+k.docID)
+			return
+		}
+		documents = append(documents, body)
+	}
+	for id := range deletedDocs {
+		deletedDocIDs = append(deletedDocIDs, id)
+	}
+
+	jsonResponse(w, http.StatusOK, map[string]interface{}{
+		"cursor":              next,
+		"has_more":            hasMore,
+		"changes":             n,
+		"documents":           documents,
+		"deleted_documents":   deletedDocIDs,
+		"deleted_annotations": deletedAnns,
+	})
+}
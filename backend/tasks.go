@@ -0,0 +1,231 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ---------- Task Queue ----------
+
+// taskLease is how long a document handed out by /tasks/next stays reserved for its annotator
+var taskLease = envDuration("TASK_LEASE", 30*time.Minute)
+
+// taskSkipCooldown is how long a skipped document is held back from /tasks/next
+var taskSkipCooldown = envDuration("TASK_SKIP_COOLDOWN", time.Hour)
+
+// skipReasonMaxLength bounds the free-text reason given for a skip
+const skipReasonMaxLength = 500
+
+// claimLapsedSQL matches documents d that nobody holds: never claimed, claimed longer ago than
+// the lease, or, once the annotator's client sends heartbeats, silent for longer than the
+// heartbeat timeout. The two durations, in seconds, are bound at the given parameter numbers.
+func claimLapsedSQL(lease, timeout int) string {
+	return fmt.Sprintf(`(d.claimed_at IS NULL OR CASE WHEN d.heartbeat_at IS NULL
+		THEN d.claimed_at < now() - $%d * interval '1 second'
+		ELSE d.heartbeat_at < now() - $%d * interval '1 second' END)`, lease, timeout)
+}
+
+// unannotatedSQL matches documents without any saved annotations
+const unannotatedSQL = `NOT EXISTS (SELECT 1 FROM components c WHERE c.document_id = d.document_id)
+	AND NOT EXISTS (SELECT 1 FROM nodes n WHERE n.document_id = d.document_id)
+	AND NOT EXISTS (SELECT 1 FROM connections x WHERE x.document_id = d.document_id)
+	AND NOT EXISTS (SELECT 1 FROM text_annotations t WHERE t.document_id = d.document_id)`
+
+type Task struct {
+	DocumentID  string   `json:"document_id"`
+	ImageFile   string   `json:"image_file"`
+	Project     string   `json:"project"`
+	NumPages    int      `json:"num_pages"`
+	Uncertainty *float64 `json:"uncertainty,omitempty"`
+	Priority    int      `json:"priority"`
+	LeaseUntil  string   `json:"lease_until"`
+	DueAt       string   `json:"due_at,omitempty"` // when assigned with a due date
+}
+
+// handleNextTask reserves the next unannotated document for an annotator:
+// GET /tasks/next?project=&annotator=&order=oldest|uncertainty
+// Documents assigned to the annotator come first, soonest due first; documents assigned to
+// anyone else are never served. Then higher priority comes first. Skipped documents are held
+// back until their cooldown ends, and documents on hold or archived are not served at all.
+// order=uncertainty serves the documents the model is least sure about first; documents without
+// a score come after all scored ones. Responds 204 when nothing is left.
+func handleNextTask(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		jsonError(w, http.StatusMethodNotAllowed, "GET only")
+		return
+	}
+	q := r.URL.Query()
+
+	orderBy := "d.created_at, d.document_id"
+	switch q.Get("order") {
+	case "", "oldest":
+	case "uncertainty":
+		orderBy = "d.uncertainty DESC NULLS LAST, " + orderBy
+	default:
+		jsonError(w, http.StatusBadRequest, "order must be oldest or uncertainty")
+		return
+	}
+	orderBy = "a.document_id IS NULL, a.due_at NULLS LAST, d.priority DESC, " + orderBy
+
+	args := []interface{}{q.Get("annotator"), taskLease.Seconds(), heartbeatTimeout.Seconds()}
+	where := claimLapsedSQL(2, 3) + " AND " + unannotatedSQL + ` AND (a.document_id IS NULL OR a.assignee = $1)
+		AND (d.deferred_until IS NULL OR d.deferred_until <= now()) AND d.status = 'active'`
+	if project := q.Get("project"); project != "" {
+		args = append(args, project)
+		where += fmt.Sprintf(" AND d.project = $%d", len(args))
+	}
+
+	var t Task
+	var uncertainty sql.NullFloat64
+	var leaseUntil time.Time
+	var due sql.NullTime
+	err := db.QueryRowContext(r.Context(), `
+		UPDATE documents SET claimed_at = now(), claimed_by = NULLIF($1, ''), heartbeat_at = NULL
+		WHERE document_id = (
+			SELECT d.document_id FROM documents d LEFT JOIN assignments a ON a.document_id = d.document_id
+			WHERE `+where+`
+			ORDER BY `+orderBy+` FOR UPDATE OF d SKIP LOCKED LIMIT 1
+		)
+		RETURNING document_id, image_file, project, COALESCE(num_pages, 1), priority, uncertainty, claimed_at + $2 * interval '1 second',
+			(SELECT due_at FROM assignments a WHERE a.document_id = documents.document_id)
+	`, args...).Scan(&t.DocumentID, &t.ImageFile, &t.Project, &t.NumPages, &t.Priority, &uncertainty, &leaseUntil, &due)
+	if err == sql.ErrNoRows {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Task claim failed", "error", err)
+		jsonError(w, http.StatusInternalServerError, "Failed to claim task")
+		return
+	}
+	if uncertainty.Valid {
+		t.Uncertainty = &uncertainty.Float64
+	}
+	t.LeaseUntil = leaseUntil.UTC().Format(time.RFC3339)
+	if due.Valid {
+		t.DueAt = due.Time.UTC().Format(time.RFC3339)
+	}
+	jsonResponse(w, http.StatusOK, t)
+}
+
+type DocumentSkip struct {
+	ID        int64  `json:"id"`
+	Annotator string `json:"annotator,omitempty"`
+	Reason    string `json:"reason"`
+	SkippedAt string `json:"skipped_at"`
+}
+
+// handleSkipDocument hands a document back to the queue: POST /documents/{id}/skip?annotator=
+// with {"reason": "..."}. The annotator's claim is released and the document is held back from
+// /tasks/next for TASK_SKIP_COOLDOWN. GET lists the skips recorded for the document.
+func handleSkipDocument(w http.ResponseWriter, r *http.Request) {
+	docID := r.PathValue("id")
+	switch r.Method {
+	case http.MethodGet:
+		rows, err := readDB(r.Context()).QueryContext(r.Context(), `
+			SELECT id, COALESCE(annotator, ''), reason, skipped_at FROM document_skips
+			WHERE document_id = $1 ORDER BY skipped_at DESC`, docID)
+		if err != nil {
+			jsonError(w, http.StatusInternalServerError, "Query failed")
+			return
+		}
+		defer rows.Close()
+		skips := []DocumentSkip{}
+		for rows.Next() {
+			var s DocumentSkip
+			var at time.Time
+			if err := rows.Scan(&s.ID, &s.Annotator, &s.Reason, &at); err != nil {
+				continue
+			}
+			s.SkippedAt = at.UTC().Format(time.RFC3339)
+			skips = append(skips, s)
+		}
+		jsonResponse(w, http.StatusOK, map[string]interface{}{"document_id": docID, "skips": skips, "count": len(skips)})
+
+	case http.MethodPost:
+		var req struct {
+			Reason string `json:"reason"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+		req.Reason = strings.TrimSpace(req.Reason)
+		if req.Reason == "" || len(req.Reason) > skipReasonMaxLength {
+			jsonError(w, http.StatusBadRequest, fmt.Sprintf("reason is required and at most %d characters", skipReasonMaxLength))
+			return
+		}
+		annotator := requestUser(r)
+
+		var deferredUntil time.Time
+		err := inTx(r.Context(), "skip document", func(tx pgx.Tx) error {
+			// Only the skipping annotator's own claim is released
+			err := tx.QueryRow(r.Context(), `
+				UPDATE documents SET deferred_until = now() + $2 * interval '1 second',
+					claimed_at = CASE WHEN claimed_by IS NOT DISTINCT FROM NULLIF($3, '') THEN NULL ELSE claimed_at END,
+					heartbeat_at = CASE WHEN claimed_by IS NOT DISTINCT FROM NULLIF($3, '') THEN NULL ELSE heartbeat_at END,
+					claimed_by = CASE WHEN claimed_by IS NOT DISTINCT FROM NULLIF($3, '') THEN NULL ELSE claimed_by END
+				WHERE document_id = $1
+				RETURNING deferred_until`, docID, taskSkipCooldown.Seconds(), annotator).Scan(&deferredUntil)
+			if err != nil {
+				return err
+			}
+			_, err = tx.Exec(r.Context(), "INSERT INTO document_skips (document_id, annotator, reason) VALUES ($1, NULLIF($2, ''), $3)",
+				docID, annotator, req.Reason)
+			return err
+		})
+		if errors.Is(err, pgx.ErrNoRows) {
+			problemError(w, http.StatusNotFound, codeDocumentNotFound, "Document not found")
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Skipping document failed", "document_id", docID, "error", err)
+			jsonError(w, http.StatusInternalServerError, "Failed to skip document")
+			return
+		}
+		slog.InfoContext(r.Context(), "Document skipped", "document_id", docID, "annotator", annotator)
+		jsonResponse(w, http.StatusOK, map[string]string{
+			"status":         "skipped",
+			"document_id":    docID,
+			"deferred_until": deferredUntil.UTC().Format(time.RFC3339),
+		})
+
+	default:
+		jsonError(w, http.StatusMethodNotAllowed, "GET or POST only")
+	}
+}
+
+// handleDocumentPriority sets a document's queue priority: PUT /documents/{id}/priority with
+// {"priority": n}. Higher is served first; the default is 0.
+func handleDocumentPriority(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		jsonError(w, http.StatusMethodNotAllowed, "PUT only")
+		return
+	}
+	var req struct {
+		Priority *int `json:"priority"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Priority == nil {
+		jsonError(w, http.StatusBadRequest, "Body must be {\"priority\": <integer>}")
+		return
+	}
+	docID := r.PathValue("id")
+	res, err := db.ExecContext(r.Context(), "UPDATE documents SET priority = $2 WHERE document_id = $1", docID, *req.Priority)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "Failed to set priority")
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		problemError(w, http.StatusNotFound, codeDocumentNotFound, "Document not found")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]interface{}{"document_id": docID, "priority": *req.Priority})
+}
@@ -0,0 +1,440 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ---------- Annotation Templates ----------
+
+// A template ("stamp") is a subgraph of components, nodes, and connections cut out of a
+// document and saved under a name, so a block drawn dozens of times per page (an op-amp stage,
+// a filter) is annotated once and stamped everywhere else:
+//
+//	GET    /templates?project=                          list templates, without their graphs
+//	POST   /templates?annotator=                        save a selection of a document's page
+//	GET    /templates/{id}                              one template with its graph
+//	DELETE /templates/{id}
+//	POST   /documents/{id}/templates/{tid}/instantiate  stamp a template onto a page at x, y
+//
+// Coordinates are stored relative to the top-left corner of the selection. Every stamp gets
+// fresh annotation ids with its connections pointing at the new copies; stamped annotations have
+// provenance "template".
+
+type Template struct {
+	ID          string `json:"id"`
+	Project     string `json:"project"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	Components  int    `json:"components"`
+	Nodes       int    `json:"nodes"`
+	Connections int    `json:"connections"`
+	Graph       *Graph `json:"graph,omitempty"`
+	CreatedBy   string `json:"created_by,omitempty"`
+	CreatedAt   string `json:"created_at"`
+}
+
+// TemplateSelection is the body of POST /templates. Without connection_ids, every connection
+// between selected components and nodes is included; with it, exactly the listed ones are.
+type TemplateSelection struct {
+	Name          string   `json:"name"`
+	Project       string   `json:"project"`
+	Description   string   `json:"description"`
+	DocumentID    string   `json:"document_id"`
+	Page          int      `json:"page"`
+	ComponentIDs  []string `json:"component_ids"`
+	NodeIDs       []string `json:"node_ids"`
+	ConnectionIDs []string `json:"connection_ids"`
+}
+
+// cutTemplate copies the selected part of doc's page, moved so its top-left corner is at 0, 0,
+// and returns it with its width and height
+func cutTemplate(doc *OutputJSON, sel TemplateSelection) (Graph, int, int, error) {
+	g := Graph{Components: []Component{}, Nodes: []Node{}, Connections: []Connection{}}
+	onPage := func(page int) bool { return page == sel.Page || (page == 0 && sel.Page == 1) }
+
+	selected := map[string]bool{}
+	for _, c := range doc.Graph.Components {
+		if onPage(c.Page) && slices.Contains(sel.ComponentIDs, c.ID) {
+			g.Components = append(g.Components, Component{ID: c.ID, Label: c.Label, BBox: c.BBox})
+			selected[c.ID] = true
+		}
+	}
+	for _, n := range doc.Graph.Nodes {
+		if onPage(n.Page) && slices.Contains(sel.NodeIDs, n.ID) {
+			g.Nodes = append(g.Nodes, Node{ID: n.ID, Position: n.Position})
+			selected[n.ID] = true
+		}
+	}
+	if len(selected) < len(sel.ComponentIDs)+len(sel.NodeIDs) {
+		return g, 0, 0, fmt.Errorf("some selected components or nodes are not on page %d", sel.Page)
+	}
+	internal := func(c Connection) bool {
+		return (c.SourceID == "" || selected[c.SourceID]) && (c.TargetID == "" || selected[c.TargetID])
+	}
+	for _, c := range doc.Graph.Connections {
+		if !onPage(c.Page) {
+			continue
+		}
+		if sel.ConnectionIDs == nil {
+			if c.SourceID == "" && c.TargetID == "" || !internal(c) {
+				continue
+			}
+		} else if !slices.Contains(sel.ConnectionIDs, c.ID) {
+			continue
+		} else if !internal(c) {
+			return g, 0, 0, fmt.Errorf("connection %s leaves the selection; select both of its ends", c.ID)
+		}
+		g.Connections = append(g.Connections, Connection{ID: c.ID, SourceID: c.SourceID, TargetID: c.TargetID, Type: c.Type, Points: c.Points})
+	}
+	if sel.ConnectionIDs != nil && len(g.Connections) < len(sel.ConnectionIDs) {
+		return g, 0, 0, fmt.Errorf("some selected connections are not on page %d", sel.Page)
+	}
+
+	// Extent of every bbox, position, and line point
+	x0, y0, x1, y1 := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	extend := func(x, y float64) {
+		x0, y0, x1, y1 = min(x0, x), min(y0, y), max(x1, x), max(y1, y)
+	}
+	for _, c := range g.Components {
+		if len(c.BBox) == 4 {
+			extend(float64(c.BBox[0]), float64(c.BBox[1]))
+			extend(float64(c.BBox[2]), float64(c.BBox[3]))
+		}
+	}
+	for _, n := range g.Nodes {
+		if len(n.Position) == 2 {
+			extend(float64(n.Position[0]), float64(n.Position[1]))
+		}
+	}
+	for _, c := range g.Connections {
+		pts, _ := parsePoints(c.Points)
+		for _, p := range pts {
+			extend(p.X, p.Y)
+		}
+	}
+	if math.IsInf(x0, 1) {
+		return g, 0, 0, fmt.Errorf("selection is empty")
+	}
+
+	ox, oy := int(math.Floor(x0)), int(math.Floor(y0))
+	moveGraph(&g, -ox, -oy)
+	return g, int(math.Ceil(x1)) - ox, int(math.Ceil(y1)) - oy, nil
+}
+
+// moveGraph shifts every coordinate of g by dx, dy in place
+func moveGraph(g *Graph, dx, dy int) {
+	for i := range g.Components {
+		if b := g.Components[i].BBox; len(b) == 4 {
+			g.Components[i].BBox = []int{b[0] + dx, b[1] + dy, b[2] + dx, b[3] + dy}
+		}
+	}
+	for i := range g.Nodes {
+		if p := g.Nodes[i].Position; len(p) == 2 {
+			g.Nodes[i].Position = []int{p[0] + dx, p[1] + dy}
+		}
+	}
+	for i := range g.Connections {
+		if g.Connections[i].Points != nil {
+			g.Connections[i].Points = offsetPoints(g.Connections[i].Points, float64(-dx), float64(-dy))
+		}
+	}
+}
+
+const templateColumns = `id, project, name, description, width, height, jsonb_array_length(graph->'components'),
+	jsonb_array_length(graph->'nodes'), jsonb_array_length(graph->'connections'), COALESCE(created_by, ''), created_at`
+
+func scanTemplate(row interface{ Scan(...interface{}) error }, extra ...interface{}) (Template, error) {
+	var t Template
+	var createdAt time.Time
+	err := row.Scan(append([]interface{}{&t.ID, &t.Project, &t.Name, &t.Description, &t.Width, &t.Height,
+		&t.Components, &t.Nodes, &t.Connections, &t.CreatedBy, &createdAt}, extra...)...)
+	t.CreatedAt = createdAt.UTC().Format(time.RFC3339)
+	return t, err
+}
+
+// loadTemplate returns a template with its graph, or sql.ErrNoRows
+func loadTemplate(ctx context.Context, id string) (Template, error) {
+	var graph []byte
+	t, err := scanTemplate(db.QueryRowContext(ctx, "SELECT "+templateColumns+", graph FROM templates WHERE id = $1", id), &graph)
+	if err != nil {
+		return t, err
+	}
+	t.Graph = &Graph{}
+	return t, json.Unmarshal(graph, t.Graph)
+}
+
+// handleTemplates lists (GET) or saves (POST) templates: /templates
+func handleTemplates(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		rows, err := db.QueryContext(r.Context(), "SELECT "+templateColumns+" FROM templates WHERE $1 = '' OR project = $1 ORDER BY project, name",
+			r.URL.Query().Get("project"))
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Listing templates failed", "error", err)
+			jsonError(w, http.StatusInternalServerError, "Query failed")
+			return
+		}
+		defer rows.Close()
+		templates := []Template{}
+		for rows.Next() {
+			t, err := scanTemplate(rows)
+			if err != nil {
+				continue
+			}
+			templates = append(templates, t)
+		}
+		jsonResponse(w, http.StatusOK, map[string]interface{}{"templates": templates, "count": len(templates)})
+
+	case http.MethodPost:
+		var sel TemplateSelection
+		if err := json.NewDecoder(r.Body).Decode(&sel); err != nil {
+			jsonError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+		if sel.Name == "" || sel.DocumentID == "" {
+			jsonError(w, http.StatusBadRequest, "name and document_id are required")
+			return
+		}
+		if sel.Project == "" {
+			sel.Project = defaultProject
+		}
+		if sel.Page == 0 {
+			sel.Page = 1
+		}
+
+		doc, err := records.LoadDocument(r.Context(), sel.DocumentID, documentView{})
+		if err != nil {
+			problemError(w, http.StatusNotFound, codeDocumentNotFound, "Document not found")
+			return
+		}
+		g, width, height, err := cutTemplate(doc, sel)
+		if err != nil {
+			jsonError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		t := Template{
+			ID: newID(), Project: sel.Project, Name: sel.Name, Description: sel.Description,
+			Width: width, Height: height, Graph: &g, CreatedBy: requestUser(r),
+			Components: len(g.Components), Nodes: len(g.Nodes), Connections: len(g.Connections),
+		}
+		graph, err := json.Marshal(g)
+		if err != nil {
+			jsonError(w, http.StatusInternalServerError, "Failed to save template")
+			return
+		}
+		var createdAt time.Time
+		err = db.QueryRowContext(r.Context(), `
+			INSERT INTO templates (id, project, name, description, width, height, graph, created_by)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, ''))
+			ON CONFLICT (project, name) DO NOTHING
+			RETURNING created_at`,
+			t.ID, t.Project, t.Name, t.Description, t.Width, t.Height, string(graph), t.CreatedBy).Scan(&createdAt)
+		if err == sql.ErrNoRows {
+			jsonError(w, http.StatusConflict, fmt.Sprintf("Project %s already has a template named %q", t.Project, t.Name))
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Saving template failed", "name", t.Name, "error", err)
+			jsonError(w, http.StatusInternalServerError, "Failed to save template")
+			return
+		}
+		t.CreatedAt = createdAt.UTC().Format(time.RFC3339)
+
+		slog.InfoContext(r.Context(), "Template saved", "template_id", t.ID, "name", t.Name, "document_id", sel.DocumentID,
+			"components", t.Components, "nodes", t.Nodes, "connections", t.Connections)
+		jsonResponse(w, http.StatusCreated, t)
+
+	default:
+		jsonError(w, http.StatusMethodNotAllowed, "GET or POST only")
+	}
+}
+
+// handleTemplate returns (GET) or deletes (DELETE) one template: /templates/{id}
+func handleTemplate(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	switch r.Method {
+	case http.MethodGet:
+		t, err := loadTemplate(r.Context(), id)
+		if err == sql.ErrNoRows {
+			jsonError(w, http.StatusNotFound, "Template not found")
+			return
+		}
+		if err != nil {
+			jsonError(w, http.StatusInternalServerError, "Query failed")
+			return
+		}
+		jsonResponse(w, http.StatusOK, t)
+
+	case http.MethodDelete:
+		res, err := db.ExecContext(r.Context(), "DELETE FROM templates WHERE id = $1", id)
+		if err != nil {
+			jsonError(w, http.StatusInternalServerError, "Failed to delete template")
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			jsonError(w, http.StatusNotFound, "Template not found")
+			return
+		}
+		jsonResponse(w, http.StatusOK, map[string]string{"status": "success"})
+
+	default:
+		jsonError(w, http.StatusMethodNotAllowed, "GET or DELETE only")
+	}
+}
+
+// handleInstantiateTemplate stamps a template onto a document page with its top-left corner at
+// x, y: POST /documents/{id}/templates/{tid}/instantiate
+// The stamp must fit on the page. The response is the graph that was added, with its new ids.
+func handleInstantiateTemplate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		jsonError(w, http.StatusMethodNotAllowed, "POST only")
+		return
+	}
+	docID, templateID := r.PathValue("id"), r.PathValue("tid")
+	var req struct {
+		Page     int    `json:"page"`
+		X        int    `json:"x"`
+		Y        int    `json:"y"`
+		RegionID string `json:"region_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+	if req.Page == 0 {
+		req.Page = 1
+	}
+
+	t, err := loadTemplate(r.Context(), templateID)
+	if err == sql.ErrNoRows {
+		jsonError(w, http.StatusNotFound, "Template not found")
+		return
+	}
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "Query failed")
+		return
+	}
+	numPages, err := records.PageCount(r.Context(), docID)
+	if err != nil {
+		problemError(w, http.StatusNotFound, codeDocumentNotFound, "Document not found")
+		return
+	}
+	if req.Page < 1 || req.Page > numPages {
+		problemError(w, http.StatusUnprocessableEntity, codeInvalidPage, fmt.Sprintf("page must be between 1 and %d", numPages))
+		return
+	}
+	sizes, err := records.PageSizes(r.Context(), docID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "Failed to load page sizes")
+		return
+	}
+	if size, ok := sizes[req.Page]; ok {
+		if req.X < 0 || req.Y < 0 || req.X+t.Width > size.Width || req.Y+t.Height > size.Height {
+			problemError(w, http.StatusUnprocessableEntity, codeInvalidBBox, fmt.Sprintf(
+				"a %dx%d template at %d, %d does not fit on the %dx%d page", t.Width, t.Height, req.X, req.Y, size.Width, size.Height))
+			return
+		}
+	}
+
+	// Fresh ids, with connections rewired to the copies
+	g := *t.Graph
+	moveGraph(&g, req.X, req.Y)
+	ids := map[string]string{}
+	for i := range g.Components {
+		ids[g.Components[i].ID] = newID()
+		g.Components[i].ID = ids[g.Components[i].ID]
+	}
+	for i := range g.Nodes {
+		ids[g.Nodes[i].ID] = newID()
+		g.Nodes[i].ID = ids[g.Nodes[i].ID]
+	}
+	for i := range g.Connections {
+		c := &g.Connections[i]
+		c.ID, c.SourceID, c.TargetID = newID(), ids[c.SourceID], ids[c.TargetID]
+	}
+
+	err = inTx(r.Context(), "instantiate_template", func(tx pgx.Tx) error {
+		if req.RegionID != "" {
+			var exists bool
+			if err := tx.QueryRow(r.Context(), "SELECT EXISTS (SELECT 1 FROM regions WHERE document_id = $1 AND id = $2 AND page_number = $3)",
+				docID, req.RegionID, req.Page).Scan(&exists); err != nil {
+				return err
+			}
+			if !exists {
+				return &FieldError{Field: "region_id", Code: codeInvalidRegion, Message: fmt.Sprintf("%s is not a region on page %d", req.RegionID, req.Page)}
+			}
+		}
+		// Serializes with /submit, which replaces the document's annotations wholesale
+		if _, err := tx.Exec(r.Context(), "SELECT 1 FROM documents WHERE document_id = $1 FOR UPDATE", docID); err != nil {
+			return err
+		}
+		for _, c := range g.Components {
+			if _, err := tx.Exec(r.Context(),
+				"INSERT INTO components (id, document_id, label, bbox, page_number, provenance, region_id) VALUES ($1, $2, $3, $4, $5, 'template', NULLIF($6, ''))",
+				c.ID, docID, c.Label, c.BBox, req.Page, req.RegionID); err != nil {
+				return err
+			}
+		}
+		for _, n := range g.Nodes {
+			if _, err := tx.Exec(r.Context(),
+				"INSERT INTO nodes (id, document_id, position, page_number, provenance, region_id) VALUES ($1, $2, $3, $4, 'template', NULLIF($5, ''))",
+				n.ID, docID, n.Position, req.Page, req.RegionID); err != nil {
+				return err
+			}
+		}
+		for _, c := range g.Connections {
+			if _, err := tx.Exec(r.Context(),
+				"INSERT INTO connections (id, document_id, source_id, target_id, type, points, page_number, provenance, region_id) VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7, 'template', NULLIF($8, ''))",
+				c.ID, docID, c.SourceID, c.TargetID, c.Type, c.Points, req.Page, req.RegionID); err != nil {
+				return err
+			}
+		}
+		return enqueueEvents(r.Context(), tx, newEvent("annotations.stamped", docID, map[string]interface{}{
+			"template_id": t.ID, "page": req.Page,
+			"components": len(g.Components), "nodes": len(g.Nodes), "connections": len(g.Connections),
+		}))
+	})
+	var fe *FieldError
+	if errors.As(err, &fe) {
+		problemError(w, http.StatusBadRequest, fe.Code, fe.Error())
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Instantiating template failed", "document_id", docID, "template_id", t.ID, "error", err)
+		jsonError(w, http.StatusInternalServerError, "Failed to instantiate template")
+		return
+	}
+	documentCache.forget(docID)
+
+	for i := range g.Components {
+		g.Components[i].Page, g.Components[i].RegionID, g.Components[i].Provenance = req.Page, req.RegionID, "template"
+	}
+	for i := range g.Nodes {
+		g.Nodes[i].Page, g.Nodes[i].RegionID, g.Nodes[i].Provenance = req.Page, req.RegionID, "template"
+	}
+	for i := range g.Connections {
+		g.Connections[i].Page, g.Connections[i].RegionID, g.Connections[i].Provenance = req.Page, req.RegionID, "template"
+	}
+	slog.InfoContext(r.Context(), "Template instantiated", "document_id", docID, "template_id", t.ID, "page", req.Page, "x", req.X, "y", req.Y)
+	jsonResponse(w, http.StatusCreated, map[string]interface{}{
+		"status":      "success",
+		"document_id": docID,
+		"template_id": t.ID,
+		"page":        req.Page,
+		"graph":       g,
+	})
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"log/slog"
+	"net/http"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// ---------- Thumbnails ----------
+
+var thumbnailSize = envInt("THUMBNAIL_SIZE", 256) // longest edge in pixels
+
+// makeThumbnail scales img to fit thumbnailSize and stores it as a JPEG object
+func makeThumbnail(img image.Image) (StoredObject, error) {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w > thumbnailSize || h > thumbnailSize {
+		if w >= h {
+			w, h = thumbnailSize, max(1, h*thumbnailSize/w)
+		} else {
+			w, h = max(1, w*thumbnailSize/h), thumbnailSize
+		}
+	}
+
+	thumb := image.NewRGBA(image.Rect(0, 0, w, h))
+	xdraw.BiLinear.Scale(thumb, thumb.Bounds(), img, b, xdraw.Src, nil)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: 80}); err != nil {
+		return StoredObject{}, fmt.Errorf("encoding thumbnail: %w", err)
+	}
+	return storeObject(&buf, ".jpg")
+}
+
+// ensureThumbnail returns the document's thumbnail key, generating it from page 1 for documents
+// uploaded before thumbnails existed
+func ensureThumbnail(ctx context.Context, docID string) (string, error) {
+	key, err := records.ThumbnailKey(ctx, docID)
+	if err != nil || key != "" {
+		return key, err
+	}
+
+	page, err := loadStoredPage(ctx, docID, 1)
+	if err != nil {
+		return "", err
+	}
+	img, err := decodeImageFile(page.Path)
+	if err != nil {
+		return "", err
+	}
+
+	obj, err := makeThumbnail(img)
+	if err != nil {
+		return "", err
+	}
+	if err := records.SetThumbnailKey(ctx, docID, obj.Key); err != nil {
+		return "", err
+	}
+	return obj.Key, nil
+}
+
+// ThumbnailKey returns the document's thumbnail key, "" if it has none yet, or sql.ErrNoRows
+func (postgresRecords) ThumbnailKey(ctx context.Context, docID string) (string, error) {
+	var key sql.NullString
+	err := db.QueryRowContext(ctx, "SELECT thumbnail_key FROM documents WHERE document_id = $1", docID).Scan(&key)
+	return key.String, err
+}
+
+func (postgresRecords) SetThumbnailKey(ctx context.Context, docID, key string) error {
+	_, err := db.ExecContext(ctx, "UPDATE documents SET thumbnail_key = $1 WHERE document_id = $2", key, docID)
+	return err
+}
+
+// handleDocumentThumbnail serves a small JPEG preview of page 1: GET /documents/{id}/thumbnail
+func handleDocumentThumbnail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		jsonError(w, http.StatusMethodNotAllowed, "GET only")
+		return
+	}
+	docID := r.PathValue("id")
+
+	key, err := ensureThumbnail(r.Context(), docID)
+	if errors.Is(err, sql.ErrNoRows) {
+		problemError(w, http.StatusNotFound, codeDocumentNotFound, "Document not found")
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Thumbnail failed", "document_id", docID, "error", err)
+		jsonError(w, http.StatusInternalServerError, "Failed to generate thumbnail")
+		return
+	}
+
+	// Object keys are content hashes, so the hash doubles as a strong ETag
+	serveObject(w, r, key, "thumbnail.jpg")
+}
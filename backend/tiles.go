@@ -0,0 +1,233 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// ---------- Deep-Zoom Tiles ----------
+
+// Tiles follow the usual z/x/y scheme: zoom level maxZoom is full resolution and each level
+// below halves the image, down to level 0 where the whole page fits in one tile.
+// A page's full pyramid is cut the first time any of its tiles is requested, then served from
+// dataset/tiles/<key>/<z>/<x>_<y>.jpg.
+var tileSize = envInt("TILE_SIZE", 256)
+
+const tilesDir = "tiles"
+
+// tileBuildLocks serializes pyramid builds per page so concurrent viewers don't all decode the scan
+var tileBuildLocks sync.Map
+
+type tilePyramid struct {
+	Width    int `json:"width"`
+	Height   int `json:"height"`
+	TileSize int `json:"tile_size"`
+	MaxZoom  int `json:"max_zoom"`
+}
+
+func newTilePyramid(w, h int) tilePyramid {
+	z := 0
+	if longest := max(w, h); longest > tileSize {
+		z = int(math.Ceil(math.Log2(float64(longest) / float64(tileSize))))
+	}
+	return tilePyramid{Width: w, Height: h, TileSize: tileSize, MaxZoom: z}
+}
+
+// tileCacheKey names a page's tile directory: its content hash, or a hash of its identity for
+// pages stored before content addressing
+func tileCacheKey(docID string, page int, sp storedPage) string {
+	if sp.SHA256 != "" {
+		return fmt.Sprintf("%s-%d", sp.SHA256, tileSize)
+	}
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%d\x00%s", docID, page, sp.Path)))
+	return fmt.Sprintf("legacy-%s-%d", hex.EncodeToString(sum[:16]), tileSize)
+}
+
+// ensureTiles builds the tile pyramid for a page image if it isn't cached yet
+func ensureTiles(key, imagePath string) (string, error) {
+	dir := filepath.Join(datasetDir, tilesDir, key)
+	if _, err := os.Stat(dir); err == nil {
+		return dir, nil
+	}
+
+	mu, _ := tileBuildLocks.LoadOrStore(key, &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+	defer mu.(*sync.Mutex).Unlock()
+	if _, err := os.Stat(dir); err == nil {
+		return dir, nil // built while we waited
+	}
+
+	img, err := decodeImageFile(imagePath)
+	if err != nil {
+		return "", err
+	}
+
+	// Build into a scratch directory and rename, so a half-built pyramid is never served
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return "", err
+	}
+	scratch, err := os.MkdirTemp(filepath.Dir(dir), ".build-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(scratch)
+
+	start := time.Now()
+	if err := buildTiles(img, scratch); err != nil {
+		return "", err
+	}
+	if err := os.Rename(scratch, dir); err != nil {
+		return "", err
+	}
+	slog.Info("Built tile pyramid", "key", key, "duration_ms", time.Since(start).Milliseconds())
+	return dir, nil
+}
+
+// buildTiles writes every tile of every zoom level into dir
+func buildTiles(img image.Image, dir string) error {
+	b := img.Bounds()
+	pyr := newTilePyramid(b.Dx(), b.Dy())
+
+	level := img
+	for z := pyr.MaxZoom; z >= 0; z-- {
+		lb := level.Bounds()
+		if err := os.MkdirAll(filepath.Join(dir, strconv.Itoa(z)), 0755); err != nil {
+			return err
+		}
+		for ty := 0; ty*tileSize < lb.Dy(); ty++ {
+			for tx := 0; tx*tileSize < lb.Dx(); tx++ {
+				r := image.Rect(tx*tileSize, ty*tileSize, (tx+1)*tileSize, (ty+1)*tileSize).Add(lb.Min).Intersect(lb)
+				if err := writeTile(filepath.Join(dir, strconv.Itoa(z), fmt.Sprintf("%d_%d.jpg", tx, ty)), subImage(level, r)); err != nil {
+					return err
+				}
+			}
+		}
+
+		if z > 0 {
+			half := image.NewRGBA(image.Rect(0, 0, (lb.Dx()+1)/2, (lb.Dy()+1)/2))
+			xdraw.ApproxBiLinear.Scale(half, half.Bounds(), level, lb, xdraw.Src, nil)
+			level = half
+		}
+	}
+	return nil
+}
+
+// subImage crops img to r, copying only when the image type has no SubImage method
+func subImage(img image.Image, r image.Rectangle) image.Image {
+	if s, ok := img.(interface {
+		SubImage(image.Rectangle) image.Image
+	}); ok {
+		return s.SubImage(r)
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, r.Dx(), r.Dy()))
+	xdraw.Copy(dst, image.Point{}, img, r, xdraw.Src, nil)
+	return dst
+}
+
+func writeTile(path string, img image.Image) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := jpeg.Encode(f, img, &jpeg.Options{Quality: 85}); err != nil {
+		f.Close()
+		return fmt.Errorf("encoding tile: %w", err)
+	}
+	return f.Close()
+}
+
+// loadTilePage resolves the page a tile request refers to, writing the error response itself
+func loadTilePage(w http.ResponseWriter, r *http.Request) (storedPage, int, bool) {
+	page, err := pageParam(r)
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return storedPage{}, 0, false
+	}
+	sp, err := loadStoredPage(r.Context(), r.PathValue("id"), page)
+	if errors.Is(err, sql.ErrNoRows) {
+		jsonError(w, http.StatusNotFound, "Document or page not found")
+		return storedPage{}, 0, false
+	}
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "Query failed")
+		return storedPage{}, 0, false
+	}
+	return sp, page, true
+}
+
+// handleTileInfo describes a page's tile pyramid for tiled viewers: GET /documents/{id}/tiles?page=N
+func handleTileInfo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		jsonError(w, http.StatusMethodNotAllowed, "GET only")
+		return
+	}
+	sp, page, ok := loadTilePage(w, r)
+	if !ok {
+		return
+	}
+	width, height, err := imageDimensions(sp.Path)
+	if err != nil {
+		jsonError(w, http.StatusNotFound, "Image file missing")
+		return
+	}
+
+	docID := r.PathValue("id")
+	jsonResponse(w, http.StatusOK, map[string]interface{}{
+		"document_id":  docID,
+		"page":         page,
+		"pyramid":      newTilePyramid(width, height),
+		"format":       "jpg",
+		"url_template": apiURL(r.Context(), fmt.Sprintf("/documents/%s/tiles/{z}/{x}/{y}?page=%d", url.PathEscape(docID), page)),
+	})
+}
+
+// handleTile serves one tile: GET /documents/{id}/tiles/{z}/{x}/{y}?page=N
+func handleTile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		jsonError(w, http.StatusMethodNotAllowed, "GET only")
+		return
+	}
+	z, errZ := strconv.Atoi(r.PathValue("z"))
+	x, errX := strconv.Atoi(r.PathValue("x"))
+	y, errY := strconv.Atoi(strings.TrimSuffix(r.PathValue("y"), ".jpg"))
+	if errZ != nil || errX != nil || errY != nil || z < 0 || x < 0 || y < 0 {
+		jsonError(w, http.StatusBadRequest, "z, x, and y must be non-negative integers")
+		return
+	}
+
+	sp, page, ok := loadTilePage(w, r)
+	if !ok {
+		return
+	}
+	key := tileCacheKey(r.PathValue("id"), page, sp)
+	dir, err := ensureTiles(key, sp.Path)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Tile build failed", "key", key, "error", err)
+		jsonError(w, http.StatusInternalServerError, "Failed to build tiles")
+		return
+	}
+
+	tilePath := filepath.Join(dir, strconv.Itoa(z), fmt.Sprintf("%d_%d.jpg", x, y))
+	if _, err := os.Stat(tilePath); err != nil {
+		jsonError(w, http.StatusNotFound, "Tile out of range")
+		return
+	}
+	serveStoredFile(w, r, tilePath, "tile.jpg", fmt.Sprintf("%s-%d-%d-%d", key, z, x, y))
+}
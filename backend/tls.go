@@ -0,0 +1,140 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// ---------- TLS ----------
+
+// The backend serves HTTPS itself when given a certificate (TLS_CERT_FILE and TLS_KEY_FILE) or
+// domains to obtain one for from Let's Encrypt (ACME_DOMAINS). It then listens on TLS_ADDR, and
+// TLS_REDIRECT_ADDR answers plain HTTP with a redirect to HTTPS (and the ACME HTTP-01
+// challenges); set it empty to turn that listener off. Without either setting nothing changes.
+var (
+	tlsCertFile     = envString("TLS_CERT_FILE", "")
+	tlsKeyFile      = envString("TLS_KEY_FILE", "")
+	tlsAddr         = envString("TLS_ADDR", ":443")
+	tlsRedirectAddr = envString("TLS_REDIRECT_ADDR", ":80")
+	acmeDomains     = parseCSV(envString("ACME_DOMAINS", ""))
+	acmeEmail       = envString("ACME_EMAIL", "")
+	// Issued certificates and the account key; keep it on a volume so restarts don't hit rate limits
+	acmeCacheDir = envString("ACME_CACHE_DIR", "autocert-cache")
+)
+
+// configureTLS switches server to HTTPS when TLS is configured and returns the HTTP listener that
+// redirects to it, or nil
+func configureTLS(server *http.Server) (*http.Server, error) {
+	redirect := http.Handler(http.HandlerFunc(redirectToHTTPS))
+	switch {
+	case len(acmeDomains) > 0:
+		if tlsCertFile != "" || tlsKeyFile != "" {
+			return nil, errors.New("set either ACME_DOMAINS or TLS_CERT_FILE/TLS_KEY_FILE, not both")
+		}
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(acmeDomains...),
+			Cache:      autocert.DirCache(acmeCacheDir),
+			Email:      acmeEmail,
+		}
+		server.TLSConfig = m.TLSConfig()
+		redirect = m.HTTPHandler(redirect)
+	case tlsCertFile != "" || tlsKeyFile != "":
+		if tlsCertFile == "" || tlsKeyFile == "" {
+			return nil, errors.New("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+		}
+		certs := &certReloader{certFile: tlsCertFile, keyFile: tlsKeyFile}
+		if _, err := certs.GetCertificate(nil); err != nil {
+			return nil, err
+		}
+		server.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12, GetCertificate: certs.GetCertificate}
+	default:
+		return nil, nil
+	}
+
+	server.Addr = tlsAddr
+	if tlsRedirectAddr == "" {
+		return nil, nil
+	}
+	return &http.Server{
+		Addr:         tlsRedirectAddr,
+		Handler:      redirect,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}, nil
+}
+
+// redirectToHTTPS sends a plain HTTP request to the same URL on the HTTPS listener. 308 keeps
+// the method and body of uploads and submits.
+func redirectToHTTPS(w http.ResponseWriter, r *http.Request) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if _, p, err := net.SplitHostPort(tlsAddr); err == nil && p != "443" {
+		host = net.JoinHostPort(host, p)
+	}
+	status := http.StatusPermanentRedirect
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		status = http.StatusMovedPermanently
+	}
+	http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), status)
+}
+
+// certReloader serves the certificate from disk and reloads it when the files change, so a
+// renewal (certbot, cert-manager) is picked up without a restart
+type certReloader struct {
+	certFile, keyFile string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+	checked time.Time
+}
+
+// certCheckInterval limits how often the certificate files are stat'ed
+const certCheckInterval = time.Minute
+
+func (c *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cert != nil && time.Since(c.checked) < certCheckInterval {
+		return c.cert, nil
+	}
+	c.checked = time.Now()
+
+	modTime := c.modTime
+	for _, f := range []string{c.certFile, c.keyFile} {
+		info, err := os.Stat(f)
+		if err != nil {
+			if c.cert != nil {
+				return c.cert, nil // keep serving the last good certificate
+			}
+			return nil, err
+		}
+		if info.ModTime().After(modTime) {
+			modTime = info.ModTime()
+		}
+	}
+	if c.cert != nil && !modTime.After(c.modTime) {
+		return c.cert, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		if c.cert != nil {
+			return c.cert, nil
+		}
+		return nil, fmt.Errorf("loading TLS certificate: %w", err)
+	}
+	c.cert, c.modTime = &cert, modTime
+	return c.cert, nil
+}
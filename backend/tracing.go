@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ---------- Tracing ----------
+
+// Spans are exported over OTLP when an endpoint is set with the standard OpenTelemetry variables
+// (OTEL_EXPORTER_OTLP_ENDPOINT or OTEL_EXPORTER_OTLP_TRACES_ENDPOINT). OTEL_EXPORTER_OTLP_PROTOCOL
+// picks grpc or http/protobuf (the default); OTEL_SERVICE_NAME, OTEL_RESOURCE_ATTRIBUTES, and
+// OTEL_TRACES_SAMPLER are read by the SDK. Without an endpoint the global no-op tracer is left
+// in place and instrumentation costs next to nothing.
+
+const tracingServiceName = "corvina-backend"
+
+// initTracing installs the OTLP tracer provider and W3C trace-context propagation. The returned
+// function flushes buffered spans.
+func initTracing(ctx context.Context) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	protocol := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_PROTOCOL")
+	if protocol == "" {
+		protocol = os.Getenv("OTEL_EXPORTER_OTLP_PROTOCOL")
+	}
+	if protocol == "" {
+		protocol = "http/protobuf"
+	}
+	var exp *otlptrace.Exporter
+	var err error
+	if protocol == "grpc" {
+		exp, err = otlptracegrpc.New(ctx)
+	} else {
+		exp, err = otlptracehttp.New(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Later options win, so OTEL_SERVICE_NAME overrides the default name
+	res, err := resource.New(ctx,
+		resource.WithAttributes(attribute.String("service.name", tracingServiceName)),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+		resource.WithHost(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exp), sdktrace.WithResource(res))
+	otel.SetTracerProvider(tp)
+	slog.Info("Exporting spans over OTLP", "protocol", protocol)
+	return tp.Shutdown, nil
+}
+
+// dbTracer gives every query made with a traced request's context its own client span. Queries
+// outside a request (workers, startup) have no trace to join and are left out.
+type dbTracer struct{}
+
+type dbSpanKey struct{}
+
+func (dbTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return ctx
+	}
+	ctx, span := otel.Tracer(tracingServiceName).Start(ctx, queryOperation(data.SQL),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("db.system", "postgresql"), attribute.String("db.statement", data.SQL)),
+	)
+	return context.WithValue(ctx, dbSpanKey{}, span)
+}
+
+func (dbTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	span, ok := ctx.Value(dbSpanKey{}).(trace.Span)
+	if !ok {
+		return
+	}
+	if data.Err != nil && !errors.Is(data.Err, pgx.ErrNoRows) {
+		span.RecordError(data.Err)
+		span.SetStatus(codes.Error, data.Err.Error())
+	} else {
+		span.SetAttributes(attribute.Int64("db.rows_affected", data.CommandTag.RowsAffected()))
+	}
+	span.End()
+}
+
+// queryOperation names a span after the statement's first keyword (SELECT, UPDATE, ...)
+func queryOperation(sql string) string {
+	fields := strings.Fields(sql)
+	if len(fields) == 0 {
+		return "db.query"
+	}
+	return strings.ToUpper(fields[0])
+}
+
+// tracingMiddleware starts a server span for each request, continuing the caller's trace when
+// it sends a traceparent header. Spans are named after the mux pattern once routing is done.
+func tracingMiddleware(next http.Handler) http.Handler {
+	routed := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r)
+		if r.Pattern != "" {
+			trace.SpanFromContext(r.Context()).SetAttributes(attribute.String("http.route", r.Pattern))
+		}
+	})
+	return otelhttp.NewHandler(routed, "http.request",
+		otelhttp.WithSpanNameFormatter(func(operation string, r *http.Request) string {
+			if r.Pattern != "" {
+				return r.Pattern
+			}
+			return operation
+		}),
+	)
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ---------- Resumable Uploads (tus) ----------
+
+// Implements tus 1.0.0 (https://tus.io/protocols/resumable-upload) with the creation,
+// termination, and expiration extensions. Partial data is kept under dataset/uploads until the
+// last byte arrives, then the file goes through registerUpload like a regular /upload.
+
+const tusVersion = "1.0.0"
+
+var (
+	tusMaxBytes = int64(envInt("TUS_MAX_MB", 512)) << 20
+	// Unfinished uploads are deleted this long after they were created
+	tusExpiry = envDuration("TUS_EXPIRY", 24*time.Hour)
+	// How long a single PATCH may take; clients resume from the stored offset when it runs out
+	tusPatchTimeout = envDuration("TUS_PATCH_TIMEOUT", 10*time.Minute)
+)
+
+const tusUploadsDir = "uploads"
+
+// tusLocks serializes PATCH requests per upload within this instance
+var tusLocks sync.Map
+
+type tusUpload struct {
+	ID         string
+	Filename   string
+	Project    string
+	Uploader   string
+	QuotaUser  string
+	Length     int64
+	DocumentID string
+	ExpiresAt  time.Time
+}
+
+func tusPath(id string) string {
+	return filepath.Join(datasetDir, tusUploadsDir, id)
+}
+
+// tusOffset is the number of bytes received so far, which is the size of the partial file
+func tusOffset(id string) (int64, error) {
+	info, err := os.Stat(tusPath(id))
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+func loadTusUpload(ctx context.Context, id string) (tusUpload, error) {
+	u := tusUpload{ID: id}
+	err := db.QueryRowContext(ctx, "SELECT filename, project, COALESCE(uploaded_by, ''), COALESCE(quota_user, ''), length, COALESCE(document_id, ''), expires_at FROM tus_uploads WHERE id = $1", id).
+		Scan(&u.Filename, &u.Project, &u.Uploader, &u.QuotaUser, &u.Length, &u.DocumentID, &u.ExpiresAt)
+	return u, err
+}
+
+// parseTusMetadata decodes an Upload-Metadata header: comma-separated "key base64value" pairs
+func parseTusMetadata(header string) (map[string]string, error) {
+	meta := map[string]string{}
+	for _, pair := range strings.Split(header, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, enc, _ := strings.Cut(pair, " ")
+		v, err := base64.StdEncoding.DecodeString(enc)
+		if err != nil {
+			return nil, fmt.Errorf("metadata %q is not base64", key)
+		}
+		meta[key] = string(v)
+	}
+	return meta, nil
+}
+
+// tusError writes a plain-text error; tus clients show the body but don't parse JSON
+func tusError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(status)
+	io.WriteString(w, msg+"\n")
+}
+
+// handleTusCreate answers capability discovery (OPTIONS) and creates uploads (POST):
+// POST /uploads/tus with Upload-Length and Upload-Metadata: filename <b64>,project <b64>
+func handleTusCreate(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	if r.Method == http.MethodOptions {
+		w.Header().Set("Tus-Version", tusVersion)
+		w.Header().Set("Tus-Extension", "creation,termination,expiration")
+		w.Header().Set("Tus-Max-Size", strconv.FormatInt(tusMaxBytes, 10))
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodPost {
+		tusError(w, http.StatusMethodNotAllowed, "POST or OPTIONS only")
+		return
+	}
+	if r.Header.Get("Tus-Resumable") != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		tusError(w, http.StatusPreconditionFailed, "Unsupported Tus-Resumable version")
+		return
+	}
+
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length <= 0 {
+		tusError(w, http.StatusBadRequest, "Upload-Length must be a positive integer")
+		return
+	}
+	if length > tusMaxBytes {
+		tusError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Upload exceeds the %d MB limit", tusMaxBytes>>20))
+		return
+	}
+	meta, err := parseTusMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		tusError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	filename := filepath.Base(meta["filename"])
+	if meta["filename"] == "" || filename == "." || filename == "/" {
+		tusError(w, http.StatusBadRequest, "Upload-Metadata must include filename")
+		return
+	}
+	project := strings.TrimSpace(meta["project"])
+	if project == "" {
+		project = defaultProject
+	}
+	// Checked again on completion; refusing here saves sending the file for nothing
+	if err := checkQuotas(r.Context(), newDocumentID(filename), project, quotaUser(r)); err != nil {
+		var qe *QuotaError
+		if errors.As(err, &qe) {
+			tusError(w, qe.status(), qe.Error())
+			return
+		}
+		slog.ErrorContext(r.Context(), "tus create failed", "error", err)
+		tusError(w, http.StatusInternalServerError, "Failed to create upload")
+		return
+	}
+
+	removeExpiredTusUploads(r.Context())
+
+	id := newID()
+	if err := os.MkdirAll(filepath.Join(datasetDir, tusUploadsDir), 0755); err != nil {
+		tusError(w, http.StatusInternalServerError, "Failed to create upload")
+		return
+	}
+	f, err := os.Create(tusPath(id))
+	if err != nil {
+		tusError(w, http.StatusInternalServerError, "Failed to create upload")
+		return
+	}
+	f.Close()
+
+	expires := time.Now().Add(tusExpiry)
+	_, err = db.ExecContext(r.Context(), "INSERT INTO tus_uploads (id, filename, project, uploaded_by, quota_user, length, expires_at) VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6, $7)",
+		id, filename, project, requestUser(r), quotaUser(r), length, expires)
+	if err != nil {
+		os.Remove(tusPath(id))
+		slog.ErrorContext(r.Context(), "tus create failed", "error", err)
+		tusError(w, http.StatusInternalServerError, "Failed to create upload")
+		return
+	}
+
+	w.Header().Set("Location", apiURL(r.Context(), "/uploads/tus/"+id))
+	w.Header().Set("Upload-Expires", expires.UTC().Format(http.TimeFormat))
+	w.WriteHeader(http.StatusCreated)
+}
+
+// handleTusUpload reports (HEAD), appends to (PATCH), or cancels (DELETE) an upload:
+// /uploads/tus/{id}
+func handleTusUpload(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	if r.Method == http.MethodOptions {
+		w.Header().Set("Tus-Version", tusVersion)
+		w.Header().Set("Tus-Extension", "creation,termination,expiration")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Header.Get("Tus-Resumable") != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		tusError(w, http.StatusPreconditionFailed, "Unsupported Tus-Resumable version")
+		return
+	}
+
+	id := r.PathValue("id")
+	u, err := loadTusUpload(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && time.Now().After(u.ExpiresAt) && u.DocumentID == "") {
+		tusError(w, http.StatusNotFound, "Upload not found")
+		return
+	}
+	if err != nil {
+		tusError(w, http.StatusInternalServerError, "Query failed")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodHead:
+		offset := u.Length
+		if u.DocumentID == "" {
+			if offset, err = tusOffset(id); err != nil {
+				tusError(w, http.StatusNotFound, "Upload data missing")
+				return
+			}
+		}
+		w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+		w.Header().Set("Upload-Length", strconv.FormatInt(u.Length, 10))
+		w.Header().Set("Cache-Control", "no-store")
+		if u.DocumentID != "" {
+			w.Header().Set("Upload-Document-Id", u.DocumentID)
+		} else {
+			w.Header().Set("Upload-Expires", u.ExpiresAt.UTC().Format(http.TimeFormat))
+		}
+		w.WriteHeader(http.StatusOK)
+
+	case http.MethodPatch:
+		patchTusUpload(w, r, u)
+
+	case http.MethodDelete:
+		os.Remove(tusPath(id))
+		db.ExecContext(r.Context(), "DELETE FROM tus_uploads WHERE id = $1", id)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		tusError(w, http.StatusMethodNotAllowed, "HEAD, PATCH, or DELETE only")
+	}
+}
+
+// patchTusUpload appends the request body at Upload-Offset. Bytes received before a dropped
+// connection are kept, so the client can resume from wherever HEAD says it got to.
+func patchTusUpload(w http.ResponseWriter, r *http.Request, u tusUpload) {
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		tusError(w, http.StatusUnsupportedMediaType, "Content-Type must be application/offset+octet-stream")
+		return
+	}
+	if u.DocumentID != "" {
+		tusError(w, http.StatusConflict, "Upload is already complete")
+		return
+	}
+	clientOffset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || clientOffset < 0 {
+		tusError(w, http.StatusBadRequest, "Upload-Offset must be a non-negative integer")
+		return
+	}
+
+	mu, _ := tusLocks.LoadOrStore(u.ID, &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+	defer mu.(*sync.Mutex).Unlock()
+
+	offset, err := tusOffset(u.ID)
+	if err != nil {
+		tusError(w, http.StatusNotFound, "Upload data missing")
+		return
+	}
+	if clientOffset != offset {
+		w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+		tusError(w, http.StatusConflict, fmt.Sprintf("Upload-Offset is %d, server has %d", clientOffset, offset))
+		return
+	}
+
+	// Large chunks over slow links outlast the server-wide read timeout
+	rc := http.NewResponseController(w)
+	rc.SetReadDeadline(time.Now().Add(tusPatchTimeout))
+
+	f, err := os.OpenFile(tusPath(u.ID), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		tusError(w, http.StatusInternalServerError, "Failed to open upload")
+		return
+	}
+	_, copyErr := io.Copy(f, &limitedReader{r: r.Body, remaining: u.Length - offset})
+	if err := f.Close(); copyErr == nil {
+		copyErr = err
+	}
+	if offset, err = tusOffset(u.ID); err != nil {
+		tusError(w, http.StatusInternalServerError, "Failed to read upload")
+		return
+	}
+	w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	if errors.Is(copyErr, errFileTooLarge) {
+		tusError(w, http.StatusRequestEntityTooLarge, "Body extends past Upload-Length")
+		return
+	}
+	if copyErr != nil {
+		// Whatever arrived is kept; the client resumes from the new offset
+		slog.WarnContext(r.Context(), "tus upload interrupted", "upload_id", u.ID, "offset", offset, "length", u.Length, "error", copyErr)
+		tusError(w, http.StatusBadRequest, "Upload interrupted")
+		return
+	}
+	if offset < u.Length {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	doc, err := completeTusUpload(r.Context(), u)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "tus upload failed to register", "upload_id", u.ID, "error", err)
+		if isUploadClientError(err) {
+			tusError(w, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+		var qe *QuotaError
+		if errors.As(err, &qe) {
+			tusError(w, qe.status(), qe.Error())
+			return
+		}
+		var de *DuplicateUploadError
+		if errors.As(err, &de) {
+			w.Header().Set("Upload-Document-Id", de.DocumentID)
+			tusError(w, http.StatusConflict, de.Error())
+			return
+		}
+		var ee *DocumentExistsError
+		if errors.As(err, &ee) {
+			w.Header().Set("Upload-Document-Id", ee.DocumentID)
+			tusError(w, http.StatusConflict, ee.Error())
+			return
+		}
+		tusError(w, http.StatusInternalServerError, "Failed to save file")
+		return
+	}
+	w.Header().Set("Upload-Document-Id", doc.DocumentID)
+	jsonResponse(w, http.StatusOK, uploadResponse(r.Context(), doc))
+}
+
+// completeTusUpload registers a fully received file as a document and drops the partial data
+func completeTusUpload(ctx context.Context, u tusUpload) (*StoredDocument, error) {
+	f, err := os.Open(tusPath(u.ID))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	doc, err := registerUpload(ctx, newDocumentID(u.Filename), u.Filename, u.Project, UploadOptions{Uploader: u.Uploader, QuotaUser: u.QuotaUser}, f)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.ExecContext(ctx, "UPDATE tus_uploads SET document_id = $1, completed_at = now() WHERE id = $2", doc.DocumentID, u.ID); err != nil {
+		slog.Error("tus upload: recording completion failed", "upload_id", u.ID, "document_id", doc.DocumentID, "error", err)
+	}
+	os.Remove(tusPath(u.ID))
+	tusLocks.Delete(u.ID)
+	return doc, nil
+}
+
+// removeExpiredTusUploads deletes the data of unfinished uploads past their expiry
+func removeExpiredTusUploads(ctx context.Context) {
+	ids, err := queryStrings(ctx, "DELETE FROM tus_uploads WHERE document_id IS NULL AND expires_at < now() RETURNING id")
+	if err != nil {
+		slog.Error("tus cleanup failed", "error", err)
+		return
+	}
+	for _, id := range ids {
+		os.Remove(tusPath(id))
+		tusLocks.Delete(id)
+	}
+}
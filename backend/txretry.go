@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ---------- Transaction Retry ----------
+
+// A transaction that fails on a serialization conflict, a deadlock, or a dropped connection is
+// run again from the start, up to DB_TX_MAX_ATTEMPTS times in all, sleeping DB_TX_RETRY_DELAY
+// doubled on each attempt (with jitter) in between.
+var (
+	txMaxAttempts = envInt("DB_TX_MAX_ATTEMPTS", 4)
+	txRetryDelay  = envDuration("DB_TX_RETRY_DELAY", 50*time.Millisecond)
+)
+
+// retryableSQLStates are errors after which the same transaction may well succeed
+var retryableSQLStates = map[string]bool{
+	"40001": true, // serialization_failure
+	"40P01": true, // deadlock_detected
+	"57P01": true, // admin_shutdown
+	"57P02": true, // crash_shutdown
+	"57P03": true, // cannot_connect_now
+}
+
+// transientReason names a retryable failure for logs and metrics, or returns "" when err is
+// permanent. Class 08 covers connection exceptions reported by the server; SafeToRetry covers
+// connections lost before the statement was sent.
+func transientReason(err error) string {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		if retryableSQLStates[pgErr.Code] || strings.HasPrefix(pgErr.Code, "08") {
+			return pgErr.Code
+		}
+		return ""
+	}
+	if pgconn.SafeToRetry(err) {
+		return "conn"
+	}
+	return ""
+}
+
+// inTx runs fn in a transaction on the pool and commits it, retrying the whole transaction on
+// transient failures. fn may run more than once, so it must not have effects outside tx.
+func inTx(ctx context.Context, name string, fn func(pgx.Tx) error) error {
+	for attempt := 1; ; attempt++ {
+		err := pgx.BeginFunc(ctx, pool, fn)
+		reason := ""
+		if err != nil {
+			reason = transientReason(err)
+		}
+		if reason == "" || attempt >= txMaxAttempts || ctx.Err() != nil {
+			return err
+		}
+
+		delay := txRetryDelay << (attempt - 1)
+		delay += rand.N(delay/2 + 1)
+		txRetries.WithLabelValues(name, reason).Inc()
+		slog.WarnContext(ctx, "Retrying transaction", "tx", name, "attempt", attempt, "reason", reason, "delay_ms", delay.Milliseconds(), "error", err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ---------- Unit Normalization ----------
+
+// Text annotation values are transcribed as written: a number, an SI prefix, and a unit
+// ({"value": "4.7", "unit_prefix": "k", "unit_suffix": "Ω"}). Each value also gets a
+// normalized form in the SI unit of its quantity ({"value": 4700, "unit": "Ω"}), computed on
+// /submit and stored next to the raw fields, and recomputed whenever annotations are read so
+// rows written before normalization existed have one too. A value that does not parse or whose
+// unit is unknown has no normalized form.
+//
+// The number may have an exponent ("1e-3"), carry its prefix ("47k"), or be a resistor code
+// ("4k7"). A unit_suffix that carries its own prefix ("mL", "kΩ") is split when unit_prefix is
+// empty. "-", which the annotation tool sends for none, is the same as leaving a field empty.
+
+type NormalizedValue struct {
+	Value float64 `json:"value"`
+	Unit  string  `json:"unit"` // "" when the value has a prefix but no unit
+}
+
+// siPrefixes are the multipliers of the prefixes a unit_prefix may hold
+var siPrefixes = map[string]float64{
+	"":  1,
+	"T": 1e12, "G": 1e9, "M": 1e6, "k": 1e3, "h": 1e2, "da": 1e1,
+	"d": 1e-1, "c": 1e-2, "m": 1e-3, "µ": 1e-6, "μ": 1e-6, "u": 1e-6, "n": 1e-9, "p": 1e-12, "f": 1e-15,
+}
+
+// siUnit converts a unit to its SI unit: si = value*scale + offset
+type siUnit struct {
+	unit   string
+	scale  float64
+	offset float64
+}
+
+// unprefixed are the units a prefix never goes with ("k%", "m°C")
+var unprefixed = map[string]bool{
+	"%": true, "°C": true, "℃": true, "°F": true, "min": true, "h": true, "hr": true, "atm": true,
+}
+
+// siUnits maps the spellings of the units seen in notebooks to their SI unit
+var siUnits = map[string]siUnit{
+	// electrical
+	"Ω": {"Ω", 1, 0}, "\u2126": {"Ω", 1, 0}, "ohm": {"Ω", 1, 0}, "ohms": {"Ω", 1, 0}, "Ohm": {"Ω", 1, 0}, "R": {"Ω", 1, 0},
+	"F": {"F", 1, 0}, "H": {"H", 1, 0}, "V": {"V", 1, 0}, "A": {"A", 1, 0}, "W": {"W", 1, 0},
+	"C": {"C", 1, 0}, "S": {"S", 1, 0}, "mho": {"S", 1, 0}, "J": {"J", 1, 0}, "Hz": {"Hz", 1, 0},
+	// time
+	"s": {"s", 1, 0}, "sec": {"s", 1, 0}, "min": {"s", 60, 0}, "h": {"s", 3600, 0}, "hr": {"s", 3600, 0},
+	// length, mass, volume, amount
+	"m": {"m", 1, 0}, "g": {"kg", 1e-3, 0}, "L": {"m³", 1e-3, 0}, "l": {"m³", 1e-3, 0},
+	"mol": {"mol", 1, 0}, "M": {"mol/m³", 1e3, 0},
+	// temperature and pressure
+	"K": {"K", 1, 0}, "°C": {"K", 1, 273.15}, "℃": {"K", 1, 273.15}, "°F": {"K", 5.0 / 9, 273.15 - 32*5.0/9},
+	"Pa": {"Pa", 1, 0}, "bar": {"Pa", 1e5, 0}, "atm": {"Pa", 101325, 0},
+	// ratios
+	"%": {"", 1e-2, 0},
+}
+
+// Numbers as written in a value: plain or with a trailing prefix ("47k"), and resistor codes
+// where the prefix, or R for none, stands in for the decimal point ("4k7", "2R2")
+var (
+	numberPattern       = regexp.MustCompile(`^([+-]?(?:\d+\.?\d*|\.\d+)(?:[eE][+-]?\d+)?)\s*(da|[TGMkhdcmµμunpf])?$`)
+	resistorCodePattern = regexp.MustCompile(`^(\d+)([TGMkmµμunpR])(\d+)$`)
+)
+
+// parseQuantity reads the number of a value along with a prefix written into it
+func parseQuantity(s string) (float64, string, bool) {
+	s = strings.TrimSpace(s)
+	var num, prefix string
+	if m := numberPattern.FindStringSubmatch(s); m != nil {
+		num, prefix = m[1], m[2]
+	} else if m := resistorCodePattern.FindStringSubmatch(s); m != nil {
+		num, prefix = m[1]+"."+m[3], strings.TrimSuffix(m[2], "R")
+	} else {
+		return 0, "", false
+	}
+	f, err := strconv.ParseFloat(num, 64)
+	if err != nil || math.IsInf(f, 0) {
+		return 0, "", false
+	}
+	return f, prefix, true
+}
+
+// splitUnit separates a unit that carries its own prefix: "kΩ" is k and Ω, "mL" m and L.
+// Units that are known as written are never split ("min", "Pa").
+func splitUnit(suffix string) (string, siUnit, bool) {
+	if u, ok := siUnits[suffix]; ok {
+		return "", u, true
+	}
+	_, size := utf8.DecodeRuneInString(suffix)
+	if strings.HasPrefix(suffix, "da") {
+		size = 2
+	}
+	prefix, rest := suffix[:size], suffix[size:]
+	u, ok := siUnits[rest]
+	if _, isPrefix := siPrefixes[prefix]; !ok || !isPrefix || prefix == "" || unprefixed[rest] {
+		return "", siUnit{}, false
+	}
+	return prefix, u, true
+}
+
+// unitField trims a unit_prefix or unit_suffix, reading "-" as empty
+func unitField(s string) string {
+	s = strings.TrimSpace(s)
+	if s == "-" {
+		return ""
+	}
+	return s
+}
+
+// valueIssue is why a value has no normalized form
+type valueIssue struct {
+	code  string // invalid_value | invalid_prefix | unknown_unit | prefix_conflict
+	field string // value | unit_prefix | unit_suffix
+	msg   string
+}
+
+// resolveValue converts v to its SI unit, or says why it can't
+func resolveValue(v Value) (*NormalizedValue, *valueIssue) {
+	f, codePrefix, ok := parseQuantity(v.Val)
+	if !ok {
+		return nil, &valueIssue{"invalid_value", "value", fmt.Sprintf("%q is not a number", v.Val)}
+	}
+	prefix := unitField(v.UnitPrefix)
+	suffix := unitField(v.UnitSuffix)
+	if _, ok := siPrefixes[prefix]; !ok {
+		return nil, &valueIssue{"invalid_prefix", "unit_prefix", fmt.Sprintf("%q is not an SI prefix", prefix)}
+	}
+
+	unit := siUnit{"", 1, 0}
+	if suffix != "" {
+		p, u, ok := splitUnit(suffix)
+		if !ok {
+			return nil, &valueIssue{"unknown_unit", "unit_suffix", fmt.Sprintf("%q is not a known unit", suffix)}
+		}
+		if p != "" {
+			if prefix != "" {
+				return nil, &valueIssue{"prefix_conflict", "unit_prefix", fmt.Sprintf("prefix %q with unit %q, which has one", prefix, suffix)}
+			}
+			prefix = p
+		}
+		unit = u
+	}
+	if codePrefix != "" {
+		if prefix != "" {
+			return nil, &valueIssue{"prefix_conflict", "value", fmt.Sprintf("%q has a prefix and so does its unit", v.Val)}
+		}
+		prefix = codePrefix
+	}
+	if prefix != "" && unprefixed[suffix] {
+		return nil, &valueIssue{"invalid_prefix", "unit_prefix", fmt.Sprintf("%q takes no prefix", suffix)}
+	}
+	return &NormalizedValue{Value: roundSignificant(f*siPrefixes[prefix]*unit.scale + unit.offset), Unit: unit.unit}, nil
+}
+
+// normalizeValue converts v to its SI unit, or returns nil when it can't
+func normalizeValue(v Value) *NormalizedValue {
+	n, _ := resolveValue(v)
+	return n
+}
+
+// roundSignificant drops the floating point noise of prefix arithmetic (4.7 * 1e3 is
+// 4700.000000000001)
+func roundSignificant(f float64) float64 {
+	r, _ := strconv.ParseFloat(strconv.FormatFloat(f, 'g', 12, 64), 64)
+	return r
+}
+
+// normalizeValues sets the normalized form of each of vs, replacing whatever a client sent
+func normalizeValues(vs []Value) {
+	for i := range vs {
+		vs[i].Normalized = normalizeValue(vs[i])
+	}
+}
+
+// ---------- Value Validation ----------
+
+// Values that can't be normalized, or whose unit doesn't fit what the text labels, are reported
+// as warnings by /submit and GET /documents/{id}/validate. They are saved anyway, since a
+// transcription is sometimes right to be odd, but "10O kΩ" should get a second look.
+//
+// The quantity a label expects comes from its name ("capacitance") or, for reference designators,
+// its letter ("C12"). Labels that match neither are not unit-checked.
+
+// labelUnits maps label names to the SI unit of the quantity they label
+var labelUnits = map[string]string{
+	"resistance": "Ω", "resistor": "Ω", "impedance": "Ω",
+	"capacitance": "F", "capacitor": "F",
+	"inductance": "H", "inductor": "H",
+	"voltage": "V", "current": "A", "power": "W", "frequency": "Hz",
+	"time": "s", "temperature": "K", "pressure": "Pa", "volume": "m³", "mass": "kg",
+	"concentration": "mol/m³",
+}
+
+// designatorUnits maps reference designator letters to the SI unit of their part's value
+var designatorUnits = map[string]string{
+	"R": "Ω", "C": "F", "L": "H", "V": "V", "I": "A", "Y": "Hz",
+}
+
+var designatorPattern = regexp.MustCompile(`^([A-Za-z])\d+$`)
+
+// labelUnit returns the SI unit label expects, or "" when it isn't known
+func labelUnit(label string) string {
+	label = strings.TrimSpace(label)
+	if u, ok := labelUnits[strings.ToLower(label)]; ok {
+		return u
+	}
+	if m := designatorPattern.FindStringSubmatch(label); m != nil {
+		return designatorUnits[strings.ToUpper(m[1])]
+	}
+	return ""
+}
+
+// checkValues reports the values of text annotation id that don't parse or don't fit its label.
+// Rows with no value are blank rows of the annotation tool and are skipped.
+func checkValues(id, label string, values []Value, page int) []GraphIssue {
+	want := labelUnit(label)
+	var issues []GraphIssue
+	for i, v := range values {
+		if strings.TrimSpace(v.Val) == "" {
+			continue
+		}
+		n, problem := resolveValue(v)
+		if problem == nil && want != "" && n.Unit != "" && n.Unit != want {
+			problem = &valueIssue{"unit_mismatch", "unit_suffix", fmt.Sprintf("%s is not a unit of %q, which takes %s", n.Unit, label, want)}
+		}
+		if problem != nil {
+			issues = append(issues, GraphIssue{
+				Code: problem.code, Severity: "warning", ID: id, Page: page,
+				Field: fmt.Sprintf("values[%d].%s", i, problem.field), Message: problem.msg,
+			})
+		}
+	}
+	return issues
+}
+
+// submittedValueIssues checks the values of the text annotations of a submission
+func submittedValueIssues(anns []RawAnnotation) []GraphIssue {
+	issues := []GraphIssue{}
+	for _, ann := range anns {
+		if ann.Type == "text" && !ann.IsIgnored {
+			issues = append(issues, checkValues(ann.ID, ann.LabelName, ann.Values, ann.Page)...)
+		}
+	}
+	return issues
+}
@@ -0,0 +1,87 @@
+package main
+
+import "testing"
+
+func TestResolveValue(t *testing.T) {
+	tests := []struct {
+		name        string
+		value       Value
+		want        float64
+		unit        string
+		code, field string // expected issue, if any
+	}{
+		{"prefix and unit", Value{Val: "4.7", UnitPrefix: "k", UnitSuffix: "Ω"}, 4700, "Ω", "", ""},
+		{"micro sign", Value{Val: "4.7", UnitPrefix: "µ", UnitSuffix: "F"}, 4.7e-6, "F", "", ""},
+		{"greek mu", Value{Val: "4.7", UnitPrefix: "μ", UnitSuffix: "F"}, 4.7e-6, "F", "", ""},
+		{"u for micro", Value{Val: "4.7", UnitPrefix: "u", UnitSuffix: "F"}, 4.7e-6, "F", "", ""},
+		{"micro in the unit", Value{Val: "10", UnitSuffix: "uF"}, 1e-5, "F", "", ""},
+		{"kilo in the unit", Value{Val: "10", UnitSuffix: "kΩ"}, 10000, "Ω", "", ""},
+		{"capital K is not a prefix", Value{Val: "10", UnitPrefix: "K", UnitSuffix: "Ω"}, 0, "", "invalid_prefix", "unit_prefix"},
+		{"capital K is not a prefix in the unit", Value{Val: "10", UnitSuffix: "KΩ"}, 0, "", "unknown_unit", "unit_suffix"},
+		{"capital K is kelvin", Value{Val: "300", UnitSuffix: "K"}, 300, "K", "", ""},
+		{"kilogram", Value{Val: "1", UnitPrefix: "k", UnitSuffix: "g"}, 1, "kg", "", ""},
+		{"millilitre", Value{Val: "1", UnitSuffix: "mL"}, 1e-6, "m³", "", ""},
+		{"min is not milli-in", Value{Val: "5", UnitSuffix: "min"}, 300, "s", "", ""},
+		{"celsius", Value{Val: "25", UnitSuffix: "°C"}, 298.15, "K", "", ""},
+		{"percent", Value{Val: "5", UnitSuffix: "%"}, 0.05, "", "", ""},
+		{"no unit", Value{Val: "12"}, 12, "", "", ""},
+		{"dash for no unit", Value{Val: "12", UnitPrefix: "-", UnitSuffix: "-"}, 12, "", "", ""},
+		{"prefix without unit", Value{Val: "2", UnitPrefix: "m"}, 0.002, "", "", ""},
+		{"prefix in the number", Value{Val: "47k"}, 47000, "", "", ""},
+		{"resistor code", Value{Val: "4k7", UnitSuffix: "Ω"}, 4700, "Ω", "", ""},
+		{"resistor code with R", Value{Val: "2R2", UnitSuffix: "Ω"}, 2.2, "Ω", "", ""},
+		{"exponent", Value{Val: "1e-3", UnitSuffix: "F"}, 0.001, "F", "", ""},
+		{"negative", Value{Val: "-5", UnitSuffix: "V"}, -5, "V", "", ""},
+		{"empty value", Value{Val: ""}, 0, "", "invalid_value", "value"},
+		{"not a number", Value{Val: "abc", UnitSuffix: "V"}, 0, "", "invalid_value", "value"},
+		{"two decimal points", Value{Val: "1.2.3"}, 0, "", "invalid_value", "value"},
+		{"letter O for zero", Value{Val: "10O", UnitPrefix: "k", UnitSuffix: "Ω"}, 0, "", "invalid_value", "value"},
+		{"unknown prefix", Value{Val: "1", UnitPrefix: "x", UnitSuffix: "V"}, 0, "", "invalid_prefix", "unit_prefix"},
+		{"unknown unit", Value{Val: "1", UnitSuffix: "furlong"}, 0, "", "unknown_unit", "unit_suffix"},
+		{"prefix twice", Value{Val: "10", UnitPrefix: "m", UnitSuffix: "kΩ"}, 0, "", "prefix_conflict", "unit_prefix"},
+		{"prefix in number and field", Value{Val: "47k", UnitPrefix: "k"}, 0, "", "prefix_conflict", "value"},
+		{"prefix on percent", Value{Val: "5", UnitPrefix: "k", UnitSuffix: "%"}, 0, "", "invalid_prefix", "unit_prefix"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, issue := resolveValue(tt.value)
+			if tt.code != "" {
+				if issue == nil {
+					t.Fatalf("got %+v, want issue %s", got, tt.code)
+				}
+				if issue.code != tt.code || issue.field != tt.field {
+					t.Errorf("got issue %s on %s, want %s on %s", issue.code, issue.field, tt.code, tt.field)
+				}
+				if normalizeValue(tt.value) != nil {
+					t.Errorf("normalizeValue returned a value for an issue")
+				}
+				return
+			}
+			if issue != nil {
+				t.Fatalf("got issue %s: %s", issue.code, issue.msg)
+			}
+			// Compared exactly: roundSignificant drops the noise of prefix arithmetic
+			if got.Value != tt.want || got.Unit != tt.unit {
+				t.Errorf("got %v %q, want %v %q", got.Value, got.Unit, tt.want, tt.unit)
+			}
+		})
+	}
+}
+
+func TestLabelUnit(t *testing.T) {
+	tests := []struct {
+		label, want string
+	}{
+		{"capacitance", "F"},
+		{"C12", "F"},
+		{"R1", "Ω"},
+		{"L3", "H"},
+		{"note", ""},
+		{"R", ""},
+	}
+	for _, tt := range tests {
+		if got := labelUnit(tt.label); got != tt.want {
+			t.Errorf("labelUnit(%q) = %q, want %q", tt.label, got, tt.want)
+		}
+	}
+}
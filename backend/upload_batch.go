@@ -0,0 +1,247 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+// ---------- Batch ZIP Upload ----------
+
+var (
+	batchMaxArchiveBytes = int64(envInt("UPLOAD_BATCH_MAX_MB", 2048)) << 20
+	batchMaxFileBytes    = int64(envInt("UPLOAD_BATCH_MAX_FILE_MB", 32)) << 20
+)
+
+var errFileTooLarge = errors.New("file exceeds size limit")
+
+// multipartOverhead is allowed on top of a file limit for part boundaries, headers, and small
+// form fields
+const multipartOverhead = 1 << 20
+
+// limitRequestBody caps the request body with http.MaxBytesReader, which also makes the server
+// close the connection rather than drain the rest of an oversized body
+func limitRequestBody(w http.ResponseWriter, r *http.Request, maxBytes int64) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+}
+
+// isTooLarge reports reads that ran past limitRequestBody or a limitedReader
+func isTooLarge(err error) bool {
+	var mbe *http.MaxBytesError
+	return errors.As(err, &mbe) || errors.Is(err, errFileTooLarge)
+}
+
+// tooLargeError writes a 413 that states the allowed maximum
+func tooLargeError(w http.ResponseWriter, what string, maxBytes int64) {
+	writeProblem(w, Problem{
+		Status:   http.StatusRequestEntityTooLarge,
+		Code:     codePayloadTooLarge,
+		Detail:   fmt.Sprintf("%s exceeds the %d MB limit", what, maxBytes>>20),
+		MaxBytes: maxBytes,
+	})
+}
+
+// limitedReader fails with errFileTooLarge instead of silently truncating like io.LimitReader
+type limitedReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.remaining <= 0 {
+		// Probe for one more byte to distinguish "exactly at the limit" from "over it"
+		var b [1]byte
+		if n, _ := l.r.Read(b[:]); n > 0 {
+			return 0, errFileTooLarge
+		}
+		return 0, io.EOF
+	}
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	return n, err
+}
+
+type BatchUploadResult struct {
+	FileName   string `json:"file_name"`
+	DocumentID string `json:"document_id,omitempty"`
+	Status     string `json:"status"` // success | duplicate | exists | error | skipped
+	Error      string `json:"error,omitempty"`
+	Warning    string `json:"warning,omitempty"`
+}
+
+// spoolMultipartFile streams the named file part of a multipart request into a temp file,
+// without buffering it in memory. Other form fields are returned as a map.
+func spoolMultipartFile(r *http.Request, field string, maxBytes int64) (*os.File, map[string]string, error) {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, nil, fmt.Errorf("expected multipart form data")
+	}
+
+	fields := map[string]string{}
+	var spooled *os.File
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if spooled != nil {
+				closeAndRemove(spooled)
+			}
+			return nil, nil, fmt.Errorf("reading multipart body: %w", err)
+		}
+
+		if part.FormName() == field && part.FileName() != "" && spooled == nil {
+			tmp, err := os.CreateTemp("", "corvina-upload-*")
+			if err != nil {
+				return nil, nil, err
+			}
+			if _, err := io.Copy(tmp, &limitedReader{r: part, remaining: maxBytes}); err != nil {
+				closeAndRemove(tmp)
+				return nil, nil, err
+			}
+			spooled = tmp
+		} else if part.FileName() == "" {
+			v, _ := io.ReadAll(io.LimitReader(part, 1<<16))
+			fields[part.FormName()] = string(v)
+		}
+		part.Close()
+	}
+
+	if spooled == nil {
+		return nil, nil, fmt.Errorf("no %s part", field)
+	}
+	if _, err := spooled.Seek(0, io.SeekStart); err != nil {
+		closeAndRemove(spooled)
+		return nil, nil, err
+	}
+	return spooled, fields, nil
+}
+
+func closeAndRemove(f *os.File) {
+	f.Close()
+	os.Remove(f.Name())
+}
+
+// handleUploadBatch accepts a zip of images/PDFs and registers one document per file
+func handleUploadBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		jsonError(w, http.StatusMethodNotAllowed, "POST only")
+		return
+	}
+
+	limitRequestBody(w, r, batchMaxArchiveBytes+multipartOverhead)
+	archive, fields, err := spoolMultipartFile(r, "file", batchMaxArchiveBytes)
+	if isTooLarge(err) {
+		tooLargeError(w, "Archive", batchMaxArchiveBytes)
+		return
+	}
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer closeAndRemove(archive)
+
+	info, err := archive.Stat()
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "Failed to read archive")
+		return
+	}
+	zr, err := zip.NewReader(archive, info.Size())
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "File is not a valid zip archive")
+		return
+	}
+
+	project := strings.TrimSpace(fields["project"])
+	if project == "" {
+		project = defaultProject
+	}
+
+	opts := UploadOptions{
+		Uploader:       requestUser(r),
+		QuotaUser:      quotaUser(r),
+		AllowDuplicate: queryFlag(r.URL.Query().Get("allow_duplicate")),
+		Overwrite:      queryFlag(r.URL.Query().Get("overwrite")),
+	}
+	results := []BatchUploadResult{}
+	seen := map[string]bool{}
+	var nOK, nFailed int
+
+	for _, f := range zr.File {
+		// Directory structure inside the archive is flattened; only the base name is used
+		name := path.Base(f.Name)
+		if f.FileInfo().IsDir() || strings.HasPrefix(name, ".") || strings.HasPrefix(f.Name, "__MACOSX/") {
+			continue
+		}
+
+		res := BatchUploadResult{FileName: f.Name}
+		switch {
+		case documentIDMode == "filename" && seen[name]:
+			res.Status, res.Error = "error", "duplicate file name in archive"
+		case f.UncompressedSize64 > uint64(batchMaxFileBytes):
+			res.Status, res.Error = "error", fmt.Sprintf("file exceeds the %d MB limit", batchMaxFileBytes>>20)
+		default:
+			seen[name] = true
+			docID := newDocumentID(name)
+			err := extractAndRegister(r.Context(), f, docID, name, project, opts)
+			var de *DuplicateUploadError
+			var ee *DocumentExistsError
+			switch {
+			case errors.Is(err, errUnrecognizedUpload):
+				res.Status, res.Error = "skipped", "unsupported file type"
+			case errors.As(err, &de):
+				res.Status, res.DocumentID, res.Error = "duplicate", de.DocumentID, de.Error()
+			case errors.As(err, &ee):
+				res.Status, res.DocumentID, res.Error = "exists", ee.DocumentID, "document already exists; pass overwrite=true to replace it"
+			case err != nil:
+				res.Status, res.Error = "error", err.Error()
+			default:
+				res.Status, res.DocumentID = "success", docID
+				if dups, err := records.FindDuplicates(r.Context(), docID, phashMaxDistance); err == nil && len(dups) > 0 {
+					res.Warning = duplicateWarning(dups)
+				}
+			}
+		}
+
+		if res.Status == "success" {
+			nOK++
+		} else if res.Status == "error" {
+			nFailed++
+		}
+		results = append(results, res)
+	}
+
+	slog.InfoContext(r.Context(), "Batch upload", "registered", nOK, "failed", nFailed, "project", project)
+
+	jsonResponse(w, http.StatusOK, map[string]interface{}{
+		"status":    "success",
+		"project":   project,
+		"succeeded": nOK,
+		"failed":    nFailed,
+		"results":   results,
+	})
+}
+
+// extractAndRegister streams a single zip entry straight into the dataset directory
+func extractAndRegister(ctx context.Context, f *zip.File, docID, filename, project string, opts UploadOptions) error {
+	rc, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("opening archive entry: %v", err)
+	}
+	defer rc.Close()
+
+	// The header size can lie; enforce the limit on the decompressed stream too
+	_, err = registerUpload(ctx, docID, filename, project, opts, &limitedReader{r: rc, remaining: batchMaxFileBytes})
+	return err
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ---------- Upload by URL ----------
+
+var (
+	urlUploadTimeout  = envDuration("UPLOAD_URL_TIMEOUT", 30*time.Second)
+	urlUploadMaxBytes = int64(envInt("UPLOAD_URL_MAX_MB", 32)) << 20
+	// Comma-separated host allowlist; empty turns URL uploads off and "*" allows any public host
+	urlUploadAllowedHosts = envString("UPLOAD_URL_ALLOWED_HOSTS", "")
+)
+
+// errBlockedAddress is returned when a fetch would connect to a loopback, private, link-local,
+// or unspecified address. It is checked on every connection the client makes, after DNS
+// resolution, so neither a redirect nor a host name that resolves inward gets around it.
+var errBlockedAddress = errors.New("address is not public")
+
+// dialPublicOnly is a net.Dialer Control func that refuses non-public addresses
+func dialPublicOnly(network, address string, _ syscall.RawConn) error {
+	ap, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("%s: %w", address, errBlockedAddress)
+	}
+	ip := ap.Addr().Unmap()
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() || sharedAddressSpace.Contains(ip) {
+		return fmt.Errorf("%s: %w", ip, errBlockedAddress)
+	}
+	return nil
+}
+
+// sharedAddressSpace is carrier-grade NAT space (RFC 6598), internal in practice
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+var urlUploadClient = &http.Client{
+	Timeout: urlUploadTimeout,
+	// No proxy: the dialer must see the address actually fetched from
+	Transport: &http.Transport{
+		DialContext:         (&net.Dialer{Timeout: 10 * time.Second, Control: dialPublicOnly}).DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+	},
+	// Redirects must not escape the allowlist
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 5 {
+			return errors.New("too many redirects")
+		}
+		if !urlHostAllowed(req.URL.Hostname()) {
+			return fmt.Errorf("redirect to %s is not allowed", req.URL.Hostname())
+		}
+		return nil
+	},
+}
+
+type URLUploadRequest struct {
+	URL      string `json:"url"`
+	Filename string `json:"filename,omitempty"`
+	Project  string `json:"project,omitempty"`
+}
+
+// urlHostAllowed checks a host against UPLOAD_URL_ALLOWED_HOSTS
+func urlHostAllowed(host string) bool {
+	for _, h := range strings.Split(urlUploadAllowedHosts, ",") {
+		if h = strings.TrimSpace(h); h == "*" || strings.EqualFold(h, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// urlContentTypeAllowed accepts the declared types of supported formats plus generic binary
+func urlContentTypeAllowed(ct string) bool {
+	ct = strings.ToLower(strings.TrimSpace(strings.Split(ct, ";")[0]))
+	switch ct {
+	case "image/png", "image/jpeg", "image/tiff", "image/webp", "application/pdf", "application/octet-stream":
+		return true
+	}
+	return false
+}
+
+// handleUploadURL fetches a remote image or PDF and registers it as a document
+func handleUploadURL(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		jsonError(w, http.StatusMethodNotAllowed, "POST only")
+		return
+	}
+
+	var req URLUploadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		jsonError(w, http.StatusBadRequest, "url must be an absolute http(s) URL")
+		return
+	}
+	if urlUploadAllowedHosts == "" {
+		jsonError(w, http.StatusForbidden, "Uploads by URL are disabled; set UPLOAD_URL_ALLOWED_HOSTS to enable them")
+		return
+	}
+	if !urlHostAllowed(u.Hostname()) {
+		jsonError(w, http.StatusForbidden, fmt.Sprintf("Host %s is not in the upload allowlist", u.Hostname()))
+		return
+	}
+
+	filename := filepath.Base(req.Filename)
+	if req.Filename == "" {
+		filename = path.Base(u.Path)
+	}
+	if filename == "" || filename == "." || filename == "/" {
+		jsonError(w, http.StatusBadRequest, "Cannot derive a filename from the URL; pass filename")
+		return
+	}
+
+	project := strings.TrimSpace(req.Project)
+	if project == "" {
+		project = defaultProject
+	}
+
+	resp, err := urlUploadClient.Get(u.String())
+	if errors.Is(err, errBlockedAddress) {
+		jsonError(w, http.StatusForbidden, "Refusing to fetch from a non-public address: "+err.Error())
+		return
+	}
+	if err != nil {
+		jsonError(w, http.StatusBadGateway, "Failed to fetch URL: "+err.Error())
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		jsonError(w, http.StatusBadGateway, fmt.Sprintf("Remote server returned %s", resp.Status))
+		return
+	}
+	if resp.ContentLength > urlUploadMaxBytes {
+		tooLargeError(w, "Remote file", urlUploadMaxBytes)
+		return
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "" && !urlContentTypeAllowed(ct) {
+		jsonError(w, http.StatusUnsupportedMediaType, fmt.Sprintf("Remote content type %q is not a supported image or PDF", ct))
+		return
+	}
+
+	// Don't trust the header alone: sniff the first bytes before writing anything
+	body := bufio.NewReader(&limitedReader{r: resp.Body, remaining: urlUploadMaxBytes})
+	head, _ := body.Peek(512)
+	ext := sniffUploadExt(head)
+	if ext == "" {
+		jsonError(w, http.StatusUnsupportedMediaType, supportedUploadsMsg)
+		return
+	}
+	// The URL's extension is only a hint; store under the extension of the actual content
+	if uploadFormats[strings.ToLower(filepath.Ext(filename))] != uploadFormats[ext] {
+		filename = strings.TrimSuffix(filename, filepath.Ext(filename)) + ext
+	}
+	docID := newDocumentID(filename)
+
+	opts := UploadOptions{
+		Uploader:       requestUser(r),
+		QuotaUser:      quotaUser(r),
+		AllowDuplicate: queryFlag(r.URL.Query().Get("allow_duplicate")),
+		Overwrite:      queryFlag(r.URL.Query().Get("overwrite")),
+	}
+	doc, err := registerUpload(r.Context(), docID, filename, project, opts, body)
+	if err != nil {
+		if isTooLarge(err) {
+			tooLargeError(w, "Remote file", urlUploadMaxBytes)
+			return
+		}
+		if quotaExceededError(w, err) || duplicateUploadError(w, err) || documentExistsError(w, err) {
+			return
+		}
+		if isUploadClientError(err) {
+			problemError(w, http.StatusUnprocessableEntity, codeInvalidUpload, err.Error())
+			return
+		}
+		slog.ErrorContext(r.Context(), "URL upload failed", "document_id", docID, "error", err)
+		jsonError(w, http.StatusInternalServerError, "Failed to save file")
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Registered document from URL", "document_id", docID, "url", u.Redacted())
+
+	out := uploadResponse(r.Context(), doc)
+	out.SourceURL = u.Redacted()
+	jsonResponse(w, http.StatusOK, out)
+}
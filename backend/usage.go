@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ---------- Usage ----------
+
+// GET /admin/usage?interval=day|week|month reports what the dataset takes up, for capacity
+// planning: documents and annotations per project, table sizes, object store and DATASET_DIR
+// bytes, and documents and upload bytes added per interval.
+
+// usageScanTTL is how long a scan of the object store and DATASET_DIR is reused; listing a large
+// bucket takes a while and costs requests
+var usageScanTTL = envDuration("USAGE_SCAN_TTL", 10*time.Minute)
+
+var usageIntervals = map[string]bool{"day": true, "week": true, "month": true}
+
+// usageAnnotationTables are counted per project
+var usageAnnotationTables = []string{"regions", "components", "nodes", "connections", "text_annotations", "suggestions"}
+
+type ProjectUsage struct {
+	Project     string           `json:"project"`
+	Documents   int64            `json:"documents"`
+	Pages       int64            `json:"pages"`
+	UploadBytes int64            `json:"upload_bytes"` // size of the original uploads
+	Annotations map[string]int64 `json:"annotations"`
+}
+
+type TableUsage struct {
+	Name  string `json:"name"`
+	Rows  int64  `json:"rows"`  // planner estimate
+	Bytes int64  `json:"bytes"` // including indexes and TOAST
+}
+
+type StorageUsage struct {
+	Backend    string `json:"backend"`
+	Objects    int    `json:"objects"`
+	Bytes      int64  `json:"bytes"`
+	DatasetDir int64  `json:"dataset_dir_bytes"` // everything under DATASET_DIR: local objects, caches, legacy files
+	ScannedAt  string `json:"scanned_at"`
+}
+
+type UsagePoint struct {
+	Period           string `json:"period"`
+	Documents        int64  `json:"documents"`
+	UploadBytes      int64  `json:"upload_bytes"`
+	TotalDocuments   int64  `json:"total_documents"`
+	TotalUploadBytes int64  `json:"total_upload_bytes"`
+}
+
+type UsageReport struct {
+	Projects      []ProjectUsage `json:"projects"`
+	Tables        []TableUsage   `json:"tables"`
+	DatabaseBytes int64          `json:"database_bytes"`
+	Storage       *StorageUsage  `json:"storage,omitempty"` // omitted when the scan failed
+	Interval      string         `json:"interval"`
+	Growth        []UsagePoint   `json:"growth"`
+}
+
+// usageScan caches the latest storage scan
+var usageScan struct {
+	sync.Mutex
+	result *StorageUsage
+	at     time.Time
+}
+
+// scanStorage measures the object store and DATASET_DIR, reusing a recent result
+func scanStorage() (*StorageUsage, error) {
+	usageScan.Lock()
+	defer usageScan.Unlock()
+	if usageScan.result != nil && time.Since(usageScan.at) < usageScanTTL {
+		return usageScan.result, nil
+	}
+
+	objects, bytes, err := store.Usage()
+	if err != nil {
+		return nil, fmt.Errorf("scanning object store: %w", err)
+	}
+	var dirBytes int64
+	err = filepath.WalkDir(datasetDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if info, err := d.Info(); err == nil {
+			dirBytes += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("scanning %s: %w", datasetDir, err)
+	}
+
+	now := time.Now()
+	usageScan.result = &StorageUsage{
+		Backend: storageBackend, Objects: objects, Bytes: bytes, DatasetDir: dirBytes,
+		ScannedAt: now.UTC().Format(time.RFC3339),
+	}
+	usageScan.at = now
+	return usageScan.result, nil
+}
+
+func projectUsage(ctx context.Context) ([]ProjectUsage, error) {
+	rows, err := readDB(ctx).QueryContext(ctx, `
+		SELECT project, count(*), COALESCE(sum(num_pages), 0), COALESCE(sum(size_bytes), 0)
+		FROM documents GROUP BY project ORDER BY project`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	projects := []ProjectUsage{}
+	index := map[string]int{}
+	for rows.Next() {
+		p := ProjectUsage{Annotations: map[string]int64{}}
+		if err := rows.Scan(&p.Project, &p.Documents, &p.Pages, &p.UploadBytes); err != nil {
+			return nil, err
+		}
+		for _, t := range usageAnnotationTables {
+			p.Annotations[t] = 0
+		}
+		index[p.Project] = len(projects)
+		projects = append(projects, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, t := range usageAnnotationTables {
+		rows, err := readDB(ctx).QueryContext(ctx, fmt.Sprintf(`
+			SELECT d.project, count(*) FROM %s a JOIN documents d ON d.document_id = a.document_id
+			GROUP BY d.project`, t))
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var project string
+			var n int64
+			if err := rows.Scan(&project, &n); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			if i, ok := index[project]; ok {
+				projects[i].Annotations[t] = n
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return projects, nil
+}
+
+// tableUsage sizes every table in the public schema. Row counts are the planner's estimates,
+// which keeps this cheap on large tables.
+func tableUsage(ctx context.Context) ([]TableUsage, int64, error) {
+	rows, err := readDB(ctx).QueryContext(ctx, `
+		SELECT c.relname, GREATEST(c.reltuples, 0)::bigint, pg_total_relation_size(c.oid)
+		FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = 'public' AND c.relkind IN ('r', 'p')
+		ORDER BY pg_total_relation_size(c.oid) DESC`)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	tables := []TableUsage{}
+	for rows.Next() {
+		var t TableUsage
+		if err := rows.Scan(&t.Name, &t.Rows, &t.Bytes); err != nil {
+			return nil, 0, err
+		}
+		tables = append(tables, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	var total int64
+	err = readDB(ctx).QueryRowContext(ctx, "SELECT pg_database_size(current_database())").Scan(&total)
+	return tables, total, err
+}
+
+// usageGrowth counts the documents uploaded in each interval, with running totals
+func usageGrowth(ctx context.Context, interval string) ([]UsagePoint, error) {
+	rows, err := readDB(ctx).QueryContext(ctx, `
+		SELECT date_trunc($1, created_at) AS period, count(*), COALESCE(sum(size_bytes), 0)
+		FROM documents WHERE created_at IS NOT NULL GROUP BY period ORDER BY period`, interval)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	points := []UsagePoint{}
+	var docs, bytes int64
+	for rows.Next() {
+		var p UsagePoint
+		var period time.Time
+		if err := rows.Scan(&period, &p.Documents, &p.UploadBytes); err != nil {
+			return nil, err
+		}
+		docs += p.Documents
+		bytes += p.UploadBytes
+		p.Period = period.UTC().Format("2006-01-02")
+		p.TotalDocuments, p.TotalUploadBytes = docs, bytes
+		points = append(points, p)
+	}
+	return points, rows.Err()
+}
+
+func handleUsage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		jsonError(w, http.StatusMethodNotAllowed, "GET only")
+		return
+	}
+	interval := r.URL.Query().Get("interval")
+	if interval == "" {
+		interval = "month"
+	}
+	if !usageIntervals[interval] {
+		jsonError(w, http.StatusBadRequest, "interval must be day, week, or month")
+		return
+	}
+
+	ctx := r.Context()
+	rep := UsageReport{Interval: interval}
+	var err error
+	if rep.Projects, err = projectUsage(ctx); err != nil {
+		slog.ErrorContext(ctx, "Usage query failed", "error", err)
+		jsonError(w, http.StatusInternalServerError, "Query failed")
+		return
+	}
+	if rep.Tables, rep.DatabaseBytes, err = tableUsage(ctx); err != nil {
+		slog.ErrorContext(ctx, "Usage query failed", "error", err)
+		jsonError(w, http.StatusInternalServerError, "Query failed")
+		return
+	}
+	if rep.Growth, err = usageGrowth(ctx, interval); err != nil {
+		slog.ErrorContext(ctx, "Usage query failed", "error", err)
+		jsonError(w, http.StatusInternalServerError, "Query failed")
+		return
+	}
+	// A storage outage should not hide the database figures
+	if rep.Storage, err = scanStorage(); err != nil {
+		slog.WarnContext(ctx, "Storage usage scan failed", "error", err)
+	}
+	jsonResponse(w, http.StatusOK, rep)
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ---------- Graph Validation ----------
+
+// GraphIssue is one defect found in a document's graph. Errors break netlist generation;
+// warnings are usually annotation gaps worth a second look.
+type GraphIssue struct {
+	Code     string `json:"code"`     // dangling_connection | self_loop | orphan_node | unconnected_component | overlapping_bbox, or a value code from units.go
+	Severity string `json:"severity"` // error | warning
+	ID       string `json:"id"`
+	OtherID  string `json:"other_id,omitempty"` // second annotation of an overlapping pair
+	Page     int    `json:"page,omitempty"`
+	Field    string `json:"field,omitempty"` // the value a value issue is about, e.g. values[0].unit_suffix
+	Message  string `json:"message"`
+}
+
+// validateGraph checks connection endpoints against the document's components and nodes.
+// Legacy lines drawn without endpoints are geometry only and are not checked.
+func validateGraph(g Graph) []GraphIssue {
+	issues := []GraphIssue{}
+	entities := map[string]bool{}
+	for _, c := range g.Components {
+		entities[c.ID] = true
+	}
+	for _, n := range g.Nodes {
+		entities[n.ID] = true
+	}
+
+	degree := map[string]int{}
+	for _, c := range g.Connections {
+		if c.Type == "line" && c.SourceID == "" && c.TargetID == "" {
+			continue
+		}
+		if c.SourceID != "" && c.SourceID == c.TargetID {
+			issues = append(issues, GraphIssue{
+				Code: "self_loop", Severity: "error", ID: c.ID, Page: c.Page,
+				Message: fmt.Sprintf("connection %s starts and ends at %s", c.ID, c.SourceID),
+			})
+		}
+		for _, end := range []struct{ name, id string }{{"source", c.SourceID}, {"target", c.TargetID}} {
+			if !entities[end.id] {
+				ref := end.id
+				if ref == "" {
+					ref = "(empty)"
+				}
+				issues = append(issues, GraphIssue{
+					Code: "dangling_connection", Severity: "error", ID: c.ID, Page: c.Page,
+					Message: fmt.Sprintf("connection %s %s %s is not a component or node", c.ID, end.name, ref),
+				})
+				continue
+			}
+			degree[end.id]++
+		}
+	}
+
+	for _, n := range g.Nodes {
+		if degree[n.ID] == 0 {
+			issues = append(issues, GraphIssue{
+				Code: "orphan_node", Severity: "warning", ID: n.ID, Page: n.Page,
+				Message: fmt.Sprintf("node %s has no connections", n.ID),
+			})
+		}
+	}
+	for _, c := range g.Components {
+		if degree[c.ID] == 0 {
+			issues = append(issues, GraphIssue{
+				Code: "unconnected_component", Severity: "warning", ID: c.ID, Page: c.Page,
+				Message: fmt.Sprintf("component %s (%s) has no connections", c.ID, c.Label),
+			})
+		}
+	}
+	return issues
+}
+
+// bboxOverlapIoU is the IoU above which two boxes are reported as the same thing labeled twice
+var bboxOverlapIoU = envFloat("BBOX_OVERLAP_IOU", 0.8)
+
+// overlapThresholdFromQuery resolves ?overlap_iou=, falling back to BBOX_OVERLAP_IOU
+func overlapThresholdFromQuery(v string) (float64, error) {
+	if v == "" {
+		return bboxOverlapIoU, nil
+	}
+	t, err := strconv.ParseFloat(v, 64)
+	if err != nil || t <= 0 || t > 1 {
+		return 0, fmt.Errorf("overlap_iou must be in (0, 1]")
+	}
+	return t, nil
+}
+
+// labeledBox is a component or text bbox checked for duplicates
+type labeledBox struct {
+	kind, id, label string
+	page            int
+	bbox            []int
+}
+
+// findOverlaps flags pairs of component boxes, or pairs of text boxes, on the same page whose IoU
+// exceeds threshold. Labels are ignored: a symbol boxed twice under different labels is still a duplicate.
+func findOverlaps(components []Component, texts []TextAnnotation, threshold float64) []GraphIssue {
+	var boxes []labeledBox
+	for _, c := range components {
+		boxes = append(boxes, labeledBox{"component", c.ID, c.Label, max(c.Page, 1), c.BBox})
+	}
+	for _, t := range texts {
+		boxes = append(boxes, labeledBox{"text", t.ID, t.RawText, max(t.Page, 1), t.BBox})
+	}
+
+	issues := []GraphIssue{}
+	for i := range boxes {
+		for j := i + 1; j < len(boxes); j++ {
+			a, b := boxes[i], boxes[j]
+			if a.kind != b.kind || a.page != b.page {
+				continue
+			}
+			if iou := boxIoU(a.bbox, b.bbox); iou > threshold {
+				issues = append(issues, GraphIssue{
+					Code: "overlapping_bbox", Severity: "warning", ID: a.id, OtherID: b.id, Page: a.page,
+					Message: fmt.Sprintf("%s %s and %s overlap with IoU %.2f", a.kind, a.id, b.id, iou),
+				})
+			}
+		}
+	}
+	return issues
+}
+
+// submittedOverlaps runs findOverlaps over a submission before it is stored
+func submittedOverlaps(anns []RawAnnotation, threshold float64) []GraphIssue {
+	var components []Component
+	var texts []TextAnnotation
+	for _, ann := range anns {
+		switch ann.Type {
+		case "box":
+			components = append(components, Component{ID: ann.ID, Label: ann.Label, BBox: ann.BBox, Page: ann.Page})
+		case "text":
+			texts = append(texts, TextAnnotation{ID: ann.ID, BBox: ann.BBox, RawText: ann.RawText, Page: ann.Page})
+		}
+	}
+	return findOverlaps(components, texts, threshold)
+}
+
+// handleValidateDocument reports graph defects and duplicate boxes:
+// GET /documents/{id}/validate?overlap_iou=0.8
+func handleValidateDocument(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		jsonError(w, http.StatusMethodNotAllowed, "GET only")
+		return
+	}
+	docID := r.PathValue("id")
+	threshold, err := overlapThresholdFromQuery(r.URL.Query().Get("overlap_iou"))
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var exists bool
+	err = db.QueryRowContext(r.Context(), "SELECT EXISTS (SELECT 1 FROM documents WHERE document_id = $1)", docID).Scan(&exists)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Validation query failed", "document_id", docID, "error", err)
+		jsonError(w, http.StatusInternalServerError, "Query failed")
+		return
+	}
+	if !exists {
+		problemError(w, http.StatusNotFound, codeDocumentNotFound, "Document not found")
+		return
+	}
+
+	graph, texts := loadAnnotations(r.Context(), docID)
+	issues := append(validateGraph(graph), findOverlaps(graph.Components, texts, threshold)...)
+	for _, t := range texts {
+		if !t.IsIgnored {
+			issues = append(issues, checkValues(t.ID, t.LabelName, t.Values, t.Page)...)
+		}
+	}
+	counts := map[string]int{}
+	errCount := 0
+	for _, is := range issues {
+		counts[is.Code]++
+		if is.Severity == "error" {
+			errCount++
+		}
+	}
+	jsonResponse(w, http.StatusOK, map[string]interface{}{
+		"document_id": docID,
+		"valid":       errCount == 0,
+		"counts":      counts,
+		"issues":      issues,
+	})
+}
+
+// ---------- Submission Validation ----------
+
+// annotationTypes are the annotation types /submit knows how to store
+var annotationTypes = []string{"box", "node", "connection", "line", "text", "region"}
+
+// validateAnnotations checks each submitted annotation on its own before anything touches the
+// database: known type, the fields that type requires, and well-formed coordinates. Every problem
+// is reported, not just the first. With clamp set, negative coordinates are left for
+// checkAnnotationBounds to pull onto the image.
+func validateAnnotations(anns []RawAnnotation, numPages int, clamp bool) []FieldError {
+	errs := []FieldError{}
+	seen := map[string]bool{}
+	for i := range anns {
+		ann := &anns[i]
+		add := func(field, code, msg string) {
+			fe := FieldError{AnnotationID: ann.ID, Field: field, Code: code, Message: msg}
+			if ann.ID == "" {
+				fe.Field = fmt.Sprintf("annotations[%d].%s", i, field)
+			}
+			errs = append(errs, fe)
+		}
+
+		switch {
+		case ann.ID == "":
+			add("id", codeSchemaViolation, "is required")
+		case seen[ann.ID]:
+			add("id", codeSchemaViolation, "is used by more than one annotation")
+		}
+		seen[ann.ID] = true
+
+		if ann.Page < 1 || ann.Page > numPages {
+			add("page", codeInvalidPage, fmt.Sprintf("%d is not between 1 and %d", ann.Page, numPages))
+		}
+
+		switch ann.Type {
+		case "box", "region", "text":
+			if len(ann.BBox) == 0 {
+				add("bbox", codeInvalidBBox, "is required for a "+ann.Type)
+			} else if msg := checkBoxShape(ann.BBox, clamp); msg != "" {
+				add("bbox", codeInvalidBBox, msg)
+			}
+		case "node":
+			switch {
+			case len(ann.Position) == 0:
+				add("position", codeInvalidPosition, "is required for a node")
+			case len(ann.Position) != 2:
+				add("position", codeInvalidPosition, "must be [x, y]")
+			case !clamp && (ann.Position[0] < 0 || ann.Position[1] < 0):
+				add("position", codeInvalidPosition, "must not be negative")
+			}
+		case "connection":
+			if ann.SourceID == "" {
+				add("source_id", codeSchemaViolation, "is required for a connection")
+			}
+			if ann.TargetID == "" {
+				add("target_id", codeSchemaViolation, "is required for a connection")
+			}
+		case "line":
+			pts, shape := parsePoints(ann.Points)
+			switch {
+			case ann.Points == nil:
+				add("points", codeSchemaViolation, "is required for a line")
+			case shape != pointsWellFormed:
+				add("points", codeSchemaViolation, "must be a list of {x, y} or [x, y] points")
+			case len(pts) < 2:
+				add("points", codeSchemaViolation, "must have at least 2 points")
+			}
+		default:
+			add("type", codeSchemaViolation, fmt.Sprintf("%q is not one of %s", ann.Type, strings.Join(annotationTypes, ", ")))
+		}
+
+		// transcription_box is [x, y, width, height]
+		if tb := ann.TranscriptionBox; len(tb) > 0 && (len(tb) != 4 || tb[2] < 0 || tb[3] < 0) {
+			add("transcription_box", codeSchemaViolation, "must be [x, y, width, height] with non-negative size")
+		}
+	}
+	return errs
+}
+
+// checkBoxShape describes what is wrong with an [x1, y1, x2, y2] box regardless of page size,
+// or returns ""
+func checkBoxShape(box []int, clamp bool) string {
+	if len(box) != 4 {
+		return fmt.Sprintf("%v must have 4 values", box)
+	}
+	if box[0] > box[2] || box[1] > box[3] {
+		return fmt.Sprintf("%v has x1 > x2 or y1 > y2", box)
+	}
+	if !clamp && (box[0] < 0 || box[1] < 0) {
+		return fmt.Sprintf("%v must not have negative coordinates", box)
+	}
+	return ""
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestValidateAnnotations(t *testing.T) {
+	points := func(s string) interface{} {
+		var v interface{}
+		if err := json.Unmarshal([]byte(s), &v); err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	tests := []struct {
+		name  string
+		anns  []RawAnnotation
+		clamp bool
+		want  []string // field/code of each error, in order
+	}{
+		{"valid annotations", []RawAnnotation{
+			{ID: "b", Type: "box", Page: 1, BBox: []int{0, 0, 10, 10}},
+			{ID: "t", Type: "text", Page: 2, BBox: []int{0, 0, 10, 10}, TranscriptionBox: []int{0, 0, 5, 5}},
+			{ID: "r", Type: "region", Page: 1, BBox: []int{0, 0, 10, 10}},
+			{ID: "n", Type: "node", Page: 1, Position: []int{3, 4}},
+			{ID: "c", Type: "connection", Page: 1, SourceID: "b", TargetID: "n"},
+			{ID: "l", Type: "line", Page: 1, Points: points(`[{"x":0,"y":0},[5,5]]`)},
+		}, false, nil},
+		{"missing id is reported by index", []RawAnnotation{
+			{Type: "node", Page: 1, Position: []int{1, 1}},
+			{ID: "n", Type: "node", Page: 1},
+		}, false, []string{"annotations[0].id/SCHEMA_VIOLATION", "position/INVALID_POSITION"}},
+		{"duplicate id", []RawAnnotation{
+			{ID: "a", Type: "node", Page: 1, Position: []int{1, 1}},
+			{ID: "a", Type: "node", Page: 1, Position: []int{2, 2}},
+		}, false, []string{"id/SCHEMA_VIOLATION"}},
+		{"page out of range", []RawAnnotation{
+			{ID: "a", Type: "node", Page: 0, Position: []int{1, 1}},
+			{ID: "b", Type: "node", Page: 3, Position: []int{1, 1}},
+		}, false, []string{"page/INVALID_PAGE", "page/INVALID_PAGE"}},
+		{"unknown type", []RawAnnotation{{ID: "a", Type: "circle", Page: 1}}, false, []string{"type/SCHEMA_VIOLATION"}},
+		{"box fields", []RawAnnotation{
+			{ID: "a", Type: "box", Page: 1},
+			{ID: "b", Type: "box", Page: 1, BBox: []int{1, 2, 3}},
+			{ID: "c", Type: "box", Page: 1, BBox: []int{10, 0, 5, 5}},
+			{ID: "d", Type: "box", Page: 1, BBox: []int{-1, 0, 5, 5}},
+		}, false, []string{"bbox/INVALID_BBOX", "bbox/INVALID_BBOX", "bbox/INVALID_BBOX", "bbox/INVALID_BBOX"}},
+		{"negative coordinates are left to clamping", []RawAnnotation{
+			{ID: "d", Type: "box", Page: 1, BBox: []int{-1, 0, 5, 5}},
+			{ID: "n", Type: "node", Page: 1, Position: []int{-1, 4}},
+		}, true, nil},
+		{"node position", []RawAnnotation{
+			{ID: "a", Type: "node", Page: 1, Position: []int{1}},
+			{ID: "b", Type: "node", Page: 1, Position: []int{1, -1}},
+		}, false, []string{"position/INVALID_POSITION", "position/INVALID_POSITION"}},
+		{"connection endpoints", []RawAnnotation{{ID: "a", Type: "connection", Page: 1}}, false,
+			[]string{"source_id/SCHEMA_VIOLATION", "target_id/SCHEMA_VIOLATION"}},
+		{"line points", []RawAnnotation{
+			{ID: "a", Type: "line", Page: 1},
+			{ID: "b", Type: "line", Page: 1, Points: points(`"0,0 5,5"`)},
+			{ID: "c", Type: "line", Page: 1, Points: points(`[[0,0],[5,"x"]]`)},
+			{ID: "d", Type: "line", Page: 1, Points: points(`[[0,0]]`)},
+			{ID: "e", Type: "line", Page: 1, Points: points(`[]`)},
+		}, false, []string{"points/SCHEMA_VIOLATION", "points/SCHEMA_VIOLATION", "points/SCHEMA_VIOLATION",
+			"points/SCHEMA_VIOLATION", "points/SCHEMA_VIOLATION"}},
+		{"transcription box", []RawAnnotation{
+			{ID: "a", Type: "text", Page: 1, BBox: []int{0, 0, 5, 5}, TranscriptionBox: []int{0, 0, 5}},
+			{ID: "b", Type: "text", Page: 1, BBox: []int{0, 0, 5, 5}, TranscriptionBox: []int{0, 0, -5, 5}},
+		}, false, []string{"transcription_box/SCHEMA_VIOLATION", "transcription_box/SCHEMA_VIOLATION"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, fe := range validateAnnotations(tt.anns, 2, tt.clamp) {
+				got = append(got, fmt.Sprintf("%s/%s", fe.Field, fe.Code))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
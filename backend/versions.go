@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ---------- Document Versions ----------
+
+// Uploading into a document that already exists (/upload?document_id=, or the same file name
+// with DOCUMENT_ID_MODE=filename) never replaces its file silently; it answers 409
+// DOCUMENT_EXISTS unless the upload says what to do:
+//
+//	?overwrite=true     replace the file in place; annotations stay and the replaced file is kept
+//	                    as a numbered version
+//	?new_version=true   upload a new document that supersedes the existing one, which is archived
+//	                    with its annotations untouched
+//
+//	GET /documents/{id}/versions   the files a document had before, oldest first
+
+type DocumentVersion struct {
+	Version          int             `json:"version"`
+	ImageFile        string          `json:"image_file"`
+	OriginalFilename string          `json:"original_filename,omitempty"`
+	OriginalFormat   string          `json:"original_format,omitempty"`
+	NumPages         int             `json:"num_pages"`
+	SHA256           string          `json:"sha256"`
+	SizeBytes        int64           `json:"size_bytes"`
+	Pages            json.RawMessage `json:"pages"`
+	ReplacedBy       string          `json:"replaced_by,omitempty"`
+	ReplacedAt       string          `json:"replaced_at"`
+}
+
+// DocumentExistsError is returned by SaveDocument when the document is already there and the
+// upload does not overwrite it
+type DocumentExistsError struct {
+	DocumentID string
+}
+
+func (e *DocumentExistsError) Error() string {
+	return fmt.Sprintf("document %s already exists", e.DocumentID)
+}
+
+// documentExistsError writes err as a problem response when it is a DocumentExistsError
+func documentExistsError(w http.ResponseWriter, err error) bool {
+	var de *DocumentExistsError
+	if !errors.As(err, &de) {
+		return false
+	}
+	writeProblem(w, Problem{
+		Status:     http.StatusConflict,
+		Code:       codeDocumentExists,
+		Detail:     de.Error() + "; pass overwrite=true to replace its file or new_version=true to upload a new version",
+		DocumentID: de.DocumentID,
+	})
+	return true
+}
+
+// recordVersion copies the current file of docID into document_versions and returns its number
+func recordVersion(ctx context.Context, tx pgx.Tx, docID, replacedBy string) (int, error) {
+	var version int
+	err := tx.QueryRow(ctx, `
+		INSERT INTO document_versions (document_id, version, image_file, pdf_file, original_format, original_filename,
+			num_pages, width, height, sha256, size_bytes, storage_key, pages, replaced_by)
+		SELECT d.document_id, COALESCE((SELECT max(version) FROM document_versions v WHERE v.document_id = d.document_id), 0) + 1,
+			d.image_file, d.pdf_file, d.original_format, d.original_filename, d.num_pages, d.width, d.height, d.sha256,
+			d.size_bytes, d.storage_key,
+			COALESCE((SELECT jsonb_agg(jsonb_build_object('page_number', p.page_number, 'image_file', p.image_file,
+				'width', p.width, 'height', p.height, 'storage_key', p.storage_key, 'sha256', p.sha256) ORDER BY p.page_number)
+				FROM pages p WHERE p.document_id = d.document_id), '[]'),
+			NULLIF($2, '')
+		FROM documents d WHERE d.document_id = $1
+		RETURNING version`, docID, replacedBy).Scan(&version)
+	return version, err
+}
+
+// supersede archives old now that doc replaces it
+func supersede(ctx context.Context, tx pgx.Tx, old string, doc *StoredDocument) error {
+	if _, err := tx.Exec(ctx, "UPDATE documents SET status = 'archived' WHERE document_id = $1", old); err != nil {
+		return fmt.Errorf("archiving superseded document: %w", err)
+	}
+	return enqueueEvents(ctx, tx, newEvent("document.superseded", old, map[string]string{
+		"superseded_by": doc.DocumentID, "uploaded_by": doc.Uploader,
+	}))
+}
+
+// handleDocumentVersions lists the files a document was uploaded with before:
+// GET /documents/{id}/versions
+func handleDocumentVersions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		jsonError(w, http.StatusMethodNotAllowed, "GET only")
+		return
+	}
+	docID := r.PathValue("id")
+	var supersedes, current string
+	err := readPool(r.Context()).QueryRow(r.Context(), `
+		SELECT COALESCE(supersedes, ''), COALESCE((SELECT document_id FROM documents n WHERE n.supersedes = d.document_id LIMIT 1), '')
+		FROM documents d WHERE document_id = $1`, docID).Scan(&supersedes, &current)
+	if errors.Is(err, pgx.ErrNoRows) {
+		problemError(w, http.StatusNotFound, codeDocumentNotFound, "Document not found")
+		return
+	}
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "Query failed")
+		return
+	}
+
+	rows, err := readPool(r.Context()).Query(r.Context(), `
+		SELECT version, image_file, COALESCE(original_filename, ''), COALESCE(original_format, ''), COALESCE(num_pages, 1),
+			COALESCE(sha256, ''), COALESCE(size_bytes, 0), pages, COALESCE(replaced_by, ''), replaced_at
+		FROM document_versions WHERE document_id = $1 ORDER BY version`, docID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "Query failed")
+		return
+	}
+	versions, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (DocumentVersion, error) {
+		var v DocumentVersion
+		var replaced time.Time
+		err := row.Scan(&v.Version, &v.ImageFile, &v.OriginalFilename, &v.OriginalFormat, &v.NumPages, &v.SHA256,
+			&v.SizeBytes, &v.Pages, &v.ReplacedBy, &replaced)
+		v.ReplacedAt = replaced.UTC().Format(time.RFC3339)
+		return v, err
+	})
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "Query failed")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]interface{}{
+		"document_id":   docID,
+		"supersedes":    supersedes,
+		"superseded_by": current,
+		"versions":      versions,
+		"count":         len(versions),
+	})
+}
@@ -1,4 +1,4 @@
-import React, { useState, useCallback } from 'react';
+import React, { useState, useCallback, useEffect } from 'react';
 import { v4 as uuidv4 } from 'uuid';
 import { FileUpload } from './components/FileUpload';
 import { ImageViewer } from './components/ImageViewer';
@@ -12,6 +12,9 @@ import { SuccessToast } from './components/SuccessToast';
 import type { Annotation } from './types';
 
 
+// Well inside the server's HEARTBEAT_TIMEOUT (2 minutes by default)
+const HEARTBEAT_INTERVAL_MS = 30_000;
+
 function App() {
   const [imgFile, setImgFile] = useState<File | null>(null);
   const [annotations, setAnnotations] = useState<Annotation[]>([]);
@@ -62,6 +65,45 @@ function App() {
 
   const closeModal = useCallback(() => setModal(prev => ({ ...prev, isOpen: false })), []);
 
+  // Annotation time is tracked server-side: a session runs while a document is open, and
+  // heartbeats hold the document so it is released if this tab dies without stopping
+  useEffect(() => {
+    if (!documentId) return;
+    const base = `http://localhost:5001/api/v1/documents/${documentId}`;
+    const send = (event: 'start' | 'stop') =>
+      fetch(`${base}/sessions`, {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ event }),
+        keepalive: true
+      }).catch(err => console.error(`Session ${event} failed:`, err));
+
+    const heartbeat = async () => {
+      try {
+        const response = await fetch(`${base}/heartbeat`, { method: 'POST' });
+        if (response.status === 409) {
+          console.warn('Document is open elsewhere:', await response.json());
+          return;
+        }
+        // The server ends sessions that went quiet (e.g. a suspended laptop); start a new one
+        const hb = await response.json();
+        if (response.ok && !hb.session_id) send('start');
+      } catch (err) {
+        console.error('Heartbeat failed:', err);
+      }
+    };
+
+    send('start').then(heartbeat);
+    const timer = window.setInterval(heartbeat, HEARTBEAT_INTERVAL_MS);
+    const stop = () => send('stop');
+    window.addEventListener('pagehide', stop);
+    return () => {
+      window.clearInterval(timer);
+      window.removeEventListener('pagehide', stop);
+      stop();
+    };
+  }, [documentId]);
+
   // When adding, we expect the annotation to already have x, y, width, height, AND page.
   // We only add the ID and Label here.
   const handleAddAnnotation = useCallback((rect: Omit<Annotation, 'id' | 'label'>) => {
@@ -143,7 +185,7 @@ function App() {
 
     try {
       const [response] = await Promise.all([
-        fetch('http://localhost:5001/upload', {
+        fetch('http://localhost:5001/api/v1/upload', {
           method: 'POST',
           body: formData,
         }),
@@ -162,7 +204,7 @@ function App() {
         setAnnotations([]); // Clear annotations
         setPhase('annotation'); // Reset phase
       } else {
-        alert(`Upload failed: ${data.error}`);
+        alert(`Upload failed: ${data.detail}${data.request_id ? ` (request ${data.request_id})` : ''}`);
       }
     } catch (error) {
       console.error(error);
@@ -216,7 +258,7 @@ function App() {
     };
 
     try {
-      const response = await fetch('http://localhost:5001/submit', {
+      const response = await fetch('http://localhost:5001/api/v1/submit', {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
         body: JSON.stringify(payload)
@@ -235,7 +277,7 @@ function App() {
         setPageImages([]);
         setPhase('annotation');
       } else {
-        alert(`Save failed: ${data.error}`);
+        alert(`Save failed: ${data.detail}${data.request_id ? ` (request ${data.request_id})` : ''}`);
       }
     } catch (error) {
       console.error(error);